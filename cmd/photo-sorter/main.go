@@ -1,30 +1,42 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"photo-sorter-go/internal/compressor"
 	"photo-sorter-go/internal/config"
 	"photo-sorter-go/internal/extractor"
+	"photo-sorter-go/internal/history"
 	"photo-sorter-go/internal/logger"
+	"photo-sorter-go/internal/naming"
 	"photo-sorter-go/internal/organizer"
 	"photo-sorter-go/internal/statistics"
+	"photo-sorter-go/internal/trash"
 	"photo-sorter-go/internal/web"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"github.com/spf13/pflag"
 )
 
 var (
 	cfgFile   string
-	sourceDir string
+	profile   string
 	targetDir string
 	dryRun    bool
 	verbose   bool
@@ -32,11 +44,48 @@ var (
 	version   string
 	buildTime string
 	port      int
+	insecure  bool
+	bindAddr  string
+	tlsCert   string
+	tlsKey    string
+	webRoot   string
+	olderThan string
+	resume    bool
+	assumeYes bool
+	planFile  string
+	nice      bool
+	filesFrom string
+	report    bool
+	force     bool
+
+	sourceDirs []string // --source, repeatable
+
+	showOrigins bool // config show --origins
+
+	reportFile string
+	errorsFile string
+	statsFile  string
+
+	historyLimit int
+	historyKeep  int
+
+	estimateEvery     int
+	compressQuality   int
+	compressThreshold float64
+	compressFormats   []string
+	compressInPlace   bool
+	compressForce     bool
+)
+
+// Limits applied by --nice, chosen to leave a shared disk usable for others.
+const (
+	niceFilesPerSecond = 10
+	niceBytesPerSecond = "10MB"
 )
 
 // rootCmd is the base command for the CLI.
 var rootCmd = &cobra.Command{
-	Use:   "photo-sorter",
+	Use:   "photo-sorter [directory | files...]",
 	Short: "Automatically organize photos and videos by date",
 	Long: `PhotoSorter is a tool that automatically organizes your photos and videos
 by extracting date information from EXIF metadata and sorting them into
@@ -50,6 +99,21 @@ Features:
 - Duplicate handling strategies
 - Dry-run mode for safe testing
 - Comprehensive logging and statistics`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runOrganize(args)
+	},
+}
+
+// organizeCmd organizes a directory or individual files; the same as running
+// photo-sorter without a command.
+var organizeCmd = &cobra.Command{
+	Use:   "organize [directory | files...]",
+	Short: "Organize a directory or individual files by date",
+	Long: `Organizes the media files in a directory, or only the given files. With
+--files-from, the files are read from a list (one path per line, "-" for stdin)
+and the source directory is not scanned.`,
+	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runOrganize(args)
 	},
@@ -96,41 +160,355 @@ Access the interface at http://localhost:<port> (default: 8080)`,
 	},
 }
 
+// planCmd writes the operations a run would perform to a plan file.
+var planCmd = &cobra.Command{
+	Use:   "plan [directory]",
+	Short: "Write the planned operations to a file for review",
+	Long: `Decides what would be done with every media file, like a dry run, and writes
+the operations as JSON lines ({source, target, action, date, date_source, ...}).
+The plan can be reviewed or edited and then executed with "apply".`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPlan(args)
+	},
+}
+
+// applyCmd executes a plan written by planCmd.
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan.json>",
+	Short: "Execute exactly the operations of a plan file",
+	Long: `Executes the operations of a plan written by "plan". Each source is checked
+to still exist with the size and modification time recorded in the plan; entries
+that no longer match are reported and left alone.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runApply(args[0])
+	},
+}
+
+// watchCmd keeps organizing files as they appear in the source directory.
+var watchCmd = &cobra.Command{
+	Use:   "watch [directory]",
+	Short: "Continuously organize new files as they appear",
+	Long: `Watches the source directory (including new subdirectories) and organizes
+files shortly after they appear, once their size has stopped changing for
+watch.settle_period. Files already present when watching starts are left alone;
+run the main command once to organize them. Stop with Ctrl+C.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runWatch(args)
+	},
+}
+
+// pruneIdenticalCmd deletes sources recorded as identical duplicates in a report.
+var pruneIdenticalCmd = &cobra.Command{
+	Use:   "prune-identical",
+	Short: "Delete skipped duplicates that are identical to the organized file",
+	Long: `Reads the journal, a report written with --report-file by a run with
+duplicate_handling "skip" and verify_identical_skips, and deletes the source
+files recorded as identical to the file already in the target. Each file is
+compared with its target again before it is deleted; files that changed since
+are kept.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPruneIdentical()
+	},
+}
+
+// compressCmd compresses the images and videos in a directory.
+var compressCmd = &cobra.Command{
+	Use:   "compress [directory]",
+	Short: "Compress images and videos with the compressor settings",
+	Long: `Compresses the images (and, with compressor.video.formats, the videos) in
+the source directory according to the compressor section of the config and
+writes them to the target directory. Files already compressed by PhotoSorter
+are skipped. Ctrl+C stops after the files being compressed.
+
+Prints a line per file, or only the totals with --quiet, and exits with an
+error status if any file failed, so that it can run from cron.
+
+With --dry-run, images are encoded in memory and the projected savings are
+printed, without writing anything. --estimate N encodes only every N-th image
+and estimates the others from them, for very large trees.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Failed files are reported by the command itself; usage would only
+		// clutter the output of cron jobs.
+		cmd.SilenceUsage = true
+		return runCompress(args)
+	},
+}
+
+// statsCmd groups commands that work with the statistics written by --stats-file.
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Work with run statistics written by --stats-file",
+}
+
+// statsDiffCmd compares the statistics of two runs.
+var statsDiffCmd = &cobra.Command{
+	Use:   "diff <before.json> <after.json>",
+	Short: "Compare the statistics of two runs",
+	Long: `Compares two statistics files written with --stats-file and prints the
+counters that changed and warnings about suspicious differences, such as a run
+organizing fewer files than the scan, plan or dry run before it would have, or
+errors of kinds the first run did not have.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStatsDiff(args[0], args[1])
+	},
+}
+
+// historyCmd lists the runs recorded in the run history.
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past runs",
+	Long: `Lists the last runs of organize, scan, plan, apply and compress, newest
+first, with the files they organized, their errors and duration. Every run
+records a summary in history.directory (default ~/.photo-sorter/history).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistoryList()
+	},
+}
+
+// historyListCmd is historyCmd as a subcommand.
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List past runs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistoryList()
+	},
+}
+
+// historyShowCmd prints one run of the run history.
+var historyShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show the options and statistics of a past run",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistoryShow(args[0])
+	},
+}
+
+// historyPruneCmd removes old runs from the run history.
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old runs from the history",
+	Long: `Removes the runs beyond the --keep newest, and with --older-than those
+older than the given age (e.g. 90d).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistoryPrune()
+	},
+}
+
+// configCmd groups commands that work with the configuration.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the configuration",
+}
+
+// configInitCmd writes a starter config file.
+var configInitCmd = &cobra.Command{
+	Use:   "init [file]",
+	Short: "Write a config file with the default settings",
+	Long: `Writes a config file (default ./config.yaml) with every setting at its
+default value and a comment explaining it. An existing file is only replaced
+with --force.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConfigInit(args)
+	},
+}
+
+// configShowCmd prints the effective configuration.
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration, with --profile applied",
+	Long: `Prints the configuration the other commands would use, as YAML: the config
+file and environment variables over the defaults, the --profile, if given,
+over them, and --source and --target over all. Secrets are left out. With
+--origins, each setting is followed by where it comes from: default, file,
+env, profile or flag.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConfigShow()
+	},
+}
+
+// configEnvCmd lists the environment variables that set settings.
+var configEnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "List the environment variables that set settings",
+	Long: `Lists the PHOTO_SORTER_* environment variables that override the settings
+of the config file, one per setting, with the value in effect. Variables set
+in the environment are marked with *. Lists are separated by commas; secrets
+are hidden.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConfigEnv()
+	},
+}
+
+// configValidateCmd checks a config file.
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check a config file and list all its problems",
+	Long: `Loads the config file (default: the one the other commands use), with the
+--profile laid over it, and lists every problem with it, such as a missing
+source directory, a compressor quality out of range or an invalid exclude
+pattern. Settings that are not known are listed as warnings. Exits with an
+error status if there are problems.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true // the problems are listed by the command
+		return runConfigValidate(args)
+	},
+}
+
+// trashCmd groups commands that manage the trash directory.
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage files moved to the trash by overwrite_to_trash",
+}
+
+// trashEmptyCmd removes old trash sessions.
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Permanently delete trashed files",
+	Long: `Permanently deletes files that were moved to .photo-sorter-trash under the
+target directory. With --older-than, only runs older than the given age are
+removed (e.g. 30d, 2w, 12h).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTrashEmpty(args)
+	},
+}
+
 func init() {
-	cobra.OnInitialize(initConfig)
+	rootCmd.Version = versionString()
+	if buildTime != "" {
+		rootCmd.SetVersionTemplate("photo-sorter {{.Version}} (built " + buildTime + ")\n")
+	} else {
+		rootCmd.SetVersionTemplate("photo-sorter {{.Version}}\n")
+	}
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "profile of the config file to lay over its other settings")
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "enable verbose logging")
 	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "suppress non-error output")
 
-	rootCmd.Flags().StringVar(&sourceDir, "source", "", "source directory containing media files")
+	rootCmd.Flags().StringArrayVar(&sourceDirs, "source", nil, "source directory containing media files (repeat to organize several in one run)")
 	rootCmd.Flags().StringVar(&targetDir, "target", "", "target directory for organized files (default: organize in place)")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "simulate organization without making changes")
+	rootCmd.Flags().BoolVar(&assumeYes, "yes", false, "start without asking for confirmation")
+	rootCmd.Flags().BoolVar(&nice, "nice", false, "throttle the run (one worker, at most 10 files and 10MB per second)")
+	rootCmd.Flags().BoolVar(&resume, "continue", false, "continue after the last file of the previous run capped by max_files_per_run")
+	rootCmd.Flags().StringVar(&filesFrom, "files-from", "", "organize the files listed in this file, one per line (\"-\" for stdin)")
+	rootCmd.Flags().BoolVar(&report, "report", false, "print how many files were placed in each target directory and the busiest date folders")
+	rootCmd.Flags().StringVar(&reportFile, "report-file", "", "write what was done with each file to this JSON or CSV (.csv) file")
+	rootCmd.Flags().StringVar(&errorsFile, "errors-file", "", "write every recorded error with the counts by operation to this JSON file")
+	rootCmd.Flags().StringVar(&statsFile, "stats-file", "", "write the counters of the run to this JSON file, for \"stats diff\"")
+	rootCmd.Flags().BoolVar(&force, "force", false, "start even if the files may not fit on the target filesystem")
+	organizeCmd.Flags().AddFlagSet(rootCmd.Flags())
+	scanCmd.Flags().StringVar(&reportFile, "report-file", "", "write what would be done with each file to this JSON or CSV (.csv) file")
+	scanCmd.Flags().BoolVar(&report, "report", false, "print how many files would be placed in each target directory and the busiest date folders")
+	scanCmd.Flags().StringVar(&errorsFile, "errors-file", "", "write every recorded error with the counts by operation to this JSON file")
+	scanCmd.Flags().StringVar(&statsFile, "stats-file", "", "write the counters of the run to this JSON file, for \"stats diff\"")
 
 	serveCmd.Flags().IntVar(&port, "port", 8080, "port to run web server on")
+	serveCmd.Flags().StringVar(&bindAddr, "bind", "", "address to listen on, e.g. 0.0.0.0 for all interfaces (default: web.bind_address, 127.0.0.1)")
+	serveCmd.Flags().BoolVar(&insecure, "insecure-bind", false, "allow listening on other addresses than 127.0.0.1 without web authentication")
+	serveCmd.Flags().StringVar(&tlsCert, "tls-cert", "", "certificate file for HTTPS (default: web.tls.cert_file)")
+	serveCmd.Flags().StringVar(&tlsKey, "tls-key", "", "private key file for HTTPS (default: web.tls.key_file)")
+	serveCmd.Flags().StringVar(&webRoot, "web-root", "", "serve the web interface from this directory (with templates/ and static/) instead of the built-in files, for development")
+
+	compressCmd.Flags().StringVar(&targetDir, "target", "", "directory for compressed files (default: from config, else the source directory)")
+	compressCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be compressed and the projected savings without writing files")
+	compressCmd.Flags().IntVar(&estimateEvery, "estimate", 0, "dry run encoding only every N-th image and estimating the rest")
+	compressCmd.Flags().IntVar(&compressQuality, "quality", 0, "JPEG/WebP quality 1-100, for all formats (default: from config)")
+	compressCmd.Flags().Float64Var(&compressThreshold, "threshold", 0, "keep the original if the compressed file is not smaller than original x threshold (default: from config)")
+	compressCmd.Flags().StringSliceVar(&compressFormats, "formats", nil, "extensions to compress, e.g. .jpg,.png (default: from config)")
+	compressCmd.Flags().BoolVar(&compressInPlace, "in-place", false, "replace the files with their compressed versions instead of writing to --target")
+	compressCmd.Flags().BoolVar(&compressForce, "force", false, "compress again images that are unchanged since an earlier run into --target")
+	compressCmd.Flags().StringVar(&reportFile, "report-file", "", "write the result for each file to this JSON file")
+
+	trashEmptyCmd.Flags().StringVar(&targetDir, "target", "", "target directory containing the trash (default: from config)")
+	trashEmptyCmd.Flags().StringVar(&olderThan, "older-than", "", "only delete runs older than this age (e.g. 30d)")
+	trashCmd.AddCommand(trashEmptyCmd)
+
+	pruneIdenticalCmd.Flags().StringVar(&reportFile, "journal", "", "report of the run that skipped the duplicates (JSON or CSV)")
+	pruneIdenticalCmd.Flags().BoolVar(&dryRun, "dry-run", false, "only list the files that would be deleted")
+	pruneIdenticalCmd.MarkFlagRequired("journal")
+	// --report-file, the flag that wrote the journal, names it too.
+	pruneIdenticalCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "report-file" {
+			name = "journal"
+		}
+		return pflag.NormalizedName(name)
+	})
+
+	watchCmd.Flags().StringArrayVar(&sourceDirs, "source", nil, "source directory to watch")
+	watchCmd.Flags().StringVar(&targetDir, "target", "", "target directory for organized files (default: organize in place)")
+	watchCmd.Flags().BoolVar(&dryRun, "dry-run", false, "log what would be done without making changes")
+	watchCmd.Flags().BoolVar(&nice, "nice", false, "throttle organizing (one worker, at most 10 files and 10MB per second)")
 
+	planCmd.Flags().StringVar(&targetDir, "target", "", "target directory for organized files (default: organize in place)")
+	planCmd.Flags().StringVarP(&planFile, "output", "o", "plan.json", "file to write the plan to")
+	planCmd.Flags().StringVar(&statsFile, "stats-file", "", "write the counters of the run to this JSON file, for \"stats diff\"")
+	applyCmd.Flags().StringVar(&targetDir, "target", "", "target directory (used for the trash and empty-directory cleanup)")
+	applyCmd.Flags().StringVar(&errorsFile, "errors-file", "", "write every recorded error with the counts by operation to this JSON file")
+	applyCmd.Flags().StringVar(&statsFile, "stats-file", "", "write the counters of the run to this JSON file, for \"stats diff\"")
+	statsCmd.AddCommand(statsDiffCmd)
+
+	historyCmd.Flags().IntVar(&historyLimit, "limit", 50, "number of runs to list (0 for all)")
+	historyListCmd.Flags().IntVar(&historyLimit, "limit", 50, "number of runs to list (0 for all)")
+	historyPruneCmd.Flags().IntVar(&historyKeep, "keep", 0, "number of newest runs to keep (0 for all)")
+	historyPruneCmd.Flags().StringVar(&olderThan, "older-than", "", "remove runs older than this age (e.g. 90d)")
+	historyCmd.AddCommand(historyListCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	historyCmd.AddCommand(historyPruneCmd)
+
+	configInitCmd.Flags().BoolVar(&force, "force", false, "replace an existing file")
+	configShowCmd.Flags().BoolVar(&showOrigins, "origins", false, "show where each setting comes from")
+	configShowCmd.Flags().StringArrayVar(&sourceDirs, "source", nil, "source directory, as for organize (repeatable)")
+	configShowCmd.Flags().StringVar(&targetDir, "target", "", "target directory, as for organize")
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configEnvCmd)
+	configCmd.AddCommand(configValidateCmd)
+
+	rootCmd.AddCommand(organizeCmd)
 	rootCmd.AddCommand(scanCmd)
 	rootCmd.AddCommand(testExifCmd)
 	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(trashCmd)
+	rootCmd.AddCommand(pruneIdenticalCmd)
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(compressCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(configCmd)
 }
 
-// initConfig loads configuration file and environment variables.
-func initConfig() {
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
-	} else {
-		viper.SetConfigName("config")
-		viper.SetConfigType("yaml")
-		viper.AddConfigPath(".")
-		viper.AddConfigPath("$HOME/.photo-sorter")
-		viper.AddConfigPath("/etc/photo-sorter")
+// versionString returns the version set at build time, or "dev".
+func versionString() string {
+	if version == "" {
+		return "dev"
 	}
+	return version
+}
 
-	viper.AutomaticEnv()
-
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintf(os.Stderr, "Using config file: %s\n", viper.ConfigFileUsed())
+// loadStructure loads the --config file, or the one found in the usual
+// places, with the --profile laid over it, only checking its structure: the
+// directories need not be set or exist.
+func loadStructure() (*config.Config, error) {
+	cfg, err := config.LoadStructure(cfgFile, profile)
+	if err == nil && cfg.File() != "" {
+		fmt.Fprintf(os.Stderr, "Using config file: %s\n", cfg.File())
 	}
+	return cfg, err
 }
 
 // runOrganize executes the main organization logic.
@@ -143,26 +521,348 @@ func runOrganize(args []string) error {
 	if dryRun {
 		cfg.Security.DryRun = true
 	}
+	if resume {
+		cfg.Security.ContinueFromCursor = true
+	}
+	if nice {
+		applyNicePreset(cfg)
+	}
+	if force {
+		cfg.Security.CheckDiskSpace = false
+	}
+
+	paths, err := explicitFiles(args)
+	if err != nil {
+		return err
+	}
 
 	log := setupLogger(cfg)
 	stats := statistics.NewStatistics()
-	dateExtractor := extractor.NewEXIFExtractor(log)
+	dateExtractor := extractor.NewDefaultExtractor(log)
 
 	compressor := compressor.NewDefaultCompressor()
 	org := organizer.NewFileOrganizer(cfg, log, stats, dateExtractor, compressor)
-
-	err = org.OrganizeFiles()
+	if paths != nil {
+		org.SetPaths(paths)
+	}
+	finishReport, err := startReport(org, cfg)
 	if err != nil {
-		return fmt.Errorf("organization failed: %w", err)
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.Security.ConfirmBeforeStart && !cfg.Security.DryRun && !assumeYes {
+		// The summary needs every file, so discovery finishes before anything is processed.
+		files, err := org.DiscoverFiles()
+		if err != nil {
+			return fmt.Errorf("organization failed: %w", err)
+		}
+		if len(files) > 0 {
+			space, err := org.CheckSpace(files)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			printPreflight(cfg, org, files, space)
+			if space != nil && !space.Sufficient() {
+				return fmt.Errorf("%w: %s (rerun with --force to start anyway)", organizer.ErrInsufficientSpace, space)
+			}
+			if err := confirmStart(); err != nil {
+				return err
+			}
+		}
+		err = org.ProcessDiscoveredFiles(ctx, files)
+	} else {
+		err = org.OrganizeFiles(ctx)
 	}
+	if reportErr := finishReport(); reportErr != nil && err == nil {
+		err = reportErr
+	}
+	if errorsErr := writeErrorsFile(stats); errorsErr != nil && err == nil {
+		err = errorsErr
+	}
+	if statsErr := writeStatsFile(stats, "organize"); statsErr != nil && err == nil {
+		err = statsErr
+	}
+	recordRun(cfg, "organize", stats.Snapshot("organize"), err)
 
 	if !quiet {
 		fmt.Println("\n" + stats.GetSummary())
+		printFileDetails(stats)
+		printErrorSummary(stats)
+	}
+	if report {
+		printReport(stats)
+	}
+	printRepeatSummary(log)
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("organization interrupted")
+	}
+	if errors.Is(err, organizer.ErrInsufficientSpace) {
+		return fmt.Errorf("%w (rerun with --force to start anyway)", err)
+	}
+	if err != nil {
+		return fmt.Errorf("organization failed: %w", err)
+	}
+
+	return nil
+}
+
+// startReport makes org write a record for every file to --report-file, if
+// given, and returns a function that completes the report once the run is over.
+func startReport(org *organizer.FileOrganizer, cfg *config.Config) (func() error, error) {
+	if reportFile == "" {
+		return func() error { return nil }, nil
+	}
+	f, err := os.Create(reportFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	rep, err := organizer.NewReport(w, organizer.ReportFormatForPath(reportFile), cfg)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	org.SetReport(rep)
+
+	return func() error {
+		err := rep.Close()
+		if err == nil {
+			err = w.Flush()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write report file: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// writeErrorsFile writes the errors recorded in stats to --errors-file, if given.
+func writeErrorsFile(stats *statistics.Statistics) error {
+	if errorsFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(stats.GetErrorReport(), "", "  ")
+	if err == nil {
+		err = os.WriteFile(errorsFile, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write errors file: %w", err)
+	}
+	return nil
+}
+
+// recordRun adds a run of kind with the statistics snap and the outcome err
+// to the run history. Failing to write it only warns, as the run is over.
+func recordRun(cfg *config.Config, kind string, snap statistics.Snapshot, err error) {
+	rec := &history.Record{
+		Kind:       kind,
+		DryRun:     snap.DryRun,
+		StartedAt:  snap.StartTime,
+		FinishedAt: time.Now(),
+		Sources:    cfg.GetSourceDirectories(),
+		Target:     cfg.GetTargetDirectory(),
+		Params:     cfg.RunOptions(),
+		Stats:      snap,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if err := history.Save(cfg, rec); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record the run in the history: %v\n", err)
+	}
+}
+
+// writeStatsFile writes a snapshot of the counters in stats of a run of kind
+// to --stats-file, if given.
+func writeStatsFile(stats *statistics.Statistics, kind string) error {
+	if statsFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(stats.Snapshot(kind), "", "  ")
+	if err == nil {
+		err = os.WriteFile(statsFile, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write stats file: %w", err)
+	}
+	return nil
+}
+
+// readStatsFile reads a snapshot written by writeStatsFile.
+func readStatsFile(path string) (statistics.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return statistics.Snapshot{}, fmt.Errorf("failed to open stats file: %w", err)
+	}
+	defer f.Close()
+	snap, err := statistics.ReadSnapshot(f)
+	if err != nil {
+		return statistics.Snapshot{}, fmt.Errorf("%s: %w", path, err)
 	}
+	return snap, nil
+}
 
+// runStatsDiff prints how the statistics in afterPath differ from those in
+// beforePath.
+func runStatsDiff(beforePath, afterPath string) error {
+	before, err := readStatsFile(beforePath)
+	if err != nil {
+		return err
+	}
+	after, err := readStatsFile(afterPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Comparing %s (%s) with %s (%s)\n\n", beforePath, runKind(before), afterPath, runKind(after))
+	fmt.Println(statistics.Compare(before, after))
 	return nil
 }
 
+// runKind describes the kind of run of snap.
+func runKind(snap statistics.Snapshot) string {
+	if snap.DryRun && snap.Kind == "organize" {
+		return "dry run"
+	}
+	return snap.Kind
+}
+
+// busiestDateFolders is how many date folders --report lists.
+const busiestDateFolders = 10
+
+// printReport prints the --report breakdowns: the files per target directory
+// and the busiest date folders.
+func printReport(stats *statistics.Statistics) {
+	fmt.Println("\n" + stats.GetDirectoryBreakdown())
+	fmt.Println(stats.GetDateHistogramSummary(busiestDateFolders))
+}
+
+// printFileDetails prints, with --verbose, the bytes of each file type and the
+// largest files found.
+func printFileDetails(stats *statistics.Statistics) {
+	if !verbose {
+		return
+	}
+	fmt.Println("\n" + stats.GetFileTypeBreakdown())
+	fmt.Println(stats.GetLargestFilesSummary(statistics.LargestFilesKept))
+}
+
+// printErrorSummary prints the errors of the run by operation, if there were any.
+func printErrorSummary(stats *statistics.Statistics) {
+	if len(stats.GetErrorsByCategory()) > 0 {
+		fmt.Println("\n" + stats.GetErrorSummary())
+	}
+}
+
+// printRepeatSummary logs the summaries of the repeated messages not logged
+// since their last one and, unless --quiet, lists the messages not all
+// repeats of which were logged.
+func printRepeatSummary(log *logrus.Logger) {
+	logger.FlushRepeats(log)
+	if summary := logger.RepeatSummary(log); summary != "" && !quiet {
+		fmt.Println("\n" + summary)
+	}
+}
+
+// explicitFiles returns the files given as arguments or listed in --files-from,
+// or nil if the source directory should be scanned. A single directory
+// argument is the source directory, not a file list.
+func explicitFiles(args []string) ([]string, error) {
+	var paths []string
+	if len(args) > 1 || (len(args) == 1 && !dirExists(args[0])) {
+		paths = append(paths, args...)
+	}
+
+	if filesFrom != "" {
+		in := os.Stdin
+		if filesFrom != "-" {
+			f, err := os.Open(filesFrom)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open file list: %w", err)
+			}
+			defer f.Close()
+			in = f
+		}
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				paths = append(paths, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read file list: %w", err)
+		}
+		if paths == nil {
+			paths = []string{} // an empty list organizes nothing rather than everything
+		}
+	}
+	return paths, nil
+}
+
+// applyNicePreset limits a run to one worker and a gentle transfer rate,
+// keeping any stricter limits set in the config.
+func applyNicePreset(cfg *config.Config) {
+	cfg.Performance.WorkerThreads = 1
+	cfg.Performance.HashThreads = 1
+	cfg.Performance.TransferThreads = 1
+	if limit := cfg.Performance.MaxFilesPerSecond; limit == 0 || limit > niceFilesPerSecond {
+		cfg.Performance.MaxFilesPerSecond = niceFilesPerSecond
+	}
+	preset, _ := config.ParseSize(niceBytesPerSecond)
+	if limit := cfg.GetMaxBytesPerSecond(); limit == 0 || limit > preset {
+		cfg.Performance.MaxBytesPerSecond = niceBytesPerSecond
+	}
+}
+
+// printPreflight prints what a run is about to do before asking for
+// confirmation. space is nil if the run's disk space was not checked.
+func printPreflight(cfg *config.Config, org *organizer.FileOrganizer, files []organizer.FileInfo, space *organizer.SpaceCheck) {
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.Size
+	}
+
+	fmt.Fprintln(os.Stderr, "\nAbout to organize:")
+	fmt.Fprintf(os.Stderr, "  Files:        %d (%s)\n", len(files), statistics.FormatBytes(totalSize))
+	fmt.Fprintf(os.Stderr, "  Operation:    %s\n", org.TransferAction())
+	fmt.Fprintf(os.Stderr, "  Source:       %s\n", strings.Join(cfg.GetSourceDirectories(), ", "))
+	if len(cfg.Sources) > 0 {
+		paths := make([]string, len(cfg.Sources))
+		for i, source := range cfg.Sources {
+			paths[i] = source.Path
+		}
+		fmt.Fprintf(os.Stderr, "  Own settings: %s (see \"config show\")\n", strings.Join(paths, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "  Target:       %s\n", cfg.GetTargetDirectory())
+	fmt.Fprintf(os.Stderr, "  Date format:  %s\n", cfg.DateFormat)
+	fmt.Fprintf(os.Stderr, "  Duplicates:   %s\n", cfg.Processing.DuplicateHandling)
+	if space != nil {
+		fmt.Fprintf(os.Stderr, "  Disk space:   %s\n", space)
+	}
+}
+
+// confirmStart asks the user to confirm the run. Without a terminal to ask on,
+// it refuses rather than proceeding unattended.
+func confirmStart() error {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("confirmation required but stdin is not a terminal; " +
+			"rerun with --yes or set security.confirm_before_start: false")
+	}
+
+	fmt.Fprint(os.Stderr, "Proceed? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("aborted by user")
+	}
+}
+
 // runScan scans the directory and prints statistics.
 func runScan(args []string) error {
 	cfg, err := loadConfig(args)
@@ -173,21 +873,39 @@ func runScan(args []string) error {
 	scanDir := cfg.SourceDirectory
 	if len(args) > 0 {
 		scanDir = args[0]
+		cfg.SetSourceDirectories(args[:1])
 	}
-
-	cfg.SourceDirectory = scanDir
 	cfg.Security.DryRun = true
 
 	fmt.Fprintf(os.Stderr, "Scanning directory: %s\n", scanDir)
+	if tmpl := cfg.Processing.FilenameTemplate; tmpl != "" {
+		fmt.Fprintf(os.Stderr, "Filename template: %s (example: %s)\n", tmpl, naming.ExampleFilename(tmpl))
+	}
 
 	log := setupLogger(cfg)
 	stats := statistics.NewStatistics()
-	dateExtractor := extractor.NewEXIFExtractor(log)
+	dateExtractor := extractor.NewDefaultExtractor(log)
 
 	compressor := compressor.NewDefaultCompressor()
 	org := organizer.NewFileOrganizer(cfg, log, stats, dateExtractor, compressor)
+	finishReport, err := startReport(org, cfg)
+	if err != nil {
+		return err
+	}
 
-	err = org.OrganizeFiles()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = org.OrganizeFiles(ctx)
+	if reportErr := finishReport(); reportErr != nil && err == nil {
+		err = reportErr
+	}
+	if errorsErr := writeErrorsFile(stats); errorsErr != nil && err == nil {
+		err = errorsErr
+	}
+	if statsErr := writeStatsFile(stats, "scan"); statsErr != nil && err == nil {
+		err = statsErr
+	}
+	recordRun(cfg, "scan", stats.Snapshot("scan"), err)
 	if err != nil {
 		return fmt.Errorf("scan failed: %w", err)
 	}
@@ -197,7 +915,18 @@ func runScan(args []string) error {
 		fmt.Println("SCAN RESULTS")
 		fmt.Println("==================================================")
 		fmt.Println("\n" + stats.GetSummary())
+		fmt.Println("\n" + stats.GetFilterSummary())
+		printFileDetails(stats)
+		printErrorSummary(stats)
+		if report {
+			printReport(stats)
+		}
+		if limit := cfg.Security.MaxFilesPerRun; limit > 0 {
+			fmt.Printf("\nMax files per run: %d (%d more files left for later runs)\n",
+				limit, atomic.LoadInt64(&stats.FilesRemaining))
+		}
 	}
+	printRepeatSummary(log)
 
 	return nil
 }
@@ -211,80 +940,800 @@ func runTestExif(filePath string) error {
 	fmt.Printf("Testing EXIF extraction for: %s\n", filePath)
 
 	log := logrus.New()
-	dateExtractor := extractor.NewEXIFExtractor(log)
-	date, err := dateExtractor.ExtractDate(filePath)
+	dateExtractor := extractor.NewDefaultExtractor(log)
+	meta, err := dateExtractor.ExtractMetadata(filePath)
 
 	if err != nil {
 		fmt.Printf("Error extracting date: %v\n", err)
 		return nil
 	}
 
-	if date.IsZero() {
+	if meta.Date.IsZero() {
 		fmt.Println("No date found in EXIF data")
 	} else {
-		fmt.Printf("Extracted date: %s\n", date.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Extracted date: %s\n", meta.Date.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Date source: %s\n", meta.Source)
+	}
+	if camera := meta.Camera(); camera != "" {
+		fmt.Printf("Camera: %s\n", camera)
+	}
+	if jsonPath := extractor.FindTakeoutJSON(filePath); jsonPath != "" {
+		fmt.Printf("Takeout JSON: %s\n", jsonPath)
+	}
+
+	if ins, err := dateExtractor.Inspect(filePath); err == nil {
+		fmt.Println("Date candidates:")
+		for _, c := range ins.Candidates {
+			marker := " "
+			if c.Source == meta.Source {
+				marker = "*"
+			}
+			if c.Date != nil {
+				fmt.Printf(" %s %-24s %s\n", marker, c.Source, c.Date.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf(" %s %-24s (%s)\n", marker, c.Source, c.Error)
+			}
+		}
 	}
 
 	return nil
 }
 
-// runServe starts the web server and handles graceful shutdown.
-func runServe() error {
-	cfg, err := config.LoadConfig("")
+// runWatch organizes new files until interrupted.
+func runWatch(args []string) error {
+	cfg, err := loadConfig(args)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "CONFIG LOAD ERROR: %v\n", err)
-		cfg = config.DefaultConfig()
-		cfg.SourceDirectory = "."
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if dryRun {
 		cfg.Security.DryRun = true
 	}
+	if nice {
+		applyNicePreset(cfg)
+	}
+	if len(cfg.GetSourceDirectories()) > 1 {
+		return fmt.Errorf("watch supports a single source directory")
+	}
 
 	log := setupLogger(cfg)
-	compressor := compressor.NewDefaultCompressor()
-	server := web.NewServer(cfg, log, compressor)
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		if err := server.Start(port); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
-		}
-	}()
-
-	fmt.Printf("🚀 PhotoSorter Web Interface started!\n")
-	fmt.Printf("📱 Open your browser and go to: http://localhost:%d\n", port)
-	fmt.Printf("🛑 Press Ctrl+C to stop the server\n\n")
-
-	<-sigChan
-	fmt.Println("\n🛑 Shutting down server...")
+	stats := statistics.NewStatistics()
+	org := organizer.NewFileOrganizer(cfg, log, stats, extractor.NewDefaultExtractor(log), compressor.NewDefaultCompressor())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if err := server.Stop(ctx); err != nil {
-		return fmt.Errorf("server shutdown failed: %w", err)
+	if err := org.Watch(ctx); err != nil {
+		return fmt.Errorf("watch failed: %w", err)
 	}
 
-	fmt.Println("✅ Server stopped gracefully")
+	if !quiet {
+		fmt.Println("\n" + stats.GetSummary())
+	}
+	printRepeatSummary(log)
 	return nil
 }
 
+// runPlan writes the planned operations for the source directory to planFile.
+func runPlan(args []string) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if len(args) > 0 {
+		cfg.SourceDirectory = args[0]
+	}
+	// Planning changes nothing: incomplete copies are left in place and the
+	// target's case sensitivity is not probed with a file.
+	cfg.Security.DryRun = true
+
+	log := setupLogger(cfg)
+	stats := statistics.NewStatistics()
+	org := organizer.NewFileOrganizer(cfg, log, stats, extractor.NewDefaultExtractor(log), compressor.NewDefaultCompressor())
+
+	entries, err := org.Plan()
+	if err != nil {
+		return fmt.Errorf("planning failed: %w", err)
+	}
+	if err := writeStatsFile(stats, "plan"); err != nil {
+		return err
+	}
+
+	out, err := os.Create(planFile)
+	if err != nil {
+		return fmt.Errorf("failed to create plan file: %w", err)
+	}
+	if err := organizer.WritePlan(out, entries); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	recordRun(cfg, "plan", stats.Snapshot("plan"), nil)
+
+	if !quiet {
+		fmt.Printf("Wrote %d operations to %s (%d files to organize, %d skipped)\n",
+			len(entries), planFile, atomic.LoadInt64(&stats.FilesOrganized), atomic.LoadInt64(&stats.FilesSkipped))
+	}
+	printRepeatSummary(log)
+	return nil
+}
+
+// runApply executes the operations of a plan file.
+func runApply(path string) error {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open plan: %w", err)
+	}
+	entries, err := organizer.ReadPlan(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	log := setupLogger(cfg)
+	stats := statistics.NewStatistics()
+	org := organizer.NewFileOrganizer(cfg, log, stats, extractor.NewDefaultExtractor(log), compressor.NewDefaultCompressor())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = org.ApplyPlan(ctx, entries)
+	if errorsErr := writeErrorsFile(stats); errorsErr != nil && err == nil {
+		err = errorsErr
+	}
+	if statsErr := writeStatsFile(stats, "apply"); statsErr != nil && err == nil {
+		err = statsErr
+	}
+	recordRun(cfg, "apply", stats.Snapshot("apply"), err)
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("apply interrupted")
+	}
+	if err != nil {
+		return fmt.Errorf("apply failed: %w", err)
+	}
+
+	if !quiet {
+		fmt.Println("\n" + stats.GetSummary())
+		if drift := atomic.LoadInt64(&stats.PlanDrift); drift > 0 {
+			fmt.Printf("\n%d plan entries were not applied because files changed since planning:\n", drift)
+			fmt.Println(stats.GetErrorSummary())
+		}
+	}
+	printRepeatSummary(log)
+	return nil
+}
+
+// runConfigInit writes the config file with the default settings to the
+// path in args, or ./config.yaml.
+func runConfigInit(args []string) error {
+	path := "config.yaml"
+	if len(args) == 1 {
+		path = args[0]
+	}
+	data, err := config.Template()
+	if err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists (use --force to replace it)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	fmt.Printf("Wrote %s; set source_directory and check it with \"photo-sorter config validate\"\n", path)
+	return nil
+}
+
+// runConfigShow prints the effective configuration as YAML.
+func runConfigShow() error {
+	cfg, err := loadStructure()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	origins := cfg.Origins()
+	if len(sourceDirs) > 0 {
+		cfg.SetSourceDirectories(sourceDirs)
+		origins["source_directory"] = "flag --source"
+		origins["source_directories"] = "flag --source"
+	}
+	if targetDir != "" {
+		cfg.TargetDirectory = &targetDir
+		origins["target_directory"] = "flag --target"
+	}
+	// Each source is shown with every setting its files are organized with.
+	cfg.Sources = cfg.ResolvedSources()
+
+	var data []byte
+	if showOrigins {
+		data, err = cfg.YAMLWithOrigins(origins)
+	} else {
+		data, err = cfg.YAML()
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# Effective configuration of %s", cfg.FilePath())
+	if cfg.Profile != "" {
+		fmt.Printf(" with profile %s", cfg.Profile)
+	}
+	fmt.Println()
+	if names := cfg.ProfileNames(); len(names) > 0 {
+		fmt.Printf("# Profiles: %s\n", strings.Join(names, ", "))
+	}
+	os.Stdout.Write(data)
+	return nil
+}
+
+// runConfigEnv lists the environment variables that set settings, with the
+// values in effect.
+func runConfigEnv() error {
+	cfg, err := loadStructure()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	vars := cfg.EnvVars()
+	width := 0
+	for _, v := range vars {
+		width = max(width, len(v.Name))
+	}
+	fmt.Printf("  %-*s  %s\n", width, "VARIABLE", "VALUE")
+	for _, v := range vars {
+		mark := " "
+		if v.Set {
+			mark = "*"
+		}
+		fmt.Printf("%s %-*s  %s\n", mark, width, v.Name, v.Value)
+	}
+	return nil
+}
+
+// runConfigValidate lists the problems of the config file in args, or of the
+// one the other commands use.
+func runConfigValidate(args []string) error {
+	path := cfgFile
+	if len(args) == 1 {
+		path = args[0]
+	}
+	name, problems, warnings := config.Check(path, profile)
+	for _, warning := range warnings {
+		fmt.Printf("warning: %v\n", warning)
+	}
+	for _, problem := range problems {
+		fmt.Printf("error: %v\n", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s has %d problem(s)", name, len(problems))
+	}
+	fmt.Printf("%s is valid\n", name)
+	return nil
+}
+
+// openHistory returns the run history of the configuration.
+func openHistory() (*history.Store, error) {
+	cfg, err := loadStructure()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return history.OpenConfigured(cfg)
+}
+
+// runHistoryList prints the last --limit runs of the run history.
+func runHistoryList() error {
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	records, warnings := store.List()
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", w)
+	}
+	if len(records) == 0 {
+		fmt.Printf("No runs recorded in %s\n", store.Dir())
+		return nil
+	}
+	if historyLimit > 0 && len(records) > historyLimit {
+		records = records[:historyLimit]
+	}
+
+	fmt.Printf("%-16s  %-20s  %9s  %6s  %8s  %-6s  %-28s  %s\n", "DATE", "MODE", "ORGANIZED", "ERRORS", "DURATION", "RESULT", "ID", "SOURCE")
+	for _, rec := range records {
+		result := "ok"
+		if rec.Error != "" {
+			result = "failed"
+		}
+		source := strings.Join(rec.Sources, ", ")
+		fmt.Printf("%-16s  %-20s  %9d  %6d  %8s  %-6s  %-28s  %s\n",
+			rec.StartedAt.Local().Format("2006-01-02 15:04"), rec.Mode(), rec.Organized(), rec.Errors(),
+			rec.Duration().Round(100*time.Millisecond), result, rec.ID, source)
+	}
+	return nil
+}
+
+// runHistoryShow prints the run with id of the run history.
+func runHistoryShow(id string) error {
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	rec, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Run:      %s\n", rec.ID)
+	fmt.Printf("Mode:     %s\n", rec.Mode())
+	fmt.Printf("Started:  %s\n", rec.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("Duration: %s\n", rec.Duration().Round(time.Millisecond))
+	fmt.Printf("Sources:  %s\n", strings.Join(rec.Sources, ", "))
+	fmt.Printf("Target:   %s\n", rec.Target)
+	if rec.User != "" {
+		fmt.Printf("User:     %s\n", rec.User)
+	}
+	if rec.Error != "" {
+		fmt.Printf("Error:    %s\n", rec.Error)
+	}
+	if rec.Params != nil {
+		params, _ := json.MarshalIndent(rec.Params, "", "  ")
+		fmt.Printf("\nOptions:\n%s\n", params)
+	}
+
+	names := make([]string, 0, len(rec.Stats.Counters))
+	for name, value := range rec.Stats.Counters {
+		if value != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	fmt.Println("\nCounters:")
+	for _, name := range names {
+		fmt.Printf("  %s: %d\n", name, rec.Stats.Counters[name])
+	}
+	if len(rec.Stats.ErrorCategories) > 0 {
+		operations := make([]string, 0, len(rec.Stats.ErrorCategories))
+		for operation := range rec.Stats.ErrorCategories {
+			operations = append(operations, operation)
+		}
+		sort.Strings(operations)
+		fmt.Println("\nErrors by operation:")
+		for _, operation := range operations {
+			fmt.Printf("  %s: %d\n", operation, rec.Stats.ErrorCategories[operation])
+		}
+	}
+	return nil
+}
+
+// runHistoryPrune removes the runs beyond --keep and older than --older-than.
+func runHistoryPrune() error {
+	if historyKeep <= 0 && olderThan == "" {
+		return fmt.Errorf("give --keep, --older-than or both")
+	}
+	var before time.Time
+	if olderThan != "" {
+		age, err := config.ParseDuration(olderThan)
+		if err != nil {
+			return fmt.Errorf("invalid --older-than: %w", err)
+		}
+		before = time.Now().Add(-age)
+	}
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+	removed, err := store.Prune(historyKeep, before)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d runs from %s\n", removed, store.Dir())
+	return nil
+}
+
+// runTrashEmpty deletes trashed files older than the --older-than age.
+func runTrashEmpty(args []string) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	age, err := config.ParseDuration(olderThan)
+	if err != nil {
+		return fmt.Errorf("invalid --older-than: %w", err)
+	}
+
+	root := cfg.GetTargetDirectory()
+	files, bytes, err := trash.Empty(root, age, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to empty trash: %w", err)
+	}
+
+	if !quiet {
+		fmt.Printf("Removed %d files (%s) from %s\n", files, statistics.FormatBytes(bytes), trash.Dir(root))
+	}
+	return nil
+}
+
+// runPruneIdentical deletes the sources recorded as identical duplicates in --journal.
+func runPruneIdentical() error {
+	f, err := os.Open(reportFile)
+	if err != nil {
+		return fmt.Errorf("failed to open report: %w", err)
+	}
+	records, err := organizer.ReadReport(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	log := logrus.New()
+	if verbose {
+		log.SetLevel(logrus.DebugLevel)
+	}
+	result, err := organizer.PruneIdentical(records, dryRun, log)
+	if !quiet {
+		verb := "Deleted"
+		if dryRun {
+			verb = "Would delete"
+		}
+		fmt.Printf("%s %d identical files (%s); kept %d that changed since the report\n",
+			verb, result.Deleted, statistics.FormatBytes(result.Bytes), result.Kept)
+	}
+	if err != nil {
+		return fmt.Errorf("prune failed: %w", err)
+	}
+	return nil
+}
+
+// runCompress compresses the files in the source directory, showing progress
+// on stderr.
+func runCompress(args []string) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if len(args) > 0 {
+		cfg.SourceDirectory = args[0]
+	}
+	if !cfg.Compressor.Enabled {
+		return fmt.Errorf("compression is disabled (compressor.enabled)")
+	}
+
+	if estimateEvery < 0 {
+		return fmt.Errorf("--estimate must be positive")
+	}
+	if compressInPlace && targetDir != "" {
+		return fmt.Errorf("--in-place and --target cannot be used together")
+	}
+
+	params := compressor.ParamsFromConfig(cfg.Compressor, []string{cfg.SourceDirectory}, cfg.GetTargetDirectory())
+	if err := params.Override(compressQuality, compressThreshold, compressFormats); err != nil {
+		return err
+	}
+	params.InPlace = compressInPlace
+	params.Force = compressForce
+	params.DetectFileType = cfg.Processing.DetectFileType
+	params.DryRun = dryRun || estimateEvery > 0
+	params.SampleEvery = estimateEvery
+	params.Logger = setupLogger(cfg)
+	if !quiet {
+		verb := "Compressing"
+		if params.DryRun {
+			verb = "Measuring"
+		}
+		params.Progress = func(p compressor.CompressionProgress) {
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d files (%d%%), %s saved",
+				verb, p.Done, p.Total, p.Done*100/max(p.Total, 1), statistics.FormatBytes(p.BytesSaved))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	started := time.Now()
+	results, err := compressor.NewDefaultCompressor().Compress(ctx, params)
+	stopped := err != nil && ctx.Err() != nil
+	snap := history.CompressionStats(compressor.Summarize(results), params.DryRun, started, time.Now())
+	recordRun(cfg, "compress", snap, err)
+	if err != nil && !stopped {
+		return fmt.Errorf("compression failed: %w", err)
+	}
+	if err := writeCompressReport(results); err != nil {
+		return err
+	}
+
+	if !quiet {
+		if len(results) > 0 {
+			fmt.Fprintln(os.Stderr)
+		}
+		printCompressTable(results)
+	}
+	var failed int
+	if params.DryRun {
+		failed = printCompressDryRun(results, stopped)
+	} else {
+		failed = printCompressSummary(results, stopped)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files failed to compress", failed)
+	}
+	return nil
+}
+
+// writeCompressReport writes the compression results to --report-file, if given.
+func writeCompressReport(results []compressor.CompressionResult) error {
+	if reportFile == "" {
+		return nil
+	}
+	f, err := os.Create(reportFile)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	err = compressor.WriteReport(f, results)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+	return nil
+}
+
+// printCompressTable prints one line per compressed file.
+func printCompressTable(results []compressor.CompressionResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Printf("%-14s %10s %10s %7s  %s\n", "ACTION", "ORIGINAL", "COMPRESSED", "SAVED", "FILE")
+	for _, r := range results {
+		compressed, saved := "-", "-"
+		if r.CompressedSize > 0 {
+			compressed = statistics.FormatBytes(r.CompressedSize)
+			saved = fmt.Sprintf("%.1f%%", r.PercentageSaved)
+		}
+		file := r.InputPath
+		if r.Action == "error" {
+			file += ": " + r.Message
+		}
+		fmt.Printf("%-14s %10s %10s %7s  %s\n",
+			r.Action, statistics.FormatBytes(r.OriginalSize), compressed, saved, file)
+	}
+}
+
+// printCompressSummary prints the totals of a compression run and returns the
+// number of files that failed.
+func printCompressSummary(results []compressor.CompressionResult, stopped bool) int {
+	summary := compressor.Summarize(results)
+	verb := "Compressed"
+	if stopped {
+		verb = "Stopped after compressing"
+	}
+	fmt.Printf("%s %d of %d files, saved %s (%d errors)\n",
+		verb, summary.Compressed, summary.TotalFiles, statistics.FormatBytes(summary.BytesSaved), summary.Errors)
+	if summary.Cached > 0 {
+		fmt.Printf("%d files unchanged since an earlier run were skipped (use --force to compress them again)\n", summary.Cached)
+	}
+	return summary.Errors
+}
+
+// printCompressDryRun prints the summary of a compression dry run and returns
+// the number of files that failed.
+func printCompressDryRun(results []compressor.CompressionResult, stopped bool) int {
+	var compress, skip, cached, estimated, failed int
+	for _, r := range results {
+		switch r.Action {
+		case "would_compress":
+			compress++
+		case "would_skip", "skipped":
+			skip++
+		case "cached":
+			cached++
+		case "estimated":
+			estimated++
+		case "error":
+			failed++
+		}
+	}
+	prefix := "Dry run"
+	if stopped {
+		prefix = "Dry run stopped"
+	}
+	fmt.Printf("%s: %d files would be compressed, %d skipped", prefix, compress, skip)
+	if cached > 0 {
+		fmt.Printf(", %d unchanged since an earlier run", cached)
+	}
+	if estimated > 0 {
+		fmt.Printf(", %d estimated from the sample", estimated)
+	}
+	fmt.Printf(" (%d errors)\n", failed)
+	fmt.Printf("Projected space saved: %s\n", statistics.FormatBytes(compressor.ProjectedSavings(results)))
+	return failed
+}
+
+// applyServeFlags applies the flags of serve that override settings to cfg.
+func applyServeFlags(cfg *config.Config) {
+	if bindAddr != "" {
+		cfg.Web.BindAddress = bindAddr
+		cfg.SetOrigin("flag --bind", "web.bind_address")
+	}
+	if tlsCert != "" || tlsKey != "" {
+		cfg.Web.TLS = config.TLSConfig{CertFile: tlsCert, KeyFile: tlsKey}
+		cfg.SetOrigin("flag --tls-cert", "web.tls.cert_file")
+		cfg.SetOrigin("flag --tls-key", "web.tls.key_file")
+	}
+}
+
+// serveConfig returns the configuration the web server starts with and the
+// notice about it for the web interface. The directories may be chosen in the
+// web interface, and are checked for each job, so they need not be set.
+func serveConfig() (*config.Config, string, error) {
+	cfg, err := loadStructure()
+	if err != nil && profile != "" {
+		return nil, "", fmt.Errorf("failed to load config: %w", err)
+	}
+	var notice string
+	switch {
+	case err != nil:
+		// Dry runs keep a broken config from moving files with the defaults.
+		fmt.Fprintf(os.Stderr, "CONFIG LOAD ERROR: %v\n", err)
+		notice = fmt.Sprintf("The config file could not be loaded (%v). Running with the default settings in dry-run mode until the file is fixed.", err)
+		cfg = config.DefaultConfig()
+		cfg.Security.DryRun = true
+		cfg.SetOrigin("config load error", "security.dry_run") // not saved
+	case cfg.File() == "":
+		notice = "No config file was loaded; running with the default settings. Choose the directories below and check \"Write to the config file\" to keep them."
+	}
+	applyServeFlags(cfg)
+	return cfg, notice, nil
+}
+
+// runServe starts the web server and handles graceful shutdown.
+func runServe() error {
+	cfg, notice, err := serveConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Web.TLS.Enabled() {
+		if err := cfg.Web.TLS.Validate(); err != nil {
+			return err
+		}
+	}
+
+	log := setupLogger(cfg)
+
+	// Without authentication anyone who can reach the server can move and
+	// delete files, so it is only reachable from this machine unless forced.
+	if !isLoopback(cfg.Web.BindAddress) && !cfg.Web.AuthEnabled() {
+		if !insecure {
+			return fmt.Errorf("refusing to listen on %q without web authentication: configure web.token or web.username and web.password_hash, or use --insecure-bind", cfg.Web.BindAddress)
+		}
+		log.Warn("Web authentication is not configured and --insecure-bind is set: anyone on the network can use the web interface")
+	}
+
+	compressor := compressor.NewDefaultCompressor()
+	server := web.NewServer(cfg, log, compressor)
+	server.SetVersion(versionString(), buildTime)
+	server.SetConfigNotice(notice)
+	listening := cfg.Web.BindAddress // until restarted
+	server.SetConfigLoader(func() (*config.Config, error) {
+		cfg, err := config.LoadStructure(cfgFile, profile)
+		if err != nil {
+			return nil, err
+		}
+		applyServeFlags(cfg)
+		if !isLoopback(listening) && !cfg.Web.AuthEnabled() && !insecure {
+			return nil, fmt.Errorf("web authentication cannot be turned off while listening on %q", listening)
+		}
+		return cfg, nil
+	})
+	if file := cfg.File(); file != "" || cfgFile != "" {
+		if file == "" {
+			file = cfgFile // could not be loaded, reloaded once fixed
+		}
+		if err := server.WatchConfigFile(file); err != nil {
+			log.Warnf("%v; send SIGHUP to reload it", err)
+		}
+	}
+	if webRoot != "" {
+		if info, err := os.Stat(filepath.Join(webRoot, "templates", "index.html")); err != nil || info.IsDir() {
+			return fmt.Errorf("--web-root %s does not hold templates/index.html", webRoot)
+		}
+		server.SetWebRoot(webRoot)
+		log.Infof("Serving the web interface from %s", webRoot)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			_ = server.ReloadConfig("SIGHUP") // logged
+		}
+	}()
+
+	host := cfg.Web.BindAddress
+	if host == "0.0.0.0" || host == "::" {
+		host = "" // all interfaces
+	}
+	go func() {
+		if err := server.Start(host, port, cfg.Web.TLS); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	scheme := "http"
+	if cfg.Web.TLS.Enabled() {
+		scheme = "https"
+	}
+	browseHost := host
+	if browseHost == "" {
+		browseHost = "localhost"
+	}
+	fmt.Printf("🚀 PhotoSorter Web Interface started!\n")
+	fmt.Printf("📱 Open your browser and go to: %s://%s\n", scheme, net.JoinHostPort(browseHost, strconv.Itoa(port)))
+	if isLoopback(cfg.Web.BindAddress) {
+		fmt.Printf("🔒 Only reachable from this machine; use --bind with web authentication for remote access\n")
+	}
+	fmt.Printf("🛑 Press Ctrl+C to stop the server\n\n")
+
+	<-sigChan
+	fmt.Println("\n🛑 Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Stop(ctx); err != nil {
+		return fmt.Errorf("server shutdown failed: %w", err)
+	}
+
+	fmt.Println("✅ Server stopped gracefully")
+	return nil
+}
+
+// isLoopback reports whether the bind address only accepts connections from
+// this machine.
+func isLoopback(addr string) bool {
+	if strings.EqualFold(addr, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
 // loadConfig loads configuration and applies CLI overrides.
 func loadConfig(args []string) (*config.Config, error) {
-	cfg, err := config.LoadConfig("")
+	// The source may be given by flags or arguments instead of the config.
+	cfg, err := loadStructure()
 	if err != nil {
 		return nil, err
 	}
 
-	if sourceDir != "" {
-		cfg.SourceDirectory = sourceDir
+	if len(sourceDirs) > 0 {
+		cfg.SetSourceDirectories(sourceDirs)
 	}
 
-	if targetDir != "" {
-		cfg.TargetDirectory = &targetDir
+	if cfg.SourceDirectory == "" && len(cfg.SourceDirectories) > 0 {
+		cfg.SourceDirectory = cfg.SourceDirectories[0]
+	}
+	if cfg.SourceDirectory == "" && len(cfg.Sources) > 0 {
+		cfg.SourceDirectory = cfg.Sources[0].Path
 	}
 
-	if cfg.SourceDirectory == "" && len(args) > 0 {
+	if cfg.SourceDirectory == "" && len(args) == 1 {
 		cfg.SourceDirectory = args[0]
 	}
 
@@ -292,9 +1741,20 @@ func loadConfig(args []string) (*config.Config, error) {
 		cfg.SourceDirectory = "."
 	}
 
-	if !dirExists(cfg.SourceDirectory) {
+	if info, err := os.Stat(cfg.SourceDirectory); err != nil || !(info.IsDir() || info.Mode().IsRegular()) {
 		return nil, fmt.Errorf("source directory does not exist: %s", cfg.SourceDirectory)
 	}
+	for _, dir := range cfg.SourceDirectories {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("source directory does not exist: %s", dir)
+		}
+	}
+	if targetDir != "" {
+		cfg.TargetDirectory = &targetDir
+	}
+	if err := cfg.ValidatePaths(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
 
 	return cfg, nil
 }
@@ -309,6 +1769,9 @@ func setupLogger(cfg *config.Config) *logrus.Logger {
 		MaxAge:     cfg.Logging.MaxAge,
 		Compress:   cfg.Logging.Compress,
 		Console:    !quiet,
+
+		ConsoleFormat: cfg.Logging.ConsoleFormat,
+		SampleRepeats: cfg.Logging.SampleRepeats,
 	}
 
 	if verbose {
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"photo-sorter-go/internal/compressor"
+	"photo-sorter-go/internal/web"
+
+	"github.com/sirupsen/logrus"
+)
+
+// withoutConfig runs the test in an empty working and home directory, where
+// no config file is found, with the command-line flags cleared.
+func withoutConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("USERPROFILE", dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	saved := [...]string{cfgFile, profile, bindAddr, tlsCert, tlsKey}
+	cfgFile, profile, bindAddr, tlsCert, tlsKey = "", "", "", "", ""
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		cfgFile, profile, bindAddr, tlsCert, tlsKey = saved[0], saved[1], saved[2], saved[3], saved[4]
+	})
+	return dir
+}
+
+// getJSON returns the decoded response to a GET request for url.
+func getJSON(t *testing.T, url string) web.APIResponse {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var decoded web.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("GET %s: decode response: %v", url, err)
+	}
+	return decoded
+}
+
+func TestServeStartsWithoutConfig(t *testing.T) {
+	withoutConfig(t)
+	cfg, notice, err := serveConfig()
+	if err != nil {
+		t.Fatalf("serveConfig: %v", err)
+	}
+	if cfg.File() != "" {
+		t.Fatalf("loaded %s, want no config file", cfg.File())
+	}
+	if cfg.Security.DryRun {
+		t.Error("runs are dry without a config file, want them to change files")
+	}
+	if !strings.Contains(notice, "No config file") {
+		t.Errorf("notice = %q, want it to tell no config file was loaded", notice)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	server := web.NewServer(cfg, log, compressor.NewDefaultCompressor())
+	server.SetConfigNotice(notice)
+	started := make(chan error, 1)
+	go func() { started <- server.Start("127.0.0.1", port, cfg.Web.TLS) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Stop(ctx); err != nil {
+			t.Errorf("stop server: %v", err)
+		}
+	})
+
+	base := "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(base + "/api/health")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET /api/health = %d", resp.StatusCode)
+			}
+			break
+		}
+		select {
+		case err := <-started:
+			t.Fatalf("server did not start: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not answer: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	resp := getJSON(t, base+"/api/config")
+	data, _ := resp.Data.(map[string]any)
+	if !resp.Success || data["notice"] != notice {
+		t.Errorf("GET /api/config notice = %v (%s), want %q", data["notice"], resp.Error, notice)
+	}
+	if dryRun, _ := data["dry_run"].(bool); dryRun {
+		t.Error("GET /api/config reports dry-run mode without a config file")
+	}
+}
+
+func TestServeFallsBackToDryRunOnBrokenConfig(t *testing.T) {
+	dir := withoutConfig(t)
+	cfgFile = filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgFile, []byte("processing: [not a section\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, notice, err := serveConfig()
+	if err != nil {
+		t.Fatalf("serveConfig: %v", err)
+	}
+	if !cfg.Security.DryRun {
+		t.Error("a broken config file runs with the defaults, want dry runs")
+	}
+	if !strings.Contains(notice, "could not be loaded") {
+		t.Errorf("notice = %q, want it to tell the config file could not be loaded", notice)
+	}
+}
+
+func TestPruneIdenticalJournalFlag(t *testing.T) {
+	saved := reportFile
+	t.Cleanup(func() { reportFile = saved })
+
+	for _, flag := range []string{"--journal", "--report-file"} {
+		reportFile = ""
+		if err := pruneIdenticalCmd.ParseFlags([]string{flag, "run.json"}); err != nil {
+			t.Fatalf("%s: %v", flag, err)
+		}
+		if reportFile != "run.json" {
+			t.Errorf("%s run.json set the journal to %q", flag, reportFile)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheName is the state file in TargetDir recording the files compressed
+// into it, so that repeat runs skip unchanged sources.
+const cacheName = ".photosorter-cache.json"
+
+// cacheEntry records a source file compressed into the target directory.
+type cacheEntry struct {
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mod_time"` // Unix nanoseconds
+	Quality    int    `json:"quality"`
+	Output     string `json:"output"`
+	OutputSize int64  `json:"output_size"`
+	OutputHash string `json:"output_hash"` // hex-encoded SHA-256
+}
+
+// compressionCache holds the entries of a target directory's state file by
+// absolute source path.
+type compressionCache struct {
+	path    string
+	entries map[string]cacheEntry
+}
+
+// usesCache reports whether runs with p skip sources compressed into the
+// target directory before. In-place runs rely on the marks instead.
+func (p CompressionParams) usesCache() bool {
+	return p.TargetDir != "" && !p.InPlace
+}
+
+// loadCache reads the state file of params.TargetDir. A missing or
+// unreadable file gives an empty cache.
+func loadCache(params CompressionParams) *compressionCache {
+	c := &compressionCache{
+		path:    filepath.Join(params.TargetDir, cacheName),
+		entries: make(map[string]cacheEntry),
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		params.warnf("Ignoring unreadable compression cache %s: %v", c.path, err)
+		c.entries = make(map[string]cacheEntry)
+	}
+	return c
+}
+
+// lookup returns a "cached" result for the file at path if it was compressed
+// with quality before, has not changed since and its output still exists.
+func (c *compressionCache) lookup(path string, quality int) (CompressionResult, bool) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return CompressionResult{}, false
+	}
+	entry, ok := c.entries[key]
+	if !ok || entry.Quality != quality {
+		return CompressionResult{}, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != entry.Size || info.ModTime().UnixNano() != entry.ModTime {
+		return CompressionResult{}, false
+	}
+	out, err := os.Stat(entry.Output)
+	if err != nil || out.Size() != entry.OutputSize {
+		return CompressionResult{}, false
+	}
+
+	now := time.Now()
+	res := CompressionResult{
+		InputPath:      path,
+		OutputPath:     entry.Output,
+		OriginalSize:   entry.Size,
+		CompressedSize: entry.OutputSize,
+		Action:         "cached",
+		Message:        "Unchanged since it was last compressed",
+		Success:        true,
+		StartedAt:      now,
+		FinishedAt:     now,
+		Quality:        quality,
+	}
+	if entry.Size > 0 {
+		res.PercentageSaved = float64(entry.Size-entry.OutputSize) * 100 / float64(entry.Size)
+	}
+	return res, true
+}
+
+// record adds the images written by results to the cache and returns how
+// many it added.
+func (c *compressionCache) record(results []CompressionResult) int {
+	added := 0
+	for _, r := range results {
+		if r.Action != "compressed" && r.Action != "original" {
+			continue
+		}
+		key, err := filepath.Abs(r.InputPath)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(r.InputPath)
+		if err != nil {
+			continue
+		}
+		out, err := os.Stat(r.OutputPath)
+		if err != nil {
+			continue
+		}
+		sum, err := fileHash(r.OutputPath)
+		if err != nil {
+			continue
+		}
+		c.entries[key] = cacheEntry{
+			Size:       info.Size(),
+			ModTime:    info.ModTime().UnixNano(),
+			Quality:    r.Quality,
+			Output:     r.OutputPath,
+			OutputSize: out.Size(),
+			OutputHash: sum,
+		}
+		added++
+	}
+	return added
+}
+
+// save writes the cache to its state file, replacing it atomically.
+func (c *compressionCache) save() error {
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write compression cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write compression cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package compressor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// outputClaims tracks the output paths of the images of a run, so that an
+// image converted to another format never replaces a file it does not own,
+// such as IMG_1.jpg next to IMG_1.png or the output of another input.
+type outputClaims struct {
+	inPlace bool
+	mu      sync.Mutex
+	owners  map[string]string // output path -> input path
+}
+
+// newOutputClaims returns the claims of files: each owns the path it is
+// written to when it keeps its format, the first of them if several share it.
+func newOutputClaims(files []string, params CompressionParams) *outputClaims {
+	claims := &outputClaims{inPlace: params.InPlace, owners: make(map[string]string, len(files))}
+	for _, file := range files {
+		if out := params.outputPath(file); claims.owners[out] == "" {
+			claims.owners[out] = file
+		}
+	}
+	return claims
+}
+
+// claim returns the path input is written to instead of outPath: outPath
+// itself if it is free, and otherwise the first free name with a "_N"
+// suffix, as duplicates are renamed when organizing. A path is taken when
+// another input owns it or, in place, when a file exists there: in place,
+// the directory holds the user's own files, while in a target directory an
+// existing file is the output of an earlier run.
+func (c *outputClaims) claim(input, outPath string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	taken := func(path string, onDisk bool) bool {
+		if owner, ok := c.owners[path]; ok {
+			return owner != input
+		}
+		if !onDisk {
+			return false
+		}
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+	if !taken(outPath, c.inPlace && outPath != filepath.Clean(input)) {
+		c.owners[outPath] = input
+		return outPath
+	}
+	ext := filepath.Ext(outPath)
+	base := strings.TrimSuffix(outPath, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, n, ext)
+		if !taken(candidate, c.inPlace) {
+			c.owners[candidate] = input
+			return candidate
+		}
+	}
+}
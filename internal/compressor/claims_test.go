@@ -0,0 +1,72 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertedImageDoesNotReplaceExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	png := writeImage(t, filepath.Join(dir, "IMG_0001.png"), noisyImage(64, 64, 1))
+	unrelated := filepath.Join(dir, "IMG_0001.jpg")
+	if err := os.WriteFile(unrelated, []byte("another photo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	params := testParams(png)
+	params.InPlace = true
+	params.ConvertTo = FormatJPEG
+	results, err := NewDefaultCompressor().Compress(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := resultFor(t, results, png)
+	want := filepath.Join(dir, "IMG_0001_1.jpg")
+	if r.Action != "compressed" || r.OutputPath != want {
+		t.Fatalf("got %s to %s (%s), want compressed to %s", r.Action, r.OutputPath, r.Message, want)
+	}
+	if data, err := os.ReadFile(unrelated); err != nil || !bytes.Equal(data, []byte("another photo")) {
+		t.Errorf("%s was replaced", unrelated)
+	}
+	if _, err := os.Stat(png); !os.IsNotExist(err) {
+		t.Errorf("converted original %s was not removed", png)
+	}
+}
+
+func TestInputsSharingAnOutputName(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out")
+	jpg := writeImage(t, filepath.Join(dir, "src", "IMG.jpg"), noisyImage(64, 64, 1))
+	png := writeImage(t, filepath.Join(dir, "src", "IMG.png"), noisyImage(64, 64, 2))
+	other := writeImage(t, filepath.Join(dir, "other", "IMG.jpg"), noisyImage(64, 64, 3))
+
+	params := testParams(jpg, png, other)
+	params.TargetDir = target
+	params.ConvertTo = FormatJPEG
+	results, err := NewDefaultCompressor().Compress(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := make(map[string]string)
+	for _, input := range []string{jpg, png, other} {
+		r := resultFor(t, results, input)
+		if !r.Success {
+			t.Fatalf("%s: %s %s", input, r.Action, r.Message)
+		}
+		if previous, ok := outputs[r.OutputPath]; ok {
+			t.Errorf("%s and %s are both written to %s", previous, input, r.OutputPath)
+		}
+		outputs[r.OutputPath] = input
+		if _, err := os.Stat(r.OutputPath); err != nil {
+			t.Errorf("output of %s: %v", input, err)
+		}
+	}
+	if got := resultFor(t, results, jpg).OutputPath; got != filepath.Join(target, "IMG.jpg") {
+		t.Errorf("first input written to %s, want it to keep its name", got)
+	}
+}
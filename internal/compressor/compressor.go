@@ -2,7 +2,16 @@ package compressor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+
+	"photo-sorter-go/internal/config"
+
+	"github.com/sirupsen/logrus"
 )
 
 // CompressionParams defines parameters for the image compression process.
@@ -12,26 +21,293 @@ type CompressionParams struct {
 	Quality    int
 	Threshold  float64
 	Formats    []string
+
+	// PerFormat overrides Quality and Threshold by lower-case extension.
+	PerFormat map[string]FormatParams
+
+	// ConvertTo converts images to FormatJPEG or FormatWebP; ConvertNone or ""
+	// keeps each image in its own format.
+	ConvertTo string
+
+	// UseExiftool copies metadata with exiftool when it cannot be copied in Go.
+	UseExiftool bool
+
+	// StripMetadata removes privacy-sensitive metadata: StripNone (or ""),
+	// StripGPS or StripAllButEssential.
+	StripMetadata string
+
+	// Video configures re-encoding videos with ffmpeg.
+	Video VideoParams
+
+	// DryRun encodes images in memory to report what would be saved, without
+	// writing anything. Results get the actions "would_compress" and
+	// "would_skip". Videos are not encoded.
+	DryRun bool
+
+	// SampleEvery, with DryRun and above 1, encodes only every SampleEvery-th
+	// image; the others get "estimated" results projected from the sample.
+	SampleEvery int
+
+	// Workers is the number of images compressed at once, and MaxMemory
+	// the approximate memory in bytes they may hold, estimated from the image
+	// dimensions. 0 derives them from NumCPU and the available memory.
+	Workers   int
+	MaxMemory int64
+
+	// MarkStrategy is how compressed files are recorded so that later runs
+	// skip them: MarkEXIF (the default), MarkManifest or MarkXattr.
+	MarkStrategy string
+
+	// DetectFileType reads the first bytes of each image to find its real
+	// type, which then decides how it is compressed, instead of its extension.
+	DetectFileType bool
+
+	// InPlace replaces each file with its compressed version, in its own
+	// directory, instead of writing to TargetDir.
+	InPlace bool
+
+	// Force compresses images again even if a state file in TargetDir records
+	// them as compressed there, unchanged, by an earlier run. Such images
+	// otherwise get "cached" results.
+	Force bool
+
+	// Progress, if set, is called after each file. Calls are not concurrent.
+	Progress func(CompressionProgress)
+
+	// Logger, if set, gets the warnings that concern no single file, such
+	// as ffmpeg missing or an unreadable state file.
+	Logger logrus.FieldLogger
+}
+
+// warnf logs a warning to p.Logger, if set.
+func (p CompressionParams) warnf(format string, args ...any) {
+	if p.Logger != nil {
+		p.Logger.Warnf(format, args...)
+	}
 }
 
-// CompressionResult describes the result of compressing a single file.
+// CompressionProgress reports how far a compression run has got.
+type CompressionProgress struct {
+	Done       int   // files finished, including skipped and failed ones
+	Total      int   // files to process
+	BytesSaved int64 // bytes saved by the files compressed so far
+}
+
+// progressTracker counts finished files for CompressionParams.Progress.
+type progressTracker struct {
+	mu       sync.Mutex
+	progress CompressionProgress
+	report   func(CompressionProgress)
+}
+
+// done records a finished file and reports the progress.
+func (t *progressTracker) done(res CompressionResult) {
+	if t.report == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.Done++
+	if (res.Action == "compressed" || res.Action == "would_compress") && res.CompressedSize > 0 {
+		t.progress.BytesSaved += res.OriginalSize - res.CompressedSize
+	}
+	t.report(t.progress)
+}
+
+// FormatParams overrides the compression settings for one extension. Zero
+// fields use the settings of CompressionParams.
+type FormatParams struct {
+	Quality   int
+	Threshold float64
+}
+
+// outputPath returns the path a compressed file with the extension of input
+// is written to.
+func (p CompressionParams) outputPath(input string) string {
+	if p.InPlace {
+		return filepath.Clean(input)
+	}
+	return filepath.Join(p.TargetDir, filepath.Base(input))
+}
+
+// forExt returns the quality and threshold applied to files with extension ext.
+func (p CompressionParams) forExt(ext string) (int, float64) {
+	quality, threshold := p.Quality, p.Threshold
+	if format, ok := p.PerFormat[strings.ToLower(ext)]; ok {
+		if format.Quality > 0 {
+			quality = format.Quality
+		}
+		if format.Threshold > 0 {
+			threshold = format.Threshold
+		}
+	}
+	if threshold <= 0 {
+		threshold = 1.01
+	}
+	return quality, threshold
+}
+
+// ParamsFromConfig returns the parameters for compressing inputPaths into
+// targetDir with the compressor settings of the config.
+func ParamsFromConfig(cfg config.CompressorConfig, inputPaths []string, targetDir string) CompressionParams {
+	perFormat := make(map[string]FormatParams, len(cfg.Formats))
+	for ext, format := range cfg.Formats {
+		perFormat[ext] = FormatParams{Quality: format.Quality, Threshold: format.Threshold}
+	}
+	return CompressionParams{
+		InputPaths:    inputPaths,
+		TargetDir:     targetDir,
+		Quality:       cfg.Quality,
+		Threshold:     cfg.Threshold,
+		Formats:       cfg.Formats.Extensions(),
+		PerFormat:     perFormat,
+		ConvertTo:     cfg.ConvertTo,
+		UseExiftool:   cfg.UseExiftool,
+		StripMetadata: cfg.StripMetadata,
+		MarkStrategy:  cfg.MarkStrategy,
+		Workers:       cfg.Workers,
+		MaxMemory:     cfg.GetMaxMemory(),
+		Video: VideoParams{
+			Formats:       cfg.Video.Formats,
+			Codec:         cfg.Video.Codec,
+			CRF:           cfg.Video.CRF,
+			Preset:        cfg.Video.Preset,
+			MaxResolution: cfg.Video.MaxResolution,
+		},
+	}
+}
+
+// Override replaces the quality, threshold and formats of p with those that
+// are set (non-zero). The quality and threshold then apply to all formats,
+// replacing the per-format settings.
+func (p *CompressionParams) Override(quality int, threshold float64, formats []string) error {
+	if quality != 0 {
+		if quality < 1 || quality > 100 {
+			return errors.New("quality must be between 1 and 100")
+		}
+		p.Quality = quality
+	}
+	if threshold != 0 {
+		if threshold < 0 {
+			return errors.New("threshold must not be negative")
+		}
+		p.Threshold = threshold
+	}
+	for ext, format := range p.PerFormat {
+		if quality != 0 {
+			format.Quality = 0
+		}
+		if threshold != 0 {
+			format.Threshold = 0
+		}
+		p.PerFormat[ext] = format
+	}
+	if len(formats) > 0 {
+		p.Formats = nil
+		for _, ext := range formats {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			p.Formats = append(p.Formats, ext)
+		}
+	}
+	return nil
+}
+
+// Video codecs for VideoParams.Codec.
+const (
+	VideoCodecH264 = "h264"
+	VideoCodecH265 = "h265"
+)
+
+// VideoParams defines how videos are re-encoded. Videos are only compressed
+// if Formats lists their extensions and ffmpeg is installed.
+type VideoParams struct {
+	Formats []string
+	Codec   string // VideoCodecH264 or VideoCodecH265
+	CRF     int    // constant rate factor; lower means better quality and larger files
+	Preset  string // encoder preset, e.g. "medium" or "slow"
+
+	// MaxResolution scales videos down so that their shorter side is at most
+	// this many pixels, e.g. 1080 (0 keeps the resolution).
+	MaxResolution int
+}
+
+// CompressionResult describes the result of compressing a single file. In
+// JSON, Error is its message and Duration is duration_ms.
 type CompressionResult struct {
-	InputPath       string
-	OutputPath      string
-	OriginalSize    int64
-	CompressedSize  int64
-	PercentageSaved float64
-	Action          string
-	Message         string
-	Success         bool
-	StartedAt       time.Time
-	FinishedAt      time.Time
-	Error           error
+	InputPath       string        `json:"input_path"`
+	OutputPath      string        `json:"output_path,omitempty"`
+	OriginalSize    int64         `json:"original_size"`
+	CompressedSize  int64         `json:"compressed_size"`
+	PercentageSaved float64       `json:"percentage_saved"`
+	Action          string        `json:"action"`
+	Message         string        `json:"message,omitempty"`
+	Success         bool          `json:"success"`
+	StartedAt       time.Time     `json:"started_at"`
+	FinishedAt      time.Time     `json:"finished_at"`
+	Duration        time.Duration `json:"-"`                   // FinishedAt - StartedAt; video encodes take minutes
+	Quality         int           `json:"quality,omitempty"`   // quality applied to the file
+	Threshold       float64       `json:"threshold,omitempty"` // threshold applied to the file
+	Error           error         `json:"-"`
+}
+
+// MarshalJSON encodes r with the message of Error and the duration in
+// milliseconds.
+func (r CompressionResult) MarshalJSON() ([]byte, error) {
+	type result CompressionResult // without the MarshalJSON method
+	out := struct {
+		result
+		Error      string `json:"error,omitempty"`
+		DurationMS int64  `json:"duration_ms"`
+	}{result: result(r), DurationMS: r.FinishedAt.Sub(r.StartedAt).Milliseconds()}
+	if r.Error != nil {
+		out.Error = r.Error.Error()
+	}
+	return json.Marshal(out)
+}
+
+// CompressionSummary totals the results of a run. For dry runs, files that
+// would be compressed or are estimated count as compressed and BytesSaved is
+// the projected saving.
+type CompressionSummary struct {
+	TotalFiles int   `json:"total_files"`
+	Compressed int   `json:"compressed"`
+	Skipped    int   `json:"skipped"` // left alone, or the original kept
+	Cached     int   `json:"cached"`  // unchanged since an earlier run
+	Errors     int   `json:"errors"`
+	BytesSaved int64 `json:"bytes_saved"`
+}
+
+// Summarize returns the totals of results.
+func Summarize(results []CompressionResult) CompressionSummary {
+	summary := CompressionSummary{TotalFiles: len(results)}
+	for _, r := range results {
+		switch r.Action {
+		case "compressed", "would_compress", "estimated":
+			summary.Compressed++
+			if r.CompressedSize > 0 {
+				summary.BytesSaved += r.OriginalSize - r.CompressedSize
+			}
+		case "cached":
+			summary.Cached++
+		case "error":
+			summary.Errors++
+		default:
+			summary.Skipped++
+		}
+	}
+	return summary
 }
 
 // Compressor defines the interface for image compression.
 type Compressor interface {
 	// Compress processes a list of files or directories according to the parameters.
-	// Returns a slice of results for each file.
+	// Returns a slice of results for each file. When ctx is cancelled, the
+	// results of the files finished so far are returned with ctx.Err().
 	Compress(ctx context.Context, params CompressionParams) ([]CompressionResult, error)
 }
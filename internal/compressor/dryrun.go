@@ -0,0 +1,189 @@
+package compressor
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dryRunResult completes res with what compressOne would do for the image,
+// measured by encoding it in memory.
+func dryRunResult(res CompressionResult, img image.Image, format, outPath, decision string, params CompressionParams) CompressionResult {
+	size, err := encodedSize(res.InputPath, img, format, res.Quality, params)
+	if err != nil {
+		res.Action = "error"
+		res.Message = fmt.Sprintf("save error: %v", err)
+		res.Error = err
+		res.FinishedAt = time.Now()
+		return res
+	}
+	res.CompressedSize = size
+
+	// As in compressOne, only JPEG originals can be kept when stripping.
+	ext := strings.ToLower(filepath.Ext(res.InputPath))
+	keepOriginal := float64(size) >= float64(res.OriginalSize)*res.Threshold
+	if stripsMetadata(params.StripMetadata) && ext != ".jpg" && ext != ".jpeg" {
+		keepOriginal = false
+	}
+	if keepOriginal {
+		res.OutputPath = params.outputPath(res.InputPath)
+		res.Action = "would_skip"
+		res.Message = fmt.Sprintf("Dry run: compressed file not smaller than original, would save original (%s)", decision)
+	} else {
+		res.OutputPath = outPath
+		res.Action = "would_compress"
+		res.Message = "Dry run: image would be compressed: " + decision + res.Message
+		res.PercentageSaved = float64(res.OriginalSize-size) * 100 / float64(res.OriginalSize)
+	}
+	res.Success = true
+	res.FinishedAt = time.Now()
+	return res
+}
+
+// encodedSize returns the size of the image at src once compressed as format,
+// including the EXIF metadata copied into JPEGs. cwebp only writes files, so
+// WebP is encoded into a temporary file.
+func encodedSize(src string, img image.Image, format string, quality int, params CompressionParams) (int64, error) {
+	if format == FormatWebP {
+		tmp, err := os.CreateTemp("", "photo-sorter-*.webp")
+		if err != nil {
+			return 0, err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		if err := encodeWebP(src, tmp.Name(), quality, stripsMetadata(params.StripMetadata)); err != nil {
+			return 0, err
+		}
+		info, err := os.Stat(tmp.Name())
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+
+	data, err := encodeImageData(img, format, quality)
+	if err != nil {
+		return 0, err
+	}
+	if format == FormatJPEG {
+		if marked, _, err := markedJPEG(src, data, params.StripMetadata, marksSoftware(params.MarkStrategy)); err == nil {
+			data = marked
+		}
+	}
+	return int64(len(data)), nil
+}
+
+// sampleFiles splits files into every n-th file, starting with the first, and
+// the rest.
+func sampleFiles(files []string, n int) ([]string, []string) {
+	var sampled, rest []string
+	for i, f := range files {
+		if i%n == 0 {
+			sampled = append(sampled, f)
+		} else {
+			rest = append(rest, f)
+		}
+	}
+	return sampled, rest
+}
+
+// estimateResults returns "estimated" results for files, projecting their
+// compressed size from the sampled results with the same extension, or from
+// all of them if there are none.
+func estimateResults(files []string, sampled []CompressionResult) []CompressionResult {
+	type ratio struct {
+		files     int
+		orig, out int64
+	}
+	var all ratio
+	byExt := make(map[string]*ratio)
+	for _, r := range sampled {
+		out := r.OriginalSize
+		switch r.Action {
+		case "would_compress":
+			out = r.CompressedSize
+		case "would_skip":
+		default:
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(r.InputPath))
+		if byExt[ext] == nil {
+			byExt[ext] = &ratio{}
+		}
+		for _, t := range []*ratio{byExt[ext], &all} {
+			t.files++
+			t.orig += r.OriginalSize
+			t.out += out
+		}
+	}
+
+	results := make([]CompressionResult, 0, len(files))
+	for _, path := range files {
+		res := CompressionResult{InputPath: path, StartedAt: time.Now()}
+		info, err := os.Stat(path)
+		if err != nil {
+			res.Action = "error"
+			res.Message = fmt.Sprintf("stat error: %v", err)
+			res.Error = err
+			res.FinishedAt = time.Now()
+			results = append(results, res)
+			continue
+		}
+		res.OriginalSize = info.Size()
+
+		ext := strings.ToLower(filepath.Ext(path))
+		r := byExt[ext]
+		if r == nil {
+			r = &all
+		}
+		res.CompressedSize = res.OriginalSize
+		if r.orig > 0 {
+			res.CompressedSize = int64(float64(res.OriginalSize) * float64(r.out) / float64(r.orig))
+		}
+		if res.OriginalSize > 0 {
+			res.PercentageSaved = float64(res.OriginalSize-res.CompressedSize) * 100 / float64(res.OriginalSize)
+		}
+		res.Action = "estimated"
+		res.Message = fmt.Sprintf("Dry run: estimated from %d sampled files", r.files)
+		res.Success = true
+		res.FinishedAt = time.Now()
+		results = append(results, res)
+	}
+	return results
+}
+
+// alreadyCompressedResults returns "would_skip" results for files already
+// marked as compressed by PhotoSorter.
+func alreadyCompressedResults(files []string) []CompressionResult {
+	results := make([]CompressionResult, 0, len(files))
+	for _, path := range files {
+		res := CompressionResult{
+			InputPath: path,
+			StartedAt: time.Now(),
+			Action:    "would_skip",
+			Message:   "Already compressed by PhotoSorter",
+			Success:   true,
+		}
+		if info, err := os.Stat(path); err == nil {
+			res.OriginalSize = info.Size()
+		}
+		res.FinishedAt = time.Now()
+		results = append(results, res)
+	}
+	return results
+}
+
+// ProjectedSavings returns the bytes a dry run projects to save: the savings
+// of the "would_compress" and "estimated" results whose size was measured.
+func ProjectedSavings(results []CompressionResult) int64 {
+	var saved int64
+	for _, r := range results {
+		if (r.Action == "would_compress" || r.Action == "estimated") && r.CompressedSize > 0 {
+			saved += r.OriginalSize - r.CompressedSize
+		}
+	}
+	return saved
+}
@@ -0,0 +1,293 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"photo-sorter-go/internal/filetype"
+)
+
+// EXIF tags rewritten in compressed files.
+const (
+	tagOrientation = 0x0112
+	tagSoftware    = 0x0131
+)
+
+const (
+	exifHeader          = "Exif\x00\x00"
+	photoSorterSoftware = "PhotoSorter Compressed"
+	maxSegmentLength    = 0xFFFF // including the two length bytes
+)
+
+var errInvalidExif = errors.New("invalid EXIF data")
+
+// markCompressed copies the EXIF metadata of src into the JPEG at dst, strips
+// it as params.StripMetadata asks, resets the orientation and, with MarkEXIF,
+// sets Software to the PhotoSorter marker. It reports whether metadata was
+// stripped. With params.UseExiftool, exiftool is tried if the metadata cannot
+// be copied in Go.
+func markCompressed(src, dst string, params CompressionParams) (bool, error) {
+	software := marksSoftware(params.MarkStrategy)
+	stripped, err := copyExifAndMark(src, dst, params.StripMetadata, software)
+	switch {
+	case err == nil:
+		return stripped, nil
+	case stripsMetadata(params.StripMetadata):
+		// Rather than risk copying what should be removed, only mark the file.
+		return true, writeMarkedExif(dst, nil, software)
+	case params.UseExiftool:
+		return false, copyExifAndSetPhotoSorterMark(src, dst, software)
+	}
+	return false, err
+}
+
+// marksSoftware reports whether strategy marks files with the EXIF Software
+// tag. The other strategies keep the Software tag of the original.
+func marksSoftware(strategy string) bool {
+	return strategy != MarkManifest && strategy != MarkXattr
+}
+
+// stripsMetadata reports whether level removes any metadata.
+func stripsMetadata(level string) bool {
+	return level == StripGPS || level == StripAllButEssential
+}
+
+// copyExifAndMark copies the EXIF segment of src, if it is a JPEG, into the
+// JPEG at dst, as markedJPEG does.
+func copyExifAndMark(src, dst, level string, software bool) (bool, error) {
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		return false, err
+	}
+	data, stripped, err := markedJPEG(src, data, level, software)
+	if err != nil {
+		return false, err
+	}
+	return stripped, os.WriteFile(dst, data, 0644)
+}
+
+// markedJPEG returns the JPEG data with the EXIF segment of src, if it is a
+// JPEG, stripped to level, with Orientation=1 and, if software is set, the
+// PhotoSorter Software tag. Other sources only get the tags set by the
+// compressor.
+func markedJPEG(src string, data []byte, level string, software bool) ([]byte, bool, error) {
+	var tiff []byte
+	if t, _ := filetype.Detect(src); t == filetype.JPEG { // whatever its extension
+		srcData, err := os.ReadFile(src)
+		if err != nil {
+			return nil, false, err
+		}
+		tiff = jpegExif(srcData)
+	}
+	tiff, stripped, err := stripExif(tiff, level)
+	if err != nil {
+		return nil, false, err
+	}
+	marked, err := markedExif(tiff, software)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err = spliceExif(data, marked)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, stripped, nil
+}
+
+// writeMarkedExif inserts the TIFF data tiff, marked by markedExif, into the
+// JPEG at dst.
+func writeMarkedExif(dst string, tiff []byte, software bool) error {
+	marked, err := markedExif(tiff, software)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		return err
+	}
+	data, err = spliceExif(data, marked)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// copyOriginalStripped copies the JPEG at src to dst with its EXIF metadata
+// stripped to level and its XMP and IPTC metadata removed. The pixels are
+// untouched, so the orientation is kept.
+func copyOriginalStripped(src, dst, level string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	tiff, _, err := stripExif(jpegExif(data), level)
+	if err != nil {
+		tiff = nil // EXIF that cannot be read cannot be stripped either
+	}
+	data = withoutMetadata(data)
+	if len(tiff) > 0 {
+		if data, err = spliceExif(data, tiff); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// withoutMetadata returns the JPEG data without its APP1 (EXIF, XMP) and
+// APP13 (IPTC) segments.
+func withoutMetadata(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+	out := append(make([]byte, 0, len(data)), data[:2]...)
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 || marker == 0xFF {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			break
+		}
+		if marker != 0xE1 && marker != 0xED {
+			out = append(out, data[i:i+2+n]...)
+		}
+		i += 2 + n
+	}
+	return append(out, data[i:]...)
+}
+
+// jpegExif returns the TIFF data of the EXIF APP1 segment of a JPEG, or nil if
+// it has none.
+func jpegExif(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // metadata precedes the image data
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte(exifHeader)) {
+			return segment[len(exifHeader):]
+		}
+		i += 2 + n
+	}
+	return nil
+}
+
+// markedExif returns a copy of the TIFF data tiff with Orientation=1 and, if
+// software is set, the PhotoSorter Software tag, or new TIFF data holding just
+// the tag if tiff is empty. The updated IFD0 is appended, so offsets into the
+// original data, such as those of the EXIF and GPS IFDs, stay valid.
+func markedExif(tiff []byte, software bool) ([]byte, error) {
+	if len(tiff) == 0 {
+		tiff = []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0} // IFD0 without entries
+	}
+	order, err := byteOrder(tiff)
+	if err != nil {
+		return nil, err
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return nil, errInvalidExif
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	end := ifd + 2 + count*12
+	if end+4 > len(tiff) {
+		return nil, errInvalidExif
+	}
+
+	var entries [][]byte
+	for i := ifd + 2; i < end; i += 12 {
+		entry := append([]byte(nil), tiff[i:i+12]...)
+		switch order.Uint16(entry) {
+		case tagSoftware:
+			if software {
+				continue
+			}
+		case tagOrientation:
+			// A SHORT value is stored in the first two bytes of the value field.
+			copy(entry[8:], []byte{0, 0, 0, 0})
+			order.PutUint16(entry[8:], 1)
+		}
+		entries = append(entries, entry)
+	}
+
+	out := append([]byte(nil), tiff...)
+	if len(out)%2 == 1 { // offsets must be even
+		out = append(out, 0)
+	}
+	newIFD := len(out)
+	var value []byte
+	if software {
+		value = append([]byte(photoSorterSoftware), 0)
+		entry := make([]byte, 12)
+		order.PutUint16(entry, tagSoftware)
+		order.PutUint16(entry[2:], 2) // ASCII
+		order.PutUint32(entry[4:], uint32(len(value)))
+		order.PutUint32(entry[8:], uint32(newIFD+2+(len(entries)+1)*12+4))
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return order.Uint16(entries[i]) < order.Uint16(entries[j])
+	})
+
+	buf := make([]byte, 2, 2+len(entries)*12+4+len(value))
+	order.PutUint16(buf, uint16(len(entries)))
+	for _, e := range entries {
+		buf = append(buf, e...)
+	}
+	buf = append(buf, tiff[end:end+4]...) // offset of IFD1, the thumbnail
+	buf = append(buf, value...)
+	out = append(out, buf...)
+	order.PutUint32(out[4:], uint32(newIFD))
+
+	if 2+len(exifHeader)+len(out) > maxSegmentLength {
+		return nil, fmt.Errorf("EXIF data too large for a JPEG segment (%d bytes)", len(out))
+	}
+	return out, nil
+}
+
+// spliceExif returns the JPEG data with an EXIF APP1 segment holding tiff
+// inserted after the start of image marker and a JFIF APP0 segment, if any.
+func spliceExif(data, tiff []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG file")
+	}
+	pos := 2
+	if data[2] == 0xFF && data[3] == 0xE0 && len(data) >= 6 {
+		pos += 2 + int(binary.BigEndian.Uint16(data[4:]))
+		if pos > len(data) {
+			return nil, errors.New("truncated JPEG file")
+		}
+	}
+
+	segment := make([]byte, 4, 4+len(exifHeader)+len(tiff))
+	segment[0], segment[1] = 0xFF, 0xE1
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(exifHeader)+len(tiff)))
+	segment = append(segment, exifHeader...)
+	segment = append(segment, tiff...)
+
+	out := make([]byte, 0, len(data)+len(segment))
+	out = append(out, data[:pos]...)
+	out = append(out, segment...)
+	return append(out, data[pos:]...), nil
+}
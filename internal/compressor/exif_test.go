@@ -0,0 +1,144 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// uprightImage returns a noisy portrait image, red in its top half and blue
+// in its bottom half.
+func uprightImage() *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 32; x++ {
+			noise := uint8(rng.Intn(64))
+			if y < 32 {
+				img.Set(x, y, color.NRGBA{R: 192 + noise, G: noise, B: noise, A: 255})
+			} else {
+				img.Set(x, y, color.NRGBA{R: noise, G: noise, B: 192 + noise, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+// redness returns the mean red minus blue of the rows of img from y0 to y1.
+func redness(img image.Image, y0, y1 int) int {
+	b := img.Bounds()
+	var sum, n int
+	for y := y0; y < y1; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, _, bl, _ := img.At(x, y).RGBA()
+			sum += int(r>>8) - int(bl>>8)
+			n++
+		}
+	}
+	return sum / n
+}
+
+func TestCompressedPhotoDisplaysUpright(t *testing.T) {
+	tests := []struct {
+		orientation int
+		stored      func(image.Image) *image.NRGBA // as the camera stored the upright image
+	}{
+		{orientation: 3, stored: imaging.Rotate180},
+		{orientation: 6, stored: imaging.Rotate90},
+		{orientation: 8, stored: imaging.Rotate270},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.orientation), func(t *testing.T) {
+			dir := t.TempDir()
+			input := writeJPEGWithExif(t, filepath.Join(dir, "IMG_0001.jpg"),
+				tt.stored(uprightImage()), photoExif(tt.orientation, "2003:11:23 10:00:00", false))
+
+			params := testParams(input)
+			params.TargetDir = filepath.Join(dir, "out")
+			results, err := NewDefaultCompressor().Compress(context.Background(), params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := resultFor(t, results, input)
+			if r.Action != "compressed" {
+				t.Fatalf("got %s (%s), want compressed", r.Action, r.Message)
+			}
+
+			// Displayed as a viewer would: the pixels turned by the orientation tag.
+			shown, err := imaging.Open(r.OutputPath, imaging.AutoOrientation(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := shown.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+				t.Fatalf("output displays as %dx%d, want 32x64", b.Dx(), b.Dy())
+			}
+			if top, bottom := redness(shown, 0, 24), redness(shown, 40, 64); top < 100 || bottom > -100 {
+				t.Errorf("output displays turned: top redness %d, bottom redness %d", top, bottom)
+			}
+
+			x := readExif(t, r.OutputPath)
+			if tag, err := x.Get(exif.Orientation); err != nil {
+				t.Errorf("output has no orientation: %v", err)
+			} else if v, _ := tag.Int(0); v != 1 {
+				t.Errorf("output orientation = %d, want 1 for the upright pixels", v)
+			}
+			if _, err := x.Get(exif.DateTimeOriginal); err != nil {
+				t.Errorf("DateTimeOriginal lost: %v", err)
+			}
+		})
+	}
+}
+
+func TestStripMetadataRemovesGPS(t *testing.T) {
+	tests := []struct {
+		level   string
+		wantGPS bool
+	}{
+		{level: StripNone, wantGPS: true},
+		{level: StripGPS},
+		{level: StripAllButEssential},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			dir := t.TempDir()
+			input := writeJPEGWithExif(t, filepath.Join(dir, "IMG_0001.jpg"),
+				uprightImage(), photoExif(1, "2003:11:23 10:00:00", true))
+			if _, err := readExif(t, input).Get(exif.GPSLatitude); err != nil {
+				t.Fatalf("fixture has no GPSLatitude: %v", err)
+			}
+
+			params := testParams(input)
+			params.TargetDir = filepath.Join(dir, "out")
+			params.StripMetadata = tt.level
+			results, err := NewDefaultCompressor().Compress(context.Background(), params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := resultFor(t, results, input)
+			if !r.Success {
+				t.Fatalf("got %s (%s)", r.Action, r.Message)
+			}
+
+			x := readExif(t, r.OutputPath)
+			if _, err := x.Get(exif.GPSLatitude); (err == nil) != tt.wantGPS {
+				t.Errorf("GPSLatitude in output: %v, want %v", err == nil, tt.wantGPS)
+			}
+			if tag, err := x.Get(exif.DateTimeOriginal); err != nil {
+				t.Errorf("DateTimeOriginal lost: %v", err)
+			} else if date, _ := tag.StringVal(); date != "2003:11:23 10:00:00" {
+				t.Errorf("DateTimeOriginal = %q, want 2003:11:23 10:00:00", date)
+			}
+			if noted := strings.Contains(r.Message, strippedNote(tt.level)); noted == tt.wantGPS {
+				t.Errorf("message %q, want the stripped note only when stripping", r.Message)
+			}
+		})
+	}
+}
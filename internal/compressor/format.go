@@ -0,0 +1,164 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp" // decodes WebP inputs converted to JPEG
+)
+
+// Image encodings. FormatJPEG and FormatWebP are also values of
+// CompressionParams.ConvertTo, along with ConvertNone.
+const (
+	FormatJPEG  = "jpeg"
+	FormatPNG   = "png"
+	FormatWebP  = "webp"
+	ConvertNone = "none"
+)
+
+// imageFormat decides how an image with extension ext is encoded. It returns
+// "" and the reason if the image is left alone. Without conversion, JPEGs stay
+// JPEGs and PNGs are recompressed losslessly; WebP files are only converted
+// to JPEG, since re-encoding them as WebP loses quality on every run.
+func imageFormat(ext, convertTo string) (string, string) {
+	ext = strings.ToLower(ext)
+	if ext == ".webp" && convertTo != FormatJPEG {
+		return "", "Already WebP, left as is"
+	}
+	switch convertTo {
+	case FormatJPEG, FormatWebP:
+		return convertTo, ""
+	}
+	switch ext {
+	case ".jpg", ".jpeg":
+		return FormatJPEG, ""
+	case ".png":
+		return FormatPNG, ""
+	}
+	return "", fmt.Sprintf("No encoder for %s files; set convert_to to convert them", ext)
+}
+
+// outputExt returns the extension of a file encoded as format. The source
+// extension is kept if it already matches.
+func outputExt(srcExt, format string) string {
+	switch format {
+	case FormatJPEG:
+		if e := strings.ToLower(srcExt); e == ".jpg" || e == ".jpeg" {
+			return srcExt
+		}
+		return ".jpg"
+	case FormatPNG:
+		if strings.EqualFold(srcExt, ".png") {
+			return srcExt
+		}
+		return ".png"
+	}
+	return "." + format
+}
+
+// formatDecision describes the encoding chosen for a file with extension
+// srcExt, for CompressionResult.Message.
+func formatDecision(srcExt, format string) string {
+	src := strings.ToUpper(strings.TrimPrefix(srcExt, "."))
+	if src == "JPG" {
+		src = "JPEG"
+	}
+	dst := strings.ToUpper(format)
+	switch {
+	case format == FormatPNG && src == "PNG":
+		return "PNG recompressed losslessly"
+	case src == dst:
+		return src + " re-encoded"
+	}
+	return fmt.Sprintf("%s converted to %s", src, dst)
+}
+
+// isOpaque reports whether img has no transparent pixels. Images whose type
+// cannot tell are treated as transparent, so they are not flattened.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// encodeImage writes img encoded as JPEG or PNG to path.
+func encodeImage(img image.Image, path, format string, quality int) error {
+	data, err := encodeImageData(img, format, quality)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write tmp file error: %w", err)
+	}
+	return nil
+}
+
+// encodeImageData returns img encoded as JPEG or PNG.
+func encodeImageData(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == FormatPNG {
+		err = imaging.Encode(&buf, img, imaging.PNG, imaging.PNGCompressionLevel(png.BestCompression))
+	} else {
+		err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(quality))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode error: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeWebP converts the image at src to WebP at path with cwebp, which also
+// copies the EXIF and XMP metadata. With strip, no metadata is written; the
+// image is then rotated upright first, as the EXIF orientation is lost.
+func encodeWebP(src, path string, quality int, strip bool) error {
+	metadata := "all"
+	if strip {
+		img, err := imaging.Open(src, imaging.AutoOrientation(true))
+		if err != nil {
+			return fmt.Errorf("open error: %w", err)
+		}
+		upright := path + ".png"
+		if err := encodeImage(img, upright, FormatPNG, 0); err != nil {
+			return err
+		}
+		defer os.Remove(upright)
+		src, metadata = upright, "none"
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("cwebp", "-quiet", "-q", strconv.Itoa(quality), "-metadata", metadata, src, "-o", path)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		_ = os.Remove(path)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("cwebp failed: %w: %s", err, lastLine(msg))
+		}
+		return fmt.Errorf("cwebp failed: %w", err)
+	}
+	return nil
+}
+
+// ConvertedPath returns the path of the image at path once converted by
+// convertTo (a CompressionParams.ConvertTo), or path if its name is kept.
+// Compress may choose another name if that one is taken; the results tell.
+func ConvertedPath(path, convertTo string) string {
+	if convertTo == "" || convertTo == ConvertNone {
+		return path
+	}
+	return replaceExt(path, outputExt(filepath.Ext(path), convertTo))
+}
+
+// replaceExt returns path with its extension replaced by ext.
+func replaceExt(path, ext string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
@@ -1,19 +1,21 @@
 package compressor
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"image"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/barasher/go-exiftool"
+	"photo-sorter-go/internal/filetype"
+
 	"github.com/disintegration/imaging"
 	"github.com/rwcarlsen/goexif/exif"
 )
@@ -26,32 +28,132 @@ func NewDefaultCompressor() *DefaultCompressor {
 	return &DefaultCompressor{}
 }
 
-// Compress performs image compression according to the provided parameters.
+// Compress compresses the images and re-encodes the videos found in the input
+// paths according to the provided parameters. If ctx is cancelled, it stops
+// starting new files and returns the results of the files finished so far
+// along with ctx.Err().
 func (c *DefaultCompressor) Compress(ctx context.Context, params CompressionParams) ([]CompressionResult, error) {
-	startGlobal := time.Now()
+	images, marked, err := imagesToCompress(params)
+	if err != nil {
+		return nil, err
+	}
+	videos, ffmpeg, err := videosToCompress(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache *compressionCache
+	var cached []CompressionResult
+	if params.usesCache() {
+		cache = loadCache(params)
+		if !params.Force {
+			images, cached = cachedImages(cache, images, params)
+		}
+	}
+
+	// A dry run may encode only a sample of the images and estimate the rest.
+	var estimated []string
+	if params.DryRun && params.SampleEvery > 1 {
+		images, estimated = sampleFiles(images, params.SampleEvery)
+	}
+
+	progress := &progressTracker{report: params.Progress}
+	progress.progress.Total = len(images) + len(videos)
+	results := compressImages(ctx, images, params, progress)
+	if ctx.Err() == nil && len(estimated) > 0 {
+		results = append(results, estimateResults(estimated, results)...)
+	}
+	if params.DryRun {
+		results = append(results, alreadyCompressedResults(marked)...)
+	}
+	if cache != nil && !params.DryRun && cache.record(results) > 0 {
+		if err := cache.save(); err != nil {
+			params.warnf("%v", err)
+		}
+	}
+	results = append(results, cached...)
+	results = append(results, compressVideos(ctx, ffmpeg, videos, params, progress)...)
+
+	for i := range results {
+		results[i].Duration = results[i].FinishedAt.Sub(results[i].StartedAt)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].InputPath < results[j].InputPath })
+	return results, ctx.Err()
+}
+
+// cachedImages splits files into those to compress and "cached" results for
+// those compressed into the target directory by an earlier run.
+func cachedImages(cache *compressionCache, files []string, params CompressionParams) ([]string, []CompressionResult) {
+	var rest []string
+	var cached []CompressionResult
+	for _, path := range files {
+		quality, _ := params.forExt(filepath.Ext(path))
+		if res, ok := cache.lookup(path, quality); ok {
+			cached = append(cached, res)
+		} else {
+			rest = append(rest, path)
+		}
+	}
+	return rest, cached
+}
+
+// cancelledResult returns the result for a file skipped because the run was
+// cancelled before it started.
+func cancelledResult(path string) CompressionResult {
+	now := time.Now()
+	return CompressionResult{
+		InputPath:  path,
+		StartedAt:  now,
+		FinishedAt: now,
+		Action:     "cancelled",
+		Message:    "Stopped before the file was compressed",
+	}
+}
+
+// imagesToCompress returns the images in the input paths that have not been
+// compressed before and those that have, and prepares the target directory.
+func imagesToCompress(params CompressionParams) ([]string, []string, error) {
 	files, err := collectImageFiles(params.InputPaths, params.Formats)
 	if err != nil {
-		return nil, fmt.Errorf("collect files: %w", err)
+		return nil, nil, fmt.Errorf("collect files: %w", err)
 	}
 	if len(files) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	filesToCompress, err := filterUncompressedImages(files, runtime.NumCPU())
+	filesToCompress, marked, err := filterUncompressedImages(files, newMarkChecker(params.MarkStrategy), runtime.NumCPU())
 	if err != nil {
-		return nil, fmt.Errorf("filter uncompressed: %w", err)
+		return nil, nil, fmt.Errorf("filter uncompressed: %w", err)
 	}
 	if len(filesToCompress) == 0 {
-		return nil, nil
+		return nil, marked, nil
 	}
 
-	if params.TargetDir != "" {
+	if params.ConvertTo == FormatWebP {
+		if _, err := exec.LookPath("cwebp"); err != nil {
+			return nil, nil, fmt.Errorf("convert_to webp needs cwebp from libwebp: %w", err)
+		}
+	}
+
+	if params.TargetDir != "" && !params.DryRun && !params.InPlace {
 		if err := os.MkdirAll(params.TargetDir, 0755); err != nil {
-			return nil, fmt.Errorf("create target dir: %w", err)
+			return nil, nil, fmt.Errorf("create target dir: %w", err)
 		}
 	}
+	return filesToCompress, marked, nil
+}
+
+// compressImages compresses files in parallel, within the worker and memory
+// limits of params. Once ctx is cancelled, the remaining files get
+// "cancelled" results. The results are in input order.
+func compressImages(ctx context.Context, files []string, params CompressionParams, progress *progressTracker) []CompressionResult {
+	if len(files) == 0 {
+		return nil
+	}
 
-	numWorkers := max(runtime.NumCPU(), 2)
+	numWorkers, maxMemory := params.limits()
+	budget := newMemoryBudget(maxMemory)
+	claims := newOutputClaims(files, params)
 	type job struct {
 		index int
 		path  string
@@ -61,8 +163,8 @@ func (c *DefaultCompressor) Compress(ctx context.Context, params CompressionPara
 		res   CompressionResult
 	}
 
-	jobs := make(chan job, len(filesToCompress))
-	results := make(chan result, len(filesToCompress))
+	jobs := make(chan job, len(files))
+	results := make(chan result, len(files))
 
 	var wg sync.WaitGroup
 	wg.Add(numWorkers)
@@ -70,18 +172,28 @@ func (c *DefaultCompressor) Compress(ctx context.Context, params CompressionPara
 		go func() {
 			defer wg.Done()
 			for j := range jobs {
-				select {
-				case <-ctx.Done():
-					return
-				default:
+				if ctx.Err() != nil {
+					results <- result{index: j.index, res: cancelledResult(j.path)}
+					continue
 				}
-				r := compressOne(j.path, params)
+				held := budget.acquire(decodedSize(j.path))
+				if ctx.Err() != nil {
+					budget.release(held)
+					results <- result{index: j.index, res: cancelledResult(j.path)}
+					continue
+				}
+				r := compressOne(j.path, params, claims)
+				budget.release(held)
+				if params.DryRun && r.Action == "skipped" {
+					r.Action = "would_skip"
+				}
+				progress.done(r)
 				results <- result{index: j.index, res: r}
 			}
 		}()
 	}
 
-	for i, path := range filesToCompress {
+	for i, path := range files {
 		jobs <- job{index: i, path: path}
 	}
 	close(jobs)
@@ -89,13 +201,16 @@ func (c *DefaultCompressor) Compress(ctx context.Context, params CompressionPara
 	wg.Wait()
 	close(results)
 
-	resArr := make([]CompressionResult, len(filesToCompress))
+	finished := make([]result, 0, len(files))
 	for r := range results {
-		resArr[r.index] = r.res
+		finished = append(finished, r)
 	}
-
-	_ = startGlobal
-	return resArr, nil
+	sort.Slice(finished, func(i, j int) bool { return finished[i].index < finished[j].index })
+	resArr := make([]CompressionResult, len(finished))
+	for i, r := range finished {
+		resArr[i] = r.res
+	}
+	return resArr
 }
 
 // collectImageFiles recursively collects all files with supported extensions.
@@ -135,8 +250,9 @@ func collectImageFiles(inputPaths []string, formats []string) ([]string, error)
 	return files, nil
 }
 
-// filterUncompressedImages filters out files that already have Software=PhotoSorter in EXIF (JPEG/JPG).
-func filterUncompressedImages(files []string, numWorkers int) ([]string, error) {
+// filterUncompressedImages filters out files that marks records as compressed,
+// returning them separately.
+func filterUncompressedImages(files []string, marks *markChecker, numWorkers int) ([]string, []string, error) {
 	type result struct {
 		path string
 		keep bool
@@ -150,12 +266,7 @@ func filterUncompressedImages(files []string, numWorkers int) ([]string, error)
 		go func() {
 			defer wg.Done()
 			for path := range jobs {
-				ext := strings.ToLower(filepath.Ext(path))
-				keep := true
-				if ext == ".jpg" || ext == ".jpeg" {
-					keep = !hasPhotoSorterSoftwareFlag(path)
-				}
-				results <- result{path: path, keep: keep}
+				results <- result{path: path, keep: !marks.compressed(path)}
 			}
 		}()
 	}
@@ -167,13 +278,15 @@ func filterUncompressedImages(files []string, numWorkers int) ([]string, error)
 	wg.Wait()
 	close(results)
 
-	var filtered []string
+	var filtered, marked []string
 	for r := range results {
 		if r.keep {
 			filtered = append(filtered, r.path)
+		} else {
+			marked = append(marked, r.path)
 		}
 	}
-	return filtered, nil
+	return filtered, marked, nil
 }
 
 // hasPhotoSorterSoftwareFlag returns true if the EXIF Software tag contains "PhotoSorter".
@@ -198,8 +311,9 @@ func hasPhotoSorterSoftwareFlag(path string) bool {
 	return strings.Contains(val, "PhotoSorter")
 }
 
-// compressOne compresses a single file and returns a CompressionResult.
-func compressOne(inputPath string, params CompressionParams) CompressionResult {
+// compressOne compresses a single file and returns a CompressionResult. A
+// converted file whose new name is taken, per claims, gets a unique one.
+func compressOne(inputPath string, params CompressionParams, claims *outputClaims) CompressionResult {
 	start := time.Now()
 	res := CompressionResult{
 		InputPath: inputPath,
@@ -218,10 +332,19 @@ func compressOne(inputPath string, params CompressionParams) CompressionResult {
 
 	extOrig := filepath.Ext(inputPath)
 	ext := strings.ToLower(extOrig)
+	// An image whose extension does not match its content is compressed as
+	// what it is, and keeps its name unless it is converted.
+	misnamed := false
+	if params.DetectFileType {
+		if t, err := filetype.Detect(inputPath); err == nil && t != nil && !t.Matches(ext) {
+			ext, misnamed = t.Extension, true
+		}
+	}
+	quality, threshold := params.forExt(ext)
+	res.Quality, res.Threshold = quality, threshold
 
 	if ext == ".jpg" || ext == ".jpeg" {
-		hasMark, err := hasPhotoSorterMarkExiftool(inputPath)
-		if err == nil && hasMark {
+		if hasPhotoSorterSoftwareFlag(inputPath) {
 			res.Action = "skipped"
 			res.Message = "Already compressed by PhotoSorter"
 			res.Success = true
@@ -230,17 +353,58 @@ func compressOne(inputPath string, params CompressionParams) CompressionResult {
 		}
 	}
 
-	img, err := imaging.Open(inputPath)
-	if err != nil {
-		res.Action = "error"
-		res.Message = fmt.Sprintf("open error: %v", err)
-		res.Error = err
+	format, reason := imageFormat(ext, params.ConvertTo)
+	if format == "" {
+		res.Action = "skipped"
+		res.Message = reason
+		res.Success = true
 		res.FinishedAt = time.Now()
-		fmt.Printf("Compression error for %s: %s\n", inputPath, res.Message)
 		return res
 	}
 
-	outPath := filepath.Join(params.TargetDir, filepath.Base(inputPath))
+	var img image.Image
+	if format != FormatWebP {
+		// The EXIF orientation is applied to the pixels, since the encoders
+		// write no EXIF; the copied tags get Orientation=1 below.
+		img, err = imaging.Open(inputPath, imaging.AutoOrientation(true))
+		if err != nil {
+			res.Action = "error"
+			res.Message = fmt.Sprintf("open error: %v", err)
+			res.Error = err
+			res.FinishedAt = time.Now()
+			fmt.Printf("Compression error for %s: %s\n", inputPath, res.Message)
+			return res
+		}
+		// JPEG has no transparency: transparent PNGs stay PNGs, other
+		// transparent images are left alone.
+		if format == FormatJPEG && !isOpaque(img) {
+			if ext != ".png" {
+				res.Action = "skipped"
+				res.Message = "Image has transparency, not converted to JPEG"
+				res.Success = true
+				res.FinishedAt = time.Now()
+				return res
+			}
+			format = FormatPNG
+		}
+	}
+	decision := formatDecision(ext, format)
+
+	outExt := outputExt(extOrig, format)
+	if misnamed && (params.ConvertTo == "" || params.ConvertTo == ConvertNone) {
+		outExt = extOrig
+	}
+	origPath := claims.claim(inputPath, params.outputPath(inputPath))
+	outPath := replaceExt(origPath, outExt)
+	if outPath != origPath {
+		outPath = claims.claim(inputPath, outPath)
+	}
+	if wanted := replaceExt(params.outputPath(inputPath), outExt); outPath != wanted {
+		res.Message = fmt.Sprintf("; saved as %s, %s exists", filepath.Base(outPath), filepath.Base(wanted))
+	}
+	if params.DryRun {
+		return dryRunResult(res, img, format, outPath, decision, params)
+	}
 	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
 		res.Action = "error"
 		res.Message = fmt.Sprintf("mkdir error: %v", err)
@@ -251,23 +415,16 @@ func compressOne(inputPath string, params CompressionParams) CompressionResult {
 	res.OutputPath = outPath
 
 	tmpPath := outPath + ".tmp"
-	var saveErr error
-
-	var buf bytes.Buffer
-	err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(params.Quality))
-	if err != nil {
-		saveErr = fmt.Errorf("encode error: %w", err)
-	} else {
-		err = os.WriteFile(tmpPath, buf.Bytes(), 0644)
-		if err != nil {
-			saveErr = fmt.Errorf("write tmp file error: %w", err)
-		} else {
-			if strings.ToLower(extOrig) == ".jpg" || strings.ToLower(extOrig) == ".jpeg" {
-				exifErr := copyExifAndSetPhotoSorterMark(inputPath, tmpPath)
-				if exifErr != nil {
-					res.Message = fmt.Sprintf("warning: exif not copied/marked: %v", exifErr)
-				}
-			}
+	var saveErr, exifErr error
+	var stripped bool
+	switch format {
+	case FormatWebP:
+		saveErr = encodeWebP(inputPath, tmpPath, quality, stripsMetadata(params.StripMetadata))
+		stripped = stripsMetadata(params.StripMetadata)
+	default:
+		saveErr = encodeImage(img, tmpPath, format, quality)
+		if saveErr == nil && format == FormatJPEG {
+			stripped, exifErr = markCompressed(inputPath, tmpPath, params)
 		}
 	}
 
@@ -294,12 +451,23 @@ func compressOne(inputPath string, params CompressionParams) CompressionResult {
 	compSize := compInfo.Size()
 	res.CompressedSize = compSize
 
-	threshold := params.Threshold
-	if threshold <= 0 {
-		threshold = 1.01
-	}
-	if float64(compSize) >= float64(origSize)*threshold {
-		copyErr := copyFile(inputPath, outPath)
+	// The original would bring back the metadata to strip; only JPEGs can be
+	// stripped without re-encoding, otherwise the re-encoded file is kept.
+	keepOriginal := float64(compSize) >= float64(origSize)*threshold
+	stripOriginal := stripsMetadata(params.StripMetadata) && (ext == ".jpg" || ext == ".jpeg")
+	if keepOriginal && stripsMetadata(params.StripMetadata) && !stripOriginal {
+		keepOriginal = false
+	}
+	if keepOriginal {
+		res.OutputPath = origPath
+		var copyErr error
+		switch {
+		case stripOriginal:
+			copyErr = copyOriginalStripped(inputPath, origPath, params.StripMetadata)
+			stripped = true
+		case !params.InPlace: // in place, the original is already there
+			copyErr = copyFile(inputPath, origPath)
+		}
 		if copyErr != nil {
 			res.Action = "error"
 			res.Message = fmt.Sprintf("copy original error: %v", copyErr)
@@ -310,7 +478,7 @@ func compressOne(inputPath string, params CompressionParams) CompressionResult {
 			return res
 		}
 		res.Action = "original"
-		res.Message = "Compressed file not smaller than original, saved original"
+		res.Message = fmt.Sprintf("Compressed file not smaller than original, saved original (%s)", decision)
 		res.PercentageSaved = 0
 		_ = os.Remove(tmpPath)
 	} else {
@@ -322,15 +490,44 @@ func compressOne(inputPath string, params CompressionParams) CompressionResult {
 			res.FinishedAt = time.Now()
 			return res
 		}
+		// Replacing the original keeps its modification time, which may date it.
+		if params.InPlace {
+			_ = os.Chtimes(outPath, info.ModTime(), info.ModTime())
+		}
+		// A converted file replacing its original in place has a new name.
+		if params.InPlace && outPath != origPath {
+			if err := os.Remove(inputPath); err != nil {
+				res.Message = fmt.Sprintf("; warning: original not removed: %v", err)
+			}
+		}
 		res.Action = "compressed"
-		res.Message = "Image compressed"
+		res.Message = "Image compressed: " + decision + res.Message
+		if exifErr != nil {
+			res.Message += fmt.Sprintf("; warning: exif not copied/marked: %v", exifErr)
+		}
 		res.PercentageSaved = float64(origSize-compSize) * 100 / float64(origSize)
 	}
+	if stripped {
+		res.Message += "; " + strippedNote(params.StripMetadata)
+	}
 	res.Success = (res.Action == "compressed" || res.Action == "original")
+	if res.Success {
+		if err := recordCompressed(res.OutputPath, params.MarkStrategy); err != nil {
+			res.Message += fmt.Sprintf("; warning: not marked as compressed: %v", err)
+		}
+	}
 	res.FinishedAt = time.Now()
 	return res
 }
 
+// strippedNote describes the metadata removed at level, for CompressionResult.Message.
+func strippedNote(level string) string {
+	if level == StripGPS {
+		return "GPS metadata removed"
+	}
+	return "metadata stripped to camera, dates and orientation"
+}
+
 // copyFile copies file src to dst.
 func copyFile(src, dst string) error {
 	in, err := os.Open(src)
@@ -358,32 +555,19 @@ func ioCopy(dst *os.File, src *os.File) (written int64, err error) {
 }
 
 // copyExifAndSetPhotoSorterMark copies EXIF from src to dst and sets Software=PhotoSorter Compressed using exiftool.
-func copyExifAndSetPhotoSorterMark(src, dst string) error {
+// The orientation is reset, as dst holds pixels that are already rotated.
+func copyExifAndSetPhotoSorterMark(src, dst string, software bool) error {
 	cmdCopy := exec.Command("exiftool", "-TagsFromFile", src, "-overwrite_original", dst)
 	if err := cmdCopy.Run(); err != nil {
 		return fmt.Errorf("exiftool copy failed: %v", err)
 	}
-	cmdSet := exec.Command("exiftool", "-overwrite_original", "-Software=PhotoSorter Compressed", dst)
+	args := []string{"-overwrite_original", "-Orientation#=1", dst}
+	if software {
+		args = append(args, "-Software=PhotoSorter Compressed")
+	}
+	cmdSet := exec.Command("exiftool", args...)
 	if err := cmdSet.Run(); err != nil {
 		return fmt.Errorf("exiftool set Software failed: %v", err)
 	}
 	return nil
 }
-
-// hasPhotoSorterMarkExiftool checks if the EXIF Software tag contains "PhotoSorter" using exiftool.
-func hasPhotoSorterMarkExiftool(path string) (bool, error) {
-	et, err := exiftool.NewExiftool()
-	if err != nil {
-		return false, err
-	}
-	defer et.Close()
-	files := et.ExtractMetadata(path)
-	if len(files) == 0 || files[0].Err != nil {
-		return false, files[0].Err
-	}
-	sw := files[0].Fields["Software"]
-	if swStr, ok := sw.(string); ok && strings.Contains(swStr, "PhotoSorter Compressed") {
-		return true, nil
-	}
-	return false, nil
-}
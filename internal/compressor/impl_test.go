@@ -0,0 +1,88 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestCancelledRunReportsEveryFile(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for i := 0; i < 12; i++ {
+		inputs = append(inputs, writeImage(t, filepath.Join(dir, fmt.Sprintf("IMG_%04d.jpg", i)), noisyImage(32, 32, int64(i))))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	params := testParams(dir)
+	params.TargetDir = filepath.Join(dir, "out")
+	params.Workers = 2
+	params.Progress = func(p CompressionProgress) {
+		if p.Done == 3 {
+			cancel()
+		}
+	}
+	results, err := NewDefaultCompressor().Compress(ctx, params)
+	if err != context.Canceled {
+		t.Fatalf("Compress = %v, want context.Canceled", err)
+	}
+
+	if len(results) != len(inputs) {
+		t.Errorf("got %d results for %d files", len(results), len(inputs))
+	}
+	cancelled := 0
+	for i, r := range results {
+		if r.InputPath == "" {
+			t.Errorf("result %d has no input path: %+v", i, r)
+		}
+		if r.Action == "cancelled" {
+			cancelled++
+		} else if !r.Success {
+			t.Errorf("%s: %s (%s)", r.InputPath, r.Action, r.Message)
+		}
+	}
+	if cancelled == 0 || cancelled > len(inputs)-3 {
+		t.Errorf("%d of %d files cancelled after 3 were done", cancelled, len(inputs))
+	}
+	if !sort.SliceIsSorted(results, func(i, j int) bool { return results[i].InputPath < results[j].InputPath }) {
+		t.Error("results are not ordered by input path")
+	}
+	for _, input := range inputs {
+		resultFor(t, results, input)
+	}
+}
+
+func TestUnreadableCacheIsLogged(t *testing.T) {
+	dir := t.TempDir()
+	input := writeImage(t, filepath.Join(dir, "IMG_0001.jpg"), noisyImage(32, 32, 1))
+	target := filepath.Join(dir, "out")
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, cacheName), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, hook := logtest.NewNullLogger()
+	params := testParams(input)
+	params.TargetDir = target
+	params.Logger = logger
+	if _, err := NewDefaultCompressor().Compress(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "unreadable compression cache") {
+			return
+		}
+	}
+	t.Errorf("logged %v, want a warning about the unreadable cache", hook.AllEntries())
+}
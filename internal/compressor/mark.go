@@ -0,0 +1,154 @@
+package compressor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Strategies for CompressionParams.MarkStrategy, which records compressed
+// files so that later runs skip them.
+const (
+	// MarkEXIF sets the EXIF Software tag of compressed JPEGs. Other formats
+	// are not marked.
+	MarkEXIF = "exif"
+	// MarkManifest lists compressed files with their SHA-256 hash in a
+	// manifest file in their directory.
+	MarkManifest = "manifest"
+	// MarkXattr sets an extended attribute holding the SHA-256 hash on
+	// compressed files, falling back to the manifest where the filesystem
+	// does not support extended attributes.
+	MarkXattr = "xattr"
+)
+
+const (
+	manifestName = ".photosorter-compressed"
+	xattrName    = "user.photosorter.compressed"
+)
+
+// manifestMu serializes the compression workers appending to manifests.
+var manifestMu sync.Mutex
+
+// recordCompressed records the file at path as compressed, unless strategy
+// marks files in their EXIF metadata.
+func recordCompressed(path, strategy string) error {
+	if strategy != MarkManifest && strategy != MarkXattr {
+		return nil
+	}
+	sum, err := fileHash(path)
+	if err != nil {
+		return err
+	}
+	if strategy == MarkXattr && setXattr(path, sum) == nil {
+		return nil
+	}
+	return appendManifest(path, sum)
+}
+
+// appendManifest adds the file at path with hash sum to the manifest of its
+// directory. The manifest has the format of sha256sum, so it can be checked
+// with "sha256sum -c".
+func appendManifest(path, sum string) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(filepath.Dir(path), manifestName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open manifest: %w", err)
+	}
+	_, err = fmt.Fprintf(f, "%s  %s\n", sum, filepath.Base(path))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// markChecker tells which files earlier runs compressed. It caches the
+// manifests it reads and is safe for concurrent use.
+type markChecker struct {
+	strategy  string
+	mu        sync.Mutex
+	manifests map[string]map[string]string // directory -> file name -> hash
+}
+
+// newMarkChecker returns a markChecker for files marked with strategy.
+func newMarkChecker(strategy string) *markChecker {
+	return &markChecker{strategy: strategy, manifests: make(map[string]map[string]string)}
+}
+
+// compressed reports whether the file at path was compressed before: JPEGs
+// with the EXIF marker, which any strategy recognizes, and files recorded by
+// the strategy whose contents have not changed since.
+func (c *markChecker) compressed(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if (ext == ".jpg" || ext == ".jpeg") && hasPhotoSorterSoftwareFlag(path) {
+		return true
+	}
+
+	var want string
+	switch c.strategy {
+	case MarkXattr:
+		if want, _ = getXattr(path); want == "" {
+			want = c.manifestHash(path)
+		}
+	case MarkManifest:
+		want = c.manifestHash(path)
+	}
+	if want == "" {
+		return false
+	}
+	sum, err := fileHash(path)
+	return err == nil && sum == want
+}
+
+// manifestHash returns the hash recorded for the file at path in the manifest
+// of its directory, or "".
+func (c *markChecker) manifestHash(path string) string {
+	dir := filepath.Dir(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hashes, ok := c.manifests[dir]
+	if !ok {
+		hashes = readManifest(filepath.Join(dir, manifestName))
+		c.manifests[dir] = hashes
+	}
+	return hashes[filepath.Base(path)]
+}
+
+// readManifest returns the hashes in the manifest at path by file name. Later
+// entries replace earlier ones for the same file.
+func readManifest(path string) map[string]string {
+	hashes := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return hashes
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if sum, name, ok := strings.Cut(line, "  "); ok && name != "" {
+			hashes[name] = sum
+		}
+	}
+	return hashes
+}
+
+// fileHash returns the hex-encoded SHA-256 hash of a file's contents.
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,91 @@
+package compressor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkedFilesAreSkippedOnTheNextRun(t *testing.T) {
+	for _, strategy := range []string{MarkManifest, MarkXattr} {
+		for _, convertTo := range []string{ConvertNone, FormatWebP} {
+			t.Run(strategy+"/"+convertTo, func(t *testing.T) {
+				if convertTo == FormatWebP {
+					if _, err := exec.LookPath("cwebp"); err != nil {
+						t.Skip("cwebp is not installed")
+					}
+				}
+				png := writeImage(t, filepath.Join(t.TempDir(), "IMG_0001.png"), noisyImage(64, 64, 1))
+				params := testParams(png)
+				params.InPlace = true
+				params.ConvertTo = convertTo
+				params.MarkStrategy = strategy
+
+				results, err := NewDefaultCompressor().Compress(context.Background(), params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := resultFor(t, results, png)
+				if !r.Success {
+					t.Fatalf("first run: %s (%s)", r.Action, r.Message)
+				}
+				output := r.OutputPath
+				before, err := os.ReadFile(output)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				params.InputPaths = []string{output}
+				params.DryRun = true
+				results, err = NewDefaultCompressor().Compress(context.Background(), params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r := resultFor(t, results, output); r.Action != "would_skip" {
+					t.Errorf("dry run after compressing: %s (%s), want would_skip", r.Action, r.Message)
+				}
+
+				params.DryRun = false
+				results, err = NewDefaultCompressor().Compress(context.Background(), params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, r := range results {
+					t.Errorf("second run compressed %s again: %s (%s)", r.InputPath, r.Action, r.Message)
+				}
+				if after, err := os.ReadFile(output); err != nil || string(after) != string(before) {
+					t.Errorf("second run changed %s", output)
+				}
+			})
+		}
+	}
+}
+
+func TestMarkedWebPIsNotCollectedAgain(t *testing.T) {
+	for _, strategy := range []string{MarkManifest, MarkXattr} {
+		t.Run(strategy, func(t *testing.T) {
+			// Written by cwebp and recorded, as compressOne does with convert_to webp.
+			dir := t.TempDir()
+			webp := filepath.Join(dir, "IMG_0001.webp")
+			if err := os.WriteFile(webp, []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := recordCompressed(webp, strategy); err != nil {
+				t.Fatal(err)
+			}
+
+			params := testParams(dir)
+			params.ConvertTo = FormatWebP
+			params.MarkStrategy = strategy
+			files, marked, err := imagesToCompress(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 0 || len(marked) != 1 || marked[0] != webp {
+				t.Errorf("got %v to compress and %v marked, want only %s marked", files, marked, webp)
+			}
+		})
+	}
+}
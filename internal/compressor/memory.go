@@ -0,0 +1,119 @@
+package compressor
+
+import (
+	"bufio"
+	"image"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// bytesPerPixel approximates the memory compressing an image takes per pixel:
+// the decoded image and the NRGBA copy made to orient and encode it.
+const bytesPerPixel = 8
+
+// typicalImageMemory is the memory assumed for an image whose dimensions
+// cannot be read, and for sizing the default worker count: a 24MP photo.
+const typicalImageMemory = 24_000_000 * bytesPerPixel
+
+// limits returns the number of image workers and the memory budget in bytes
+// (0 = unlimited) for p. Unset, the budget is half of the available memory and
+// the workers are NumCPU, fewer if typical photos would not fit the budget.
+func (p CompressionParams) limits() (int, int64) {
+	maxMemory := p.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = availableMemory() / 2
+	}
+	workers := p.Workers
+	if workers <= 0 {
+		workers = max(runtime.NumCPU(), 2)
+		if maxMemory > 0 {
+			workers = min(workers, max(int(maxMemory/typicalImageMemory), 1))
+		}
+	}
+	return workers, maxMemory
+}
+
+// availableMemory returns the memory available for new allocations, from
+// MemAvailable in /proc/meminfo, or 0 where it is unknown.
+func availableMemory() int64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// decodedSize estimates the memory compressing the image at path takes, from
+// the dimensions in its header.
+func decodedSize(path string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return typicalImageMemory
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return typicalImageMemory
+	}
+	return int64(cfg.Width) * int64(cfg.Height) * bytesPerPixel
+}
+
+// memoryBudget is a weighted semaphore limiting the memory held by the image
+// workers.
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64 // 0 = unlimited
+	used  int64
+}
+
+// newMemoryBudget returns a budget of limit bytes, or an unlimited one if
+// limit is 0.
+func newMemoryBudget(limit int64) *memoryBudget {
+	b := &memoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire waits until n bytes fit the budget and takes them. It returns the
+// bytes taken, to be given back with release. An image larger than the whole
+// budget takes all of it, so it is compressed alone instead of never.
+func (b *memoryBudget) acquire(n int64) int64 {
+	if b.limit <= 0 {
+		return 0
+	}
+	n = min(n, b.limit)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+	return n
+}
+
+// release gives back n bytes taken by acquire.
+func (b *memoryBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
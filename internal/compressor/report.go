@@ -0,0 +1,16 @@
+package compressor
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// WriteReport writes results to w as a JSON array.
+func WriteReport(w io.Writer, results []CompressionResult) error {
+	if results == nil {
+		results = []CompressionResult{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
@@ -0,0 +1,228 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// Metadata stripping levels for CompressionParams.StripMetadata.
+const (
+	StripNone            = "none"
+	StripGPS             = "gps"
+	StripAllButEssential = "all-but-essential"
+)
+
+// EXIF tags that point to sub-IFDs.
+const (
+	tagExifIFD = 0x8769
+	tagGPSIFD  = 0x8825
+)
+
+// essentialIFD0Tags and essentialExifTags are the tags kept by
+// StripAllButEssential: the camera, the dates and the orientation.
+var (
+	essentialIFD0Tags = map[uint16]bool{
+		0x010F: true, // Make
+		0x0110: true, // Model
+		0x0112: true, // Orientation
+		0x0132: true, // DateTime
+	}
+	essentialExifTags = map[uint16]bool{
+		0x9003: true, // DateTimeOriginal
+		0x9004: true, // DateTimeDigitized
+		0x9010: true, // OffsetTime
+		0x9011: true, // OffsetTimeOriginal
+		0x9012: true, // OffsetTimeDigitized
+		0x9290: true, // SubSecTime
+		0x9291: true, // SubSecTimeOriginal
+		0x9292: true, // SubSecTimeDigitized
+	}
+)
+
+// tiffTypeSizes holds the size in bytes of a value of each TIFF field type.
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// tiffEntry is a field of an IFD.
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte // in the byte order of the TIFF data
+	offset   int    // of value in the TIFF data, or -1 if stored in the entry
+}
+
+// tiffOrder is the byte order of TIFF data.
+type tiffOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// byteOrder returns the byte order of TIFF data.
+func byteOrder(tiff []byte) (tiffOrder, error) {
+	if len(tiff) < 8 {
+		return nil, errInvalidExif
+	}
+	switch string(tiff[:2]) {
+	case "II":
+		return binary.LittleEndian, nil
+	case "MM":
+		return binary.BigEndian, nil
+	}
+	return nil, errInvalidExif
+}
+
+// readIFD returns the entries of the IFD at offset.
+func readIFD(tiff []byte, order tiffOrder, offset int) ([]tiffEntry, error) {
+	if offset < 8 || offset+2 > len(tiff) {
+		return nil, errInvalidExif
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	if offset+2+count*12+4 > len(tiff) {
+		return nil, errInvalidExif
+	}
+	entries := make([]tiffEntry, 0, count)
+	for i := offset + 2; i < offset+2+count*12; i += 12 {
+		e := tiffEntry{
+			tag:    order.Uint16(tiff[i:]),
+			typ:    order.Uint16(tiff[i+2:]),
+			count:  order.Uint32(tiff[i+4:]),
+			offset: -1,
+		}
+		size := int64(tiffTypeSizes[e.typ]) * int64(e.count)
+		switch {
+		case size <= 4:
+			e.value = tiff[i+8 : i+8+int(size)]
+		default:
+			start := int64(order.Uint32(tiff[i+8:]))
+			if start+size > int64(len(tiff)) {
+				return nil, errInvalidExif
+			}
+			e.offset = int(start)
+			e.value = tiff[start : start+size]
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// stripExif removes metadata from TIFF data according to level. For StripGPS
+// the GPS IFD and its values are zeroed in place, keeping all other offsets
+// valid; for StripAllButEssential new TIFF data is built from the essential
+// tags. It reports whether anything was removed.
+func stripExif(tiff []byte, level string) ([]byte, bool, error) {
+	if len(tiff) == 0 || (level != StripGPS && level != StripAllButEssential) {
+		return tiff, false, nil
+	}
+	order, err := byteOrder(tiff)
+	if err != nil {
+		return nil, false, err
+	}
+	ifd0 := int(order.Uint32(tiff[4:]))
+	entries, err := readIFD(tiff, order, ifd0)
+	if err != nil {
+		return nil, false, err
+	}
+	if level == StripAllButEssential {
+		return essentialExif(tiff, order, entries), true, nil
+	}
+
+	gps := -1
+	for i, e := range entries {
+		if e.tag == tagGPSIFD && len(e.value) == 4 {
+			gps = i
+		}
+	}
+	if gps < 0 {
+		return tiff, false, nil
+	}
+
+	// Zero the GPS values and IFD, then write IFD0 again without the pointer.
+	out := append([]byte(nil), tiff...)
+	gpsIFD := int(order.Uint32(entries[gps].value))
+	if gpsEntries, err := readIFD(out, order, gpsIFD); err == nil {
+		for _, e := range gpsEntries {
+			if e.offset >= 0 {
+				clear(out[e.offset : e.offset+len(e.value)])
+			}
+		}
+		clear(out[gpsIFD : gpsIFD+2+len(gpsEntries)*12+4])
+	}
+	end := ifd0 + 2 + len(entries)*12
+	ifd := order.AppendUint16(nil, uint16(len(entries)-1))
+	for i := range entries {
+		if i != gps {
+			ifd = append(ifd, tiff[ifd0+2+i*12:ifd0+14+i*12]...)
+		}
+	}
+	ifd = append(ifd, tiff[end:end+4]...) // offset of IFD1
+	clear(out[ifd0 : end+4])
+	copy(out[ifd0:], ifd)
+	return out, true, nil
+}
+
+// essentialExif builds TIFF data holding only the essential tags of IFD0 and
+// the EXIF IFD.
+func essentialExif(tiff []byte, order tiffOrder, ifd0 []tiffEntry) []byte {
+	var keep, exif []tiffEntry
+	for _, e := range ifd0 {
+		if essentialIFD0Tags[e.tag] {
+			keep = append(keep, e)
+		}
+		if e.tag == tagExifIFD && len(e.value) == 4 {
+			if entries, err := readIFD(tiff, order, int(order.Uint32(e.value))); err == nil {
+				for _, x := range entries {
+					if essentialExifTags[x.tag] {
+						exif = append(exif, x)
+					}
+				}
+			}
+		}
+	}
+
+	out := append([]byte(nil), tiff[:4]...) // byte order and magic number
+	out = order.AppendUint32(out, 8)
+	if len(exif) > 0 {
+		pointer := tiffEntry{tag: tagExifIFD, typ: 4, count: 1, value: make([]byte, 4)}
+		keep = append(keep, pointer)
+	}
+	exifOffset, out := writeIFD(out, order, keep)
+	if len(exif) > 0 {
+		order.PutUint32(out[exifOffset:], uint32(len(out)))
+		_, out = writeIFD(out, order, exif)
+	}
+	return out
+}
+
+// writeIFD appends an IFD with entries and their values to out, with no next
+// IFD. It returns the offset of the value of the last entry with tag
+// tagExifIFD, so that the caller can fill in the pointer, or 0.
+func writeIFD(out []byte, order tiffOrder, entries []tiffEntry) (int, []byte) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	start := len(out)
+	data := start + 2 + len(entries)*12 + 4
+	var values bytes.Buffer
+	var pointer int
+
+	out = order.AppendUint16(out, uint16(len(entries)))
+	for _, e := range entries {
+		out = order.AppendUint16(out, e.tag)
+		out = order.AppendUint16(out, e.typ)
+		out = order.AppendUint32(out, e.count)
+		if e.tag == tagExifIFD {
+			pointer = len(out)
+		}
+		if len(e.value) <= 4 {
+			field := make([]byte, 4)
+			copy(field, e.value)
+			out = append(out, field...)
+			continue
+		}
+		out = order.AppendUint32(out, uint32(data+values.Len()))
+		values.Write(e.value)
+		if values.Len()%2 == 1 { // offsets must be even
+			values.WriteByte(0)
+		}
+	}
+	out = order.AppendUint32(out, 0)
+	return pointer, append(out, values.Bytes()...)
+}
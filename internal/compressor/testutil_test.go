@@ -0,0 +1,134 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// noisyImage returns an opaque w×h image of random pixels, which JPEG
+// compresses far better than PNG.
+func noisyImage(w, h int, seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(rng.Intn(256)), G: uint8(rng.Intn(256)), B: uint8(rng.Intn(256)), A: 255})
+		}
+	}
+	return img
+}
+
+// writeImage encodes img at path in the format its extension stands for,
+// creating its directory, and returns path.
+func writeImage(t testing.TB, path string, img image.Image) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := imaging.Save(img, path, imaging.JPEGQuality(100)); err != nil {
+		t.Fatalf("save %s: %v", path, err)
+	}
+	return path
+}
+
+// photoExif returns big-endian TIFF data with the Orientation tag, an EXIF
+// IFD holding DateTimeOriginal set to date and, if gps is set, a GPS IFD
+// holding a latitude.
+func photoExif(orientation int, date string, gps bool) []byte {
+	order := binary.BigEndian
+	out := []byte{'M', 'M', 0, 42, 0, 0, 0, 0} // IFD0 offset filled in below
+	ifd0 := []tiffEntry{{tag: tagOrientation, typ: 3, count: 1, value: order.AppendUint16(nil, uint16(orientation))}}
+
+	pointer := func(tag uint16, offset int) tiffEntry {
+		return tiffEntry{tag: tag, typ: 4, count: 1, value: order.AppendUint32(nil, uint32(offset))}
+	}
+	ifd0 = append(ifd0, pointer(tagExifIFD, len(out)))
+	_, out = writeIFD(out, order, []tiffEntry{
+		{tag: 0x9003, typ: 2, count: uint32(len(date) + 1), value: append([]byte(date), 0)}, // DateTimeOriginal
+	})
+	if gps {
+		var latitude []byte // 52° 31' 12", as three rationals
+		for _, v := range []uint32{52, 1, 31, 1, 12, 1} {
+			latitude = order.AppendUint32(latitude, v)
+		}
+		ifd0 = append(ifd0, pointer(tagGPSIFD, len(out)))
+		_, out = writeIFD(out, order, []tiffEntry{
+			{tag: 0x0001, typ: 2, count: 2, value: []byte("N\x00")}, // GPSLatitudeRef
+			{tag: 0x0002, typ: 5, count: 3, value: latitude},        // GPSLatitude
+		})
+	}
+	order.PutUint32(out[4:], uint32(len(out)))
+	_, out = writeIFD(out, order, ifd0)
+	return out
+}
+
+// writeJPEGWithExif encodes img as a JPEG with the EXIF TIFF data tiff at
+// path, creating its directory, and returns path.
+func writeJPEGWithExif(t testing.TB, path string, img image.Image, tiff []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(100)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := spliceExif(buf.Bytes(), tiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readExif returns the EXIF metadata of the JPEG at path.
+func readExif(t testing.TB, path string) *exif.Exif {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	x, err := exif.Decode(f)
+	if err != nil {
+		t.Fatalf("read EXIF of %s: %v", path, err)
+	}
+	return x
+}
+
+// testParams returns the parameters of a run compressing inputs with the
+// default settings, one image at a time.
+func testParams(inputs ...string) CompressionParams {
+	return CompressionParams{
+		InputPaths:   inputs,
+		Quality:      85,
+		Threshold:    1.01,
+		Formats:      []string{".jpg", ".jpeg", ".png", ".webp"},
+		ConvertTo:    ConvertNone,
+		MarkStrategy: MarkEXIF,
+		Workers:      1,
+	}
+}
+
+// resultFor returns the result for input among results.
+func resultFor(t testing.TB, results []CompressionResult, input string) CompressionResult {
+	t.Helper()
+	for _, r := range results {
+		if r.InputPath == input {
+			return r
+		}
+	}
+	t.Fatalf("no result for %s in %d results", input, len(results))
+	return CompressionResult{}
+}
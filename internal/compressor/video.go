@@ -0,0 +1,202 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for unset VideoParams fields.
+const (
+	defaultVideoCRF    = 23
+	defaultVideoPreset = "medium"
+)
+
+// videosToCompress returns the videos in the input paths and the path of
+// ffmpeg. Without ffmpeg, videos are left alone with a single warning.
+func videosToCompress(params CompressionParams) ([]string, string, error) {
+	if len(params.Video.Formats) == 0 {
+		return nil, "", nil
+	}
+	files, err := collectImageFiles(params.InputPaths, params.Video.Formats)
+	if err != nil {
+		return nil, "", fmt.Errorf("collect videos: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, "", nil
+	}
+
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		params.warnf("ffmpeg not found, skipping compression of %d videos", len(files))
+		return nil, "", nil
+	}
+	return files, ffmpeg, nil
+}
+
+// compressVideos re-encodes files with ffmpeg. ffmpeg uses all cores for a
+// single encode, so videos are encoded one at a time. Cancelling ctx stops
+// the running encode, and the remaining videos get "cancelled" results.
+func compressVideos(ctx context.Context, ffmpeg string, files []string, params CompressionParams, progress *progressTracker) []CompressionResult {
+	var results []CompressionResult
+	for _, path := range files {
+		if ctx.Err() != nil {
+			results = append(results, cancelledResult(path))
+			continue
+		}
+		r := compressVideo(ctx, ffmpeg, path, params)
+		progress.done(r)
+		results = append(results, r)
+	}
+	return results
+}
+
+// compressVideo re-encodes a single video and returns a CompressionResult. As
+// with images, the original is kept if the encode is not smaller by the
+// threshold.
+func compressVideo(ctx context.Context, ffmpeg, inputPath string, params CompressionParams) CompressionResult {
+	res := CompressionResult{
+		InputPath: inputPath,
+		StartedAt: time.Now(),
+	}
+	fail := func(message string, err error) CompressionResult {
+		res.Action = "error"
+		res.Message = fmt.Sprintf("%s: %v", message, err)
+		res.Error = err
+		res.FinishedAt = time.Now()
+		fmt.Printf("Compression error for %s: %s\n", inputPath, res.Message)
+		return res
+	}
+
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return fail("stat error", err)
+	}
+	res.OriginalSize = info.Size()
+
+	outPath := params.outputPath(inputPath)
+	if params.DryRun {
+		// Measuring the result would take a full encode.
+		res.OutputPath = outPath
+		res.Action = "would_compress"
+		res.Message = "Dry run: video would be re-encoded; savings not estimated"
+		res.Success = true
+		res.FinishedAt = time.Now()
+		return res
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fail("mkdir error", err)
+	}
+	res.OutputPath = outPath
+
+	// ffmpeg picks the container by extension, so the temporary file keeps it.
+	ext := filepath.Ext(outPath)
+	tmpPath := strings.TrimSuffix(outPath, ext) + ".tmp" + ext
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg, ffmpegArgs(inputPath, tmpPath, params.Video, params.StripMetadata)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		_ = os.Remove(tmpPath)
+		if ctx.Err() != nil {
+			res.Action = "cancelled"
+			res.Message = "Stopped before the encode finished"
+			res.FinishedAt = time.Now()
+			return res
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, lastLine(msg))
+		}
+		return fail("ffmpeg error", err)
+	}
+
+	compInfo, err := os.Stat(tmpPath)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fail("stat compressed error", err)
+	}
+	res.CompressedSize = compInfo.Size()
+
+	_, threshold := params.forExt(filepath.Ext(inputPath))
+	res.Threshold = threshold
+	// The original still has the location, so it is not kept when stripping.
+	if float64(res.CompressedSize) >= float64(res.OriginalSize)*threshold && !stripsMetadata(params.StripMetadata) {
+		_ = os.Remove(tmpPath)
+		if !params.InPlace {
+			if err := copyFile(inputPath, outPath); err != nil {
+				return fail("copy original error", err)
+			}
+		}
+		res.Action = "original"
+		res.Message = "Re-encoded video not smaller than original, saved original"
+	} else {
+		if err := os.Rename(tmpPath, outPath); err != nil {
+			return fail("rename error", err)
+		}
+		res.Action = "compressed"
+		res.Message = "Video re-encoded"
+		if stripsMetadata(params.StripMetadata) {
+			res.Message += "; location removed"
+		}
+		res.PercentageSaved = float64(res.OriginalSize-res.CompressedSize) * 100 / float64(res.OriginalSize)
+	}
+	res.Success = true
+	res.FinishedAt = time.Now()
+	return res
+}
+
+// ffmpegArgs returns the ffmpeg arguments for re-encoding input to output.
+// Container metadata such as creation_time is copied with -map_metadata,
+// except for the location if strip removes it, and audio is copied unchanged.
+func ffmpegArgs(input, output string, video VideoParams, strip string) []string {
+	encoder := "libx264"
+	if video.Codec == VideoCodecH265 {
+		encoder = "libx265"
+	}
+	crf := video.CRF
+	if crf <= 0 {
+		crf = defaultVideoCRF
+	}
+	preset := video.Preset
+	if preset == "" {
+		preset = defaultVideoPreset
+	}
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", input,
+		"-map_metadata", "0",
+		"-c:v", encoder, "-crf", strconv.Itoa(crf), "-preset", preset,
+	}
+	if video.MaxResolution > 0 {
+		// Limit the shorter side, so portrait videos are treated like landscape ones.
+		r := strconv.Itoa(video.MaxResolution)
+		args = append(args, "-vf", fmt.Sprintf(
+			"scale='if(gt(iw,ih),-2,min(iw,%[1]s))':'if(gt(iw,ih),min(ih,%[1]s),-2)'", r))
+	}
+	if stripsMetadata(strip) {
+		// Clearing a key removes it; these hold the recording location.
+		args = append(args, "-metadata", "location=", "-metadata", "location-eng=",
+			"-metadata", "com.apple.quicktime.location.ISO6709=")
+	}
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".mp4", ".mov", ".m4v":
+		if video.Codec == VideoCodecH265 {
+			args = append(args, "-tag:v", "hvc1") // so that Apple players recognize HEVC
+		}
+	}
+	return append(args, "-c:a", "copy", output)
+}
+
+// lastLine returns the last line of s.
+func lastLine(s string) string {
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package compressor
+
+import "errors"
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// setXattr fails, so that MarkXattr falls back to the manifest.
+func setXattr(path, value string) error {
+	return errXattrUnsupported
+}
+
+// getXattr fails, so that MarkXattr falls back to the manifest.
+func getXattr(path string) (string, error) {
+	return "", errXattrUnsupported
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin
+
+package compressor
+
+import "golang.org/x/sys/unix"
+
+// setXattr stores value in the compression extended attribute of the file at
+// path.
+func setXattr(path, value string) error {
+	return unix.Setxattr(path, xattrName, []byte(value), 0)
+}
+
+// getXattr returns the compression extended attribute of the file at path.
+func getXattr(path string) (string, error) {
+	buf := make([]byte, 128)
+	n, err := unix.Getxattr(path, xattrName, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
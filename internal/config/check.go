@@ -0,0 +1,52 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Check loads the config file at path, or the one LoadConfig would use if
+// path is empty, with the profile laid over it unless profile is empty, and
+// returns the file and every problem with it. Settings that are not known,
+// and so ignored, are returned as warnings.
+func Check(path, profile string) (file string, problems, warnings []error) {
+	cfg, err := load(path, profile)
+	if err != nil {
+		return path, []error{err}, nil
+	}
+	if cfg.File() == "" {
+		problems = append(problems, fmt.Errorf("no config file found in ., $HOME/.photo-sorter or /etc/photo-sorter"))
+	}
+	return cfg.FilePath(), append(problems, cfg.Problems()...), unknownSettings(cfg.settings)
+}
+
+// unknownSettings returns a warning for each setting read into settings
+// that no field of Config reads.
+func unknownSettings(settings *viper.Viper) []error {
+	err := settings.Unmarshal(DefaultConfig(), viper.DecodeHook(decodeHooks()), func(dc *mapstructure.DecoderConfig) {
+		dc.ErrorUnused = true
+	})
+	var decodeErr *mapstructure.Error
+	if !errors.As(err, &decodeErr) {
+		return nil
+	}
+	var warnings []error
+	for _, message := range decodeErr.Errors {
+		section, keys, ok := strings.Cut(message, " has invalid keys: ")
+		if !ok {
+			continue // reported by Problems
+		}
+		section = strings.Trim(section, "'")
+		if section != "" {
+			section += "."
+		}
+		for _, key := range strings.Split(keys, ", ") {
+			warnings = append(warnings, fmt.Errorf("unknown setting %s%s is ignored", section, key))
+		}
+	}
+	return warnings
+}
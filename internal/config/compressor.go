@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// CompressorFormat holds the compression settings of one image extension.
+// Zero Quality and Threshold use the compressor's flat settings.
+type CompressorFormat struct {
+	Quality   int     `mapstructure:"quality"`
+	Threshold float64 `mapstructure:"threshold"`
+	Skip      bool    `mapstructure:"skip"` // leave files with this extension alone
+}
+
+// CompressorFormats maps image extensions to their compression settings. In
+// the config file it is either a list of extensions, which use the flat
+// settings, or a map from extension to settings.
+type CompressorFormats map[string]CompressorFormat
+
+// Extensions returns the extensions that are compressed, sorted.
+func (f CompressorFormats) Extensions() []string {
+	var extensions []string
+	for ext, format := range f {
+		if !format.Skip {
+			extensions = append(extensions, ext)
+		}
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+// compressorFormatsHook decodes compressor.formats given as a list or a
+// comma-separated string of extensions. Map keys such as ".jpg" are split at
+// the dot by viper, leaving them under an empty key, so they are joined again.
+func compressorFormatsHook(from, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeOf(CompressorFormats{}) {
+		return data, nil
+	}
+	switch v := data.(type) {
+	case string:
+		formats := make(map[string]any)
+		for _, ext := range strings.Split(v, ",") {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				formats[ext] = map[string]any{}
+			}
+		}
+		return formats, nil
+	case []any:
+		formats := make(map[string]any, len(v))
+		for _, ext := range v {
+			formats[fmt.Sprint(ext)] = map[string]any{}
+		}
+		return formats, nil
+	case map[string]any:
+		dotted, ok := v[""].(map[string]any)
+		if !ok {
+			return v, nil
+		}
+		formats := make(map[string]any, len(v)+len(dotted))
+		for ext, format := range v {
+			if ext != "" {
+				formats[ext] = format
+			}
+		}
+		for ext, format := range dotted {
+			formats["."+ext] = format
+		}
+		return formats, nil
+	}
+	return data, nil
+}
+
+// validate normalizes the compressor extensions and checks the quality,
+// threshold, strip_metadata, mark_strategy and resource settings.
+func (c *CompressorConfig) validate() error {
+	if c.Quality < 1 || c.Quality > 100 {
+		return fmt.Errorf("compressor quality must be between 1 and 100, got %d", c.Quality)
+	}
+	if c.Threshold < 0 {
+		return fmt.Errorf("compressor threshold must not be negative")
+	}
+
+	c.StripMetadata = strings.ToLower(c.StripMetadata)
+	switch c.StripMetadata {
+	case "":
+		c.StripMetadata = "none"
+	case "none", "gps", "all-but-essential":
+	default:
+		return fmt.Errorf("invalid compressor strip_metadata: %s (valid: none, gps, all-but-essential)", c.StripMetadata)
+	}
+
+	c.MarkStrategy = strings.ToLower(c.MarkStrategy)
+	switch c.MarkStrategy {
+	case "":
+		c.MarkStrategy = "exif"
+	case "exif", "manifest", "xattr":
+	default:
+		return fmt.Errorf("invalid compressor mark_strategy: %s (valid: exif, manifest, xattr)", c.MarkStrategy)
+	}
+
+	if c.Workers < 0 {
+		return fmt.Errorf("compressor workers must not be negative (use 0 for automatic)")
+	}
+	if _, err := ParseSize(c.MaxMemory); err != nil {
+		return fmt.Errorf("invalid compressor max_memory: %w", err)
+	}
+	if _, err := ParseSize(c.MinSize); err != nil {
+		return fmt.Errorf("invalid compressor min_size: %w", err)
+	}
+
+	formats := make(CompressorFormats, len(c.Formats))
+	for ext, format := range c.Formats {
+		if format.Quality != 0 && (format.Quality < 1 || format.Quality > 100) {
+			return fmt.Errorf("compressor quality for %s must be between 1 and 100, got %d", ext, format.Quality)
+		}
+		if format.Threshold < 0 {
+			return fmt.Errorf("compressor threshold for %s must not be negative", ext)
+		}
+		formats[normalizeExtensions([]string{ext})[0]] = format
+	}
+	c.Formats = formats
+	return nil
+}
+
+// decodeHooks returns the hooks viper uses to decode the config: its default
+// ones, compressorFormatsHook and duplicatePolicyHook.
+func decodeHooks() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		compressorFormatsHook,
+		duplicatePolicyHook,
+	)
+}
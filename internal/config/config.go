@@ -1,56 +1,276 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 
+	"photo-sorter-go/internal/naming"
+	"photo-sorter-go/internal/schedule"
+
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// DateFormatOption defines a predefined date format option.
+// DateFormatOption defines a predefined date format option. Format is a Go
+// time layout when one can express the option, and its template otherwise;
+// Template is the option in the syntax of date tokens.
 type DateFormatOption struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Format      string `json:"format"`
+	Template    string `json:"template"`
 	Example     string `json:"example"`
 	Description string `json:"description"`
 }
 
 // CompressorConfig holds image compression settings.
 type CompressorConfig struct {
-	Enabled   bool     `mapstructure:"enabled"`
-	Quality   int      `mapstructure:"quality"`
-	Threshold float64  `mapstructure:"threshold"`
-	Formats   []string `mapstructure:"formats"`
+	Enabled   bool              `mapstructure:"enabled"`
+	Quality   int               `mapstructure:"quality"`
+	Threshold float64           `mapstructure:"threshold"`
+	Formats   CompressorFormats `mapstructure:"formats"`    // per-extension overrides of quality and threshold
+	ConvertTo string            `mapstructure:"convert_to"` // none, jpeg or webp
+	// UseExiftool falls back to exiftool for metadata that cannot be copied in Go.
+	UseExiftool bool `mapstructure:"use_exiftool"`
+	// StripMetadata removes metadata from compressed files: none, gps or all-but-essential.
+	StripMetadata string `mapstructure:"strip_metadata"`
+	// MarkStrategy records compressed files so later runs skip them: exif, manifest or xattr.
+	MarkStrategy string `mapstructure:"mark_strategy"`
+	// Workers is the number of images compressed at once (0 = derived from
+	// the CPUs and memory). MaxMemory caps the memory of the decoded images
+	// in bytes or human-readable form ("2GB"; "" = half of the available memory).
+	Workers   int    `mapstructure:"workers"`
+	MaxMemory string `mapstructure:"max_memory"`
+	// RunDuringOrganize compresses images in place as they are organized, if
+	// they are at least MinSize (bytes or human-readable form, "2MB").
+	RunDuringOrganize bool   `mapstructure:"run_during_organize"`
+	MinSize           string `mapstructure:"min_size"`
 	// OutputDir string   `mapstructure:"output_dir"` // Deprecated
+
+	Video VideoCompressionConfig `mapstructure:"video"`
+}
+
+// VideoCompressionConfig holds video re-encoding settings. Videos are only
+// re-encoded if formats lists their extensions and ffmpeg is installed.
+type VideoCompressionConfig struct {
+	Formats       []string `mapstructure:"formats"`
+	Codec         string   `mapstructure:"codec"` // h264 or h265
+	CRF           int      `mapstructure:"crf"`
+	Preset        string   `mapstructure:"preset"`
+	MaxResolution int      `mapstructure:"max_resolution"` // shorter side in pixels, 0 keeps it
 }
 
 // Config is the main configuration structure.
 type Config struct {
 	SourceDirectory     string            `mapstructure:"source_directory" validate:"required"`
+	SourceDirectories   []string          `mapstructure:"source_directories"` // organized in the same run as SourceDirectory
 	TargetDirectory     *string           `mapstructure:"target_directory"`
 	DateFormat          string            `mapstructure:"date_format"`
+	AllowDateCollisions bool              `mapstructure:"allow_date_collisions"` // date formats such as "01" that merge years
 	SupportedExtensions []string          `mapstructure:"supported_extensions"`
 	Processing          ProcessingConfig  `mapstructure:"processing"`
 	Video               VideoConfig       `mapstructure:"video"`
 	Performance         PerformanceConfig `mapstructure:"performance"`
 	Security            SecurityConfig    `mapstructure:"security"`
+	Watch               WatchConfig       `mapstructure:"watch"`
+	Web                 WebConfig         `mapstructure:"web"`
 	Logging             LoggingConfig     `mapstructure:"logging"`
+	History             HistoryConfig     `mapstructure:"history"`
 	Compressor          CompressorConfig  `mapstructure:"compressor"`
+	Schedules           []Schedule        `mapstructure:"schedules"` // jobs serve runs by itself
+
+	// Sources are more source directories organized in the same run, each
+	// with settings of its own.
+	Sources []SourceConfig `mapstructure:"sources"`
+
+	// Profiles are named sets of settings laid over the others when selected
+	// with --profile, e.g. a different target directory and mode. Profile is
+	// the name of the profile applied, if any.
+	Profiles map[string]map[string]any `mapstructure:"profiles" save:"keep"`
+	Profile  string                    `mapstructure:"-"`
+
+	file     string            // the config file read by LoadProfile, if any
+	settings *viper.Viper      // what LoadProfile read, for Origins
+	origins  map[string]string // dotted path -> origin, see SetOrigin
+}
+
+// ScheduleJobs are the job types a schedule can run.
+var ScheduleJobs = []string{"organize", "scan", "compress"}
+
+// Schedule runs a job at set times while serve is running.
+type Schedule struct {
+	Name string `mapstructure:"name" json:"name"`
+
+	// At is a daily time ("03:00"), a cron expression of five fields
+	// ("0 3 * * 1-5") or @hourly, @daily, @weekly or @monthly, in local time.
+	At string `mapstructure:"at" json:"at"`
+
+	Job string `mapstructure:"job" json:"job"` // one of ScheduleJobs
+
+	// The directories default to source_directory and target_directory.
+	SourceDirectory string `mapstructure:"source_directory" json:"source_directory,omitempty"`
+	TargetDirectory string `mapstructure:"target_directory" json:"target_directory,omitempty"`
+	DryRun          bool   `mapstructure:"dry_run" json:"dry_run"`
+	Disabled        bool   `mapstructure:"disabled" json:"disabled"`
+}
+
+// Validate checks that the schedule has a name, a valid time and a known job.
+func (s Schedule) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("schedule without a name")
+	}
+	if _, err := schedule.Parse(s.At); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	if !slices.Contains(ScheduleJobs, s.Job) {
+		return fmt.Errorf("schedule %s: invalid job %q (valid: %s)", s.Name, s.Job, strings.Join(ScheduleJobs, ", "))
+	}
+	return nil
 }
 
 // ProcessingConfig holds file processing settings.
 type ProcessingConfig struct {
-	MoveFiles         bool   `mapstructure:"move_files"`
-	DuplicateHandling string `mapstructure:"duplicate_handling"`
-	SkipOrganized     bool   `mapstructure:"skip_organized"`
-	CreateBackups     bool   `mapstructure:"create_backups"`
+	MoveFiles         bool            `mapstructure:"move_files"`
+	DuplicateHandling DuplicatePolicy `mapstructure:"duplicate_handling"`
+	SkipOrganized     bool            `mapstructure:"skip_organized"`
+	CreateBackups     bool            `mapstructure:"create_backups"`
+
+	// SettleTime skips files whose size or modification time changed within
+	// this window, as they may still be being written (0 disables the check).
+	// StrictInUseCheck also skips files another process has open for writing
+	// (Linux only).
+	SettleTime       time.Duration `mapstructure:"settle_time"`
+	StrictInUseCheck bool          `mapstructure:"strict_in_use_check"`
+
+	// VerifyIdenticalSkips compares duplicates skipped by duplicate_handling
+	// "skip" with the existing file and records whether they are identical.
+	VerifyIdenticalSkips bool `mapstructure:"verify_identical_skips"`
+
+	// IgnoreHidden skips dotfiles and dot-directories and known system junk
+	// (AppleDouble "._" files, .DS_Store, Thumbs.db, desktop.ini) during
+	// discovery.
+	IgnoreHidden bool `mapstructure:"ignore_hidden"`
+
+	// FollowSymlinks descends into symlinked directories during discovery and
+	// organizes symlinked files by their targets' contents.
+	FollowSymlinks bool `mapstructure:"follow_symlinks"`
+
+	// MinFileSize is the smallest file to organize, in bytes or human-readable form ("50KB").
+	MinFileSize string        `mapstructure:"min_file_size"`
+	MinAge      time.Duration `mapstructure:"min_age"`
+	MaxAge      time.Duration `mapstructure:"max_age"`
+
+	// ExcludePatterns are glob patterns of files and directories to leave
+	// alone. Patterns without a slash match names at any depth ("*.tmp",
+	// "Screenshots"); others match paths relative to the source directory
+	// ("2019/raw/*").
+	ExcludePatterns []string `mapstructure:"exclude_patterns"`
+
+	// FilenameTemplate renames organized files, e.g. "{date}_{time}_{original}.{ext}".
+	// Empty keeps the original file names.
+	FilenameTemplate string `mapstructure:"filename_template"`
+
+	// GroupByCamera adds a camera folder level below the date folders.
+	// A {camera} token in DateFormat places the camera folder explicitly instead.
+	GroupByCamera       bool   `mapstructure:"group_by_camera"`
+	UnknownCameraFolder string `mapstructure:"unknown_camera_folder"`
+
+	// PreserveSourceSubdir keeps the source folder a file came from below the
+	// date folders: "none", "last" (its name, e.g. an event like "Rome Trip")
+	// or "relative" (its whole path relative to the source directory).
+	PreserveSourceSubdir string `mapstructure:"preserve_source_subdir"`
+
+	// PairRawJPEG keeps RAW files together with the same-named JPEG, using the JPEG's date.
+	PairRawJPEG bool `mapstructure:"pair_raw_jpeg"`
+
+	// PairLivePhotos keeps Live Photo videos (.mov) with the same-named still image.
+	// Files whose modification times differ by more than LivePhotoMaxDelta are not paired.
+	PairLivePhotos    bool          `mapstructure:"pair_live_photos"`
+	LivePhotoMaxDelta time.Duration `mapstructure:"live_photo_max_delta"`
+
+	// SidecarExtensions lists metadata files that follow their same-named media file.
+	SidecarExtensions []string `mapstructure:"sidecar_extensions"`
+	// CollectOrphanedSidecars moves sidecars without a media file into OrphanedSidecarsFolder
+	// (relative to the target directory).
+	CollectOrphanedSidecars bool   `mapstructure:"collect_orphaned_sidecars"`
+	OrphanedSidecarsFolder  string `mapstructure:"orphaned_sidecars_folder"`
+
+	// PreserveTimestamps keeps the source access and modification times on copies.
+	PreserveTimestamps bool `mapstructure:"preserve_timestamps"`
+	// PreserveOwnership keeps the source owner and group on copies (Unix, usually requires root).
+	PreserveOwnership bool `mapstructure:"preserve_ownership"`
+
+	// RemoveEmptyDirs deletes source directories left empty after files are moved out.
+	RemoveEmptyDirs bool `mapstructure:"remove_empty_dirs"`
+
+	// UseModTimeFallback dates files by modification time when no metadata date is found.
+	UseModTimeFallback bool `mapstructure:"use_modtime_fallback"`
+	// UnsortedDirectory collects files without a date under the target directory,
+	// keeping their relative source path. Empty leaves such files in place.
+	UnsortedDirectory string `mapstructure:"unsorted_directory"`
+
+	// OverwriteToTrash moves files that would be overwritten or deleted into
+	// .photo-sorter-trash/<timestamp>/ under the target directory.
+	OverwriteToTrash bool `mapstructure:"overwrite_to_trash"`
+
+	// LinkMode places files in the target tree as links to their original
+	// location instead of moving or copying them: "none", "hardlink" or "symlink".
+	LinkMode string `mapstructure:"link_mode"`
+	// AbsoluteSymlinks writes absolute symlink targets instead of relative ones.
+	AbsoluteSymlinks bool `mapstructure:"absolute_symlinks"`
+
+	// CaseInsensitiveTarget controls whether target file names differing only in
+	// case are treated as the same file: "auto" (detect), "true" or "false".
+	CaseInsensitiveTarget string `mapstructure:"case_insensitive_target"`
+
+	// CreateTarget creates the target directory when it does not exist. Off,
+	// the target must exist.
+	CreateTarget bool `mapstructure:"create_target"`
+
+	// DetectFileType reads the first bytes of each media file to find its
+	// real type, which then decides whether it is an image or a video and
+	// how its metadata is read, instead of its extension.
+	DetectFileType bool `mapstructure:"detect_file_type"`
+	// FixExtensions gives organized files whose extension does not match
+	// their content the right one. It requires DetectFileType.
+	FixExtensions bool `mapstructure:"fix_extensions"`
 }
 
+// Values for ProcessingConfig.CaseInsensitiveTarget.
+const (
+	CaseInsensitiveAuto  = "auto"
+	CaseInsensitiveTrue  = "true"
+	CaseInsensitiveFalse = "false"
+)
+
+// Values for ProcessingConfig.PreserveSourceSubdir.
+const (
+	PreserveSubdirNone     = "none"
+	PreserveSubdirLast     = "last"
+	PreserveSubdirRelative = "relative"
+)
+
+// Link modes for ProcessingConfig.LinkMode.
+const (
+	LinkModeNone     = "none"
+	LinkModeHardlink = "hardlink"
+	LinkModeSymlink  = "symlink"
+)
+
+// Archive formats the target can be written as instead of a directory tree,
+// chosen by the target's extension.
+const (
+	ArchiveFormatTar   = "tar"
+	ArchiveFormatTarGz = "tar.gz"
+	ArchiveFormatZip   = "zip"
+)
+
 // VideoConfig holds video processing settings.
 type VideoConfig struct {
 	MPGProcessing        MPGProcessingConfig `mapstructure:"mpg_processing"`
@@ -67,10 +287,26 @@ type MPGProcessingConfig struct {
 
 // PerformanceConfig holds performance tuning settings.
 type PerformanceConfig struct {
-	BatchSize     int  `mapstructure:"batch_size"`
-	WorkerThreads int  `mapstructure:"worker_threads"`
-	ShowProgress  bool `mapstructure:"show_progress"`
-	CacheSize     int  `mapstructure:"cache_size"`
+	// BatchSize is the number of files processed per batch. The report is
+	// flushed and progress is reported after each batch, and BatchPause is
+	// slept between batches.
+	BatchSize     int           `mapstructure:"batch_size"`
+	BatchPause    time.Duration `mapstructure:"batch_pause"`
+	WorkerThreads int           `mapstructure:"worker_threads"`
+	ShowProgress  bool          `mapstructure:"show_progress"`
+	CacheSize     int           `mapstructure:"cache_size"`
+
+	// HashThreads and TransferThreads size the two stages files pass through:
+	// reading metadata to determine the target, and moving or copying the file.
+	// 0 uses WorkerThreads.
+	HashThreads     int `mapstructure:"hash_threads"`
+	TransferThreads int `mapstructure:"transfer_threads"`
+
+	// MaxFilesPerSecond and MaxBytesPerSecond throttle file transfers so a run
+	// does not saturate the disk (0 / "" = unlimited). MaxBytesPerSecond is in
+	// bytes or human-readable form ("20MB").
+	MaxFilesPerSecond float64 `mapstructure:"max_files_per_second"`
+	MaxBytesPerSecond string  `mapstructure:"max_bytes_per_second"`
 }
 
 // SecurityConfig holds security and safety settings.
@@ -78,6 +314,96 @@ type SecurityConfig struct {
 	DryRun             bool `mapstructure:"dry_run"`
 	ConfirmBeforeStart bool `mapstructure:"confirm_before_start"`
 	MaxFilesPerRun     int  `mapstructure:"max_files_per_run"`
+
+	// ContinueFromCursor resumes discovery after the last file of the previous
+	// run capped by MaxFilesPerRun.
+	ContinueFromCursor bool `mapstructure:"continue_from_cursor"`
+
+	// CheckDiskSpace refuses to start a run that copies data to the target
+	// filesystem when the files, plus FreeSpaceMargin (bytes or human-readable
+	// form, "1GB"), do not fit in the space available there.
+	CheckDiskSpace  bool   `mapstructure:"check_disk_space"`
+	FreeSpaceMargin string `mapstructure:"free_space_margin"`
+}
+
+// WatchConfig holds settings for the watch command.
+type WatchConfig struct {
+	// SettlePeriod is how long a new file's size must stay unchanged before it is organized.
+	SettlePeriod time.Duration `mapstructure:"settle_period"`
+
+	// SidecarTimeout is how long a settled sidecar waits for its media file,
+	// still settling, before it is handled without it.
+	SidecarTimeout time.Duration `mapstructure:"sidecar_timeout"`
+}
+
+// WebConfig holds settings for the web interface.
+type WebConfig struct {
+	// BindAddress is the address serve listens on. Other addresses than the
+	// loopback one need authentication, or the --insecure-bind flag.
+	BindAddress string `mapstructure:"bind_address"`
+
+	// TLS serves HTTPS when both files are set.
+	TLS TLSConfig `mapstructure:"tls"`
+
+	// AllowedOrigins are the origins (e.g. "https://nas.local:8080") allowed
+	// to open WebSocket connections besides the server's own; "*" allows any.
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+
+	// BrowseRoots are the directories the directory browser may show, with
+	// everything below them. Empty allows the home directory and the source
+	// and target directories of the configuration the server loaded.
+	BrowseRoots []string `mapstructure:"browse_roots"`
+
+	// JobHistory is how many scan, organize and apply jobs /api/jobs keeps,
+	// the oldest being dropped first.
+	JobHistory int `mapstructure:"job_history"`
+
+	// MetricsEnabled serves Prometheus metrics at /metrics, behind the same
+	// authentication as the API.
+	MetricsEnabled bool `mapstructure:"metrics_enabled"`
+
+	// StatsInterval is how often running jobs send a stats_update message
+	// with their counters, rate and ETA.
+	StatsInterval time.Duration `mapstructure:"stats_interval"`
+
+	// AuditLog is the JSONL file recording who started jobs and changed the
+	// configuration. Empty puts audit.jsonl next to the log file.
+	AuditLog string `mapstructure:"audit_log"`
+
+	// Token, if set, is accepted as "Authorization: Bearer <token>". Username
+	// and PasswordHash (bcrypt) allow logging in with a password instead.
+	// Without either, serve only listens on 127.0.0.1. The secrets are never
+	// written by Save; the values in the config file are kept.
+	Token        string `mapstructure:"token" save:"keep"`
+	Username     string `mapstructure:"username"`
+	PasswordHash string `mapstructure:"password_hash" save:"keep"`
+}
+
+// TLSConfig holds the certificate and private key files for HTTPS.
+type TLSConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// Enabled reports whether HTTPS is configured.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Validate checks that both files are set and hold a usable certificate and key.
+func (c TLSConfig) Validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return fmt.Errorf("TLS needs both a certificate and a key file")
+	}
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return fmt.Errorf("cannot load TLS certificate and key: %w", err)
+	}
+	return nil
+}
+
+// AuthEnabled reports whether the web interface requires authentication.
+func (c WebConfig) AuthEnabled() bool {
+	return c.Token != "" || c.PasswordHash != ""
 }
 
 // LoggingConfig holds logging settings.
@@ -88,6 +414,37 @@ type LoggingConfig struct {
 	MaxBackups int    `mapstructure:"max_backups"`
 	MaxAge     int    `mapstructure:"max_age"`
 	Compress   bool   `mapstructure:"compress"`
+
+	// ConsoleFormat is the format of the log lines on the console: "text",
+	// concise lines colored on terminals (unless NO_COLOR is set), or
+	// "json" like the log file.
+	ConsoleFormat string `mapstructure:"console_format"`
+
+	// SampleRepeats is how many times the same warning, such as "Could not
+	// extract date" for every file of a directory, is logged before further
+	// repeats are only counted and summarized now and then. 0 logs every
+	// warning; errors and info messages are always logged.
+	SampleRepeats int `mapstructure:"sample_repeats"`
+
+	// MaxRecordedErrors is how many errors of a run are kept for the error
+	// summary and export; further ones are only counted. 0 keeps all.
+	MaxRecordedErrors int `mapstructure:"max_recorded_errors"`
+}
+
+// HistoryConfig holds settings for the run history listed by "history" and
+// /api/history.
+type HistoryConfig struct {
+	// Enabled records a summary of every organize, scan, plan, apply and
+	// compress run.
+	Enabled bool `mapstructure:"enabled"`
+
+	// Directory holds one JSON file per run. Empty uses
+	// ~/.photo-sorter/history.
+	Directory string `mapstructure:"directory"`
+
+	// MaxRuns is how many runs are kept, the oldest being removed first. 0
+	// keeps all.
+	MaxRuns int `mapstructure:"max_runs"`
 }
 
 // GetAvailableDateFormats returns all available date format options.
@@ -97,6 +454,7 @@ func GetAvailableDateFormats() []DateFormatOption {
 			ID:          "year_month_day",
 			Name:        "Year/Month/Day",
 			Format:      "2006/01/02",
+			Template:    "{year}/{month}/{day}",
 			Example:     "2024/12/25",
 			Description: "Full date structure with year, month, and day folders",
 		},
@@ -104,6 +462,7 @@ func GetAvailableDateFormats() []DateFormatOption {
 			ID:          "year_month",
 			Name:        "Year/Month",
 			Format:      "2006/01",
+			Template:    "{year}/{month}",
 			Example:     "2024/12",
 			Description: "Monthly organization with year and month folders only",
 		},
@@ -111,6 +470,7 @@ func GetAvailableDateFormats() []DateFormatOption {
 			ID:          "year_only",
 			Name:        "Year Only",
 			Format:      "2006",
+			Template:    "{year}",
 			Example:     "2024",
 			Description: "Yearly organization with only year folders",
 		},
@@ -118,6 +478,7 @@ func GetAvailableDateFormats() []DateFormatOption {
 			ID:          "year_dash_month_dash_day",
 			Name:        "Year-Month-Day",
 			Format:      "2006-01-02",
+			Template:    "{year}-{month}-{day}",
 			Example:     "2024-12-25",
 			Description: "Full date structure with dashes",
 		},
@@ -125,12 +486,40 @@ func GetAvailableDateFormats() []DateFormatOption {
 			ID:          "year_dash_month",
 			Name:        "Year-Month",
 			Format:      "2006-01",
+			Template:    "{year}-{month}",
 			Example:     "2024-12",
 			Description: "Monthly organization with dashes",
 		},
+		{
+			ID:          "year_month_name",
+			Name:        "Year/Month Name",
+			Format:      "2006/01-January",
+			Template:    "{year}/{month}-{month_name}",
+			Example:     "2024/12-December",
+			Description: "Monthly folders named with the month's number and name",
+		},
+		{
+			ID:          "year_quarter",
+			Name:        "Year/Quarter",
+			Format:      "{year}/Q{quarter}",
+			Template:    "{year}/Q{quarter}",
+			Example:     "2024/Q4",
+			Description: "Quarterly organization with year and quarter folders",
+		},
+		{
+			ID:          "year_week",
+			Name:        "Year/Week",
+			Format:      "{week_year}/W{week}",
+			Template:    "{week_year}/W{week}",
+			Example:     "2024/W52",
+			Description: "Weekly organization by ISO week, with the year the week belongs to",
+		},
 	}
 }
 
+// CameraToken is replaced with the camera name when used in DateFormat.
+const CameraToken = "{camera}"
+
 // DefaultConfig returns a configuration with default values.
 func DefaultConfig() *Config {
 	return &Config{
@@ -138,12 +527,27 @@ func DefaultConfig() *Config {
 		SupportedExtensions: []string{
 			".jpg", ".jpeg", ".png", ".tiff", ".tif",
 			".cr2", ".nef", ".arw", ".dng", ".raw",
+			".heic", ".heif",
 		},
 		Processing: ProcessingConfig{
-			MoveFiles:         true,
-			DuplicateHandling: "rename",
-			SkipOrganized:     true,
-			CreateBackups:     false,
+			MoveFiles:              true,
+			DuplicateHandling:      DuplicatePolicy{"default": DuplicateRename},
+			SkipOrganized:          true,
+			CreateBackups:          false,
+			SettleTime:             2 * time.Second,
+			IgnoreHidden:           true,
+			UnknownCameraFolder:    naming.DefaultCameraName,
+			PreserveSourceSubdir:   PreserveSubdirNone,
+			PairRawJPEG:            true,
+			PairLivePhotos:         true,
+			LivePhotoMaxDelta:      time.Minute,
+			SidecarExtensions:      []string{".xmp", ".aae", ".json"},
+			OrphanedSidecarsFolder: "orphaned-sidecars",
+			PreserveTimestamps:     true,
+			UseModTimeFallback:     true,
+			LinkMode:               LinkModeNone,
+			CaseInsensitiveTarget:  CaseInsensitiveAuto,
+			CreateTarget:           true,
 		},
 		Video: VideoConfig{
 			MPGProcessing: MPGProcessingConfig{
@@ -166,6 +570,17 @@ func DefaultConfig() *Config {
 			DryRun:             false,
 			ConfirmBeforeStart: true,
 			MaxFilesPerRun:     0,
+			CheckDiskSpace:     true,
+			FreeSpaceMargin:    "100MB",
+		},
+		Watch: WatchConfig{
+			SettlePeriod:   5 * time.Second,
+			SidecarTimeout: 5 * time.Minute,
+		},
+		Web: WebConfig{
+			BindAddress:   "127.0.0.1",
+			JobHistory:    50,
+			StatsInterval: time.Second,
 		},
 		Logging: LoggingConfig{
 			Level:      "info",
@@ -174,97 +589,404 @@ func DefaultConfig() *Config {
 			MaxBackups: 3,
 			MaxAge:     30,
 			Compress:   true,
+
+			ConsoleFormat:     "text",
+			SampleRepeats:     10,
+			MaxRecordedErrors: 10000,
+		},
+		History: HistoryConfig{
+			Enabled: true,
+			MaxRuns: 1000,
 		},
 		Compressor: CompressorConfig{
-			Enabled:   true,
-			Quality:   85,
-			Threshold: 1.01,
-			Formats:   []string{".jpg", ".jpeg", ".png", ".webp"},
+			Enabled:       true,
+			Quality:       85,
+			Threshold:     1.01,
+			Formats:       CompressorFormats{".jpg": {}, ".jpeg": {}, ".png": {}, ".webp": {}},
+			ConvertTo:     "none",
+			StripMetadata: "none",
+			MarkStrategy:  "exif",
+			Video: VideoCompressionConfig{
+				Codec:  "h264",
+				CRF:    23,
+				Preset: "medium",
+			},
 		},
 	}
 }
 
 // LoadConfig loads configuration from file and environment variables.
 func LoadConfig(configPath string) (*Config, error) {
-	config := DefaultConfig()
+	return LoadProfile(configPath, "")
+}
 
-	viper.SetConfigType("yaml")
+// LoadProfile loads the configuration like LoadConfig and lays the profile
+// over it, unless profile is empty. The merged configuration is validated.
+func LoadProfile(configPath, profile string) (*Config, error) {
+	config, err := load(configPath, profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+	return config, nil
+}
 
+// LoadStructure loads the configuration like LoadProfile, but only checks it
+// with ValidateStructure: the directories need not be set or exist. It is for
+// commands that take them from elsewhere, such as serve from each request.
+func LoadStructure(configPath, profile string) (*Config, error) {
+	config, err := load(configPath, profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ValidateStructure(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+	return config, nil
+}
+
+// load reads the configuration for LoadProfile without validating it. Each
+// load has its own viper instance, so nothing is left over from earlier ones.
+func load(configPath, profile string) (*Config, error) {
+	config := DefaultConfig()
+
+	v := viper.New()
+	v.SetConfigType("yaml")
 	if configPath != "" {
-		viper.SetConfigFile(configPath)
+		v.SetConfigFile(configPath)
 	} else {
-		viper.SetConfigName("config")
-		viper.AddConfigPath(".")
-		viper.AddConfigPath("$HOME/.photo-sorter")
-		viper.AddConfigPath("/etc/photo-sorter")
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+		v.AddConfigPath("$HOME/.photo-sorter")
+		v.AddConfigPath("/etc/photo-sorter")
 	}
 
-	viper.SetEnvPrefix("PHOTO_SORTER")
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	viper.AutomaticEnv()
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	bindEnv(v)
 
-	if err := viper.ReadInConfig(); err != nil {
+	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			return nil, fmt.Errorf("error reading config file: %w", err)
 		}
 	}
+	config.file = v.ConfigFileUsed()
+	config.settings = v
 
-	if err := viper.Unmarshal(config); err != nil {
-		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+	// A configured formats list replaces the default one rather than being
+	// merged into it.
+	if v.IsSet("compressor.formats") {
+		config.Compressor.Formats = nil
 	}
 
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+	if err := v.Unmarshal(config, viper.DecodeHook(decodeHooks())); err != nil {
+		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	if profile != "" {
+		merged, err := config.WithProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		config = merged
+	}
 	return config, nil
 }
 
-// Validate checks the configuration for correctness.
+// Validate checks the configuration for correctness and returns the first
+// problem found.
 func (c *Config) Validate() error {
-	if c.SourceDirectory == "" {
-		return fmt.Errorf("source_directory is required")
+	if problems := c.Problems(); len(problems) > 0 {
+		return problems[0]
 	}
+	return nil
+}
+
+// ValidateStructure checks the configuration like Validate, except that the
+// directories are not required to be set or to exist, and returns the first
+// problem found.
+func (c *Config) ValidateStructure() error {
+	if problems := c.StructureProblems(); len(problems) > 0 {
+		return problems[0]
+	}
+	return nil
+}
 
-	if !isValidPath(c.SourceDirectory) {
-		return fmt.Errorf("source_directory does not exist or is not accessible: %s", c.SourceDirectory)
+// ValidatePaths checks that the source directory is set, that the source
+// directories exist and that the target exists or can be created, and
+// returns the first problem found.
+func (c *Config) ValidatePaths() error {
+	if problems := c.PathProblems(); len(problems) > 0 {
+		return problems[0]
+	}
+	return nil
+}
+
+// Problems checks the configuration like Validate and returns every problem
+// found. Unset settings are given their defaults.
+func (c *Config) Problems() []error {
+	return append(c.PathProblems(), c.StructureProblems()...)
+}
+
+// PathProblems returns the problems of the source and target directories:
+// no source directory, source directories that do not exist, and a target
+// that does not exist and cannot be created.
+func (c *Config) PathProblems() []error {
+	var problems []error
+	if c.SourceDirectory == "" && len(c.SourceDirectories) > 0 {
+		c.SourceDirectory = c.SourceDirectories[0]
+	}
+	if c.SourceDirectory == "" && len(c.Sources) > 0 {
+		c.SourceDirectory = c.Sources[0].Path
+	}
+	if c.SourceDirectory == "" {
+		problems = append(problems, fmt.Errorf("source_directory is required"))
+	} else if !isValidPath(c.SourceDirectory) && !isExistingFile(c.SourceDirectory) {
+		// A single file may be given instead of a directory.
+		problems = append(problems, fmt.Errorf("source_directory does not exist or is not accessible: %s", c.SourceDirectory))
+	}
+	for _, dir := range c.SourceDirectories {
+		if !isValidPath(dir) {
+			problems = append(problems, fmt.Errorf("source_directories entry does not exist or is not accessible: %s", dir))
+		}
+	}
+	for _, source := range c.Sources {
+		if source.Path != "" && !isValidPath(source.Path) {
+			problems = append(problems, fmt.Errorf("sources entry does not exist or is not accessible: %s", source.Path))
+		}
 	}
 
 	if c.TargetDirectory != nil && *c.TargetDirectory != "" {
-		if !isValidPath(*c.TargetDirectory) {
-			return fmt.Errorf("target_directory does not exist or is not accessible: %s", *c.TargetDirectory)
+		if c.TargetArchiveFormat() != "" {
+			// The archive is created by the run; only its directory must exist.
+			if dir := filepath.Dir(*c.TargetDirectory); !isValidPath(dir) {
+				problems = append(problems, fmt.Errorf("directory of target archive does not exist or is not accessible: %s", dir))
+			}
+		} else if info, err := os.Stat(*c.TargetDirectory); err == nil && !info.IsDir() {
+			problems = append(problems, fmt.Errorf("target_directory is not a directory: %s", *c.TargetDirectory))
+		} else if !isValidPath(*c.TargetDirectory) {
+			// The run creates the target; only its nearest existing parent
+			// must be writable.
+			if !c.Processing.CreateTarget {
+				problems = append(problems, fmt.Errorf("target_directory does not exist or is not accessible: %s (create_target is off)", *c.TargetDirectory))
+			} else if parent := existingParent(*c.TargetDirectory); !isWritableDir(parent) {
+				problems = append(problems, fmt.Errorf("target_directory %s cannot be created: %s is not a writable directory", *c.TargetDirectory, parent))
+			}
 		}
 	}
+	return problems
+}
 
+// existingParent returns the nearest directory above path that exists.
+func existingParent(path string) string {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return parent
+		}
+		if _, err := os.Stat(parent); err == nil {
+			return parent
+		}
+		path = parent
+	}
+}
+
+// StructureProblems returns every problem of the configuration apart from
+// those of PathProblems. Unset settings are given their defaults.
+func (c *Config) StructureProblems() []error {
+	var problems []error
 	if c.DateFormat == "" {
 		c.DateFormat = "2006/01/02"
 	}
 
-	testTime := time.Date(2023, 12, 25, 15, 30, 45, 0, time.UTC)
-	testFormatted := testTime.Format(c.DateFormat)
-	if testFormatted == c.DateFormat {
-		return fmt.Errorf("invalid date format: %s", c.DateFormat)
+	problems = append(problems, dateFormatProblems(c.DateFormat, c.AllowDateCollisions)...)
+
+	if strings.TrimSpace(c.Processing.UnknownCameraFolder) == "" {
+		c.Processing.UnknownCameraFolder = naming.DefaultCameraName
+	}
+	if strings.ContainsAny(c.Processing.UnknownCameraFolder, `/\`) {
+		problems = append(problems, fmt.Errorf("unknown_camera_folder must be a single folder name: %s", c.Processing.UnknownCameraFolder))
+	}
+
+	problems = append(problems, c.Processing.DuplicateHandling.problems()...)
+
+	c.Processing.PreserveSourceSubdir = strings.ToLower(strings.TrimSpace(c.Processing.PreserveSourceSubdir))
+	switch c.Processing.PreserveSourceSubdir {
+	case "":
+		c.Processing.PreserveSourceSubdir = PreserveSubdirNone
+	case PreserveSubdirNone, PreserveSubdirLast, PreserveSubdirRelative:
+	default:
+		problems = append(problems, fmt.Errorf("invalid preserve_source_subdir: %s (valid: none, last, relative)", c.Processing.PreserveSourceSubdir))
+	}
+
+	c.Processing.LinkMode = strings.ToLower(strings.TrimSpace(c.Processing.LinkMode))
+	switch c.Processing.LinkMode {
+	case "":
+		c.Processing.LinkMode = LinkModeNone
+	case LinkModeNone, LinkModeHardlink, LinkModeSymlink:
+	default:
+		problems = append(problems, fmt.Errorf("invalid link_mode: %s (valid: none, hardlink, symlink)", c.Processing.LinkMode))
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.Processing.CaseInsensitiveTarget)) {
+	case "", CaseInsensitiveAuto:
+		c.Processing.CaseInsensitiveTarget = CaseInsensitiveAuto
+	case CaseInsensitiveTrue, "1":
+		c.Processing.CaseInsensitiveTarget = CaseInsensitiveTrue
+	case CaseInsensitiveFalse, "0":
+		c.Processing.CaseInsensitiveTarget = CaseInsensitiveFalse
+	default:
+		problems = append(problems, fmt.Errorf("invalid case_insensitive_target: %s (valid: auto, true, false)",
+			c.Processing.CaseInsensitiveTarget))
 	}
 
-	validStrategies := map[string]bool{
-		"rename":    true,
-		"skip":      true,
-		"overwrite": true,
+	if c.Processing.FixExtensions && !c.Processing.DetectFileType {
+		problems = append(problems, fmt.Errorf("fix_extensions requires detect_file_type"))
 	}
-	if !validStrategies[c.Processing.DuplicateHandling] {
-		return fmt.Errorf("invalid duplicate_handling strategy: %s (valid: rename, skip, overwrite)",
-			c.Processing.DuplicateHandling)
+
+	if _, err := ParseSize(c.Processing.MinFileSize); err != nil {
+		problems = append(problems, fmt.Errorf("invalid min_file_size: %w", err))
+	}
+	problems = append(problems, excludePatternProblems(c.Processing.ExcludePatterns)...)
+	if c.Processing.MinAge < 0 || c.Processing.MaxAge < 0 {
+		problems = append(problems, fmt.Errorf("min_age and max_age must not be negative"))
+	}
+	if c.Processing.LivePhotoMaxDelta < 0 {
+		problems = append(problems, fmt.Errorf("live_photo_max_delta must not be negative"))
+	}
+	if c.Processing.MaxAge > 0 && c.Processing.MinAge > c.Processing.MaxAge {
+		problems = append(problems, fmt.Errorf("min_age (%v) must not exceed max_age (%v)", c.Processing.MinAge, c.Processing.MaxAge))
+	}
+
+	if err := naming.ValidateFilenameTemplate(c.Processing.FilenameTemplate); err != nil {
+		problems = append(problems, fmt.Errorf("invalid filename_template: %w", err))
 	}
 
 	c.SupportedExtensions = normalizeExtensions(c.SupportedExtensions)
 	c.Video.SupportedExtensions = normalizeExtensions(c.Video.SupportedExtensions)
+	c.Processing.SidecarExtensions = normalizeExtensions(c.Processing.SidecarExtensions)
+	c.Compressor.Video.Formats = normalizeExtensions(c.Compressor.Video.Formats)
+
+	if err := c.Compressor.validate(); err != nil {
+		problems = append(problems, err)
+	}
+	c.Compressor.ConvertTo = strings.ToLower(c.Compressor.ConvertTo)
+	switch c.Compressor.ConvertTo {
+	case "":
+		c.Compressor.ConvertTo = "none"
+	case "none", "jpeg", "webp":
+	default:
+		problems = append(problems, fmt.Errorf("invalid compressor convert_to: %s (valid: none, jpeg, webp)", c.Compressor.ConvertTo))
+	}
+
+	c.Compressor.Video.Codec = strings.ToLower(c.Compressor.Video.Codec)
+	switch c.Compressor.Video.Codec {
+	case "":
+		c.Compressor.Video.Codec = "h264"
+	case "h264", "h265":
+	default:
+		problems = append(problems, fmt.Errorf("invalid compressor video codec: %s (valid: h264, h265)", c.Compressor.Video.Codec))
+	}
+	if c.Compressor.Video.CRF < 0 || c.Compressor.Video.CRF > 51 {
+		problems = append(problems, fmt.Errorf("compressor video crf must be between 0 and 51"))
+	}
+	if c.Compressor.Video.MaxResolution < 0 {
+		problems = append(problems, fmt.Errorf("compressor video max_resolution must not be negative (use 0 to keep the resolution)"))
+	}
+
+	if filepath.IsAbs(c.Processing.UnsortedDirectory) || strings.HasPrefix(filepath.Clean(c.Processing.UnsortedDirectory), "..") {
+		problems = append(problems, fmt.Errorf("unsorted_directory must be relative to the target directory: %s", c.Processing.UnsortedDirectory))
+	}
+
+	if c.Processing.OrphanedSidecarsFolder == "" {
+		c.Processing.OrphanedSidecarsFolder = "orphaned-sidecars"
+	}
 
+	if c.Performance.MaxFilesPerSecond < 0 {
+		problems = append(problems, fmt.Errorf("max_files_per_second must not be negative"))
+	}
+	if c.Logging.SampleRepeats < 0 {
+		problems = append(problems, fmt.Errorf("sample_repeats must not be negative (use 0 to log every warning)"))
+	}
+	if c.Logging.MaxRecordedErrors < 0 {
+		problems = append(problems, fmt.Errorf("max_recorded_errors must not be negative (use 0 to keep all errors)"))
+	}
+	if c.History.MaxRuns < 0 {
+		problems = append(problems, fmt.Errorf("history.max_runs must not be negative (use 0 to keep all runs)"))
+	}
+	if _, err := ParseSize(c.Performance.MaxBytesPerSecond); err != nil {
+		problems = append(problems, fmt.Errorf("invalid max_bytes_per_second: %w", err))
+	}
+
+	if _, err := ParseSize(c.Security.FreeSpaceMargin); err != nil {
+		problems = append(problems, fmt.Errorf("invalid free_space_margin: %w", err))
+	}
+
+	// A batch needs at least one file; an unset or invalid size falls back to the default.
 	if c.Performance.BatchSize <= 0 {
 		c.Performance.BatchSize = 100
 	}
+	if c.Processing.SettleTime < 0 {
+		problems = append(problems, fmt.Errorf("settle_time must not be negative (use 0 to disable the in-use check)"))
+	}
+	if c.Performance.BatchPause < 0 {
+		problems = append(problems, fmt.Errorf("batch_pause must not be negative (use 0 to process batches without pausing)"))
+	}
+	if c.Watch.SettlePeriod <= 0 {
+		c.Watch.SettlePeriod = 5 * time.Second
+	}
+	if c.Watch.SidecarTimeout <= 0 {
+		c.Watch.SidecarTimeout = 5 * time.Minute
+	}
+	roots := make([]string, len(c.Web.BrowseRoots))
+	for i, root := range c.Web.BrowseRoots {
+		if !filepath.IsAbs(root) {
+			problems = append(problems, fmt.Errorf("web browse_roots must be absolute paths: %s", root))
+		}
+		roots[i] = filepath.Clean(root)
+	}
+	c.Web.BrowseRoots = roots
+	if c.Web.BindAddress == "" {
+		c.Web.BindAddress = "127.0.0.1"
+	}
+	if c.Web.JobHistory <= 0 {
+		c.Web.JobHistory = 50
+	}
+	if c.Web.StatsInterval <= 0 {
+		c.Web.StatsInterval = time.Second
+	}
+	names := make(map[string]bool, len(c.Schedules))
+	for _, s := range c.Schedules {
+		if err := s.Validate(); err != nil {
+			problems = append(problems, err)
+		}
+		if names[s.Name] {
+			problems = append(problems, fmt.Errorf("duplicate schedule name %q", s.Name))
+		}
+		names[s.Name] = true
+	}
+	if c.Web.TLS.Enabled() {
+		if err := c.Web.TLS.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("invalid web tls: %w", err))
+		}
+	}
+	if c.Web.PasswordHash != "" {
+		if c.Web.Username == "" {
+			problems = append(problems, fmt.Errorf("web username is required with password_hash"))
+		}
+		if _, err := bcrypt.Cost([]byte(c.Web.PasswordHash)); err != nil {
+			problems = append(problems, fmt.Errorf("web password_hash must be a bcrypt hash: %w", err))
+		}
+	}
 	if c.Performance.WorkerThreads <= 0 {
 		c.Performance.WorkerThreads = 4
 	}
+	if c.Performance.HashThreads < 0 || c.Performance.TransferThreads < 0 {
+		problems = append(problems, fmt.Errorf("hash_threads and transfer_threads must not be negative (use 0 for worker_threads)"))
+	}
 	if c.Performance.CacheSize <= 0 {
 		c.Performance.CacheSize = 1000
 	}
@@ -276,9 +998,104 @@ func (c *Config) Validate() error {
 		"error": true,
 	}
 	if !validLogLevels[strings.ToLower(c.Logging.Level)] {
-		return fmt.Errorf("invalid log level: %s (valid: debug, info, warn, error)", c.Logging.Level)
+		problems = append(problems, fmt.Errorf("invalid log level: %s (valid: debug, info, warn, error)", c.Logging.Level))
+	}
+	c.Logging.ConsoleFormat = strings.ToLower(strings.TrimSpace(c.Logging.ConsoleFormat))
+	switch c.Logging.ConsoleFormat {
+	case "":
+		c.Logging.ConsoleFormat = "text"
+	case "text", "json":
+	default:
+		problems = append(problems, fmt.Errorf("invalid logging console_format: %s (valid: text, json)", c.Logging.ConsoleFormat))
+	}
+
+	if err := c.ValidateArchiveTarget(); err != nil {
+		problems = append(problems, err)
+	}
+	return append(problems, c.sourceProblems()...)
+}
+
+// dateFormatProblems returns the problems of a date_format: unknown tokens,
+// times of day, a layout without date fields, folders holding dates of
+// different periods unless allowCollisions is set, and folders outside the
+// target directory.
+func dateFormatProblems(format string, allowCollisions bool) []error {
+	var problems []error
+	layout, err := naming.ParseDateLayout(strings.ReplaceAll(format, CameraToken, ""))
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Errorf("invalid date format: %w", err))
+	case !layout.HasDate():
+		problems = append(problems, fmt.Errorf("invalid date format: %s", format))
+	case !allowCollisions:
+		if first, second, ok := layout.Collision(); ok {
+			hint := ""
+			if strings.Contains(format, "{week}") && !strings.Contains(format, "{week_year}") {
+				hint = " (use {week_year} with {week})"
+			}
+			problems = append(problems, fmt.Errorf("date format %s puts %s and %s in folder %s, but not the days between them%s; set allow_date_collisions to allow this",
+				format, first.Format("2006-01-02"), second.Format("2006-01-02"), layout.Format(first), hint))
+		}
 	}
+	// The folders it produces must stay inside the target directory.
+	if strings.HasPrefix(format, "/") || strings.HasPrefix(format, `\`) ||
+		slices.Contains(strings.FieldsFunc(format, func(r rune) bool { return r == '/' || r == '\\' }), "..") {
+		problems = append(problems, fmt.Errorf("invalid date format: %s (must be a relative folder pattern)", format))
+	}
+	return problems
+}
+
+// excludePatternProblems returns the exclude_patterns entries that are not
+// valid glob patterns.
+func excludePatternProblems(patterns []string) []error {
+	var problems []error
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problems = append(problems, fmt.Errorf("invalid exclude_patterns entry %q: %w", pattern, err))
+		}
+	}
+	return problems
+}
+
+// ArchiveFormat returns the archive format a target path names by its
+// extension (.tar, .tar.gz or .tgz, .zip), or "" for a directory.
+func ArchiveFormat(path string) string {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveFormatTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveFormatTarGz
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveFormatZip
+	}
+	return ""
+}
 
+// TargetArchiveFormat returns the archive format the target is written as, or
+// "" if files are organized into a directory tree.
+func (c *Config) TargetArchiveFormat() string {
+	if c.TargetDirectory == nil || *c.TargetDirectory == "" {
+		return ""
+	}
+	return ArchiveFormat(*c.TargetDirectory)
+}
+
+// ValidateArchiveTarget checks that the settings allow writing the target as
+// an archive. Files can only be copied into an archive, and entries already
+// written cannot be replaced.
+func (c *Config) ValidateArchiveTarget() error {
+	if c.TargetArchiveFormat() == "" {
+		return nil
+	}
+	switch {
+	case c.UsesLinks():
+		return fmt.Errorf("link_mode %s cannot be used with an archive target", c.Processing.LinkMode)
+	case c.Processing.MoveFiles:
+		return fmt.Errorf("files cannot be moved into an archive target; set move_files: false to copy them")
+	case c.Processing.DuplicateHandling.Uses(DuplicateOverwrite):
+		return fmt.Errorf("duplicate_handling overwrite cannot be used with an archive target (valid: rename, skip)")
+	}
 	return nil
 }
 
@@ -290,6 +1107,150 @@ func (c *Config) GetTargetDirectory() string {
 	return c.SourceDirectory
 }
 
+// GetSourceDirectories returns the directories a run organizes:
+// SourceDirectory, SourceDirectories and the paths of Sources, in that order,
+// without repeats and without directories inside another one, whose walk
+// already finds their files. Symlinked spellings of the same directory count
+// as repeats.
+func (c *Config) GetSourceDirectories() []string {
+	var dirs, resolved []string
+	all := append([]string{c.SourceDirectory}, c.SourceDirectories...)
+	for _, source := range c.Sources {
+		all = append(all, source.Path)
+	}
+	for _, dir := range all {
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		real, err := filepath.Abs(dir)
+		if err == nil {
+			if r, err := filepath.EvalSymlinks(real); err == nil {
+				real = r
+			}
+		}
+		dirs = append(dirs, dir)
+		resolved = append(resolved, real)
+	}
+
+	var kept []string
+	for i := range dirs {
+		covered := false
+		for j := range dirs {
+			if resolved[i] == resolved[j] && j < i || resolved[i] != resolved[j] && isSubdirectory(resolved[j], resolved[i]) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, dirs[i])
+		}
+	}
+	return kept
+}
+
+// isSubdirectory reports whether path is below dir.
+func isSubdirectory(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// GetAuditLogPath returns the path of the web audit log.
+func (c *Config) GetAuditLogPath() string {
+	if c.Web.AuditLog != "" {
+		return c.Web.AuditLog
+	}
+	return filepath.Join(filepath.Dir(c.Logging.FilePath), "audit.jsonl")
+}
+
+// GetHistoryDirectory returns the directory of the run history.
+func (c *Config) GetHistoryDirectory() (string, error) {
+	if c.History.Directory != "" {
+		return c.History.Directory, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the home directory for the run history: %w", err)
+	}
+	return filepath.Join(home, ".photo-sorter", "history"), nil
+}
+
+// RunOptions returns the effective options of a run with c, for the
+// messages announcing it and the run history.
+func (c *Config) RunOptions() map[string]any {
+	return map[string]any{
+		"source_directory":   c.SourceDirectory,
+		"source_directories": c.GetSourceDirectories(),
+		"target_directory":   c.GetTargetDirectory(),
+		"date_format":        c.DateFormat,
+		"duplicate_handling": c.Processing.DuplicateHandling.String(),
+		"move_files":         c.Processing.MoveFiles,
+		"dry_run":            c.Security.DryRun,
+		"max_files":          c.Security.MaxFilesPerRun,
+		"exclude_patterns":   c.Processing.ExcludePatterns,
+		"min_file_size":      c.Processing.MinFileSize,
+	}
+}
+
+// UsesLinks reports whether files are linked into the target tree rather than moved or copied.
+func (c *Config) UsesLinks() bool {
+	return c.Processing.LinkMode == LinkModeHardlink || c.Processing.LinkMode == LinkModeSymlink
+}
+
+// GetMaxBytesPerSecond returns the transfer rate limit in bytes per second,
+// or 0 if no limit is set.
+func (c *Config) GetMaxBytesPerSecond() int64 {
+	size, err := ParseSize(c.Performance.MaxBytesPerSecond)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// GetMinSize returns the size in bytes below which images are not compressed
+// while organizing, or 0 if all are.
+func (c CompressorConfig) GetMinSize() int64 {
+	size, err := ParseSize(c.MinSize)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// GetMaxMemory returns the memory budget of the compressor in bytes, or 0 to
+// derive it from the available memory.
+func (c CompressorConfig) GetMaxMemory() int64 {
+	size, err := ParseSize(c.MaxMemory)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// GetFreeSpaceMargin returns the space in bytes to leave free on the target
+// filesystem beyond what a run needs.
+func (c *Config) GetFreeSpaceMargin() int64 {
+	size, err := ParseSize(c.Security.FreeSpaceMargin)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// GetMinFileSize returns the minimum file size in bytes, or 0 if no limit is set.
+func (c *Config) GetMinFileSize() int64 {
+	size, err := ParseSize(c.Processing.MinFileSize)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// UsesCameraFolders reports whether target paths include a camera folder level.
+func (c *Config) UsesCameraFolders() bool {
+	return c.Processing.GroupByCamera || strings.Contains(c.DateFormat, CameraToken)
+}
+
 // IsInPlaceOrganization returns true if files are organized in place.
 func (c *Config) IsInPlaceOrganization() bool {
 	return c.TargetDirectory == nil || *c.TargetDirectory == "" ||
@@ -316,6 +1277,28 @@ func (c *Config) IsVideoExtension(ext string) bool {
 	return slices.Contains(c.Video.SupportedExtensions, ext)
 }
 
+// rawExtensions lists camera RAW extensions recognized for RAW+JPEG pairing.
+var rawExtensions = []string{
+	".cr2", ".cr3", ".nef", ".arw", ".dng", ".raw", ".orf", ".rw2", ".raf", ".pef", ".srw",
+}
+
+// IsRawExtension returns true if the extension is for a camera RAW file.
+func (c *Config) IsRawExtension(ext string) bool {
+	return slices.Contains(rawExtensions, strings.ToLower(ext))
+}
+
+// IsJPEGExtension returns true if the extension is for a JPEG file.
+func (c *Config) IsJPEGExtension(ext string) bool {
+	ext = strings.ToLower(ext)
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// IsLivePhotoImageExtension returns true if the extension can be the still image of a Live Photo.
+func (c *Config) IsLivePhotoImageExtension(ext string) bool {
+	ext = strings.ToLower(ext)
+	return c.IsJPEGExtension(ext) || ext == ".heic" || ext == ".heif"
+}
+
 // isValidPath checks if the given path exists and is a directory.
 func isValidPath(path string) bool {
 	if path == "" {
@@ -335,6 +1318,12 @@ func isValidPath(path string) bool {
 	return err == nil && stat.IsDir()
 }
 
+// isExistingFile reports whether path is an existing regular file.
+func isExistingFile(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.Mode().IsRegular()
+}
+
 // normalizeExtensions returns a normalized slice of file extensions.
 func normalizeExtensions(extensions []string) []string {
 	normalized := make([]string, len(extensions))
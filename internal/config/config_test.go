@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLoadKeepsNothingFromEarlierLoads(t *testing.T) {
+	first := writeConfigFile(t, `
+source_directory: /photos/first
+target_directory: /photos/first-sorted
+date_format: "2006/01"
+processing:
+  move_files: false
+  duplicate_handling:
+    default: skip
+    video: overwrite
+  exclude_patterns: ["*.tmp"]
+compressor:
+  formats: [".png"]
+web:
+  job_history: 7
+  browse_roots: [/photos]
+profiles:
+  trial:
+    security:
+      max_files_per_run: 10
+`)
+	second := writeConfigFile(t, `
+source_directory: /photos/second
+`)
+
+	load := func(path string) (*Config, []byte) {
+		t.Helper()
+		cfg, err := LoadStructure(path, "")
+		if err != nil {
+			t.Fatalf("load %s: %v", path, err)
+		}
+		data, err := cfg.YAML()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg, data
+	}
+	alone, aloneYAML := load(second)
+	firstCfg, firstYAML := load(first)
+	after, afterYAML := load(second)
+	_, againYAML := load(first)
+
+	if firstCfg.DateFormat != "2006/01" || firstCfg.Web.JobHistory != 7 || len(firstCfg.Profiles) != 1 {
+		t.Fatalf("first file not loaded: date_format %q, job_history %d, %d profiles",
+			firstCfg.DateFormat, firstCfg.Web.JobHistory, len(firstCfg.Profiles))
+	}
+	if string(afterYAML) != string(aloneYAML) {
+		t.Errorf("second file loaded after the first:\n%s\nwant as loaded alone:\n%s", afterYAML, aloneYAML)
+	}
+	if !reflect.DeepEqual(after.Origins(), alone.Origins()) {
+		t.Errorf("origins of the second file differ after loading the first")
+	}
+	if string(againYAML) != string(firstYAML) {
+		t.Errorf("first file loaded again:\n%s\nwant as loaded before:\n%s", againYAML, firstYAML)
+	}
+
+	defaults := DefaultConfig()
+	if after.TargetDirectory != nil && *after.TargetDirectory != "" {
+		t.Errorf("target_directory = %s after loading the first file, want it unset", *after.TargetDirectory)
+	}
+	for name, got := range map[string][2]any{
+		"date_format":                   {after.DateFormat, defaults.DateFormat},
+		"processing.move_files":         {after.Processing.MoveFiles, defaults.Processing.MoveFiles},
+		"processing.duplicate_handling": {after.Processing.DuplicateHandling, defaults.Processing.DuplicateHandling},
+		"processing.exclude_patterns":   {after.Processing.ExcludePatterns, defaults.Processing.ExcludePatterns},
+		"compressor.formats":            {after.Compressor.Formats, defaults.Compressor.Formats},
+		"web.job_history":               {after.Web.JobHistory, defaults.Web.JobHistory},
+		"web.browse_roots":              {after.Web.BrowseRoots, defaults.Web.BrowseRoots},
+		"profiles":                      {after.Profiles, defaults.Profiles},
+	} {
+		// Printed, as an empty list is left out of the file like a nil one.
+		if fmt.Sprint(got[0]) != fmt.Sprint(got[1]) {
+			t.Errorf("%s = %v after loading the first file, want the default %v", name, got[0], got[1])
+		}
+	}
+}
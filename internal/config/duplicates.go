@@ -0,0 +1,164 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Duplicate handling strategies: what to do with a file whose target exists.
+const (
+	DuplicateRename    = "rename"
+	DuplicateSkip      = "skip"
+	DuplicateOverwrite = "overwrite"
+)
+
+// DuplicateStrategies lists the valid duplicate_handling strategies.
+var DuplicateStrategies = []string{DuplicateRename, DuplicateSkip, DuplicateOverwrite}
+
+// File categories duplicate_handling can set a strategy for. RAW files are
+// not counted as images.
+const (
+	CategoryImage = "image"
+	CategoryVideo = "video"
+	CategoryRAW   = "raw"
+)
+
+// DuplicateCategories lists the keys of duplicate_handling: the categories
+// and "default", the strategy of the categories not listed.
+var DuplicateCategories = []string{"default", CategoryImage, CategoryVideo, CategoryRAW}
+
+// DuplicatePolicy maps file categories to their duplicate_handling strategy.
+// In the config file it is either a strategy for all files, such as "rename",
+// or a map such as {default: rename, video: skip}.
+type DuplicatePolicy map[string]string
+
+// For returns the strategy of files of category: its own, the default one
+// or "rename".
+func (p DuplicatePolicy) For(category string) string {
+	if strategy := p[category]; strategy != "" {
+		return strategy
+	}
+	if strategy := p["default"]; strategy != "" {
+		return strategy
+	}
+	return DuplicateRename
+}
+
+// Uses reports whether files of any category are handled with strategy.
+func (p DuplicatePolicy) Uses(strategy string) bool {
+	for _, category := range DuplicateCategories {
+		if p.For(category) == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the policy as it may be written in an environment variable:
+// the strategy alone if all files share it, such as "rename", and otherwise
+// the categories with their strategies, such as "default=rename,video=skip".
+func (p DuplicatePolicy) String() string {
+	categories := make([]string, 0, len(p))
+	for category, strategy := range p {
+		if category != "default" && strategy != "" {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) == 0 {
+		return p.For("default")
+	}
+	sort.Strings(categories)
+	pairs := []string{"default=" + p.For("default")}
+	for _, category := range categories {
+		pairs = append(pairs, category+"="+p[category])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// UnmarshalJSON reads a policy given as a strategy for all files or as an
+// object of categories and strategies.
+func (p *DuplicatePolicy) UnmarshalJSON(data []byte) error {
+	var strategy string
+	if err := json.Unmarshal(data, &strategy); err == nil {
+		*p, err = ParseDuplicatePolicy(strategy)
+		return err
+	}
+	var policy map[string]string
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("duplicate_handling must be a strategy or an object of strategies by file category")
+	}
+	*p = policy
+	return nil
+}
+
+// ParseDuplicatePolicy reads a policy written as String returns it: a
+// strategy, or comma-separated category=strategy pairs. An empty string is
+// an empty policy.
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	policy := make(DuplicatePolicy)
+	if !strings.Contains(s, "=") {
+		if s = strings.TrimSpace(s); s != "" {
+			policy["default"] = s
+		}
+		return policy, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		category, strategy, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid duplicate_handling %q: %q is not category=strategy", s, pair)
+		}
+		policy[strings.TrimSpace(category)] = strings.TrimSpace(strategy)
+	}
+	return policy, nil
+}
+
+// duplicatePolicyHook decodes duplicate_handling given as a strategy or as
+// category=strategy pairs.
+func duplicatePolicyHook(from, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeOf(DuplicatePolicy{}) {
+		return data, nil
+	}
+	if s, ok := data.(string); ok {
+		return ParseDuplicatePolicy(s)
+	}
+	return data, nil
+}
+
+// problems returns the unknown categories and invalid strategies of p,
+// which it lowercases. A policy that is already lowercase is only read, so
+// copies of a validated config sharing it can be validated concurrently.
+func (p DuplicatePolicy) problems() []error {
+	var problems []error
+	categories := make([]string, 0, len(p))
+	for category := range p {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		given := p[category]
+		strategy := strings.ToLower(strings.TrimSpace(given))
+		if normalized := strings.ToLower(strings.TrimSpace(category)); normalized != category || strategy != given {
+			delete(p, category)
+			category = normalized
+			p[category] = strategy
+		}
+		if !slices.Contains(DuplicateCategories, category) {
+			problems = append(problems, fmt.Errorf("invalid duplicate_handling category: %s (valid: %s)",
+				category, strings.Join(DuplicateCategories, ", ")))
+			continue
+		}
+		if !slices.Contains(DuplicateStrategies, strategy) {
+			setting := "duplicate_handling." + category
+			if len(categories) == 1 && category == "default" {
+				setting = "duplicate_handling" // given as a plain strategy
+			}
+			problems = append(problems, fmt.Errorf("invalid %s strategy: %s (valid: %s)",
+				setting, strategy, strings.Join(DuplicateStrategies, ", ")))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// envPrefix starts the names of the environment variables that set settings.
+const envPrefix = "PHOTO_SORTER"
+
+// EnvVar is an environment variable that sets a setting.
+type EnvVar struct {
+	Name  string // e.g. PHOTO_SORTER_PROCESSING_MOVE_FILES
+	Path  string // dotted path of the setting
+	Value string // value in effect, "(hidden)" for secrets
+	Set   bool   // whether the variable is set
+}
+
+// EnvName returns the environment variable that sets the setting at the
+// dotted path.
+func EnvName(path string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// EnvVars returns the environment variables that set the settings, in the
+// order of the settings, with the values in effect in c.
+func (c *Config) EnvVars() []EnvVar {
+	values := make(map[string]any)
+	settingValues(reflect.ValueOf(c).Elem(), "", values)
+	var vars []EnvVar
+	envSettings(func(path string, field reflect.StructField) {
+		value := formatSetting(values[path])
+		if field.Tag.Get("save") == "keep" && value != "" {
+			value = "(hidden)"
+		}
+		name := EnvName(path)
+		vars = append(vars, EnvVar{Name: name, Path: path, Value: value, Set: os.Getenv(name) != ""})
+	})
+	return vars
+}
+
+// bindEnv makes v read every setting an environment variable can set from
+// it. Viper only looks up variables of keys it knows of, which settings
+// below a section are not unless the config file sets them.
+func bindEnv(v *viper.Viper) {
+	envSettings(func(path string, _ reflect.StructField) {
+		_ = v.BindEnv(path, EnvName(path)) // only fails without a key
+	})
+}
+
+// envSettings calls fn with the dotted path and the field of every setting
+// an environment variable can set: plain values, lists of them,
+// compressor.formats, given as a list of extensions, and duplicate_handling,
+// given as a strategy or as category=strategy pairs.
+func envSettings(fn func(path string, field reflect.StructField)) {
+	settingPaths(reflect.TypeOf(Config{}), "", func(path string, field reflect.StructField) {
+		t := field.Type
+		if t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		textMap := t == reflect.TypeOf(CompressorFormats{}) || t == reflect.TypeOf(DuplicatePolicy{})
+		if t.Kind() == reflect.Map && !textMap || t.Kind() == reflect.Struct {
+			return // profiles, schedules, sources
+		}
+		fn(path, field)
+	})
+}
+
+// formatSetting returns value as it would be written in an environment
+// variable, lists separated by commas.
+func formatSetting(value any) string {
+	if formats, ok := value.(CompressorFormats); ok {
+		return strings.Join(formats.Extensions(), ",")
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case !v.IsValid():
+		return ""
+	case v.Kind() == reflect.Pointer:
+		if v.IsNil() {
+			return ""
+		}
+		return formatSetting(v.Elem().Interface())
+	case v.Kind() == reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatSetting(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
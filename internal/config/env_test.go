@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestEnvSetsNestedSettings(t *testing.T) {
+	path := writeConfigFile(t, `
+source_directory: /photos
+processing:
+  move_files: true
+  exclude_patterns: ["*.tmp"]
+compressor:
+  quality: 90
+logging:
+  level: warn
+`)
+	env := map[string]string{
+		"processing.move_files":         "false",
+		"processing.exclude_patterns":   "*.bak,trash/*",
+		"processing.duplicate_handling": "default=rename,video=skip",
+		"compressor.quality":            "70",
+		"compressor.formats":            ".png,.webp",
+		"compressor.video.crf":          "30",
+		"logging.level":                 "debug",
+		"logging.console_format":        "json",
+		"logging.max_size":              "5",
+	}
+	for setting, value := range env {
+		t.Setenv(EnvName(setting), value)
+	}
+
+	cfg, err := LoadStructure(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for setting, got := range map[string]any{
+		"processing.move_files":         cfg.Processing.MoveFiles,
+		"processing.exclude_patterns":   cfg.Processing.ExcludePatterns,
+		"processing.duplicate_handling": cfg.Processing.DuplicateHandling,
+		"compressor.quality":            cfg.Compressor.Quality,
+		"compressor.formats":            cfg.Compressor.Formats,
+		"compressor.video.crf":          cfg.Compressor.Video.CRF,
+		"logging.level":                 cfg.Logging.Level,
+		"logging.console_format":        cfg.Logging.ConsoleFormat,
+		"logging.max_size":              cfg.Logging.MaxSize,
+	} {
+		if value := formatSetting(got); value != env[setting] {
+			t.Errorf("%s = %q, want %q from %s", setting, value, env[setting], EnvName(setting))
+		}
+		if origin, want := cfg.Origins()[setting], "env "+EnvName(setting); origin != want {
+			t.Errorf("origin of %s = %q, want %q", setting, origin, want)
+		}
+	}
+	if cfg.SourceDirectory != "/photos" {
+		t.Errorf("source_directory = %q, want the file's /photos", cfg.SourceDirectory)
+	}
+
+	vars := make(map[string]EnvVar)
+	for _, v := range cfg.EnvVars() {
+		vars[v.Path] = v
+	}
+	for setting, value := range env {
+		if v := vars[setting]; !v.Set || v.Value != value {
+			t.Errorf("EnvVars has %s set %v to %q, want set to %q", v.Name, v.Set, v.Value, value)
+		}
+	}
+	if v := vars["source_directory"]; v.Set || v.Value != "/photos" {
+		t.Errorf("EnvVars has %s set %v to %q, want unset with /photos in effect", v.Name, v.Set, v.Value)
+	}
+}
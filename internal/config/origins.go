@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+
+	"github.com/spf13/viper"
+)
+
+// Origins of settings, as returned by Origins.
+const (
+	OriginDefault = "default"
+	OriginFile    = "file"
+	OriginWeb     = "web" // changed in the web interface
+)
+
+// Origins returns where each setting of c, loaded by LoadProfile, comes from,
+// by dotted path such as "processing.move_files": OriginDefault, OriginFile,
+// "env PHOTO_SORTER_...", "profile <name>" or what SetOrigin recorded.
+func (c *Config) Origins() map[string]string {
+	settings := c.settings
+	if settings == nil { // not loaded, all defaults
+		settings = viper.New()
+	}
+	known := make(map[string]bool)
+	for _, key := range settings.AllKeys() {
+		known[key] = true
+	}
+	origins := make(map[string]string)
+	settingPaths(reflect.TypeOf(*c), "", func(path string, _ reflect.StructField) {
+		env := EnvName(path)
+		if origin, ok := c.origins[path]; ok {
+			origins[path] = origin
+			return
+		}
+		switch {
+		case c.Profile != "" && hasSetting(c.Profiles[c.Profile], path):
+			origins[path] = "profile " + c.Profile
+		case os.Getenv(env) != "" && known[path]: // viper ignores empty variables
+			origins[path] = "env " + env
+		case settings.InConfig(path):
+			origins[path] = OriginFile
+		default:
+			origins[path] = OriginDefault
+		}
+	})
+	return origins
+}
+
+// SetOrigin records that the settings at the dotted paths were changed after
+// c was loaded, by origin: OriginWeb, or a flag such as "flag --bind". Copies
+// of c made before keep the origins they had.
+func (c *Config) SetOrigin(origin string, paths ...string) {
+	origins := maps.Clone(c.origins)
+	if origins == nil {
+		origins = make(map[string]string, len(paths))
+	}
+	for _, path := range paths {
+		origins[path] = origin
+	}
+	c.origins = origins
+}
+
+// YAML returns c as it would be saved, without the secrets and profiles.
+func (c *Config) YAML() ([]byte, error) {
+	node, err := yamlNode(reflect.ValueOf(c).Elem(), nil, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	return encodeYAML(node)
+}
+
+// YAMLWithOrigins returns c like YAML, with the origin of each setting from
+// origins after it.
+func (c *Config) YAMLWithOrigins(origins map[string]string) ([]byte, error) {
+	node, err := yamlNode(reflect.ValueOf(c).Elem(), nil, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	annotate(node, reflect.TypeOf(*c), "", func(path string) (string, string) {
+		return "", origins[path] // empty for sections
+	})
+	return encodeYAML(node)
+}
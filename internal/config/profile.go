@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ProfileNames returns the names of the configured profiles, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithProfile returns a copy of c with the profile name laid over it. The
+// settings the profile sets replace those of c, lists and maps as a whole,
+// and the others are kept. The result is not validated. Profile names are
+// not case-sensitive.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	name = strings.ToLower(name)
+	overlay, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return nil, fmt.Errorf("unknown profile %q: no profiles are configured", name)
+		}
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	if _, nested := overlay["profiles"]; nested {
+		return nil, fmt.Errorf("profile %s: profiles cannot be set in a profile", name)
+	}
+
+	merged := *c
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       decodeHooks(),
+		WeaklyTypedInput: true,
+		ErrorUnused:      true, // catches misspelled settings
+		ZeroFields:       true, // so that maps of c are replaced, not changed
+		Result:           &merged,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(overlay); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	merged.Profile = name
+	return &merged, nil
+}
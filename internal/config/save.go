@@ -0,0 +1,204 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is where the config is saved when it was not loaded from a file.
+const defaultConfigFile = "config.yaml"
+
+// File returns the path of the config file c was loaded from, or "" if it
+// was not loaded from a file.
+func (c *Config) File() string {
+	return c.file
+}
+
+// FilePath returns the path of the config file c was loaded from, or
+// ./config.yaml if none was.
+func (c *Config) FilePath() string {
+	if c.file != "" {
+		return c.file
+	}
+	return defaultConfigFile
+}
+
+// Save validates c and writes it as YAML to path, or to c.FilePath() if path is
+// empty. The file is replaced atomically, so it is never left half-written or
+// invalid. Comments in the existing file are not kept. Fields tagged
+// save:"keep", the secrets and the profiles, keep the value in the existing file instead of
+// being written from c, and so do the settings that come from elsewhere than
+// the file, the defaults or the web interface (see Origins): a value from an
+// environment variable or a flag only applies while it is set.
+func (c *Config) Save(path string) error {
+	if c.Profile != "" {
+		return fmt.Errorf("cannot save the config with profile %s applied: its settings would replace those of the base config", c.Profile)
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+	if path == "" {
+		path = c.FilePath()
+	}
+
+	var existing map[string]any
+	if data, err := os.ReadFile(path); err == nil {
+		_ = yaml.Unmarshal(data, &existing) // an unreadable file has nothing to keep
+	}
+	origins := c.Origins()
+	node, err := yamlNode(reflect.ValueOf(c).Elem(), existing, "", func(path string) bool {
+		return !savedOrigin(origins[path])
+	})
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	data, err := encodeYAML(node)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# PhotoSorter configuration, saved " + time.Now().Format(time.RFC3339) + "\n")
+	buf.Write(data)
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save config: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	return nil
+}
+
+// savedOrigin reports whether Save writes a setting of the given origin.
+func savedOrigin(origin string) bool {
+	return origin == OriginFile || origin == OriginDefault || origin == OriginWeb
+}
+
+// yamlNode returns the YAML form of v, keyed by the mapstructure tags so that
+// LoadConfig reads it back. Struct fields keep their order, nil pointers and
+// fields tagged "-" are left out, durations are written as "2s", lists of
+// plain values inline and a duplicate_handling with one strategy for all files
+// as that strategy. Fields tagged save:"keep", and the settings for whose
+// dotted path keep (which may be nil) is true, are taken from existing, the
+// same part of the file being replaced, or left out. path is the dotted path
+// of v followed by a dot, or empty for the whole config.
+func yamlNode(v reflect.Value, existing any, path string, keep func(path string) bool) (*yaml.Node, error) {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return scalarNode(d.String())
+	}
+	if p, ok := v.Interface().(DuplicatePolicy); ok && !strings.Contains(p.String(), "=") {
+		return scalarNode(p.String())
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return yamlNode(v.Elem(), existing, path, keep)
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		existingFields, _ := existing.(map[string]any)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			var value *yaml.Node
+			var err error
+			if field.Tag.Get("save") == "keep" || (keep != nil && !isSection(field.Type) && keep(path+name)) {
+				if kept, ok := existingFields[name]; ok {
+					value, err = scalarNode(kept)
+				}
+			} else {
+				value, err = yamlNode(v.Field(i), existingFields[name], path+name+".", keep)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				continue
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+		}
+		return node, nil
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			value, err := yamlNode(v.MapIndex(key), nil, "", nil)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				continue
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(key)}, value)
+		}
+		return node, nil
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		if v.Type().Elem().Kind() != reflect.Struct {
+			node.Style = yaml.FlowStyle // e.g. [".jpg", ".png"]
+		}
+		for i := 0; i < v.Len(); i++ {
+			value, err := yamlNode(v.Index(i), nil, "", nil)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		return node, nil
+	}
+	return scalarNode(v.Interface())
+}
+
+// encodeYAML returns the YAML text of node, indented by two spaces.
+func encodeYAML(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scalarNode returns the YAML node of a plain value.
+func scalarNode(value any) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeConfigFile writes content as config.yaml in a new temporary directory
+// and returns its path.
+func writeConfigFile(t testing.TB, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readConfigFile returns the settings in the config file at path.
+func readConfigFile(t testing.TB, path string) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings map[string]any
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		t.Fatalf("parse %s: %v", path, err)
+	}
+	return settings
+}
+
+// lookup returns the value at the dotted path in settings read by
+// readConfigFile.
+func lookup(settings map[string]any, path string) (any, bool) {
+	var value any = settings
+	for _, key := range strings.Split(path, ".") {
+		section, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = section[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func TestSaveWritesOnlyFileAndWebSettings(t *testing.T) {
+	source := t.TempDir()
+	path := writeConfigFile(t, `
+source_directory: `+source+`
+date_format: "2006/01"
+processing:
+  move_files: true
+web:
+  job_history: 20
+`)
+	t.Setenv(EnvName("processing.move_files"), "false")
+	t.Setenv(EnvName("target_directory"), filepath.Join(source, "from-env"))
+	t.Setenv(EnvName("web.job_history"), "30")
+
+	cfg, err := LoadStructure(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Web.BindAddress = "0.0.0.0"
+	cfg.SetOrigin("flag --bind", "web.bind_address")
+	cfg.DateFormat = "2006-01-02"
+	cfg.SetOrigin(OriginWeb, "date_format")
+	cfg.Processing.RemoveEmptyDirs = !cfg.Processing.RemoveEmptyDirs
+	cfg.SetOrigin(OriginWeb, "processing.remove_empty_dirs")
+	if err := cfg.Save(""); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	saved := readConfigFile(t, path)
+	tests := []struct {
+		path    string
+		want    any // nil if the setting must not be in the file
+		because string
+	}{
+		{path: "source_directory", want: source, because: "it is from the file"},
+		{path: "date_format", want: "2006-01-02", because: "it was changed in the web interface"},
+		{path: "processing.remove_empty_dirs", want: cfg.Processing.RemoveEmptyDirs, because: "it was changed in the web interface"},
+		{path: "processing.move_files", want: true, because: "the environment only overrides the file's value"},
+		{path: "web.job_history", want: 20, because: "the environment only overrides the file's value"},
+		{path: "target_directory", because: "it is only set by the environment"},
+		{path: "web.bind_address", because: "it is only set by a flag"},
+	}
+	for _, tt := range tests {
+		got, ok := lookup(saved, tt.path)
+		switch {
+		case tt.want == nil && ok:
+			t.Errorf("%s saved as %v, want it left out: %s", tt.path, got, tt.because)
+		case tt.want != nil && got != tt.want:
+			t.Errorf("%s saved as %v (%T), want %v: %s", tt.path, got, got, tt.want, tt.because)
+		}
+	}
+}
+
+func TestSetOriginLeavesCopiesAlone(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SetOrigin("flag --bind", "web.bind_address")
+	copied := *cfg
+	copied.SetOrigin(OriginWeb, "web.bind_address", "date_format")
+
+	if origin := cfg.Origins()["web.bind_address"]; origin != "flag --bind" {
+		t.Errorf("origin of web.bind_address = %q after changing a copy, want %q", origin, "flag --bind")
+	}
+	if origin := cfg.Origins()["date_format"]; origin != OriginDefault {
+		t.Errorf("origin of date_format = %q after changing a copy, want %q", origin, OriginDefault)
+	}
+	if origin := copied.Origins()["web.bind_address"]; origin != OriginWeb {
+		t.Errorf("origin of web.bind_address in the copy = %q, want %q", origin, OriginWeb)
+	}
+}
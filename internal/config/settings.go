@@ -0,0 +1,84 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangedSettings returns the dotted paths of the settings that differ
+// between old and updated, sorted.
+func ChangedSettings(old, updated *Config) []string {
+	before, after := make(map[string]any), make(map[string]any)
+	settingValues(reflect.ValueOf(old).Elem(), "", before)
+	settingValues(reflect.ValueOf(updated).Elem(), "", after)
+	changed := []string{}
+	for path, value := range after {
+		if !reflect.DeepEqual(before[path], value) {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// settingValues adds the value of every setting of the struct v that is not
+// a section to values, by dotted path.
+func settingValues(v reflect.Value, prefix string, values map[string]any) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		value := v.Field(i)
+		if !isSection(field.Type) {
+			values[prefix+name] = value.Interface()
+			continue
+		}
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		settingValues(value, prefix+name+".", values)
+	}
+}
+
+// settingPaths calls fn with the dotted path and the field of every setting
+// of the struct type t that is not a section.
+func settingPaths(t reflect.Type, prefix string, fn func(path string, field reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		if isSection(field.Type) {
+			section := field.Type
+			if section.Kind() == reflect.Pointer {
+				section = section.Elem()
+			}
+			settingPaths(section, prefix+name+".", fn)
+		} else {
+			fn(prefix+name, field)
+		}
+	}
+}
+
+// hasSetting reports whether the settings of a profile set the dotted path.
+func hasSetting(settings map[string]any, path string) bool {
+	var value any = settings
+	for _, key := range strings.Split(path, ".") {
+		section, ok := value.(map[string]any)
+		if !ok {
+			return false
+		}
+		if value, ok = section[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"", 0},
+		{"4096", 4096},
+		{"4096b", 4096},
+		{"50KB", 50000},
+		{"50kb", 50000},
+		{"50Kb", 50000},
+		{"50k", 50000},
+		{"1.5 MB", 1500000},
+		{"2mb", 2000000},
+		{"2MiB", 2 << 20},
+		{"2mib", 2 << 20},
+		{"4KiB", 4096},
+		{"1GB", 1000000000},
+		{"1GiB", 1 << 30},
+		{"1TiB", 1 << 40},
+		{"  8 KB  ", 8000},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if err != nil {
+			t.Errorf("ParseSize(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSizeErrors(t *testing.T) {
+	tests := []struct {
+		in      string
+		problem string
+	}{
+		{"KB", "missing number"},
+		{"-5KB", "missing number"},
+		{"50XB", `unknown unit "XB"`},
+		{"50 K B", `unknown unit " K B"`},
+		{"1.2.3MB", "invalid size"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSize(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.problem) {
+			t.Errorf("ParseSize(%q) error = %v, want %q", tt.in, err, tt.problem)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"photo-sorter-go/internal/naming"
+)
+
+// SourceConfig is a source directory with settings of its own, which replace
+// the top-level ones for the files found in it. Settings it does not set are
+// nil and keep their top-level values.
+type SourceConfig struct {
+	Path             string    `mapstructure:"path" json:"path"`
+	DateFormat       *string   `mapstructure:"date_format" json:"date_format,omitempty"`
+	MoveFiles        *bool     `mapstructure:"move_files" json:"move_files,omitempty"`
+	FilenameTemplate *string   `mapstructure:"filename_template" json:"filename_template,omitempty"`
+	ExcludePatterns  *[]string `mapstructure:"exclude_patterns" json:"exclude_patterns,omitempty"` // replace the top-level patterns
+	PairRawJPEG      *bool     `mapstructure:"pair_raw_jpeg" json:"pair_raw_jpeg,omitempty"`
+}
+
+// WithSource returns a copy of c with the settings source sets laid over it,
+// the settings files found in source are organized with.
+func (c *Config) WithSource(source SourceConfig) *Config {
+	merged := *c
+	if source.DateFormat != nil {
+		merged.DateFormat = *source.DateFormat
+	}
+	if source.MoveFiles != nil {
+		merged.Processing.MoveFiles = *source.MoveFiles
+	}
+	if source.FilenameTemplate != nil {
+		merged.Processing.FilenameTemplate = *source.FilenameTemplate
+	}
+	if source.ExcludePatterns != nil {
+		merged.Processing.ExcludePatterns = *source.ExcludePatterns
+	}
+	if source.PairRawJPEG != nil {
+		merged.Processing.PairRawJPEG = *source.PairRawJPEG
+	}
+	return &merged
+}
+
+// ResolvedSources returns the sources entries with every setting set to the
+// value files found in them are organized with, for "config show".
+func (c *Config) ResolvedSources() []SourceConfig {
+	resolved := make([]SourceConfig, len(c.Sources))
+	for i, source := range c.Sources {
+		merged := c.WithSource(source)
+		patterns := merged.Processing.ExcludePatterns
+		if patterns == nil {
+			patterns = []string{}
+		}
+		resolved[i] = SourceConfig{
+			Path:             source.Path,
+			DateFormat:       &merged.DateFormat,
+			MoveFiles:        &merged.Processing.MoveFiles,
+			FilenameTemplate: &merged.Processing.FilenameTemplate,
+			ExcludePatterns:  &patterns,
+			PairRawJPEG:      &merged.Processing.PairRawJPEG,
+		}
+	}
+	return resolved
+}
+
+// SetSourceDirectories makes dirs the directories a run organizes instead of
+// the configured ones. The sources entries at or below one of dirs keep
+// applying to the files found there; the others are dropped.
+func (c *Config) SetSourceDirectories(dirs []string) {
+	c.SourceDirectory, c.SourceDirectories = "", nil
+	if len(dirs) > 0 {
+		c.SourceDirectory, c.SourceDirectories = dirs[0], dirs[1:]
+	}
+	var kept []SourceConfig
+	for _, source := range c.Sources {
+		path := absPath(source.Path)
+		for _, dir := range dirs {
+			if dir := absPath(dir); path == dir || isSubdirectory(dir, path) {
+				kept = append(kept, source)
+				break
+			}
+		}
+	}
+	c.Sources = kept
+}
+
+// absPath returns path made absolute and cleaned, or path itself if the
+// working directory is not known.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// sourceProblems returns the problems of the sources entries: a missing or
+// repeated path, and settings that would be problems at the top level.
+func (c *Config) sourceProblems() []error {
+	var problems []error
+	seen := make(map[string]bool, len(c.Sources))
+	for i, source := range c.Sources {
+		if source.Path == "" {
+			problems = append(problems, fmt.Errorf("sources[%d]: path is required", i))
+			continue
+		}
+		name := fmt.Sprintf("sources[%d] (%s)", i, source.Path)
+		if path := absPath(source.Path); seen[path] {
+			problems = append(problems, fmt.Errorf("%s: the directory is listed more than once", name))
+		} else {
+			seen[path] = true
+		}
+
+		var errs []error
+		if source.DateFormat != nil {
+			errs = append(errs, dateFormatProblems(*source.DateFormat, c.AllowDateCollisions)...)
+		}
+		if source.FilenameTemplate != nil {
+			if err := naming.ValidateFilenameTemplate(*source.FilenameTemplate); err != nil {
+				errs = append(errs, fmt.Errorf("invalid filename_template: %w", err))
+			}
+		}
+		if source.ExcludePatterns != nil {
+			errs = append(errs, excludePatternProblems(*source.ExcludePatterns)...)
+		}
+		// Problems of the archive target the top-level settings have are
+		// reported once, for them.
+		if source.MoveFiles != nil && c.ValidateArchiveTarget() == nil {
+			if err := c.WithSource(source).ValidateArchiveTarget(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, err := range errs {
+			problems = append(problems, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateHeader starts the config file written by Template.
+const templateHeader = `# PhotoSorter configuration, written by "photo-sorter config init".
+# Every setting has its default value. See config.example.yaml for more
+# examples, and check the file with "photo-sorter config validate".
+
+`
+
+// settingComments explain the settings in the file written by Template, by
+// dotted path.
+var settingComments = map[string]string{
+	"source_directory":      "Directory with the media files to organize (required)",
+	"source_directories":    "More source directories organized in the same run",
+	"target_directory":      "Directory for the organized files; empty organizes in place. A path\nending in .tar, .tar.gz, .tgz or .zip writes an archive instead",
+	"date_format":           "Folders files are placed in, with tokens such as {year}/{month}/{day}\n({month_name}, {quarter}, {week}, {week_year}) or as a Go time layout:\n2006 = year, 01 = month, 02 = day; {camera} adds the camera model",
+	"allow_date_collisions": "Allow date formats that put dates of different periods in one folder, e.g. \"01\"",
+	"supported_extensions":  "Image extensions to organize",
+
+	"processing":                           "File processing settings",
+	"processing.move_files":                "Move files instead of copying them",
+	"processing.duplicate_handling":        "What to do when the target file exists: rename, skip or overwrite, or\none per category, e.g. {default: rename, video: skip, raw: skip}",
+	"processing.skip_organized":            "Skip directories under the target that match the date format",
+	"processing.create_backups":            "Create backup copies before moving or modifying files",
+	"processing.settle_time":               "Skip files changed within this window, as they may still be written (0 = no check)",
+	"processing.strict_in_use_check":       "Also skip files another process has open for writing (Linux only)",
+	"processing.verify_identical_skips":    "With duplicate_handling skip, record whether skipped files are identical",
+	"processing.ignore_hidden":             "Skip dotfiles, dot-directories and system junk such as .DS_Store",
+	"processing.follow_symlinks":           "Descend into symlinked directories and organize symlinked files",
+	"processing.min_file_size":             "Smallest file to organize, in bytes or e.g. \"50KB\"",
+	"processing.min_age":                   "Only organize files older than this (0 = any age)",
+	"processing.max_age":                   "Only organize files younger than this (0 = any age)",
+	"processing.exclude_patterns":          "Glob patterns of files and directories to leave alone, e.g. \"*.tmp\"",
+	"processing.filename_template":         "Rename organized files, e.g. \"{date}_{time}_{original}.{ext}\" (empty keeps the names)",
+	"processing.group_by_camera":           "Add a camera folder below the date folders",
+	"processing.unknown_camera_folder":     "Camera folder of files without a camera model",
+	"processing.preserve_source_subdir":    "Keep the source folder below the date folders: none, last or relative",
+	"processing.pair_raw_jpeg":             "Keep RAW files with the same-named JPEG, dated by the JPEG",
+	"processing.pair_live_photos":          "Keep Live Photo videos with the same-named still image",
+	"processing.live_photo_max_delta":      "Largest difference of modification times of a Live Photo pair",
+	"processing.sidecar_extensions":        "Metadata files that follow their same-named media file",
+	"processing.collect_orphaned_sidecars": "Move sidecars without a media file into orphaned_sidecars_folder",
+	"processing.orphaned_sidecars_folder":  "Folder for orphaned sidecars, relative to the target directory",
+	"processing.preserve_timestamps":       "Keep the access and modification times on copies",
+	"processing.preserve_ownership":        "Keep the owner and group on copies (Unix, usually requires root)",
+	"processing.remove_empty_dirs":         "Delete source directories left empty after moving files out",
+	"processing.use_modtime_fallback":      "Date files by modification time when no metadata date is found",
+	"processing.unsorted_directory":        "Folder under the target for files without a date (empty leaves them in place)",
+	"processing.overwrite_to_trash":        "Move files that would be overwritten or deleted to .photo-sorter-trash",
+	"processing.link_mode":                 "Link files into the target instead of moving or copying: none, hardlink or symlink",
+	"processing.absolute_symlinks":         "Write absolute symlink targets instead of relative ones",
+	"processing.case_insensitive_target":   "Treat names differing only in case as the same file: auto, true or false",
+	"processing.create_target":             "Create target_directory when it does not exist (its parent must be writable)",
+	"processing.detect_file_type":          "Tell images and videos apart by their content instead of their extension",
+	"processing.fix_extensions":            "Give organized files whose extension does not match their content the right one",
+
+	"video":                               "Video processing settings",
+	"video.mpg_processing":                "Merging of MPG videos with their THM thumbnails",
+	"video.mpg_processing.enable_merging": "Date MPG files by their THM thumbnails",
+	"video.mpg_processing.delete_thm_after_merge": "Delete THM files after merging",
+	"video.mpg_processing.create_backup":          "Back up THM files before deleting them",
+	"video.extract_video_metadata":                "Read dates from video metadata",
+	"video.supported_extensions":                  "Video extensions to organize",
+
+	"performance":                      "Performance tuning",
+	"performance.batch_size":           "Files processed per batch",
+	"performance.batch_pause":          "Pause between batches (0 = none)",
+	"performance.worker_threads":       "Files processed at once",
+	"performance.show_progress":        "Show a progress bar",
+	"performance.cache_size":           "Metadata cache entries",
+	"performance.hash_threads":         "Threads reading metadata (0 = worker_threads)",
+	"performance.transfer_threads":     "Threads moving or copying files (0 = worker_threads)",
+	"performance.max_files_per_second": "Throttle transfers to this many files per second (0 = unlimited)",
+	"performance.max_bytes_per_second": "Throttle transfers to this many bytes per second, e.g. \"20MB\" (empty = unlimited)",
+
+	"security":                      "Safety settings",
+	"security.dry_run":              "Show what would be done without changing any files",
+	"security.confirm_before_start": "Ask before organizing (--yes skips the question)",
+	"security.max_files_per_run":    "Stop after this many files (0 = no limit)",
+	"security.continue_from_cursor": "Continue after the last file of a run stopped by max_files_per_run",
+	"security.check_disk_space":     "Refuse to start when the files do not fit on the target",
+	"security.free_space_margin":    "Space to leave free on the target",
+
+	"watch":                 "Settings of the watch command",
+	"watch.settle_period":   "How long a new file must stay unchanged before it is organized",
+	"watch.sidecar_timeout": "How long a sidecar waits for its media file to settle",
+
+	"web":                 "Settings of the web interface (serve). Set token, or username and\npassword_hash, to require authentication",
+	"web.bind_address":    "Address to listen on; others than 127.0.0.1 need authentication",
+	"web.tls":             "Serve HTTPS with this certificate and key",
+	"web.allowed_origins": "Other origins allowed to open WebSocket connections (\"*\" = any)",
+	"web.browse_roots":    "Directories the directory browser may show (empty = home and the configured ones)",
+	"web.job_history":     "Jobs kept by /api/jobs",
+	"web.metrics_enabled": "Serve Prometheus metrics at /metrics",
+	"web.stats_interval":  "How often running jobs send their counters",
+	"web.audit_log":       "File recording who started jobs and changed the configuration (empty = audit.jsonl next to the log)",
+	"web.username":        "User name for logging in with password_hash",
+
+	"logging":                     "Logging settings",
+	"logging.level":               "debug, info, warn or error",
+	"logging.file_path":           "Log file",
+	"logging.max_size":            "Size in MB at which the log file is rotated",
+	"logging.max_backups":         "Rotated log files kept",
+	"logging.max_age":             "Days rotated log files are kept",
+	"logging.compress":            "Compress rotated log files",
+	"logging.console_format":      "Format of the console lines: text (colored on terminals unless NO_COLOR\nis set) or json like the log file",
+	"logging.sample_repeats":      "Times the same warning is logged before its repeats are only counted (0 = log all)",
+	"logging.max_recorded_errors": "Errors of a run kept for the error summary (0 = all)",
+
+	"history":           "Summaries of past runs, listed by \"photo-sorter history\"",
+	"history.enabled":   "Record a summary of every run",
+	"history.directory": "Directory of the summaries (empty = ~/.photo-sorter/history)",
+	"history.max_runs":  "Runs kept, the oldest removed first (0 = all)",
+
+	"compressor":                      "Image compression settings (compress command)",
+	"compressor.enabled":              "Enable image compression",
+	"compressor.quality":              "JPEG and WebP quality (1-100)",
+	"compressor.threshold":            "Keep the compressed image only if the original is this many times larger",
+	"compressor.formats":              "Extensions to compress, optionally with their own quality and threshold",
+	"compressor.convert_to":           "Convert compressed images: none, jpeg or webp",
+	"compressor.use_exiftool":         "Copy metadata Go cannot copy with exiftool",
+	"compressor.strip_metadata":       "Remove metadata: none, gps or all-but-essential",
+	"compressor.mark_strategy":        "Record compressed files so later runs skip them: exif, manifest or xattr",
+	"compressor.workers":              "Images compressed at once (0 = automatic)",
+	"compressor.max_memory":           "Memory for decoded images, e.g. \"2GB\" (empty = half of the available memory)",
+	"compressor.run_during_organize":  "Compress images in place as they are organized",
+	"compressor.min_size":             "Smallest image compressed during organize, e.g. \"2MB\"",
+	"compressor.video":                "Video re-encoding with ffmpeg",
+	"compressor.video.formats":        "Video extensions to re-encode, e.g. [\".mp4\", \".mov\"]",
+	"compressor.video.codec":          "h264 or h265",
+	"compressor.video.crf":            "Constant rate factor (0-51); lower is better and larger",
+	"compressor.video.preset":         "ffmpeg preset, e.g. fast, medium or slow",
+	"compressor.video.max_resolution": "Largest shorter side in pixels (0 keeps the resolution)",
+
+	"schedules": "Jobs serve runs by itself, e.g.\n- name: nightly\n  at: \"03:00\"\n  job: organize",
+	"sources":   "More source directories, each with its own date_format, move_files,\nfilename_template, exclude_patterns or pair_raw_jpeg, e.g.\n- path: /media/whatsapp\n  move_files: false",
+	"profiles":  "Named sets of settings laid over the others with --profile <name>",
+}
+
+// Template returns a config file with the default settings, each explained
+// by a comment, for "config init".
+func Template() ([]byte, error) {
+	c := DefaultConfig()
+	empty := ""
+	c.TargetDirectory = &empty
+	node, err := yamlNode(reflect.ValueOf(c).Elem(), map[string]any{"profiles": map[string]any{}}, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	annotate(node, reflect.TypeOf(*c), "", func(path string) (string, string) {
+		return settingComments[path], ""
+	})
+	data, err := encodeYAML(node)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(templateHeader), data...), nil
+}
+
+// annotate sets the comments of the settings in node, the YAML form of a
+// value of type t, to those comment returns for their dotted paths: head
+// above the setting, line after it. Sections are descended into.
+func annotate(node *yaml.Node, t reflect.Type, prefix string, comment func(path string) (head, line string)) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind != yaml.MappingNode || t.Kind() != reflect.Struct {
+		return
+	}
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+		fields[name] = t.Field(i).Type
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		path := prefix + key.Value
+		head, line := comment(path)
+		key.HeadComment = head
+		if value.Kind == yaml.ScalarNode || value.Style == yaml.FlowStyle {
+			value.LineComment = line
+		} else {
+			key.LineComment = line
+		}
+		if field, ok := fields[key.Value]; ok && isSection(field) {
+			annotate(value, field, path+".", comment)
+		}
+	}
+}
+
+// isSection reports whether a setting of type t holds other settings.
+func isSection(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package config
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// isWritableDir reports whether files can be created in the directory dir.
+func isWritableDir(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir() && unix.Access(dir, unix.W_OK) == nil
+}
@@ -0,0 +1,11 @@
+package config
+
+import "os"
+
+// isWritableDir reports whether files can be created in the directory dir.
+// The read-only attribute does not keep files from being created in a
+// directory on Windows, so only its existence is checked.
+func isWritableDir(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
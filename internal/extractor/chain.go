@@ -0,0 +1,155 @@
+package extractor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ChainExtractor tries several extractors in priority order. A result that only
+// falls back to the file modification time is used only if no other extractor
+// finds a real date.
+type ChainExtractor struct {
+	extractors []DateExtractor
+}
+
+// NewChainExtractor returns a ChainExtractor that consults extractors from highest to lowest priority.
+func NewChainExtractor(extractors ...DateExtractor) *ChainExtractor {
+	sorted := make([]DateExtractor, len(extractors))
+	copy(sorted, extractors)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetPriority() > sorted[j].GetPriority()
+	})
+	return &ChainExtractor{extractors: sorted}
+}
+
+// NewDefaultExtractor returns the standard extractor chain: EXIF metadata first,
+// then Google Takeout JSON, then the file modification time.
+func NewDefaultExtractor(logger *logrus.Logger) *ChainExtractor {
+	return NewChainExtractor(
+		NewEXIFExtractor(logger),
+		NewTakeoutJSONExtractor(logger),
+	)
+}
+
+// ExtractDate returns the best date found by the chained extractors.
+func (c *ChainExtractor) ExtractDate(filePath string) (*time.Time, error) {
+	meta, err := c.ExtractMetadata(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &meta.Date, nil
+}
+
+// ExtractMetadata returns the metadata from the highest-priority extractor that finds a real date,
+// falling back to a modification-time result if that is all that is available.
+func (c *ChainExtractor) ExtractMetadata(filePath string) (*Metadata, error) {
+	return c.ExtractMetadataAs(filePath, filepath.Ext(filePath))
+}
+
+// ExtractMetadataAs is ExtractMetadata for a file whose content is of the type
+// extension ext stands for, e.g. a JPEG named .png: the extractors are chosen
+// by ext. Extractors that are not TypedExtractors only read files with their
+// own extension.
+func (c *ChainExtractor) ExtractMetadataAs(filePath, ext string) (*Metadata, error) {
+	var fallback *Metadata
+	var lastErr error
+
+	for _, e := range c.extractors {
+		if !supportsAs(e, filePath, ext) {
+			continue
+		}
+
+		meta, err := extractMetadataAs(e, filePath, ext)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if meta.Source == DateSourceFileModTime {
+			if fallback == nil {
+				fallback = meta
+			}
+			continue
+		}
+		if fallback != nil && meta.CameraModel == "" {
+			meta.CameraMake, meta.CameraModel = fallback.CameraMake, fallback.CameraModel
+		}
+		return meta, nil
+	}
+
+	if fallback != nil {
+		return fallback, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("file type not supported by extractor: %s", filePath)
+}
+
+// SupportsFile reports whether any chained extractor supports the file.
+func (c *ChainExtractor) SupportsFile(filePath string) bool {
+	for _, e := range c.extractors {
+		if e.SupportsFile(filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsExtension reports whether any chained TypedExtractor supports files
+// with extension ext.
+func (c *ChainExtractor) SupportsExtension(ext string) bool {
+	for _, e := range c.extractors {
+		if typed, ok := e.(TypedExtractor); ok && typed.SupportsExtension(ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPriority returns the highest priority among the chained extractors.
+func (c *ChainExtractor) GetPriority() int {
+	if len(c.extractors) == 0 {
+		return 0
+	}
+	return c.extractors[0].GetPriority()
+}
+
+// GetExtractors returns the chained extractors in priority order.
+func (c *ChainExtractor) GetExtractors() []DateExtractor {
+	return c.extractors
+}
+
+// supportsAs reports whether e supports a file at filePath with content of
+// the type of extension ext.
+func supportsAs(e DateExtractor, filePath, ext string) bool {
+	if typed, ok := e.(TypedExtractor); ok {
+		return typed.SupportsExtension(ext)
+	}
+	return strings.EqualFold(filepath.Ext(filePath), ext) && e.SupportsFile(filePath)
+}
+
+// extractMetadataAs calls ExtractMetadataAs if the extractor supports it, or
+// extractMetadata otherwise.
+func extractMetadataAs(e DateExtractor, filePath, ext string) (*Metadata, error) {
+	if typed, ok := e.(TypedExtractor); ok {
+		return typed.ExtractMetadataAs(filePath, ext)
+	}
+	return extractMetadata(e, filePath)
+}
+
+// extractMetadata calls ExtractMetadata if the extractor supports it, or wraps ExtractDate otherwise.
+func extractMetadata(e DateExtractor, filePath string) (*Metadata, error) {
+	if me, ok := e.(MetadataExtractor); ok {
+		return me.ExtractMetadata(filePath)
+	}
+	date, err := e.ExtractDate(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{Date: *date}, nil
+}
@@ -33,7 +33,23 @@ func NewEXIFExtractor(logger *logrus.Logger) *EXIFExtractor {
 // ExtractDate returns the date from an image file using EXIF metadata.
 // If EXIF data is not available, it falls back to the file modification time.
 func (e *EXIFExtractor) ExtractDate(filePath string) (*time.Time, error) {
-	if !e.SupportsFile(filePath) {
+	meta, err := e.ExtractMetadata(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &meta.Date, nil
+}
+
+// ExtractMetadata returns the date and camera fields from an image file using a single EXIF read.
+// If EXIF data is not available, the date falls back to the file modification time.
+func (e *EXIFExtractor) ExtractMetadata(filePath string) (*Metadata, error) {
+	return e.ExtractMetadataAs(filePath, filepath.Ext(filePath))
+}
+
+// ExtractMetadataAs is ExtractMetadata for a file whose content is of the type
+// extension ext stands for.
+func (e *EXIFExtractor) ExtractMetadataAs(filePath, ext string) (*Metadata, error) {
+	if !e.SupportsExtension(ext) {
 		return nil, fmt.Errorf("file type not supported by extractor: %s", filePath)
 	}
 
@@ -42,29 +58,37 @@ func (e *EXIFExtractor) ExtractDate(filePath string) (*time.Time, error) {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	if cachedDate := e.getCachedDateWithInfo(filePath, fileInfo); cachedDate != nil {
+	if cached := e.getCachedMetadataWithInfo(filePath, fileInfo); cached != nil {
 		e.incrementCacheHits()
-		return cachedDate, nil
+		return cached, nil
 	}
 
 	e.incrementCacheMisses()
 
-	if date, err := e.extractWithGoExif(filePath); err == nil && date != nil {
-		e.cacheDateWithInfo(filePath, fileInfo, date)
-		return date, nil
+	if meta, err := e.extractWithGoExif(filePath); err == nil && meta != nil {
+		e.cacheMetadataWithInfo(filePath, fileInfo, meta)
+		return meta, nil
 	}
 
-	modTime := fileInfo.ModTime()
-	e.cacheDateWithInfo(filePath, fileInfo, &modTime)
-	return &modTime, nil
+	meta := &Metadata{
+		Date:   fileInfo.ModTime(),
+		Source: DateSourceFileModTime,
+	}
+	e.cacheMetadataWithInfo(filePath, fileInfo, meta)
+	return meta, nil
 }
 
 // SupportsFile reports whether the file is supported by this extractor.
 func (e *EXIFExtractor) SupportsFile(filePath string) bool {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	supportedExts := []string{".jpg", ".jpeg", ".png", ".tiff", ".tif", ".cr2", ".nef", ".arw", ".dng", ".raw"}
+	return e.SupportsExtension(filepath.Ext(filePath))
+}
 
-	return slices.Contains(supportedExts, ext)
+// SupportsExtension reports whether files with extension ext are supported
+// by this extractor.
+func (e *EXIFExtractor) SupportsExtension(ext string) bool {
+	supportedExts := []string{".jpg", ".jpeg", ".png", ".tiff", ".tif", ".cr2", ".nef", ".arw", ".dng", ".raw", ".heic", ".heif", ".thm"}
+
+	return slices.Contains(supportedExts, strings.ToLower(ext))
 }
 
 // GetPriority returns the priority of this extractor.
@@ -92,8 +116,8 @@ func (e *EXIFExtractor) GetCacheStats() CacheStats {
 	return stats
 }
 
-// extractWithGoExif extracts the date using the rwcarlsen/goexif library.
-func (e *EXIFExtractor) extractWithGoExif(filePath string) (*time.Time, error) {
+// extractWithGoExif extracts the date and camera fields using the rwcarlsen/goexif library.
+func (e *EXIFExtractor) extractWithGoExif(filePath string) (*Metadata, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
@@ -105,32 +129,48 @@ func (e *EXIFExtractor) extractWithGoExif(filePath string) (*time.Time, error) {
 		return nil, fmt.Errorf("failed to decode EXIF: %w", err)
 	}
 
+	meta := &Metadata{
+		CameraMake:  e.getStringTag(x, exif.Make),
+		CameraModel: e.getStringTag(x, exif.Model),
+	}
+
 	if tm, err := x.DateTime(); err == nil {
 		e.logger.Debugf("Extracted DateTime from EXIF: %v for file %s", tm, filePath)
-		return &tm, nil
+		meta.Date = tm
+		meta.Source = DateSourceEXIFDateTime
+		return meta, nil
 	}
 
-	if field, err := x.Get(exif.DateTimeOriginal); err == nil {
-		if dateStr, err := field.StringVal(); err == nil {
-			if date := e.parseEXIFDateTime(dateStr); date != nil {
-				e.logger.Debugf("Extracted DateTimeOriginal from EXIF: %v for file %s", date, filePath)
-				return date, nil
-			}
-		}
+	if date := e.parseEXIFDateTime(e.getStringTag(x, exif.DateTimeOriginal)); date != nil {
+		e.logger.Debugf("Extracted DateTimeOriginal from EXIF: %v for file %s", date, filePath)
+		meta.Date = *date
+		meta.Source = DateSourceEXIFDateTimeOriginal
+		return meta, nil
 	}
 
-	if field, err := x.Get(exif.DateTimeDigitized); err == nil {
-		if dateStr, err := field.StringVal(); err == nil {
-			if date := e.parseEXIFDateTime(dateStr); date != nil {
-				e.logger.Debugf("Extracted DateTimeDigitized from EXIF: %v for file %s", date, filePath)
-				return date, nil
-			}
-		}
+	if date := e.parseEXIFDateTime(e.getStringTag(x, exif.DateTimeDigitized)); date != nil {
+		e.logger.Debugf("Extracted DateTimeDigitized from EXIF: %v for file %s", date, filePath)
+		meta.Date = *date
+		meta.Source = DateSourceEXIFDateTimeDigitized
+		return meta, nil
 	}
 
 	return nil, fmt.Errorf("no valid date found in EXIF using goexif")
 }
 
+// getStringTag returns the trimmed string value of an EXIF tag, or "" if it is missing.
+func (e *EXIFExtractor) getStringTag(x *exif.Exif, name exif.FieldName) string {
+	field, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := field.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
 // parseEXIFDateTime parses an EXIF date time string and returns a time.Time pointer.
 // Returns nil if parsing fails.
 func (e *EXIFExtractor) parseEXIFDateTime(dateStr string) *time.Time {
@@ -162,25 +202,25 @@ func (e *EXIFExtractor) getCacheKey(filePath string, fileInfo os.FileInfo) strin
 	return fmt.Sprintf("%s:%d:%d", filePath, fileInfo.Size(), fileInfo.ModTime().Unix())
 }
 
-// getCachedDateWithInfo returns the cached date for the given file path and file info, or nil if not found.
-func (e *EXIFExtractor) getCachedDateWithInfo(filePath string, fileInfo os.FileInfo) *time.Time {
+// getCachedMetadataWithInfo returns the cached metadata for the given file path and file info, or nil if not found.
+func (e *EXIFExtractor) getCachedMetadataWithInfo(filePath string, fileInfo os.FileInfo) *Metadata {
 	key := e.getCacheKey(filePath, fileInfo)
 	if value, ok := e.cache.Load(key); ok {
-		if date, ok := value.(time.Time); ok {
-			return &date
+		if meta, ok := value.(Metadata); ok {
+			return &meta
 		}
 	}
 	return nil
 }
 
-// cacheDateWithInfo stores the date in the cache for the given file path and file info.
-func (e *EXIFExtractor) cacheDateWithInfo(filePath string, fileInfo os.FileInfo, date *time.Time) {
-	if date == nil {
+// cacheMetadataWithInfo stores the metadata in the cache for the given file path and file info.
+func (e *EXIFExtractor) cacheMetadataWithInfo(filePath string, fileInfo os.FileInfo, meta *Metadata) {
+	if meta == nil {
 		return
 	}
 
 	key := e.getCacheKey(filePath, fileInfo)
-	e.cache.Store(key, *date)
+	e.cache.Store(key, *meta)
 }
 
 // incrementCacheHits increments the cache hit counter.
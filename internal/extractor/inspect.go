@@ -0,0 +1,175 @@
+package extractor
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"time"
+
+	// Decoders for the dimensions of files without EXIF.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/sirupsen/logrus"
+)
+
+// DateCandidate is a date one source offers for a file.
+type DateCandidate struct {
+	Source DateSource
+	Date   *time.Time // nil if the source has no usable date
+	Raw    string     // the value as stored, e.g. the EXIF string or Takeout timestamp
+	Error  string     // why the source has no date, if it is known
+}
+
+// Inspection is the diagnostic breakdown of a file's metadata: every date
+// candidate and the one the extractor chain picks, with the main EXIF tags.
+type Inspection struct {
+	Candidates  []DateCandidate // in the order the chain considers them
+	Selected    *Metadata       // nil if no date was found
+	TakeoutJSON string          // path of the Takeout JSON sidecar, or ""
+	HasEXIF     bool
+	CameraMake  string
+	CameraModel string
+	Orientation int // EXIF orientation, 1-8, or 0 if unknown
+	HasGPS      bool
+	Width       int // pixel dimensions, or 0 if unknown
+	Height      int
+}
+
+// Inspect returns the breakdown of the dates c could extract from filePath and
+// which one it would use. Unlike ExtractMetadata it reads every source, bypassing
+// the EXIF cache, so it is meant for single files rather than whole trees.
+func (c *ChainExtractor) Inspect(filePath string) (*Inspection, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", filePath)
+	}
+
+	ins := &Inspection{}
+	ins.Candidates = append(ins.Candidates, inspectEXIF(filePath, ins)...)
+
+	takeout := DateCandidate{Source: DateSourceTakeoutJSON}
+	ins.TakeoutJSON = FindTakeoutJSON(filePath)
+	if ins.TakeoutJSON == "" {
+		takeout.Error = "no Takeout JSON sidecar"
+	} else if meta, err := extractMetadata(&TakeoutJSONExtractor{logger: discardLogger()}, filePath); err != nil {
+		takeout.Raw = ins.TakeoutJSON
+		takeout.Error = err.Error()
+	} else {
+		takeout.Raw = ins.TakeoutJSON
+		takeout.Date = &meta.Date
+	}
+	ins.Candidates = append(ins.Candidates, takeout)
+
+	modTime := info.ModTime()
+	ins.Candidates = append(ins.Candidates, DateCandidate{
+		Source: DateSourceFileModTime,
+		Date:   &modTime,
+		Raw:    modTime.Format(time.RFC3339),
+	})
+
+	if ins.Width == 0 || ins.Height == 0 {
+		if f, err := os.Open(filePath); err == nil {
+			if cfg, _, err := image.DecodeConfig(f); err == nil {
+				ins.Width, ins.Height = cfg.Width, cfg.Height
+			}
+			f.Close()
+		}
+	}
+
+	if c.SupportsFile(filePath) {
+		if meta, err := c.ExtractMetadata(filePath); err == nil {
+			ins.Selected = meta
+		}
+	}
+	return ins, nil
+}
+
+// inspectEXIF returns the EXIF date candidates of filePath and fills in the
+// EXIF tags of ins.
+func inspectEXIF(filePath string, ins *Inspection) []DateCandidate {
+	candidates := []DateCandidate{
+		{Source: DateSourceEXIFDateTime},
+		{Source: DateSourceEXIFDateTimeOriginal},
+		{Source: DateSourceEXIFDateTimeDigitized},
+	}
+	fail := func(reason string) []DateCandidate {
+		for i := range candidates {
+			candidates[i].Error = reason
+		}
+		return candidates
+	}
+
+	e := NewEXIFExtractor(discardLogger())
+	if !e.SupportsFile(filePath) {
+		return fail("file type has no EXIF metadata")
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fail(err.Error())
+	}
+	defer f.Close()
+	x, err := exif.Decode(f)
+	if err != nil {
+		return fail("no EXIF metadata: " + err.Error())
+	}
+
+	ins.HasEXIF = true
+	ins.CameraMake = e.getStringTag(x, exif.Make)
+	ins.CameraModel = e.getStringTag(x, exif.Model)
+	ins.Orientation = intTag(x, exif.Orientation)
+	ins.Width = intTag(x, exif.PixelXDimension)
+	ins.Height = intTag(x, exif.PixelYDimension)
+	_, _, gpsErr := x.LatLong()
+	ins.HasGPS = gpsErr == nil
+
+	tags := []exif.FieldName{exif.DateTime, exif.DateTimeOriginal, exif.DateTimeDigitized}
+	for i, tag := range tags {
+		raw := e.getStringTag(x, tag)
+		candidates[i].Raw = raw
+		switch date := e.parseEXIFDateTime(raw); {
+		case raw == "":
+			candidates[i].Error = "tag not present"
+		case date == nil:
+			candidates[i].Error = "unparseable date"
+		default:
+			candidates[i].Date = date
+		}
+	}
+	// The chain's EXIF DateTime is goexif's Exif.DateTime, which prefers
+	// DateTimeOriginal and applies the camera's time zone if it is known.
+	if dt, err := x.DateTime(); err == nil {
+		candidates[0].Date, candidates[0].Error = &dt, ""
+		if original := candidates[1].Raw; original != "" {
+			candidates[0].Raw = original
+		}
+	}
+	return candidates
+}
+
+// discardLogger returns a logger that drops everything, for extractors whose
+// debug output is not wanted.
+func discardLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+// intTag returns the first integer value of an EXIF tag, or 0 if it is missing.
+func intTag(x *exif.Exif, name exif.FieldName) int {
+	field, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	value, err := field.Int(0)
+	if err != nil {
+		return 0
+	}
+	return value
+}
@@ -1,6 +1,7 @@
 package extractor
 
 import (
+	"strings"
 	"time"
 )
 
@@ -11,6 +12,19 @@ type DateExtractor interface {
 	GetPriority() int
 }
 
+// MetadataExtractor is implemented by extractors that can return camera
+// information alongside the date from a single metadata read.
+type MetadataExtractor interface {
+	ExtractMetadata(filePath string) (*Metadata, error)
+}
+
+// TypedExtractor is implemented by extractors that can read a file whose
+// extension does not match its content, as a file with extension ext.
+type TypedExtractor interface {
+	SupportsExtension(ext string) bool
+	ExtractMetadataAs(filePath, ext string) (*Metadata, error)
+}
+
 // CachedDateExtractor extends DateExtractor with caching capabilities.
 type CachedDateExtractor interface {
 	DateExtractor
@@ -58,6 +72,7 @@ const (
 	DateSourceThumbnail
 	DateSourceFileModTime
 	DateSourceFileName
+	DateSourceTakeoutJSON
 )
 
 // ExtractedDate contains the extracted date and its source.
@@ -67,6 +82,29 @@ type ExtractedDate struct {
 	Raw    string
 }
 
+// Metadata contains the date and camera fields extracted from a file.
+type Metadata struct {
+	Date        time.Time
+	Source      DateSource
+	CameraMake  string
+	CameraModel string
+}
+
+// Camera returns a display name for the camera, e.g. "Canon EOS R6".
+// The make is omitted when the model already starts with it.
+func (m *Metadata) Camera() string {
+	model := strings.TrimSpace(m.CameraModel)
+	cameraMake := strings.TrimSpace(m.CameraMake)
+	switch {
+	case model == "":
+		return cameraMake
+	case cameraMake == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(cameraMake)):
+		return model
+	default:
+		return cameraMake + " " + model
+	}
+}
+
 // String returns a human-readable description of the date source.
 func (ds DateSource) String() string {
 	switch ds {
@@ -84,6 +122,8 @@ func (ds DateSource) String() string {
 		return "File Modification Time"
 	case DateSourceFileName:
 		return "File Name"
+	case DateSourceTakeoutJSON:
+		return "Google Takeout JSON"
 	default:
 		return "Unknown"
 	}
@@ -0,0 +1,168 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// takeoutMaxNameLength is the length Google Takeout truncates JSON sidecar names to,
+// not counting the ".json" suffix.
+const takeoutMaxNameLength = 46
+
+// takeoutDuplicatePattern matches the "(1)" counter Takeout adds to duplicate file names.
+var takeoutDuplicatePattern = regexp.MustCompile(`^(.*)(\(\d+\))$`)
+
+// TakeoutJSONExtractor extracts dates from the JSON metadata files that
+// Google Takeout exports next to each photo and video.
+type TakeoutJSONExtractor struct {
+	logger *logrus.Logger
+}
+
+// takeoutMetadata is the subset of a Takeout JSON file used for date extraction.
+type takeoutMetadata struct {
+	PhotoTakenTime struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"photoTakenTime"`
+	CreationTime struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"creationTime"`
+}
+
+// NewTakeoutJSONExtractor returns a new TakeoutJSONExtractor.
+func NewTakeoutJSONExtractor(logger *logrus.Logger) *TakeoutJSONExtractor {
+	return &TakeoutJSONExtractor{logger: logger}
+}
+
+// ExtractDate returns the photoTakenTime from the file's Takeout JSON metadata.
+func (t *TakeoutJSONExtractor) ExtractDate(filePath string) (*time.Time, error) {
+	meta, err := t.ExtractMetadata(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &meta.Date, nil
+}
+
+// ExtractMetadata returns the photoTakenTime from the file's Takeout JSON metadata.
+func (t *TakeoutJSONExtractor) ExtractMetadata(filePath string) (*Metadata, error) {
+	jsonPath := FindTakeoutJSON(filePath)
+	if jsonPath == "" {
+		return nil, fmt.Errorf("no Takeout JSON metadata found for %s", filePath)
+	}
+
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Takeout JSON: %w", err)
+	}
+
+	var tm takeoutMetadata
+	if err := json.Unmarshal(data, &tm); err != nil {
+		return nil, fmt.Errorf("failed to parse Takeout JSON %s: %w", jsonPath, err)
+	}
+
+	timestamp := tm.PhotoTakenTime.Timestamp
+	if timestamp == "" {
+		return nil, fmt.Errorf("no photoTakenTime in Takeout JSON %s", jsonPath)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || seconds <= 0 {
+		return nil, fmt.Errorf("invalid photoTakenTime %q in %s", timestamp, jsonPath)
+	}
+
+	date := time.Unix(seconds, 0)
+	t.logger.Debugf("Extracted photoTakenTime from Takeout JSON %s: %v for file %s", jsonPath, date, filePath)
+	return &Metadata{Date: date, Source: DateSourceTakeoutJSON}, nil
+}
+
+// SupportsFile reports whether the file can have Takeout JSON metadata.
+func (t *TakeoutJSONExtractor) SupportsFile(filePath string) bool {
+	return t.SupportsExtension(filepath.Ext(filePath))
+}
+
+// SupportsExtension reports whether files with extension ext can have
+// Takeout JSON metadata.
+func (t *TakeoutJSONExtractor) SupportsExtension(ext string) bool {
+	return !strings.EqualFold(ext, ".json")
+}
+
+// ExtractMetadataAs is ExtractMetadata; the metadata file is found by the
+// file's own name whatever its content.
+func (t *TakeoutJSONExtractor) ExtractMetadataAs(filePath, ext string) (*Metadata, error) {
+	return t.ExtractMetadata(filePath)
+}
+
+// GetPriority returns the priority of this extractor.
+func (t *TakeoutJSONExtractor) GetPriority() int {
+	return 50
+}
+
+// FindTakeoutJSON returns the path of the Takeout JSON metadata file for a media file,
+// or "" if there is none. It accounts for Takeout's naming quirks: names truncated to
+// 46 characters, "(n)" duplicate counters moved after the extension, "-edited" copies
+// sharing the original's JSON, and the newer ".supplemental-metadata" suffix.
+func FindTakeoutJSON(filePath string) string {
+	for _, candidate := range takeoutJSONCandidates(filePath) {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// takeoutJSONCandidates returns possible Takeout JSON paths for a media file, most specific first.
+func takeoutJSONCandidates(filePath string) []string {
+	dir := filepath.Dir(filePath)
+	base := filepath.Base(filePath)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	counter := ""
+	if m := takeoutDuplicatePattern.FindStringSubmatch(stem); m != nil {
+		stem, counter = m[1], m[2]
+	}
+
+	stems := []string{stem}
+	if edited := strings.TrimSuffix(stem, "-edited"); edited != stem {
+		stems = append(stems, edited)
+	}
+
+	var names []string
+	for _, s := range stems {
+		names = append(names,
+			truncateTakeoutName(s+ext+".supplemental-metadata")+counter,
+			truncateTakeoutName(s+ext)+counter,
+			truncateTakeoutName(s)+counter,
+		)
+		if counter != "" {
+			names = append(names, truncateTakeoutName(s+counter+ext), truncateTakeoutName(s+counter))
+		}
+	}
+
+	seen := make(map[string]bool, len(names))
+	candidates := make([]string, 0, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		candidates = append(candidates, filepath.Join(dir, name+".json"))
+	}
+	return candidates
+}
+
+// truncateTakeoutName truncates a name the way Takeout does for JSON sidecars.
+func truncateTakeoutName(name string) string {
+	runes := []rune(name)
+	if len(runes) > takeoutMaxNameLength {
+		return string(runes[:takeoutMaxNameLength])
+	}
+	return name
+}
@@ -0,0 +1,176 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTakeoutJSONCandidates(t *testing.T) {
+	long := strings.Repeat("a", 50)
+	tests := []struct {
+		name string
+		file string
+		want []string // candidates that must be offered, in this order
+	}{
+		{
+			name: "plain",
+			file: "IMG_0001.jpg",
+			want: []string{"IMG_0001.jpg.supplemental-metadata.json", "IMG_0001.jpg.json", "IMG_0001.json"},
+		},
+		{
+			name: "truncated to 46 characters",
+			file: long + ".jpg",
+			want: []string{long[:46] + ".json"},
+		},
+		{
+			name: "duplicate counter after the extension",
+			file: "IMG(1).jpg",
+			want: []string{"IMG.jpg(1).json", "IMG(1).json"},
+		},
+		{
+			name: "edited copy falls back to the original",
+			file: "IMG_0001-edited.jpg",
+			want: []string{"IMG_0001-edited.jpg.json", "IMG_0001.jpg.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, candidate := range takeoutJSONCandidates(filepath.Join("dir", tt.file)) {
+				if filepath.Dir(candidate) != "dir" {
+					t.Errorf("candidate %s is not next to the file", candidate)
+				}
+				names = append(names, filepath.Base(candidate))
+			}
+			last := -1
+			for _, want := range tt.want {
+				i := slices.Index(names, want)
+				if i < 0 {
+					t.Fatalf("candidates %q lack %q", names, want)
+				}
+				if i < last {
+					t.Errorf("candidates %q offer %q too early", names, want)
+				}
+				last = i
+			}
+			for _, name := range names {
+				if stem := strings.TrimSuffix(name, ".json"); len(stem) > takeoutMaxNameLength {
+					t.Errorf("candidate %q is longer than Takeout names", name)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateTakeoutName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "IMG_0001.jpg", want: "IMG_0001.jpg"},
+		{name: strings.Repeat("a", 46), want: strings.Repeat("a", 46)},
+		{name: strings.Repeat("a", 47), want: strings.Repeat("a", 46)},
+		// Takeout counts characters, not bytes.
+		{name: strings.Repeat("é", 50), want: strings.Repeat("é", 46)},
+	}
+	for _, tt := range tests {
+		if got := truncateTakeoutName(tt.name); got != tt.want {
+			t.Errorf("truncateTakeoutName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTakeoutDateRanking(t *testing.T) {
+	exifDate := time.Date(2003, 11, 23, 14, 5, 6, 0, time.Local) // EXIF dates have no zone
+	takeoutDate := time.Date(2010, 6, 1, 12, 0, 0, 0, time.UTC)
+	takeoutJSON := fmt.Sprintf(`{"photoTakenTime": {"timestamp": "%d"}}`, takeoutDate.Unix())
+
+	tests := []struct {
+		name     string
+		exif     bool
+		takeout  bool
+		want     DateSource
+		wantDate time.Time
+	}{
+		{name: "exif over takeout", exif: true, takeout: true, want: DateSourceEXIFDateTime, wantDate: exifDate},
+		{name: "takeout over mod time", takeout: true, want: DateSourceTakeoutJSON, wantDate: takeoutDate},
+		{name: "mod time last", want: DateSourceFileModTime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			photo := filepath.Join(dir, "IMG_0001.jpg")
+			data := []byte("not a JPEG")
+			if tt.exif {
+				data = jpegWithEXIFDate(exifDate)
+			}
+			if err := os.WriteFile(photo, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.takeout {
+				if err := os.WriteFile(photo+".json", []byte(takeoutJSON), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			meta, err := NewDefaultExtractor(logger).ExtractMetadata(photo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Source != tt.want {
+				t.Errorf("source = %s, want %s", meta.Source, tt.want)
+			}
+			if !tt.wantDate.IsZero() && !meta.Date.Equal(tt.wantDate) {
+				t.Errorf("date = %s, want %s", meta.Date, tt.wantDate)
+			}
+		})
+	}
+}
+
+// jpegWithEXIFDate returns the start of a JPEG whose EXIF DateTimeOriginal
+// is date: enough for the EXIF extractor, which reads no further.
+func jpegWithEXIFDate(date time.Time) []byte {
+	const (
+		ifd0Offset     = 8
+		exifIFDOffset  = ifd0Offset + 2 + 12 + 4
+		dateOffset     = exifIFDOffset + 2 + 12 + 4
+		tagExifIFD     = 0x8769
+		tagDateTimeOrg = 0x9003
+		typeASCII      = 2
+		typeLong       = 4
+	)
+	value := append([]byte(date.Format("2006:01:02 15:04:05")), 0)
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(ifd0Offset))
+	entry := func(tag, typ uint16, count, valueOrOffset uint32) {
+		binary.Write(&tiff, binary.BigEndian, uint16(1)) // one entry per IFD
+		binary.Write(&tiff, binary.BigEndian, tag)
+		binary.Write(&tiff, binary.BigEndian, typ)
+		binary.Write(&tiff, binary.BigEndian, count)
+		binary.Write(&tiff, binary.BigEndian, valueOrOffset)
+		binary.Write(&tiff, binary.BigEndian, uint32(0)) // no next IFD
+	}
+	entry(tagExifIFD, typeLong, 1, exifIFDOffset)
+	entry(tagDateTimeOrg, typeASCII, uint32(len(value)), dateOffset)
+	tiff.Write(value)
+
+	segment := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[4:], uint16(2+6+tiff.Len()))
+	segment = append(segment, "Exif\x00\x00"...)
+	return append(segment, tiff.Bytes()...)
+}
@@ -0,0 +1,166 @@
+// Package filetype recognizes media files by their first bytes, for files
+// whose extension does not match their content.
+package filetype
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// headerSize is how many bytes Detect reads: enough for every signature,
+// including the second sync byte of an MPEG transport stream packet.
+const headerSize = 512
+
+// Type is a file type recognized by its content.
+type Type struct {
+	Name string // e.g. "JPEG"
+
+	// Extension is the usual extension of files of the type, and Extensions
+	// all those they may have.
+	Extension  string
+	Extensions []string
+
+	Video bool
+}
+
+// tiffRaw lists the RAW formats stored as TIFF files, which can only be
+// told apart from TIFF images by their extension.
+var tiffRaw = []string{".nef", ".nrw", ".arw", ".srf", ".sr2", ".dng", ".raw", ".pef", ".srw", ".3fr", ".erf", ".kdc", ".dcr", ".mos", ".mef", ".iiq"}
+
+// isoMedia lists the extensions of files in the ISO base media format, which
+// MP4, QuickTime and 3GP videos share.
+var isoMedia = []string{".mp4", ".m4v", ".mov", ".qt", ".3gp", ".3g2"}
+
+// The recognized types.
+var (
+	JPEG = &Type{Name: "JPEG", Extension: ".jpg", Extensions: []string{".jpg", ".jpeg", ".jpe", ".jfif", ".thm"}}
+	PNG  = &Type{Name: "PNG", Extension: ".png", Extensions: []string{".png"}}
+	GIF  = &Type{Name: "GIF", Extension: ".gif", Extensions: []string{".gif"}}
+	WebP = &Type{Name: "WebP", Extension: ".webp", Extensions: []string{".webp"}}
+	TIFF = &Type{Name: "TIFF", Extension: ".tif", Extensions: append([]string{".tif", ".tiff"}, tiffRaw...)}
+	CR2  = &Type{Name: "CR2", Extension: ".cr2", Extensions: []string{".cr2"}}
+	CR3  = &Type{Name: "CR3", Extension: ".cr3", Extensions: []string{".cr3"}}
+	ORF  = &Type{Name: "ORF", Extension: ".orf", Extensions: []string{".orf"}}
+	RW2  = &Type{Name: "RW2", Extension: ".rw2", Extensions: []string{".rw2", ".raw"}}
+	RAF  = &Type{Name: "RAF", Extension: ".raf", Extensions: []string{".raf"}}
+	HEIC = &Type{Name: "HEIC", Extension: ".heic", Extensions: []string{".heic", ".heif", ".hif"}}
+	AVIF = &Type{Name: "AVIF", Extension: ".avif", Extensions: []string{".avif"}}
+
+	MP4     = &Type{Name: "MP4", Extension: ".mp4", Extensions: isoMedia, Video: true}
+	MOV     = &Type{Name: "QuickTime", Extension: ".mov", Extensions: isoMedia, Video: true}
+	ThreeGP = &Type{Name: "3GP", Extension: ".3gp", Extensions: isoMedia, Video: true}
+	AVI     = &Type{Name: "AVI", Extension: ".avi", Extensions: []string{".avi"}, Video: true}
+	MKV     = &Type{Name: "Matroska", Extension: ".mkv", Extensions: []string{".mkv", ".webm", ".mk3d"}, Video: true}
+	MPEG    = &Type{Name: "MPEG", Extension: ".mpg", Extensions: []string{".mpg", ".mpeg", ".mpe", ".m2v", ".vob", ".mod", ".tod"}, Video: true}
+	MTS     = &Type{Name: "MPEG-TS", Extension: ".mts", Extensions: []string{".mts", ".m2ts", ".m2t", ".ts"}, Video: true}
+)
+
+// Matches reports whether ext is an extension files of type t may have.
+func (t *Type) Matches(ext string) bool {
+	return slices.Contains(t.Extensions, strings.ToLower(ext))
+}
+
+// Detect returns the type of the file at path, read from its first bytes,
+// or nil if it is not recognized.
+func Detect(path string) (*Type, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return Sniff(header[:n]), nil
+}
+
+// Sniff returns the type of a file starting with header, or nil if it is
+// not recognized.
+func Sniff(header []byte) *Type {
+	at := func(offset int, signature string) bool {
+		return len(header) >= offset+len(signature) && string(header[offset:offset+len(signature)]) == signature
+	}
+	switch {
+	case at(0, "\xff\xd8\xff"):
+		return JPEG
+	case at(0, "\x89PNG\r\n\x1a\n"):
+		return PNG
+	case at(0, "GIF87a"), at(0, "GIF89a"):
+		return GIF
+	case at(0, "RIFF") && at(8, "WEBP"):
+		return WebP
+	case at(0, "RIFF") && at(8, "AVI "):
+		return AVI
+	case at(0, "II*\x00") && at(8, "CR"):
+		return CR2
+	case at(0, "II*\x00"), at(0, "MM\x00*"):
+		return TIFF
+	case at(0, "IIRO"), at(0, "IIRS"), at(0, "MMOR"):
+		return ORF
+	case at(0, "IIU\x00"):
+		return RW2
+	case at(0, "FUJIFILMCCD-RAW"):
+		return RAF
+	case at(4, "ftyp"):
+		return isoMediaType(header)
+	case at(4, "moov"), at(4, "mdat"), at(4, "wide"), at(4, "free"), at(4, "skip"), at(4, "pnot"):
+		return MOV
+	case at(0, "\x1a\x45\xdf\xa3"):
+		return MKV
+	case at(0, "\x00\x00\x01\xba"), at(0, "\x00\x00\x01\xb3"):
+		return MPEG
+	case at(0, "G") && at(188, "G"), at(4, "G") && at(196, "G"):
+		return MTS
+	}
+	return nil
+}
+
+// isoMediaType returns the type of an ISO base media file by the brands of
+// its ftyp box: HEIC and AVIF images, CR3 RAW files and videos.
+func isoMediaType(header []byte) *Type {
+	if len(header) < 12 {
+		return MP4
+	}
+	size := int(header[0])<<24 | int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+	if size < 16 || size > len(header) {
+		size = len(header)
+	}
+	major := string(header[8:12])
+	// The compatible brands follow the major brand and its version.
+	brands := [][]byte{header[8:12]}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, header[i:i+4])
+	}
+	has := func(names ...string) bool {
+		for _, brand := range brands {
+			for _, name := range names {
+				if bytes.Equal(brand, []byte(name)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch {
+	case major == "crx ":
+		return CR3
+	case has("heic", "heix", "hevc", "hevx", "heim", "heis"):
+		return HEIC
+	case has("avif", "avis"):
+		return AVIF
+	case has("mif1", "msf1"):
+		return HEIC
+	case major == "qt  ":
+		return MOV
+	case strings.HasPrefix(major, "3g"):
+		return ThreeGP
+	}
+	return MP4
+}
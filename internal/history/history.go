@@ -0,0 +1,267 @@
+// Package history keeps a summary of every run on disk, one JSON file per
+// run, so that past runs can be listed after the process that ran them has
+// exited.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"photo-sorter-go/internal/compressor"
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/statistics"
+)
+
+// ErrNotFound is returned by Get for a run that is not in the history.
+var ErrNotFound = errors.New("run not found in history")
+
+// Record is the summary of one run.
+type Record struct {
+	ID         string              `json:"id"`
+	Kind       string              `json:"kind"` // organize, scan, plan, apply or compress
+	DryRun     bool                `json:"dry_run"`
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	Sources    []string            `json:"sources"`
+	Target     string              `json:"target"`
+	User       string              `json:"user,omitempty"` // who started a web job
+	Params     any                 `json:"params,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	Stats      statistics.Snapshot `json:"stats"`
+}
+
+// Mode describes the kind of run, e.g. "organize (dry run)".
+func (r Record) Mode() string {
+	if r.DryRun && r.Kind != "scan" && r.Kind != "plan" {
+		return r.Kind + " (dry run)"
+	}
+	return r.Kind
+}
+
+// Organized returns the files the run organized, or compressed; dry runs
+// count the files they would have.
+func (r Record) Organized() int64 {
+	if r.Kind == "compress" {
+		return r.Stats.Counters["files_compressed"]
+	}
+	return r.Stats.Counters["files_organized"]
+}
+
+// Errors returns the files the run failed on.
+func (r Record) Errors() int64 {
+	return r.Stats.Counters["files_with_errors"]
+}
+
+// Duration returns how long the run took.
+func (r Record) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// CompressionStats returns the statistics of a compression run with summary,
+// under the counter names of the organize statistics where they match.
+func CompressionStats(summary compressor.CompressionSummary, dryRun bool, started, finished time.Time) statistics.Snapshot {
+	return statistics.Snapshot{
+		Kind:            "compress",
+		DryRun:          dryRun,
+		StartTime:       started,
+		DurationSeconds: finished.Sub(started).Seconds(),
+		Counters: map[string]int64{
+			"total_files_found":          int64(summary.TotalFiles),
+			"files_compressed":           int64(summary.Compressed),
+			"files_skipped":              int64(summary.Skipped),
+			"files_cached":               int64(summary.Cached),
+			"files_with_errors":          int64(summary.Errors),
+			"bytes_saved_by_compression": summary.BytesSaved,
+		},
+		ErrorCategories: map[string]int64{},
+	}
+}
+
+// OpenConfigured returns the store of the history configured in cfg.
+func OpenConfigured(cfg *config.Config) (*Store, error) {
+	dir, err := cfg.GetHistoryDirectory()
+	if err != nil {
+		return nil, err
+	}
+	return Open(dir), nil
+}
+
+// Save adds rec to the history configured in cfg, if it is enabled, and
+// removes the oldest runs beyond history.max_runs. Relative directories of
+// rec are made absolute.
+func Save(cfg *config.Config, rec *Record) error {
+	if !cfg.History.Enabled {
+		return nil
+	}
+	for i, dir := range rec.Sources {
+		rec.Sources[i] = absPath(dir)
+	}
+	rec.Target = absPath(rec.Target)
+	store, err := OpenConfigured(cfg)
+	if err != nil {
+		return err
+	}
+	if err := store.Write(rec); err != nil {
+		return err
+	}
+	if cfg.History.MaxRuns > 0 {
+		if _, err := store.Prune(cfg.History.MaxRuns, time.Time{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Store is a directory of run records.
+type Store struct {
+	dir string
+}
+
+// Open returns the store in dir, which is created by the first Write.
+func Open(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Write adds rec to the history, setting its ID from its start time and
+// kind. The record is written to a temporary file first, so that a crash
+// cannot leave a partial record under its name.
+func (s *Store) Write(rec *Record) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	base := rec.StartedAt.Format("20060102-150405") + "-" + rec.Kind
+	rec.ID = base
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(s.path(rec.ID)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		rec.ID = base + "-" + strconv.Itoa(n)
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run record: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, ".run-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write run record: %w", err)
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(rec.ID))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write run record: %w", err)
+	}
+	return nil
+}
+
+// List returns the runs in the history, newest first. Files that cannot be
+// read or decoded are left out and returned as warnings.
+func (s *Store) List() ([]Record, []error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Record{}, nil
+	}
+	if err != nil {
+		return []Record{}, []error{fmt.Errorf("failed to read history directory: %w", err)}
+	}
+
+	records := []Record{}
+	var warnings []error
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		rec, err := s.read(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("skipping %w", err))
+			continue
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].StartedAt.Equal(records[j].StartedAt) {
+			return records[i].StartedAt.After(records[j].StartedAt)
+		}
+		return records[i].ID > records[j].ID
+	})
+	return records, warnings
+}
+
+// Get returns the run with id.
+func (s *Store) Get(id string) (Record, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return Record{}, ErrNotFound
+	}
+	if _, err := os.Stat(s.path(id)); errors.Is(err, os.ErrNotExist) {
+		return Record{}, ErrNotFound
+	}
+	return s.read(id)
+}
+
+// Prune removes the runs beyond the keep newest, 0 for no limit, and those
+// that started before olderThan, unless it is zero. It returns how many
+// were removed.
+func (s *Store) Prune(keep int, olderThan time.Time) (int, error) {
+	records, _ := s.List() // unreadable files are left alone
+	removed := 0
+	for i, rec := range records {
+		if (keep > 0 && i >= keep) || (!olderThan.IsZero() && rec.StartedAt.Before(olderThan)) {
+			if err := os.Remove(s.path(rec.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return removed, fmt.Errorf("failed to remove run %s: %w", rec.ID, err)
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// read decodes the record with id.
+func (s *Store) read(id string) (Record, error) {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return Record{}, fmt.Errorf("run %s: %w", id, err)
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, fmt.Errorf("run %s: corrupt record: %w", id, err)
+	}
+	if rec.ID != id || rec.StartedAt.IsZero() {
+		return Record{}, fmt.Errorf("run %s: incomplete record", id)
+	}
+	return rec, nil
+}
+
+// absPath returns path made absolute, or path if it is empty or cannot be.
+func absPath(path string) string {
+	if path == "" {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// path returns the file of the run with id.
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Console formats, selected with logging.console_format.
+const (
+	ConsoleFormatText = "text"
+	ConsoleFormatJSON = "json"
+)
+
+// levelColors are the ANSI colors of the level names on the console.
+var levelColors = map[logrus.Level]int{
+	logrus.TraceLevel: 90, // gray
+	logrus.DebugLevel: 90,
+	logrus.InfoLevel:  36, // cyan
+	logrus.WarnLevel:  33, // yellow
+	logrus.ErrorLevel: 31, // red
+	logrus.FatalLevel: 31,
+	logrus.PanicLevel: 31,
+}
+
+// consoleFormatter writes entries as concise lines for people, such as
+// "14:03:07 WARN  Could not extract date file=IMG_1.jpg", the level colored
+// if color is set.
+type consoleFormatter struct {
+	color bool
+}
+
+// Format returns the line of entry.
+func (f *consoleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(entry.Time.Format("15:04:05"))
+	b.WriteByte(' ')
+	level := fmt.Sprintf("%-5s", strings.ToUpper(levelName(entry.Level)))
+	if f.color {
+		fmt.Fprintf(&b, "\x1b[%dm%s\x1b[0m", levelColors[entry.Level], level)
+	} else {
+		b.WriteString(level)
+	}
+	b.WriteByte(' ')
+	b.WriteString(strings.TrimRight(entry.Message, "\n"))
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := fmt.Sprint(entry.Data[key])
+		if strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// levelName returns the name of level, "warn" rather than "warning" to keep
+// the lines aligned.
+func levelName(level logrus.Level) string {
+	if level == logrus.WarnLevel {
+		return "warn"
+	}
+	return level.String()
+}
+
+// colorEnabled reports whether the console lines written to file are
+// colored: when it is a terminal and NO_COLOR (https://no-color.org) is not set.
+func colorEnabled(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -18,10 +19,20 @@ type LoggerConfig struct {
 	MaxAge     int    // Maximum number of days to retain old log files
 	Compress   bool   // Whether to compress rotated log files
 	Console    bool   // Whether to also log to the console
+
+	// ConsoleFormat is the format of the console lines: "text", concise
+	// lines colored on terminals, or "json" like the file. Empty is "text".
+	ConsoleFormat string
+
+	// SampleRepeats is how many times the same warning is logged before its
+	// repeats are only counted and summarized now and then. 0 logs every
+	// warning; other levels are always logged.
+	SampleRepeats int
 }
 
 // NewLogger returns a new logrus.Logger configured according to the provided LoggerConfig.
-// The logger supports log rotation and structured JSON output.
+// The logger supports log rotation; the file gets structured JSON output and
+// the console the format of ConsoleFormat.
 func NewLogger(config LoggerConfig) (*logrus.Logger, error) {
 	logger := logrus.New()
 
@@ -31,47 +42,63 @@ func NewLogger(config LoggerConfig) (*logrus.Logger, error) {
 	}
 	logger.SetLevel(level)
 
-	logger.SetFormatter(&logrus.JSONFormatter{
-		TimestampFormat: "2006-01-02 15:04:05",
-		FieldMap: logrus.FieldMap{
-			logrus.FieldKeyTime:  "timestamp",
-			logrus.FieldKeyLevel: "level",
-			logrus.FieldKeyMsg:   "message",
-			logrus.FieldKeyFunc:  "function",
-		},
-	})
-
-	var writers []io.Writer
+	var console logrus.Formatter
+	switch config.ConsoleFormat {
+	case "", ConsoleFormatText:
+		console = &consoleFormatter{color: colorEnabled(os.Stdout)}
+	case ConsoleFormatJSON:
+		console = jsonFormatter()
+	default:
+		return nil, fmt.Errorf("invalid console format: %s (valid: text, json)", config.ConsoleFormat)
+	}
 
+	var fileWriter io.Writer
 	if config.FilePath != "" {
 		dir := filepath.Dir(config.FilePath)
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, err
 		}
 
-		fileWriter := &lumberjack.Logger{
+		fileWriter = &lumberjack.Logger{
 			Filename:   config.FilePath,
 			MaxSize:    config.MaxSize,
 			MaxBackups: config.MaxBackups,
 			MaxAge:     config.MaxAge,
 			Compress:   config.Compress,
 		}
-		writers = append(writers, fileWriter)
 	}
 
-	if config.Console || config.FilePath == "" {
-		writers = append(writers, os.Stdout)
+	output := &outputHook{}
+	if fileWriter != nil {
+		output.sinks = append(output.sinks, sink{writer: fileWriter, formatter: jsonFormatter()})
 	}
-
-	if len(writers) > 1 {
-		logger.SetOutput(io.MultiWriter(writers...))
-	} else if len(writers) == 1 {
-		logger.SetOutput(writers[0])
+	if fileWriter == nil || config.Console {
+		output.sinks = append(output.sinks, sink{writer: os.Stdout, formatter: console})
 	}
+	if config.SampleRepeats > 0 {
+		output.sampler = newSampler(config.SampleRepeats)
+	}
+	// The hook writes every line; the logger itself writes nothing.
+	logger.SetOutput(io.Discard)
+	logger.SetFormatter(discardFormatter{})
+	logger.AddHook(output)
 
 	return logger, nil
 }
 
+// jsonFormatter returns the formatter of the log file.
+func jsonFormatter() logrus.Formatter {
+	return &logrus.JSONFormatter{
+		TimestampFormat: "2006-01-02 15:04:05",
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyTime:  "timestamp",
+			logrus.FieldKeyLevel: "level",
+			logrus.FieldKeyMsg:   "message",
+			logrus.FieldKeyFunc:  "function",
+		},
+	}
+}
+
 // WithFields returns a logger entry with the specified fields.
 func WithFields(logger *logrus.Logger, fields logrus.Fields) *logrus.Entry {
 	return logger.WithFields(fields)
@@ -105,5 +132,7 @@ func DefaultConfig() LoggerConfig {
 		MaxAge:     30,
 		Compress:   true,
 		Console:    true,
+
+		ConsoleFormat: ConsoleFormatText,
 	}
 }
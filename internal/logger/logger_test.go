@@ -0,0 +1,169 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newCapturedLogger returns a logger made by NewLogger from config, with the
+// log file in a temporary directory, and the paths of that file and of the
+// file that takes the place of the console.
+func newCapturedLogger(t *testing.T, config LoggerConfig) (*logrus.Logger, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	config.FilePath = filepath.Join(dir, "photo-sorter.log")
+
+	consolePath := filepath.Join(dir, "console.log")
+	console, err := os.Create(consolePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = console
+	log, err := NewLogger(config)
+	os.Stdout = stdout
+	if err != nil {
+		console.Close()
+		t.Fatalf("NewLogger: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, s := range outputOf(log).sinks {
+			if closer, ok := s.writer.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	})
+	return log, config.FilePath, consolePath
+}
+
+// readLines returns the non-empty lines of the file at path.
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// assertJSONLine checks that line is the JSON of the warning logged by the
+// tests.
+func assertJSONLine(t *testing.T, sink, line string) {
+	t.Helper()
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		t.Fatalf("%s line %q is not JSON: %v", sink, line, err)
+	}
+	want := map[string]string{
+		"message": "Could not extract date",
+		"level":   "warning",
+		"file":    "IMG_1.jpg",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s line %s = %v, want %q", sink, key, fields[key], value)
+		}
+	}
+	if _, ok := fields["timestamp"]; !ok {
+		t.Errorf("%s line %q has no timestamp", sink, line)
+	}
+}
+
+func TestEachSinkGetsItsFormat(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+
+	for _, format := range []string{"", ConsoleFormatText, ConsoleFormatJSON} {
+		t.Run("console="+format, func(t *testing.T) {
+			log, filePath, consolePath := newCapturedLogger(t, LoggerConfig{
+				Level:         "info",
+				Console:       true,
+				ConsoleFormat: format,
+			})
+			WithFile(log, "IMG_1.jpg").Warn("Could not extract date")
+
+			fileLines := readLines(t, filePath)
+			if len(fileLines) != 1 {
+				t.Fatalf("log file has %d lines, want 1: %q", len(fileLines), fileLines)
+			}
+			assertJSONLine(t, "file", fileLines[0])
+
+			consoleLines := readLines(t, consolePath)
+			if len(consoleLines) != 1 {
+				t.Fatalf("console has %d lines, want 1: %q", len(consoleLines), consoleLines)
+			}
+			line := consoleLines[0]
+			if format == ConsoleFormatJSON {
+				assertJSONLine(t, "console", line)
+				return
+			}
+			if json.Valid([]byte(line)) {
+				t.Fatalf("console line %q is JSON, want text", line)
+			}
+			// The console is not a terminal, so the level is not colored.
+			if strings.Contains(line, "\x1b[") {
+				t.Errorf("console line %q is colored", line)
+			}
+			if want := " WARN  Could not extract date file=IMG_1.jpg"; !strings.HasSuffix(line, want) {
+				t.Errorf("console line = %q, want it to end with %q", line, want)
+			}
+		})
+	}
+}
+
+func TestConsoleOnlyWithoutFile(t *testing.T) {
+	log, filePath, consolePath := newCapturedLogger(t, LoggerConfig{Level: "info"})
+	// Without Console, the file is the only sink.
+	log.Info("Organized 3 files")
+
+	if lines := readLines(t, consolePath); len(lines) != 0 {
+		t.Errorf("console got %q, want nothing", lines)
+	}
+	if lines := readLines(t, filePath); len(lines) != 1 {
+		t.Errorf("log file has %d lines, want 1: %q", len(lines), lines)
+	}
+}
+
+func TestConsoleColor(t *testing.T) {
+	entry := &logrus.Entry{Level: logrus.ErrorLevel, Message: "Failed to copy"}
+
+	colored, err := (&consoleFormatter{color: true}).Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(colored, []byte("\x1b[31mERROR\x1b[0m")) {
+		t.Errorf("colored line = %q, want the level in red", colored)
+	}
+
+	plain, err := (&consoleFormatter{}).Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(plain, []byte("\x1b[")) {
+		t.Errorf("plain line = %q, want no color", plain)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if colorEnabled(os.Stdout) {
+		t.Error("colorEnabled with NO_COLOR set = true, want false")
+	}
+}
+
+func TestInvalidConsoleFormat(t *testing.T) {
+	_, err := NewLogger(LoggerConfig{Level: "info", ConsoleFormat: "xml"})
+	if err == nil || !strings.Contains(err.Error(), "invalid console format: xml") {
+		t.Fatalf("NewLogger error = %v, want an invalid console format", err)
+	}
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sink is a writer log lines go to, with the formatter of its lines.
+type sink struct {
+	writer    io.Writer
+	formatter logrus.Formatter
+}
+
+// outputHook writes the entries of a logger to its sinks, each with its own
+// formatter, so that the console and the log file get different formats.
+// With a sampler, repeats of the same message beyond its limit are left out.
+// The logger itself writes nothing.
+type outputHook struct {
+	sinks   []sink
+	sampler *sampler   // nil logs every entry
+	mu      sync.Mutex // hooks are fired concurrently
+}
+
+// Levels returns the levels the hook receives: all the logger logs.
+func (h *outputHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire writes entry to the sinks, unless the sampler suppresses it, and the
+// summary of the repeats of its message when one is due.
+func (h *outputHook) Fire(entry *logrus.Entry) error {
+	if h.sampler == nil {
+		return h.write(entry)
+	}
+	logged, summary := h.sampler.admit(entry)
+	if logged {
+		if err := h.write(entry); err != nil {
+			return err
+		}
+	}
+	if summary != nil {
+		return h.write(summary)
+	}
+	return nil
+}
+
+// write formats entry for every sink and writes it there.
+func (h *outputHook) write(entry *logrus.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.sinks {
+		line, err := s.formatter.Format(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := s.writer.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardFormatter is the formatter of a logger whose hook writes its lines:
+// it formats nothing, so that the logger does no work of its own.
+type discardFormatter struct{}
+
+// Format returns no line.
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// outputOf returns the outputHook of log, or nil if it was not made by
+// NewLogger.
+func outputOf(log *logrus.Logger) *outputHook {
+	if log == nil {
+		return nil
+	}
+	for _, hook := range log.Hooks[logrus.InfoLevel] {
+		if output, ok := hook.(*outputHook); ok {
+			return output
+		}
+	}
+	return nil
+}
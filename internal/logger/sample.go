@@ -0,0 +1,207 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// repeatSummaryInterval is how often the repeats of a message that go on
+// being suppressed are summarized.
+const repeatSummaryInterval = time.Minute
+
+// Patterns of the parts of messages that differ between repeats of the same
+// message: words with a path separator and numbers.
+var (
+	pathWordPattern = regexp.MustCompile(`[^\s'"]*[/\\][^\s'":,;]*`)
+	numberPattern   = regexp.MustCompile(`\d+`)
+)
+
+// Repeat is a message of which repeats were suppressed.
+type Repeat struct {
+	Message    string // with paths replaced by "*" and numbers by "#"
+	Operation  string // the operation field of the entries, if any
+	Level      logrus.Level
+	Count      int64 // all occurrences
+	Suppressed int64 // occurrences not logged
+}
+
+// repeatKey tells repeats of a message apart from other messages.
+type repeatKey struct {
+	template  string
+	operation string
+}
+
+// repeatState counts the occurrences of a message.
+type repeatState struct {
+	Repeat
+	pending     int64     // suppressed since the last summary
+	lastSummary time.Time // or the first suppression
+}
+
+// sampler logs the first limit occurrences of each warning and suppresses
+// the rest, summarizing them now and then. Other levels are never suppressed:
+// errors must all be seen, and info and debug lines are what a dry run or
+// --verbose is asked for.
+type sampler struct {
+	limit   int64
+	mu      sync.Mutex
+	repeats map[repeatKey]*repeatState
+}
+
+// newSampler returns a sampler logging limit occurrences of each message.
+func newSampler(limit int) *sampler {
+	return &sampler{limit: int64(limit), repeats: make(map[repeatKey]*repeatState)}
+}
+
+// messageTemplate returns message without the parts that differ between
+// repeats, such as the paths of the files a warning is about.
+func messageTemplate(message string) string {
+	return numberPattern.ReplaceAllString(pathWordPattern.ReplaceAllString(message, "*"), "#")
+}
+
+// admit reports whether entry is logged, and returns the summary of the
+// suppressed repeats of its message if one is due.
+func (s *sampler) admit(entry *logrus.Entry) (bool, *logrus.Entry) {
+	if entry.Level != logrus.WarnLevel {
+		return true, nil
+	}
+	operation, _ := entry.Data["operation"].(string)
+	key := repeatKey{template: messageTemplate(entry.Message), operation: operation}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.repeats[key]
+	if !ok {
+		state = &repeatState{Repeat: Repeat{Message: key.template, Operation: operation, Level: entry.Level}}
+		s.repeats[key] = state
+	}
+	state.Count++
+	if state.Count <= s.limit {
+		return true, nil
+	}
+	state.Suppressed++
+	state.pending++
+	if state.pending == 1 && state.lastSummary.IsZero() {
+		state.lastSummary = entry.Time
+	}
+	if entry.Time.Sub(state.lastSummary) < repeatSummaryInterval {
+		return false, nil
+	}
+	return false, state.summary(entry.Logger, entry.Time)
+}
+
+// flush returns the summaries of the messages suppressed since their last
+// one.
+func (s *sampler) flush(logger *logrus.Logger) []*logrus.Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var summaries []*logrus.Entry
+	for _, state := range s.sorted() {
+		if state.pending > 0 {
+			summaries = append(summaries, state.summary(logger, time.Now()))
+		}
+	}
+	return summaries
+}
+
+// suppressed returns the messages with suppressed repeats, the most
+// suppressed first.
+func (s *sampler) suppressed() []Repeat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var repeats []Repeat
+	for _, state := range s.sorted() {
+		if state.Suppressed > 0 {
+			repeats = append(repeats, state.Repeat)
+		}
+	}
+	sort.SliceStable(repeats, func(i, j int) bool { return repeats[i].Suppressed > repeats[j].Suppressed })
+	return repeats
+}
+
+// sorted returns the counted messages sorted by template and operation. The
+// caller holds s.mu.
+func (s *sampler) sorted() []*repeatState {
+	states := make([]*repeatState, 0, len(s.repeats))
+	for _, state := range s.repeats {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Message != states[j].Message {
+			return states[i].Message < states[j].Message
+		}
+		return states[i].Operation < states[j].Operation
+	})
+	return states
+}
+
+// summary returns the entry summarizing the repeats suppressed since the
+// last summary, and starts counting them anew.
+func (state *repeatState) summary(logger *logrus.Logger, now time.Time) *logrus.Entry {
+	fields := logrus.Fields{"repeats": state.pending}
+	if state.Operation != "" {
+		fields["operation"] = state.Operation
+	}
+	entry := logrus.NewEntry(logger).WithFields(fields)
+	entry.Level = state.Level
+	entry.Time = now
+	entry.Message = fmt.Sprintf("message %q repeated %s more times", state.Message, formatCount(state.pending))
+	state.pending, state.lastSummary = 0, now
+	return entry
+}
+
+// formatCount returns n with thousands separators, such as "4,812".
+func formatCount(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	var out []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, digits[i])
+	}
+	return string(out)
+}
+
+// FlushRepeats logs the summaries of the messages of log suppressed since
+// their last one, so that a run ends with all repeats accounted for.
+func FlushRepeats(log *logrus.Logger) {
+	output := outputOf(log)
+	if output == nil || output.sampler == nil {
+		return
+	}
+	for _, summary := range output.sampler.flush(log) {
+		_ = output.write(summary) // the log is written on a best-effort basis
+	}
+}
+
+// SuppressedRepeats returns the messages of log of which repeats were not
+// logged, the most suppressed first.
+func SuppressedRepeats(log *logrus.Logger) []Repeat {
+	output := outputOf(log)
+	if output == nil || output.sampler == nil {
+		return nil
+	}
+	return output.sampler.suppressed()
+}
+
+// RepeatSummary returns a formatted list of the messages of log of which
+// repeats were not logged, or "" if none were.
+func RepeatSummary(log *logrus.Logger) string {
+	repeats := SuppressedRepeats(log)
+	if len(repeats) == 0 {
+		return ""
+	}
+	result := "Repeated Log Messages (not all logged):\n"
+	for _, repeat := range repeats {
+		result += fmt.Sprintf("  %s: %s of %s suppressed  %s\n",
+			levelName(repeat.Level), formatCount(repeat.Suppressed), formatCount(repeat.Count), repeat.Message)
+	}
+	return result
+}
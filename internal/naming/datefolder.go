@@ -0,0 +1,247 @@
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateTokens lists the tokens of date folder templates, with the pattern of
+// the text each stands for.
+var dateTokens = map[string]string{
+	"year":       `\d{4}`,
+	"month":      `0[1-9]|1[0-2]`,
+	"month_name": `January|February|March|April|May|June|July|August|September|October|November|December`,
+	"day":        `0[1-9]|[12]\d|3[01]`,
+	"week":       `0[1-9]|[1-4]\d|5[0-3]`,
+	"week_year":  `\d{4}`,
+	"quarter":    `[1-4]`,
+}
+
+// dateTokenNames are the date tokens in the order error messages list them.
+var dateTokenNames = []string{"year", "month", "month_name", "day", "week", "week_year", "quarter"}
+
+// dateTokenPattern matches the tokens of a date folder template, {camera}
+// included.
+var dateTokenPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// DateLayout is a compiled date_format: a template of tokens such as
+// "{year}/{month}", or a Go time layout such as "2006/01". A {camera} token
+// is kept in the folders it formats, for the caller to replace.
+type DateLayout struct {
+	format   string
+	template bool
+	segments []dateSegment // of a template
+}
+
+// dateSegment is a token of a template, or the literal text between tokens.
+type dateSegment struct {
+	token   string
+	literal string
+}
+
+// IsDateTemplate reports whether format is a template of date tokens rather
+// than a Go time layout: whether it has a token other than {camera}.
+func IsDateTemplate(format string) bool {
+	for _, match := range dateTokenPattern.FindAllStringSubmatch(format, -1) {
+		if match[1] != "camera" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDateLayout compiles a date_format. Templates may only use the date
+// tokens and {camera}, and Go layouts only date elements, not times of day.
+func ParseDateLayout(format string) (DateLayout, error) {
+	if !IsDateTemplate(format) {
+		if element := timeOfDayElement(strings.ReplaceAll(format, "{camera}", "")); element != "" {
+			return DateLayout{}, fmt.Errorf("%q in %s is a time of day, not a date (2006 = year, 01 = month, 02 = day)", element, format)
+		}
+		return DateLayout{format: format}, nil
+	}
+
+	layout := DateLayout{format: format, template: true}
+	literal := func(text string) error {
+		if strings.ContainsAny(text, "{}") {
+			return fmt.Errorf("unbalanced braces in %s", format)
+		}
+		if text != "" {
+			layout.segments = append(layout.segments, dateSegment{literal: text})
+		}
+		return nil
+	}
+	end := 0
+	for _, loc := range dateTokenPattern.FindAllStringSubmatchIndex(format, -1) {
+		if err := literal(format[end:loc[0]]); err != nil {
+			return DateLayout{}, err
+		}
+		end = loc[1]
+		switch token := format[loc[2]:loc[3]]; {
+		case token == "camera":
+			layout.segments = append(layout.segments, dateSegment{literal: "{camera}"})
+		case dateTokens[token] != "":
+			layout.segments = append(layout.segments, dateSegment{token: token})
+		default:
+			return DateLayout{}, fmt.Errorf("unknown token {%s} (valid: {%s}, {camera})", token, strings.Join(dateTokenNames, "}, {"))
+		}
+	}
+	if err := literal(format[end:]); err != nil {
+		return DateLayout{}, err
+	}
+	return layout, nil
+}
+
+// String returns the date_format the layout was compiled from.
+func (l DateLayout) String() string {
+	return l.format
+}
+
+// IsTemplate reports whether the layout is a template of date tokens.
+func (l DateLayout) IsTemplate() bool {
+	return l.template
+}
+
+// Format returns the folders of t.
+func (l DateLayout) Format(t time.Time) string {
+	if !l.template {
+		return t.Format(l.format)
+	}
+	var b strings.Builder
+	for _, segment := range l.segments {
+		if segment.token == "" {
+			b.WriteString(segment.literal)
+			continue
+		}
+		b.WriteString(formatDateToken(segment.token, t))
+	}
+	return b.String()
+}
+
+// formatDateToken returns the text token stands for on the date t.
+func formatDateToken(token string, t time.Time) string {
+	switch token {
+	case "year":
+		return t.Format("2006")
+	case "month":
+		return t.Format("01")
+	case "month_name":
+		return t.Format("January")
+	case "day":
+		return t.Format("02")
+	case "week":
+		_, week := t.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	case "week_year":
+		year, _ := t.ISOWeek()
+		return strconv.Itoa(year)
+	case "quarter":
+		return strconv.Itoa((int(t.Month())-1)/3 + 1)
+	}
+	return ""
+}
+
+// MatchesFolders reports whether parts, path components, are the leading
+// folders of a date the layout formats, e.g. "2023" or "2023/07" for
+// "{year}/{month}/{day}". Folders with the camera are never matched.
+func (l DateLayout) MatchesFolders(parts []string) bool {
+	layout := strings.Split(l.format, "/")
+	if len(parts) > len(layout) {
+		return false
+	}
+	for i, part := range parts {
+		if strings.Contains(layout[i], "{camera}") {
+			return false
+		}
+		if !l.template {
+			if _, err := time.Parse(layout[i], part); err != nil {
+				return false
+			}
+			continue
+		}
+		var pattern strings.Builder
+		end := 0
+		for _, loc := range dateTokenPattern.FindAllStringSubmatchIndex(layout[i], -1) {
+			pattern.WriteString(regexp.QuoteMeta(layout[i][end:loc[0]]))
+			pattern.WriteString("(?:" + dateTokens[layout[i][loc[2]:loc[3]]] + ")")
+			end = loc[1]
+		}
+		pattern.WriteString(regexp.QuoteMeta(layout[i][end:]))
+		if ok, _ := regexp.MatchString("^"+pattern.String()+"$", part); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// HasDate reports whether the folders the layout formats depend on the date.
+func (l DateLayout) HasDate() bool {
+	first := time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC)
+	return l.Format(first) != l.Format(first.AddDate(-1, -6, -9))
+}
+
+// Collision returns two dates the layout puts in the same folder although a
+// date between them is put in another one, such as the same month of two
+// years when the layout has no year. ok is false if there are none: each
+// folder holds one day, week, month, quarter or year.
+func (l DateLayout) Collision() (first, second time.Time, ok bool) {
+	last := make(map[string]time.Time) // folder -> last day seen in it
+	start := time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var previous string
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		folder := l.Format(day)
+		if seen, ok := last[folder]; ok && folder != previous {
+			return seen, day, true
+		}
+		last[folder], previous = day, folder
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// layoutElements are the elements of Go time layouts, an element before
+// the shorter ones it starts with, and whether they stand for a time of day
+// or a time zone. "_2006" is an underscore followed by the year.
+var layoutElements = []struct {
+	text string
+	time bool
+}{
+	{"January", false}, {"Jan", false}, {"Monday", false}, {"Mon", false}, {"MST", true},
+	{"2006", false}, {"002", false}, {"__2", false}, {"_2006", false}, {"_2", false},
+	{"01", false}, {"02", false}, {"06", false}, {"03", true}, {"04", true}, {"05", true}, {"15", true},
+	{"1", false}, {"2", false}, {"3", true}, {"4", true}, {"5", true},
+	{"PM", true}, {"pm", true}, {"-07", true}, {"Z07", true},
+}
+
+// timeOfDayElement returns the first element of the Go time layout that
+// stands for a time of day or a time zone, or "" if there is none. It reads
+// the layout as the time package does.
+func timeOfDayElement(layout string) string {
+	for i := 0; i < len(layout); i++ {
+		rest := layout[i:]
+		if rest[0] == '.' || rest[0] == ',' {
+			// Fractional seconds, unless the zeros or nines are followed
+			// by another digit.
+			j := 1
+			for j < len(rest) && (rest[j] == '0' || rest[j] == '9') && rest[j] == rest[1] {
+				j++
+			}
+			if j > 1 && (j == len(rest) || rest[j] < '0' || rest[j] > '9') {
+				return rest[:j]
+			}
+			continue
+		}
+		for _, element := range layoutElements {
+			if strings.HasPrefix(rest, element.text) {
+				if element.time {
+					return element.text
+				}
+				i += len(element.text) - 1
+				break
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package naming_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/naming"
+)
+
+func TestDateLayoutFormat(t *testing.T) {
+	// A Sunday, so that its ISO week belongs to the year before.
+	date := time.Date(2023, 1, 1, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		format   string
+		template bool
+		want     string
+	}{
+		{format: "{year}/{month}/{day}", template: true, want: "2023/01/01"},
+		{format: "{year}/{month_name}", template: true, want: "2023/January"},
+		{format: "{week_year}/W{week}", template: true, want: "2022/W52"},
+		{format: "{year}/Q{quarter}", template: true, want: "2023/Q1"},
+		{format: "{camera}/{year}", template: true, want: "{camera}/2023"},
+		// Go layouts are used as they are.
+		{format: "2006/01", want: "2023/01"},
+		{format: "2006-01-02", want: "2023-01-01"},
+		{format: "2006/Jan", want: "2023/Jan"},
+		{format: "{camera}/2006", want: "{camera}/2023"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			layout, err := naming.ParseDateLayout(tt.format)
+			if err != nil {
+				t.Fatalf("ParseDateLayout: %v", err)
+			}
+			if layout.IsTemplate() != tt.template {
+				t.Errorf("IsTemplate = %v, want %v", layout.IsTemplate(), tt.template)
+			}
+			if got := layout.Format(date); got != tt.want {
+				t.Errorf("Format = %q, want %q", got, tt.want)
+			}
+			if layout.String() != tt.format {
+				t.Errorf("String = %q, want %q", layout.String(), tt.format)
+			}
+		})
+	}
+}
+
+func TestParseDateLayoutErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "{year}/{hour}", want: "unknown token {hour}"},
+		{format: "{year}/{Month}", want: "unbalanced braces"},
+		{format: "{year}/{month", want: "unbalanced braces"},
+		{format: "2006/01/15", want: `"15" in 2006/01/15 is a time of day`},
+		{format: "2006-01-02 MST", want: `"MST"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			_, err := naming.ParseDateLayout(tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseDateLayout error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateLayoutCollision(t *testing.T) {
+	tests := []struct {
+		format    string
+		collision bool
+	}{
+		{format: "{year}/{month}/{day}"},
+		{format: "{year}/Q{quarter}"},
+		{format: "{week_year}/{week}"},
+		{format: "2006/01"},
+		{format: "{month}/{day}", collision: true},
+		{format: "{year}/{week}", collision: true},
+		{format: "01", collision: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			layout, err := naming.ParseDateLayout(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			first, second, ok := layout.Collision()
+			if ok != tt.collision {
+				t.Fatalf("Collision = %v (%s and %s), want %v", ok, first, second, tt.collision)
+			}
+			if ok && layout.Format(first) != layout.Format(second) {
+				t.Errorf("Collision returned %s and %s, in different folders", first, second)
+			}
+		})
+	}
+}
+
+func TestDateCollisionsNeedOverride(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DateFormat = "{month}/{day}"
+	err := cfg.ValidateStructure()
+	if err == nil || !strings.Contains(err.Error(), "allow_date_collisions") {
+		t.Fatalf("ValidateStructure = %v, want a date collision", err)
+	}
+
+	cfg.AllowDateCollisions = true
+	if err := cfg.ValidateStructure(); err != nil {
+		t.Fatalf("ValidateStructure with allow_date_collisions = %v, want nil", err)
+	}
+}
@@ -0,0 +1,120 @@
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FilenameVars holds the values substituted into a filename template.
+type FilenameVars struct {
+	Date     time.Time
+	Original string // Original file name without extension
+	Ext      string // Original extension including the leading dot
+	Counter  int64
+	Camera   string
+}
+
+// tokenPattern matches template tokens such as {date} or {original}.
+var tokenPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// supportedTokens lists the tokens accepted in filename templates.
+var supportedTokens = map[string]bool{
+	"date":     true,
+	"time":     true,
+	"original": true,
+	"ext":      true,
+	"counter":  true,
+	"camera":   true,
+}
+
+// DefaultCameraName is used for {camera} when the file has no camera metadata.
+const DefaultCameraName = "unknown-camera"
+
+// ValidateFilenameTemplate checks that a filename template only uses supported tokens
+// and cannot expand to a path outside the target directory.
+func ValidateFilenameTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+
+	for _, match := range tokenPattern.FindAllStringSubmatch(tmpl, -1) {
+		if !supportedTokens[match[1]] {
+			return fmt.Errorf("unknown token {%s} (valid: {date}, {time}, {original}, {ext}, {counter}, {camera})", match[1])
+		}
+	}
+
+	if rest := tokenPattern.ReplaceAllString(tmpl, ""); strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("unbalanced braces in template: %s", tmpl)
+	}
+
+	if strings.ContainsAny(tmpl, `/\`) {
+		return fmt.Errorf("template must not contain path separators: %s", tmpl)
+	}
+
+	return nil
+}
+
+// ExpandFilenameTemplate returns the file name produced by applying vars to tmpl.
+// If the template has no {ext} token, the original extension is appended.
+func ExpandFilenameTemplate(tmpl string, vars FilenameVars) string {
+	camera := SanitizeComponent(vars.Camera)
+	if camera == "" {
+		camera = DefaultCameraName
+	}
+
+	name := tokenPattern.ReplaceAllStringFunc(tmpl, func(token string) string {
+		switch token {
+		case "{date}":
+			return vars.Date.Format("2006-01-02")
+		case "{time}":
+			return vars.Date.Format("150405")
+		case "{original}":
+			return vars.Original
+		case "{ext}":
+			return strings.TrimPrefix(vars.Ext, ".")
+		case "{counter}":
+			return fmt.Sprintf("%04d", vars.Counter)
+		case "{camera}":
+			return camera
+		default:
+			return token
+		}
+	})
+
+	if !strings.Contains(tmpl, "{ext}") {
+		name += vars.Ext
+	}
+	return name
+}
+
+// ExampleFilename returns an example expansion of tmpl for display purposes.
+func ExampleFilename(tmpl string) string {
+	return ExpandFilenameTemplate(tmpl, FilenameVars{
+		Date:     time.Date(2023, 7, 14, 15, 30, 45, 0, time.UTC),
+		Original: "IMG_1234",
+		Ext:      ".jpg",
+		Counter:  1,
+		Camera:   "Canon EOS R6",
+	})
+}
+
+// SanitizeComponent makes a metadata value safe to use as a single path component.
+func SanitizeComponent(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "." || value == ".." {
+		return ""
+	}
+	return value
+}
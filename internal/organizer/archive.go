@@ -0,0 +1,257 @@
+package organizer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"photo-sorter-go/internal/config"
+)
+
+// archiveOutput writes organized files into a tar or zip archive instead of a
+// directory tree. Target paths below the archive's path become entry names, so
+// the archive holds the same structure the directory target would. Entries are
+// streamed one at a time; the archive is written under a temporary name and
+// only renamed into place once it is complete.
+type archiveOutput struct {
+	mu       sync.Mutex
+	root     string // the archive's path, the root of all target paths
+	file     *os.File
+	gzip     *gzip.Writer // for compressed tar archives
+	tar      *tar.Writer
+	zip      *zip.Writer
+	key      func(string) string // identifies an entry, folding case if needed
+	sources  map[string]string   // entry key -> file copied there
+	dirs     map[string]bool     // directory entries written
+	modified time.Time           // time stamp for directory entries
+
+	// failed is why the archive is broken: an entry was started but not
+	// completed, so the writer is mid-entry and nothing more can be added.
+	failed error
+	done   func() // ends tracking the temporary file, see trackTempFile
+}
+
+// newArchiveOutput starts writing an archive of the given format at path,
+// which must not exist yet.
+func newArchiveOutput(path, format string, key func(string) string) (*archiveOutput, error) {
+	if _, err := os.Lstat(path); err == nil {
+		return nil, fmt.Errorf("target archive already exists: %s", path)
+	}
+	file, err := os.OpenFile(path+tempSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create target archive: %w", err)
+	}
+
+	a := &archiveOutput{
+		root:     path,
+		file:     file,
+		done:     trackTempFile(file.Name()),
+		key:      key,
+		sources:  make(map[string]string),
+		dirs:     make(map[string]bool),
+		modified: time.Now(),
+	}
+	switch format {
+	case config.ArchiveFormatZip:
+		a.zip = zip.NewWriter(file)
+	case config.ArchiveFormatTarGz:
+		a.gzip = gzip.NewWriter(file)
+		a.tar = tar.NewWriter(a.gzip)
+	default:
+		a.tar = tar.NewWriter(file)
+	}
+	return a, nil
+}
+
+// entryName returns the archive entry name for a target path.
+func (a *archiveOutput) entryName(targetPath string) (string, error) {
+	rel, err := filepath.Rel(a.root, targetPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not inside the target archive", targetPath)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// exists reports whether an entry has been written for path.
+func (a *archiveOutput) exists(targetPath string) bool {
+	name, err := a.entryName(targetPath)
+	if err != nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.sources[a.key(name)]
+	return ok
+}
+
+// createDirectory writes entries for dir and those of its parents that have
+// none yet. Extracting works without them, but they keep directory listings
+// of the archive complete.
+func (a *archiveOutput) createDirectory(dir string) (bool, error) {
+	if filepath.Clean(dir) == filepath.Clean(a.root) {
+		return false, nil
+	}
+	name, err := a.entryName(dir)
+	if err != nil {
+		return false, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failed != nil {
+		return false, a.failed
+	}
+	var missing []string
+	for d := name; d != "." && !a.dirs[d]; d = path.Dir(d) {
+		missing = append(missing, d)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := a.writeDir(missing[i] + "/"); err != nil {
+			return false, a.fail(missing[i]+"/", err)
+		}
+		a.dirs[missing[i]] = true
+	}
+	return len(missing) > 0, nil
+}
+
+// writeDir writes a directory entry. The caller holds a.mu.
+func (a *archiveOutput) writeDir(name string) error {
+	if a.zip != nil {
+		header := &zip.FileHeader{Name: name, Modified: a.modified}
+		header.SetMode(os.ModeDir | 0755)
+		_, err := a.zip.CreateHeader(header)
+		return err
+	}
+	return a.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     0755,
+		ModTime:  a.modified,
+	})
+}
+
+// fail marks the archive as broken by the error err writing the entry name,
+// and returns the error. The caller holds a.mu.
+func (a *archiveOutput) fail(name string, err error) error {
+	a.failed = fmt.Errorf("archive entry %s is incomplete: %w", name, err)
+	return a.failed
+}
+
+// copyFile writes the contents of sourcePath as the entry for targetPath,
+// with the source's modification time and permissions. Once the entry is
+// started, an error breaks the archive: close then discards it.
+func (a *archiveOutput) copyFile(sourcePath, targetPath string) error {
+	name, err := a.entryName(targetPath)
+	if err != nil {
+		return err
+	}
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Entries are written one after the other, so a single writer at a time.
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failed != nil {
+		return a.failed
+	}
+	if a.zip != nil {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Method = zip.Store // photos and videos are already compressed
+		w, err := a.zip.CreateHeader(header)
+		if err != nil {
+			return a.fail(name, err)
+		}
+		if _, err := io.Copy(w, source); err != nil {
+			return a.fail(name, err)
+		}
+	} else {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if err := a.tar.WriteHeader(header); err != nil {
+			return a.fail(name, err)
+		}
+		if _, err := io.CopyN(a.tar, source, header.Size); err != nil {
+			return a.fail(name, err)
+		}
+	}
+	a.sources[a.key(name)] = sourcePath
+	return nil
+}
+
+// contentsPath returns the file that was copied to path, since entries cannot
+// be read back while the archive is being written.
+func (a *archiveOutput) contentsPath(targetPath string) string {
+	name, err := a.entryName(targetPath)
+	if err != nil {
+		return targetPath
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if source, ok := a.sources[a.key(name)]; ok {
+		return source
+	}
+	return targetPath
+}
+
+// close completes the archive and renames it into place. An archive without
+// any files is removed instead, e.g. when the run found nothing to organize,
+// and so is a broken one, whose error is returned.
+func (a *archiveOutput) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tempPath := a.file.Name()
+	defer a.done()
+	if a.failed != nil {
+		a.file.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("target archive discarded: %w", a.failed)
+	}
+	if len(a.sources) == 0 {
+		a.file.Close()
+		return os.Remove(tempPath)
+	}
+
+	var err error
+	if a.zip != nil {
+		err = a.zip.Close()
+	} else {
+		err = a.tar.Close()
+		if err == nil && a.gzip != nil {
+			err = a.gzip.Close()
+		}
+	}
+	if err == nil {
+		err = a.file.Sync()
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, a.root)
+}
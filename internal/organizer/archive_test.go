@@ -0,0 +1,183 @@
+package organizer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"photo-sorter-go/internal/config"
+)
+
+// readArchive returns the contents of the file entries of the archive at
+// path by entry name.
+func readArchive(t testing.TB, path string) map[string][]byte {
+	t.Helper()
+	entries := make(map[string][]byte)
+	if strings.HasSuffix(path, ".zip") {
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			t.Fatalf("open %s: %v", path, err)
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("read %s from %s: %v", f.Name, path, err)
+			}
+			entries[f.Name] = data
+		}
+		return entries
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".tar.gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read %s from %s: %v", header.Name, path, err)
+		}
+		entries[header.Name] = data
+	}
+}
+
+func TestOrganizeIntoArchive(t *testing.T) {
+	for _, name := range []string{"photos.tar", "photos.tar.gz", "photos.zip"} {
+		t.Run(name, func(t *testing.T) {
+			tree := newTestTree(t)
+			first := tree.photo("IMG_0001.jpg", testDate)
+			second := tree.photo("trip/IMG_0001.jpg", testDate)
+			sidecar := tree.file("trip/IMG_0001.xmp", []byte("<x:xmpmeta/>"))
+			want := make(map[string][]byte)
+			for entry, path := range map[string]string{
+				"2003/11/23/IMG_0001.jpg":   first,
+				"2003/11/23/IMG_0001_1.jpg": second,
+				"2003/11/23/IMG_0001_1.xmp": sidecar,
+			} {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want[entry] = data
+			}
+
+			cfg := tree.config()
+			archive := filepath.Join(tree.Target, name)
+			cfg.TargetDirectory = &archive
+			cfg.Processing.MoveFiles = false
+			// One worker places the photos in the order they are found, so
+			// the first keeps its name.
+			cfg.Performance.WorkerThreads = 1
+			stats := organize(t, cfg)
+
+			assertNoFile(t, archive+tempSuffix)
+			got := readArchive(t, archive)
+			if len(got) != len(want) {
+				t.Errorf("archive holds %d files, want %d", len(got), len(want))
+			}
+			for entry, data := range want {
+				if content, ok := got[entry]; !ok {
+					t.Errorf("archive has no entry %s", entry)
+				} else if !bytes.Equal(content, data) {
+					t.Errorf("entry %s holds %d bytes that differ from the %d expected", entry, len(content), len(data))
+				}
+			}
+			assertFile(t, first)
+			assertCount(t, "FilesOrganized", stats.FilesOrganized, 1)
+			assertCount(t, "ImageDuplicates.Renamed", stats.ImageDuplicates.Renamed, 1)
+		})
+	}
+}
+
+func TestArchiveEntryFailureDiscardsArchive(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		// fail makes copying the next entry fail after it is started and
+		// returns the source to copy.
+		fail func(t *testing.T, a *archiveOutput, dir string) string
+	}{
+		{
+			name:   "unreadable source",
+			format: config.ArchiveFormatZip,
+			fail: func(t *testing.T, a *archiveOutput, dir string) string {
+				// A directory opens and has a size, but reading it fails.
+				unreadable := filepath.Join(dir, "unreadable.jpg")
+				if err := os.Mkdir(unreadable, 0755); err != nil {
+					t.Fatal(err)
+				}
+				return unreadable
+			},
+		},
+		{
+			name:   "failing writer",
+			format: config.ArchiveFormatTar,
+			fail: func(t *testing.T, a *archiveOutput, dir string) string {
+				a.file.Close()
+				return filepath.Join(dir, "big.jpg")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := writeTestFile(t, filepath.Join(dir, "big.jpg"), bytes.Repeat([]byte{0xAB}, 1<<20))
+			root := filepath.Join(dir, "photos."+tt.format)
+			a, err := newArchiveOutput(root, tt.format, strings.ToLower)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := a.copyFile(source, filepath.Join(root, "2003/a.jpg")); err != nil {
+				t.Fatalf("first entry: %v", err)
+			}
+
+			broken := tt.fail(t, a, dir)
+			if err := a.copyFile(broken, filepath.Join(root, "2003/b.jpg")); err == nil {
+				t.Fatal("copying the failing entry succeeded")
+			}
+			if err := a.copyFile(source, filepath.Join(root, "2003/c.jpg")); err == nil {
+				t.Error("copying into a broken archive succeeded")
+			}
+			if err := a.close(); err == nil {
+				t.Error("closing a broken archive succeeded")
+			}
+			assertNoFile(t, root)
+			assertNoFile(t, root+tempSuffix)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package organizer
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time of a file; access times are only read on Linux.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
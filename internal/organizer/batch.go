@@ -0,0 +1,103 @@
+package organizer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// BatchProgress describes how far a run has come after a batch of files.
+type BatchProgress struct {
+	Batch     int   // number of the completed batch, counting from 1
+	Files     int   // files in the completed batch
+	Processed int64 // files processed so far in the run
+	Found     int64 // files found so far; the total once discovery is complete
+}
+
+// SetProgressHook makes the organizer call hook after each batch of files.
+func (fo *FileOrganizer) SetProgressHook(hook func(BatchProgress)) {
+	fo.progressHook = hook
+}
+
+// CurrentFile returns the path of the file whose processing started last, or
+// "" before the first one. With several workers, others are processed too.
+func (fo *FileOrganizer) CurrentFile() string {
+	if path := fo.currentFile.Load(); path != nil {
+		return *path
+	}
+	return ""
+}
+
+// processBatches processes the batches received from batches one after the
+// other, each through both processing stages, until the channel is closed.
+// Between batches the report is flushed, progress is reported and, for
+// low-priority runs, the organizer pauses for performance.batch_pause. Once ctx is cancelled the
+// remaining batches are drained without being processed.
+func (fo *FileOrganizer) processBatches(ctx context.Context, batches <-chan []FileInfo, stages fileStages) {
+	count := 0
+	for batch := range batches {
+		if ctx.Err() != nil {
+			continue
+		}
+		if count > 0 && !fo.pauseBetweenBatches(ctx) {
+			continue
+		}
+		fo.processBatch(ctx, batch, stages)
+		count++
+		fo.endBatch(count, len(batch))
+	}
+}
+
+// runBatches processes already discovered files in batches of
+// performance.batch_size, like processBatches.
+func (fo *FileOrganizer) runBatches(ctx context.Context, files []FileInfo, stages fileStages) {
+	batches := make(chan []FileInfo)
+	go func() {
+		defer close(batches)
+		size := fo.config.Performance.BatchSize
+		for start := 0; start < len(files); start += size {
+			end := min(start+size, len(files))
+			batches <- files[start:end]
+		}
+	}()
+	fo.processBatches(ctx, batches, stages)
+}
+
+// endBatch flushes the report and reports the progress after a batch.
+func (fo *FileOrganizer) endBatch(batch, files int) {
+	if err := fo.report.Flush(); err != nil {
+		fo.logger.Warnf("Could not write report: %v", err)
+	}
+
+	progress := BatchProgress{
+		Batch:     batch,
+		Files:     files,
+		Processed: atomic.LoadInt64(&fo.stats.TotalFilesProcessed),
+		Found:     atomic.LoadInt64(&fo.stats.TotalFilesFound),
+	}
+	if fo.config.Performance.ShowProgress {
+		fo.logger.Infof("Batch %d done: %d files processed, %d found", progress.Batch, progress.Processed, progress.Found)
+	} else {
+		fo.logger.Debugf("Batch %d done: %d files processed, %d found", progress.Batch, progress.Processed, progress.Found)
+	}
+	if fo.progressHook != nil {
+		fo.progressHook(progress)
+	}
+}
+
+// pauseBetweenBatches sleeps for performance.batch_pause before the next
+// batch. Dry runs do not pause. It reports false if ctx was cancelled.
+func (fo *FileOrganizer) pauseBetweenBatches(ctx context.Context) bool {
+	pause := fo.config.Performance.BatchPause
+	if pause <= 0 || fo.config.Security.DryRun {
+		return true
+	}
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
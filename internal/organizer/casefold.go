@@ -0,0 +1,126 @@
+package organizer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"photo-sorter-go/internal/config"
+)
+
+// detectCaseInsensitiveTarget decides whether target paths that differ only in
+// case refer to the same file, according to case_insensitive_target.
+func (fo *FileOrganizer) detectCaseInsensitiveTarget() bool {
+	switch fo.config.Processing.CaseInsensitiveTarget {
+	case config.CaseInsensitiveTrue:
+		return true
+	case config.CaseInsensitiveFalse:
+		return false
+	}
+
+	dir := fo.config.GetTargetDirectory()
+	if insensitive, ok := probeExistingCase(dir); ok {
+		return insensitive
+	}
+	if !fo.config.Security.DryRun {
+		if insensitive, ok := probeNewFileCase(dir); ok {
+			return insensitive
+		}
+	}
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+// probeExistingCase checks case sensitivity using an existing entry of dir
+// whose name contains letters, without writing anything.
+func probeExistingCase(dir string) (insensitive, ok bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		swapped := swapCase(name)
+		if swapped == name {
+			continue
+		}
+		return sameFile(filepath.Join(dir, name), filepath.Join(dir, swapped)), true
+	}
+	return false, false
+}
+
+// probeNewFileCase checks case sensitivity by creating a temporary file in dir.
+func probeNewFileCase(dir string) (insensitive, ok bool) {
+	probe, err := os.CreateTemp(dir, ".photosorter-case-*"+tempSuffix)
+	if err != nil {
+		return false, false
+	}
+	defer trackTempFile(probe.Name())()
+	probe.Close()
+	defer os.Remove(probe.Name())
+
+	name := filepath.Base(probe.Name())
+	return sameFile(probe.Name(), filepath.Join(dir, swapCase(name))), true
+}
+
+// sameFile reports whether both paths exist and refer to the same file.
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// swapCase inverts the case of every letter in s.
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// targetExists reports whether a file exists at path in the output. On
+// case-insensitive targets a file whose name differs only in case also counts.
+func (fo *FileOrganizer) targetExists(path string) bool {
+	return fo.out.exists(path)
+}
+
+// exists reports whether a file exists at path, also matching names that
+// differ only in case on case-insensitive targets, even when the filesystem's
+// own lookup does not fold case (e.g. some network shares).
+func (o dirOutput) exists(path string) bool {
+	if _, err := os.Lstat(path); err == nil {
+		return true
+	}
+	if !o.fo.caseInsensitive {
+		return false
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	name := filepath.Base(path)
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// samePath reports whether two paths name the same target location.
+func (fo *FileOrganizer) samePath(a, b string) bool {
+	if fo.caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
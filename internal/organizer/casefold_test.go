@@ -0,0 +1,107 @@
+package organizer
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"photo-sorter-go/internal/config"
+)
+
+// targetNames returns the names of the files in dir below the target.
+func (tree *testTree) targetNames(dir string) []string {
+	tree.t.Helper()
+	entries, err := os.ReadDir(tree.target(dir))
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestCaseInsensitiveTargetCollisions forces case_insensitive_target, so that
+// the case-folded comparison is tested whatever the case sensitivity of the
+// filesystem the tests run on.
+func TestCaseInsensitiveTargetCollisions(t *testing.T) {
+	tree := newTestTree(t)
+	upper := jpegWithDate(t, testDate, 1)
+	lower := jpegWithDate(t, testDate, 2)
+	tree.file("a/IMG_0001.JPG", upper)
+	tree.file("b/img_0001.jpg", lower)
+	existing := jpegWithDate(t, testDate, 3)
+	tree.targetFile("2003/11/23/Img_0001_1.jpg", existing)
+
+	cfg := tree.config()
+	cfg.Processing.CaseInsensitiveTarget = config.CaseInsensitiveTrue
+	stats := organize(t, cfg)
+
+	assertCount(t, "FilesMoved", stats.FilesMoved, 2)
+	names := tree.targetNames("2003/11/23")
+	if len(names) != 3 {
+		t.Fatalf("target has %q, want the existing file and both photos", names)
+	}
+	folded := make(map[string]bool)
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if folded[key] {
+			t.Errorf("target has names differing only in case: %q", names)
+		}
+		folded[key] = true
+	}
+	// The renamed photo skipped the _1 taken by a name in another case.
+	if !folded["img_0001.jpg"] || !folded["img_0001_2.jpg"] {
+		t.Errorf("target has %q, want img_0001 and img_0001_2 in some case", names)
+	}
+	assertSameContent(t, tree.target("2003/11/23/Img_0001_1.jpg"), existing)
+}
+
+func TestCaseSensitiveTargetKeepsBothNames(t *testing.T) {
+	tree := newTestTree(t)
+	if insensitive, ok := probeNewFileCase(tree.Target); !ok || insensitive {
+		t.Skip("the target filesystem is not case-sensitive")
+	}
+	upper := jpegWithDate(t, testDate, 1)
+	lower := jpegWithDate(t, testDate, 2)
+	tree.file("a/IMG_0001.JPG", upper)
+	tree.file("b/img_0001.jpg", lower)
+
+	cfg := tree.config()
+	cfg.Processing.CaseInsensitiveTarget = config.CaseInsensitiveFalse
+	organize(t, cfg)
+
+	assertSameContent(t, tree.target("2003/11/23/IMG_0001.JPG"), upper)
+	assertSameContent(t, tree.target("2003/11/23/img_0001.jpg"), lower)
+}
+
+func TestDetectCaseInsensitiveTarget(t *testing.T) {
+	tree := newTestTree(t)
+	cfg := tree.config()
+	fo, _ := newTestOrganizer(t, cfg)
+
+	for _, setting := range []string{config.CaseInsensitiveTrue, config.CaseInsensitiveFalse} {
+		cfg.Processing.CaseInsensitiveTarget = setting
+		if got, want := fo.detectCaseInsensitiveTarget(), setting == config.CaseInsensitiveTrue; got != want {
+			t.Errorf("case_insensitive_target %s: detected %v, want %v", setting, got, want)
+		}
+	}
+
+	// Auto probes the target: an existing entry and a new file agree.
+	cfg.Processing.CaseInsensitiveTarget = config.CaseInsensitiveAuto
+	probed, ok := probeNewFileCase(tree.Target)
+	if !ok {
+		t.Fatal("could not probe the target")
+	}
+	if got := fo.detectCaseInsensitiveTarget(); got != probed {
+		t.Errorf("auto on an empty target detected %v, want %v", got, probed)
+	}
+	tree.targetFile("Photos.txt", nil)
+	if got := fo.detectCaseInsensitiveTarget(); got != probed {
+		t.Errorf("auto with an existing entry detected %v, want %v", got, probed)
+	}
+	assertCount(t, "entries left by probing", int64(len(tree.targetNames("."))), 1)
+}
@@ -0,0 +1,78 @@
+package organizer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// recordMovedFrom remembers that a file was moved out of dir, making it a
+// candidate for empty directory cleanup.
+func (fo *FileOrganizer) recordMovedFrom(dir string) {
+	fo.movedFromDirs.Store(dir, struct{}{})
+}
+
+// removeEmptyDirs removes source directories that became empty because files were
+// moved out of them, deepest first. The source roots themselves, directories outside
+// the source trees, and symlinks are never removed.
+func (fo *FileOrganizer) removeEmptyDirs() {
+	var roots []string
+	for _, source := range fo.sources {
+		root, err := filepath.Abs(source)
+		if err != nil {
+			fo.logger.Warnf("Could not resolve source directory for cleanup: %v", err)
+			return
+		}
+		roots = append(roots, root)
+	}
+
+	candidates := make(map[string]bool)
+	fo.movedFromDirs.Range(func(key, _ any) bool {
+		dir, err := filepath.Abs(key.(string))
+		if err != nil {
+			return true
+		}
+		for _, root := range roots {
+			for isInsideDir(root, dir) && !candidates[dir] {
+				candidates[dir] = true
+				dir = filepath.Dir(dir)
+			}
+		}
+		return true
+	})
+
+	dirs := make([]string, 0, len(candidates))
+	for dir := range candidates {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], string(filepath.Separator)) > strings.Count(dirs[j], string(filepath.Separator))
+	})
+
+	for _, dir := range dirs {
+		info, err := os.Lstat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dir); err != nil {
+			fo.logger.Warnf("Could not remove empty directory %s: %v", dir, err)
+			continue
+		}
+		fo.stats.IncrementDirectoriesRemoved()
+		fo.logger.Debugf("Removed empty directory: %s", dir)
+	}
+}
+
+// isInsideDir reports whether path is strictly inside root.
+func isInsideDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,100 @@
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"photo-sorter-go/internal/compressor"
+	"photo-sorter-go/internal/statistics"
+)
+
+// compressesDuringOrganize reports whether placed images are compressed as
+// they are organized. Compressing a linked file would change its source, and
+// files in an archive cannot be rewritten.
+func (fo *FileOrganizer) compressesDuringOrganize() bool {
+	c := fo.config.Compressor
+	return c.Enabled && c.RunDuringOrganize && fo.compressor != nil &&
+		!fo.config.UsesLinks() && fo.config.TargetArchiveFormat() == ""
+}
+
+// compressPlaced compresses the image placed at path in place, if it is at
+// least compressor.min_size, and returns its path afterwards: a converted
+// image gets the extension of its new format. The compressed file replaces it
+// with a single write, and only if it is smaller. In a dry run, the source
+// file is measured instead and nothing is written. Failures are logged and
+// counted, but the file stays organized.
+func (fo *FileOrganizer) compressPlaced(file FileInfo, path string) string {
+	if !fo.compressesDuringOrganize() || file.Size < fo.config.Compressor.GetMinSize() {
+		return path
+	}
+	params := compressor.ParamsFromConfig(fo.config.Compressor, []string{path}, "")
+	params.InPlace = true
+	params.DetectFileType = fo.config.Processing.DetectFileType
+	params.Workers = 1         // the organizer's workers already run in parallel
+	params.Video.Formats = nil // encodes take minutes and would hold up organizing
+	params.Logger = fo.logger
+	if fo.config.Security.DryRun {
+		params.InputPaths = []string{file.Path}
+		params.DryRun = true
+	}
+	// Holding the converted name keeps other workers from placing a file
+	// there while the compressor checks that it is free.
+	if converted := compressor.ConvertedPath(path, params.ConvertTo); converted != path && !params.DryRun {
+		fo.reserved.reserve(fo.claimKey(converted))
+		defer fo.releaseTarget(converted)
+	}
+
+	results, err := fo.compressor.Compress(context.Background(), params)
+	if err != nil {
+		fo.compressionFailed(path, err)
+		return path
+	}
+	finalPath := path
+	for _, r := range results {
+		switch r.Action {
+		case "compressed", "would_compress":
+			saved := r.OriginalSize - r.CompressedSize
+			fo.stats.RecordCompression(saved)
+			msg := fmt.Sprintf("Compressed %s, saved %s", path, statistics.FormatBytes(saved))
+			if params.DryRun {
+				msg = fmt.Sprintf("DRY-RUN: Would compress %s, saving %s", path, statistics.FormatBytes(saved))
+			}
+			fo.logger.Info(msg)
+			if fo.logHook != nil {
+				fo.logHook("info", msg)
+			}
+			finalPath = fo.compressedPath(path, r, params)
+		case "error":
+			fo.compressionFailed(path, r.Error)
+		}
+	}
+	return finalPath
+}
+
+// compressedPath returns the path of the image placed at path once
+// compressed with result r. In a dry run, r is about the source file, so
+// only its new extension is taken over.
+func (fo *FileOrganizer) compressedPath(path string, r compressor.CompressionResult, params compressor.CompressionParams) string {
+	switch {
+	case r.OutputPath == "":
+		return path
+	case params.DryRun:
+		if filepath.Ext(r.OutputPath) == filepath.Ext(r.InputPath) {
+			return path
+		}
+		return strings.TrimSuffix(path, filepath.Ext(path)) + filepath.Ext(r.OutputPath)
+	}
+	if r.OutputPath != path {
+		fo.logger.Infof("Converted %s to %s", path, r.OutputPath)
+	}
+	return r.OutputPath
+}
+
+// compressionFailed logs and counts an image that could not be compressed
+// after it was organized.
+func (fo *FileOrganizer) compressionFailed(path string, err error) {
+	fo.logger.Warnf("Could not compress %s: %v", path, err)
+	fo.stats.IncrementCompressionErrors()
+}
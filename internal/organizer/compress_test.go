@@ -0,0 +1,50 @@
+package organizer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCompressDuringOrganizeFollowsConvertedName(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool   // an unrelated IMG.jpg is already organized
+		want     string // the name of the converted image
+	}{
+		{name: "free name", want: "IMG"},
+		{name: "taken name", existing: true, want: "IMG_1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			tree.file("IMG.png", noisyPNG(t, 1))
+			tree.file("IMG.xmp", []byte("<x:xmpmeta/>"))
+			if tt.existing {
+				tree.targetFile("unsorted/IMG.jpg", []byte("another photo"))
+			}
+
+			cfg := tree.config()
+			cfg.Processing.UseModTimeFallback = false
+			cfg.Processing.UnsortedDirectory = "unsorted"
+			cfg.Compressor.Enabled = true
+			cfg.Compressor.RunDuringOrganize = true
+			cfg.Compressor.ConvertTo = "jpeg"
+			fo, stats := newTestOrganizer(t, cfg)
+			records := recordReport(t, fo, cfg)
+			if err := fo.OrganizeFiles(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			assertCount(t, "FilesCompressed", stats.FilesCompressed, 1)
+			assertNoFile(t, tree.target("unsorted/IMG.png"))
+			assertFile(t, tree.target("unsorted/"+tt.want+".jpg"))
+			assertFile(t, tree.target("unsorted/"+tt.want+".xmp"))
+			if tt.existing {
+				assertSameContent(t, tree.target("unsorted/IMG.jpg"), []byte("another photo"))
+			}
+			if got := records(); len(got) != 1 || got[0].Target != tree.target("unsorted/"+tt.want+".jpg") {
+				t.Errorf("report records %+v, want one for %s.jpg", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package organizer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// countedTree writes five photos in two directories, one of them with a
+// sidecar, which travels with its photo and is not counted as found.
+func countedTree(t *testing.T) *testTree {
+	t.Helper()
+	tree := newTestTree(t)
+	tree.photo("IMG_0001.jpg", testDate)
+	tree.photo("IMG_0002.jpg", testDate)
+	tree.photo("trip/IMG_0003.jpg", testDate)
+	tree.photo("trip/IMG_0004.jpg", testDate)
+	tree.photo("trip/IMG_0005.jpg", testDate)
+	tree.file("trip/IMG_0005.xmp", []byte("<x:xmpmeta/>"))
+	return tree
+}
+
+func TestFoundFilesAreCountedOnce(t *testing.T) {
+	t.Run("organize", func(t *testing.T) {
+		tree := countedTree(t)
+		stats := organize(t, tree.config())
+
+		assertCount(t, "TotalFilesFound", stats.TotalFilesFound, 5)
+		assertCount(t, "TotalFilesProcessed", stats.TotalFilesProcessed, 5)
+		assertCount(t, "FilesOrganized", stats.FilesOrganized, 5)
+		assertCount(t, "FilesMoved", stats.FilesMoved, 5)
+		assertCount(t, "DirectoriesScanned", stats.DirectoriesScanned, 2)
+	})
+
+	t.Run("discover then process", func(t *testing.T) {
+		tree := countedTree(t)
+		fo, stats := newTestOrganizer(t, tree.config())
+		files, err := fo.DiscoverFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 5 {
+			t.Fatalf("discovered %d files, want 5", len(files))
+		}
+		if err := fo.ProcessDiscoveredFiles(context.Background(), files); err != nil {
+			t.Fatal(err)
+		}
+		assertCount(t, "TotalFilesFound", stats.TotalFilesFound, 5)
+		assertCount(t, "FilesOrganized", stats.FilesOrganized, 5)
+	})
+}
+
+func TestDryRunCountsWhatWouldBeOrganized(t *testing.T) {
+	tree := countedTree(t)
+	before := snapshotTree(t, tree.Source)
+	cfg := tree.config()
+	cfg.Security.DryRun = true
+	stats := organize(t, cfg)
+
+	assertTreeUnchanged(t, tree.Source, before)
+	assertCount(t, "TotalFilesFound", stats.TotalFilesFound, 5)
+	assertCount(t, "FilesOrganized", stats.FilesOrganized, 5)
+	assertCount(t, "FilesMoved", stats.FilesMoved, 0)
+	assertCount(t, "DirectoriesCreated", stats.DirectoriesCreated, 0)
+	if !stats.IsDryRun() {
+		t.Error("statistics of a dry run are not marked as such")
+	}
+	summary := stats.GetSummary()
+	for _, want := range []string{"dry run, nothing was changed", "Would Organize: 5"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary does not say %q:\n%s", want, summary)
+		}
+	}
+}
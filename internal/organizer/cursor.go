@@ -0,0 +1,114 @@
+package organizer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cursorFileName is the file in the target directory that records how far a
+// run capped by max_files_per_run got, so that --continue can resume after it.
+const cursorFileName = ".photo-sorter-cursor.json"
+
+// discoveryCursor is the persisted position of a capped discovery.
+type discoveryCursor struct {
+	Source   string    `json:"source"`
+	LastPath string    `json:"last_path"` // relative to Source, in walk order
+	Updated  time.Time `json:"updated"`
+}
+
+// cursorPath returns the location of the cursor file: in the target
+// directory, or next to an archive target.
+func (fo *FileOrganizer) cursorPath() string {
+	if fo.config.TargetArchiveFormat() != "" {
+		return filepath.Join(filepath.Dir(fo.config.GetTargetDirectory()), cursorFileName)
+	}
+	return filepath.Join(fo.config.GetTargetDirectory(), cursorFileName)
+}
+
+// loadCursor returns the relative path discovery should resume after, or "" to
+// start from the beginning.
+func (fo *FileOrganizer) loadCursor() string {
+	if !fo.config.Security.ContinueFromCursor {
+		return ""
+	}
+	if len(fo.sources) > 1 {
+		fo.logger.Warn("Discovery cursors are not supported with several source directories, starting from the beginning")
+		return ""
+	}
+
+	data, err := os.ReadFile(fo.cursorPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fo.logger.Warnf("Could not read discovery cursor: %v", err)
+		}
+		return ""
+	}
+
+	var cursor discoveryCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		fo.logger.Warnf("Ignoring invalid discovery cursor %s: %v", fo.cursorPath(), err)
+		return ""
+	}
+	if source, _ := filepath.Abs(fo.config.SourceDirectory); cursor.Source != source {
+		fo.logger.Warnf("Ignoring discovery cursor for a different source directory: %s", cursor.Source)
+		return ""
+	}
+
+	fo.logger.Infof("Continuing after %s", cursor.LastPath)
+	return cursor.LastPath
+}
+
+// updateCursor saves the discovery position after a capped run, or removes the
+// cursor once a run has reached the end of the source tree.
+func (fo *FileOrganizer) updateCursor() {
+	if fo.config.Security.DryRun || fo.config.Security.MaxFilesPerRun <= 0 || fo.explicitPaths() != nil || len(fo.sources) > 1 {
+		return
+	}
+
+	if !fo.discoveryTruncated {
+		if err := os.Remove(fo.cursorPath()); err == nil {
+			fo.logger.Info("Source directory fully processed, removed discovery cursor")
+		}
+		return
+	}
+
+	source, err := filepath.Abs(fo.config.SourceDirectory)
+	if err != nil {
+		fo.logger.Warnf("Could not save discovery cursor: %v", err)
+		return
+	}
+	data, err := json.MarshalIndent(discoveryCursor{
+		Source:   source,
+		LastPath: fo.lastDiscovered,
+		Updated:  time.Now(),
+	}, "", "  ")
+	if err == nil {
+		err = os.WriteFile(fo.cursorPath(), data, 0644)
+	}
+	if err != nil {
+		fo.logger.Warnf("Could not save discovery cursor: %v", err)
+		return
+	}
+	fo.logger.Infof("Stopped after %s; run again with --continue to process the next batch", fo.lastDiscovered)
+}
+
+// walkOrderLess reports whether relative path a is visited before b by
+// filepath.Walk, which orders entries lexically within each directory.
+func walkOrderLess(a, b string) bool {
+	partsA := strings.Split(filepath.ToSlash(a), "/")
+	partsB := strings.Split(filepath.ToSlash(b), "/")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		if partsA[i] != partsB[i] {
+			return partsA[i] < partsB[i]
+		}
+	}
+	return len(partsA) < len(partsB)
+}
+
+// isAncestorDir reports whether relative directory dir contains relative path path.
+func isAncestorDir(dir, path string) bool {
+	return strings.HasPrefix(filepath.ToSlash(path), filepath.ToSlash(dir)+"/")
+}
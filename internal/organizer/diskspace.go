@@ -0,0 +1,229 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"photo-sorter-go/internal/statistics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInsufficientSpace is returned when the files of a run do not fit on the
+// target filesystem.
+var ErrInsufficientSpace = errors.New("not enough free space on the target filesystem")
+
+// SpaceCheck compares the space a run needs on the target filesystem with the
+// space available there.
+type SpaceCheck struct {
+	Required  int64 // bytes the run writes to the target filesystem
+	Available int64 // bytes available to the user on the target filesystem
+	Margin    int64 // bytes to leave free, from security.free_space_margin
+}
+
+// Sufficient reports whether the required space and the margin fit in the
+// available space.
+func (c SpaceCheck) Sufficient() bool {
+	return c.Required+c.Margin <= c.Available
+}
+
+// String describes the space needed, the margin and the space available.
+func (c SpaceCheck) String() string {
+	return fmt.Sprintf("%s needed (plus %s margin), %s available",
+		statistics.FormatBytes(c.Required), statistics.FormatBytes(c.Margin), statistics.FormatBytes(c.Available))
+}
+
+// CheckSpace works out how much space files need on the target filesystem and
+// how much is available there. It returns nil if nothing needs checking: in
+// dry runs, with security.check_disk_space off, when files are linked rather
+// than copied, or when they are all moved within the target filesystem.
+func (fo *FileOrganizer) CheckSpace(files []FileInfo) (*SpaceCheck, error) {
+	if !fo.needsSpaceCheck() {
+		return nil, nil
+	}
+
+	return fo.spaceCheck(fo.requiredSpace(files, existingAncestor(fo.config.GetTargetDirectory())))
+}
+
+// spaceCheck compares required bytes with the space available on the target
+// filesystem. It returns nil if nothing is required.
+func (fo *FileOrganizer) spaceCheck(required int64) (*SpaceCheck, error) {
+	if required == 0 {
+		return nil, nil
+	}
+	target := existingAncestor(fo.config.GetTargetDirectory())
+	available, _, err := diskSpace(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine free space on %s: %w", target, err)
+	}
+
+	check := &SpaceCheck{Required: required, Available: available, Margin: fo.config.GetFreeSpaceMargin()}
+	fo.stats.SetSpaceCheck(check.Required, check.Available)
+	return check, nil
+}
+
+// EstimateSpace is CheckSpace before discovery: it compares sourceBytes, the
+// size of the media files to organize, with the space available on the target
+// filesystem. Companions and sidecars are not counted. It returns nil if
+// nothing needs checking.
+func (fo *FileOrganizer) EstimateSpace(sourceBytes int64) (*SpaceCheck, error) {
+	if !fo.needsSpaceCheck() || sourceBytes == 0 {
+		return nil, nil
+	}
+	target := existingAncestor(fo.config.GetTargetDirectory())
+	available, _, err := diskSpace(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine free space on %s: %w", target, err)
+	}
+	return &SpaceCheck{Required: sourceBytes, Available: available, Margin: fo.config.GetFreeSpaceMargin()}, nil
+}
+
+// DiskSpace returns the bytes available to the current user on the filesystem
+// that holds path, or would hold it once created, and the filesystem's size.
+func DiskSpace(path string) (available, total int64, err error) {
+	return diskSpace(existingAncestor(path))
+}
+
+// needsSpaceCheck reports whether a run may copy data to the target
+// filesystem and should check that it fits first. A move from a source
+// directory on the target filesystem needs no check, so the run can start
+// before discovery is complete.
+func (fo *FileOrganizer) needsSpaceCheck() bool {
+	if fo.config.Security.DryRun || !fo.config.Security.CheckDiskSpace {
+		return false
+	}
+	if fo.config.UsesLinks() {
+		return false
+	}
+	if fo.explicitPaths() != nil {
+		return true
+	}
+	target := existingAncestor(fo.config.GetTargetDirectory())
+	dirs := slices.Clone(fo.sources)
+	for _, source := range fo.sourceConfigs {
+		dirs = append(dirs, source.dir) // may be inside one of sources
+	}
+	for _, dir := range dirs {
+		if fo.transferAction(dir) != "move" || !sameFilesystem(dir, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredSpace returns the bytes that organizing files writes to the
+// filesystem of target, including companions and sidecars. Moved files only
+// count if they come from another filesystem.
+func (fo *FileOrganizer) requiredSpace(files []FileInfo, target string) int64 {
+	local := make(map[string]bool) // directory -> on the target filesystem
+	copied := func(path string) bool {
+		if fo.transferAction(path) != "move" {
+			return true
+		}
+		dir := filepath.Dir(path)
+		same, ok := local[dir]
+		if !ok {
+			same = sameFilesystem(dir, target)
+			local[dir] = same
+		}
+		return !same
+	}
+	size := func(path string) int64 {
+		if info, err := os.Stat(path); err == nil {
+			return info.Size()
+		}
+		return 0
+	}
+
+	var required int64
+	for _, file := range files {
+		if !copied(file.Path) {
+			continue
+		}
+		required += file.Size
+		for _, companion := range file.Companions {
+			required += size(companion.Path)
+		}
+		for _, sidecar := range file.Sidecars {
+			required += size(sidecar.Path)
+		}
+	}
+	return required
+}
+
+// discoveredSpace walks the sources as discovery does and returns the bytes
+// organizing the files found writes to the target filesystem. Only the sum
+// is kept, so that checking the space before a run needs no more memory
+// than the run itself. Nothing is changed and nothing is counted: the walk
+// is made by a dry-run organizer of its own.
+func (fo *FileOrganizer) discoveredSpace(ctx context.Context) (int64, error) {
+	cfg := *fo.config
+	cfg.Security.DryRun = true            // stale temporary files are left to the run
+	cfg.Processing.DetectFileType = false // types do not change the sizes
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	probe := NewFileOrganizer(&cfg, log, statistics.NewStatistics(), fo.extractor, fo.compressor)
+	probe.paths = fo.paths
+
+	target := existingAncestor(fo.config.GetTargetDirectory())
+	var required int64
+	err := probe.walkSource(ctx, func(group []FileInfo) {
+		required += fo.requiredSpace(group, target)
+	})
+	return required, err
+}
+
+// checkSourceSpace is checkSpace for the files of the sources, before they
+// are discovered.
+func (fo *FileOrganizer) checkSourceSpace(ctx context.Context) error {
+	required, err := fo.discoveredSpace(ctx)
+	if err != nil {
+		return err
+	}
+	check, err := fo.spaceCheck(required)
+	return fo.acceptSpace(check, err)
+}
+
+// checkSpace fails with ErrInsufficientSpace if files do not fit on the
+// target filesystem. If the free space cannot be determined, the run goes
+// ahead with a warning.
+func (fo *FileOrganizer) checkSpace(files []FileInfo) error {
+	check, err := fo.CheckSpace(files)
+	return fo.acceptSpace(check, err)
+}
+
+// acceptSpace returns the error of checkSpace for the outcome of a check.
+func (fo *FileOrganizer) acceptSpace(check *SpaceCheck, err error) error {
+	if err != nil {
+		fo.logger.Warnf("Skipping disk space check: %v", err)
+		return nil
+	}
+	if check == nil {
+		return nil
+	}
+	if !check.Sufficient() {
+		return fmt.Errorf("%w: %s", ErrInsufficientSpace, check)
+	}
+	fo.logger.Infof("Disk space: %s", check)
+	return nil
+}
+
+// existingAncestor returns path or, if it does not exist yet, its closest
+// existing parent directory.
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,64 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestOrganizeChecksSpaceBeforeCopying(t *testing.T) {
+	tests := []struct {
+		name        string
+		margin      string
+		wantErr     bool
+		wantScanned int64 // by the run, not by the walk measuring the space
+	}{
+		{name: "fits", margin: "0", wantScanned: 2},
+		{name: "does not fit", margin: "1000000TB", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			var want int64
+			for _, path := range []string{
+				tree.photo("IMG_0001.jpg", testDate),
+				tree.photo("trip/IMG_0002.jpg", testDate),
+				tree.file("trip/IMG_0002.xmp", []byte("<x:xmpmeta/>")),
+			} {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want += info.Size()
+			}
+			tree.file("orphan.xmp", []byte("<x:xmpmeta/>")) // not placed, so not counted
+			sourceBefore := snapshotTree(t, tree.Source)
+
+			cfg := tree.config()
+			cfg.Processing.MoveFiles = false
+			cfg.Security.CheckDiskSpace = true
+			cfg.Security.FreeSpaceMargin = tt.margin
+			fo, stats := newTestOrganizer(t, cfg)
+			err := fo.OrganizeFiles(context.Background())
+
+			assertCount(t, "SpaceRequired", stats.SpaceRequired, want)
+			assertCount(t, "DirectoriesScanned", stats.DirectoriesScanned, tt.wantScanned)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInsufficientSpace) {
+					t.Fatalf("OrganizeFiles = %v, want ErrInsufficientSpace", err)
+				}
+				assertNoFile(t, tree.target("2003/11/23/IMG_0001.jpg"))
+				assertCount(t, "TotalFilesFound", stats.TotalFilesFound, 0)
+			} else {
+				if err != nil {
+					t.Fatalf("OrganizeFiles: %v", err)
+				}
+				assertFile(t, tree.target("2003/11/23/IMG_0001.jpg"))
+				assertFile(t, tree.target("2003/11/23/IMG_0002.xmp"))
+				assertCount(t, "TotalFilesFound", stats.TotalFilesFound, 2)
+			}
+			assertTreeUnchanged(t, tree.Source, sourceBefore)
+		})
+	}
+}
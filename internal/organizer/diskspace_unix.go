@@ -0,0 +1,31 @@
+//go:build !windows
+
+package organizer
+
+import (
+	"os"
+	"syscall"
+)
+
+// diskSpace returns the bytes available to the current user on the
+// filesystem holding path, and its size.
+func diskSpace(path string) (available, total int64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return int64(uint64(stat.Bavail) * uint64(stat.Bsize)), int64(uint64(stat.Blocks) * uint64(stat.Bsize)), nil
+}
+
+// sameFilesystem reports whether a and b are on the same filesystem. Paths
+// that cannot be examined are treated as being on different filesystems.
+func sameFilesystem(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	statA, okA := infoA.Sys().(*syscall.Stat_t)
+	statB, okB := infoB.Sys().(*syscall.Stat_t)
+	return okA && okB && statA.Dev == statB.Dev
+}
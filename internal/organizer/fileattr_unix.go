@@ -0,0 +1,38 @@
+//go:build !windows
+
+package organizer
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// chownLike sets the owner and group of path to those of the source file.
+func chownLike(sourceInfo os.FileInfo, path string) error {
+	stat, ok := sourceInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("ownership information not available")
+	}
+	return os.Chown(path, int(stat.Uid), int(stat.Gid))
+}
+
+// isCrossDeviceError reports whether err is caused by renaming across filesystems.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// explainSymlinkError returns err unchanged; symlinks need no special privileges on Unix.
+func explainSymlinkError(err error) error {
+	return err
+}
+
+// fileIdentity returns the device and inode of a file, used to recognize a
+// directory reached again through a symlink.
+func fileIdentity(path string, info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
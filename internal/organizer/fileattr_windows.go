@@ -0,0 +1,51 @@
+//go:build windows
+
+package organizer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// errorNotSameDevice is the Windows error for moving a file to a different drive.
+const errorNotSameDevice syscall.Errno = 17
+
+// errorPrivilegeNotHeld is returned when creating a symlink without the required privilege.
+const errorPrivilegeNotHeld syscall.Errno = 1314
+
+// chownLike is a no-op on Windows, which has no Unix-style ownership.
+func chownLike(sourceInfo os.FileInfo, path string) error {
+	return nil
+}
+
+// isCrossDeviceError reports whether err is caused by renaming across drives.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// explainSymlinkError adds a hint to symlink errors caused by missing privileges.
+func explainSymlinkError(err error) error {
+	if errors.Is(err, errorPrivilegeNotHeld) {
+		return fmt.Errorf("creating symlinks on Windows requires Developer Mode or administrator rights "+
+			"(or use link_mode: hardlink): %w", err)
+	}
+	return err
+}
+
+// fileIdentity identifies a directory by its fully resolved path, since
+// os.FileInfo carries no file index on Windows. Symlinks and junctions
+// resolve to the same path as their target.
+func fileIdentity(path string, info os.FileInfo) (fileID, bool) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fileID{}, false
+	}
+	if abs, err := filepath.Abs(resolved); err == nil {
+		resolved = abs
+	}
+	return fileID{path: strings.ToLower(resolved)}, true
+}
@@ -0,0 +1,46 @@
+package organizer
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryFilters(t *testing.T) {
+	tree := newTestTree(t)
+	kept := tree.photo("IMG_0001.jpg", testDate)
+	stub := tree.file("IMG_0002.jpg", []byte("corrupt stub"))
+	recent := tree.photo("IMG_0003.jpg", testDate)
+	old := tree.photo("IMG_0004.jpg", testDate)
+	now := time.Now()
+	for path, modTime := range map[string]time.Time{recent: now, old: now.AddDate(0, 0, -2)} {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := tree.config()
+	cfg.Processing.MinFileSize = "0.5kb"
+	cfg.Processing.MinAge = 30 * time.Minute
+	cfg.Processing.MaxAge = 24 * time.Hour
+	stats := organize(t, cfg)
+
+	assertNoFile(t, kept)
+	assertFile(t, tree.target("2003/11/23/IMG_0001.jpg"))
+	for _, path := range []string{stub, recent, old} {
+		assertFile(t, path)
+	}
+	assertCount(t, "FilesOrganized", stats.FilesOrganized, 1)
+	assertCount(t, "FilesSkipped", stats.FilesSkipped, 3)
+	assertCount(t, "FilteredBySize", stats.FilteredBySize, 1)
+	assertCount(t, "FilteredByMinAge", stats.FilteredByMinAge, 1)
+	assertCount(t, "FilteredByMaxAge", stats.FilteredByMaxAge, 1)
+
+	summary := stats.GetFilterSummary()
+	for _, want := range []string{"Below Minimum Size: 1", "Newer Than Min Age: 1", "Older Than Max Age: 1"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("filter summary %q does not report %q", summary, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package organizer
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// junkNames are the lower-cased names of files operating systems leave in
+// photo folders that are never worth organizing.
+var junkNames = map[string]bool{
+	".ds_store":   true,
+	"thumbs.db":   true,
+	"ehthumbs.db": true,
+	"desktop.ini": true,
+	"icon\r":      true, // macOS custom folder icon
+}
+
+// isHiddenName reports whether a file or directory name is a dotfile
+// (including AppleDouble "._" files) or known system junk.
+func isHiddenName(name string) bool {
+	return strings.HasPrefix(name, ".") || junkNames[strings.ToLower(name)]
+}
+
+// isIgnoredHidden reports whether path is ignored by processing.ignore_hidden.
+// The source directories themselves are never ignored, even if their names are hidden.
+func (fo *FileOrganizer) isIgnoredHidden(path string) bool {
+	return fo.config.Processing.IgnoreHidden &&
+		path != fo.sourceRoot(path) &&
+		isHiddenName(filepath.Base(path))
+}
+
+// skipHidden reports whether a discovered file is ignored by
+// processing.ignore_hidden, counting it if so.
+func (fo *FileOrganizer) skipHidden(path string) bool {
+	if !fo.isIgnoredHidden(path) {
+		return false
+	}
+	fo.logger.Debugf("Ignoring hidden or system file: %s", path)
+	fo.stats.IncrementHiddenFilesSkipped()
+	return true
+}
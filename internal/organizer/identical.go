@@ -0,0 +1,85 @@
+package organizer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reasons recorded in the report for duplicates skipped with
+// verify_identical_skips: the source has the same contents as the existing
+// target (and can be deleted), or only the same name.
+const (
+	SkipReasonIdentical     = "identical"
+	SkipReasonNameCollision = "name-collision"
+)
+
+// skipReason returns the report reason for a duplicate skipped because
+// targetPath exists. With verify_identical_skips the two files are compared
+// by content; if another worker is still writing targetPath (reserved is
+// false), the comparison waits until it is done.
+func (fo *FileOrganizer) skipReason(file FileInfo, targetPath string, reserved bool) string {
+	if !fo.config.Processing.VerifyIdenticalSkips {
+		return "skip"
+	}
+	if !reserved {
+		fo.reserved.reserve(fo.claimKey(targetPath))
+		defer fo.releaseTarget(targetPath)
+	}
+
+	identical, err := sameContents(file.Path, fo.out.contentsPath(targetPath))
+	if err != nil {
+		fo.logger.Warnf("Could not compare %s with %s: %v", file.Path, targetPath, err)
+		return "skip"
+	}
+	if identical {
+		fo.logger.Debugf("Skipped %s is identical to %s", file.Path, targetPath)
+		fo.stats.IncrementDuplicatesIdentical()
+		return SkipReasonIdentical
+	}
+	fo.logger.Debugf("Skipped %s only has the same name as %s", file.Path, targetPath)
+	fo.stats.IncrementDuplicatesNameCollision()
+	return SkipReasonNameCollision
+}
+
+// sameContents reports whether two files have the same size and SHA-256 hash.
+func sameContents(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+
+	hashA, err := fileHash(a)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := fileHash(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hashA, hashB), nil
+}
+
+// fileHash returns the SHA-256 hash of a file's contents.
+func fileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
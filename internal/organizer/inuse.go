@@ -0,0 +1,89 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// writeHandlesMaxAge is how long a snapshot of the files open for writing is reused.
+const writeHandlesMaxAge = time.Second
+
+// writeHandles caches the files other processes have open for writing, since
+// listing them is too expensive to repeat for every file.
+type writeHandles struct {
+	mu    sync.Mutex
+	files map[string]bool
+	taken time.Time
+}
+
+// has reports whether path was open for writing when the snapshot was taken,
+// taking a new snapshot if the current one is too old.
+func (h *writeHandles) has(path string) bool {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.files == nil || time.Since(h.taken) > writeHandlesMaxAge {
+		h.files = openWriteHandles()
+		h.taken = time.Now()
+	}
+	return h.files[path]
+}
+
+// inUse reports whether file seems to be still being written, and why: its
+// size or modification time changed since it was found or it was modified
+// within processing.settle_time, or, with processing.strict_in_use_check,
+// another process has it open for writing.
+func (fo *FileOrganizer) inUse(file FileInfo) (bool, string) {
+	settle := fo.config.Processing.SettleTime
+	strict := fo.config.Processing.StrictInUseCheck
+	if settle <= 0 && !strict {
+		return false, ""
+	}
+
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return false, "" // the transfer reports missing files
+	}
+	if settle > 0 {
+		if info.Size() != file.Size || !info.ModTime().Equal(file.ModTime) {
+			return true, "changed since it was found"
+		}
+		if age := time.Since(info.ModTime()); age >= 0 && age < settle {
+			return true, fmt.Sprintf("modified %v ago", age.Round(time.Millisecond))
+		}
+	}
+	if strict && fo.writeHandles.has(file.Path) {
+		return true, "open for writing by another process"
+	}
+	return false, ""
+}
+
+// skipInUse skips file if it seems to be still being written, so that it is
+// organized by a later run instead of being moved half-written. It reports
+// whether the file was skipped.
+func (fo *FileOrganizer) skipInUse(file FileInfo) bool {
+	inUse, reason := fo.inUse(file)
+	if !inUse {
+		return false
+	}
+	msg := fmt.Sprintf("Skipping %s for now: %s, it may still be being written", file.Path, reason)
+	if fo.config.Security.DryRun {
+		msg = fmt.Sprintf("DRY-RUN: Would skip %s for now: %s, it may still be being written", file.Path, reason)
+	}
+	fo.logger.Infof(msg)
+	if fo.logHook != nil {
+		fo.logHook("info", msg)
+	}
+	fo.stats.IncrementFilesInUse()
+	fo.reportFile(file, "", ReportActionSkip, "in use: "+reason, nil)
+	return true
+}
@@ -0,0 +1,68 @@
+package organizer
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// openWriteHandles lists the files that other processes have open for
+// writing, from /proc/<pid>/fd and /proc/<pid>/fdinfo. Processes of other
+// users are not visible unless running as root.
+func openWriteHandles() map[string]bool {
+	files := make(map[string]bool)
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return files
+	}
+	self := strconv.Itoa(os.Getpid())
+	for _, proc := range procs {
+		pid := proc.Name()
+		if pid == self || pid[0] < '0' || pid[0] > '9' {
+			continue
+		}
+		fdDir := filepath.Join("/proc", pid, "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !filepath.IsAbs(target) || files[target] {
+				continue
+			}
+			if openedForWriting(filepath.Join("/proc", pid, "fdinfo", fd.Name())) {
+				files[target] = true
+			}
+		}
+	}
+	return files
+}
+
+// openedForWriting reports whether the file descriptor described by the
+// fdinfo file was opened with write access.
+func openedForWriting(fdinfo string) bool {
+	f, err := os.Open(fdinfo)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "flags:")
+		if !ok {
+			continue
+		}
+		flags, err := strconv.ParseInt(strings.TrimSpace(value), 8, 64)
+		if err != nil {
+			return false
+		}
+		mode := flags & syscall.O_ACCMODE
+		return mode == syscall.O_WRONLY || mode == syscall.O_RDWR
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package organizer
+
+// openWriteHandles returns no files: open file handles are only inspected on
+// Linux, so strict_in_use_check has no effect elsewhere.
+func openWriteHandles() map[string]bool {
+	return nil
+}
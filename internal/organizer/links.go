@@ -0,0 +1,121 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"photo-sorter-go/internal/config"
+)
+
+// TransferAction returns how files are placed in the target tree:
+// "move", "copy", "hardlink" or "symlink". Files of sources entries that set
+// move_files may be placed differently.
+func (fo *FileOrganizer) TransferAction() string {
+	return transferAction(fo.config)
+}
+
+// transferAction returns how the file at path is placed in the target tree,
+// by the settings of its source.
+func (fo *FileOrganizer) transferAction(path string) string {
+	return transferAction(fo.configFor(path))
+}
+
+// transferAction returns how cfg places files in the target tree.
+func transferAction(cfg *config.Config) string {
+	switch cfg.Processing.LinkMode {
+	case config.LinkModeHardlink, config.LinkModeSymlink:
+		return cfg.Processing.LinkMode
+	}
+	if cfg.Processing.MoveFiles {
+		return "move"
+	}
+	return "copy"
+}
+
+// transferFile places sourcePath at destPath using the transfer action of
+// its source.
+func (fo *FileOrganizer) transferFile(sourcePath, destPath string) error {
+	return fo.transferFileAs(fo.transferAction(sourcePath), sourcePath, destPath)
+}
+
+// transferFileAs places sourcePath at destPath using the given transfer action.
+func (fo *FileOrganizer) transferFileAs(action, sourcePath, destPath string) error {
+	switch action {
+	case config.LinkModeHardlink:
+		return fo.hardlinkFile(sourcePath, destPath)
+	case config.LinkModeSymlink:
+		return fo.symlinkFile(sourcePath, destPath)
+	case "move":
+		return fo.moveFile(sourcePath, destPath)
+	default:
+		return fo.out.copyFile(sourcePath, destPath)
+	}
+}
+
+// countTransfer records a completed transfer of the primary file at path of
+// size bytes in the statistics.
+func (fo *FileOrganizer) countTransfer(path string, size int64) {
+	fo.countTransferAs(fo.transferAction(path), size)
+}
+
+// countTransferAs records a completed transfer with the given action of a
+// file of size bytes in the statistics.
+func (fo *FileOrganizer) countTransferAs(action string, size int64) {
+	switch action {
+	case config.LinkModeHardlink, config.LinkModeSymlink:
+		fo.stats.IncrementFilesLinked()
+		fo.stats.AddBytesLinked(size)
+	case "move":
+		fo.stats.IncrementFilesMoved()
+		fo.stats.AddBytesMoved(size)
+	default:
+		fo.stats.IncrementFilesCopied()
+		fo.stats.AddBytesCopied(size)
+	}
+}
+
+// hardlinkFile creates a hard link to sourcePath at destPath.
+func (fo *FileOrganizer) hardlinkFile(sourcePath, destPath string) error {
+	if err := removeForLink(destPath); err != nil {
+		return err
+	}
+	err := os.Link(sourcePath, destPath)
+	if err != nil && isCrossDeviceError(err) {
+		return fmt.Errorf("cannot hardlink %s: source and target are on different filesystems "+
+			"(use link_mode: symlink, or keep source and target on one filesystem)", sourcePath)
+	}
+	return err
+}
+
+// symlinkFile creates a symbolic link to sourcePath at destPath. The link is
+// relative to destPath's directory unless absolute_symlinks is set.
+func (fo *FileOrganizer) symlinkFile(sourcePath, destPath string) error {
+	linkTarget, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return err
+	}
+	if !fo.config.Processing.AbsoluteSymlinks {
+		destDir, err := filepath.Abs(filepath.Dir(destPath))
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(destDir, linkTarget); err == nil {
+			linkTarget = rel
+		}
+	}
+
+	if err := removeForLink(destPath); err != nil {
+		return err
+	}
+	return explainSymlinkError(os.Symlink(linkTarget, destPath))
+}
+
+// removeForLink removes an existing file at path, since links, unlike
+// renames, cannot replace an existing file.
+func removeForLink(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
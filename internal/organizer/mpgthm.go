@@ -0,0 +1,102 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// xmpDateTemplate is the XMP sidecar written for a merged MPG video. Both
+// placeholders are the thumbnail's date in XMP date format.
+const xmpDateTemplate = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmp:CreateDate="%s"
+    exif:DateTimeOriginal="%s"/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`
+
+// shouldMergeThumbnail reports whether file is an MPG video whose THM thumbnail
+// should be merged into it.
+func (fo *FileOrganizer) shouldMergeThumbnail(file FileInfo) bool {
+	return fo.config.Video.MPGProcessing.EnableMerging && file.Extension == ".mpg" && file.Thumbnail() != ""
+}
+
+// mergeThumbnail transfers the EXIF date of an MPG video's THM thumbnail into
+// the video placed at targetPath: its modification time is set to that date
+// and an XMP sidecar recording it is written next to it (unless the video
+// has one). MPG containers have no standard writable date field, so the
+// sidecar carries the date for other tools. The source is never changed, so
+// a video that ends up skipped stays as it was; only a placed copy is. With
+// delete_thm_after_merge the thumbnail is then removed (or moved to the
+// trash) instead of following the video. The returned FileInfo reflects the
+// changes; on failure the error is recorded and file is returned unchanged.
+func (fo *FileOrganizer) mergeThumbnail(file FileInfo, targetPath string) FileInfo {
+	thumbnail := file.Thumbnail()
+	fail := func(err error) FileInfo {
+		fo.logger.Errorf("Could not merge %s into %s: %v", thumbnail, targetPath, err)
+		fo.stats.IncrementMPGTHMErrors()
+		fo.stats.AddError(file.Path, "mpg_thm_merge", err.Error())
+		return file
+	}
+
+	meta, err := fo.thumbnailMetadata(thumbnail)
+	if err != nil {
+		return fail(err)
+	}
+
+	if fo.config.Video.MPGProcessing.CreateBackup {
+		if err := fo.createBackup(targetPath); err != nil {
+			return fail(fmt.Errorf("backup failed: %w", err))
+		}
+	}
+
+	if err := os.Chtimes(targetPath, meta.Date, meta.Date); err != nil {
+		return fail(fmt.Errorf("set modification time: %w", err))
+	}
+	file.ModTime = meta.Date
+
+	if !hasSidecarSuffix(file, ".xmp") {
+		xmpPath := strings.TrimSuffix(targetPath, filepath.Ext(targetPath)) + ".xmp"
+		if _, err := os.Lstat(xmpPath); os.IsNotExist(err) {
+			date := meta.Date.Format("2006-01-02T15:04:05")
+			if err := os.WriteFile(xmpPath, []byte(fmt.Sprintf(xmpDateTemplate, date, date)), 0644); err != nil {
+				return fail(fmt.Errorf("write XMP sidecar: %w", err))
+			}
+		}
+	}
+
+	fo.stats.IncrementMPGTHMMerged()
+	fo.logger.Infof("Merged thumbnail %s into %s (date %s)", thumbnail, targetPath, meta.Date.Format(time.DateTime))
+
+	if fo.config.Video.MPGProcessing.DeleteTHMAfterMerge {
+		if err := fo.discardFile(thumbnail); err != nil {
+			fo.logger.Warnf("Could not delete merged thumbnail %s: %v", thumbnail, err)
+			fo.stats.AddError(thumbnail, "mpg_thm_merge", err.Error())
+			return file
+		}
+		file.Sidecars = slices.DeleteFunc(slices.Clone(file.Sidecars), func(s Sidecar) bool {
+			return s.IsThumbnail
+		})
+	}
+
+	return file
+}
+
+// hasSidecarSuffix reports whether file already has a sidecar with the given suffix.
+func hasSidecarSuffix(file FileInfo, suffix string) bool {
+	for _, sidecar := range file.Sidecars {
+		if strings.EqualFold(sidecar.Suffix, suffix) {
+			return true
+		}
+	}
+	return false
+}
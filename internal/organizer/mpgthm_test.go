@@ -0,0 +1,85 @@
+package organizer
+
+import (
+	"os"
+	"testing"
+
+	"photo-sorter-go/internal/config"
+)
+
+func TestMergeThumbnailChangesOnlyThePlacedVideo(t *testing.T) {
+	for _, move := range []bool{true, false} {
+		name := "copy"
+		if move {
+			name = "move"
+		}
+		t.Run(name, func(t *testing.T) {
+			tree := newTestTree(t)
+			video := tree.file("clip.mpg", []byte("not really an MPEG stream"))
+			thumbnail := tree.file("clip.thm", jpegWithDate(t, testDate, 0))
+			sourceBefore := snapshotTree(t, tree.Source)
+
+			cfg := tree.config()
+			cfg.Processing.MoveFiles = move
+			stats := organize(t, cfg)
+
+			placed := tree.target("2003/11/23/clip.mpg")
+			info, err := os.Stat(placed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(testDate) {
+				t.Errorf("placed video dated %v, want %v", info.ModTime(), testDate)
+			}
+			assertFile(t, tree.target("2003/11/23/clip.xmp"))
+			assertFile(t, tree.target("2003/11/23/clip.mpg.backup"))
+			assertFile(t, tree.target("2003/11/23/clip.thm"))
+			assertNoFile(t, tree.source("clip.xmp"))
+			assertNoFile(t, tree.source("clip.mpg.backup"))
+			if move {
+				assertNoFile(t, video)
+				assertNoFile(t, thumbnail)
+			} else {
+				assertTreeUnchanged(t, tree.Source, sourceBefore)
+			}
+			assertCount(t, "MPGTHMMerged", stats.MPGTHMMerged, 1)
+		})
+	}
+}
+
+func TestMergeThumbnailLeavesSkippedDuplicateAlone(t *testing.T) {
+	tree := newTestTree(t)
+	tree.file("clip.mpg", []byte("not really an MPEG stream"))
+	tree.file("clip.thm", jpegWithDate(t, testDate, 0))
+	tree.targetFile("2003/11/23/clip.mpg", []byte("organized before"))
+	sourceBefore := snapshotTree(t, tree.Source)
+	targetBefore := snapshotTree(t, tree.target("2003"))
+
+	cfg := tree.config()
+	cfg.Processing.DuplicateHandling = config.DuplicatePolicy{"default": config.DuplicateSkip}
+	cfg.Video.MPGProcessing.DeleteTHMAfterMerge = true
+	stats := organize(t, cfg)
+
+	assertTreeUnchanged(t, tree.Source, sourceBefore)
+	assertTreeUnchanged(t, tree.target("2003"), targetBefore)
+	assertCount(t, "MPGTHMMerged", stats.MPGTHMMerged, 0)
+	assertCount(t, "DuplicatesFound", stats.DuplicatesFound, 1)
+}
+
+func TestMergeThumbnailDeletesThumbnailAfterPlacing(t *testing.T) {
+	tree := newTestTree(t)
+	tree.file("clip.mpg", []byte("not really an MPEG stream"))
+	thumbnail := tree.file("clip.thm", jpegWithDate(t, testDate, 0))
+
+	cfg := tree.config()
+	cfg.Processing.MoveFiles = false
+	cfg.Video.MPGProcessing.DeleteTHMAfterMerge = true
+	cfg.Video.MPGProcessing.CreateBackup = false
+	organize(t, cfg)
+
+	assertFile(t, tree.target("2003/11/23/clip.mpg"))
+	assertFile(t, tree.target("2003/11/23/clip.xmp"))
+	assertNoFile(t, tree.target("2003/11/23/clip.thm"))
+	assertNoFile(t, tree.target("2003/11/23/clip.mpg.backup"))
+	assertNoFile(t, thumbnail)
+}
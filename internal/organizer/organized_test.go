@@ -0,0 +1,58 @@
+package organizer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestInPlaceSkipsOrganizedTrees(t *testing.T) {
+	tree := newTestTree(t)
+	organized := tree.photo("2003/11/23/IMG_0001.jpg", testDate.AddDate(1, 0, 0))
+	nested := tree.photo("random/02/IMG_0002.jpg", testDate)
+	loose := tree.photo("new/IMG_0003.jpg", testDate)
+
+	cfg := tree.config()
+	cfg.TargetDirectory = &tree.Source
+	stats := organize(t, cfg)
+
+	// The organized photo stays although its date is another one: its whole
+	// tree was pruned at 2003, not descended into.
+	assertFile(t, organized)
+	assertCount(t, "DirectoriesPruned", stats.DirectoriesPruned, 1)
+	// A date-like directory below other directories is not organized.
+	assertNoFile(t, nested)
+	assertFile(t, tree.source("2003/11/23/IMG_0002.jpg"))
+	assertNoFile(t, loose)
+	assertFile(t, tree.source("2003/11/23/IMG_0003.jpg"))
+	assertCount(t, "FilesOrganized", stats.FilesOrganized, 2)
+}
+
+func TestIsAlreadyOrganized(t *testing.T) {
+	tree := newTestTree(t)
+	cfg := tree.config()
+	cfg.DateFormat = "2006/01/02"
+	fo, _ := newTestOrganizer(t, cfg)
+
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{".", false},
+		{"2003", true},
+		{"2003/11", true},
+		{"2003/11/23", true},
+		{"2003/11/23/extra", false},
+		{"2003-11", true}, // another known format
+		{"02", false},
+		{"random/02", false},
+		{"random/2003", false},
+		{"2003/13", false},
+		{"../2003", false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(tree.Target, filepath.FromSlash(tt.rel))
+		if got := fo.isAlreadyOrganized(path); got != tt.want {
+			t.Errorf("isAlreadyOrganized(%s) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
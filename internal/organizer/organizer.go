@@ -1,25 +1,40 @@
 package organizer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"photo-sorter-go/internal/compressor"
 	"photo-sorter-go/internal/config"
 	"photo-sorter-go/internal/extractor"
+	"photo-sorter-go/internal/filetype"
+	"photo-sorter-go/internal/naming"
 	"photo-sorter-go/internal/statistics"
+	"photo-sorter-go/internal/trash"
 
 	"github.com/sirupsen/logrus"
 )
 
-// FileOrganizer organizes media files by date.
+// LogHookFunc receives the messages of planned and performed operations.
+//
+// Deprecated: add a logrus hook to the logger instead; it receives every
+// entry with its fields.
 type LogHookFunc func(level, message string)
 
+// FileOrganizer organizes media files by date.
 type FileOrganizer struct {
 	config     *config.Config
 	logger     *logrus.Logger
@@ -29,18 +44,67 @@ type FileOrganizer struct {
 	workerPool chan struct{}
 	compressor compressor.Compressor
 
+	hashWorkers     int // workers reading metadata and determining targets
+	transferWorkers int // workers placing files at their targets
+
 	logHook LogHookFunc // Новый хук для проброса логов
+
+	fileCounter int64 // sequence number for the {counter} filename token
+
+	orphanedSidecars   []string // sidecars found without a matching media file
+	discoveryTruncated bool     // discovery stopped early at max_files_per_run
+	lastDiscovered     string   // relative path of the last file discovered before the cap
+	discoveryDuration  time.Duration
+
+	movedFromDirs sync.Map // source directories files were moved out of
+
+	trash *trash.Trash // receives overwritten files when overwrite_to_trash is set
+
+	caseInsensitive bool // target paths differing only in case collide
+
+	reserved targetReservations // target paths with a transfer in progress
+
+	throttle *throttle // limits transfers per second; nil when unlimited
+
+	paths   []string // explicit files to organize instead of walking the source
+	sources []string // source directories walked, without repeats or nested ones
+
+	sourceConfigs []sourceConfig // settings of the sources entries
+
+	writeHandles writeHandles           // files open for writing, for strict_in_use_check
+	report       *Report                // records the outcome for each file; nil when not reporting
+	progressHook func(BatchProgress)    // called after each batch of files
+	currentFile  atomic.Pointer[string] // the file whose processing started last
+
+	out output // where files are placed: the target directory or an archive
+
+	targetOnce sync.Once // creates the target directory on first use
+	targetErr  error     // why the target directory could not be created
+
+	dirMu sync.Mutex // creates one target directory at a time, so each is counted once
 }
 
 // FileInfo contains information about a file to be organized.
 type FileInfo struct {
-	Path          string
-	Size          int64
-	ModTime       time.Time
-	IsVideo       bool
-	IsImage       bool
-	Extension     string
-	ThumbnailPath string
+	Path      string
+	Size      int64
+	ModTime   time.Time
+	IsVideo   bool
+	IsImage   bool
+	Extension string
+
+	// ContentExtension is the usual extension of the file's type when
+	// detect_file_type found that its extension does not match its content,
+	// and empty otherwise.
+	ContentExtension string
+
+	// Sidecars are metadata files (.xmp, .aae, .json) and THM thumbnails that
+	// follow this file wherever it is organized.
+	Sidecars []Sidecar
+
+	// Companions are files organized together with this one (e.g. the RAW half
+	// of a RAW+JPEG pair). They share the primary's date and target name.
+	Companions []Companion
 }
 
 // OrganizedFile represents a file that has been organized.
@@ -64,6 +128,8 @@ func NewFileOrganizer(
 }
 
 // NewFileOrganizerWithLogHook позволяет пробрасывать логи наружу (например, в WebSocket)
+//
+// Deprecated: use NewFileOrganizer and add a logrus hook to the logger.
 func NewFileOrganizerWithLogHook(
 	cfg *config.Config,
 	logger *logrus.Logger,
@@ -76,307 +142,923 @@ func NewFileOrganizerWithLogHook(
 	if workers <= 0 {
 		workers = 4
 	}
-	return &FileOrganizer{
-		config:     cfg,
-		logger:     logger,
-		stats:      stats,
-		extractor:  dateExtractor,
-		workers:    workers,
-		workerPool: make(chan struct{}, workers),
-		compressor: compressor,
-		logHook:    logHook,
+	hashWorkers := cfg.Performance.HashThreads
+	if hashWorkers <= 0 {
+		hashWorkers = workers
+	}
+	transferWorkers := cfg.Performance.TransferThreads
+	if transferWorkers <= 0 {
+		transferWorkers = workers
+	}
+	stats.SetDryRun(cfg.Security.DryRun)
+	stats.SetMaxErrors(cfg.Logging.MaxRecordedErrors)
+	fo := &FileOrganizer{
+		config:          cfg,
+		logger:          logger,
+		stats:           stats,
+		extractor:       dateExtractor,
+		workers:         workers,
+		workerPool:      make(chan struct{}, workers),
+		compressor:      compressor,
+		hashWorkers:     hashWorkers,
+		transferWorkers: transferWorkers,
+		logHook:         logHook,
+		trash:           trash.New(cfg.GetTargetDirectory(), time.Now()),
+		throttle:        newThrottle(cfg.Performance.MaxFilesPerSecond, cfg.GetMaxBytesPerSecond()),
+		sources:         cfg.GetSourceDirectories(),
+		sourceConfigs:   newSourceConfigs(cfg),
 	}
+	fo.out = dirOutput{fo}
+	return fo
 }
 
-// OrganizeFiles organizes all files in the source directory.
-func (fo *FileOrganizer) OrganizeFiles() error {
+// OrganizeFiles organizes all files in the source directory. Files are
+// processed while discovery is still running, so memory use does not grow
+// with the size of the tree. Cancelling ctx stops both discovery and the
+// workers; files already being processed are finished first.
+func (fo *FileOrganizer) OrganizeFiles(ctx context.Context) (err error) {
 	fo.logger.Info("Starting file organization process")
-	fo.stats.StartTime = time.Now()
 
-	files, err := fo.discoverFiles()
+	if err := fo.openOutput(); err != nil {
+		return err
+	}
+	defer fo.closeOutput(&err)
+
+	// Discovery fills the next batch while the workers process the current one.
+	batches := make(chan []FileInfo, 1)
+	processed := make(chan struct{})
+	go func() {
+		defer close(processed)
+		fo.processBatches(ctx, batches, fo.stages())
+	}()
+
+	var batch []FileInfo
+	queue := func(group []FileInfo) {
+		// Companions and sidecars travel inside their primary's FileInfo, so
+		// groups can be split between batches.
+		for _, file := range group {
+			batch = append(batch, file)
+			if len(batch) >= fo.config.Performance.BatchSize {
+				batches <- batch
+				batch = nil
+			}
+		}
+	}
+	err = fo.beginRun(ctx, nil)
+	if err == nil && ctx.Err() == nil {
+		err = fo.walkSource(ctx, queue)
+	}
+	if len(batch) > 0 {
+		batches <- batch
+	}
+	close(batches)
+	<-processed
+	fo.stats.SetDiscoveryComplete()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		fo.stats.Finalize()
+		fo.logger.Info("File organization cancelled")
+		return ctxErr
+	}
 	if err != nil {
+		fo.stats.Finalize()
+		if errors.Is(err, ErrInsufficientSpace) {
+			return err
+		}
 		return fmt.Errorf("failed to discover files: %w", err)
 	}
 
-	if len(files) == 0 {
+	if atomic.LoadInt64(&fo.stats.TotalFilesFound) == 0 {
 		fo.logger.Info("No media files found to organize")
+	}
+	fo.finishRun()
+	return nil
+}
+
+// beginRun prepares the target for a run whose files are known or about to
+// be walked: it starts the clock, detects a case-insensitive target, removes
+// temporary files left there by interrupted copies and checks that the files
+// fit, those given or, if files is nil, those in the sources.
+func (fo *FileOrganizer) beginRun(ctx context.Context, files []FileInfo) error {
+	// Discovery before a confirmation counts, the wait for it does not.
+	fo.stats.StartTime = time.Now().Add(-fo.discoveryDuration)
+
+	fo.caseInsensitive = fo.detectCaseInsensitiveTarget()
+	if fo.caseInsensitive {
+		fo.logger.Debug("Target is case-insensitive, comparing file names without case")
+	}
+	if fo.config.Security.DryRun {
+		fo.logger.Info("Running in dry-run mode - no files will be moved or modified")
+		fo.reportNewTarget()
+	}
+
+	if err := fo.sweepTargetTempFiles(ctx); err != nil {
+		return err
+	}
+	if !fo.needsSpaceCheck() {
 		return nil
 	}
+	if files != nil {
+		return fo.checkSpace(files)
+	}
+	// Nothing is processed before the space needed is known, which takes a
+	// walk of its own.
+	return fo.checkSourceSpace(ctx)
+}
+
+// finishRun handles what is left once every file of a run is processed:
+// orphaned sidecars, empty source directories and the discovery cursor.
+func (fo *FileOrganizer) finishRun() {
+	fo.processOrphanedSidecars()
+	if fo.config.Processing.RemoveEmptyDirs && !fo.config.Security.DryRun {
+		fo.removeEmptyDirs()
+	}
+	fo.updateCursor()
 
+	fo.stats.Finalize()
+	fo.logger.Info("File organization completed")
+}
+
+// DiscoverFiles finds the media files to organize without changing anything,
+// so that they can be reviewed before being passed to ProcessDiscoveredFiles.
+func (fo *FileOrganizer) DiscoverFiles() ([]FileInfo, error) {
+	fo.logger.Info("Starting file organization process")
+	started := time.Now()
+
+	files, err := fo.discoverFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover files: %w", err)
+	}
+
+	fo.discoveryDuration = time.Since(started)
+	fo.stats.SetDiscoveryComplete()
+	return files, nil
+}
+
+// ProcessDiscoveredFiles organizes files returned by DiscoverFiles, like
+// OrganizeFiles: cancelling ctx stops the workers once the files being
+// processed are finished.
+func (fo *FileOrganizer) ProcessDiscoveredFiles(ctx context.Context, files []FileInfo) (err error) {
+	if len(files) == 0 {
+		fo.stats.StartTime = time.Now().Add(-fo.discoveryDuration)
+		fo.logger.Info("No media files found to organize")
+		fo.updateCursor()
+		fo.stats.Finalize()
+		return nil
+	}
 	fo.logger.Infof("Found %d media files to process", len(files))
-	fo.stats.TotalFilesFound = int64(len(files))
 
-	if fo.config.Security.DryRun {
-		fo.logger.Info("Running in dry-run mode - no files will be moved or modified")
-		return fo.dryRunProcess(files)
+	if err := fo.openOutput(); err != nil {
+		fo.stats.Finalize()
+		return err
+	}
+	defer fo.closeOutput(&err)
+	if err := fo.beginRun(ctx, files); err != nil {
+		fo.stats.Finalize()
+		return err
 	}
 
-	return fo.processFiles(files)
+	fo.runBatches(ctx, files, fo.stages())
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		fo.stats.Finalize()
+		fo.logger.Info("File organization cancelled")
+		return ctxErr
+	}
+	fo.finishRun()
+	return nil
+}
+
+// relativeSourcePath returns path relative to its source directory.
+func (fo *FileOrganizer) relativeSourcePath(path string) string {
+	rel, err := filepath.Rel(fo.sourceRoot(path), path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// sourceRoot returns the source directory path was found in, or the first
+// one for paths outside all of them.
+func (fo *FileOrganizer) sourceRoot(path string) string {
+	for _, source := range fo.sources {
+		if path == source || isInsideDir(source, path) {
+			return source
+		}
+	}
+	return fo.config.SourceDirectory
 }
 
 // discoverFiles finds all media files in the source directory.
 func (fo *FileOrganizer) discoverFiles() ([]FileInfo, error) {
 	var files []FileInfo
-	var mutex sync.Mutex
+	err := fo.walkSource(context.Background(), func(group []FileInfo) {
+		files = append(files, group...)
+	})
+	return files, err
+}
 
-	err := filepath.Walk(fo.config.SourceDirectory, func(path string, info os.FileInfo, err error) error {
+// dirBatch holds what has been found in one directory so far.
+type dirBatch struct {
+	files              []FileInfo
+	sidecars, filtered []string
+}
+
+// walkSource finds the media files in the source directories and passes them to
+// emit one directory at a time, already grouped with their companions and
+// sidecars (which always live in the same directory). A directory is emitted as
+// soon as the walk has left it, so files can be processed while discovery is
+// still running. The walk stops early when ctx is cancelled.
+func (fo *FileOrganizer) walkSource(ctx context.Context, emit func([]FileInfo)) error {
+	if paths := fo.explicitPaths(); paths != nil {
+		return fo.listSource(ctx, paths, emit)
+	}
+
+	resumeAfter := fo.loadCursor()
+	var capDir string
+	var found int
+	fo.discoveryTruncated = false
+	fo.orphanedSidecars = nil
+
+	batches := make(map[string]*dirBatch)
+	batch := func(dir string) *dirBatch {
+		b, ok := batches[dir]
+		if !ok {
+			b = &dirBatch{}
+			batches[dir] = b
+		}
+		return b
+	}
+	// flush emits the batches of all directories the walk has left, i.e. all
+	// but current and its ancestors. An empty current flushes everything.
+	flush := func(current string) {
+		var done []string
+		for dir := range batches {
+			if current == "" || (dir != current && !isAncestorDir(dir, current)) {
+				done = append(done, dir)
+			}
+		}
+		sort.Strings(done)
+		for _, dir := range done {
+			b := batches[dir]
+			delete(batches, dir)
+			if group := fo.groupFiles(b.files, b.sidecars, b.filtered); len(group) > 0 {
+				emit(group)
+			}
+		}
+	}
+
+	walk := func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
 			fo.logger.Warnf("Error accessing path %s: %v", path, err)
 			return nil
 		}
 
 		if info.IsDir() {
-			fo.stats.IncrementDirectoriesScanned()
+			if fo.isExcludedDir(path) {
+				return filepath.SkipDir
+			}
+			if fo.isIgnoredHidden(path) {
+				fo.logger.Debugf("Skipping hidden directory: %s", path)
+				return filepath.SkipDir
+			}
+			if fo.matchesExcludePattern(path) {
+				fo.logger.Debugf("Skipping directory matching an exclude pattern: %s", path)
+				fo.stats.IncrementFilteredByPattern()
+				return filepath.SkipDir
+			}
+			if rel := fo.relativeSourcePath(path); resumeAfter != "" && rel != "." &&
+				walkOrderLess(rel, resumeAfter) && !isAncestorDir(rel, resumeAfter) {
+				return filepath.SkipDir
+			}
+			if fo.discoveryTruncated && !fo.config.Security.DryRun {
+				return filepath.SkipDir
+			}
 			if fo.config.Processing.SkipOrganized && fo.isAlreadyOrganized(path) {
 				fo.logger.Debugf("Skipping already organized directory: %s", path)
+				fo.stats.IncrementDirectoriesPruned()
 				return filepath.SkipDir
 			}
+			fo.stats.IncrementDirectoriesScanned()
+			flush(path)
 			return nil
 		}
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if !fo.isSupportedFile(ext) {
+		dir := filepath.Dir(path)
+		flush(dir)
+
+		if strings.HasSuffix(path, tempSuffix) {
+			fo.removeStaleTempFile(path)
 			return nil
 		}
+		if fo.skipHidden(path) {
+			return nil
+		}
+
+		rel := fo.relativeSourcePath(path)
+		if resumeAfter != "" && !walkOrderLess(resumeAfter, rel) {
+			return nil
+		}
+		// After the cap is reached, only the rest of the last directory is read
+		// (for sidecars of the files already found), unless counting what remains.
+		if fo.discoveryTruncated && dir != capDir && !fo.config.Security.DryRun {
+			return filepath.SkipAll
+		}
 
-		fileInfo := FileInfo{
-			Path:      path,
-			Size:      info.Size(),
-			ModTime:   info.ModTime(),
-			Extension: ext,
-			IsImage:   fo.config.IsImageExtension(ext),
-			IsVideo:   fo.config.IsVideoExtension(ext),
+		ext := strings.ToLower(filepath.Ext(path))
+		if !fo.isSupportedFile(ext) {
+			if fo.isSidecarFile(ext) && (!fo.discoveryTruncated || dir == capDir) {
+				b := batch(dir)
+				b.sidecars = append(b.sidecars, path)
+			}
+			return nil
 		}
 
-		if fileInfo.IsVideo && ext == ".mpg" {
-			thmPath := strings.TrimSuffix(path, ext) + ".thm"
-			if _, err := os.Stat(thmPath); err == nil {
-				fileInfo.ThumbnailPath = thmPath
-				fo.stats.IncrementThumbnailsFound()
+		if fo.discoveryTruncated {
+			if fo.passesFilters(path, info) {
+				fo.stats.IncrementFilesRemaining()
 			}
+			return nil
 		}
 
-		mutex.Lock()
-		files = append(files, fileInfo)
-		fo.stats.IncrementFilesFound()
-		if fileInfo.IsVideo {
-			fo.stats.IncrementVideoFilesFound()
+		if !fo.passesFilters(path, info) {
+			fo.stats.IncrementFilesSkipped()
+			b := batch(dir)
+			b.filtered = append(b.filtered, path)
+			return nil
 		}
-		fo.stats.IncrementFileType(strings.ToUpper(strings.TrimPrefix(ext, ".")))
-		mutex.Unlock()
 
-		if fo.config.Security.MaxFilesPerRun > 0 && len(files) >= fo.config.Security.MaxFilesPerRun {
+		b := batch(dir)
+		b.files = append(b.files, fo.newFileInfo(path, info))
+		found++
+
+		if fo.config.Security.MaxFilesPerRun > 0 && found >= fo.config.Security.MaxFilesPerRun {
 			fo.logger.Infof("Reached maximum files limit (%d), stopping discovery", fo.config.Security.MaxFilesPerRun)
-			return filepath.SkipAll
+			fo.discoveryTruncated = true
+			fo.lastDiscovered = rel
+			capDir = dir
 		}
 
 		return nil
-	})
+	}
 
-	return files, err
+	var err error
+	for _, source := range fo.sources {
+		if err = fo.walkTree(source, walk); err != nil {
+			break
+		}
+		flush("")
+	}
+	return err
 }
 
-// processFiles processes all discovered files.
-func (fo *FileOrganizer) processFiles(files []FileInfo) error {
-	var wg sync.WaitGroup
-	fileChan := make(chan FileInfo, fo.config.Performance.BatchSize)
-
-	for i := 0; i < fo.workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			fo.worker(fileChan)
-		}()
+// groupFiles pairs discovered files with their companions and sidecars.
+// Files grouped into another no longer count as found on their own, so the
+// found count matches the number of files handed to the workers.
+func (fo *FileOrganizer) groupFiles(files []FileInfo, sidecars, filtered []string) []FileInfo {
+	found := len(files)
+	// The files of a group come from one directory, so from one source.
+	if len(files) > 0 && fo.configFor(files[0].Path).Processing.PairRawJPEG {
+		files = fo.pairRawJPEG(files)
+	}
+	if fo.config.Processing.PairLivePhotos {
+		files = fo.pairLivePhotos(files)
 	}
+	files = fo.attachSidecars(files, sidecars, filtered)
+	if grouped := found - len(files); grouped > 0 {
+		fo.stats.AddFilesFound(-int64(grouped))
+	}
+	return files
+}
 
-	go func() {
-		defer close(fileChan)
-		for _, file := range files {
-			fileChan <- file
+// matchesExcludePattern reports whether file, a file or directory below a
+// source directory, matches one of the exclude_patterns of its source: by
+// name for patterns without a slash, by its path relative to the source
+// otherwise.
+func (fo *FileOrganizer) matchesExcludePattern(file string) bool {
+	patterns := fo.configFor(file).Processing.ExcludePatterns
+	if len(patterns) == 0 {
+		return false
+	}
+	rel := filepath.ToSlash(fo.relativeSourcePath(file))
+	if rel == "." {
+		return false
+	}
+	name := filepath.Base(file)
+	for _, pattern := range patterns {
+		subject := name
+		if strings.Contains(pattern, "/") {
+			subject = rel
 		}
-	}()
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
 
-	wg.Wait()
+// isExcludedDir reports whether a directory holds the organizer's own output
+// (orphaned sidecars, unsorted files, trash) and must not be organized again.
+func (fo *FileOrganizer) isExcludedDir(path string) bool {
+	target := fo.config.GetTargetDirectory()
+	switch {
+	case fo.config.Processing.CollectOrphanedSidecars &&
+		path == filepath.Join(target, fo.config.Processing.OrphanedSidecarsFolder):
+		return true
+	case fo.config.Processing.UnsortedDirectory != "" &&
+		path == filepath.Join(target, fo.config.Processing.UnsortedDirectory):
+		return true
+	default:
+		return path == trash.Dir(target)
+	}
+}
 
-	fo.stats.Finalize()
-	fo.logger.Info("File organization completed")
-	return nil
+// newFileInfo returns the FileInfo for a discovered media file and counts it
+// in the statistics.
+func (fo *FileOrganizer) newFileInfo(path string, info os.FileInfo) FileInfo {
+	ext := strings.ToLower(filepath.Ext(path))
+	fileInfo := FileInfo{
+		Path:      path,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Extension: ext,
+		IsImage:   fo.config.IsImageExtension(ext),
+		IsVideo:   fo.config.IsVideoExtension(ext),
+	}
+	if fo.config.Processing.DetectFileType {
+		fo.detectFileType(&fileInfo)
+	}
+
+	fo.stats.IncrementFilesFound()
+	if fileInfo.IsVideo {
+		fo.stats.IncrementVideoFilesFound()
+	}
+	typeExt := ext
+	if fileInfo.ContentExtension != "" {
+		typeExt = fileInfo.ContentExtension
+	}
+	fo.stats.RecordFileType(strings.ToUpper(strings.TrimPrefix(typeExt, ".")), path, fileInfo.Size)
+	return fileInfo
+}
+
+// detectFileType reads the first bytes of file to find its type. If its
+// extension does not match, the type decides whether it is an image or a
+// video, and its extension is set as the file's ContentExtension. Files of
+// types that are not recognized keep what their extension says.
+func (fo *FileOrganizer) detectFileType(file *FileInfo) {
+	t, err := filetype.Detect(file.Path)
+	if err != nil {
+		fo.logger.Debugf("Could not detect the type of %s: %v", file.Path, err)
+		return
+	}
+	if t == nil || t.Matches(file.Extension) {
+		return
+	}
+	fo.logger.Infof("%s has the wrong extension: its content is %s", file.Path, t.Name)
+	fo.stats.IncrementMismatchedExtensions()
+	file.ContentExtension = t.Extension
+	file.IsImage, file.IsVideo = !t.Video, t.Video
+}
+
+// contentName returns name, the target name of file, with the extension of
+// its content when fix_extensions is on and its own does not match. An
+// upper-case extension is replaced by an upper-case one.
+func (fo *FileOrganizer) contentName(file FileInfo, name string) string {
+	if !fo.config.Processing.FixExtensions || file.ContentExtension == "" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	fixed := file.ContentExtension
+	if ext != "" && ext == strings.ToUpper(ext) {
+		fixed = strings.ToUpper(fixed)
+	}
+	return strings.TrimSuffix(name, ext) + fixed
 }
 
-// worker processes files from the channel.
-func (fo *FileOrganizer) worker(fileChan <-chan FileInfo) {
-	for file := range fileChan {
-		fo.processFile(file)
+// passesFilters reports whether a file satisfies the configured exclude
+// patterns and size and age filters.
+func (fo *FileOrganizer) passesFilters(path string, info os.FileInfo) bool {
+	if fo.matchesExcludePattern(path) {
+		fo.logger.Debugf("Skipping %s: matches an exclude pattern", path)
+		fo.stats.IncrementFilteredByPattern()
+		return false
+	}
+
+	if minSize := fo.config.GetMinFileSize(); minSize > 0 && info.Size() < minSize {
+		fo.logger.Debugf("Skipping %s: size %d is below minimum %d", path, info.Size(), minSize)
+		fo.stats.IncrementFilteredBySize()
+		return false
+	}
+
+	age := time.Since(info.ModTime())
+	if minAge := fo.config.Processing.MinAge; minAge > 0 && age < minAge {
+		fo.logger.Debugf("Skipping %s: age %v is below min_age %v", path, age, minAge)
+		fo.stats.IncrementFilteredByMinAge()
+		return false
 	}
+	if maxAge := fo.config.Processing.MaxAge; maxAge > 0 && age > maxAge {
+		fo.logger.Debugf("Skipping %s: age %v exceeds max_age %v", path, age, maxAge)
+		fo.stats.IncrementFilteredByMaxAge()
+		return false
+	}
+
+	return true
+}
+
+// safeProcess runs process on file, recording a panic (e.g. from a metadata
+// parser choking on a corrupt file) as an error for that file instead of
+// crashing the whole run.
+func (fo *FileOrganizer) safeProcess(file FileInfo, process func(FileInfo)) {
+	defer func() {
+		if r := recover(); r != nil {
+			fo.logger.Errorf("Panic while processing %s: %v", file.Path, r)
+			fo.stats.IncrementFilesWithErrors()
+			fo.stats.AddError(file.Path, "panic", fmt.Sprintf("%v\n%s", r, debug.Stack()))
+		}
+	}()
+	process(file)
 }
 
 // processFile processes a single file.
 func (fo *FileOrganizer) processFile(file FileInfo) {
+	if job, ok := fo.prepareFile(file); ok {
+		fo.placeFile(job)
+	}
+}
+
+// prepareFile reads a file's metadata and determines its target path. It
+// reports false if the file is not to be placed.
+func (fo *FileOrganizer) prepareFile(file FileInfo) (fileJob, bool) {
 	fo.logger.Debugf("Processing file: %s", file.Path)
 	fo.stats.IncrementFilesProcessed()
+	if fo.skipInUse(file) {
+		return fileJob{}, false
+	}
 
-	date, err := fo.extractDate(file)
+	var targetPath, reason string
+	meta, err := fo.extractMetadata(file)
 	if err != nil {
 		fo.logger.Warnf("Could not extract date from %s: %v", file.Path, err)
 		fo.stats.IncrementFilesWithoutDates()
-		fo.stats.AddError(file.Path, "date_extraction", err.Error())
-		return
+		if fo.config.Processing.UnsortedDirectory == "" {
+			fo.stats.AddError(file.Path, "date_extraction", err.Error())
+			fo.reportFile(file, "", ReportActionNoDate, err.Error(), nil)
+			return fileJob{}, false
+		}
+		targetPath, reason = fo.unsortedTargetPath(file), "no date"
+	} else {
+		targetPath, err = fo.generateTargetPath(file, meta)
+		if err != nil {
+			fo.logger.Errorf("Could not generate target path for %s: %v", file.Path, err)
+			fo.stats.IncrementFilesWithErrors()
+			fo.stats.AddError(file.Path, "path_generation", err.Error())
+			fo.reportFile(file, "", ReportActionError, err.Error(), meta)
+			return fileJob{}, false
+		}
+		fo.stats.IncrementDateFolder(fo.dateFolder(file, meta))
 	}
+	return fileJob{file: file, meta: meta, targetPath: targetPath, reason: reason}, true
+}
 
-	targetPath, err := fo.generateTargetPath(file, *date)
-	if err != nil {
-		fo.logger.Errorf("Could not generate target path for %s: %v", file.Path, err)
-		fo.stats.IncrementFilesWithErrors()
-		fo.stats.AddError(file.Path, "path_generation", err.Error())
-		return
-	}
+// placeFile moves, copies or links a prepared file to its target, resolving
+// duplicates, and takes its companions and sidecars along.
+func (fo *FileOrganizer) placeFile(job fileJob) {
+	file, meta, targetPath := job.file, job.meta, job.targetPath
 
-	if fo.fileExistsAtTarget(file.Path, targetPath) {
-		if err := fo.handleDuplicate(file, targetPath); err != nil {
-			fo.logger.Errorf("Error handling duplicate for %s: %v", file.Path, err)
-			fo.stats.IncrementFilesWithErrors()
-			fo.stats.AddError(file.Path, "duplicate_handling", err.Error())
-		}
-		return
+	// Reserve the target so that no other worker picks the same name before
+	// this file arrives there; if another worker holds it, this file is a duplicate.
+	reserved := fo.reserveTarget(targetPath)
+	if reserved {
+		defer fo.releaseTarget(targetPath)
 	}
 
+	// The directory is created first: when another worker holds the target,
+	// a renamed duplicate may reach the directory before that worker has
+	// created it.
 	targetDir := filepath.Dir(targetPath)
 	if err := fo.createDirectory(targetDir); err != nil {
 		fo.logger.Errorf("Could not create directory %s: %v", targetDir, err)
 		fo.stats.IncrementFilesWithErrors()
 		fo.stats.AddError(file.Path, "directory_creation", err.Error())
+		fo.reportFile(file, targetPath, ReportActionError, err.Error(), meta)
 		return
 	}
 
-	if fo.config.Security.DryRun {
-		// Всегда только логируем, никаких реальных действий!
-		var msg string
-		if fo.config.Processing.MoveFiles {
-			msg = fmt.Sprintf("DRY-RUN: Would move %s -> %s", file.Path, targetPath)
+	if !reserved || fo.fileExistsAtTarget(file.Path, targetPath) || fo.companionsTaken(file, targetPath, nil) {
+		finalPath, err := fo.handleDuplicate(file, targetPath, reserved)
+		if err != nil {
+			fo.logger.Errorf("Error handling duplicate for %s: %v", file.Path, err)
+			fo.stats.IncrementFilesWithErrors()
+			fo.stats.AddError(file.Path, "duplicate_handling", err.Error())
+			fo.reportFile(file, targetPath, ReportActionError, err.Error(), meta)
+			return
+		}
+		if finalPath != "" {
+			finalPath = fo.compressPlaced(file, finalPath)
+			if fo.shouldMergeThumbnail(file) && !fo.config.Security.DryRun {
+				file = fo.mergeThumbnail(file, finalPath)
+			}
+			fo.processCompanions(file, finalPath)
+			fo.processSidecars(file, finalPath)
+			fo.reportFile(file, finalPath, ReportActionDuplicate, fo.duplicateStrategy(file), meta)
 		} else {
-			msg = fmt.Sprintf("DRY-RUN: Would copy %s -> %s", file.Path, targetPath)
+			fo.reportFile(file, targetPath, ReportActionDuplicate, fo.skipReason(file, targetPath, reserved), meta)
 		}
+		return
+	}
+
+	if fo.config.Security.DryRun {
+		// Всегда только логируем, никаких реальных действий!
+		msg := fmt.Sprintf("DRY-RUN: Would %s %s -> %s", fo.transferAction(file.Path), file.Path, targetPath)
 		fo.logger.Infof(msg)
 		if fo.logHook != nil {
 			fo.logHook("info", msg)
 		}
+		fo.stats.AddBytesWouldProcess(file.Size)
 	} else {
-		if fo.config.Processing.MoveFiles {
-			if err := fo.moveFile(file.Path, targetPath); err != nil {
-				fo.logger.Errorf("Could not move file %s to %s: %v", file.Path, targetPath, err)
-				fo.stats.IncrementFilesWithErrors()
-				fo.stats.AddError(file.Path, "move_file", err.Error())
-				return
-			}
-			fo.stats.IncrementFilesMoved()
-		} else {
-			if err := fo.copyFile(file.Path, targetPath); err != nil {
-				fo.logger.Errorf("Could not copy file %s to %s: %v", file.Path, targetPath, err)
-				fo.stats.IncrementFilesWithErrors()
-				fo.stats.AddError(file.Path, "copy_file", err.Error())
-				return
-			}
-			fo.stats.IncrementFilesCopied()
+		if err := fo.transferFile(file.Path, targetPath); err != nil {
+			action := fo.transferAction(file.Path)
+			fo.logger.Errorf("Could not %s file %s to %s: %v", action, file.Path, targetPath, err)
+			fo.stats.IncrementFilesWithErrors()
+			fo.stats.AddError(file.Path, action+"_file", err.Error())
+			fo.reportFile(file, targetPath, ReportActionError, err.Error(), meta)
+			return
 		}
+		fo.countTransfer(file.Path, file.Size)
 	}
-
-	if file.ThumbnailPath != "" {
-		fo.processThumbnail(file, targetPath)
+	targetPath = fo.compressPlaced(file, targetPath)
+	if fo.shouldMergeThumbnail(file) && !fo.config.Security.DryRun {
+		file = fo.mergeThumbnail(file, targetPath)
 	}
 
+	fo.processCompanions(file, targetPath)
+	fo.processSidecars(file, targetPath)
+
 	fo.stats.IncrementFilesOrganized()
-	fo.stats.AddBytesProcessed(file.Size)
+	fo.recordPlacement(targetPath, file.Size, false)
+	fo.reportFile(file, targetPath, fo.transferAction(file.Path), job.reason, meta)
 	fo.logger.Infof("Organized file: %s -> %s", file.Path, targetPath)
 }
 
-// extractDate extracts the date from a file using the configured extractor.
-func (fo *FileOrganizer) extractDate(file FileInfo) (*time.Time, error) {
-	if !fo.extractor.SupportsFile(file.Path) {
+// extractMetadata extracts the date and, when supported, camera fields from a file
+// using the configured extractor.
+func (fo *FileOrganizer) extractMetadata(file FileInfo) (*extractor.Metadata, error) {
+	meta, err := fo.readMetadata(file.Path, file.ContentExtension)
+	if err != nil || meta.Source == extractor.DateSourceFileModTime {
+		if thumbnail := file.Thumbnail(); thumbnail != "" {
+			if thumbMeta, thumbErr := fo.thumbnailMetadata(thumbnail); thumbErr == nil {
+				meta, err = thumbMeta, nil
+			}
+		}
+	}
+	if err != nil {
+		fo.stats.IncrementDateExtractionErrors()
+		return nil, err
+	}
+
+	if meta.Source == extractor.DateSourceFileModTime && !fo.config.Processing.UseModTimeFallback {
+		fo.stats.IncrementDateExtractionErrors()
+		return nil, fmt.Errorf("no date found in file metadata")
+	}
+
+	switch meta.Source {
+	case extractor.DateSourceFileModTime:
+		fo.stats.IncrementDateFromModTime()
+	case extractor.DateSourceTakeoutJSON:
+		fo.stats.IncrementDateFromTakeoutJSON()
+	case extractor.DateSourceVideoMetadata:
+		fo.stats.IncrementDateFromVideoMeta()
+	case extractor.DateSourceThumbnail:
+		fo.stats.IncrementDateFromThumbnail()
+	case extractor.DateSourceFileName:
+		fo.stats.IncrementDateFromFileName()
+	default:
+		fo.stats.IncrementDateFromEXIF()
+	}
+	return meta, nil
+}
+
+// readMetadata extracts metadata from a single file with the configured
+// extractor. A file whose content was found to be of another type than its
+// extension says is read as that type, with contentExt its extension.
+func (fo *FileOrganizer) readMetadata(path, contentExt string) (*extractor.Metadata, error) {
+	if typed, ok := fo.extractor.(extractor.TypedExtractor); ok && contentExt != "" {
+		if !typed.SupportsExtension(contentExt) {
+			return nil, fmt.Errorf("file type not supported by extractor")
+		}
+		return typed.ExtractMetadataAs(path, contentExt)
+	}
+	if !fo.extractor.SupportsFile(path) {
 		return nil, fmt.Errorf("file type not supported by extractor")
 	}
 
-	date, err := fo.extractor.ExtractDate(file.Path)
+	if me, ok := fo.extractor.(extractor.MetadataExtractor); ok {
+		return me.ExtractMetadata(path)
+	}
+	date, err := fo.extractor.ExtractDate(path)
 	if err != nil {
-		fo.stats.IncrementDateExtractionErrors()
 		return nil, err
 	}
+	return &extractor.Metadata{Date: *date}, nil
+}
 
-	fo.stats.IncrementDateFromEXIF()
-	return date, nil
+// thumbnailMetadata returns the EXIF date and camera of a video's THM thumbnail.
+func (fo *FileOrganizer) thumbnailMetadata(path string) (*extractor.Metadata, error) {
+	meta, err := fo.readMetadata(path, "")
+	if err != nil {
+		return nil, err
+	}
+	if meta.Source == extractor.DateSourceFileModTime {
+		return nil, fmt.Errorf("thumbnail %s has no EXIF date", path)
+	}
+	meta.Source = extractor.DateSourceThumbnail
+	return meta, nil
 }
 
-// generateTargetPath returns the target path for a file based on its date.
-func (fo *FileOrganizer) generateTargetPath(file FileInfo, date time.Time) (string, error) {
+// generateTargetPath returns the target path for a file based on its metadata.
+func (fo *FileOrganizer) generateTargetPath(file FileInfo, meta *extractor.Metadata) (string, error) {
 	targetDir := fo.config.GetTargetDirectory()
-	dateSubdir := date.Format(fo.config.DateFormat)
-	fullTargetDir := filepath.Join(targetDir, dateSubdir)
-	filename := filepath.Base(file.Path)
+	dateSubdir := fo.dateLayout(fo.configFor(file.Path).DateFormat).Format(meta.Date)
+	if strings.Contains(dateSubdir, config.CameraToken) {
+		dateSubdir = strings.ReplaceAll(dateSubdir, config.CameraToken, fo.cameraFolder(meta))
+	} else if fo.config.Processing.GroupByCamera {
+		dateSubdir = filepath.Join(dateSubdir, fo.cameraFolder(meta))
+	}
+	fullTargetDir := filepath.Join(targetDir, dateSubdir, fo.sourceSubdir(file))
+	filename := fo.generateFilename(file, meta)
 	return filepath.Join(fullTargetDir, filename), nil
 }
 
+// dateFolder returns the date folders of file by meta's date, such as
+// "2021/08", without the camera folder date_format may include.
+func (fo *FileOrganizer) dateFolder(file FileInfo, meta *extractor.Metadata) string {
+	folder := strings.ReplaceAll(fo.configFor(file.Path).DateFormat, config.CameraToken, "")
+	return path.Clean(filepath.ToSlash(fo.dateLayout(folder).Format(meta.Date)))
+}
+
+// dateLayout returns the compiled form of format, a validated date_format.
+func (fo *FileOrganizer) dateLayout(format string) naming.DateLayout {
+	layout, err := naming.ParseDateLayout(format)
+	if err != nil {
+		// Only reached with a configuration that was not validated.
+		fo.logger.Debugf("Invalid date format %s: %v", format, err)
+		layout, _ = naming.ParseDateLayout(config.DefaultConfig().DateFormat)
+	}
+	return layout
+}
+
+// sourceSubdir returns the part of the directory file was found in that
+// preserve_source_subdir keeps below the date folders, with each component
+// sanitized, or "" for files directly in the source directory.
+func (fo *FileOrganizer) sourceSubdir(file FileInfo) string {
+	mode := fo.config.Processing.PreserveSourceSubdir
+	if mode != config.PreserveSubdirLast && mode != config.PreserveSubdirRelative {
+		return ""
+	}
+	rel, err := filepath.Rel(fo.sourceRoot(file.Path), filepath.Dir(file.Path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if mode == config.PreserveSubdirLast {
+		parts = parts[len(parts)-1:]
+	}
+	var kept []string
+	for _, part := range parts {
+		if part = naming.SanitizeComponent(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return filepath.Join(kept...)
+}
+
+// unsortedTargetPath returns the target path for a file without a date: its path
+// relative to its source directory, under the unsorted directory.
+func (fo *FileOrganizer) unsortedTargetPath(file FileInfo) string {
+	rel, err := filepath.Rel(fo.sourceRoot(file.Path), file.Path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(file.Path)
+	}
+	return filepath.Join(fo.config.GetTargetDirectory(), fo.config.Processing.UnsortedDirectory, fo.contentName(file, rel))
+}
+
+// cameraFolder returns the folder name for the camera that took a file,
+// or the configured fallback when no camera metadata is available.
+func (fo *FileOrganizer) cameraFolder(meta *extractor.Metadata) string {
+	if camera := naming.SanitizeComponent(meta.Camera()); camera != "" {
+		return camera
+	}
+	return fo.config.Processing.UnknownCameraFolder
+}
+
+// generateFilename returns the target file name, applying the filename template if configured.
+func (fo *FileOrganizer) generateFilename(file FileInfo, meta *extractor.Metadata) string {
+	filename := fo.contentName(file, filepath.Base(file.Path))
+	tmpl := fo.configFor(file.Path).Processing.FilenameTemplate
+	if tmpl == "" {
+		return filename
+	}
+
+	ext := filepath.Ext(filename)
+	return naming.ExpandFilenameTemplate(tmpl, naming.FilenameVars{
+		Date:     meta.Date,
+		Original: strings.TrimSuffix(filename, ext),
+		Ext:      ext,
+		Counter:  atomic.AddInt64(&fo.fileCounter, 1),
+		Camera:   fo.cameraFolder(meta),
+	})
+}
+
 // fileExistsAtTarget returns true if a file already exists at the target location.
 func (fo *FileOrganizer) fileExistsAtTarget(sourcePath, targetPath string) bool {
-	if sourcePath == targetPath {
+	if fo.samePath(sourcePath, targetPath) || strings.HasSuffix(targetPath, tempSuffix) {
 		return false
 	}
-	_, err := os.Stat(targetPath)
-	return err == nil
+	return fo.targetExists(targetPath)
 }
 
 // handleDuplicate handles duplicate files according to configuration.
-func (fo *FileOrganizer) handleDuplicate(file FileInfo, targetPath string) error {
+// reserved tells whether the caller holds the reservation of targetPath.
+// It returns the path the file was written to, or "" if the file was skipped.
+func (fo *FileOrganizer) handleDuplicate(file FileInfo, targetPath string, reserved bool) (string, error) {
 	fo.stats.IncrementDuplicatesFound()
 
-	switch fo.config.Processing.DuplicateHandling {
-	case "skip":
+	category := fo.duplicateCategory(file.Extension, file.IsVideo)
+	switch strategy := fo.config.Processing.DuplicateHandling.For(category); strategy {
+	case config.DuplicateSkip:
 		fo.logger.Infof("Skipping duplicate file: %s", file.Path)
-		fo.stats.IncrementDuplicatesSkipped()
+		fo.stats.IncrementDuplicatesSkipped(category)
 		fo.stats.IncrementFilesSkipped()
-		return nil
-
-	case "overwrite":
+		fo.stats.AddBytesSkipped(file.Size)
+		return "", nil
+
+	case config.DuplicateOverwrite:
+		if !reserved {
+			// Wait for the other worker's file to arrive, then replace it.
+			fo.reserved.reserve(fo.claimKey(targetPath))
+			defer fo.releaseTarget(targetPath)
+		}
 		fo.logger.Infof("Overwriting existing file: %s", targetPath)
-		if fo.config.Processing.MoveFiles {
-			err := fo.moveFile(file.Path, targetPath)
-			if err == nil {
-				fo.stats.IncrementFilesMoved()
-			}
-			return err
-		} else {
-			err := fo.copyFile(file.Path, targetPath)
-			if err == nil {
-				fo.stats.IncrementFilesCopied()
-			}
-			return err
+		if err := fo.trashExisting(targetPath); err != nil {
+			return "", err
 		}
-
-	case "rename":
-		newTargetPath := fo.generateUniqueFilename(targetPath)
+		if err := fo.transferFile(file.Path, targetPath); err != nil {
+			return "", err
+		}
+		fo.countTransfer(file.Path, file.Size)
+		fo.stats.IncrementDuplicatesReplaced(category)
+		fo.recordPlacement(targetPath, file.Size, true)
+		return targetPath, nil
+
+	case config.DuplicateRename:
+		newTargetPath := fo.generateUniqueTarget(file, targetPath)
+		defer fo.releaseTarget(newTargetPath)
 		fo.logger.Infof("Renaming duplicate file: %s -> %s", file.Path, newTargetPath)
 
-		if fo.config.Processing.MoveFiles {
-			err := fo.moveFile(file.Path, newTargetPath)
-			if err == nil {
-				fo.stats.IncrementFilesMoved()
-				fo.stats.IncrementDuplicatesRenamed()
-			}
-			return err
-		} else {
-			err := fo.copyFile(file.Path, newTargetPath)
-			if err == nil {
-				fo.stats.IncrementFilesCopied()
-				fo.stats.IncrementDuplicatesRenamed()
-			}
-			return err
+		if err := fo.transferFile(file.Path, newTargetPath); err != nil {
+			return "", err
 		}
+		fo.countTransfer(file.Path, file.Size)
+		fo.stats.IncrementDuplicatesRenamed(category)
+		fo.recordPlacement(newTargetPath, file.Size, true)
+		return newTargetPath, nil
 
 	default:
-		return fmt.Errorf("unknown duplicate handling strategy: %s", fo.config.Processing.DuplicateHandling)
+		return "", fmt.Errorf("unknown duplicate handling strategy: %s", strategy)
+	}
+}
+
+// duplicateCategory returns the duplicate_handling category of a file with
+// the extension ext: raw for camera RAW files, video for videos and image
+// for the others.
+func (fo *FileOrganizer) duplicateCategory(ext string, video bool) string {
+	switch {
+	case fo.config.IsRawExtension(ext):
+		return config.CategoryRAW
+	case video:
+		return config.CategoryVideo
 	}
+	return config.CategoryImage
+}
+
+// duplicateStrategy returns how a duplicate of file is handled.
+func (fo *FileOrganizer) duplicateStrategy(file FileInfo) string {
+	return fo.config.Processing.DuplicateHandling.For(fo.duplicateCategory(file.Extension, file.IsVideo))
 }
 
-// generateUniqueFilename returns a unique filename by adding a counter.
+// generateUniqueFilename returns a unique filename by adding a counter. The
+// returned path is reserved; the caller releases it with releaseTarget.
 func (fo *FileOrganizer) generateUniqueFilename(basePath string) string {
+	return fo.generateUniqueTarget(FileInfo{}, basePath)
+}
+
+// generateUniqueTarget is generateUniqueFilename for file, whose companions
+// must be free to take the name too, so that a RAW file gets the same "_N"
+// suffix as its JPEG.
+func (fo *FileOrganizer) generateUniqueTarget(file FileInfo, basePath string) string {
 	dir := filepath.Dir(basePath)
 	name := filepath.Base(basePath)
 	ext := filepath.Ext(name)
@@ -386,87 +1068,244 @@ func (fo *FileOrganizer) generateUniqueFilename(basePath string) string {
 	for {
 		newName := fmt.Sprintf("%s_%d%s", nameWithoutExt, counter, ext)
 		newPath := filepath.Join(dir, newName)
-		if _, err := os.Stat(newPath); os.IsNotExist(err) {
-			return newPath
+		if fo.reserveTarget(newPath) {
+			if !fo.targetExists(newPath) && !fo.companionsTaken(file, newPath, nil) {
+				return newPath
+			}
+			fo.releaseTarget(newPath)
 		}
 		counter++
 	}
 }
 
-// processThumbnail processes the thumbnail file associated with a video.
-func (fo *FileOrganizer) processThumbnail(file FileInfo, videoTargetPath string) {
-	if file.ThumbnailPath == "" {
-		return
-	}
-
-	videoDir := filepath.Dir(videoTargetPath)
-	videoName := filepath.Base(videoTargetPath)
-	videoExt := filepath.Ext(videoName)
-	thmName := strings.TrimSuffix(videoName, videoExt) + ".thm"
-	thmTargetPath := filepath.Join(videoDir, thmName)
-
-	var err error
-	if fo.config.Processing.MoveFiles {
-		err = fo.moveFile(file.ThumbnailPath, thmTargetPath)
-	} else {
-		err = fo.copyFile(file.ThumbnailPath, thmTargetPath)
+// createDirectory creates a target directory and its parents if they do not exist.
+func (fo *FileOrganizer) createDirectory(dirPath string) error {
+	if err := fo.createTarget(); err != nil {
+		return err
 	}
-
+	fo.dirMu.Lock()
+	created, err := fo.out.createDirectory(dirPath)
+	fo.dirMu.Unlock()
 	if err != nil {
-		fo.logger.Errorf("Could not process thumbnail %s: %v", file.ThumbnailPath, err)
-		fo.stats.AddError(file.ThumbnailPath, "thumbnail_processing", err.Error())
-	} else {
-		fo.logger.Debugf("Processed thumbnail: %s -> %s", file.ThumbnailPath, thmTargetPath)
+		return err
+	}
+	if created {
+		fo.stats.IncrementDirectoriesCreated()
+		fo.logger.Debugf("Created directory: %s", dirPath)
 	}
+	return nil
 }
 
-// createDirectory creates a directory and its parents if they do not exist.
-func (fo *FileOrganizer) createDirectory(dirPath string) error {
-	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(dirPath, 0755); err != nil {
-			return err
+// createTarget creates the target directory when the first file is placed
+// in it, if it does not exist and create_target is on, and counts it among
+// the directories created.
+func (fo *FileOrganizer) createTarget() error {
+	fo.targetOnce.Do(func() {
+		target := fo.config.GetTargetDirectory()
+		if fo.config.TargetArchiveFormat() != "" || fo.config.Security.DryRun {
+			return
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			return
+		}
+		if !fo.config.Processing.CreateTarget {
+			fo.targetErr = fmt.Errorf("target directory does not exist: %s", target)
+			return
+		}
+		if err := os.MkdirAll(target, 0755); err != nil {
+			fo.targetErr = fmt.Errorf("failed to create target directory: %w", err)
+			return
 		}
 		fo.stats.IncrementDirectoriesCreated()
-		fo.logger.Debugf("Created directory: %s", dirPath)
+		fo.logger.Infof("Created target directory %s", target)
+	})
+	return fo.targetErr
+}
+
+// reportNewTarget logs, in a dry run, that the target directory would be
+// created, if it does not exist.
+func (fo *FileOrganizer) reportNewTarget() {
+	target := fo.config.GetTargetDirectory()
+	if !fo.config.Security.DryRun || fo.config.TargetArchiveFormat() != "" {
+		return
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		return
+	}
+	msg := fmt.Sprintf("DRY-RUN: Would create target directory %s", target)
+	if !fo.config.Processing.CreateTarget {
+		msg = fmt.Sprintf("DRY-RUN: Target directory %s does not exist and create_target is off", target)
+	}
+	fo.logger.Info(msg)
+	if fo.logHook != nil {
+		fo.logHook("info", msg)
 	}
-	return nil
 }
 
 // moveFile moves a file from source to destination.
+// If source and destination are on different devices, it falls back to copy and delete.
 func (fo *FileOrganizer) moveFile(sourcePath, destPath string) error {
 	if fo.config.Processing.CreateBackups {
 		if err := fo.createBackup(sourcePath); err != nil {
 			fo.logger.Warnf("Could not create backup for %s: %v", sourcePath, err)
 		}
 	}
-	return os.Rename(sourcePath, destPath)
+
+	// Renaming a followed symlink would move the link itself into the target
+	// tree (where a relative link breaks), so its target's contents are copied
+	// instead and only the link is removed.
+	copyInstead := fo.config.Processing.FollowSymlinks && isSymlink(sourcePath)
+	var err error
+	if !copyInstead {
+		err = os.Rename(sourcePath, destPath)
+		if err != nil && isCrossDeviceError(err) {
+			fo.logger.Debugf("Cross-device move of %s, falling back to copy and delete", sourcePath)
+			copyInstead = true
+		}
+	}
+	if copyInstead {
+		if err = fo.copyFile(sourcePath, destPath); err != nil {
+			os.Remove(destPath)
+		} else {
+			err = os.Remove(sourcePath)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fo.recordMovedFrom(filepath.Dir(sourcePath))
+	return nil
 }
 
-// copyFile copies a file from source to destination.
-func (fo *FileOrganizer) copyFile(sourcePath, destPath string) error {
+// tempSuffix marks a copy in progress. Files are copied under this name and
+// renamed into place once complete, so an interrupted copy never leaves a
+// truncated file under the final name.
+const tempSuffix = ".photosorter-tmp"
+
+// tempFilesInProgress holds the temporary files being written by any run in
+// this process, so that a concurrent run does not take them for stale ones.
+var tempFilesInProgress sync.Map
+
+// trackTempFile marks path as being written until the returned func is called.
+func trackTempFile(path string) (done func()) {
+	tempFilesInProgress.Store(path, struct{}{})
+	return func() { tempFilesInProgress.Delete(path) }
+}
+
+// newCopyWriter returns the writer copyFile writes the data of a copy to
+// through the temporary file. Tests replace it to make copies fail midway.
+var newCopyWriter = func(tempFile *os.File) io.Writer { return tempFile }
+
+// copyFile copies a file from source to destination, preserving its mode and,
+// if configured, its timestamps and ownership. The data is written to a
+// temporary file next to the destination, synced and then renamed into place.
+func (fo *FileOrganizer) copyFile(sourcePath, destPath string) (err error) {
 	sourceFile, err := os.Open(sourcePath)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(destPath)
+	sourceInfo, err := sourceFile.Stat()
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
+	tempPath := destPath + tempSuffix
+	defer trackTempFile(tempPath)()
+	tempFile, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, sourceInfo.Mode().Perm())
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempPath)
+		}
+	}()
+
+	if _, err = io.Copy(newCopyWriter(tempFile), sourceFile); err != nil {
+		return err
+	}
+	if err = tempFile.Sync(); err != nil {
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		return err
+	}
 
-	sourceInfo, err := os.Stat(sourcePath)
-	if err != nil {
+	if err = os.Chmod(tempPath, sourceInfo.Mode()); err != nil {
 		return err
 	}
+	if err = fo.preserveAttributes(sourceInfo, tempPath); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, destPath)
+}
+
+// removeStaleTempFile deletes a temporary file left behind by an interrupted copy.
+// Copies still being written by another run are left alone.
+func (fo *FileOrganizer) removeStaleTempFile(path string) {
+	if _, ok := tempFilesInProgress.Load(path); ok {
+		fo.logger.Debugf("Skipping copy in progress %s", path)
+		return
+	}
+	if fo.config.Security.DryRun {
+		fo.logger.Infof("DRY-RUN: Would remove incomplete copy %s", path)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		fo.logger.Warnf("Could not remove incomplete copy %s: %v", path, err)
+		return
+	}
+	fo.logger.Infof("Removed incomplete copy left by an interrupted run: %s", path)
+}
+
+// sweepTargetTempFiles removes temporary files left in the target directory by
+// interrupted copies. The walk of the sources only finds those in the source
+// directories, and nothing else would ever remove the ones in the target. It
+// only fails if ctx is cancelled.
+func (fo *FileOrganizer) sweepTargetTempFiles(ctx context.Context) error {
+	if fo.config.TargetArchiveFormat() != "" {
+		return nil
+	}
+	return filepath.WalkDir(fo.config.GetTargetDirectory(), func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// A target that does not exist yet has nothing to sweep.
+			if !errors.Is(err, fs.ErrNotExist) {
+				fo.logger.Warnf("Error accessing path %s: %v", path, err)
+			}
+			return nil
+		}
+		if !d.IsDir() && strings.HasSuffix(path, tempSuffix) {
+			fo.removeStaleTempFile(path)
+		}
+		return nil
+	})
+}
+
+// preserveAttributes applies the source file's timestamps and ownership to the destination,
+// according to configuration. Ownership failures are only logged, since changing owners
+// usually requires root.
+func (fo *FileOrganizer) preserveAttributes(sourceInfo os.FileInfo, destPath string) error {
+	if fo.config.Processing.PreserveTimestamps {
+		if err := os.Chtimes(destPath, accessTime(sourceInfo), sourceInfo.ModTime()); err != nil {
+			return fmt.Errorf("preserve timestamps: %w", err)
+		}
+	}
+
+	if fo.config.Processing.PreserveOwnership {
+		if err := chownLike(sourceInfo, destPath); err != nil {
+			fo.logger.Warnf("Could not preserve ownership of %s: %v", destPath, err)
+		}
+	}
 
-	return os.Chmod(destPath, sourceInfo.Mode())
+	return nil
 }
 
 // createBackup creates a backup of a file.
@@ -480,105 +1319,148 @@ func (fo *FileOrganizer) isSupportedFile(ext string) bool {
 	return fo.config.IsImageExtension(ext) || fo.config.IsVideoExtension(ext)
 }
 
-// isAlreadyOrganized returns true if a directory appears to be already organized.
+// isAlreadyOrganized returns true if a directory appears to be already organized:
+// its path relative to the target root matches the leading components of the
+// configured date formats or another known format, so whole date trees are
+// pruned at their top directory.
 func (fo *FileOrganizer) isAlreadyOrganized(dirPath string) bool {
-	dirName := filepath.Base(dirPath)
-	datePatterns := []string{
-		"2006",
-		"2006-01",
-		"2006/01",
-		"2006-01-02",
-		"2006/01/02",
+	rel, err := filepath.Rel(fo.config.GetTargetDirectory(), dirPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
 	}
 
-	for _, pattern := range datePatterns {
-		if _, err := time.Parse(pattern, dirName); err == nil {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	formats := []string{fo.config.DateFormat}
+	for _, source := range fo.sourceConfigs {
+		formats = append(formats, source.config.DateFormat)
+	}
+	for _, option := range config.GetAvailableDateFormats() {
+		formats = append(formats, option.Format)
+	}
+	for _, format := range formats {
+		if layout, err := naming.ParseDateLayout(format); err == nil && layout.MatchesFolders(parts) {
 			return true
 		}
 	}
-
 	return false
 }
 
-// dryRunProcess simulates the organization process without making changes.
-func (fo *FileOrganizer) dryRunProcess(files []FileInfo) error {
-	fo.logger.Info("Starting dry-run process")
-
-	var wg sync.WaitGroup
-	fileChan := make(chan FileInfo, fo.config.Performance.BatchSize)
-
-	for i := 0; i < fo.workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			fo.dryRunWorker(fileChan)
-		}()
-	}
-
-	go func() {
-		defer close(fileChan)
-		for _, file := range files {
-			fileChan <- file
-		}
-	}()
-
-	wg.Wait()
-
-	fo.stats.Finalize()
-	fo.logger.Info("Dry-run process completed")
-	return nil
-}
-
-// dryRunWorker processes files in dry-run mode.
-func (fo *FileOrganizer) dryRunWorker(fileChan <-chan FileInfo) {
-	for file := range fileChan {
-		fo.processDryRunFile(file)
+// processDryRunFile processes a single file in dry-run mode.
+func (fo *FileOrganizer) processDryRunFile(file FileInfo) {
+	if job, ok := fo.prepareDryRunFile(file); ok {
+		fo.placeDryRunFile(job)
 	}
 }
 
-// processDryRunFile processes a single file in dry-run mode.
-func (fo *FileOrganizer) processDryRunFile(file FileInfo) {
+// prepareDryRunFile is prepareFile for dry runs: it only logs the changes
+// that preparing a file would make.
+func (fo *FileOrganizer) prepareDryRunFile(file FileInfo) (fileJob, bool) {
 	fo.stats.IncrementFilesProcessed()
-
-	date, err := fo.extractDate(file)
-	if err != nil {
-		msg := fmt.Sprintf("DRY-RUN: Would skip %s (no date): %v", file.Path, err)
-		fo.logger.Infof(msg)
-		if fo.logHook != nil {
-			fo.logHook("info", msg)
-		}
-		fo.stats.IncrementFilesWithoutDates()
-		return
+	if fo.skipInUse(file) {
+		return fileJob{}, false
 	}
 
-	targetPath, err := fo.generateTargetPath(file, *date)
+	var targetPath, reason string
+	meta, err := fo.extractMetadata(file)
 	if err != nil {
-		msg := fmt.Sprintf("DRY-RUN: Could not generate target path for %s: %v", file.Path, err)
-		fo.logger.Errorf(msg)
-		if fo.logHook != nil {
-			fo.logHook("error", msg)
+		fo.stats.IncrementFilesWithoutDates()
+		if fo.config.Processing.UnsortedDirectory == "" {
+			msg := fmt.Sprintf("DRY-RUN: Would skip %s (no date): %v", file.Path, err)
+			fo.logger.Infof(msg)
+			if fo.logHook != nil {
+				fo.logHook("info", msg)
+			}
+			fo.reportFile(file, "", ReportActionNoDate, err.Error(), nil)
+			return fileJob{}, false
 		}
-		fo.stats.IncrementFilesWithErrors()
-		return
+		targetPath, reason = fo.unsortedTargetPath(file), "no date"
+	} else {
+		targetPath, err = fo.generateTargetPath(file, meta)
+		if err != nil {
+			msg := fmt.Sprintf("DRY-RUN: Could not generate target path for %s: %v", file.Path, err)
+			fo.logger.Errorf(msg)
+			if fo.logHook != nil {
+				fo.logHook("error", msg)
+			}
+			fo.stats.IncrementFilesWithErrors()
+			fo.reportFile(file, "", ReportActionError, err.Error(), meta)
+			return fileJob{}, false
+		}
+		fo.stats.IncrementDateFolder(fo.dateFolder(file, meta))
 	}
+	return fileJob{file: file, meta: meta, targetPath: targetPath, reason: reason}, true
+}
+
+// placeDryRunFile logs where a prepared file would be placed.
+func (fo *FileOrganizer) placeDryRunFile(job fileJob) {
+	file, meta, targetPath := job.file, job.meta, job.targetPath
 
-	if fo.fileExistsAtTarget(file.Path, targetPath) {
+	if fo.fileExistsAtTarget(file.Path, targetPath) || fo.companionsTaken(file, targetPath, nil) {
 		msg := fmt.Sprintf("DRY-RUN: Would handle duplicate for %s -> %s", file.Path, targetPath)
 		fo.logger.Infof(msg)
 		if fo.logHook != nil {
 			fo.logHook("info", msg)
 		}
 		fo.stats.IncrementDuplicatesFound()
-	} else {
-		action := "move"
-		if !fo.config.Processing.MoveFiles {
-			action = "copy"
+		reason := fo.duplicateStrategy(file)
+		if reason == config.DuplicateSkip {
+			reason = fo.skipReason(file, targetPath, true)
+			fo.stats.AddBytesSkipped(file.Size)
+		} else {
+			fo.stats.AddBytesWouldProcess(file.Size)
+			fo.recordPlacement(targetPath, file.Size, true)
 		}
+		fo.reportFile(file, targetPath, ReportActionDuplicate, reason, meta)
+	} else {
+		action := fo.transferAction(file.Path)
 		msg := fmt.Sprintf("DRY-RUN: Would %s %s -> %s", action, file.Path, targetPath)
 		fo.logger.Infof(msg)
 		if fo.logHook != nil {
 			fo.logHook("info", msg)
 		}
+		targetPath = fo.compressPlaced(file, targetPath)
+		if fo.shouldMergeThumbnail(file) {
+			msg := fmt.Sprintf("DRY-RUN: Would merge thumbnail %s into %s", file.Thumbnail(), targetPath)
+			if fo.config.Video.MPGProcessing.DeleteTHMAfterMerge {
+				msg += " and delete the thumbnail"
+				file.Sidecars = slices.DeleteFunc(slices.Clone(file.Sidecars), func(s Sidecar) bool {
+					return s.IsThumbnail
+				})
+			}
+			fo.logger.Infof(msg)
+			if fo.logHook != nil {
+				fo.logHook("info", msg)
+			}
+		}
+		for _, companion := range file.Companions {
+			msg := fmt.Sprintf("DRY-RUN: Would %s %s -> %s (with %s)",
+				action, companion.Path, companionTargetPath(companion.Path, targetPath), filepath.Base(file.Path))
+			fo.logger.Infof(msg)
+			if fo.logHook != nil {
+				fo.logHook("info", msg)
+			}
+		}
+		for _, sidecar := range file.Sidecars {
+			msg := fmt.Sprintf("DRY-RUN: Would %s sidecar %s -> %s",
+				action, sidecar.Path, sidecarTargetPath(sidecar, targetPath))
+			fo.logger.Infof(msg)
+			if fo.logHook != nil {
+				fo.logHook("info", msg)
+			}
+		}
 		fo.stats.IncrementFilesOrganized()
+		fo.stats.AddBytesWouldProcess(file.Size)
+		fo.recordPlacement(targetPath, file.Size, false)
+		fo.reportFile(file, targetPath, action, job.reason, meta)
+	}
+}
+
+// recordPlacement records in the statistics that a file was (or, in a dry
+// run, would be) placed at targetPath.
+func (fo *FileOrganizer) recordPlacement(targetPath string, size int64, duplicate bool) {
+	dir := filepath.Dir(targetPath)
+	if rel, err := filepath.Rel(fo.config.GetTargetDirectory(), dir); err == nil {
+		dir = rel
 	}
+	fo.stats.RecordPlacement(filepath.ToSlash(dir), size, duplicate)
 }
@@ -0,0 +1,199 @@
+package organizer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"photo-sorter-go/internal/config"
+)
+
+func TestOrganizeMovesOrCopies(t *testing.T) {
+	tests := []struct {
+		name      string
+		move      bool
+		keepsOrig bool
+	}{
+		{name: "move", move: true, keepsOrig: false},
+		{name: "copy", move: false, keepsOrig: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			src := tree.photo("IMG_0001.jpg", testDate)
+			nested := tree.photo("trip/day1/IMG_0002.jpg", testDate.AddDate(0, 1, 0))
+			data, err := os.ReadFile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := tree.config()
+			cfg.Processing.MoveFiles = tt.move
+			stats := organize(t, cfg)
+
+			assertSameContent(t, tree.target("2003/11/23/IMG_0001.jpg"), data)
+			assertFile(t, tree.target("2003/12/23/IMG_0002.jpg"))
+			for _, path := range []string{src, nested} {
+				if tt.keepsOrig {
+					assertFile(t, path)
+				} else {
+					assertNoFile(t, path)
+				}
+			}
+			assertCount(t, "FilesOrganized", stats.FilesOrganized, 2)
+			if tt.move {
+				assertCount(t, "FilesMoved", stats.FilesMoved, 2)
+			} else {
+				assertCount(t, "FilesCopied", stats.FilesCopied, 2)
+			}
+		})
+	}
+}
+
+func TestOrganizeDuplicateStrategies(t *testing.T) {
+	existing := []byte("the file already organized")
+	tests := []struct {
+		strategy   string
+		wantTarget func(incoming []byte) []byte // content of the original target name
+		renamed    bool                         // the incoming file is placed under a new name
+		sourceLeft bool                         // the incoming file stays in the source
+	}{
+		{strategy: config.DuplicateRename, wantTarget: func([]byte) []byte { return existing }, renamed: true},
+		{strategy: config.DuplicateSkip, wantTarget: func([]byte) []byte { return existing }, sourceLeft: true},
+		{strategy: config.DuplicateOverwrite, wantTarget: func(incoming []byte) []byte { return incoming }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			tree := newTestTree(t)
+			src := tree.photo("IMG_0001.jpg", testDate)
+			incoming, err := os.ReadFile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree.targetFile("2003/11/23/IMG_0001.jpg", existing)
+
+			cfg := tree.config()
+			cfg.Processing.DuplicateHandling = config.DuplicatePolicy{"default": tt.strategy}
+			stats := organize(t, cfg)
+
+			assertSameContent(t, tree.target("2003/11/23/IMG_0001.jpg"), tt.wantTarget(incoming))
+			if tt.renamed {
+				assertSameContent(t, tree.target("2003/11/23/IMG_0001_1.jpg"), incoming)
+			} else {
+				assertNoFile(t, tree.target("2003/11/23/IMG_0001_1.jpg"))
+			}
+			if tt.sourceLeft {
+				assertSameContent(t, src, incoming)
+			} else {
+				assertNoFile(t, src)
+			}
+			assertCount(t, "DuplicatesFound", stats.DuplicatesFound, 1)
+			duplicates := stats.ImageDuplicates
+			switch tt.strategy {
+			case config.DuplicateRename:
+				assertCount(t, "ImageDuplicates.Renamed", duplicates.Renamed, 1)
+			case config.DuplicateSkip:
+				assertCount(t, "ImageDuplicates.Skipped", duplicates.Skipped, 1)
+			case config.DuplicateOverwrite:
+				assertCount(t, "ImageDuplicates.Replaced", duplicates.Replaced, 1)
+			}
+		})
+	}
+}
+
+func TestOrganizeDuplicateStrategyPerCategory(t *testing.T) {
+	tree := newTestTree(t)
+	photo := tree.photo("IMG_0001.jpg", testDate)
+	tree.targetFile("2003/11/23/IMG_0001.jpg", []byte("existing"))
+
+	cfg := tree.config()
+	cfg.Processing.DuplicateHandling = config.DuplicatePolicy{"default": config.DuplicateRename, "image": config.DuplicateSkip}
+	organize(t, cfg)
+
+	assertFile(t, photo)
+	assertNoFile(t, tree.target("2003/11/23/IMG_0001_1.jpg"))
+}
+
+func TestDryRunChangesNothing(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *config.Config)
+	}{
+		{name: "move", modify: func(cfg *config.Config) {}},
+		{name: "copy", modify: func(cfg *config.Config) { cfg.Processing.MoveFiles = false }},
+		{name: "overwrite", modify: func(cfg *config.Config) {
+			cfg.Processing.DuplicateHandling = config.DuplicatePolicy{"default": config.DuplicateOverwrite}
+		}},
+		{name: "new target", modify: func(cfg *config.Config) {
+			target := *cfg.TargetDirectory + "/new"
+			cfg.TargetDirectory = &target
+		}},
+		{name: "remove empty dirs", modify: func(cfg *config.Config) { cfg.Processing.RemoveEmptyDirs = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			tree.photo("IMG_0001.jpg", testDate)
+			tree.photo("trip/IMG_0002.jpg", testDate)
+			tree.file("trip/IMG_0002.xmp", []byte("<x:xmpmeta/>"))
+			tree.file("interrupted.jpg"+tempSuffix, []byte("partial"))
+			tree.targetFile("2003/11/23/IMG_0001.jpg", []byte("existing"))
+			if err := os.MkdirAll(tree.source("empty"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			sourceBefore := snapshotTree(t, tree.Source)
+			targetBefore := snapshotTree(t, tree.Target)
+
+			cfg := tree.config()
+			cfg.Security.DryRun = true
+			tt.modify(cfg)
+			stats := organize(t, cfg)
+
+			assertTreeUnchanged(t, tree.Source, sourceBefore)
+			assertTreeUnchanged(t, tree.Target, targetBefore)
+			assertCount(t, "TotalFilesFound", stats.TotalFilesFound, 2)
+		})
+	}
+}
+
+func TestOrganizeDateFolders(t *testing.T) {
+	date := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "2006/01/02", want: "2021/08/09/IMG_0001.jpg"},
+		{format: "2006/01", want: "2021/08/IMG_0001.jpg"},
+		{format: "2006-01-02", want: "2021-08-09/IMG_0001.jpg"},
+		{format: "{year}/{month}", want: "2021/08/IMG_0001.jpg"},
+		{format: "{year}/{month_name}", want: "2021/August/IMG_0001.jpg"},
+		{format: "{year}/Q{quarter}", want: "2021/Q3/IMG_0001.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			tree := newTestTree(t)
+			tree.photo("IMG_0001.jpg", date)
+
+			cfg := tree.config()
+			cfg.DateFormat = tt.format
+			stats := organize(t, cfg)
+
+			assertFile(t, tree.target(tt.want))
+			assertCount(t, "FilesOrganized", stats.FilesOrganized, 1)
+		})
+	}
+}
+
+func TestOrganizeWithoutDate(t *testing.T) {
+	tree := newTestTree(t)
+	src := tree.file("scan.jpg", []byte("not a JPEG"))
+
+	cfg := tree.config()
+	cfg.Processing.UseModTimeFallback = false
+	cfg.Processing.UnsortedDirectory = "unsorted"
+	stats := organize(t, cfg)
+
+	assertNoFile(t, src)
+	assertFile(t, tree.target("unsorted/scan.jpg"))
+	assertCount(t, "FilesWithoutDates", stats.FilesWithoutDates, 1)
+}
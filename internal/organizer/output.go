@@ -0,0 +1,97 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+)
+
+// output is where a run places organized files: the target directory tree, or
+// an archive written instead of it. Paths are target paths as generated for a
+// directory target.
+type output interface {
+	// exists reports whether a file has been placed at path.
+	exists(path string) bool
+	// createDirectory creates dir and its parents, reporting whether any of
+	// them were new.
+	createDirectory(dir string) (bool, error)
+	// copyFile copies the file at sourcePath to path.
+	copyFile(sourcePath, path string) error
+	// contentsPath returns a file on disk with the contents of the file placed
+	// at path, for comparing it with another file.
+	contentsPath(path string) string
+	// close finishes the output once the run is over.
+	close() error
+}
+
+// dirOutput places files in the target directory tree.
+type dirOutput struct {
+	fo *FileOrganizer
+}
+
+// createDirectory creates dir and its parents if they do not exist.
+func (o dirOutput) createDirectory(dir string) (bool, error) {
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		return false, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// copyFile copies sourcePath to path, preserving attributes as configured.
+func (o dirOutput) copyFile(sourcePath, path string) error {
+	return o.fo.copyFile(sourcePath, path)
+}
+
+// contentsPath returns path itself.
+func (o dirOutput) contentsPath(path string) string {
+	return path
+}
+
+// close does nothing; files in the directory tree are complete once copied.
+func (o dirOutput) close() error {
+	return nil
+}
+
+// openOutput prepares the output of a run: for an archive target, it checks
+// the settings and starts writing the archive. Dry runs write nothing.
+func (fo *FileOrganizer) openOutput() error {
+	format := fo.config.TargetArchiveFormat()
+	if format == "" {
+		return nil
+	}
+	if err := fo.config.ValidateArchiveTarget(); err != nil {
+		return err
+	}
+	if fo.config.Security.DryRun {
+		return nil
+	}
+
+	archive, err := newArchiveOutput(fo.config.GetTargetDirectory(), format, fo.claimKey)
+	if err != nil {
+		return err
+	}
+	fo.out = archive
+	fo.logger.Infof("Writing organized files to %s archive %s", format, fo.config.GetTargetDirectory())
+	return nil
+}
+
+// closeOutput finishes the output opened by openOutput. A close error is
+// stored in *err unless it already holds one.
+func (fo *FileOrganizer) closeOutput(err *error) {
+	closeErr := fo.out.close()
+	fo.out = dirOutput{fo}
+	if closeErr != nil && *err == nil {
+		*err = fmt.Errorf("failed to finish output: %w", closeErr)
+	}
+}
+
+// refuseArchiveTarget returns an error if the target is an archive, which
+// the given operation does not support.
+func (fo *FileOrganizer) refuseArchiveTarget(operation string) error {
+	if fo.config.TargetArchiveFormat() != "" {
+		return fmt.Errorf("%s does not support archive targets: %s", operation, fo.config.GetTargetDirectory())
+	}
+	return nil
+}
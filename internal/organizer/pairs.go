@@ -0,0 +1,181 @@
+package organizer
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photo-sorter-go/internal/config"
+)
+
+// CompanionKind identifies why a file is organized together with a primary file.
+type CompanionKind int
+
+const (
+	// CompanionRAW is the RAW half of a RAW+JPEG pair.
+	CompanionRAW CompanionKind = iota
+	// CompanionLivePhoto is the video half of an Apple Live Photo.
+	CompanionLivePhoto
+)
+
+// String returns a human-readable name for the companion kind.
+func (k CompanionKind) String() string {
+	switch k {
+	case CompanionRAW:
+		return "RAW"
+	case CompanionLivePhoto:
+		return "Live Photo video"
+	default:
+		return "companion"
+	}
+}
+
+// Companion is a file organized together with, and dated by, its primary file.
+type Companion struct {
+	Path string
+	Kind CompanionKind
+}
+
+// pairRawJPEG attaches RAW files to the JPEG with the same base name in the same
+// directory, so both are sorted by the JPEG's date and organized together.
+func (fo *FileOrganizer) pairRawJPEG(files []FileInfo) []FileInfo {
+	return fo.attachCompanions(files, CompanionRAW,
+		func(f FileInfo) bool { return fo.config.IsJPEGExtension(f.Extension) },
+		func(f FileInfo) bool { return fo.config.IsRawExtension(f.Extension) },
+		nil,
+		fo.stats.IncrementRAWJPEGPairsFound,
+	)
+}
+
+// pairLivePhotos attaches Live Photo videos to the still image with the same base name,
+// provided their modification times are within the configured delta.
+func (fo *FileOrganizer) pairLivePhotos(files []FileInfo) []FileInfo {
+	maxDelta := fo.config.Processing.LivePhotoMaxDelta
+	return fo.attachCompanions(files, CompanionLivePhoto,
+		func(f FileInfo) bool { return fo.config.IsLivePhotoImageExtension(f.Extension) },
+		func(f FileInfo) bool { return f.Extension == ".mov" },
+		func(primary, companion FileInfo) bool {
+			delta := primary.ModTime.Sub(companion.ModTime)
+			if delta < 0 {
+				delta = -delta
+			}
+			if maxDelta > 0 && delta > maxDelta {
+				fo.logger.Debugf("Not pairing %s with %s: modification times differ by %v",
+					companion.Path, primary.Path, delta.Round(time.Second))
+				return false
+			}
+			return true
+		},
+		fo.stats.IncrementLivePhotoPairsFound,
+	)
+}
+
+// attachCompanions moves every file matching isCompanion into the Companions of the
+// file matching isPrimary with the same directory and base name. If accept is set,
+// it can veto individual pairs.
+func (fo *FileOrganizer) attachCompanions(
+	files []FileInfo,
+	kind CompanionKind,
+	isPrimary, isCompanion func(FileInfo) bool,
+	accept func(primary, companion FileInfo) bool,
+	onPair func(),
+) []FileInfo {
+	primaries := make(map[string]int)
+	for i, file := range files {
+		if isPrimary(file) {
+			primaries[pairKey(file.Path)] = i
+		}
+	}
+	if len(primaries) == 0 {
+		return files
+	}
+
+	// Companions are attached to the one primary recorded for their key, even
+	// if other primaries share it (e.g. IMG_1.jpg and IMG_1.heic), so that
+	// each is organized and counted once.
+	result := make([]FileInfo, 0, len(files))
+	resultIndex := make(map[int]int) // index in files -> index in result
+	var companions []FileInfo
+	for i, file := range files {
+		if isCompanion(file) {
+			if p, ok := primaries[pairKey(file.Path)]; ok && (accept == nil || accept(files[p], file)) {
+				companions = append(companions, file)
+				continue
+			}
+		}
+		resultIndex[i] = len(result)
+		result = append(result, file)
+	}
+
+	for _, companion := range companions {
+		primary := &result[resultIndex[primaries[pairKey(companion.Path)]]]
+		primary.Companions = append(primary.Companions, Companion{Path: companion.Path, Kind: kind})
+		primary.Size += companion.Size
+		onPair()
+		fo.logger.Debugf("Paired %s %s with %s", kind, companion.Path, primary.Path)
+	}
+
+	return result
+}
+
+// pairKey returns the directory and case-folded base name used to match pair members.
+func pairKey(path string) string {
+	return strings.ToLower(strings.TrimSuffix(path, filepath.Ext(path)))
+}
+
+// companionTargetPath returns where a companion file goes, given its primary's target path.
+// The companion keeps its own extension but takes the primary's target base name.
+func companionTargetPath(companionPath, primaryTargetPath string) string {
+	base := strings.TrimSuffix(primaryTargetPath, filepath.Ext(primaryTargetPath))
+	return base + filepath.Ext(companionPath)
+}
+
+// companionsTaken reports whether the target of a companion of file would
+// be taken, were file placed at primaryTargetPath: whether a file exists
+// there or, for plans, claimed holds it. A group is only placed under a name
+// that is free for all its members, so that they keep sharing it.
+func (fo *FileOrganizer) companionsTaken(file FileInfo, primaryTargetPath string, claimed map[string]bool) bool {
+	for _, companion := range file.Companions {
+		target := companionTargetPath(companion.Path, primaryTargetPath)
+		if fo.fileExistsAtTarget(companion.Path, target) || claimed[fo.claimKey(target)] {
+			return true
+		}
+	}
+	return false
+}
+
+// processCompanions moves or copies the companions of a file next to its
+// organized location, under its target name. A companion replaces the file
+// at its target when its primary overwrote a duplicate; otherwise that
+// target was free when the primary's name was chosen, and it only gets a
+// name of its own if a file arrived there since.
+func (fo *FileOrganizer) processCompanions(file FileInfo, primaryTargetPath string) {
+	overwrite := fo.duplicateStrategy(file) == config.DuplicateOverwrite
+	for _, companion := range file.Companions {
+		targetPath := companionTargetPath(companion.Path, primaryTargetPath)
+		var err error
+		if overwrite {
+			fo.reserved.reserve(fo.claimKey(targetPath))
+			err = fo.trashExisting(targetPath)
+		} else {
+			targetPath = fo.reserveFreeTarget(companion.Path, targetPath)
+		}
+		if err == nil {
+			err = fo.transferFile(companion.Path, targetPath)
+		}
+		fo.releaseTarget(targetPath)
+
+		if err != nil {
+			fo.logger.Errorf("Could not organize %s together with %s: %v", companion.Path, file.Path, err)
+			switch companion.Kind {
+			case CompanionRAW:
+				fo.stats.IncrementRAWJPEGPairsSplit()
+			case CompanionLivePhoto:
+				fo.stats.IncrementLivePhotoPairsSplit()
+			}
+			fo.stats.AddError(companion.Path, "companion_processing", err.Error())
+			continue
+		}
+		fo.logger.Debugf("Organized %s: %s -> %s", companion.Kind, companion.Path, targetPath)
+	}
+}
@@ -0,0 +1,181 @@
+package organizer
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"photo-sorter-go/internal/config"
+)
+
+// testFiles returns FileInfos for the named files of dir, modified at
+// modTime, each of 100 bytes.
+func testFiles(dir string, modTime time.Time, names ...string) []FileInfo {
+	files := make([]FileInfo, 0, len(names))
+	for _, name := range names {
+		ext := strings.ToLower(filepath.Ext(name))
+		files = append(files, FileInfo{
+			Path:      filepath.Join(dir, name),
+			Size:      100,
+			ModTime:   modTime,
+			Extension: ext,
+			IsVideo:   ext == ".mov",
+			IsImage:   ext != ".mov",
+		})
+	}
+	return files
+}
+
+// companionsOf returns the base names of the companions of each file, by the
+// file's base name.
+func companionsOf(files []FileInfo) map[string][]string {
+	companions := make(map[string][]string)
+	for _, file := range files {
+		for _, companion := range file.Companions {
+			name := filepath.Base(file.Path)
+			companions[name] = append(companions[name], filepath.Base(companion.Path))
+		}
+	}
+	return companions
+}
+
+func TestPairing(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		files     []FileInfo
+		pair      func(fo *FileOrganizer, files []FileInfo) []FileInfo
+		wantFiles int
+		want      map[string][]string
+		wantSize  int64 // of the files and their companions
+	}{
+		{
+			name:      "raw with jpeg",
+			files:     testFiles("/photos", now, "DSC_1.JPG", "DSC_1.NEF", "DSC_2.NEF"),
+			pair:      (*FileOrganizer).pairRawJPEG,
+			wantFiles: 2,
+			want:      map[string][]string{"DSC_1.JPG": {"DSC_1.NEF"}},
+			wantSize:  300,
+		},
+		{
+			name:      "live photo",
+			files:     testFiles("/photos", now, "IMG_1.HEIC", "IMG_1.MOV"),
+			pair:      (*FileOrganizer).pairLivePhotos,
+			wantFiles: 1,
+			want:      map[string][]string{"IMG_1.HEIC": {"IMG_1.MOV"}},
+			wantSize:  200,
+		},
+		{
+			name:      "live photo with two stills",
+			files:     testFiles("/photos", now, "IMG_1.JPG", "IMG_1.HEIC", "IMG_1.MOV"),
+			pair:      (*FileOrganizer).pairLivePhotos,
+			wantFiles: 2,
+			want:      map[string][]string{"IMG_1.HEIC": {"IMG_1.MOV"}},
+			wantSize:  300,
+		},
+		{
+			name: "live photo hours apart",
+			files: append(testFiles("/photos", now, "IMG_1.HEIC"),
+				testFiles("/photos", now.Add(-3*time.Hour), "IMG_1.MOV")...),
+			pair:      (*FileOrganizer).pairLivePhotos,
+			wantFiles: 2,
+			want:      map[string][]string{},
+			wantSize:  200,
+		},
+		{
+			name: "same name in another directory",
+			files: append(testFiles("/photos/a", now, "IMG_1.HEIC"),
+				testFiles("/photos/b", now, "IMG_1.MOV")...),
+			pair:      (*FileOrganizer).pairLivePhotos,
+			wantFiles: 2,
+			want:      map[string][]string{},
+			wantSize:  200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fo, stats := newTestOrganizer(t, newTestTree(t).config())
+			got := tt.pair(fo, tt.files)
+
+			if len(got) != tt.wantFiles {
+				t.Errorf("got %d files, want %d", len(got), tt.wantFiles)
+			}
+			companions := companionsOf(got)
+			if len(companions) != len(tt.want) {
+				t.Errorf("companions %v, want %v", companions, tt.want)
+			}
+			pairs := 0
+			for name, want := range tt.want {
+				pairs += len(want)
+				if strings.Join(companions[name], ",") != strings.Join(want, ",") {
+					t.Errorf("companions of %s = %v, want %v", name, companions[name], want)
+				}
+			}
+			var size int64
+			for _, file := range got {
+				size += file.Size
+			}
+			assertCount(t, "total size", size, tt.wantSize)
+			assertCount(t, "pairs found", stats.RAWJPEGPairsFound+stats.LivePhotoPairsFound, int64(pairs))
+		})
+	}
+}
+
+func TestRAWCompanionSharesPrimaryName(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		existing []string // names already in the date folder
+		want     string   // base name the pair is placed under
+	}{
+		{name: "jpeg taken", strategy: config.DuplicateRename, existing: []string{"DSC_1.JPG"}, want: "DSC_1_1"},
+		{name: "raw taken", strategy: config.DuplicateRename, existing: []string{"DSC_1.NEF"}, want: "DSC_1_1"},
+		{name: "renamed raw taken", strategy: config.DuplicateRename,
+			existing: []string{"DSC_1.JPG", "DSC_1_1.NEF"}, want: "DSC_1_2"},
+		{name: "overwrite", strategy: config.DuplicateOverwrite, existing: []string{"DSC_1.JPG", "DSC_1.NEF"}, want: "DSC_1"},
+	}
+	for _, tt := range tests {
+		for _, plan := range []bool{false, true} {
+			name := tt.name
+			if plan {
+				name += " plan"
+			}
+			t.Run(name, func(t *testing.T) {
+				tree := newTestTree(t)
+				tree.photo("DSC_1.JPG", testDate)
+				raw := tree.file("DSC_1.NEF", []byte("raw sensor data"))
+				for _, existing := range tt.existing {
+					tree.targetFile("2003/11/23/"+existing, []byte("existing "+existing))
+				}
+
+				cfg := tree.config()
+				cfg.Processing.DuplicateHandling = config.DuplicatePolicy{"default": tt.strategy}
+				if plan {
+					fo, _ := newTestOrganizer(t, cfg)
+					entries, err := fo.Plan()
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, entry := range entries {
+						want := tree.target("2003/11/23/" + tt.want + filepath.Ext(entry.Source))
+						if entry.Target != want {
+							t.Errorf("plan places %s at %s, want %s", entry.Source, entry.Target, want)
+						}
+					}
+					return
+				}
+				organize(t, cfg)
+
+				assertFile(t, tree.target("2003/11/23/"+tt.want+".JPG"))
+				assertSameContent(t, tree.target("2003/11/23/"+tt.want+".NEF"), []byte("raw sensor data"))
+				assertNoFile(t, raw)
+				for _, existing := range tt.existing {
+					if !strings.HasPrefix(existing, tt.want+".") {
+						assertSameContent(t, tree.target("2003/11/23/"+existing), []byte("existing "+existing))
+					}
+				}
+			})
+		}
+	}
+}
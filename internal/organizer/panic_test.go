@@ -0,0 +1,78 @@
+package organizer
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"photo-sorter-go/internal/compressor"
+	"photo-sorter-go/internal/extractor"
+	"photo-sorter-go/internal/statistics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// panickingExtractor extracts dates like the default extractor, except that
+// it panics for one file, like a metadata parser choking on a corrupt file.
+type panickingExtractor struct {
+	extractor.DateExtractor
+	path string
+}
+
+func (e panickingExtractor) ExtractDate(path string) (*time.Time, error) {
+	if path == e.path {
+		panic("corrupt TIFF")
+	}
+	return e.DateExtractor.ExtractDate(path)
+}
+
+func TestPanicIsRecordedAsFileError(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		name := "organize"
+		if dryRun {
+			name = "dry-run"
+		}
+		t.Run(name, func(t *testing.T) {
+			tree := newTestTree(t)
+			tree.photo("IMG_0001.jpg", testDate)
+			corrupt := tree.photo("corrupt.jpg", testDate)
+			tree.photo("IMG_0002.jpg", testDate)
+
+			cfg := tree.config()
+			cfg.Security.DryRun = dryRun
+			cfg.Performance.WorkerThreads = 1 // the worker goes on after the panic
+			if err := cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+			stats := statistics.NewStatistics()
+			dates := panickingExtractor{DateExtractor: extractor.NewDefaultExtractor(log), path: corrupt}
+			fo := NewFileOrganizer(cfg, log, stats, dates, compressor.NewDefaultCompressor())
+			if err := fo.OrganizeFiles(context.Background()); err != nil {
+				t.Fatalf("OrganizeFiles: %v", err)
+			}
+
+			assertCount(t, "FilesWithErrors", stats.FilesWithErrors, 1)
+			assertCount(t, "FilesOrganized", stats.FilesOrganized, 2)
+			assertFile(t, corrupt)
+			if !dryRun {
+				assertFile(t, tree.target("2003/11/23/IMG_0001.jpg"))
+				assertFile(t, tree.target("2003/11/23/IMG_0002.jpg"))
+			}
+
+			errs := stats.GetErrors()
+			if len(errs) != 1 {
+				t.Fatalf("recorded errors %+v, want one", errs)
+			}
+			if errs[0].FilePath != corrupt || errs[0].Operation != "panic" {
+				t.Errorf("recorded error for %s in %q, want %s in \"panic\"", errs[0].FilePath, errs[0].Operation, corrupt)
+			}
+			if !strings.Contains(errs[0].Error, "corrupt TIFF") || !strings.Contains(errs[0].Error, "goroutine") {
+				t.Errorf("recorded error %q lacks the panic value and stack", errs[0].Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetPaths makes the organizer process exactly the given files instead of
+// walking the source directory. Sidecars next to the files are picked up as
+// in a normal run.
+func (fo *FileOrganizer) SetPaths(paths []string) {
+	fo.paths = paths
+}
+
+// explicitPaths returns the files to process instead of walking the source
+// directory: those passed to SetPaths, or the source itself if it is a file.
+func (fo *FileOrganizer) explicitPaths() []string {
+	if fo.paths != nil {
+		return fo.paths
+	}
+	if len(fo.sources) > 1 {
+		return nil
+	}
+	if info, err := os.Stat(fo.config.SourceDirectory); err == nil && info.Mode().IsRegular() {
+		return []string{fo.config.SourceDirectory}
+	}
+	return nil
+}
+
+// listSource passes the explicitly given files to emit, grouped with their
+// companions and sidecars like walkSource does. Consecutive files from the
+// same directory are grouped together, so lists produced by find or ls keep
+// their pairs. Paths that do not exist or are not files are recorded as
+// errors for those paths; they do not stop the run.
+func (fo *FileOrganizer) listSource(ctx context.Context, paths []string, emit func([]FileInfo)) error {
+	fo.orphanedSidecars = nil
+
+	var dir string
+	var b dirBatch
+	listed := make(map[string]bool)
+	flush := func() {
+		if len(b.files) == 0 && len(b.sidecars) == 0 {
+			return
+		}
+		files, sidecars := fo.nearbySidecars(dir, b.files, b.sidecars, listed)
+		if group := fo.groupFiles(files, sidecars, b.filtered); len(group) > 0 {
+			emit(group)
+		}
+		b = dirBatch{}
+	}
+
+	found := 0
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path = strings.TrimSpace(path)
+		if path == "" || listed[path] {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err == nil && !info.Mode().IsRegular() {
+			err = fmt.Errorf("not a regular file")
+		}
+		if err != nil {
+			fo.logger.Warnf("Skipping %s: %v", path, err)
+			fo.stats.IncrementFilesWithErrors()
+			fo.stats.AddError(path, "file_list", err.Error())
+			continue
+		}
+
+		if fo.skipHidden(path) {
+			continue
+		}
+
+		if d := filepath.Dir(path); d != dir {
+			flush()
+			dir = d
+		}
+		listed[path] = true
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if !fo.isSupportedFile(ext) {
+			if fo.isSidecarFile(ext) {
+				b.sidecars = append(b.sidecars, path)
+			} else {
+				fo.logger.Debugf("Skipping %s: unsupported file type", path)
+			}
+			continue
+		}
+		if !fo.passesFilters(path, info) {
+			fo.stats.IncrementFilesSkipped()
+			b.filtered = append(b.filtered, path)
+			continue
+		}
+
+		b.files = append(b.files, fo.newFileInfo(path, info))
+		found++
+		if fo.config.Security.MaxFilesPerRun > 0 && found >= fo.config.Security.MaxFilesPerRun {
+			fo.logger.Infof("Reached maximum files limit (%d), ignoring the rest of the list", fo.config.Security.MaxFilesPerRun)
+			break
+		}
+	}
+	flush()
+	return nil
+}
+
+// nearbySidecars adds the sidecars and THM thumbnails in dir that belong to
+// the given files but were not listed themselves, so that they are not left
+// behind when their media file is organized.
+func (fo *FileOrganizer) nearbySidecars(dir string, files []FileInfo, sidecars []string, listed map[string]bool) ([]FileInfo, []string) {
+	if len(files) == 0 {
+		return files, sidecars
+	}
+	keys := make(map[string]bool)
+	for _, file := range files {
+		keys[pairKey(file.Path)] = true
+		keys[strings.ToLower(file.Path)] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return files, sidecars
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || listed[path] || !keys[pairKey(path)] || fo.isIgnoredHidden(path) {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		switch {
+		case fo.isSidecarFile(ext):
+			sidecars = append(sidecars, path)
+		case ext == ".thm" && fo.isSupportedFile(ext):
+			if info, err := entry.Info(); err == nil {
+				files = append(files, fo.newFileInfo(path, info))
+			}
+		}
+	}
+	return files, sidecars
+}
@@ -0,0 +1,91 @@
+package organizer
+
+import (
+	"context"
+	"sync"
+
+	"photo-sorter-go/internal/extractor"
+)
+
+// fileJob is a file whose metadata has been read and whose target has been
+// determined, waiting to be placed there.
+type fileJob struct {
+	file       FileInfo
+	meta       *extractor.Metadata // nil for files without a date
+	targetPath string
+	reason     string // why the file goes where it goes, for the report
+}
+
+// fileStages are the two stages of processing a file: reading its metadata
+// to determine its target, which is mostly CPU-bound, and placing it there,
+// which is mostly IO-bound.
+type fileStages struct {
+	prepare func(FileInfo) (fileJob, bool)
+	place   func(fileJob)
+}
+
+// stages returns the stages for the current run, which only log in dry runs.
+func (fo *FileOrganizer) stages() fileStages {
+	if fo.config.Security.DryRun {
+		return fileStages{prepare: fo.prepareDryRunFile, place: fo.placeDryRunFile}
+	}
+	return fileStages{prepare: fo.prepareFile, place: fo.placeFile}
+}
+
+// processBatch runs files through both stages and returns once all of them
+// are done. Each stage has its own workers (performance.hash_threads and
+// performance.transfer_threads), connected by a bounded channel, so metadata
+// for the next files is read while earlier files are being transferred.
+func (fo *FileOrganizer) processBatch(ctx context.Context, files []FileInfo, stages fileStages) {
+	fileChan := make(chan FileInfo)
+	jobChan := make(chan fileJob, fo.transferWorkers)
+
+	var prepared sync.WaitGroup
+	for i := 0; i < min(fo.hashWorkers, len(files)); i++ {
+		prepared.Add(1)
+		go func() {
+			defer prepared.Done()
+			for file := range fileChan {
+				if ctx.Err() != nil {
+					continue
+				}
+				var job fileJob
+				var ok bool
+				path := file.Path
+				fo.currentFile.Store(&path)
+				fo.safeProcess(file, func(file FileInfo) {
+					job, ok = stages.prepare(file)
+				})
+				if ok {
+					jobChan <- job
+				}
+			}
+		}()
+	}
+
+	var placed sync.WaitGroup
+	for i := 0; i < min(fo.transferWorkers, len(files)); i++ {
+		placed.Add(1)
+		go func() {
+			defer placed.Done()
+			for job := range jobChan {
+				if ctx.Err() == nil && fo.throttled(ctx, job.file) {
+					fo.safeProcess(job.file, func(FileInfo) {
+						stages.place(job)
+					})
+				}
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		fileChan <- file
+	}
+	close(fileChan)
+	prepared.Wait()
+	close(jobChan)
+	placed.Wait()
+}
@@ -0,0 +1,94 @@
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// processSinglePool processes files the way the organizer did before it had
+// stages: each of its workers reads the metadata of a file and then places
+// it, so reading and transferring compete for the same workers.
+func (fo *FileOrganizer) processSinglePool(files []FileInfo) {
+	work := make(chan FileInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < fo.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range work {
+				fo.safeProcess(file, fo.processFile)
+			}
+		}()
+	}
+	for _, file := range files {
+		work <- file
+	}
+	close(work)
+	wg.Wait()
+}
+
+// BenchmarkPipeline compares the staged pipeline with the single pool it
+// replaced on a synthetic tree of photos large enough for copying to take a
+// while, copied so that every iteration finds the same source.
+func BenchmarkPipeline(b *testing.B) {
+	const photos = 64
+	tree := newTestTree(b)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < photos; i++ {
+		// Bytes after the end of the image are kept by copying and ignored
+		// by the extractor.
+		padding := make([]byte, 256<<10)
+		rng.Read(padding)
+		data := append(jpegWithDate(b, testDate.Add(time.Duration(i)*time.Hour), uint8(i)), padding...)
+		tree.file(fmt.Sprintf("dir%d/IMG_%04d.jpg", i%8, i), data)
+	}
+
+	runs := []struct {
+		name                    string
+		workers, hash, transfer int
+		process                 func(*FileOrganizer, []FileInfo)
+	}{
+		{name: "single-pool", workers: 4, process: (*FileOrganizer).processSinglePool},
+		{name: "stages", workers: 4, process: processStages},
+		{name: "stages-hash=2-transfer=8", workers: 4, hash: 2, transfer: 8, process: processStages},
+	}
+	for _, run := range runs {
+		b.Run(run.name, func(b *testing.B) {
+			cfg := tree.config()
+			cfg.Processing.MoveFiles = false
+			cfg.Performance.WorkerThreads = run.workers
+			cfg.Performance.HashThreads = run.hash
+			cfg.Performance.TransferThreads = run.transfer
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if err := os.RemoveAll(tree.Target); err != nil {
+					b.Fatal(err)
+				}
+				fo, stats := newTestOrganizer(b, cfg)
+				files, err := fo.DiscoverFiles()
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				run.process(fo, files)
+
+				if copied := atomic.LoadInt64(&stats.FilesCopied); copied != photos {
+					b.Fatalf("copied %d files, want %d", copied, photos)
+				}
+			}
+		})
+	}
+}
+
+// processStages processes files through the staged pipeline.
+func processStages(fo *FileOrganizer, files []FileInfo) {
+	fo.processBatch(context.Background(), files, fo.stages())
+}
@@ -0,0 +1,350 @@
+package organizer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photo-sorter-go/internal/config"
+)
+
+// Plan entry kinds. Primary entries are the media files themselves; companion
+// and sidecar entries travel with the primary entry before them.
+const (
+	PlanKindPrimary   = ""
+	PlanKindCompanion = "companion"
+	PlanKindSidecar   = "sidecar"
+)
+
+// PlanActionSkip marks a plan entry that leaves its file where it is.
+const PlanActionSkip = "skip"
+
+// PlanEntry is a single operation of an organization plan.
+type PlanEntry struct {
+	Source     string    `json:"source"`
+	Target     string    `json:"target,omitempty"`
+	Action     string    `json:"action"` // move, copy, hardlink, symlink or skip
+	Date       time.Time `json:"date"`
+	DateSource string    `json:"date_source,omitempty"`
+	Kind       string    `json:"kind,omitempty"`
+	Reason     string    `json:"reason,omitempty"` // why a file is skipped
+	Overwrite  bool      `json:"overwrite,omitempty"`
+
+	// Size and ModTime describe the source when the plan was made, so that
+	// applying the plan can detect files that changed in the meantime.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Plan discovers files and decides what would be done with each of them,
+// without changing anything.
+func (fo *FileOrganizer) Plan() ([]PlanEntry, error) {
+	if err := fo.refuseArchiveTarget("plan"); err != nil {
+		return nil, err
+	}
+	files, err := fo.DiscoverFiles()
+	if err != nil {
+		return nil, err
+	}
+	fo.caseInsensitive = fo.detectCaseInsensitiveTarget()
+	fo.stats.SetDryRun(true) // planning changes nothing
+
+	var entries []PlanEntry
+	claimed := make(map[string]bool)
+	for _, file := range files {
+		entries = append(entries, fo.planFile(file, claimed)...)
+	}
+	fo.stats.Finalize()
+	return entries, nil
+}
+
+// planFile returns the plan entries for a file and the files traveling with it.
+// claimed holds the targets already assigned earlier in the plan.
+func (fo *FileOrganizer) planFile(file FileInfo, claimed map[string]bool) []PlanEntry {
+	fo.stats.IncrementFilesProcessed()
+	entry := PlanEntry{
+		Source:  file.Path,
+		Action:  fo.transferAction(file.Path),
+		Size:    file.Size,
+		ModTime: file.ModTime,
+	}
+
+	var targetPath string
+	meta, err := fo.extractMetadata(file)
+	if err != nil {
+		fo.stats.IncrementFilesWithoutDates()
+		if fo.config.Processing.UnsortedDirectory == "" {
+			entry.Action = PlanActionSkip
+			entry.Reason = "no date: " + err.Error()
+			fo.stats.IncrementFilesSkipped()
+			return []PlanEntry{entry}
+		}
+		targetPath = fo.unsortedTargetPath(file)
+	} else {
+		entry.Date = meta.Date
+		entry.DateSource = meta.Source.String()
+		targetPath, err = fo.generateTargetPath(file, meta)
+		if err != nil {
+			entry.Action = PlanActionSkip
+			entry.Reason = "path generation failed: " + err.Error()
+			fo.stats.IncrementFilesWithErrors()
+			return []PlanEntry{entry}
+		}
+		fo.stats.IncrementDateFolder(fo.dateFolder(file, meta))
+	}
+
+	duplicate := fo.fileExistsAtTarget(file.Path, targetPath) || claimed[fo.claimKey(targetPath)] ||
+		fo.companionsTaken(file, targetPath, claimed)
+	if duplicate {
+		fo.stats.IncrementDuplicatesFound()
+		category := fo.duplicateCategory(file.Extension, file.IsVideo)
+		switch fo.config.Processing.DuplicateHandling.For(category) {
+		case config.DuplicateSkip:
+			entry.Action = PlanActionSkip
+			entry.Target = targetPath
+			entry.Reason = "duplicate"
+			fo.stats.IncrementDuplicatesSkipped(category)
+			fo.stats.IncrementFilesSkipped()
+			fo.stats.AddBytesSkipped(file.Size)
+			return []PlanEntry{entry}
+		case config.DuplicateOverwrite:
+			entry.Overwrite = true
+		default:
+			targetPath = fo.unclaimedTarget(file, targetPath, claimed)
+		}
+	}
+	entry.Target = targetPath
+	claimed[fo.claimKey(targetPath)] = true
+	fo.stats.IncrementFilesOrganized()
+	fo.stats.AddBytesWouldProcess(file.Size)
+	fo.recordPlacement(targetPath, file.Size, duplicate)
+
+	entries := []PlanEntry{entry}
+	for _, companion := range file.Companions {
+		// Companions replace the other half of a pair their primary overwrites.
+		target := companionTargetPath(companion.Path, targetPath)
+		overwrite := entry.Overwrite && fo.fileExistsAtTarget(companion.Path, target)
+		if !overwrite && (fo.fileExistsAtTarget(companion.Path, target) || claimed[fo.claimKey(target)]) {
+			target = fo.unclaimedPath(target, claimed)
+		}
+		companionEntry := fo.travelingEntry(entry, companion.Path, target, PlanKindCompanion, claimed)
+		companionEntry.Overwrite = overwrite
+		entries = append(entries, companionEntry)
+	}
+	for _, sidecar := range file.Sidecars {
+		target := sidecarTargetPath(sidecar, targetPath)
+		entries = append(entries, fo.travelingEntry(entry, sidecar.Path, target, PlanKindSidecar, claimed))
+	}
+	return entries
+}
+
+// travelingEntry returns the plan entry for a file organized together with primary.
+func (fo *FileOrganizer) travelingEntry(primary PlanEntry, source, target, kind string, claimed map[string]bool) PlanEntry {
+	entry := PlanEntry{
+		Source:     source,
+		Target:     target,
+		Action:     primary.Action,
+		Date:       primary.Date,
+		DateSource: primary.DateSource,
+		Kind:       kind,
+		// Sidecars replace existing files next to their primary, as in a normal run.
+		Overwrite: kind == PlanKindSidecar && fo.targetExists(target),
+	}
+	if info, err := os.Stat(source); err == nil {
+		entry.Size = info.Size()
+		entry.ModTime = info.ModTime()
+	}
+	claimed[fo.claimKey(target)] = true
+	return entry
+}
+
+// claimKey returns the key identifying a target path among the plan's targets.
+func (fo *FileOrganizer) claimKey(path string) string {
+	if fo.caseInsensitive {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// unclaimedPath returns a renamed variant of path that neither exists nor is
+// already a target in the plan.
+func (fo *FileOrganizer) unclaimedPath(path string, claimed map[string]bool) string {
+	return fo.unclaimedTarget(FileInfo{}, path, claimed)
+}
+
+// unclaimedTarget is unclaimedPath for file, whose companions must be free
+// to take the name too.
+func (fo *FileOrganizer) unclaimedTarget(file FileInfo, path string, claimed map[string]bool) string {
+	dir := filepath.Dir(path)
+	ext := filepath.Ext(path)
+	nameWithoutExt := strings.TrimSuffix(filepath.Base(path), ext)
+
+	for counter := 1; ; counter++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s_%d%s", nameWithoutExt, counter, ext))
+		if !fo.targetExists(candidate) && !claimed[fo.claimKey(candidate)] && !fo.companionsTaken(file, candidate, claimed) {
+			return candidate
+		}
+	}
+}
+
+// ApplyPlan performs exactly the operations of a plan. Entries whose source
+// changed or disappeared since the plan was made, or whose target appeared in
+// the meantime, are not applied and are recorded as plan drift, and so are
+// the companions and sidecars of a primary entry that was not applied.
+// Cancelling ctx stops it before the next entry, even one traveling with a
+// primary already applied; the entries left can be applied later.
+func (fo *FileOrganizer) ApplyPlan(ctx context.Context, entries []PlanEntry) error {
+	if err := fo.refuseArchiveTarget("apply"); err != nil {
+		return err
+	}
+	fo.logger.Infof("Applying plan with %d entries", len(entries))
+	fo.stats.StartTime = time.Now()
+	fo.caseInsensitive = fo.detectCaseInsensitiveTarget()
+
+	// Entries before the first primary travel with no file and are applied
+	// on their own.
+	primary, primaryApplied := "", true
+	for _, entry := range entries {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			fo.stats.Finalize()
+			fo.logger.Info("Plan application cancelled")
+			return ctxErr
+		}
+		source := entry.Source
+		fo.currentFile.Store(&source)
+		if entry.Kind == PlanKindPrimary {
+			fo.stats.IncrementFilesFound()
+			primary, primaryApplied = entry.Source, fo.applyEntry(entry)
+			continue
+		}
+		if !primaryApplied {
+			fo.planDrift(entry, "its primary file was not applied: "+primary)
+			continue
+		}
+		fo.applyEntry(entry)
+	}
+
+	if fo.config.Processing.RemoveEmptyDirs {
+		fo.removeEmptyDirs()
+	}
+
+	fo.stats.Finalize()
+	fo.logger.Info("Plan applied")
+	return nil
+}
+
+// applyEntry performs a single plan entry and reports whether its file was
+// placed at its target.
+func (fo *FileOrganizer) applyEntry(entry PlanEntry) bool {
+	primary := entry.Kind == PlanKindPrimary
+	if primary {
+		fo.stats.IncrementFilesProcessed()
+	}
+
+	switch entry.Action {
+	case PlanActionSkip:
+		if primary {
+			fo.stats.IncrementFilesSkipped()
+			fo.stats.AddBytesSkipped(entry.Size)
+		}
+		return false
+	case "move", "copy", config.LinkModeHardlink, config.LinkModeSymlink:
+	default:
+		fo.planDrift(entry, fmt.Sprintf("unknown action %q", entry.Action))
+		return false
+	}
+
+	info, err := os.Stat(entry.Source)
+	if err != nil {
+		fo.planDrift(entry, "source no longer exists")
+		return false
+	}
+	if info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+		fo.planDrift(entry, "source changed since the plan was made")
+		return false
+	}
+	if !entry.Overwrite && fo.fileExistsAtTarget(entry.Source, entry.Target) {
+		fo.planDrift(entry, "target already exists: "+entry.Target)
+		return false
+	}
+
+	if err := fo.createDirectory(filepath.Dir(entry.Target)); err != nil {
+		fo.logger.Errorf("Could not create directory for %s: %v", entry.Target, err)
+		fo.stats.IncrementFilesWithErrors()
+		fo.stats.AddError(entry.Source, "directory_creation", err.Error())
+		return false
+	}
+	if entry.Overwrite {
+		if err := fo.trashExisting(entry.Target); err != nil {
+			fo.logger.Errorf("Could not replace %s: %v", entry.Target, err)
+			fo.stats.IncrementFilesWithErrors()
+			fo.stats.AddError(entry.Source, "overwrite", err.Error())
+			return false
+		}
+		if primary {
+			ext := strings.ToLower(filepath.Ext(entry.Source))
+			fo.stats.IncrementDuplicatesReplaced(fo.duplicateCategory(ext, fo.config.IsVideoExtension(ext)))
+		}
+	}
+
+	if err := fo.transferFileAs(entry.Action, entry.Source, entry.Target); err != nil {
+		fo.logger.Errorf("Could not %s file %s to %s: %v", entry.Action, entry.Source, entry.Target, err)
+		fo.stats.IncrementFilesWithErrors()
+		fo.stats.AddError(entry.Source, entry.Action+"_file", err.Error())
+		return false
+	}
+
+	if primary {
+		fo.countTransferAs(entry.Action, entry.Size)
+		fo.stats.IncrementFilesOrganized()
+		fo.recordPlacement(entry.Target, entry.Size, entry.Overwrite)
+	}
+	fo.logger.Infof("Applied: %s %s -> %s", entry.Action, entry.Source, entry.Target)
+	return true
+}
+
+// planDrift records a plan entry that no longer matches the filesystem.
+func (fo *FileOrganizer) planDrift(entry PlanEntry, reason string) {
+	fo.logger.Warnf("Not applying %s: %s", entry.Source, reason)
+	fo.stats.IncrementPlanDrift()
+	fo.stats.AddError(entry.Source, "plan_drift", reason)
+}
+
+// WritePlan writes plan entries as JSON lines.
+func WritePlan(w io.Writer, entries []PlanEntry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPlan reads plan entries written by WritePlan. Blank lines are ignored.
+func ReadPlan(r io.Reader) ([]PlanEntry, error) {
+	var entries []PlanEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry PlanEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("plan line %d: %w", line, err)
+		}
+		if entry.Source == "" || (entry.Action != PlanActionSkip && entry.Target == "") {
+			return nil, fmt.Errorf("plan line %d: source and target are required", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
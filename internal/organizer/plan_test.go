@@ -0,0 +1,118 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPlanChangesNothing(t *testing.T) {
+	tree := newTestTree(t)
+	tree.photo("IMG_0001.jpg", testDate)
+	tree.photo("trip/IMG_0002.jpg", testDate)
+	tree.file("trip/interrupted.jpg"+tempSuffix, []byte("partial"))
+	tree.targetFile("2003/11/23/IMG_0001.jpg", []byte("existing"))
+	tree.targetFile("2003/11/23/stale.jpg"+tempSuffix, []byte("partial"))
+	sourceBefore := snapshotTree(t, tree.Source)
+	targetBefore := snapshotTree(t, tree.Target)
+
+	cfg := tree.config()
+	cfg.Security.DryRun = true // as the plan command and /api/plan set it
+	fo, _ := newTestOrganizer(t, cfg)
+	entries, err := fo.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("got %d plan entries, want 2", len(entries))
+	}
+	assertTreeUnchanged(t, tree.Source, sourceBefore)
+	assertTreeUnchanged(t, tree.Target, targetBefore)
+}
+
+func TestApplyPlan(t *testing.T) {
+	tree := newTestTree(t)
+	src := tree.photo("IMG_0001.jpg", testDate)
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := tree.config()
+	cfg.Security.DryRun = true
+	planner, _ := newTestOrganizer(t, cfg)
+	entries, err := planner.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg = tree.config()
+	fo, stats := newTestOrganizer(t, cfg)
+	if err := fo.ApplyPlan(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+	assertNoFile(t, src)
+	assertSameContent(t, tree.target("2003/11/23/IMG_0001.jpg"), data)
+	assertCount(t, "PlanDrift", stats.PlanDrift, 0)
+}
+
+func TestApplyPlanSkipsCompanionsOfDriftedPrimary(t *testing.T) {
+	tree := newTestTree(t)
+	photo := tree.photo("DSC_1.JPG", testDate)
+	raw := tree.file("DSC_1.NEF", []byte("raw sensor data"))
+	sidecar := tree.file("DSC_1.xmp", []byte("<x:xmpmeta/>"))
+
+	cfg := tree.config()
+	cfg.Security.DryRun = true
+	planner, _ := newTestOrganizer(t, cfg)
+	entries, err := planner.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d plan entries, want the photo, its RAW file and its sidecar", len(entries))
+	}
+
+	// The photo is edited between planning and applying.
+	if err := os.Chtimes(photo, time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	fo, stats := newTestOrganizer(t, tree.config())
+	if err := fo.ApplyPlan(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFile(t, photo)
+	assertFile(t, raw)
+	assertFile(t, sidecar)
+	for _, entry := range entries {
+		assertNoFile(t, entry.Target)
+	}
+	assertCount(t, "PlanDrift", stats.PlanDrift, 3)
+	assertCount(t, "FilesOrganized", stats.FilesOrganized, 0)
+}
+
+func TestApplyPlanStopsWhenCancelled(t *testing.T) {
+	tree := newTestTree(t)
+	photo := tree.photo("IMG_0001.jpg", testDate)
+
+	cfg := tree.config()
+	cfg.Security.DryRun = true
+	planner, _ := newTestOrganizer(t, cfg)
+	entries, err := planner.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fo, stats := newTestOrganizer(t, tree.config())
+	if err := fo.ApplyPlan(ctx, entries); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ApplyPlan = %v, want context.Canceled", err)
+	}
+	assertFile(t, photo)
+	assertCount(t, "FilesOrganized", stats.FilesOrganized, 0)
+}
@@ -0,0 +1,150 @@
+package organizer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReadReport reads the file records of a report written with --report-file,
+// in JSON or CSV format.
+func ReadReport(r io.Reader) ([]ReportRecord, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+
+	if first[0] == '{' {
+		var report struct {
+			Files []ReportRecord `json:"files"`
+		}
+		if err := json.NewDecoder(br).Decode(&report); err != nil {
+			return nil, fmt.Errorf("invalid report: %w", err)
+		}
+		return report.Files, nil
+	}
+
+	cr := csv.NewReader(br)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = len(reportColumns)
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	var records []ReportRecord
+	for i, row := range rows {
+		if i == 0 && row[0] == reportColumns[0] {
+			continue // column names
+		}
+		size, _ := strconv.ParseInt(row[5], 10, 64)
+		records = append(records, ReportRecord{
+			Source:     row[0],
+			Target:     row[1],
+			Action:     row[2],
+			DateSource: row[4],
+			Size:       size,
+			Reason:     row[6],
+		})
+	}
+	return records, nil
+}
+
+// EachReportRecord calls fn with the file records of a JSON report, in order,
+// until fn returns false. Unlike ReadReport, it does not hold the records in
+// memory.
+func EachReportRecord(r io.Reader, fn func(ReportRecord) bool) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("invalid report: expected an object")
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("invalid report: %w", err)
+		}
+		if key != "files" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("invalid report: %w", err)
+			}
+			continue
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return fmt.Errorf("invalid report: files is not an array")
+		}
+		for dec.More() {
+			var rec ReportRecord
+			if err := dec.Decode(&rec); err != nil {
+				return fmt.Errorf("invalid report: %w", err)
+			}
+			if !fn(rec) {
+				return nil
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("invalid report: %w", err)
+		}
+	}
+	return nil
+}
+
+// PruneResult summarizes a PruneIdentical run.
+type PruneResult struct {
+	Deleted int   // sources deleted, or that would be deleted in a dry run
+	Bytes   int64 // size of the deleted sources
+	Kept    int   // sources recorded as identical that no longer are
+}
+
+// PruneIdentical deletes the sources of duplicates that a run skipped as
+// identical to their target, after checking again that source and target
+// still have the same contents. Other records are ignored. With dryRun
+// nothing is deleted.
+func PruneIdentical(records []ReportRecord, dryRun bool, logger *logrus.Logger) (PruneResult, error) {
+	var result PruneResult
+	for _, rec := range records {
+		if rec.Action != ReportActionDuplicate || rec.Reason != SkipReasonIdentical {
+			continue
+		}
+		if strings.TrimSpace(rec.Target) == "" {
+			continue
+		}
+
+		info, err := os.Stat(rec.Source)
+		if err != nil {
+			logger.Debugf("Skipping %s: %v", rec.Source, err)
+			continue
+		}
+		// The target may be the source itself, or a link to it.
+		if targetInfo, err := os.Stat(rec.Target); err == nil && os.SameFile(info, targetInfo) {
+			logger.Warnf("Keeping %s: %s is the same file", rec.Source, rec.Target)
+			result.Kept++
+			continue
+		}
+		identical, err := sameContents(rec.Source, rec.Target)
+		if err != nil || !identical {
+			logger.Warnf("Keeping %s: it is no longer identical to %s", rec.Source, rec.Target)
+			result.Kept++
+			continue
+		}
+
+		if dryRun {
+			logger.Infof("DRY-RUN: Would delete %s (identical to %s)", rec.Source, rec.Target)
+		} else {
+			if err := os.Remove(rec.Source); err != nil {
+				return result, fmt.Errorf("failed to delete %s: %w", rec.Source, err)
+			}
+			logger.Infof("Deleted %s (identical to %s)", rec.Source, rec.Target)
+		}
+		result.Deleted++
+		result.Bytes += info.Size()
+	}
+	return result, nil
+}
@@ -0,0 +1,210 @@
+package organizer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/extractor"
+)
+
+// Report actions for files that are not transferred. Transferred files are
+// reported with their transfer action (move, copy, hardlink or symlink).
+const (
+	ReportActionSkip      = "skip"
+	ReportActionDuplicate = "duplicate"
+	ReportActionNoDate    = "no-date"
+	ReportActionError     = "error"
+)
+
+// Report formats.
+const (
+	ReportFormatJSON = "json"
+	ReportFormatCSV  = "csv"
+)
+
+// ReportRecord describes what a run did, or would do, with one file.
+type ReportRecord struct {
+	Source     string     `json:"source"`
+	Target     string     `json:"target,omitempty"`
+	Action     string     `json:"action"`
+	Date       *time.Time `json:"date,omitempty"`
+	DateSource string     `json:"date_source,omitempty"`
+	Size       int64      `json:"size"`
+	Reason     string     `json:"reason,omitempty"` // e.g. how a duplicate was resolved
+}
+
+// ReportHeader records when and with which configuration a report was made,
+// so that the run can be reproduced.
+type ReportHeader struct {
+	Generated time.Time      `json:"generated"`
+	DryRun    bool           `json:"dry_run"`
+	Config    *config.Config `json:"config"`
+}
+
+// reportColumns are the CSV columns, in the order of csvRow.
+var reportColumns = []string{"source", "target", "action", "date", "date_source", "size", "reason"}
+
+// Report writes one record per file to w as the run goes, so that reports of
+// large runs need no memory. JSON reports are a single object with a "header"
+// and a "files" array; CSV reports start with the header as "#" comment lines.
+// Report is safe for use by concurrent workers.
+type Report struct {
+	mu      sync.Mutex
+	w       io.Writer
+	csv     *csv.Writer
+	records int
+	err     error
+}
+
+// ReportFormatForPath returns the report format matching path's extension:
+// CSV for .csv files and JSON otherwise.
+func ReportFormatForPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReportFormatCSV
+	}
+	return ReportFormatJSON
+}
+
+// NewReport starts a report in the given format on w, writing its header.
+func NewReport(w io.Writer, format string, cfg *config.Config) (*Report, error) {
+	header := ReportHeader{
+		Generated: time.Now(),
+		DryRun:    cfg.Security.DryRun,
+		Config:    cfg,
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report header: %w", err)
+	}
+
+	r := &Report{w: w}
+	switch format {
+	case ReportFormatJSON:
+		_, err = fmt.Fprintf(w, "{\"header\":%s,\"files\":[", headerJSON)
+	case ReportFormatCSV:
+		configJSON, _ := json.Marshal(cfg)
+		_, err = fmt.Fprintf(w, "# photo-sorter report generated %s (dry run: %t)\n# config: %s\n",
+			header.Generated.Format(time.RFC3339), header.DryRun, configJSON)
+		if err == nil {
+			r.csv = csv.NewWriter(w)
+			err = r.csv.Write(reportColumns)
+		}
+	default:
+		return nil, fmt.Errorf("unknown report format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write report header: %w", err)
+	}
+	return r, nil
+}
+
+// Record appends a record to the report. Write errors are kept and returned
+// by Close; records after an error are dropped.
+func (r *Report) Record(rec ReportRecord) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+
+	if r.csv != nil {
+		r.err = r.csv.Write(rec.csvRow())
+	} else {
+		var data []byte
+		data, r.err = json.Marshal(rec)
+		if r.err == nil {
+			sep := ",\n"
+			if r.records == 0 {
+				sep = "\n"
+			}
+			_, r.err = fmt.Fprintf(r.w, "%s%s", sep, data)
+		}
+	}
+	r.records++
+}
+
+// Flush writes buffered records through to the underlying writer, which is
+// flushed too if it buffers, so that the report of an interrupted run is
+// complete up to the last batch.
+func (r *Report) Flush() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	if r.csv != nil {
+		r.csv.Flush()
+		if err := r.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := r.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close finishes the report and returns the first error that occurred while
+// writing it. It does not close the underlying writer.
+func (r *Report) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	if r.csv != nil {
+		r.csv.Flush()
+		return r.csv.Error()
+	}
+	_, err := io.WriteString(r.w, "\n]}\n")
+	return err
+}
+
+// csvRow returns the record's fields in the order of reportColumns.
+func (rec ReportRecord) csvRow() []string {
+	date := ""
+	if rec.Date != nil {
+		date = rec.Date.Format(time.RFC3339)
+	}
+	return []string{rec.Source, rec.Target, rec.Action, date, rec.DateSource, strconv.FormatInt(rec.Size, 10), rec.Reason}
+}
+
+// SetReport makes the organizer write a record for every file it handles to r.
+func (fo *FileOrganizer) SetReport(r *Report) {
+	fo.report = r
+}
+
+// reportFile records the outcome for a file in the report, if there is one.
+// meta may be nil for files without a date.
+func (fo *FileOrganizer) reportFile(file FileInfo, target, action, reason string, meta *extractor.Metadata) {
+	if fo.report == nil {
+		return
+	}
+	rec := ReportRecord{
+		Source: file.Path,
+		Target: target,
+		Action: action,
+		Size:   file.Size,
+		Reason: reason,
+	}
+	if meta != nil {
+		date := meta.Date
+		rec.Date = &date
+		rec.DateSource = meta.Source.String()
+	}
+	fo.report.Record(rec)
+}
@@ -0,0 +1,75 @@
+package organizer
+
+import "sync"
+
+// targetReservations tracks the target paths workers are currently writing to.
+// Checking that a target is free and then transferring a file to it is not
+// atomic, so without reservations two workers organizing same-named files into
+// one directory could both pick the same name and one file would replace the other.
+type targetReservations struct {
+	mu   sync.Mutex
+	held map[string]chan struct{} // closed when the reservation is released
+}
+
+// tryReserve reserves key, reporting false if it is already reserved.
+func (r *targetReservations) tryReserve(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.held[key]; ok {
+		return false
+	}
+	if r.held == nil {
+		r.held = make(map[string]chan struct{})
+	}
+	r.held[key] = make(chan struct{})
+	return true
+}
+
+// reserve reserves key, waiting for any current reservation to be released.
+func (r *targetReservations) reserve(key string) {
+	for {
+		r.mu.Lock()
+		released, ok := r.held[key]
+		r.mu.Unlock()
+		if !ok && r.tryReserve(key) {
+			return
+		}
+		if ok {
+			<-released
+		}
+	}
+}
+
+// release releases a reservation of key.
+func (r *targetReservations) release(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if released, ok := r.held[key]; ok {
+		close(released)
+		delete(r.held, key)
+	}
+}
+
+// reserveTarget reserves path for a transfer, reporting false if another
+// worker is already transferring a file there.
+func (fo *FileOrganizer) reserveTarget(path string) bool {
+	return fo.reserved.tryReserve(fo.claimKey(path))
+}
+
+// releaseTarget releases a reservation made by reserveTarget or
+// generateUniqueFilename once the transfer is done (or has failed).
+func (fo *FileOrganizer) releaseTarget(path string) {
+	fo.reserved.release(fo.claimKey(path))
+}
+
+// reserveFreeTarget reserves targetPath for sourcePath if it is free, or
+// otherwise a renamed variant of it, and returns the reserved path.
+func (fo *FileOrganizer) reserveFreeTarget(sourcePath, targetPath string) string {
+	if fo.reserveTarget(targetPath) {
+		if !fo.fileExistsAtTarget(sourcePath, targetPath) {
+			return targetPath
+		}
+		fo.releaseTarget(targetPath)
+	}
+	return fo.generateUniqueFilename(targetPath)
+}
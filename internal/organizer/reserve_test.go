@@ -0,0 +1,92 @@
+package organizer
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParallelDuplicatesAllSurvive(t *testing.T) {
+	const files = 100
+	// More threads than processors make the workers interleave even on a
+	// single processor.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(16))
+	tree := newTestTree(t)
+	want := make(map[[32]byte]bool)
+	for i := 0; i < files; i++ {
+		data := jpegWithDate(t, testDate, uint8(i))
+		// Bytes after the end of the image make every file distinct.
+		data = append(data, fmt.Sprintf("source %d", i)...)
+		want[sha256.Sum256(data)] = true
+		tree.file(fmt.Sprintf("card%03d/IMG_0001.jpg", i), data)
+	}
+
+	cfg := tree.config()
+	// Copies take long enough for workers to race between checking a name
+	// and writing the file.
+	cfg.Processing.MoveFiles = false
+	cfg.Performance.WorkerThreads = 16
+	cfg.Performance.BatchSize = files
+	stats := organize(t, cfg)
+
+	dir := tree.target("2003/11/23")
+	names := tree.targetNames("2003/11/23")
+	if len(names) != files {
+		t.Fatalf("target has %d files, want %d; errors: %v", len(names), files, stats.GetErrors())
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		if !want[sum] {
+			t.Errorf("%s is not one of the source files, or is a second copy of one", name)
+		}
+		delete(want, sum)
+	}
+	assertCount(t, "FilesWithErrors", stats.FilesWithErrors, 0)
+	assertCount(t, "DirectoriesCreated", stats.DirectoriesCreated, 1)
+}
+
+func TestTargetReservations(t *testing.T) {
+	var r targetReservations
+	if !r.tryReserve("a") {
+		t.Fatal("tryReserve of a free key failed")
+	}
+	if r.tryReserve("a") {
+		t.Fatal("tryReserve of a reserved key succeeded")
+	}
+	if !r.tryReserve("b") {
+		t.Fatal("tryReserve of another key failed")
+	}
+
+	reserved := make(chan struct{})
+	go func() {
+		r.reserve("a")
+		close(reserved)
+	}()
+	select {
+	case <-reserved:
+		t.Fatal("reserve returned while the key was reserved")
+	case <-time.After(20 * time.Millisecond):
+	}
+	r.release("a")
+	select {
+	case <-reserved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reserve did not return once the key was released")
+	}
+	if r.tryReserve("a") {
+		t.Fatal("tryReserve succeeded while reserve held the key")
+	}
+	r.release("a")
+	r.release("a") // releasing a free key does nothing
+	if !r.tryReserve("a") {
+		t.Fatal("tryReserve of a released key failed")
+	}
+}
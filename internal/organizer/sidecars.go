@@ -0,0 +1,204 @@
+package organizer
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Sidecar is a metadata or thumbnail file that follows its primary file.
+type Sidecar struct {
+	Path string
+	// Suffix is the part of the sidecar name after the primary's base name
+	// (".xmp") or full name (".jpg.json"), with its original case.
+	Suffix string
+	// FullName is true for sidecars named after the full primary file name (IMG.jpg.xmp)
+	// rather than its base name (IMG.xmp).
+	FullName bool
+	// IsThumbnail is true for THM thumbnails of MPG videos.
+	IsThumbnail bool
+}
+
+// Thumbnail returns the path of the file's THM thumbnail, or "" if it has none.
+func (f FileInfo) Thumbnail() string {
+	for _, sidecar := range f.Sidecars {
+		if sidecar.IsThumbnail {
+			return sidecar.Path
+		}
+	}
+	return ""
+}
+
+// isSidecarFile returns true if the extension is a configured sidecar extension.
+func (fo *FileOrganizer) isSidecarFile(ext string) bool {
+	return slices.Contains(fo.config.Processing.SidecarExtensions, ext)
+}
+
+// attachSidecars matches sidecar files and MPG thumbnails to their primary files.
+// Sidecars of filtered files are claimed but not attached, so they are not reported
+// as orphans. Unclaimed sidecars are stored as orphans, and claimed THM files are
+// removed from the list of files to organize.
+func (fo *FileOrganizer) attachSidecars(files []FileInfo, sidecars, filtered []string) []FileInfo {
+	index := make(map[string][]string)
+	for _, path := range sidecars {
+		key := pairKey(path)
+		index[key] = append(index[key], path)
+	}
+	for _, file := range files {
+		if file.Extension == ".thm" {
+			key := pairKey(file.Path)
+			index[key] = append(index[key], file.Path)
+		}
+	}
+
+	claimed := make(map[string]bool)
+	claim := func(primaryPath string, includeThumbnail bool) []Sidecar {
+		var result []Sidecar
+		base := filepath.Base(primaryPath)
+		baseName := strings.TrimSuffix(base, filepath.Ext(base))
+
+		for _, fullName := range []bool{false, true} {
+			key := pairKey(primaryPath)
+			prefix := baseName
+			if fullName {
+				key = strings.ToLower(primaryPath)
+				prefix = base
+			}
+			for _, path := range index[key] {
+				if claimed[path] || path == primaryPath {
+					continue
+				}
+				isThumbnail := strings.ToLower(filepath.Ext(path)) == ".thm"
+				if isThumbnail && (fullName || !includeThumbnail) {
+					continue
+				}
+				claimed[path] = true
+				result = append(result, Sidecar{
+					Path:        path,
+					Suffix:      filepath.Base(path)[len(prefix):],
+					FullName:    fullName,
+					IsThumbnail: isThumbnail,
+				})
+			}
+		}
+		return result
+	}
+
+	for _, path := range filtered {
+		claim(path, strings.ToLower(filepath.Ext(path)) == ".mpg")
+	}
+
+	for i := range files {
+		if files[i].Extension == ".thm" {
+			continue
+		}
+		files[i].Sidecars = claim(files[i].Path, files[i].IsVideo && files[i].Extension == ".mpg")
+		for _, sidecar := range files[i].Sidecars {
+			if sidecar.IsThumbnail {
+				fo.stats.IncrementThumbnailsFound()
+			} else {
+				fo.stats.IncrementSidecarsFound()
+			}
+			fo.logger.Debugf("Attached sidecar %s to %s", sidecar.Path, files[i].Path)
+		}
+	}
+
+	result := files[:0]
+	for _, file := range files {
+		if file.Extension == ".thm" && claimed[file.Path] {
+			continue
+		}
+		result = append(result, file)
+	}
+
+	for _, path := range sidecars {
+		if !claimed[path] {
+			fo.orphanedSidecars = append(fo.orphanedSidecars, path)
+			fo.stats.IncrementOrphanedSidecars()
+			fo.logger.Debugf("Orphaned sidecar with no matching media file: %s", path)
+		}
+	}
+
+	return result
+}
+
+// sidecarTargetPath returns where a sidecar goes, given its primary's target path.
+func sidecarTargetPath(sidecar Sidecar, primaryTargetPath string) string {
+	if sidecar.FullName {
+		return primaryTargetPath + sidecar.Suffix
+	}
+	return strings.TrimSuffix(primaryTargetPath, filepath.Ext(primaryTargetPath)) + sidecar.Suffix
+}
+
+// processSidecars moves or copies the sidecars of a file next to its organized location.
+func (fo *FileOrganizer) processSidecars(file FileInfo, primaryTargetPath string) {
+	for _, sidecar := range file.Sidecars {
+		targetPath := sidecarTargetPath(sidecar, primaryTargetPath)
+
+		err := fo.trashExisting(targetPath)
+		if err == nil {
+			err = fo.transferFile(sidecar.Path, targetPath)
+		}
+
+		if err != nil {
+			operation := "sidecar_processing"
+			if sidecar.IsThumbnail {
+				operation = "thumbnail_processing"
+			}
+			fo.logger.Errorf("Could not process sidecar %s: %v", sidecar.Path, err)
+			fo.stats.AddError(sidecar.Path, operation, err.Error())
+		} else {
+			fo.logger.Debugf("Processed sidecar: %s -> %s", sidecar.Path, targetPath)
+		}
+	}
+}
+
+// orphanedSidecarTargetPath returns where an orphaned sidecar goes when orphans are collected.
+func (fo *FileOrganizer) orphanedSidecarTargetPath(path string) string {
+	rel, err := filepath.Rel(fo.sourceRoot(path), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(fo.config.GetTargetDirectory(), fo.config.Processing.OrphanedSidecarsFolder, rel)
+}
+
+// processOrphanedSidecars moves or copies sidecars without a primary file into the
+// orphaned sidecars folder, if enabled. In dry-run mode it only logs what would happen.
+func (fo *FileOrganizer) processOrphanedSidecars() {
+	if !fo.config.Processing.CollectOrphanedSidecars || len(fo.orphanedSidecars) == 0 {
+		return
+	}
+	if fo.discoveryTruncated {
+		fo.logger.Infof("Not collecting %d orphaned sidecars: discovery stopped at max_files_per_run", len(fo.orphanedSidecars))
+		return
+	}
+
+	for _, path := range fo.orphanedSidecars {
+		targetPath := fo.orphanedSidecarTargetPath(path)
+
+		if fo.config.Security.DryRun {
+			msg := "DRY-RUN: Would collect orphaned sidecar " + path + " -> " + targetPath
+			fo.logger.Info(msg)
+			if fo.logHook != nil {
+				fo.logHook("info", msg)
+			}
+			continue
+		}
+
+		if err := fo.createDirectory(filepath.Dir(targetPath)); err != nil {
+			fo.logger.Errorf("Could not create directory for orphaned sidecar %s: %v", path, err)
+			fo.stats.AddError(path, "orphaned_sidecar", err.Error())
+			continue
+		}
+
+		targetPath = fo.reserveFreeTarget(path, targetPath)
+		err := fo.transferFile(path, targetPath)
+		fo.releaseTarget(targetPath)
+		if err != nil {
+			fo.logger.Errorf("Could not collect orphaned sidecar %s: %v", path, err)
+			fo.stats.AddError(path, "orphaned_sidecar", err.Error())
+			continue
+		}
+		fo.logger.Debugf("Collected orphaned sidecar: %s -> %s", path, targetPath)
+	}
+}
@@ -0,0 +1,46 @@
+package organizer
+
+import (
+	"path/filepath"
+
+	"photo-sorter-go/internal/config"
+)
+
+// sourceConfig holds the settings files found in a sources entry's
+// directory are organized with.
+type sourceConfig struct {
+	dir    string // absolute
+	config *config.Config
+}
+
+// newSourceConfigs returns the settings of the sources entries of cfg.
+func newSourceConfigs(cfg *config.Config) []sourceConfig {
+	configs := make([]sourceConfig, 0, len(cfg.Sources))
+	for _, source := range cfg.Sources {
+		dir, err := filepath.Abs(source.Path)
+		if err != nil {
+			dir = filepath.Clean(source.Path)
+		}
+		configs = append(configs, sourceConfig{dir: dir, config: cfg.WithSource(source)})
+	}
+	return configs
+}
+
+// configFor returns the settings the file or directory at path is organized
+// with: those of the innermost sources entry it was found in, or the
+// top-level ones.
+func (fo *FileOrganizer) configFor(path string) *config.Config {
+	if len(fo.sourceConfigs) == 0 {
+		return fo.config
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	cfg, depth := fo.config, -1
+	for _, source := range fo.sourceConfigs {
+		if (path == source.dir || isInsideDir(source.dir, path)) && len(source.dir) > depth {
+			cfg, depth = source.config, len(source.dir)
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,95 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestOrganizeRemovesStaleTempFiles(t *testing.T) {
+	tree := newTestTree(t)
+	tree.photo("IMG_0001.jpg", testDate)
+	inSource := tree.file("trip/interrupted.jpg"+tempSuffix, []byte("partial"))
+	inTarget := tree.targetFile("2001/01/01/interrupted.jpg"+tempSuffix, []byte("partial"))
+	inProgress := tree.targetFile("2003/11/23/copying.jpg"+tempSuffix, []byte("partial"))
+	defer trackTempFile(inProgress)()
+
+	organize(t, tree.config())
+
+	assertFile(t, tree.target("2003/11/23/IMG_0001.jpg"))
+	assertNoFile(t, inSource)
+	assertNoFile(t, inTarget)
+	assertFile(t, inProgress) // another run is still writing it
+}
+
+func TestConfirmedRunSweepsAndStops(t *testing.T) {
+	tree := newTestTree(t)
+	photo := tree.photo("IMG_0001.jpg", testDate)
+	stale := tree.targetFile("2001/01/01/interrupted.jpg"+tempSuffix, []byte("partial"))
+	fo, stats := newTestOrganizer(t, tree.config())
+	files, err := fo.DiscoverFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelled while waiting for confirmation, the run cleans up the
+	// target but processes nothing.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fo.ProcessDiscoveredFiles(ctx, files); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ProcessDiscoveredFiles = %v, want context.Canceled", err)
+	}
+	assertFile(t, photo)
+	assertCount(t, "FilesOrganized", stats.FilesOrganized, 0)
+
+	fo, _ = newTestOrganizer(t, tree.config())
+	if err := fo.ProcessDiscoveredFiles(context.Background(), files); err != nil {
+		t.Fatal(err)
+	}
+	assertNoFile(t, stale)
+	assertFile(t, tree.target("2003/11/23/IMG_0001.jpg"))
+}
+
+// failingWriter writes to w until it has written limit bytes, then fails
+// like a disk filling up.
+type failingWriter struct {
+	w     io.Writer
+	limit int
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > fw.limit {
+		n, _ := fw.w.Write(p[:fw.limit])
+		fw.limit -= n
+		return n, errors.New("no space left on device")
+	}
+	n, err := fw.w.Write(p)
+	fw.limit -= n
+	return n, err
+}
+
+func TestInterruptedCopyLeavesNoFile(t *testing.T) {
+	tree := newTestTree(t)
+	photo := tree.photo("IMG_0001.jpg", testDate)
+	dest := tree.target("IMG_0001.jpg")
+
+	var tempPath string
+	defer func(original func(*os.File) io.Writer) { newCopyWriter = original }(newCopyWriter)
+	newCopyWriter = func(tempFile *os.File) io.Writer {
+		tempPath = tempFile.Name()
+		return &failingWriter{w: tempFile, limit: 100}
+	}
+
+	fo, _ := newTestOrganizer(t, tree.config())
+	if err := fo.copyFile(photo, dest); err == nil {
+		t.Fatal("copying onto a full disk succeeded")
+	}
+	if tempPath != dest+tempSuffix {
+		t.Fatalf("copied through %q, want %q", tempPath, dest+tempSuffix)
+	}
+	assertNoFile(t, dest)
+	assertNoFile(t, tempPath)
+	assertFile(t, photo)
+}
@@ -0,0 +1,339 @@
+package organizer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"photo-sorter-go/internal/compressor"
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/extractor"
+	"photo-sorter-go/internal/statistics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testDate is the DateTimeOriginal of the test photos unless a test sets
+// another one.
+var testDate = time.Date(2003, 11, 23, 14, 5, 6, 0, time.UTC)
+
+// jpegWithDate returns a small JPEG whose EXIF DateTimeOriginal is date.
+// shade varies the pixels, so that photos of the same date can differ.
+func jpegWithDate(t testing.TB, date time.Time, shade uint8) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.RGBA{R: shade, G: uint8(x * 32), B: uint8(y * 32), A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatalf("encode JPEG: %v", err)
+	}
+	data := encoded.Bytes()
+
+	// The APP1 segment goes right after the start of image marker.
+	tiff := exifWithDate(date)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+6+len(tiff)))
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, tiff...)
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+// exifWithDate returns big-endian TIFF data holding an IFD0 that points to an
+// EXIF IFD with the DateTimeOriginal tag set to date.
+func exifWithDate(date time.Time) []byte {
+	const (
+		ifd0Offset     = 8
+		exifIFDOffset  = ifd0Offset + 2 + 12 + 4
+		dateOffset     = exifIFDOffset + 2 + 12 + 4
+		tagExifIFD     = 0x8769
+		tagDateTimeOrg = 0x9003
+		typeASCII      = 2
+		typeLong       = 4
+	)
+	value := append([]byte(date.Format("2006:01:02 15:04:05")), 0)
+
+	var b bytes.Buffer
+	b.WriteString("MM")
+	binary.Write(&b, binary.BigEndian, uint16(42))
+	binary.Write(&b, binary.BigEndian, uint32(ifd0Offset))
+	entry := func(tag, typ uint16, count, valueOrOffset uint32) {
+		binary.Write(&b, binary.BigEndian, uint16(1)) // one entry per IFD
+		binary.Write(&b, binary.BigEndian, tag)
+		binary.Write(&b, binary.BigEndian, typ)
+		binary.Write(&b, binary.BigEndian, count)
+		binary.Write(&b, binary.BigEndian, valueOrOffset)
+		binary.Write(&b, binary.BigEndian, uint32(0)) // no next IFD
+	}
+	entry(tagExifIFD, typeLong, 1, exifIFDOffset)
+	entry(tagDateTimeOrg, typeASCII, uint32(len(value)), dateOffset)
+	b.Write(value)
+	return b.Bytes()
+}
+
+// noisyPNG returns a PNG of random pixels, which converting to JPEG makes
+// much smaller.
+func noisyPNG(t testing.TB, seed int64) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	rng.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255 // opaque, or it would stay a PNG
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatalf("encode PNG: %v", err)
+	}
+	return encoded.Bytes()
+}
+
+// testTree is a source and a target directory for a test run.
+type testTree struct {
+	t      testing.TB
+	Source string
+	Target string
+}
+
+// newTestTree returns an empty source and target directory, removed when the
+// test ends.
+func newTestTree(t testing.TB) *testTree {
+	t.Helper()
+	root := t.TempDir()
+	// Source paths are resolved, so the paths the tests build must be too.
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	tree := &testTree{t: t, Source: filepath.Join(root, "src"), Target: filepath.Join(root, "target")}
+	for _, dir := range []string{tree.Source, tree.Target} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+// photo writes a JPEG taken on date at rel below the source directory and
+// returns its path.
+func (tree *testTree) photo(rel string, date time.Time) string {
+	tree.t.Helper()
+	return tree.file(rel, jpegWithDate(tree.t, date, uint8(len(rel))))
+}
+
+// file writes data at rel below the source directory, dated an hour ago, and
+// returns its path.
+func (tree *testTree) file(rel string, data []byte) string {
+	tree.t.Helper()
+	return writeTestFile(tree.t, filepath.Join(tree.Source, rel), data)
+}
+
+// targetFile writes data at rel below the target directory and returns its path.
+func (tree *testTree) targetFile(rel string, data []byte) string {
+	tree.t.Helper()
+	return writeTestFile(tree.t, filepath.Join(tree.Target, rel), data)
+}
+
+// source and target return the paths of rel below the source and the target
+// directory, written with slashes.
+func (tree *testTree) source(rel string) string {
+	return filepath.Join(tree.Source, filepath.FromSlash(rel))
+}
+
+func (tree *testTree) target(rel string) string {
+	return filepath.Join(tree.Target, filepath.FromSlash(rel))
+}
+
+// writeTestFile writes data at path, creating its directory, and dates it an
+// hour ago so that it is not taken for a file still being written.
+func writeTestFile(t testing.TB, path string, data []byte) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// config returns the default configuration for organizing tree, with
+// compression off and no settle time.
+func (tree *testTree) config() *config.Config {
+	tree.t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.SourceDirectory = tree.Source
+	target := tree.Target
+	cfg.TargetDirectory = &target
+	cfg.Compressor.Enabled = false
+	cfg.Processing.SettleTime = 0
+	cfg.Security.CheckDiskSpace = false
+	cfg.Performance.BatchSize = 4
+	return cfg
+}
+
+// newTestOrganizer returns an organizer for cfg with the default extractor,
+// logging nothing, and its statistics.
+func newTestOrganizer(t testing.TB, cfg *config.Config) (*FileOrganizer, *statistics.Statistics) {
+	t.Helper()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	stats := statistics.NewStatistics()
+	fo := NewFileOrganizer(cfg, log, stats, extractor.NewDefaultExtractor(log), compressor.NewDefaultCompressor())
+	return fo, stats
+}
+
+// organize runs the organizer for cfg to completion and returns its statistics.
+func organize(t testing.TB, cfg *config.Config) *statistics.Statistics {
+	t.Helper()
+	fo, stats := newTestOrganizer(t, cfg)
+	if err := fo.OrganizeFiles(context.Background()); err != nil {
+		t.Fatalf("OrganizeFiles: %v", err)
+	}
+	return stats
+}
+
+// recordReport makes fo report to memory and returns a function that ends
+// the report and returns its records.
+func recordReport(t testing.TB, fo *FileOrganizer, cfg *config.Config) func() []ReportRecord {
+	t.Helper()
+	var buf bytes.Buffer
+	report, err := NewReport(&buf, ReportFormatJSON, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fo.SetReport(report)
+	return func() []ReportRecord {
+		t.Helper()
+		if err := report.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var decoded struct {
+			Files []ReportRecord `json:"files"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		return decoded.Files
+	}
+}
+
+// assertFile fails the test unless a regular file exists at path.
+func assertFile(t testing.TB, path string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Errorf("expected file %s: %v", path, err)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		t.Errorf("expected %s to be a regular file, it is %v", path, info.Mode())
+	}
+}
+
+// assertNoFile fails the test if anything exists at path.
+func assertNoFile(t testing.TB, path string) {
+	t.Helper()
+	if _, err := os.Lstat(path); err == nil {
+		t.Errorf("expected no file at %s", path)
+	} else if !os.IsNotExist(err) {
+		t.Errorf("stat %s: %v", path, err)
+	}
+}
+
+// assertSameContent fails the test unless the file at path holds data.
+func assertSameContent(t testing.TB, path string, data []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("read %s: %v", path, err)
+		return
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("%s holds %d bytes that differ from the %d expected", path, len(got), len(data))
+	}
+}
+
+// assertCount fails the test unless counter, named name, is want.
+func assertCount(t testing.TB, name string, counter, want int64) {
+	t.Helper()
+	if counter != want {
+		t.Errorf("%s = %d, want %d", name, counter, want)
+	}
+}
+
+// treeState describes every entry below a directory: its mode, size,
+// modification time and, for files, a hash of its content.
+type treeState map[string]string
+
+// snapshotTree returns the state of the tree at root.
+func snapshotTree(t testing.TB, root string) treeState {
+	t.Helper()
+	state := make(treeState)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		desc := fmt.Sprintf("%v %d %s", info.Mode(), info.Size(), info.ModTime().Format(time.RFC3339Nano))
+		if info.Mode().IsRegular() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			desc += fmt.Sprintf(" %x", sha256.Sum256(data))
+		}
+		rel, _ := filepath.Rel(root, path)
+		state[filepath.ToSlash(rel)] = desc
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("snapshot %s: %v", root, err)
+	}
+	return state
+}
+
+// assertTreeUnchanged fails the test unless the tree at root is in the state
+// before.
+func assertTreeUnchanged(t testing.TB, root string, before treeState) {
+	t.Helper()
+	after := snapshotTree(t, root)
+	for path, desc := range before {
+		if now, ok := after[path]; !ok {
+			t.Errorf("%s: %s was removed", root, path)
+		} else if now != desc {
+			t.Errorf("%s: %s changed from %s to %s", root, path, desc, now)
+		}
+	}
+	for path := range after {
+		if _, ok := before[path]; !ok {
+			t.Errorf("%s: %s was created", root, path)
+		}
+	}
+}
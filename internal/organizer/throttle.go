@@ -0,0 +1,79 @@
+package organizer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// throttle limits how many files and bytes are transferred per second, shared
+// by all workers. Each file reserves the time it costs at the configured rates
+// on a common schedule; a worker whose slot lies in the future sleeps until it
+// comes up, which spreads transfers evenly instead of in bursts.
+type throttle struct {
+	filesPerSecond float64
+	bytesPerSecond float64
+
+	mu   sync.Mutex
+	next time.Time // when the next transfer may start
+}
+
+// newThrottle returns a throttle for the given rates, or nil if both are unlimited.
+func newThrottle(filesPerSecond float64, bytesPerSecond int64) *throttle {
+	if filesPerSecond <= 0 && bytesPerSecond <= 0 {
+		return nil
+	}
+	return &throttle{filesPerSecond: filesPerSecond, bytesPerSecond: float64(bytesPerSecond)}
+}
+
+// wait blocks until a file of the given size may be transferred and returns
+// how long it waited. It returns early with ctx's error when ctx is cancelled.
+func (t *throttle) wait(ctx context.Context, size int64) (time.Duration, error) {
+	if t == nil {
+		return 0, nil
+	}
+
+	var cost time.Duration
+	if t.filesPerSecond > 0 {
+		cost = time.Duration(float64(time.Second) / t.filesPerSecond)
+	}
+	if t.bytesPerSecond > 0 {
+		if byBytes := time.Duration(float64(size) / t.bytesPerSecond * float64(time.Second)); byBytes > cost {
+			cost = byBytes
+		}
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start.Add(cost)
+	t.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return time.Since(now), ctx.Err()
+	}
+}
+
+// throttled waits for the throttle before a file is processed, recording the
+// time spent waiting. It reports false if ctx was cancelled while waiting.
+// Dry runs transfer nothing and are never throttled.
+func (fo *FileOrganizer) throttled(ctx context.Context, file FileInfo) bool {
+	if fo.throttle == nil || fo.config.Security.DryRun {
+		return true
+	}
+	waited, err := fo.throttle.wait(ctx, file.Size)
+	fo.stats.AddThrottleWait(waited)
+	return err == nil
+}
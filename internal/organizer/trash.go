@@ -0,0 +1,35 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+)
+
+// trashExisting moves the file at path into the trash when overwrite_to_trash is
+// enabled, so that it can be recovered after being overwritten.
+func (fo *FileOrganizer) trashExisting(path string) error {
+	if !fo.config.Processing.OverwriteToTrash {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+
+	trashPath, err := fo.trash.Move(path)
+	if err != nil {
+		return fmt.Errorf("failed to move %s to trash: %w", path, err)
+	}
+	fo.stats.IncrementFilesTrashed(info.Size())
+	fo.logger.Infof("Moved existing file to trash: %s -> %s", path, trashPath)
+	return nil
+}
+
+// discardFile removes a file that is no longer needed, moving it into the
+// trash instead when overwrite_to_trash is enabled.
+func (fo *FileOrganizer) discardFile(path string) error {
+	if fo.config.Processing.OverwriteToTrash {
+		return fo.trashExisting(path)
+	}
+	return os.Remove(path)
+}
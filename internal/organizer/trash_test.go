@@ -0,0 +1,43 @@
+package organizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/trash"
+)
+
+func TestOverwriteMovesExistingToTrash(t *testing.T) {
+	tree := newTestTree(t)
+	src := tree.photo("IMG_0001.jpg", testDate)
+	incoming, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := []byte("the file already organized")
+	tree.targetFile("2003/11/23/IMG_0001.jpg", existing)
+
+	cfg := tree.config()
+	cfg.Processing.DuplicateHandling = config.DuplicatePolicy{"default": config.DuplicateOverwrite}
+	cfg.Processing.OverwriteToTrash = true
+	stats := organize(t, cfg)
+
+	assertSameContent(t, tree.target("2003/11/23/IMG_0001.jpg"), incoming)
+	trashed, err := filepath.Glob(filepath.Join(trash.Dir(tree.Target), "*", "2003", "11", "23", "IMG_0001.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 1 {
+		t.Fatalf("trash holds %q, want the overwritten file below its session", trashed)
+	}
+	assertSameContent(t, trashed[0], existing)
+
+	assertCount(t, "FilesTrashed", stats.FilesTrashed, 1)
+	assertCount(t, "BytesTrashed", stats.BytesTrashed, int64(len(existing)))
+	if summary := stats.GetSummary(); !strings.Contains(summary, "Files Trashed: 1") {
+		t.Errorf("summary does not report the trashed file:\n%s", summary)
+	}
+}
@@ -0,0 +1,150 @@
+package organizer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileID identifies a directory independently of the path it was reached by.
+type fileID struct {
+	dev, ino uint64
+	path     string // used where no device and inode are available
+}
+
+// treeWalker walks a directory tree like filepath.Walk, but can follow
+// symlinks. Directories already visited are skipped, which breaks symlink
+// loops and keeps a directory linked twice from being organized twice.
+type treeWalker struct {
+	fo      *FileOrganizer
+	fn      filepath.WalkFunc
+	follow  bool
+	visited map[fileID]bool
+	root    string // the resolved root directory
+}
+
+// walkTree walks root, calling fn for each file and directory in lexical
+// order like filepath.Walk. Broken symlinks are logged at debug level and
+// skipped. With follow_symlinks, symlinks to directories are walked as
+// directories under the link's path and symlinks to files are passed to fn
+// with their target's info; otherwise symlinked directories are skipped.
+func (fo *FileOrganizer) walkTree(root string, fn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		w := &treeWalker{
+			fo:      fo,
+			fn:      fn,
+			follow:  fo.config.Processing.FollowSymlinks,
+			visited: make(map[fileID]bool),
+			root:    root,
+		}
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			w.root = resolved
+		}
+		err = w.walk(root, info)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walk visits path, descending into it if it is a directory.
+func (w *treeWalker) walk(path string, info os.FileInfo) error {
+	linkedDir := false
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		if err != nil {
+			w.fo.logger.Debugf("Skipping broken symlink %s: %v", path, err)
+			return nil
+		}
+		if target.IsDir() {
+			if !w.follow {
+				return nil
+			}
+			w.fo.stats.IncrementSymlinkedDirs()
+			info, linkedDir = target, true
+		} else if w.follow {
+			// A link to a file inside the tree would organize that file twice.
+			if resolved, err := filepath.EvalSymlinks(path); err == nil && isAncestorDir(w.root, resolved) {
+				w.fo.logger.Debugf("Skipping symlink %s: its target %s is inside the source directory", path, resolved)
+				return nil
+			}
+			if w.fo.isSupportedFile(strings.ToLower(filepath.Ext(path))) {
+				w.fo.stats.IncrementSymlinkedFiles()
+			}
+			info = target
+		}
+	}
+
+	if !info.IsDir() {
+		return w.fn(path, info, nil)
+	}
+
+	if id, ok := fileIdentity(path, info); ok {
+		if w.visited[id] {
+			w.fo.logger.Debugf("Skipping %s: directory already visited (symlink loop or duplicate link)", path)
+			return nil
+		}
+		w.visited[id] = true
+	}
+
+	err := w.fn(path, info, nil)
+	if err != nil {
+		if linkedDir && err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	names, readErr := readDirNames(path)
+	if readErr != nil {
+		if err := w.fn(path, info, readErr); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+
+	for _, name := range names {
+		child := filepath.Join(path, name)
+		childInfo, err := os.Lstat(child)
+		if err != nil {
+			if err := w.fn(child, childInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := w.walk(child, childInfo); err != nil {
+			if !childInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readDirNames returns the sorted names of the entries in dir.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isSymlink reports whether path is a symbolic link.
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
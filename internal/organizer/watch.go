@@ -0,0 +1,307 @@
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// pendingFile is a file seen by the watcher that has not been organized yet.
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	changed time.Time // when the file was last seen changing
+
+	heldSince time.Time // when a sidecar began waiting for its media file; zero otherwise
+}
+
+// Watch organizes files as they appear in the source directory until ctx is
+// cancelled. A file is organized once its size and modification time have not
+// changed for the configured settle period, so half-written files are left alone.
+func (fo *FileOrganizer) Watch(ctx context.Context) error {
+	if err := fo.refuseArchiveTarget("watch"); err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	fo.stats.StartTime = time.Now()
+	fo.caseInsensitive = fo.detectCaseInsensitiveTarget()
+	fo.sweepTargetTempFiles(ctx) // cancelling is handled below
+
+	pending := make(map[string]*pendingFile)
+	if err := fo.watchTree(watcher, fo.config.SourceDirectory, nil); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", fo.config.SourceDirectory, err)
+	}
+
+	settle := fo.config.Watch.SettlePeriod
+	ticker := time.NewTicker(settleTick(settle))
+	defer ticker.Stop()
+
+	fo.logger.Infof("Watching %s for new files (settle period %v)", fo.config.SourceDirectory, settle)
+
+	for {
+		select {
+		case <-ctx.Done():
+			fo.stats.Finalize()
+			fo.logger.Info("Stopped watching")
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			fo.handleWatchEvent(watcher, event, pending)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fo.logger.Warnf("Watcher error: %v", err)
+
+		case <-ticker.C:
+			if ready := fo.settledFiles(pending, settle); len(ready) > 0 {
+				for _, path := range fo.organizeBatch(ctx, ready, pending) {
+					fo.retryPending(pending, path)
+				}
+			}
+		}
+	}
+}
+
+// settleTick returns how often pending files are checked for the settle period.
+func settleTick(settle time.Duration) time.Duration {
+	if tick := settle / 2; tick >= 100*time.Millisecond {
+		return tick
+	}
+	return 100 * time.Millisecond
+}
+
+// watchTree adds watches for dir and its subdirectories. Files already present
+// in newly watched directories are added to pending, since they may have been
+// created before the watch was registered.
+func (fo *FileOrganizer) watchTree(watcher *fsnotify.Watcher, dir string, pending map[string]*pendingFile) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if path != dir && fo.isWatchExcludedDir(path) {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				fo.logger.Warnf("Could not watch %s: %v", path, err)
+			}
+			return nil
+		}
+		if pending != nil {
+			fo.markPending(pending, path, info)
+		}
+		return nil
+	})
+}
+
+// isWatchExcludedDir reports whether the watcher should ignore a directory:
+// the organizer's own output directories, hidden directories with
+// ignore_hidden and, with skip_organized, directories that already look
+// organized (which is where files go when organizing in place).
+func (fo *FileOrganizer) isWatchExcludedDir(path string) bool {
+	if fo.isExcludedDir(path) || fo.isIgnoredHidden(path) {
+		return true
+	}
+	return fo.config.Processing.SkipOrganized && fo.isAlreadyOrganized(path)
+}
+
+// handleWatchEvent updates pending files for a filesystem event.
+func (fo *FileOrganizer) handleWatchEvent(watcher *fsnotify.Watcher, event fsnotify.Event, pending map[string]*pendingFile) {
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		// The file is gone (or renamed, which shows up as a new create);
+		// a file that vanishes before it settles is simply forgotten.
+		delete(pending, event.Name)
+		return
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		delete(pending, event.Name)
+		return
+	}
+	if info.IsDir() {
+		if event.Has(fsnotify.Create) && !fo.isWatchExcludedDir(event.Name) {
+			if err := fo.watchTree(watcher, event.Name, pending); err != nil {
+				fo.logger.Warnf("Could not watch %s: %v", event.Name, err)
+			}
+		}
+		return
+	}
+	if dir := filepath.Dir(event.Name); dir != fo.config.SourceDirectory && fo.isWatchExcludedDir(dir) {
+		return
+	}
+	fo.markPending(pending, event.Name, info)
+}
+
+// markPending records that a file was seen with the given state.
+func (fo *FileOrganizer) markPending(pending map[string]*pendingFile, path string, info os.FileInfo) {
+	if strings.HasSuffix(path, tempSuffix) {
+		return
+	}
+	entry, ok := pending[path]
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return
+	}
+	pending[path] = &pendingFile{size: info.Size(), modTime: info.ModTime(), changed: time.Now()}
+}
+
+// settledFiles removes and returns the pending files that have not changed for
+// the settle period. Files that no longer exist are dropped without error.
+func (fo *FileOrganizer) settledFiles(pending map[string]*pendingFile, settle time.Duration) map[string]*pendingFile {
+	ready := make(map[string]*pendingFile)
+	now := time.Now()
+	for path, entry := range pending {
+		if now.Sub(entry.changed) < settle {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(pending, path)
+			continue
+		}
+		if info.Size() != entry.size || !info.ModTime().Equal(entry.modTime) {
+			fo.markPending(pending, path, info)
+			continue
+		}
+		delete(pending, path)
+		ready[path] = entry
+	}
+	return ready
+}
+
+// retryPending puts a file back into pending, to be organized once it has
+// settled again.
+func (fo *FileOrganizer) retryPending(pending map[string]*pendingFile, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	pending[path] = &pendingFile{size: info.Size(), modTime: info.ModTime(), changed: time.Now()}
+}
+
+// organizeBatch organizes a set of settled files, grouping them with their
+// companions and sidecars like a normal run. Sidecars whose media file is
+// still pending go back into pending to be organized along with it; other
+// sidecars whose media file is not part of the batch are left in place. It
+// returns the files that were left alone because they still seem to be in
+// use, with their companions and sidecars, to be retried later.
+func (fo *FileOrganizer) organizeBatch(ctx context.Context, ready, pending map[string]*pendingFile) (retry []string) {
+	var files []FileInfo
+	var sidecars, filtered []string
+
+	for path := range ready {
+		info, err := os.Stat(path)
+		if err != nil || fo.skipHidden(path) {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !fo.isSupportedFile(ext) {
+			if fo.isSidecarFile(ext) {
+				sidecars = append(sidecars, path)
+			}
+			continue
+		}
+		if !fo.passesFilters(path, info) {
+			fo.stats.IncrementFilesSkipped()
+			filtered = append(filtered, path)
+			continue
+		}
+		files = append(files, fo.newFileInfo(path, info))
+	}
+
+	sidecars = fo.holdSidecars(sidecars, ready, pending)
+	files = fo.groupFiles(files, sidecars, filtered)
+	fo.orphanedSidecars = nil
+
+	process := fo.processFile
+	if fo.config.Security.DryRun {
+		process = fo.processDryRunFile
+	}
+	for _, file := range files {
+		// The file may have been removed while it settled; that is not an error.
+		if _, err := os.Stat(file.Path); err != nil {
+			continue
+		}
+		if inUse, reason := fo.inUse(file); inUse {
+			fo.logger.Debugf("Retrying %s later: %s", file.Path, reason)
+			retry = append(retry, file.Path)
+			for _, companion := range file.Companions {
+				retry = append(retry, companion.Path)
+			}
+			for _, sidecar := range file.Sidecars {
+				retry = append(retry, sidecar.Path)
+			}
+			continue
+		}
+		if !fo.throttled(ctx, file) {
+			return retry
+		}
+		fo.safeProcess(file, process)
+	}
+
+	if fo.config.Processing.RemoveEmptyDirs && !fo.config.Security.DryRun {
+		fo.removeEmptyDirs()
+	}
+	return retry
+}
+
+// holdSidecars returns the sidecars to organize with the batch. A sidecar
+// whose media file is still pending, because it settles later or is retried,
+// goes back into pending instead, so that it is organized along with its
+// media file rather than left behind as an orphan. It waits for at most
+// watch.sidecar_timeout.
+func (fo *FileOrganizer) holdSidecars(sidecars []string, ready, pending map[string]*pendingFile) []string {
+	if len(sidecars) == 0 {
+		return sidecars
+	}
+	// Sidecars are matched by base name (IMG_1.xmp) or full name (IMG_1.jpg.xmp).
+	media := make(map[string]bool)
+	for path := range pending {
+		if fo.isSupportedFile(strings.ToLower(filepath.Ext(path))) {
+			media[pairKey(path)] = true
+			media[strings.ToLower(path)] = true
+		}
+	}
+
+	now := time.Now()
+	var release []string
+	for _, path := range sidecars {
+		if !media[pairKey(path)] {
+			release = append(release, path)
+			continue
+		}
+		entry := *ready[path]
+		if entry.heldSince.IsZero() {
+			entry.heldSince = now
+		}
+		if waited := now.Sub(entry.heldSince); waited >= fo.config.Watch.SidecarTimeout {
+			fo.logger.Debugf("Sidecar %s waited %v for its media file, organizing it without", path, waited.Round(time.Second))
+			release = append(release, path)
+			continue
+		}
+		fo.logger.Debugf("Holding sidecar %s until its media file settles", path)
+		pending[path] = &entry
+	}
+	return release
+}
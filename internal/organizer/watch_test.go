@@ -0,0 +1,139 @@
+package organizer
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pendingEntry returns the pending state of the file at path, settled since
+// an hour ago.
+func pendingEntry(t *testing.T, path string) *pendingFile {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pendingFile{size: info.Size(), modTime: info.ModTime(), changed: time.Now().Add(-time.Hour)}
+}
+
+func TestWatchHoldsSidecarForItsMediaFile(t *testing.T) {
+	tree := newTestTree(t)
+	photo := tree.photo("IMG_0001.jpg", testDate)
+	sidecar := tree.file("IMG_0001.xmp", []byte("<x:xmpmeta/>"))
+	fo, stats := newTestOrganizer(t, tree.config())
+	ctx := context.Background()
+
+	// The sidecar settles while the photo is still pending.
+	pending := map[string]*pendingFile{photo: pendingEntry(t, photo)}
+	ready := map[string]*pendingFile{sidecar: pendingEntry(t, sidecar)}
+	if retry := fo.organizeBatch(ctx, ready, pending); len(retry) != 0 {
+		t.Fatalf("retry = %q, want nothing", retry)
+	}
+	assertFile(t, sidecar)
+	held, ok := pending[sidecar]
+	if !ok || held.heldSince.IsZero() {
+		t.Fatalf("sidecar is not held in pending: %+v", held)
+	}
+	assertCount(t, "OrphanedSidecars", stats.OrphanedSidecars, 0)
+
+	// Once the photo settles, both are organized together.
+	ready = fo.settledFiles(pending, time.Second)
+	if len(ready) != 2 {
+		t.Fatalf("settled %d files, want the photo and the held sidecar", len(ready))
+	}
+	fo.organizeBatch(ctx, ready, pending)
+	assertFile(t, tree.target("2003/11/23/IMG_0001.jpg"))
+	assertFile(t, tree.target("2003/11/23/IMG_0001.xmp"))
+	assertNoFile(t, sidecar)
+	assertCount(t, "SidecarsFound", stats.SidecarsFound, 1)
+	assertCount(t, "OrphanedSidecars", stats.OrphanedSidecars, 0)
+}
+
+func TestWatchReleasesSidecarAfterTimeout(t *testing.T) {
+	tree := newTestTree(t)
+	photo := tree.photo("IMG_0001.jpg", testDate)
+	sidecar := tree.file("IMG_0001.jpg.xmp", []byte("<x:xmpmeta/>"))
+	cfg := tree.config()
+	cfg.Watch.SidecarTimeout = time.Minute
+	fo, stats := newTestOrganizer(t, cfg)
+
+	pending := map[string]*pendingFile{photo: pendingEntry(t, photo)}
+	entry := pendingEntry(t, sidecar)
+	entry.heldSince = time.Now().Add(-2 * time.Minute)
+	fo.organizeBatch(context.Background(), map[string]*pendingFile{sidecar: entry}, pending)
+
+	if _, ok := pending[sidecar]; ok {
+		t.Error("sidecar is still held after the timeout")
+	}
+	// Without its media file in the batch, it is an orphan left in place.
+	assertFile(t, sidecar)
+	assertCount(t, "OrphanedSidecars", stats.OrphanedSidecars, 1)
+}
+
+func TestWatchRetriesSidecarsOfFilesInUse(t *testing.T) {
+	tree := newTestTree(t)
+	photo := tree.photo("IMG_0001.jpg", testDate)
+	sidecar := tree.file("IMG_0001.xmp", []byte("<x:xmpmeta/>"))
+	cfg := tree.config()
+	cfg.Processing.SettleTime = 2 * time.Hour // the photo, written an hour ago, seems in use
+	fo, _ := newTestOrganizer(t, cfg)
+
+	ready := map[string]*pendingFile{photo: pendingEntry(t, photo), sidecar: pendingEntry(t, sidecar)}
+	retry := fo.organizeBatch(context.Background(), ready, map[string]*pendingFile{})
+
+	if len(retry) != 2 || !slices.Contains(retry, photo) || !slices.Contains(retry, sidecar) {
+		t.Fatalf("retry = %q, want the photo and its sidecar", retry)
+	}
+	assertFile(t, photo)
+	assertFile(t, sidecar)
+}
+
+func TestWatchOrganizesSidecarWithSlowMediaFile(t *testing.T) {
+	tree := newTestTree(t)
+	cfg := tree.config()
+	cfg.Watch.SettlePeriod = 200 * time.Millisecond
+	fo, stats := newTestOrganizer(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- fo.Watch(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond) // for the watch to be registered
+
+	// The photo keeps being written well past the settle period of its
+	// sidecar, like a large file still being copied.
+	data := jpegWithDate(t, testDate, 1)
+	photo := tree.source("IMG_0001.jpg")
+	tree.file("IMG_0001.xmp", []byte("<x:xmpmeta/>"))
+	for written := 1; written <= len(data); written += len(data) / 8 {
+		if err := os.WriteFile(photo, data[:written], 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := os.WriteFile(photo, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, photoErr := os.Stat(tree.target("2003/11/23/IMG_0001.jpg"))
+		_, sidecarErr := os.Stat(tree.target("2003/11/23/IMG_0001.xmp"))
+		if photoErr == nil && sidecarErr == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("photo and sidecar were not organized together (orphaned sidecars: %d)", atomic.LoadInt64(&stats.OrphanedSidecars))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,170 @@
+// Package schedule parses the times jobs are scheduled at: a daily time such
+// as "03:00", or a cron expression of five fields (minute, hour, day of month,
+// month, day of week) such as "30 2 * * 1-5".
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch is how far ahead Next looks for a matching time; expressions such
+// as "0 0 30 2 *" never match.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// aliases are the predefined cron expressions.
+var aliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// field is the range of values of a cron field.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are Sunday
+}
+
+// Spec is a parsed schedule: the sets of minutes, hours, days of the month,
+// months and weekdays it fires at.
+type Spec struct {
+	minute, hour, dom, month, dow uint64
+
+	// A restricted day of month or day of week matches if either matches,
+	// as in cron; a field starting with "*", such as "*/2", leaves the
+	// choice to the other.
+	domAny, dowAny bool
+}
+
+// Parse parses a daily time ("HH:MM"), a cron expression or one of the
+// aliases @hourly, @daily, @weekly and @monthly.
+func Parse(expr string) (Spec, error) {
+	expr = strings.TrimSpace(expr)
+	if alias, ok := aliases[expr]; ok {
+		expr = alias
+	}
+	if hour, minute, ok := strings.Cut(expr, ":"); ok && !strings.Contains(expr, " ") {
+		h, errH := strconv.Atoi(hour)
+		m, errM := strconv.Atoi(minute)
+		if errH != nil || errM != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+			return Spec{}, fmt.Errorf("invalid time %q, expected HH:MM", expr)
+		}
+		expr = fmt.Sprintf("%d %d * * *", m, h)
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Spec{}, fmt.Errorf("invalid schedule %q: expected HH:MM or 5 cron fields", expr)
+	}
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return Spec{}, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1 // Sunday
+	}
+	return Spec{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: strings.HasPrefix(parts[2], "*"),
+		dowAny: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseField returns the set of values of one cron field: "*", a value, a
+// range "a-b", either with a step "/n", or a comma-separated list of those.
+func parseField(expr string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepExpr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s", stepExpr, f.name)
+			}
+			step = n
+		}
+
+		low, high := f.min, f.max
+		if rangeExpr != "*" {
+			from, to, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			if low, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid %s %q", f.name, item)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid %s %q", f.name, item)
+				}
+			} else if hasStep {
+				high = f.max
+			}
+		}
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("%s %q out of range %d-%d", f.name, item, f.min, f.max)
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time after after that s fires at, in after's
+// location, or the zero time if there is none within five years.
+func (s Spec) Next(after time.Time) time.Time {
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute()+1, 0, 0, after.Location())
+	end := after.Add(maxSearch)
+	for t.Before(end) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the day of month and day
+// of week fields.
+func (s Spec) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
@@ -0,0 +1,81 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday.
+	after := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"03:00", time.Date(2024, 5, 16, 3, 0, 0, 0, time.UTC)},
+		{"10:30", time.Date(2024, 5, 16, 10, 30, 0, 0, time.UTC)}, // not at after itself
+		{"10:31", time.Date(2024, 5, 15, 10, 31, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2024, 5, 15, 10, 40, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)},
+		{"15 1-3/2 * * *", time.Date(2024, 5, 16, 1, 15, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 5, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 5, 19, 9, 0, 0, 0, time.UTC)}, // 7 is Sunday
+		{"0 0 1 * *", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		// A restricted day of month or of week matches if either does.
+		{"0 0 20 * 5", time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 16 * 0", time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		// A stepped "*" leaves the choice to the other field, like "*".
+		{"0 0 */2 * 6", time.Date(2024, 5, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * */7", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			spec, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := spec.Next(after); !got.Equal(tt.want) {
+				t.Errorf("Next = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+5", 5*60*60)
+	spec, err := Parse("03:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 03:00 in UTC has passed, 03:00 five hours ahead of it has not.
+	after := time.Date(2024, 5, 15, 4, 0, 0, 0, time.UTC).In(loc)
+	want := time.Date(2024, 5, 16, 3, 0, 0, 0, loc)
+	if got := spec.Next(after); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	spec, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := spec.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %s, want the zero time", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"", "24:00", "03:60", "3 am", "* * * *", "60 * * * *", "0 0 0 * *",
+		"0 0 * 13 *", "0 0 * * 8", "*/0 * * * *", "5-1 * * * *", "@yearly",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package statistics
+
+import "sync/atomic"
+
+// EventSink receives the changes of the counters of Statistics as they
+// happen. kind is the name of the counter in snapshots, such as
+// "files_organized", with labels nil; the breakdowns send "file_type" (label
+// "type"), "date_folder" ("folder"), "placement" ("directory") and "error"
+// ("operation") events. OnEvent runs on the goroutine changing the counter,
+// after the change, so it must be quick and safe for concurrent use, and
+// must not change labels.
+type EventSink interface {
+	OnEvent(kind string, delta int64, labels map[string]string)
+}
+
+// EventFunc adapts a function to an EventSink.
+type EventFunc func(kind string, delta int64, labels map[string]string)
+
+// OnEvent calls f.
+func (f EventFunc) OnEvent(kind string, delta int64, labels map[string]string) {
+	f(kind, delta, labels)
+}
+
+// subscription is a subscribed sink; its address identifies it, as sinks
+// need not be comparable.
+type subscription struct {
+	sink EventSink
+}
+
+// Subscribe makes the counter changes of s reach sink until the returned
+// function is called. Changes merged with Add are not sent.
+func (s *Statistics) Subscribe(sink EventSink) (unsubscribe func()) {
+	sub := &subscription{sink: sink}
+	s.sinksMutex.Lock()
+	defer s.sinksMutex.Unlock()
+	var subs []*subscription
+	if cur := s.sinks.Load(); cur != nil {
+		subs = append(subs, *cur...)
+	}
+	subs = append(subs, sub)
+	s.sinks.Store(&subs)
+
+	return func() {
+		s.sinksMutex.Lock()
+		defer s.sinksMutex.Unlock()
+		cur := s.sinks.Load()
+		if cur == nil {
+			return
+		}
+		var rest []*subscription
+		for _, other := range *cur {
+			if other != sub {
+				rest = append(rest, other)
+			}
+		}
+		if len(rest) == 0 {
+			s.sinks.Store(nil) // back to the cheap path
+		} else {
+			s.sinks.Store(&rest)
+		}
+	}
+}
+
+// count adds delta to counter and sends the change as kind. Without sinks
+// this costs one atomic load more than the addition.
+func (s *Statistics) count(counter *int64, kind string, delta int64) {
+	atomic.AddInt64(counter, delta)
+	if subs := s.sinks.Load(); subs != nil {
+		for _, sub := range *subs {
+			sub.sink.OnEvent(kind, delta, nil)
+		}
+	}
+}
+
+// emitLabel sends a change of a breakdown, labeled key=value. The labels are
+// only built if there are sinks.
+func (s *Statistics) emitLabel(kind string, delta int64, key, value string) {
+	subs := s.sinks.Load()
+	if subs == nil {
+		return
+	}
+	labels := map[string]string{key: value}
+	for _, sub := range *subs {
+		sub.sink.OnEvent(kind, delta, labels)
+	}
+}
@@ -0,0 +1,59 @@
+package statistics
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// BenchmarkIncrementNoSink measures the counters workers update for every
+// file when nothing is subscribed, the cost every run pays.
+func BenchmarkIncrementNoSink(b *testing.B) {
+	s := NewStatistics()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.IncrementFilesProcessed()
+		}
+	})
+}
+
+// BenchmarkIncrementWithSink measures the same counter with a sink
+// subscribed, as with the web UI's live statistics.
+func BenchmarkIncrementWithSink(b *testing.B) {
+	s := NewStatistics()
+	var events atomic.Int64
+	defer s.Subscribe(EventFunc(func(kind string, delta int64, labels map[string]string) {
+		events.Add(delta)
+	}))()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.IncrementFilesProcessed()
+		}
+	})
+	if got := events.Load(); got != int64(b.N) {
+		b.Fatalf("sink got %d events, want %d", got, b.N)
+	}
+}
+
+// BenchmarkIncrementLabeled measures a breakdown, whose labels are only
+// built when a sink is subscribed.
+func BenchmarkIncrementLabeled(b *testing.B) {
+	for _, subscribed := range []bool{false, true} {
+		name := "no-sink"
+		if subscribed {
+			name = "with-sink"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := NewStatistics()
+			if subscribed {
+				defer s.Subscribe(EventFunc(func(kind string, delta int64, labels map[string]string) {
+					_ = labels["folder"]
+				}))()
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					s.IncrementDateFolder("2003/11")
+				}
+			})
+		})
+	}
+}
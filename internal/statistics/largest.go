@@ -0,0 +1,42 @@
+package statistics
+
+import "container/heap"
+
+// LargestFilesKept is how many of the largest files found Statistics keeps,
+// the most GetLargestFiles returns.
+const LargestFilesKept = 20
+
+// FileSize is a file found and its size.
+type FileSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// largestFiles is a min-heap of the largest files found so far, so that the
+// smallest of them is replaced when a larger file is found.
+type largestFiles []FileSize
+
+func (h largestFiles) Len() int           { return len(h) }
+func (h largestFiles) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h largestFiles) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *largestFiles) Push(x any)        { *h = append(*h, x.(FileSize)) }
+func (h *largestFiles) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// add keeps file if it is among the LargestFilesKept largest files seen.
+// Most files are smaller than the smallest one kept and cost one comparison.
+func (h *largestFiles) add(file FileSize) {
+	if len(*h) < LargestFilesKept {
+		heap.Push(h, file)
+		return
+	}
+	if file.Size <= (*h)[0].Size {
+		return
+	}
+	(*h)[0] = file
+	heap.Fix(h, 0)
+}
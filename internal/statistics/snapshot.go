@@ -0,0 +1,155 @@
+package statistics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is the state of the counters of a run, saved to compare runs.
+type Snapshot struct {
+	Kind            string           `json:"kind"` // scan, organize, plan or apply
+	DryRun          bool             `json:"dry_run"`
+	StartTime       time.Time        `json:"start_time"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	Counters        map[string]int64 `json:"counters"`
+	ErrorCategories map[string]int64 `json:"error_categories"` // errors by operation
+}
+
+// Snapshot returns the current counters of s, of a run of kind.
+func (s *Statistics) Snapshot(kind string) Snapshot {
+	snap := Snapshot{
+		Kind:            kind,
+		Counters:        make(map[string]int64),
+		ErrorCategories: make(map[string]int64),
+	}
+	for _, c := range s.counters() {
+		snap.Counters[c.name] = atomic.LoadInt64(c.value)
+	}
+	for _, category := range s.GetErrorsByCategory() {
+		snap.ErrorCategories[category.Operation] = category.Count
+	}
+	s.mutex.RLock()
+	snap.DryRun = s.DryRun
+	snap.StartTime = s.StartTime
+	snap.DurationSeconds = s.Duration.Seconds()
+	s.mutex.RUnlock()
+	return snap
+}
+
+// ReadSnapshot reads a snapshot written as JSON.
+func ReadSnapshot(r io.Reader) (Snapshot, error) {
+	var snap Snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return Snapshot{}, fmt.Errorf("invalid statistics snapshot: %w", err)
+	}
+	if snap.Counters == nil {
+		return Snapshot{}, fmt.Errorf("invalid statistics snapshot: no counters")
+	}
+	return snap, nil
+}
+
+// CounterDelta is a counter that differs between two snapshots.
+type CounterDelta struct {
+	Name   string `json:"name"`
+	Before int64  `json:"before"`
+	After  int64  `json:"after"`
+	Delta  int64  `json:"delta"`
+}
+
+// Diff is the difference between two snapshots.
+type Diff struct {
+	Counters           []CounterDelta `json:"counters"` // changed counters, by name
+	NewErrorCategories []string       `json:"new_error_categories"`
+
+	// Warnings are differences suggesting files were lost or failed, such
+	// as a run organizing fewer files than the dry run before it would have.
+	Warnings []string `json:"warnings"`
+}
+
+// Compare returns how after differs from before.
+func Compare(before, after Snapshot) Diff {
+	diff := Diff{
+		Counters:           []CounterDelta{},
+		NewErrorCategories: []string{},
+		Warnings:           []string{},
+	}
+
+	names := make(map[string]bool)
+	for name := range before.Counters {
+		names[name] = true
+	}
+	for name := range after.Counters {
+		names[name] = true
+	}
+	for name := range names {
+		if b, a := before.Counters[name], after.Counters[name]; a != b {
+			diff.Counters = append(diff.Counters, CounterDelta{Name: name, Before: b, After: a, Delta: a - b})
+		}
+	}
+	sort.Slice(diff.Counters, func(i, j int) bool { return diff.Counters[i].Name < diff.Counters[j].Name })
+
+	for operation := range after.ErrorCategories {
+		if before.ErrorCategories[operation] == 0 {
+			diff.NewErrorCategories = append(diff.NewErrorCategories, operation)
+		}
+	}
+	sort.Strings(diff.NewErrorCategories)
+
+	diff.Warnings = compareWarnings(before, after, diff)
+	return diff
+}
+
+// compareWarnings returns the suspicious differences between before and after.
+func compareWarnings(before, after Snapshot, diff Diff) []string {
+	warnings := []string{}
+	b, a := before.Counters, after.Counters
+
+	simulated := before.DryRun || before.Kind == "plan" || before.Kind == "scan"
+	real := !after.DryRun && (after.Kind == "organize" || after.Kind == "apply")
+	if simulated && real && a["files_organized"] < b["files_organized"] {
+		warnings = append(warnings, fmt.Sprintf("%s organized %d files, %d fewer than the %d the %s would have organized",
+			after.Kind, a["files_organized"], b["files_organized"]-a["files_organized"], b["files_organized"], before.Kind))
+	}
+	if a["total_files_found"] < b["total_files_found"] && before.Kind == after.Kind && before.Kind == "scan" {
+		warnings = append(warnings, fmt.Sprintf("the second scan found %d files, %d fewer than the first",
+			a["total_files_found"], b["total_files_found"]-a["total_files_found"]))
+	}
+	if a["files_with_errors"] > b["files_with_errors"] {
+		warnings = append(warnings, fmt.Sprintf("files with errors rose from %d to %d", b["files_with_errors"], a["files_with_errors"]))
+	}
+	if len(diff.NewErrorCategories) > 0 {
+		warnings = append(warnings, fmt.Sprintf("new kinds of errors: %v", diff.NewErrorCategories))
+	}
+	if a["plan_drift"] > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d plan entries were not applied because files changed", a["plan_drift"]))
+	}
+	if a["files_without_dates"] > b["files_without_dates"] {
+		warnings = append(warnings, fmt.Sprintf("files without dates rose from %d to %d", b["files_without_dates"], a["files_without_dates"]))
+	}
+	return warnings
+}
+
+// String returns the differences in a readable form.
+func (d Diff) String() string {
+	if len(d.Counters) == 0 && len(d.Warnings) == 0 {
+		return "No differences"
+	}
+	result := "Changed Counters:\n"
+	if len(d.Counters) == 0 {
+		result += "  none\n"
+	}
+	for _, c := range d.Counters {
+		result += fmt.Sprintf("  %s: %d -> %d (%+d)\n", c.Name, c.Before, c.After, c.Delta)
+	}
+	if len(d.Warnings) > 0 {
+		result += "\nWarnings:\n"
+		for _, w := range d.Warnings {
+			result += "  ! " + w + "\n"
+		}
+	}
+	return result
+}
@@ -2,18 +2,23 @@ package statistics
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// Statistics contains all statistics for the photo sorting operation.
+// Statistics contains all statistics for the photo sorting operation. Its
+// int64 counters, including those of DateExtractionStats, are changed and read
+// with sync/atomic while workers update them; the mutex guards the other
+// fields: the times and rates, DryRun, Errors and the maps.
 type Statistics struct {
 	TotalFilesFound     int64
 	TotalFilesProcessed int64
 	FilesOrganized      int64
 	FilesMoved          int64
 	FilesCopied         int64
+	FilesLinked         int64
 	FilesSkipped        int64
 	FilesWithErrors     int64
 	FilesWithoutDates   int64
@@ -25,11 +30,31 @@ type Statistics struct {
 	MPGTHMMerged        int64
 	MPGTHMErrors        int64
 
+	RAWJPEGPairsFound   int64
+	RAWJPEGPairsSplit   int64
+	LivePhotoPairsFound int64
+	LivePhotoPairsSplit int64
+
+	SidecarsFound    int64
+	OrphanedSidecars int64
+
 	DuplicatesFound    int64
 	DuplicatesRenamed  int64
 	DuplicatesSkipped  int64
 	DuplicatesReplaced int64
 
+	// DuplicatesIdentical and DuplicatesNameCollision split skipped duplicates
+	// by whether their contents match the existing file (verify_identical_skips).
+	DuplicatesIdentical     int64
+	DuplicatesNameCollision int64
+
+	// ImageDuplicates, VideoDuplicates and RAWDuplicates split the renamed,
+	// skipped and replaced duplicates by file category, as duplicate_handling
+	// may handle them differently.
+	ImageDuplicates DuplicateStats
+	VideoDuplicates DuplicateStats
+	RAWDuplicates   DuplicateStats
+
 	StartTime       time.Time
 	EndTime         time.Time
 	Duration        time.Duration
@@ -37,28 +62,169 @@ type Statistics struct {
 	BytesProcessed  int64
 	AverageFileSize int64
 
+	// BytesMoved, BytesCopied and BytesLinked count the sizes of the files
+	// transferred, duplicates included; BytesSkipped of the files left in
+	// place as duplicates or by plan; BytesWouldProcess of the files a dry
+	// run would transfer. BytesProcessed is their sum.
+	BytesMoved        int64
+	BytesCopied       int64
+	BytesLinked       int64
+	BytesSkipped      int64
+	BytesWouldProcess int64
+
+	// ThrottleWait is the total time workers waited for the transfer rate limit.
+	ThrottleWait int64 // nanoseconds
+
 	CacheHits    int64
 	CacheMisses  int64
 	CacheHitRate float64
 
 	DirectoriesCreated int64
 	DirectoriesScanned int64
+	DirectoriesRemoved int64
+	DirectoriesPruned  int64
+
+	// FilesInUse counts files skipped because they may still be being written.
+	FilesInUse int64
+
+	// HiddenFilesSkipped counts dotfiles and system junk (AppleDouble files,
+	// .DS_Store, Thumbs.db) ignored during discovery.
+	HiddenFilesSkipped int64
+
+	// SpaceRequired and SpaceAvailable are the bytes a run needs and has on
+	// the target filesystem, if they were checked before starting.
+	SpaceRequired  int64
+	SpaceAvailable int64
+
+	// SymlinkedFiles and SymlinkedDirs count symlinks followed during discovery.
+	SymlinkedFiles int64
+	SymlinkedDirs  int64
+
+	// MismatchedExtensions counts media files whose extension does not match
+	// their content (processing.detect_file_type).
+	MismatchedExtensions int64
+
+	FilesTrashed int64
+	BytesTrashed int64
+
+	// FilesCompressed and BytesSavedByCompression count the files compressed
+	// as they were organized (compressor.run_during_organize) and the bytes
+	// saved; in a dry run, what compression would save. CompressionErrors
+	// counts files left uncompressed because compression failed.
+	FilesCompressed         int64
+	BytesSavedByCompression int64
+	CompressionErrors       int64
+
+	FilteredBySize   int64
+	FilteredByMinAge int64
+	FilteredByMaxAge int64
+
+	// FilteredByPattern counts files and directories matching
+	// processing.exclude_patterns.
+	FilteredByPattern int64
+
+	// PlanDrift counts plan entries not applied because the filesystem changed.
+	PlanDrift int64
+
+	// FilesRemaining counts media files left for later runs by max_files_per_run.
+	FilesRemaining int64
+
+	// DiscoveryComplete is 1 once all files have been found, so that
+	// TotalFilesFound is final. Files are processed while discovery runs.
+	DiscoveryComplete int32
+
+	// DryRun marks statistics of a simulated run: FilesOrganized and the
+	// duplicate counters then count what would have been done. Set it with
+	// SetDryRun once the statistics may be read concurrently.
+	DryRun bool
 
 	Errors []StatError
 
+	// ErrorCategories counts the recorded errors by operation, also those
+	// not kept in Errors beyond the limit set with SetMaxErrors, which
+	// ErrorsDropped counts.
+	ErrorCategories map[string]*ErrorCategory
+	ErrorsDropped   int64
+	maxErrors       int // 0 keeps all errors
+
 	mutex sync.RWMutex
 
-	FileTypeStats map[string]int64
+	// sinks are the subscribed event sinks, nil without any; sinksMutex
+	// serializes subscribing, the sinks are read without locks.
+	sinks      atomic.Pointer[[]*subscription]
+	sinksMutex sync.Mutex
+
+	// FileTypeStats counts the files found and their bytes by extension,
+	// such as "CR2".
+	FileTypeStats map[string]*FileTypeStat
+
+	largest largestFiles // the largest files found
+
+	// DirectoryStats counts the files placed in each target directory, keyed
+	// by the directory's path relative to the target root.
+	DirectoryStats map[string]*DirectoryStat
+
+	// DateHistogram counts the files by date folder, the target directory
+	// levels given by date_format such as "2021/08", as targets are decided.
+	DateHistogram map[string]int64
 
 	DateExtractionStats DateExtractionStats
 }
 
+// DuplicateStats counts the duplicates of one file category by how they
+// were handled.
+type DuplicateStats struct {
+	Renamed  int64
+	Skipped  int64
+	Replaced int64
+}
+
+// DirectoryStat describes the files placed in one target directory.
+type DirectoryStat struct {
+	Directory  string `json:"directory"`
+	Files      int64  `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	Duplicates int64  `json:"duplicates"` // renamed or replaced duplicates among Files
+}
+
+// FileTypeStat is the number and total size of the files of one extension.
+type FileTypeStat struct {
+	Type  string `json:"type"`
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// DateBucket is the number of files of one date folder.
+type DateBucket struct {
+	Folder string `json:"folder"`
+	Files  int64  `json:"files"`
+}
+
 // StatError represents an error that occurred during processing.
 type StatError struct {
-	FilePath  string
-	Operation string
-	Error     string
-	Timestamp time.Time
+	FilePath  string    `json:"file_path"`
+	Operation string    `json:"operation"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// errorExamples is how many paths an ErrorCategory keeps as examples.
+const errorExamples = 3
+
+// ErrorCategory counts the errors of one operation, such as
+// "date_extraction" or "move_file".
+type ErrorCategory struct {
+	Operation string   `json:"operation"`
+	Count     int64    `json:"count"`
+	Examples  []string `json:"examples"` // the first paths that failed
+}
+
+// ErrorReport is the machine-readable form of the errors of a run.
+type ErrorReport struct {
+	Total      int64           `json:"total"`   // all recorded errors
+	Dropped    int64           `json:"dropped"` // not kept in Errors because of the limit
+	Categories []ErrorCategory `json:"categories"`
+	Errors     []StatError     `json:"errors"`
 }
 
 // DateExtractionStats contains statistics about date extraction methods.
@@ -67,6 +233,7 @@ type DateExtractionStats struct {
 	FromVideoMeta    int64
 	FromThumbnail    int64
 	FromFileName     int64
+	FromTakeoutJSON  int64
 	FromModTime      int64
 	ExtractionErrors int64
 }
@@ -75,128 +242,303 @@ type DateExtractionStats struct {
 func NewStatistics() *Statistics {
 	return &Statistics{
 		StartTime:           time.Now(),
-		FileTypeStats:       make(map[string]int64),
+		FileTypeStats:       make(map[string]*FileTypeStat),
+		DirectoryStats:      make(map[string]*DirectoryStat),
+		DateHistogram:       make(map[string]int64),
 		Errors:              make([]StatError, 0),
+		ErrorCategories:     make(map[string]*ErrorCategory),
 		DateExtractionStats: DateExtractionStats{},
 	}
 }
 
 // IncrementFilesFound increases the count of found files by 1.
 func (s *Statistics) IncrementFilesFound() {
-	atomic.AddInt64(&s.TotalFilesFound, 1)
+	s.count(&s.TotalFilesFound, "total_files_found", 1)
+}
+
+// AddFilesFound adjusts the count of found files by delta, e.g. when files
+// are grouped with a companion and no longer count on their own.
+func (s *Statistics) AddFilesFound(delta int64) {
+	s.count(&s.TotalFilesFound, "total_files_found", delta)
+}
+
+// SetDiscoveryComplete records that all files have been found.
+func (s *Statistics) SetDiscoveryComplete() {
+	atomic.StoreInt32(&s.DiscoveryComplete, 1)
+}
+
+// IsDiscoveryComplete reports whether all files have been found.
+func (s *Statistics) IsDiscoveryComplete() bool {
+	return atomic.LoadInt32(&s.DiscoveryComplete) == 1
+}
+
+// AddThrottleWait adds time a worker spent waiting for the transfer rate limit.
+func (s *Statistics) AddThrottleWait(d time.Duration) {
+	s.count(&s.ThrottleWait, "throttle_wait_ns", int64(d))
 }
 
 // IncrementFilesProcessed increases the count of processed files by 1.
 func (s *Statistics) IncrementFilesProcessed() {
-	atomic.AddInt64(&s.TotalFilesProcessed, 1)
+	s.count(&s.TotalFilesProcessed, "total_files_processed", 1)
 }
 
 // IncrementFilesOrganized increases the count of organized files by 1.
 func (s *Statistics) IncrementFilesOrganized() {
-	atomic.AddInt64(&s.FilesOrganized, 1)
+	s.count(&s.FilesOrganized, "files_organized", 1)
 }
 
 // IncrementFilesMoved increases the count of moved files by 1.
 func (s *Statistics) IncrementFilesMoved() {
-	atomic.AddInt64(&s.FilesMoved, 1)
+	s.count(&s.FilesMoved, "files_moved", 1)
 }
 
 // IncrementFilesCopied increases the count of copied files by 1.
 func (s *Statistics) IncrementFilesCopied() {
-	atomic.AddInt64(&s.FilesCopied, 1)
+	s.count(&s.FilesCopied, "files_copied", 1)
+}
+
+// IncrementFilesLinked increases the count of hardlinked or symlinked files by 1.
+func (s *Statistics) IncrementFilesLinked() {
+	s.count(&s.FilesLinked, "files_linked", 1)
 }
 
 // IncrementFilesSkipped increases the count of skipped files by 1.
 func (s *Statistics) IncrementFilesSkipped() {
-	atomic.AddInt64(&s.FilesSkipped, 1)
+	s.count(&s.FilesSkipped, "files_skipped", 1)
 }
 
 // IncrementFilesWithErrors increases the count of files with errors by 1.
 func (s *Statistics) IncrementFilesWithErrors() {
-	atomic.AddInt64(&s.FilesWithErrors, 1)
+	s.count(&s.FilesWithErrors, "files_with_errors", 1)
 }
 
 // IncrementFilesWithoutDates increases the count of files without dates by 1.
 func (s *Statistics) IncrementFilesWithoutDates() {
-	atomic.AddInt64(&s.FilesWithoutDates, 1)
+	s.count(&s.FilesWithoutDates, "files_without_dates", 1)
 }
 
 // IncrementVideoFilesFound increases the count of found video files by 1.
 func (s *Statistics) IncrementVideoFilesFound() {
-	atomic.AddInt64(&s.VideoFilesFound, 1)
+	s.count(&s.VideoFilesFound, "video_files_found", 1)
 }
 
 // IncrementVideoFilesProcessed increases the count of processed video files by 1.
 func (s *Statistics) IncrementVideoFilesProcessed() {
-	atomic.AddInt64(&s.VideoFilesProcessed, 1)
+	s.count(&s.VideoFilesProcessed, "video_files_processed", 1)
 }
 
 // IncrementThumbnailsFound increases the count of found thumbnails by 1.
 func (s *Statistics) IncrementThumbnailsFound() {
-	atomic.AddInt64(&s.ThumbnailsFound, 1)
+	s.count(&s.ThumbnailsFound, "thumbnails_found", 1)
 }
 
 // IncrementVideoPairsFound increases the count of found video pairs by 1.
 func (s *Statistics) IncrementVideoPairsFound() {
-	atomic.AddInt64(&s.VideoPairsFound, 1)
+	s.count(&s.VideoPairsFound, "video_pairs_found", 1)
 }
 
 // IncrementMPGTHMMerged increases the count of merged MPG/THM pairs by 1.
 func (s *Statistics) IncrementMPGTHMMerged() {
-	atomic.AddInt64(&s.MPGTHMMerged, 1)
+	s.count(&s.MPGTHMMerged, "mpg_thm_merged", 1)
 }
 
 // IncrementMPGTHMErrors increases the count of MPG/THM errors by 1.
 func (s *Statistics) IncrementMPGTHMErrors() {
-	atomic.AddInt64(&s.MPGTHMErrors, 1)
+	s.count(&s.MPGTHMErrors, "mpg_thm_errors", 1)
+}
+
+// IncrementRAWJPEGPairsFound increases the count of found RAW+JPEG pairs by 1.
+func (s *Statistics) IncrementRAWJPEGPairsFound() {
+	s.count(&s.RAWJPEGPairsFound, "raw_jpeg_pairs_found", 1)
+}
+
+// IncrementRAWJPEGPairsSplit increases the count of RAW+JPEG pairs that could not be kept together by 1.
+func (s *Statistics) IncrementRAWJPEGPairsSplit() {
+	s.count(&s.RAWJPEGPairsSplit, "raw_jpeg_pairs_split", 1)
+}
+
+// IncrementLivePhotoPairsFound increases the count of found Live Photo pairs by 1.
+func (s *Statistics) IncrementLivePhotoPairsFound() {
+	s.count(&s.LivePhotoPairsFound, "live_photo_pairs_found", 1)
+}
+
+// IncrementLivePhotoPairsSplit increases the count of Live Photo pairs that could not be kept together by 1.
+func (s *Statistics) IncrementLivePhotoPairsSplit() {
+	s.count(&s.LivePhotoPairsSplit, "live_photo_pairs_split", 1)
+}
+
+// IncrementSidecarsFound increases the count of sidecar files attached to media files by 1.
+func (s *Statistics) IncrementSidecarsFound() {
+	s.count(&s.SidecarsFound, "sidecars_found", 1)
+}
+
+// IncrementOrphanedSidecars increases the count of sidecar files without a media file by 1.
+func (s *Statistics) IncrementOrphanedSidecars() {
+	s.count(&s.OrphanedSidecars, "orphaned_sidecars", 1)
 }
 
 // IncrementDuplicatesFound increases the count of found duplicates by 1.
 func (s *Statistics) IncrementDuplicatesFound() {
-	atomic.AddInt64(&s.DuplicatesFound, 1)
+	s.count(&s.DuplicatesFound, "duplicates_found", 1)
+}
+
+// IncrementDuplicatesRenamed increases the count of renamed duplicates, and
+// of those of category ("image", "video" or "raw"), by 1.
+func (s *Statistics) IncrementDuplicatesRenamed(category string) {
+	s.count(&s.DuplicatesRenamed, "duplicates_renamed", 1)
+	s.count(&s.duplicatesOf(category).Renamed, "duplicates_renamed_"+category, 1)
+}
+
+// IncrementDuplicatesSkipped increases the count of skipped duplicates, and
+// of those of category, by 1.
+func (s *Statistics) IncrementDuplicatesSkipped(category string) {
+	s.count(&s.DuplicatesSkipped, "duplicates_skipped", 1)
+	s.count(&s.duplicatesOf(category).Skipped, "duplicates_skipped_"+category, 1)
+}
+
+// IncrementDuplicatesIdentical increases the count of skipped duplicates identical to the existing file by 1.
+func (s *Statistics) IncrementDuplicatesIdentical() {
+	s.count(&s.DuplicatesIdentical, "duplicates_identical", 1)
 }
 
-// IncrementDuplicatesRenamed increases the count of renamed duplicates by 1.
-func (s *Statistics) IncrementDuplicatesRenamed() {
-	atomic.AddInt64(&s.DuplicatesRenamed, 1)
+// IncrementDuplicatesNameCollision increases the count of skipped duplicates differing from the existing file by 1.
+func (s *Statistics) IncrementDuplicatesNameCollision() {
+	s.count(&s.DuplicatesNameCollision, "duplicates_name_collision", 1)
 }
 
-// IncrementDuplicatesSkipped increases the count of skipped duplicates by 1.
-func (s *Statistics) IncrementDuplicatesSkipped() {
-	atomic.AddInt64(&s.DuplicatesSkipped, 1)
+// IncrementDuplicatesReplaced increases the count of replaced duplicates, and
+// of those of category, by 1.
+func (s *Statistics) IncrementDuplicatesReplaced(category string) {
+	s.count(&s.DuplicatesReplaced, "duplicates_replaced", 1)
+	s.count(&s.duplicatesOf(category).Replaced, "duplicates_replaced_"+category, 1)
 }
 
-// IncrementDuplicatesReplaced increases the count of replaced duplicates by 1.
-func (s *Statistics) IncrementDuplicatesReplaced() {
-	atomic.AddInt64(&s.DuplicatesReplaced, 1)
+// duplicatesOf returns the duplicate counters of category; those of images
+// for unknown categories.
+func (s *Statistics) duplicatesOf(category string) *DuplicateStats {
+	switch category {
+	case "video":
+		return &s.VideoDuplicates
+	case "raw":
+		return &s.RAWDuplicates
+	}
+	return &s.ImageDuplicates
 }
 
 // IncrementDirectoriesCreated increases the count of created directories by 1.
 func (s *Statistics) IncrementDirectoriesCreated() {
-	atomic.AddInt64(&s.DirectoriesCreated, 1)
+	s.count(&s.DirectoriesCreated, "directories_created", 1)
 }
 
 // IncrementDirectoriesScanned increases the count of scanned directories by 1.
 func (s *Statistics) IncrementDirectoriesScanned() {
-	atomic.AddInt64(&s.DirectoriesScanned, 1)
+	s.count(&s.DirectoriesScanned, "directories_scanned", 1)
 }
 
-// IncrementCacheHits increases the cache hit count by 1.
-func (s *Statistics) IncrementCacheHits() {
+// IncrementDirectoriesRemoved increases the count of removed empty directories by 1.
+func (s *Statistics) IncrementDirectoriesRemoved() {
+	s.count(&s.DirectoriesRemoved, "directories_removed", 1)
+}
+
+// IncrementFilesTrashed records a file of the given size moved to the trash.
+func (s *Statistics) IncrementFilesTrashed(size int64) {
+	s.count(&s.FilesTrashed, "files_trashed", 1)
+	s.count(&s.BytesTrashed, "bytes_trashed", size)
+}
+
+// IncrementPlanDrift increases the count of plan entries skipped due to drift by 1.
+func (s *Statistics) IncrementPlanDrift() {
+	s.count(&s.PlanDrift, "plan_drift", 1)
+}
+
+// IncrementFilesRemaining increases the count of files left unprocessed by the per-run cap by 1.
+func (s *Statistics) IncrementFilesRemaining() {
+	s.count(&s.FilesRemaining, "files_remaining", 1)
+}
+
+// IncrementFilesInUse increases the count of files skipped as still being written by 1.
+func (s *Statistics) IncrementFilesInUse() {
+	s.count(&s.FilesInUse, "files_in_use", 1)
+}
+
+// IncrementHiddenFilesSkipped increases the count of hidden and system junk files ignored by 1.
+func (s *Statistics) IncrementHiddenFilesSkipped() {
+	s.count(&s.HiddenFilesSkipped, "hidden_files_skipped", 1)
+}
+
+// SetSpaceCheck records the space a run needs and has on the target filesystem.
+func (s *Statistics) SetSpaceCheck(required, available int64) {
+	atomic.StoreInt64(&s.SpaceRequired, required)
+	atomic.StoreInt64(&s.SpaceAvailable, available)
+}
+
+// IncrementSymlinkedFiles increases the count of symlinked media files followed by 1.
+func (s *Statistics) IncrementSymlinkedFiles() {
+	s.count(&s.SymlinkedFiles, "symlinked_files", 1)
+}
+
+// IncrementMismatchedExtensions increases the count of files whose extension does not match their content by 1.
+func (s *Statistics) IncrementMismatchedExtensions() {
+	s.count(&s.MismatchedExtensions, "mismatched_extensions", 1)
+}
+
+// IncrementSymlinkedDirs increases the count of symlinked directories followed by 1.
+func (s *Statistics) IncrementSymlinkedDirs() {
+	s.count(&s.SymlinkedDirs, "symlinked_dirs", 1)
+}
+
+// IncrementDirectoriesPruned increases the count of already organized directories skipped by 1.
+func (s *Statistics) IncrementDirectoriesPruned() {
+	s.count(&s.DirectoriesPruned, "directories_pruned", 1)
+}
+
+// IncrementFilteredBySize increases the count of files excluded by the minimum size filter by 1.
+func (s *Statistics) IncrementFilteredBySize() {
+	s.count(&s.FilteredBySize, "filtered_by_size", 1)
+}
+
+// IncrementFilteredByMinAge increases the count of files excluded as too recent by 1.
+func (s *Statistics) IncrementFilteredByMinAge() {
+	s.count(&s.FilteredByMinAge, "filtered_by_min_age", 1)
+}
+
+// IncrementFilteredByMaxAge increases the count of files excluded as too old by 1.
+func (s *Statistics) IncrementFilteredByMaxAge() {
+	s.count(&s.FilteredByMaxAge, "filtered_by_max_age", 1)
+}
+
+// IncrementFilteredByPattern increases the count of files and directories
+// matching an exclude pattern by 1.
+func (s *Statistics) IncrementFilteredByPattern() {
+	s.count(&s.FilteredByPattern, "filtered_by_pattern", 1)
+}
+
+// SetDryRun marks the statistics as those of a simulated run, or not.
+func (s *Statistics) SetDryRun(dryRun bool) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.CacheHits++
+	s.DryRun = dryRun
+}
+
+// IncrementCacheHits increases the cache hit count by 1.
+func (s *Statistics) IncrementCacheHits() {
+	s.count(&s.CacheHits, "cache_hits", 1)
 }
 
 // IncrementCacheMisses increases the cache miss count by 1.
 func (s *Statistics) IncrementCacheMisses() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.CacheMisses++
+	s.count(&s.CacheMisses, "cache_misses", 1)
 }
 
 // UpdateCacheHitRate updates the cache hit rate based on current hits and misses.
 func (s *Statistics) UpdateCacheHitRate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateCacheHitRate()
+}
+
+// updateCacheHitRate is UpdateCacheHitRate for callers holding the mutex.
+func (s *Statistics) updateCacheHitRate() {
 	hits := atomic.LoadInt64(&s.CacheHits)
 	misses := atomic.LoadInt64(&s.CacheMisses)
 	total := hits + misses
@@ -207,56 +549,185 @@ func (s *Statistics) UpdateCacheHitRate() {
 
 // IncrementDateFromEXIF increases the count of dates extracted from EXIF by 1.
 func (s *Statistics) IncrementDateFromEXIF() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.DateExtractionStats.FromEXIF++
+	s.count(&s.DateExtractionStats.FromEXIF, "date_from_exif", 1)
 }
 
 // IncrementDateFromVideoMeta increases the count of dates extracted from video metadata by 1.
 func (s *Statistics) IncrementDateFromVideoMeta() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.DateExtractionStats.FromVideoMeta++
+	s.count(&s.DateExtractionStats.FromVideoMeta, "date_from_video_meta", 1)
 }
 
 // IncrementDateFromThumbnail increases the count of dates extracted from thumbnails by 1.
 func (s *Statistics) IncrementDateFromThumbnail() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.DateExtractionStats.FromThumbnail++
+	s.count(&s.DateExtractionStats.FromThumbnail, "date_from_thumbnail", 1)
 }
 
 // IncrementDateFromFileName increases the count of dates extracted from filenames by 1.
 func (s *Statistics) IncrementDateFromFileName() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.DateExtractionStats.FromFileName++
+	s.count(&s.DateExtractionStats.FromFileName, "date_from_file_name", 1)
+}
+
+// IncrementDateFromTakeoutJSON increases the count of dates extracted from Google Takeout JSON by 1.
+func (s *Statistics) IncrementDateFromTakeoutJSON() {
+	s.count(&s.DateExtractionStats.FromTakeoutJSON, "date_from_takeout_json", 1)
 }
 
 // IncrementDateFromModTime increases the count of dates extracted from modification time by 1.
 func (s *Statistics) IncrementDateFromModTime() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.DateExtractionStats.FromModTime++
+	s.count(&s.DateExtractionStats.FromModTime, "date_from_mod_time", 1)
 }
 
 // IncrementDateExtractionErrors increases the count of date extraction errors by 1.
 func (s *Statistics) IncrementDateExtractionErrors() {
+	s.count(&s.DateExtractionStats.ExtractionErrors, "date_extraction_errors", 1)
+}
+
+// RecordFileType records a found file of fileType and size bytes at path, for
+// the per-type statistics and the largest files.
+func (s *Statistics) RecordFileType(fileType, path string, size int64) {
+	defer s.emitLabel("file_type", 1, "type", fileType) // once unlocked
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stat, ok := s.FileTypeStats[fileType]
+	if !ok {
+		stat = &FileTypeStat{Type: fileType}
+		s.FileTypeStats[fileType] = stat
+	}
+	stat.Files++
+	stat.Bytes += size
+	s.largest.add(FileSize{Path: path, Size: size})
+}
+
+// FileTypes returns the per-type statistics, the largest types by size first.
+func (s *Statistics) FileTypes() []FileTypeStat {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]FileTypeStat, 0, len(s.FileTypeStats))
+	for _, stat := range s.FileTypeStats {
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
+
+// GetLargestFiles returns the n largest files found, largest first; at most
+// LargestFilesKept are kept.
+func (s *Statistics) GetLargestFiles(n int) []FileSize {
+	s.mutex.RLock()
+	result := append([]FileSize(nil), s.largest...)
+	s.mutex.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Size != result[j].Size {
+			return result[i].Size > result[j].Size
+		}
+		return result[i].Path < result[j].Path
+	})
+	return result[:min(n, len(result))]
+}
+
+// IncrementDateFolder increases the count of files dated into folder by 1.
+func (s *Statistics) IncrementDateFolder(folder string) {
+	defer s.emitLabel("date_folder", 1, "folder", folder)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.DateExtractionStats.ExtractionErrors++
+	s.DateHistogram[folder]++
 }
 
-// IncrementFileType increases the count for a specific file type by 1.
-func (s *Statistics) IncrementFileType(fileType string) {
+// GetDateHistogram returns the number of files of each date folder, sorted
+// by folder and so by date.
+func (s *Statistics) GetDateHistogram() []DateBucket {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]DateBucket, 0, len(s.DateHistogram))
+	for folder, files := range s.DateHistogram {
+		result = append(result, DateBucket{Folder: folder, Files: files})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Folder < result[j].Folder
+	})
+	return result
+}
+
+// RecordPlacement records a file of the given size placed in a target
+// directory (relative to the target root); duplicate marks a renamed or
+// replaced duplicate.
+func (s *Statistics) RecordPlacement(dir string, size int64, duplicate bool) {
+	defer s.emitLabel("placement", 1, "directory", dir)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.FileTypeStats[fileType]++
+	stat, ok := s.DirectoryStats[dir]
+	if !ok {
+		stat = &DirectoryStat{Directory: dir}
+		s.DirectoryStats[dir] = stat
+	}
+	stat.Files++
+	stat.Bytes += size
+	if duplicate {
+		stat.Duplicates++
+	}
+}
+
+// DirectoryBreakdown returns the per-directory placement counts sorted by directory.
+func (s *Statistics) DirectoryBreakdown() []DirectoryStat {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]DirectoryStat, 0, len(s.DirectoryStats))
+	for _, stat := range s.DirectoryStats {
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Directory < result[j].Directory
+	})
+	return result
+}
+
+// RecordCompression records a file compressed after it was organized,
+// saving the given number of bytes.
+func (s *Statistics) RecordCompression(saved int64) {
+	s.count(&s.FilesCompressed, "files_compressed", 1)
+	s.count(&s.BytesSavedByCompression, "bytes_saved_by_compression", saved)
+}
+
+// IncrementCompressionErrors records a file that could not be compressed
+// after it was organized.
+func (s *Statistics) IncrementCompressionErrors() {
+	s.count(&s.CompressionErrors, "compression_errors", 1)
+}
+
+// AddBytesMoved adds the size of a moved file.
+func (s *Statistics) AddBytesMoved(bytes int64) {
+	s.addBytes(&s.BytesMoved, "bytes_moved", bytes)
+}
+
+// AddBytesCopied adds the size of a copied file.
+func (s *Statistics) AddBytesCopied(bytes int64) {
+	s.addBytes(&s.BytesCopied, "bytes_copied", bytes)
 }
 
-// AddBytesProcessed adds the given number of bytes to the total bytes processed.
-func (s *Statistics) AddBytesProcessed(bytes int64) {
-	atomic.AddInt64(&s.BytesProcessed, bytes)
+// AddBytesLinked adds the size of a file linked into the target.
+func (s *Statistics) AddBytesLinked(bytes int64) {
+	s.addBytes(&s.BytesLinked, "bytes_linked", bytes)
+}
+
+// AddBytesSkipped adds the size of a file left in place.
+func (s *Statistics) AddBytesSkipped(bytes int64) {
+	s.addBytes(&s.BytesSkipped, "bytes_skipped", bytes)
+}
+
+// AddBytesWouldProcess adds the size of a file a dry run would transfer.
+func (s *Statistics) AddBytesWouldProcess(bytes int64) {
+	s.addBytes(&s.BytesWouldProcess, "bytes_would_process", bytes)
+}
+
+// addBytes adds bytes to counter, sent as kind, and to BytesProcessed, their sum.
+func (s *Statistics) addBytes(counter *int64, kind string, bytes int64) {
+	s.count(counter, kind, bytes)
+	s.count(&s.BytesProcessed, "bytes_processed", bytes)
 }
 
 // Finalize calculates final statistics such as duration, files per second, and average file size.
@@ -278,14 +749,37 @@ func (s *Statistics) Finalize() {
 		s.AverageFileSize = bytesProcessed / totalProcessed
 	}
 
-	s.UpdateCacheHitRate()
+	s.updateCacheHitRate()
+}
+
+// SetMaxErrors limits the errors kept in Errors to max, 0 for no limit, so
+// that a run failing on many files does not hold all their errors in memory.
+// Errors beyond the limit are still counted by category.
+func (s *Statistics) SetMaxErrors(max int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.maxErrors = max
 }
 
 // AddError records an error that occurred during processing.
 func (s *Statistics) AddError(filePath, operation, errorMsg string) {
+	defer s.emitLabel("error", 1, "operation", operation)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	category, ok := s.ErrorCategories[operation]
+	if !ok {
+		category = &ErrorCategory{Operation: operation}
+		s.ErrorCategories[operation] = category
+	}
+	category.Count++
+	if len(category.Examples) < errorExamples {
+		category.Examples = append(category.Examples, filePath)
+	}
+	if s.maxErrors > 0 && len(s.Errors) >= s.maxErrors {
+		atomic.AddInt64(&s.ErrorsDropped, 1)
+		return
+	}
 	s.Errors = append(s.Errors, StatError{
 		FilePath:  filePath,
 		Operation: operation,
@@ -296,17 +790,29 @@ func (s *Statistics) AddError(filePath, operation, errorMsg string) {
 
 // GetSummary returns a formatted summary of all statistics.
 func (s *Statistics) GetSummary() string {
-	return fmt.Sprintf(`Photo Sorter Statistics Summary:
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	title, organized := "Photo Sorter Statistics Summary:", "Organized"
+	if s.DryRun {
+		title, organized = "Photo Sorter Statistics Summary (dry run, nothing was changed):", "Would Organize"
+	}
+	return fmt.Sprintf(`%s
 
 Files:
 		Total Found: %d
 		Total Processed: %d
-		Organized: %d
+		%s: %d
 		Moved: %d
 		Copied: %d
+		Linked: %d
 		Skipped: %d
+		In Use (retry later): %d
+		Hidden/Junk Skipped: %d
 		Errors: %d
 		Without Dates: %d
+		Via Symlink: %d
+		Wrong Extension: %d
 
 Videos:
 		Videos Found: %d
@@ -316,16 +822,41 @@ Videos:
 		MPG/THM Merged: %d
 		MPG/THM Errors: %d
 
+Pairs:
+		RAW+JPEG Pairs: %d
+		RAW+JPEG Pairs Split: %d
+		Live Photo Pairs: %d
+		Live Photo Pairs Split: %d
+
+Sidecars:
+		Attached: %d
+		Orphaned: %d
+
 Duplicates:
 		Found: %d
 		Renamed: %d
 		Skipped: %d
+		  Identical: %d
+		  Name Collisions: %d
 		Replaced: %d
+		Images: %d renamed, %d skipped, %d replaced
+		Videos: %d renamed, %d skipped, %d replaced
+		RAW: %d renamed, %d skipped, %d replaced
+
+Trash:
+		Files Trashed: %d
+		Bytes Trashed: %s
+
+Compression:
+		Files Compressed: %d
+		Bytes Saved: %s
+		Errors: %d
 
 Performance:
 		Duration: %v
 		Files/Second: %.2f
-		Bytes Processed: %s
+		Throttled: %v
+		Bytes Processed: %s (moved %s, copied %s, linked %s, skipped %s, dry run %s)
 		Average File Size: %s
 
 Cache:
@@ -338,89 +869,248 @@ Date Extraction:
 		From Video Metadata: %d
 		From Thumbnail: %d
 		From Filename: %d
+		From Takeout JSON: %d
 		From ModTime: %d
 		Extraction Errors: %d
 
 Directories:
 		Created: %d
-		Scanned: %d`,
+		Scanned: %d
+		Removed: %d
+		Already Organized: %d
+		Symlinks Followed: %d`,
+		title,
 		atomic.LoadInt64(&s.TotalFilesFound),
 		atomic.LoadInt64(&s.TotalFilesProcessed),
+		organized,
 		atomic.LoadInt64(&s.FilesOrganized),
 		atomic.LoadInt64(&s.FilesMoved),
 		atomic.LoadInt64(&s.FilesCopied),
+		atomic.LoadInt64(&s.FilesLinked),
 		atomic.LoadInt64(&s.FilesSkipped),
+		atomic.LoadInt64(&s.FilesInUse),
+		atomic.LoadInt64(&s.HiddenFilesSkipped),
 		atomic.LoadInt64(&s.FilesWithErrors),
 		atomic.LoadInt64(&s.FilesWithoutDates),
+		atomic.LoadInt64(&s.SymlinkedFiles),
+		atomic.LoadInt64(&s.MismatchedExtensions),
 		atomic.LoadInt64(&s.VideoFilesFound),
 		atomic.LoadInt64(&s.VideoFilesProcessed),
 		atomic.LoadInt64(&s.ThumbnailsFound),
 		atomic.LoadInt64(&s.VideoPairsFound),
 		atomic.LoadInt64(&s.MPGTHMMerged),
 		atomic.LoadInt64(&s.MPGTHMErrors),
+		atomic.LoadInt64(&s.RAWJPEGPairsFound),
+		atomic.LoadInt64(&s.RAWJPEGPairsSplit),
+		atomic.LoadInt64(&s.LivePhotoPairsFound),
+		atomic.LoadInt64(&s.LivePhotoPairsSplit),
+		atomic.LoadInt64(&s.SidecarsFound),
+		atomic.LoadInt64(&s.OrphanedSidecars),
 		atomic.LoadInt64(&s.DuplicatesFound),
 		atomic.LoadInt64(&s.DuplicatesRenamed),
 		atomic.LoadInt64(&s.DuplicatesSkipped),
+		atomic.LoadInt64(&s.DuplicatesIdentical),
+		atomic.LoadInt64(&s.DuplicatesNameCollision),
 		atomic.LoadInt64(&s.DuplicatesReplaced),
+		atomic.LoadInt64(&s.ImageDuplicates.Renamed),
+		atomic.LoadInt64(&s.ImageDuplicates.Skipped),
+		atomic.LoadInt64(&s.ImageDuplicates.Replaced),
+		atomic.LoadInt64(&s.VideoDuplicates.Renamed),
+		atomic.LoadInt64(&s.VideoDuplicates.Skipped),
+		atomic.LoadInt64(&s.VideoDuplicates.Replaced),
+		atomic.LoadInt64(&s.RAWDuplicates.Renamed),
+		atomic.LoadInt64(&s.RAWDuplicates.Skipped),
+		atomic.LoadInt64(&s.RAWDuplicates.Replaced),
+		atomic.LoadInt64(&s.FilesTrashed),
+		FormatBytes(atomic.LoadInt64(&s.BytesTrashed)),
+		atomic.LoadInt64(&s.FilesCompressed),
+		FormatBytes(atomic.LoadInt64(&s.BytesSavedByCompression)),
+		atomic.LoadInt64(&s.CompressionErrors),
 		s.Duration,
 		s.FilesPerSecond,
-		formatBytes(atomic.LoadInt64(&s.BytesProcessed)),
-		formatBytes(s.AverageFileSize),
+		time.Duration(atomic.LoadInt64(&s.ThrottleWait)).Round(time.Millisecond),
+		FormatBytes(atomic.LoadInt64(&s.BytesProcessed)),
+		FormatBytes(atomic.LoadInt64(&s.BytesMoved)),
+		FormatBytes(atomic.LoadInt64(&s.BytesCopied)),
+		FormatBytes(atomic.LoadInt64(&s.BytesLinked)),
+		FormatBytes(atomic.LoadInt64(&s.BytesSkipped)),
+		FormatBytes(atomic.LoadInt64(&s.BytesWouldProcess)),
+		FormatBytes(s.AverageFileSize),
 		atomic.LoadInt64(&s.CacheHits),
 		atomic.LoadInt64(&s.CacheMisses),
 		s.CacheHitRate*100,
-		s.DateExtractionStats.FromEXIF,
-		s.DateExtractionStats.FromVideoMeta,
-		s.DateExtractionStats.FromThumbnail,
-		s.DateExtractionStats.FromFileName,
-		s.DateExtractionStats.FromModTime,
-		s.DateExtractionStats.ExtractionErrors,
+		atomic.LoadInt64(&s.DateExtractionStats.FromEXIF),
+		atomic.LoadInt64(&s.DateExtractionStats.FromVideoMeta),
+		atomic.LoadInt64(&s.DateExtractionStats.FromThumbnail),
+		atomic.LoadInt64(&s.DateExtractionStats.FromFileName),
+		atomic.LoadInt64(&s.DateExtractionStats.FromTakeoutJSON),
+		atomic.LoadInt64(&s.DateExtractionStats.FromModTime),
+		atomic.LoadInt64(&s.DateExtractionStats.ExtractionErrors),
 		atomic.LoadInt64(&s.DirectoriesCreated),
-		atomic.LoadInt64(&s.DirectoriesScanned))
+		atomic.LoadInt64(&s.DirectoriesScanned),
+		atomic.LoadInt64(&s.DirectoriesRemoved),
+		atomic.LoadInt64(&s.DirectoriesPruned),
+		atomic.LoadInt64(&s.SymlinkedDirs))
 }
 
-// GetFileTypeBreakdown returns a formatted breakdown of file types processed.
+// GetFileTypeBreakdown returns a formatted breakdown of the file types found
+// with their sizes and share of all bytes, the largest types first.
 func (s *Statistics) GetFileTypeBreakdown() string {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	if len(s.FileTypeStats) == 0 {
+	types := s.FileTypes()
+	if len(types) == 0 {
 		return "No file type statistics available"
 	}
 
+	var total int64
+	for _, stat := range types {
+		total += stat.Bytes
+	}
 	result := "File Type Breakdown:\n"
-	for fileType, count := range s.FileTypeStats {
-		result += fmt.Sprintf("  %s: %d\n", fileType, count)
+	for _, stat := range types {
+		share := 0.0
+		if total > 0 {
+			share = float64(stat.Bytes) * 100 / float64(total)
+		}
+		result += fmt.Sprintf("  %s: %d files, %s (%.1f%%)\n", stat.Type, stat.Files, FormatBytes(stat.Bytes), share)
 	}
 	return result
 }
 
-// GetErrorSummary returns a summary of errors that occurred during processing.
-func (s *Statistics) GetErrorSummary() string {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+// GetLargestFilesSummary returns a formatted list of the n largest files found.
+func (s *Statistics) GetLargestFilesSummary(n int) string {
+	largest := s.GetLargestFiles(n)
+	if len(largest) == 0 {
+		return "No files found"
+	}
 
-	if len(s.Errors) == 0 {
-		return "No errors occurred during processing"
+	result := "Largest Files:\n"
+	for _, file := range largest {
+		result += fmt.Sprintf("  %9s  %s\n", FormatBytes(file.Size), file.Path)
+	}
+	return result
+}
+
+// GetDirectoryBreakdown returns a formatted list of the target directories
+// files were placed in, sorted by directory (and so by date for date folders).
+func (s *Statistics) GetDirectoryBreakdown() string {
+	breakdown := s.DirectoryBreakdown()
+	if len(breakdown) == 0 {
+		return "No files were placed in target directories"
 	}
 
-	result := fmt.Sprintf("Errors (%d total):\n", len(s.Errors))
-	for i, err := range s.Errors {
-		if i >= 10 {
-			result += fmt.Sprintf("  ... and %d more errors\n", len(s.Errors)-10)
+	result := "Target Directories:\n"
+	for _, stat := range breakdown {
+		result += fmt.Sprintf("  %s — %d files, %s", stat.Directory, stat.Files, FormatBytes(stat.Bytes))
+		if stat.Duplicates > 0 {
+			result += fmt.Sprintf(" (%d duplicates)", stat.Duplicates)
+		}
+		result += "\n"
+	}
+	return result
+}
+
+// GetDateHistogramSummary returns the top date folders with the most files,
+// busiest first, to spot dates that got suspiciously many files.
+func (s *Statistics) GetDateHistogramSummary(top int) string {
+	histogram := s.GetDateHistogram()
+	if len(histogram) == 0 {
+		return "No files were dated into date folders"
+	}
+	sort.SliceStable(histogram, func(i, j int) bool {
+		return histogram[i].Files > histogram[j].Files
+	})
+
+	result := fmt.Sprintf("Busiest Date Folders (%d folders):\n", len(histogram))
+	for i, bucket := range histogram {
+		if i >= top {
+			result += fmt.Sprintf("  ... and %d more folders\n", len(histogram)-top)
 			break
 		}
-		result += fmt.Sprintf("  [%s] %s: %s - %s\n",
-			err.Timestamp.Format("15:04:05"),
-			err.Operation,
-			err.FilePath,
-			err.Error)
+		result += fmt.Sprintf("  %s: %d files\n", bucket.Folder, bucket.Files)
 	}
 	return result
 }
 
-// formatBytes returns a human-readable string for a byte count.
-func formatBytes(bytes int64) string {
+// GetFilterSummary returns a breakdown of files excluded by discovery filters.
+func (s *Statistics) GetFilterSummary() string {
+	return fmt.Sprintf(`Discovery Filters:
+		Below Minimum Size: %d
+		Newer Than Min Age: %d
+		Older Than Max Age: %d
+		Exclude Patterns: %d`,
+		atomic.LoadInt64(&s.FilteredBySize),
+		atomic.LoadInt64(&s.FilteredByMinAge),
+		atomic.LoadInt64(&s.FilteredByMaxAge),
+		atomic.LoadInt64(&s.FilteredByPattern))
+}
+
+// GetErrorSummary returns the number of errors of each operation, the most
+// frequent first, with the first paths that failed.
+func (s *Statistics) GetErrorSummary() string {
+	categories := s.GetErrorsByCategory()
+	if len(categories) == 0 {
+		return "No errors occurred during processing"
+	}
+
+	var total int64
+	for _, category := range categories {
+		total += category.Count
+	}
+	result := fmt.Sprintf("Errors (%d total):\n", total)
+	for _, category := range categories {
+		result += fmt.Sprintf("  %s: %d\n", category.Operation, category.Count)
+		for _, path := range category.Examples {
+			result += "    " + path + "\n"
+		}
+		if more := category.Count - int64(len(category.Examples)); more > 0 {
+			result += fmt.Sprintf("    ... and %d more\n", more)
+		}
+	}
+	return result
+}
+
+// GetErrorsByCategory returns the error counts by operation, the most
+// frequent first.
+func (s *Statistics) GetErrorsByCategory() []ErrorCategory {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]ErrorCategory, 0, len(s.ErrorCategories))
+	for _, category := range s.ErrorCategories {
+		c := *category
+		c.Examples = append([]string(nil), category.Examples...)
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Operation < result[j].Operation
+	})
+	return result
+}
+
+// GetErrorReport returns every kept error with the counts by operation.
+func (s *Statistics) GetErrorReport() ErrorReport {
+	report := ErrorReport{
+		Categories: s.GetErrorsByCategory(),
+		Errors:     append([]StatError{}, s.GetErrors()...),
+		Dropped:    atomic.LoadInt64(&s.ErrorsDropped),
+	}
+	for _, category := range report.Categories {
+		report.Total += category.Count
+	}
+	return report
+}
+
+// GetErrors returns a copy of the errors that occurred during processing.
+func (s *Statistics) GetErrors() []StatError {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]StatError(nil), s.Errors...)
+}
+
+// FormatBytes returns a human-readable string for a byte count.
+func FormatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
@@ -435,23 +1125,18 @@ func formatBytes(bytes int64) string {
 
 // GetTotalFilesProcessed returns the total number of files processed.
 func (s *Statistics) GetTotalFilesProcessed() int64 {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	return s.TotalFilesProcessed
+	return atomic.LoadInt64(&s.TotalFilesProcessed)
 }
 
 // GetFilesOrganized returns the total number of files organized.
 func (s *Statistics) GetFilesOrganized() int64 {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	return s.FilesOrganized
+	return atomic.LoadInt64(&s.FilesOrganized)
 }
 
-// GetFilesWithErrors returns the total number of files with errors.
+// GetFilesWithErrors returns the total number of files with errors, as in the
+// summary. Errors may hold more entries, such as failed cleanups, or fewer.
 func (s *Statistics) GetFilesWithErrors() int64 {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	return int64(len(s.Errors))
+	return atomic.LoadInt64(&s.FilesWithErrors)
 }
 
 // GetDuration returns the total duration of the operation.
@@ -467,3 +1152,122 @@ func (s *Statistics) GetFilesPerSecond() float64 {
 	defer s.mutex.RUnlock()
 	return s.FilesPerSecond
 }
+
+// IsDryRun reports whether the statistics are those of a simulated run.
+func (s *Statistics) IsDryRun() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.DryRun
+}
+
+// namedCounter is a counter of Statistics with its name in snapshots.
+type namedCounter struct {
+	name  string
+	value *int64
+}
+
+// counters returns the counters of s that add up over runs, in a fixed order.
+func (s *Statistics) counters() []namedCounter {
+	return []namedCounter{
+		{"total_files_found", &s.TotalFilesFound},
+		{"total_files_processed", &s.TotalFilesProcessed},
+		{"files_organized", &s.FilesOrganized},
+		{"files_moved", &s.FilesMoved},
+		{"files_copied", &s.FilesCopied},
+		{"files_linked", &s.FilesLinked},
+		{"files_skipped", &s.FilesSkipped},
+		{"files_with_errors", &s.FilesWithErrors},
+		{"files_without_dates", &s.FilesWithoutDates},
+		{"video_files_found", &s.VideoFilesFound},
+		{"video_files_processed", &s.VideoFilesProcessed},
+		{"thumbnails_found", &s.ThumbnailsFound},
+		{"video_pairs_found", &s.VideoPairsFound},
+		{"mpg_thm_merged", &s.MPGTHMMerged},
+		{"mpg_thm_errors", &s.MPGTHMErrors},
+		{"raw_jpeg_pairs_found", &s.RAWJPEGPairsFound},
+		{"raw_jpeg_pairs_split", &s.RAWJPEGPairsSplit},
+		{"live_photo_pairs_found", &s.LivePhotoPairsFound},
+		{"live_photo_pairs_split", &s.LivePhotoPairsSplit},
+		{"sidecars_found", &s.SidecarsFound},
+		{"orphaned_sidecars", &s.OrphanedSidecars},
+		{"duplicates_found", &s.DuplicatesFound},
+		{"duplicates_renamed", &s.DuplicatesRenamed},
+		{"duplicates_skipped", &s.DuplicatesSkipped},
+		{"duplicates_replaced", &s.DuplicatesReplaced},
+		{"duplicates_identical", &s.DuplicatesIdentical},
+		{"duplicates_name_collision", &s.DuplicatesNameCollision},
+		{"duplicates_renamed_image", &s.ImageDuplicates.Renamed},
+		{"duplicates_skipped_image", &s.ImageDuplicates.Skipped},
+		{"duplicates_replaced_image", &s.ImageDuplicates.Replaced},
+		{"duplicates_renamed_video", &s.VideoDuplicates.Renamed},
+		{"duplicates_skipped_video", &s.VideoDuplicates.Skipped},
+		{"duplicates_replaced_video", &s.VideoDuplicates.Replaced},
+		{"duplicates_renamed_raw", &s.RAWDuplicates.Renamed},
+		{"duplicates_skipped_raw", &s.RAWDuplicates.Skipped},
+		{"duplicates_replaced_raw", &s.RAWDuplicates.Replaced},
+		{"bytes_processed", &s.BytesProcessed},
+		{"bytes_moved", &s.BytesMoved},
+		{"bytes_copied", &s.BytesCopied},
+		{"bytes_linked", &s.BytesLinked},
+		{"bytes_skipped", &s.BytesSkipped},
+		{"bytes_would_process", &s.BytesWouldProcess},
+		{"throttle_wait_ns", &s.ThrottleWait},
+		{"cache_hits", &s.CacheHits},
+		{"cache_misses", &s.CacheMisses},
+		{"directories_created", &s.DirectoriesCreated},
+		{"directories_scanned", &s.DirectoriesScanned},
+		{"directories_removed", &s.DirectoriesRemoved},
+		{"directories_pruned", &s.DirectoriesPruned},
+		{"files_in_use", &s.FilesInUse},
+		{"hidden_files_skipped", &s.HiddenFilesSkipped},
+		{"symlinked_files", &s.SymlinkedFiles},
+		{"symlinked_dirs", &s.SymlinkedDirs},
+		{"mismatched_extensions", &s.MismatchedExtensions},
+		{"files_trashed", &s.FilesTrashed},
+		{"bytes_trashed", &s.BytesTrashed},
+		{"files_compressed", &s.FilesCompressed},
+		{"bytes_saved_by_compression", &s.BytesSavedByCompression},
+		{"compression_errors", &s.CompressionErrors},
+		{"filtered_by_size", &s.FilteredBySize},
+		{"filtered_by_min_age", &s.FilteredByMinAge},
+		{"filtered_by_max_age", &s.FilteredByMaxAge},
+		{"filtered_by_pattern", &s.FilteredByPattern},
+		{"plan_drift", &s.PlanDrift},
+		{"files_remaining", &s.FilesRemaining},
+		{"date_from_exif", &s.DateExtractionStats.FromEXIF},
+		{"date_from_video_meta", &s.DateExtractionStats.FromVideoMeta},
+		{"date_from_thumbnail", &s.DateExtractionStats.FromThumbnail},
+		{"date_from_file_name", &s.DateExtractionStats.FromFileName},
+		{"date_from_takeout_json", &s.DateExtractionStats.FromTakeoutJSON},
+		{"date_from_mod_time", &s.DateExtractionStats.FromModTime},
+		{"date_extraction_errors", &s.DateExtractionStats.ExtractionErrors},
+	}
+}
+
+// Add adds the counters of other to s, so that s accumulates the statistics
+// of several runs. Times, rates, space checks, errors and the per-directory
+// and per-date breakdowns are not added.
+func (s *Statistics) Add(other *Statistics) {
+	dst, src := s.counters(), other.counters()
+	for i := range dst {
+		atomic.AddInt64(dst[i].value, atomic.LoadInt64(src[i].value))
+	}
+
+	fileTypes := other.FileTypes()
+	largest := other.GetLargestFiles(LargestFilesKept)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, other := range fileTypes {
+		stat, ok := s.FileTypeStats[other.Type]
+		if !ok {
+			stat = &FileTypeStat{Type: other.Type}
+			s.FileTypeStats[other.Type] = stat
+		}
+		stat.Files += other.Files
+		stat.Bytes += other.Bytes
+	}
+	for _, file := range largest {
+		s.largest.add(file)
+	}
+}
@@ -0,0 +1,93 @@
+package statistics
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConcurrentUpdatesAndReads(t *testing.T) {
+	const writers, updates, reads = 8, 200, 50
+	s := NewStatistics()
+	s.SetMaxErrors(10)
+	var events atomic.Int64
+	unsubscribe := s.Subscribe(EventFunc(func(kind string, delta int64, labels map[string]string) {
+		if kind == "files_organized" {
+			events.Add(delta)
+		}
+	}))
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	read := []func(){
+		func() { _ = s.GetSummary() },
+		func() { _ = s.GetTotalFilesProcessed() + s.GetFilesOrganized() + s.GetFilesWithErrors() },
+		func() { _, _ = s.GetDuration(), s.GetFilesPerSecond() },
+		func() { _ = s.FileTypes() },
+		func() { _ = s.GetLargestFiles(LargestFilesKept) },
+		func() { _ = s.DirectoryBreakdown() },
+		func() { _ = s.GetDateHistogram() },
+		func() { _ = s.GetErrorReport() },
+		func() { _ = s.Snapshot("organize") },
+		func() { s.UpdateCacheHitRate() },
+		func() { NewStatistics().Add(s) },
+	}
+	for _, fn := range read {
+		wg.Add(1)
+		go func(fn func()) {
+			defer wg.Done()
+			for i := 0; i < reads; i++ {
+				fn()
+			}
+		}(fn)
+	}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				path := fmt.Sprintf("/photos/%d/%d.jpg", w, i)
+				s.IncrementFilesFound()
+				s.IncrementFilesProcessed()
+				s.IncrementFilesOrganized()
+				s.IncrementFilesWithErrors()
+				s.IncrementCacheHits()
+				s.IncrementCacheMisses()
+				s.IncrementDuplicatesRenamed("video")
+				s.AddBytesCopied(10)
+				s.RecordFileType("JPEG", path, int64(i))
+				s.RecordPlacement("2003/11", 10, false)
+				s.IncrementDateFolder("2003/11")
+				s.AddError(path, "copy", "failed")
+			}
+		}(w)
+	}
+	wg.Wait()
+	s.Finalize()
+
+	const want = writers * updates
+	for name, got := range map[string]int64{
+		"TotalFilesFound":         atomic.LoadInt64(&s.TotalFilesFound),
+		"GetTotalFilesProcessed":  s.GetTotalFilesProcessed(),
+		"GetFilesOrganized":       s.GetFilesOrganized(),
+		"GetFilesWithErrors":      s.GetFilesWithErrors(),
+		"VideoDuplicates.Renamed": atomic.LoadInt64(&s.VideoDuplicates.Renamed),
+		"files_organized events":  events.Load(),
+		"BytesProcessed":          atomic.LoadInt64(&s.BytesProcessed) / 10,
+		"JPEG files":              s.FileTypes()[0].Files,
+		"placed in 2003/11":       s.DirectoryBreakdown()[0].Files,
+		"dated 2003/11":           s.GetDateHistogram()[0].Files,
+		"copy errors":             s.GetErrorsByCategory()[0].Count,
+	} {
+		if got != want {
+			t.Errorf("%s = %d, want %d", name, got, want)
+		}
+	}
+	if got := len(s.GetErrors()); got != 10 {
+		t.Errorf("kept %d errors, want 10", got)
+	}
+	if s.CacheHitRate != 0.5 {
+		t.Errorf("CacheHitRate = %v, want 0.5", s.CacheHitRate)
+	}
+}
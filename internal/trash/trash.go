@@ -0,0 +1,144 @@
+package trash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DirName is the name of the trash directory created under the target root.
+const DirName = ".photo-sorter-trash"
+
+// timestampFormat names the per-run trash directories.
+const timestampFormat = "20060102-150405"
+
+// Trash moves files that would otherwise be destroyed into a timestamped
+// directory under a root, mirroring their path relative to that root.
+type Trash struct {
+	root    string
+	session string
+}
+
+// New returns a Trash for files under root. All files trashed through it share
+// one session directory named after startedAt.
+func New(root string, startedAt time.Time) *Trash {
+	return &Trash{
+		root:    root,
+		session: startedAt.Format(timestampFormat),
+	}
+}
+
+// Dir returns the trash directory for a root.
+func Dir(root string) string {
+	return filepath.Join(root, DirName)
+}
+
+// Move moves path into the trash and returns its new location.
+func (t *Trash) Move(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(t.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+
+	dest := filepath.Join(Dir(t.root), t.session, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("create trash directory: %w", err)
+	}
+	dest = uniquePath(dest)
+
+	if err := os.Rename(path, dest); err != nil {
+		if err := copyAndRemove(path, dest, info.Mode()); err != nil {
+			return "", fmt.Errorf("move to trash: %w", err)
+		}
+	}
+
+	return dest, nil
+}
+
+// Empty removes trash sessions under root that are older than olderThan and
+// returns the number of files and bytes removed. A zero olderThan empties the trash.
+func Empty(root string, olderThan time.Duration, now time.Time) (files, bytes int64, err error) {
+	dir := Dir(root)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		started, err := time.ParseInLocation(timestampFormat, entry.Name(), time.Local)
+		if err != nil || now.Sub(started) < olderThan {
+			continue
+		}
+
+		session := filepath.Join(dir, entry.Name())
+		_ = filepath.Walk(session, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files++
+				bytes += info.Size()
+			}
+			return nil
+		})
+		if err := os.RemoveAll(session); err != nil {
+			return files, bytes, fmt.Errorf("remove %s: %w", session, err)
+		}
+	}
+
+	if remaining, err := os.ReadDir(dir); err == nil && len(remaining) == 0 {
+		os.Remove(dir)
+	}
+
+	return files, bytes, nil
+}
+
+// uniquePath returns path, or path with a counter added if it already exists.
+func uniquePath(path string) string {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for counter := 1; ; counter++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, counter, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// copyAndRemove copies src to dst and removes src, for moves across filesystems.
+func copyAndRemove(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
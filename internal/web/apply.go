@@ -0,0 +1,56 @@
+package web
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// checkPlanPaths returns an error if req would touch files it may not: a
+// source outside the source directories and browse roots, a target directory
+// other than the configured one outside the browse roots, or a target
+// outside the target directory.
+func (s *Server) checkPlanPaths(req ApplyRequest) error {
+	cfg := s.currentConfig()
+	roots := s.browseRoots(cfg)
+	target := cfg.GetTargetDirectory()
+	if req.TargetDirectory != "" && filepath.Clean(req.TargetDirectory) != filepath.Clean(target) {
+		if !filepath.IsAbs(req.TargetDirectory) || !withinRoots(resolvedPath(req.TargetDirectory), roots) {
+			return fmt.Errorf("target directory %s is outside the allowed browse roots", req.TargetDirectory)
+		}
+		target = req.TargetDirectory
+	}
+	targets := []string{resolvedPath(target)}
+	sources := append(roots, targets...)
+	for _, source := range cfg.GetSourceDirectories() {
+		sources = append(sources, resolvedPath(source))
+	}
+
+	for _, entry := range req.Entries {
+		if !filepath.IsAbs(entry.Source) || !withinRoots(resolvedPath(entry.Source), sources) {
+			return fmt.Errorf("plan entry source %s is outside the source directories", entry.Source)
+		}
+		if entry.Target == "" {
+			continue
+		}
+		if !filepath.IsAbs(entry.Target) || !withinRoots(resolvedPath(entry.Target), targets) {
+			return fmt.Errorf("plan entry target %s is outside the target directory %s", entry.Target, target)
+		}
+	}
+	return nil
+}
+
+// resolvedPath returns the absolute path of path with the symlinks of its
+// longest existing ancestor resolved, as browse roots are.
+func resolvedPath(path string) string {
+	path, _ = filepath.Abs(path)
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...)
+		}
+		if filepath.Dir(dir) == dir {
+			return path
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
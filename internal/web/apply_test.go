@@ -0,0 +1,111 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"photo-sorter-go/internal/organizer"
+)
+
+func TestApplyRejectsPathsOutsideTheDirectories(t *testing.T) {
+	cfg, dirs := newTestConfig(t)
+	outside := filepath.Join(filepath.Dir(dirs.Home), "outside")
+	secret := writeTestFile(t, filepath.Join(outside, "secret.jpg"), []byte("secret"))
+	photo := writeTestFile(t, filepath.Join(dirs.Source, "IMG_0001.jpg"), []byte("photo"))
+	entry := func(source, target string) organizer.PlanEntry {
+		e := organizer.PlanEntry{
+			Source: source,
+			Target: target,
+			Action: "copy",
+			Date:   time.Date(2003, 11, 23, 0, 0, 0, 0, time.UTC),
+		}
+		if info, err := os.Stat(source); err == nil {
+			e.Size, e.ModTime = info.Size(), info.ModTime()
+		}
+		return e
+	}
+
+	tests := []struct {
+		name       string
+		req        ApplyRequest
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "source outside",
+			req:        ApplyRequest{Entries: []organizer.PlanEntry{entry(secret, filepath.Join(dirs.Target, "secret.jpg"))}},
+			wantStatus: http.StatusForbidden,
+			wantError:  secret,
+		},
+		{
+			name:       "relative source",
+			req:        ApplyRequest{Entries: []organizer.PlanEntry{entry("src/IMG_0001.jpg", filepath.Join(dirs.Target, "IMG_0001.jpg"))}},
+			wantStatus: http.StatusForbidden,
+			wantError:  "src/IMG_0001.jpg",
+		},
+		{
+			name:       "target outside",
+			req:        ApplyRequest{Entries: []organizer.PlanEntry{entry(photo, filepath.Join(outside, "IMG_0001.jpg"))}},
+			wantStatus: http.StatusForbidden,
+			wantError:  filepath.Join(outside, "IMG_0001.jpg"),
+		},
+		{
+			name:       "target escaping",
+			req:        ApplyRequest{Entries: []organizer.PlanEntry{entry(photo, dirs.Target+"/../outside/IMG_0001.jpg")}},
+			wantStatus: http.StatusForbidden,
+			wantError:  "outside the target directory",
+		},
+		{
+			name: "target directory outside",
+			req: ApplyRequest{
+				TargetDirectory: outside,
+				Entries:         []organizer.PlanEntry{entry(photo, filepath.Join(outside, "IMG_0001.jpg"))},
+			},
+			wantStatus: http.StatusForbidden,
+			wantError:  outside,
+		},
+		{
+			name:       "inside",
+			req:        ApplyRequest{Entries: []organizer.PlanEntry{entry(photo, filepath.Join(dirs.Target, "2003/11/23/IMG_0001.jpg"))}},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := newTestServer(t, cfg)
+			status, resp := doJSON(t, ts, "POST", "/api/apply", tt.req)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, tt.wantStatus, resp.Error)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(resp.Error, tt.wantError) {
+					t.Errorf("error %q does not mention %q", resp.Error, tt.wantError)
+				}
+				if jobs := s.jobs.list(); len(jobs) != 0 {
+					t.Errorf("a rejected plan started %d jobs", len(jobs))
+				}
+				return
+			}
+			id, _ := resp.Data.(map[string]any)["job_id"].(string)
+			if state := waitForJob(t, s, id); state != JobCompleted {
+				t.Errorf("job state = %s, want completed", state)
+			}
+		})
+	}
+
+	// Nothing outside the directories was touched.
+	data, err := os.ReadFile(secret)
+	if err != nil || string(data) != "secret" {
+		t.Errorf("%s changed: %q, %v", secret, data, err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "IMG_0001.jpg")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the target directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dirs.Target, "2003/11/23/IMG_0001.jpg")); err != nil {
+		t.Errorf("the plan inside the directories was not applied: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	assets "photo-sorter-go/web"
+
+	"github.com/gorilla/mux"
+)
+
+// SetWebRoot makes the server read the web interface assets from dir, which
+// holds templates/ and static/ like the web directory of the source tree, on
+// every request instead of using the ones built into the binary. Edited
+// assets then show up on reloading the page.
+func (s *Server) SetWebRoot(dir string) {
+	s.assets = os.DirFS(dir)
+	s.assetsFromDisk = true
+}
+
+// handleStatic serves the scripts and styles of the web interface.
+func (s *Server) handleStatic(w http.ResponseWriter, r *http.Request) {
+	s.serveAsset(w, r, "static/"+mux.Vars(r)["path"])
+}
+
+// serveAsset serves the asset name with the content type of its extension.
+// Built-in assets carry an ETag, so browsers revalidate them cheaply and get
+// new ones after an upgrade; assets read from disk are never cached.
+func (s *Server) serveAsset(w http.ResponseWriter, r *http.Request, name string) {
+	data, err := fs.ReadFile(s.assets, name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if s.assetsFromDisk {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		sum := sha256.Sum256(data)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
+
+// builtinAssets returns the assets built into the binary.
+func builtinAssets() fs.FS {
+	return assets.Assets
+}
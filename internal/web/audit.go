@@ -0,0 +1,185 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"photo-sorter-go/internal/config"
+)
+
+// Page sizes of /api/audit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// anonymousUser is the identity of requests when authentication is not configured.
+const anonymousUser = "anonymous"
+
+// identityKey is the request context key of the authenticated user.
+type identityKey struct{}
+
+// withIdentity returns r with user as its identity.
+func withIdentity(r *http.Request, user string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, user))
+}
+
+// identity returns the user that sent r: the basic auth or login username,
+// "token" for the configured token, or anonymousUser.
+func identity(r *http.Request) string {
+	if user, ok := r.Context().Value(identityKey{}).(string); ok && user != "" {
+		return user
+	}
+	return anonymousUser
+}
+
+// AuditEntry is one line of the audit log.
+type AuditEntry struct {
+	Time       time.Time               `json:"time"`
+	User       string                  `json:"user"`
+	RemoteAddr string                  `json:"remote_addr,omitempty"`
+	Action     string                  `json:"action"` // scan, organize, apply, compress, stop, config_update, ...
+	JobID      string                  `json:"job_id,omitempty"`
+	Params     any                     `json:"params,omitempty"`
+	Outcome    string                  `json:"outcome"` // started, rejected, completed, failed, stopped, applied, ...
+	Error      string                  `json:"error,omitempty"`
+	Changes    map[string]ConfigChange `json:"changes,omitempty"` // config updates only
+}
+
+// ConfigChange is the old and new value of a changed config field.
+type ConfigChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// auditLog appends entries to a JSONL file.
+type auditLog struct {
+	mu sync.Mutex
+}
+
+// record appends entry to the audit log at path.
+func (a *auditLog) record(path string, entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// last returns the last limit entries of the audit log at path, newest first.
+// Lines that cannot be parsed are skipped.
+func (a *auditLog) last(path string, limit int) ([]AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ring := make([]AuditEntry, 0, limit)
+	next := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if len(ring) < limit {
+			ring = append(ring, entry)
+		} else {
+			ring[next] = entry
+		}
+		next = (next + 1) % limit
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(ring))
+	for i := 1; i <= len(ring); i++ {
+		entries = append(entries, ring[(next-i+len(ring))%len(ring)])
+	}
+	return entries, nil
+}
+
+// audit records entry, made by the user of r unless r is nil, logging
+// failures instead of failing the request.
+func (s *Server) audit(r *http.Request, entry AuditEntry) {
+	if r != nil {
+		entry.User = identity(r)
+		entry.RemoteAddr = r.RemoteAddr
+	}
+	entry.Time = time.Now()
+	if err := s.auditLog.record(s.currentConfig().GetAuditLogPath(), entry); err != nil {
+		s.log.Warnf("Failed to write audit log: %v", err)
+	}
+}
+
+// configChanges returns the fields of the web-editable configuration that
+// differ between old and updated.
+func configChanges(old, updated *config.Config) map[string]ConfigChange {
+	fields := func(cfg *config.Config) map[string]any {
+		return map[string]any{
+			"date_format":        cfg.DateFormat,
+			"move_files":         cfg.Processing.MoveFiles,
+			"dry_run":            cfg.Security.DryRun,
+			"duplicate_handling": cfg.Processing.DuplicateHandling.String(),
+			"source_directory":   cfg.SourceDirectory,
+			"target_directory":   cfg.GetTargetDirectory(),
+		}
+	}
+	before, after := fields(old), fields(updated)
+	changes := make(map[string]ConfigChange)
+	for name, value := range after {
+		if before[name] != value {
+			changes[name] = ConfigChange{Old: before[name], New: value}
+		}
+	}
+	return changes
+}
+
+// handleAudit returns the last entries of the audit log, newest first, at most
+// the limit query parameter of them.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			s.writeError(w, "limit must be between 1 and "+strconv.Itoa(maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	entries, err := s.auditLog.last(s.currentConfig().GetAuditLogPath(), limit)
+	if err != nil {
+		s.writeError(w, "Failed to read audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, APIResponse{Success: true, Data: entries})
+}
@@ -0,0 +1,193 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"photo-sorter-go/internal/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sessionLifetime is how long a token issued by /api/login stays valid.
+const sessionLifetime = 30 * 24 * time.Hour
+
+// tokenUser is the identity of requests with the configured token.
+const tokenUser = "token"
+
+// session is a login through /api/login.
+type session struct {
+	user    string
+	expires time.Time
+}
+
+// LoginRequest represents a login request payload: either the configured
+// token, or the username and password.
+type LoginRequest struct {
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// requireAuth rejects requests without valid credentials when authentication
+// is configured: a bearer token (the configured one or one issued by
+// /api/login) in the Authorization header or the token query parameter, as
+// WebSockets cannot set headers, or basic auth with the username and password.
+// The user the credentials belong to becomes the identity of the request.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		web := s.currentConfig().Web
+		if !web.AuthEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user, ok := s.authorized(r, web); ok {
+			next.ServeHTTP(w, withIdentity(r, user))
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="photo-sorter"`)
+		s.writeError(w, "Authentication required", http.StatusUnauthorized)
+	})
+}
+
+// authorized returns the user of the credentials of r and whether they are
+// valid for web.
+func (s *Server) authorized(r *http.Request, web config.WebConfig) (string, bool) {
+	if token := requestToken(r); token != "" {
+		return s.validToken(token, web)
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		return username, s.validPassword(username, password, web)
+	}
+	return "", false
+}
+
+// requestToken returns the bearer token of r, from the Authorization header
+// or the token query parameter.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return r.URL.Query().Get("token")
+}
+
+// validToken returns the user of token and whether it is the configured
+// token or an unexpired one issued by /api/login.
+func (s *Server) validToken(token string, web config.WebConfig) (string, bool) {
+	if web.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(web.Token)) == 1 {
+		return tokenUser, true
+	}
+	s.authMutex.Lock()
+	defer s.authMutex.Unlock()
+	sess, ok := s.sessions[token]
+	if ok && time.Now().After(sess.expires) {
+		delete(s.sessions, token)
+		return "", false
+	}
+	return sess.user, ok
+}
+
+// validPassword reports whether username and password match the configured
+// credentials. Checked credentials are remembered, as bcrypt is deliberately
+// too slow to run on every request.
+func (s *Server) validPassword(username, password string, web config.WebConfig) bool {
+	if web.PasswordHash == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(username + "\x00" + password + "\x00" + web.PasswordHash))
+	key := hex.EncodeToString(sum[:])
+
+	s.authMutex.Lock()
+	checked := s.checkedPasswords[key]
+	s.authMutex.Unlock()
+	if checked {
+		return true
+	}
+
+	if subtle.ConstantTimeCompare([]byte(username), []byte(web.Username)) != 1 {
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(web.PasswordHash), []byte(password)) != nil {
+		return false
+	}
+	s.authMutex.Lock()
+	s.checkedPasswords[key] = true
+	s.authMutex.Unlock()
+	return true
+}
+
+// checkOrigin allows WebSocket connections from the server's own origin, from
+// web.allowed_origins, and from clients that send no Origin (not browsers).
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.currentConfig().Web.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// handleLogin exchanges the configured token, or the username and password,
+// for a token the web interface sends with its requests.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	web := s.currentConfig().Web
+	if !web.AuthEnabled() {
+		s.writeJSON(w, APIResponse{Success: true, Message: "Authentication is not configured"})
+		return
+	}
+
+	if req.Token != "" {
+		if _, ok := s.validToken(req.Token, web); !ok {
+			s.log.Warnf("Failed web login with a token from %s", r.RemoteAddr)
+			s.writeError(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		s.writeJSON(w, APIResponse{Success: true, Data: map[string]any{"token": req.Token}})
+		return
+	}
+	if !s.validPassword(req.Username, req.Password, web) {
+		s.log.Warnf("Failed web login for %q from %s", req.Username, r.RemoteAddr)
+		s.writeError(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		s.writeError(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(buf)
+	s.authMutex.Lock()
+	s.sessions[token] = session{user: req.Username, expires: time.Now().Add(sessionLifetime)}
+	s.authMutex.Unlock()
+	s.log.Infof("Web login for %q from %s", req.Username, r.RemoteAddr)
+
+	s.writeJSON(w, APIResponse{Success: true, Data: map[string]any{"token": token}})
+}
+
+// handleLogout ends the session of the request's token.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if token := requestToken(r); token != "" {
+		s.authMutex.Lock()
+		delete(s.sessions, token)
+		s.authMutex.Unlock()
+	}
+	s.writeJSON(w, APIResponse{Success: true, Message: "Logged out"})
+}
@@ -0,0 +1,287 @@
+package web
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"photo-sorter-go/internal/config"
+)
+
+// BrowseEntry is a file or directory listed by the directory browser.
+type BrowseEntry struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	IsDir      bool      `json:"is_dir"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	MediaCount int       `json:"media_count"` // media files directly inside a directory
+}
+
+// BrowseRoot is a starting point for the directory browser.
+type BrowseRoot struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Kind string `json:"kind"` // home, source, target, root or mount
+}
+
+// pseudoFilesystems are the /proc/mounts types that never hold photos.
+var pseudoFilesystems = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true,
+	"cgroup": true, "cgroup2": true, "securityfs": true, "pstore": true, "debugfs": true,
+	"tracefs": true, "mqueue": true, "hugetlbfs": true, "configfs": true, "fusectl": true,
+	"binfmt_misc": true, "autofs": true, "bpf": true, "nsfs": true, "rpc_pipefs": true,
+	"ramfs": true, "efivarfs": true, "selinuxfs": true, "overlay": true, "squashfs": true,
+}
+
+// handleBrowse lists the children of the directory given by the path query
+// parameter. Hidden entries are left out unless hidden=true.
+func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	cfg := s.currentConfig()
+	path := r.URL.Query().Get("path")
+	if path == "" || !filepath.IsAbs(path) {
+		s.writeError(w, "path must be an absolute directory path", http.StatusBadRequest)
+		return
+	}
+	hidden, _ := strconv.ParseBool(r.URL.Query().Get("hidden"))
+
+	// Checked before and after resolving symlinks, so that whether a path
+	// outside the roots exists is not revealed.
+	roots := s.browseRoots(cfg)
+	if !withinRoots(filepath.Clean(path), roots) {
+		s.writeError(w, "Path is outside the allowed browse roots", http.StatusForbidden)
+		return
+	}
+	dir, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		s.writeError(w, "Directory not found: "+path, http.StatusNotFound)
+		return
+	}
+	if !withinRoots(dir, roots) {
+		s.writeError(w, "Path is outside the allowed browse roots", http.StatusForbidden)
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fs.ErrPermission) {
+			status = http.StatusForbidden
+		}
+		s.writeError(w, "Failed to read directory: "+err.Error(), status)
+		return
+	}
+
+	media := mediaExtensions(cfg)
+	children := make([]BrowseEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !hidden && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		childPath := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(childPath) // follows symlinks
+		if err != nil {
+			continue
+		}
+		child := BrowseEntry{
+			Name:    entry.Name(),
+			Path:    childPath,
+			IsDir:   info.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if child.IsDir {
+			child.Size = 0
+			if resolved, err := filepath.EvalSymlinks(childPath); err == nil && withinRoots(resolved, roots) {
+				child.MediaCount = countMedia(resolved, media, hidden)
+			}
+		}
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].IsDir != children[j].IsDir {
+			return children[i].IsDir
+		}
+		return strings.ToLower(children[i].Name) < strings.ToLower(children[j].Name)
+	})
+
+	parent := filepath.Dir(dir)
+	if parent == dir || !withinRoots(parent, roots) {
+		parent = ""
+	}
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"path":    dir,
+			"parent":  parent,
+			"entries": children,
+		},
+	})
+}
+
+// handleBrowseRoots lists the starting points of the directory browser: the
+// home, source and target directories, the configured roots and, on Linux,
+// mounted volumes, as far as the browse roots allow them.
+func (s *Server) handleBrowseRoots(w http.ResponseWriter, r *http.Request) {
+	cfg := s.currentConfig()
+	candidates := []BrowseRoot{}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, BrowseRoot{Name: "Home", Path: home, Kind: "home"})
+	}
+	candidates = append(candidates, BrowseRoot{Name: "Source", Path: cfg.SourceDirectory, Kind: "source"})
+	if cfg.TargetArchiveFormat() == "" {
+		candidates = append(candidates, BrowseRoot{Name: "Target", Path: cfg.GetTargetDirectory(), Kind: "target"})
+	}
+	for _, root := range cfg.Web.BrowseRoots {
+		candidates = append(candidates, BrowseRoot{Name: root, Path: root, Kind: "root"})
+	}
+	for _, mount := range mountPoints() {
+		candidates = append(candidates, BrowseRoot{Name: mount, Path: mount, Kind: "mount"})
+	}
+
+	allowed := s.browseRoots(cfg)
+	seen := make(map[string]bool)
+	roots := []BrowseRoot{}
+	for _, c := range candidates {
+		path, err := filepath.Abs(c.Path)
+		if err != nil {
+			continue
+		}
+		if path, err = filepath.EvalSymlinks(path); err != nil || seen[path] {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || !info.IsDir() || !withinRoots(path, allowed) {
+			continue
+		}
+		seen[path] = true
+		c.Path = path
+		roots = append(roots, c)
+	}
+
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data:    roots,
+	})
+}
+
+// browseRoots returns the directories the browser may show, with symlinks
+// resolved: web.browse_roots of cfg or, if there are none, the default roots.
+func (s *Server) browseRoots(cfg *config.Config) []string {
+	configured := cfg.Web.BrowseRoots
+	if len(configured) == 0 {
+		s.cfgMutex.RLock()
+		configured = s.browseDefaults
+		s.cfgMutex.RUnlock()
+	}
+	var roots []string
+	for _, root := range configured {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			roots = append(roots, resolved)
+		}
+	}
+	return roots
+}
+
+// defaultBrowseRoots returns the browse roots used when web.browse_roots is
+// empty: the home directory and the source and target directories of cfg.
+// They are taken from the configuration the server starts with or reloads
+// from its file, never from one changed through POST /api/config, so that
+// changing the source or target directory there cannot widen what may be
+// browsed.
+func defaultBrowseRoots(cfg *config.Config) []string {
+	var roots []string
+	if home, err := os.UserHomeDir(); err == nil {
+		roots = append(roots, home)
+	}
+	roots = append(roots, cfg.GetSourceDirectories()...)
+	if cfg.TargetArchiveFormat() == "" {
+		roots = append(roots, cfg.GetTargetDirectory())
+	}
+	return roots
+}
+
+// withinRoots reports whether path is one of roots or below one of them.
+func withinRoots(path string, roots []string) bool {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaExtensions returns the configured image and video extensions as a set.
+func mediaExtensions(cfg *config.Config) map[string]bool {
+	extensions := make(map[string]bool)
+	for _, ext := range cfg.GetAllSupportedExtensions() {
+		extensions[strings.ToLower(ext)] = true
+	}
+	return extensions
+}
+
+// countMedia returns the number of media files directly inside dir.
+func countMedia(dir string, media map[string]bool, hidden bool) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() || (!hidden && strings.HasPrefix(entry.Name(), ".")) {
+			continue
+		}
+		if media[strings.ToLower(filepath.Ext(entry.Name()))] {
+			count++
+		}
+	}
+	return count
+}
+
+// mountPoints returns the mount points of real filesystems from /proc/mounts,
+// or none where it is not available.
+func mountPoints() []string {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var mounts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || pseudoFilesystems[fields[2]] {
+			continue
+		}
+		mounts = append(mounts, unescapeMount(fields[1]))
+	}
+	return mounts
+}
+
+// unescapeMount decodes the octal escapes (such as \040 for a space) of a
+// mount point in /proc/mounts.
+func unescapeMount(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBrowseRootsIgnoreConfigUpdates(t *testing.T) {
+	cfg, dirs := newTestConfig(t)
+	outside := filepath.Join(filepath.Dir(dirs.Home), "outside")
+	if err := os.MkdirAll(filepath.Join(outside, "private"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, ts := newTestServer(t, cfg)
+
+	browse := func(path string) int {
+		t.Helper()
+		status, _ := doJSON(t, ts, "GET", "/api/browse?path="+url.QueryEscape(path), nil)
+		return status
+	}
+	if status := browse(outside); status != http.StatusForbidden {
+		t.Fatalf("browsing %s before the update: status %d, want 403", outside, status)
+	}
+
+	status, resp := doJSON(t, ts, "POST", "/api/config", map[string]any{
+		"source_directory": outside,
+		"target_directory": filepath.Join(outside, "private"),
+	})
+	if status != http.StatusOK {
+		t.Fatalf("config update: status %d: %s", status, resp.Error)
+	}
+
+	for _, path := range []string{outside, filepath.Join(outside, "private")} {
+		if status := browse(path); status != http.StatusForbidden {
+			t.Errorf("browsing %s after the update: status %d, want 403", path, status)
+		}
+	}
+	for _, path := range []string{dirs.Home, dirs.Source, dirs.Target} {
+		if status := browse(path); status != http.StatusOK {
+			t.Errorf("browsing %s after the update: status %d, want 200", path, status)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package web
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"photo-sorter-go/internal/compressor"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Page sizes of /api/compression/{id}/results.
+	defaultCompressionLimit = 200
+	maxCompressionLimit     = 1000
+
+	// maxStatusResults is the most results /api/compression-status returns;
+	// larger runs are read page by page.
+	maxStatusResults = 1000
+)
+
+// errCompressionRunning is returned when starting a compression while another one runs.
+var errCompressionRunning = errors.New("compression already running")
+
+// CompressionTotals are the totals of a compression run, computed once when
+// it finishes.
+type CompressionTotals struct {
+	compressor.CompressionSummary
+	FilesProcessed int     `json:"files_processed"` // compressed, or the original kept
+	OriginalSize   int64   `json:"original_size"`
+	CompressedSize int64   `json:"compressed_size"`
+	PercentSaved   float64 `json:"percent_saved"`
+	DurationMS     int64   `json:"duration_ms"`
+	ProjectedSaved int64   `json:"projected_saved"` // dry runs only
+}
+
+// compressionRun is a compression started through the web API. Only the
+// latest run is kept.
+type compressionRun struct {
+	ID         string
+	User       string          // who started the run
+	Params     CompressRequest // as requested
+	DryRun     bool
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Error      string
+	Results    []compressor.CompressionResult // set when the run has finished
+	Totals     CompressionTotals
+}
+
+// summarizeCompression returns the totals of results.
+func summarizeCompression(results []compressor.CompressionResult) CompressionTotals {
+	totals := CompressionTotals{
+		CompressionSummary: compressor.Summarize(results),
+		ProjectedSaved:     compressor.ProjectedSavings(results),
+	}
+	var duration time.Duration
+	for _, r := range results {
+		switch r.Action {
+		case "compressed", "original", "would_compress", "would_skip", "estimated":
+			if r.CompressedSize > 0 { // dry runs do not measure videos and marked files
+				totals.OriginalSize += r.OriginalSize
+				totals.CompressedSize += r.CompressedSize
+			}
+			totals.FilesProcessed++
+		}
+		duration += r.Duration
+	}
+	if totals.OriginalSize > 0 {
+		totals.PercentSaved = float64(totals.OriginalSize-totals.CompressedSize) * 100 / float64(totals.OriginalSize)
+	}
+	totals.DurationMS = duration.Milliseconds()
+	return totals
+}
+
+// finishedCompression returns the finished run with the id of the request,
+// or writes an error response and returns nil.
+func (s *Server) finishedCompression(w http.ResponseWriter, r *http.Request) *compressionRun {
+	s.compressionMutex.RLock()
+	run := s.compression
+	finished := run != nil && run.FinishedAt != nil
+	s.compressionMutex.RUnlock()
+	if run == nil || run.ID != mux.Vars(r)["id"] {
+		s.writeError(w, "Compression not found; only the latest compression's results are kept", http.StatusNotFound)
+		return nil
+	}
+	if !finished {
+		s.writeError(w, "Compression results are available once the compression has finished", http.StatusConflict)
+		return nil
+	}
+	return run // a finished run is not changed any more
+}
+
+// compressionFilter returns the filter of the action and min_saved query
+// parameters, or writes an error response and returns false.
+func (s *Server) compressionFilter(w http.ResponseWriter, r *http.Request) (func(compressor.CompressionResult) bool, bool) {
+	action := r.URL.Query().Get("action")
+	minSaved := 0.0
+	if v := r.URL.Query().Get("min_saved"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			s.writeError(w, "min_saved must be a percentage", http.StatusBadRequest)
+			return nil, false
+		}
+		minSaved = n
+	}
+	return func(res compressor.CompressionResult) bool {
+		if action != "" && res.Action != action {
+			return false
+		}
+		return minSaved == 0 || res.PercentageSaved >= minSaved
+	}, true
+}
+
+// handleCompressionResults returns a page of the per-file results of a
+// finished compression with its totals. The action query parameter keeps only
+// one action (e.g. "compressed"), min_saved only files that shrank by at
+// least that percentage, and offset and limit choose the page.
+func (s *Server) handleCompressionResults(w http.ResponseWriter, r *http.Request) {
+	run := s.finishedCompression(w, r)
+	if run == nil {
+		return
+	}
+	keep, ok := s.compressionFilter(w, r)
+	if !ok {
+		return
+	}
+	offset, limit, err := pageParams(r, defaultCompressionLimit, maxCompressionLimit)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	counts := make(map[string]int)
+	total := 0
+	results := []compressor.CompressionResult{}
+	for _, res := range run.Results {
+		counts[res.Action]++
+		if !keep(res) {
+			continue
+		}
+		if total >= offset && len(results) < limit {
+			results = append(results, res)
+		}
+		total++
+	}
+
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"id":      run.ID,
+			"dry_run": run.DryRun,
+			"summary": run.Totals,
+			"total":   total,
+			"offset":  offset,
+			"limit":   limit,
+			"counts":  counts,
+			"results": results,
+		},
+	})
+}
+
+// handleCompressionCSV streams the per-file results of a finished compression
+// as CSV, with the filters of handleCompressionResults but without pages.
+func (s *Server) handleCompressionCSV(w http.ResponseWriter, r *http.Request) {
+	run := s.finishedCompression(w, r)
+	if run == nil {
+		return
+	}
+	keep, ok := s.compressionFilter(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="compression-`+run.ID+`.csv"`)
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"input_path", "output_path", "action", "original_size", "compressed_size",
+		"percentage_saved", "quality", "threshold", "duration_ms", "message", "error",
+	})
+	for i, res := range run.Results {
+		if !keep(res) {
+			continue
+		}
+		var errMsg string
+		if res.Error != nil {
+			errMsg = res.Error.Error()
+		}
+		out.Write([]string{
+			res.InputPath,
+			res.OutputPath,
+			res.Action,
+			strconv.FormatInt(res.OriginalSize, 10),
+			strconv.FormatInt(res.CompressedSize, 10),
+			strconv.FormatFloat(res.PercentageSaved, 'f', 2, 64),
+			strconv.Itoa(res.Quality),
+			strconv.FormatFloat(res.Threshold, 'f', -1, 64),
+			strconv.FormatInt(res.FinishedAt.Sub(res.StartedAt).Milliseconds(), 10),
+			res.Message,
+			errMsg,
+		})
+		if i%1000 == 999 {
+			out.Flush()
+			if out.Error() != nil {
+				return // the client went away
+			}
+		}
+	}
+	out.Flush()
+}
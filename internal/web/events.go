@@ -0,0 +1,278 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// subscriberQueue is how many events may wait for a WebSocket or event
+	// stream client; clients falling further behind are dropped rather than
+	// holding up the others.
+	subscriberQueue = 256
+
+	// eventReplay is how many recent events are kept for event stream
+	// clients reconnecting with Last-Event-ID.
+	eventReplay = 512
+
+	// sseHeartbeat is how often an idle event stream gets a comment, so
+	// that proxies and clients do not take it for a dead connection.
+	sseHeartbeat = 15 * time.Second
+)
+
+// event is a message for the clients, numbered in publishing order.
+type event struct {
+	id    uint64
+	data  []byte       // JSON-encoded WSMessage
+	level logrus.Level // of log messages; PanicLevel, which all clients get, for others
+}
+
+// subscriber receives the events published while it is subscribed.
+type subscriber struct {
+	events   chan event    // closed when the subscriber is removed
+	name     string        // describes the client in log messages
+	minLevel atomic.Uint32 // least severe logrus.Level of the log messages it gets
+	shutdown atomic.Bool   // removed because the server is stopping
+}
+
+// setLogLevel makes sub get the log messages at level and above. It reports
+// whether level names a level.
+func (sub *subscriber) setLogLevel(level string) bool {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return false
+	}
+	sub.minLevel.Store(uint32(parsed))
+	return true
+}
+
+// wants reports whether sub gets ev.
+func (sub *subscriber) wants(ev event) bool {
+	return ev.level <= logrus.Level(sub.minLevel.Load())
+}
+
+// publisher fans the server's messages out to the WebSocket and event stream
+// clients, keeping the last ones for clients that reconnect.
+type publisher struct {
+	mu          sync.Mutex
+	lastID      uint64
+	subscribers map[*subscriber]bool
+	recent      []event // the last eventReplay events, oldest first
+	closed      bool    // set by closeAll; later subscribers are removed at once
+	snapshot    *event  // the latest stats_update of the running job, for new subscribers
+}
+
+// newPublisher creates a publisher without subscribers.
+func newPublisher() *publisher {
+	return &publisher{subscribers: make(map[*subscriber]bool)}
+}
+
+// publish numbers message, setting its Seq, and queues it for every
+// subscriber. With snapshot, it is also queued for later subscribers until
+// clearSnapshot. A non-nil history, that of the job the message belongs to,
+// also keeps it; final marks messages it must not drop. publish returns the
+// subscribers dropped because their queue was full.
+func (p *publisher) publish(message WSMessage, level logrus.Level, snapshot bool, history *jobEvents, final bool) ([]*subscriber, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	message.Seq = p.lastID + 1
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	p.lastID++
+	ev := event{id: p.lastID, data: data, level: level}
+	if snapshot {
+		p.snapshot = &ev
+	}
+	if history != nil {
+		history.add(ev, snapshot, final)
+	}
+	p.recent = append(p.recent, ev)
+	if len(p.recent) > eventReplay {
+		p.recent = append([]event(nil), p.recent[len(p.recent)-eventReplay:]...)
+	}
+
+	var dropped []*subscriber
+	for sub := range p.subscribers {
+		select {
+		case sub.events <- ev:
+		default:
+			delete(p.subscribers, sub)
+			close(sub.events)
+			dropped = append(dropped, sub)
+		}
+	}
+	return dropped, nil
+}
+
+// latest returns the number of the last event published.
+func (p *publisher) latest() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastID
+}
+
+// subscribe adds a subscriber. With replay, it also returns the kept events
+// published after lastID, which the subscriber then does not get again.
+func (p *publisher) subscribe(name string, replay bool, lastID uint64) (*subscriber, []event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sub := &subscriber{events: make(chan event, subscriberQueue), name: name}
+	sub.minLevel.Store(uint32(logrus.InfoLevel))
+	if p.closed {
+		sub.shutdown.Store(true)
+		close(sub.events)
+		return sub, nil
+	}
+	p.subscribers[sub] = true
+
+	var missed []event
+	if replay && lastID < p.lastID {
+		for _, ev := range p.recent {
+			if ev.id > lastID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	if p.snapshot != nil && !(replay && p.snapshot.id > lastID) {
+		sub.events <- *p.snapshot // the queue is empty
+	}
+	return sub, missed
+}
+
+// clearSnapshot stops queueing the last snapshot for new subscribers.
+func (p *publisher) clearSnapshot() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.snapshot = nil
+}
+
+// unsubscribe removes sub, closing its queue. Removing it twice is harmless.
+func (p *publisher) unsubscribe(sub *subscriber) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.subscribers[sub] {
+		delete(p.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// closeAll removes all subscribers, ending their connections, and turns
+// away new ones.
+func (p *publisher) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for sub := range p.subscribers {
+		sub.shutdown.Store(true)
+		delete(p.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// broadcastWSMessage sends a message to all connected WebSocket and event
+// stream clients. Clients too far behind are dropped.
+func (s *Server) broadcastWSMessage(messageType string, data any) {
+	s.publish(messageType, data, logrus.PanicLevel, false)
+}
+
+// publish sends a message to the clients, log messages of level only to those
+// that want them. A snapshot message is also sent to clients connecting later,
+// until it is replaced or cleared. Messages of a job, those with its job_id,
+// are kept in its event history unless they are debug logs.
+func (s *Server) publish(messageType string, data any, level logrus.Level, snapshot bool) {
+	message := WSMessage{
+		Type: messageType,
+		Data: data,
+	}
+
+	var history *jobEvents
+	if fields, ok := data.(map[string]any); ok && level <= logrus.InfoLevel {
+		if id, ok := fields["job_id"].(string); ok {
+			if job := s.jobs.find(id); job != nil {
+				history = job.events
+			}
+		}
+	}
+
+	dropped, err := s.events.publish(message, level, snapshot, history, finalEvents[messageType])
+	if err != nil {
+		s.log.Errorf("Failed to marshal WebSocket message: %v", err)
+		return
+	}
+	for _, sub := range dropped {
+		s.log.Warnf("Dropping %s: too many unsent messages", sub.name)
+	}
+}
+
+// handleEvents streams the messages sent to WebSocket clients as server-sent
+// events, for networks and proxies that break WebSockets. Each event carries
+// an ID; a client reconnecting with Last-Event-ID first gets the events it
+// missed, as far as they are still kept. The log_level query parameter
+// chooses the least severe log messages sent (default info).
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	logLevel := r.URL.Query().Get("log_level")
+	if _, err := logrus.ParseLevel(logLevel); logLevel != "" && err != nil {
+		s.writeError(w, "Invalid log_level: "+logLevel, http.StatusBadRequest)
+		return
+	}
+	s.streamClients.Add(1)
+	defer s.streamClients.Add(-1)
+	rc := http.NewResponseController(w)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	lastID, err := strconv.ParseUint(lastEventID, 10, 64)
+	sub, missed := s.events.subscribe("event stream client "+r.RemoteAddr, lastEventID != "" && err == nil, lastID)
+	defer s.events.unsubscribe(sub)
+	if logLevel != "" {
+		sub.setLogLevel(logLevel)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise hold the events back
+	w.WriteHeader(http.StatusOK)
+
+	write := func(format string, args ...any) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if !write("retry: 3000\n\n") {
+		return
+	}
+	for _, ev := range missed {
+		if sub.wants(ev) && !write("id: %d\ndata: %s\n\n", ev.id, ev.data) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ev, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if sub.wants(ev) && !write("id: %d\ndata: %s\n\n", ev.id, ev.data) {
+				return
+			}
+		case <-heartbeat.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
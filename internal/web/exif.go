@@ -0,0 +1,112 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExifInspection is the metadata breakdown of a file returned by /api/exif.
+// Every field is always present, so that the web interface can rely on it.
+type ExifInspection struct {
+	Path        string          `json:"path"`
+	Date        *time.Time      `json:"date"`        // the date the file would be organized by
+	DateSource  string          `json:"date_source"` // "" if no date was found
+	Candidates  []DateCandidate `json:"candidates"`
+	TakeoutJSON string          `json:"takeout_json"`
+	Tags        ExifTags        `json:"tags"`
+}
+
+// DateCandidate is a date one source offers for the inspected file.
+type DateCandidate struct {
+	Source   string     `json:"source"`
+	Date     *time.Time `json:"date"`
+	Raw      string     `json:"raw"`
+	Error    string     `json:"error"`
+	Selected bool       `json:"selected"` // the date the file would be organized by
+}
+
+// ExifTags are the main metadata tags of the inspected file.
+type ExifTags struct {
+	HasEXIF     bool   `json:"has_exif"`
+	CameraMake  string `json:"camera_make"`
+	CameraModel string `json:"camera_model"`
+	Orientation int    `json:"orientation"`
+	HasGPS      bool   `json:"has_gps"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// handleExif returns the date candidates and main tags of the media file given
+// by the path query parameter, like the test-exif command. Paths are limited
+// to the browse roots.
+func (s *Server) handleExif(w http.ResponseWriter, r *http.Request) {
+	cfg := s.currentConfig()
+	path := r.URL.Query().Get("path")
+	if path == "" || !filepath.IsAbs(path) {
+		s.writeError(w, "path must be an absolute file path", http.StatusBadRequest)
+		return
+	}
+
+	// Checked before and after resolving symlinks, as in handleBrowse.
+	roots := s.browseRoots(cfg)
+	if !withinRoots(filepath.Clean(path), roots) {
+		s.writeError(w, "Path is outside the allowed browse roots", http.StatusForbidden)
+		return
+	}
+	file, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		s.writeError(w, "File not found: "+path, http.StatusNotFound)
+		return
+	}
+	if !withinRoots(file, roots) {
+		s.writeError(w, "Path is outside the allowed browse roots", http.StatusForbidden)
+		return
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		s.writeError(w, "File not found: "+path, http.StatusNotFound)
+		return
+	}
+	if !info.Mode().IsRegular() || !mediaExtensions(cfg)[strings.ToLower(filepath.Ext(file))] {
+		s.writeError(w, "Not a supported media file: "+path, http.StatusUnprocessableEntity)
+		return
+	}
+
+	ins, err := s.dateExtractor.Inspect(file)
+	if err != nil {
+		s.writeError(w, "Failed to inspect file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := ExifInspection{
+		Path:        file,
+		Candidates:  make([]DateCandidate, 0, len(ins.Candidates)),
+		TakeoutJSON: ins.TakeoutJSON,
+		Tags: ExifTags{
+			HasEXIF:     ins.HasEXIF,
+			CameraMake:  ins.CameraMake,
+			CameraModel: ins.CameraModel,
+			Orientation: ins.Orientation,
+			HasGPS:      ins.HasGPS,
+			Width:       ins.Width,
+			Height:      ins.Height,
+		},
+	}
+	if ins.Selected != nil {
+		result.Date = &ins.Selected.Date
+		result.DateSource = ins.Selected.Source.String()
+	}
+	for _, c := range ins.Candidates {
+		result.Candidates = append(result.Candidates, DateCandidate{
+			Source:   c.Source.String(),
+			Date:     c.Date,
+			Raw:      c.Raw,
+			Error:    c.Error,
+			Selected: ins.Selected != nil && c.Source == ins.Selected.Source,
+		})
+	}
+	s.writeJSON(w, APIResponse{Success: true, Data: result})
+}
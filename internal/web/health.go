@@ -0,0 +1,46 @@
+package web
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// SetVersion sets the version and build time reported by /api/version.
+func (s *Server) SetVersion(version, buildTime string) {
+	s.version = version
+	s.buildTime = buildTime
+}
+
+// handleHealth reports that the server is up, for health checks of service
+// managers and container orchestrators. It needs no authentication and
+// always answers 200.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.latest()
+	s.compressionMutex.RLock()
+	compressing := s.compressionRunning
+	s.compressionMutex.RUnlock()
+
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"status":              "ok",
+			"uptime_seconds":      time.Since(s.started).Seconds(),
+			"goroutines":          runtime.NumGoroutine(),
+			"job_running":         ok && job.State == JobRunning,
+			"compression_running": compressing,
+		},
+	})
+}
+
+// handleVersion returns the version and build time of the binary.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"version":    s.version,
+			"build_time": s.buildTime,
+			"go_version": runtime.Version(),
+		},
+	})
+}
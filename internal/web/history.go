@@ -0,0 +1,124 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"photo-sorter-go/internal/compressor"
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/history"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultHistoryLimit is how many runs /api/history returns without a limit.
+const defaultHistoryLimit = 50
+
+// recordJob adds the finished job, run with cfg, to the run history, so that
+// it is listed after the server restarts.
+func (s *Server) recordJob(job Job, cfg *config.Config) {
+	rec := &history.Record{
+		Kind:      job.Type,
+		StartedAt: job.StartedAt,
+		Sources:   cfg.GetSourceDirectories(),
+		Target:    cfg.GetTargetDirectory(),
+		User:      job.User,
+		Params:    job.Params,
+		Error:     job.Error,
+		Stats:     job.stats.Snapshot(job.Type),
+	}
+	rec.DryRun = rec.Stats.DryRun
+	if job.FinishedAt != nil {
+		rec.FinishedAt = *job.FinishedAt
+	}
+	if job.State == JobStopped {
+		rec.Error = "stopped"
+	}
+	s.saveHistory(rec)
+}
+
+// recordCompression adds the compression run with params, finished at
+// finished, to the run history.
+func (s *Server) recordCompression(run *compressionRun, params compressor.CompressionParams, finished time.Time) {
+	rec := &history.Record{
+		Kind:       "compress",
+		DryRun:     run.DryRun,
+		StartedAt:  run.StartedAt,
+		FinishedAt: finished,
+		Sources:    params.InputPaths,
+		Target:     params.TargetDir,
+		User:       run.User,
+		Params:     run.Params,
+		Error:      run.Error,
+		Stats:      history.CompressionStats(compressor.Summarize(run.Results), run.DryRun, run.StartedAt, finished),
+	}
+	s.saveHistory(rec)
+}
+
+// saveHistory writes rec to the run history, logging failures.
+func (s *Server) saveHistory(rec *history.Record) {
+	if err := history.Save(s.currentConfig(), rec); err != nil {
+		s.log.Warnf("Failed to record the run in the history: %v", err)
+	}
+}
+
+// handleListHistory returns the runs of the run history, newest first, also
+// those of earlier server runs and of the command line. limit is the number
+// of runs (default 50, 0 for all); records that cannot be read are left out
+// and listed as warnings.
+func (s *Server) handleListHistory(w http.ResponseWriter, r *http.Request) {
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			s.writeError(w, "limit must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	store, err := history.OpenConfigured(s.currentConfig())
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	records, problems := store.List()
+	total := len(records)
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	warnings := make([]string, len(problems))
+	for i, problem := range problems {
+		warnings[i] = problem.Error()
+		s.log.Warnf("Run history: %v", problem)
+	}
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"total":    total,
+			"runs":     records,
+			"warnings": warnings,
+		},
+	})
+}
+
+// handleGetHistory returns one run of the run history.
+func (s *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	store, err := history.OpenConfigured(s.currentConfig())
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rec, err := store.Get(mux.Vars(r)["id"])
+	if errors.Is(err, history.ErrNotFound) {
+		s.writeError(w, "Run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, APIResponse{Success: true, Data: rec})
+}
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// jobEventLimit is how many messages of a job are kept for clients catching
+// up after a reconnect; older ones are dropped, except final ones.
+const jobEventLimit = 1000
+
+// finalEvents are the message types ending a job, which its event history
+// keeps for as long as the job itself is kept.
+var finalEvents = map[string]bool{
+	"scan_completed":     true,
+	"scan_error":         true,
+	"organize_completed": true,
+	"organize_error":     true,
+	"apply_completed":    true,
+	"apply_error":        true,
+	"operation_stopped":  true,
+}
+
+// jobEvents is the event history of a job.
+type jobEvents struct {
+	mu       sync.Mutex
+	events   []event // the last jobEventLimit messages, oldest first
+	final    []event // final messages, also once dropped from events
+	dropped  uint64  // number of the newest message dropped, 0 if none
+	snapshot uint64  // number of the kept snapshot message, 0 if none
+}
+
+// add appends ev to the history, dropping the oldest message beyond
+// jobEventLimit. A snapshot message, such as stats_update, replaces the
+// previous one, so that frequent snapshots do not push out other messages.
+func (h *jobEvents) add(ev event, snapshot, final bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if snapshot {
+		if i := slices.IndexFunc(h.events, func(kept event) bool { return kept.id == h.snapshot }); i >= 0 {
+			h.events = slices.Delete(h.events, i, i+1)
+		}
+		h.snapshot = ev.id
+	}
+	h.events = append(h.events, ev)
+	if final {
+		h.final = append(h.final, ev)
+	}
+	if len(h.events) > jobEventLimit {
+		h.dropped = h.events[0].id
+		h.events = append([]event(nil), h.events[1:]...)
+	}
+}
+
+// since returns the kept messages numbered after seq that a client with
+// minLevel gets, oldest first, and whether some of them have been dropped.
+func (h *jobEvents) since(seq uint64, minLevel logrus.Level) ([]event, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var events []event
+	for _, ev := range h.final {
+		if ev.id > seq && ev.id <= h.dropped {
+			events = append(events, ev)
+		}
+	}
+	for _, ev := range h.events {
+		if ev.id > seq && ev.level <= minLevel {
+			events = append(events, ev)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].id < events[j].id })
+	return events, seq < h.dropped
+}
+
+// handleJobEvents returns the messages sent about a job after the since query
+// parameter, a message's seq, for clients that were disconnected. The
+// log_level query parameter chooses the least severe log messages returned
+// (default info). truncated tells that older messages have been dropped;
+// the messages ending a job are always kept.
+func (s *Server) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	job := s.jobs.find(mux.Vars(r)["id"])
+	if job == nil {
+		s.writeError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			s.writeError(w, "since must be a message seq", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+	minLevel := logrus.InfoLevel
+	if v := r.URL.Query().Get("log_level"); v != "" {
+		level, err := logrus.ParseLevel(v)
+		if err != nil {
+			s.writeError(w, "Invalid log_level: "+v, http.StatusBadRequest)
+			return
+		}
+		minLevel = level
+	}
+
+	events, truncated := job.events.since(since, minLevel)
+	messages := make([]json.RawMessage, len(events))
+	for i, ev := range events {
+		messages[i] = ev.data
+	}
+	snapshot, _ := s.jobs.get(job.ID)
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"job_id":    job.ID,
+			"state":     snapshot.State,
+			"last_seq":  s.events.latest(),
+			"truncated": truncated,
+			"events":    messages,
+		},
+	})
+}
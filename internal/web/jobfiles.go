@@ -0,0 +1,221 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"photo-sorter-go/internal/organizer"
+	"photo-sorter-go/internal/statistics"
+
+	"github.com/gorilla/mux"
+)
+
+// Page sizes of /api/jobs/{id}/files.
+const (
+	defaultFilesLimit = 100
+	maxFilesLimit     = 1000
+)
+
+// FileResult is what a job did, or would do, with one file.
+type FileResult struct {
+	Path       string     `json:"path"`
+	Target     string     `json:"target,omitempty"`
+	Action     string     `json:"action"` // move, copy, skip, duplicate, no-date, error, ...
+	Date       *time.Time `json:"date,omitempty"`
+	DateSource string     `json:"date_source,omitempty"`
+	Size       int64      `json:"size"`
+	Reason     string     `json:"reason,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// handleJobFiles returns a page of the per-file results of a finished scan or
+// organize job, read from its report so that large runs need no memory. The
+// status query parameter keeps only one action (e.g. "error"), q only files
+// whose source or target path contains it, and offset and limit choose the
+// page. Errors not tied to a report record, such as a failed thumbnail merge,
+// are listed after the records. Only the latest job's results are kept.
+func (s *Server) handleJobFiles(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(mux.Vars(r)["id"])
+	if !ok {
+		s.writeError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if job.State == JobRunning {
+		s.writeError(w, "File results are available once the job has finished", http.StatusConflict)
+		return
+	}
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	q := strings.ToLower(query.Get("q"))
+	offset, limit, err := pageParams(r, defaultFilesLimit, maxFilesLimit)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.reportMutex.RLock()
+	defer s.reportMutex.RUnlock()
+	if s.reportPath == "" || s.reportJob != job.ID {
+		s.writeError(w, "File results are only kept for the latest scan or organize job", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(s.reportPath)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	counts := make(map[string]int)
+	total := 0
+	files := []FileResult{}
+	add := func(res FileResult) {
+		counts[res.Action]++
+		if status != "" && res.Action != status {
+			return
+		}
+		if q != "" && !strings.Contains(strings.ToLower(res.Path), q) && !strings.Contains(strings.ToLower(res.Target), q) {
+			return
+		}
+		if total >= offset && len(files) < limit {
+			files = append(files, res)
+		}
+		total++
+	}
+
+	reported := make(map[string]bool) // sources with an error record
+	err = organizer.EachReportRecord(f, func(rec organizer.ReportRecord) bool {
+		res := FileResult{
+			Path:       rec.Source,
+			Target:     rec.Target,
+			Action:     rec.Action,
+			Date:       rec.Date,
+			DateSource: rec.DateSource,
+			Size:       rec.Size,
+			Reason:     rec.Reason,
+		}
+		if rec.Action == organizer.ReportActionError {
+			res.Reason, res.Error = "", rec.Reason
+			reported[rec.Source] = true
+		}
+		add(res)
+		return true
+	})
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, e := range job.stats.GetErrors() {
+		if reported[e.FilePath] {
+			continue
+		}
+		add(FileResult{
+			Path:   e.FilePath,
+			Action: organizer.ReportActionError,
+			Error:  e.Operation + ": " + e.Error,
+		})
+	}
+
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"total":  total,
+			"offset": offset,
+			"limit":  limit,
+			"counts": counts,
+			"files":  files,
+		},
+	})
+}
+
+// handleJobErrors returns every error recorded by a job, up to
+// logging.max_recorded_errors, with the number of errors of each operation
+// and a few paths that failed. Running jobs return the errors so far.
+func (s *Server) handleJobErrors(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(mux.Vars(r)["id"])
+	if !ok {
+		s.writeError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: struct {
+			JobID string `json:"job_id"`
+			statistics.ErrorReport
+		}{job.ID, job.stats.GetErrorReport()},
+	})
+}
+
+// handleJobHistogram returns the number of files a scan or organize job dated
+// into each date folder, sorted by folder; dry runs count the files that would
+// be placed there.
+func (s *Server) handleJobHistogram(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(mux.Vars(r)["id"])
+	if !ok {
+		s.writeError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"job_id":  job.ID,
+			"folders": job.stats.GetDateHistogram(),
+		},
+	})
+}
+
+// handleCompareJobs compares the statistics of the jobs given by the from and
+// to query parameters, as "photo-sorter stats diff" compares two runs. A job
+// still running is compared with its counters so far.
+func (s *Server) handleCompareJobs(w http.ResponseWriter, r *http.Request) {
+	var snaps [2]statistics.Snapshot
+	for i, param := range []string{"from", "to"} {
+		id := r.URL.Query().Get(param)
+		if id == "" {
+			s.writeError(w, "from and to must be job IDs", http.StatusBadRequest)
+			return
+		}
+		job, ok := s.jobs.get(id)
+		if !ok {
+			s.writeError(w, fmt.Sprintf("Job %s not found", id), http.StatusNotFound)
+			return
+		}
+		snaps[i] = job.stats.Snapshot(job.Type)
+	}
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"from": snaps[0],
+			"to":   snaps[1],
+			"diff": statistics.Compare(snaps[0], snaps[1]),
+		},
+	})
+}
+
+// pageParams returns the offset and limit query parameters of r, with
+// defaultLimit if there is no limit.
+func pageParams(r *http.Request, defaultLimit, maxLimit int) (offset, limit int, err error) {
+	query := r.URL.Query()
+	limit = defaultLimit
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("offset must be a non-negative number")
+		}
+		offset = n
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			return 0, 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxLimit))
+		}
+		limit = n
+	}
+	return offset, limit, nil
+}
@@ -0,0 +1,282 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/statistics"
+
+	"github.com/gorilla/mux"
+)
+
+// Job states.
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobStopped   = "stopped"
+)
+
+// Errors of starting and stopping jobs.
+var (
+	errJobRunning    = errors.New("operation already in progress")
+	errJobNotRunning = errors.New("job is not running")
+)
+
+// Job is a scan, organize or apply operation started through the web API.
+type Job struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"` // scan, organize or apply
+	Params     any        `json:"params"`
+	User       string     `json:"user"` // who started the job
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	stats  *statistics.Statistics
+	events *jobEvents         // the messages sent about the job
+	cancel context.CancelFunc // stops the job
+	done   chan struct{}      // closed when the job has finished
+}
+
+// jobDetail is a job with a snapshot of its statistics.
+type jobDetail struct {
+	Job
+	Statistics any `json:"statistics"`
+}
+
+// jobStore keeps the last jobs, oldest first. At most one job runs at a time,
+// so the running job is always the newest.
+type jobStore struct {
+	mu     sync.Mutex
+	jobs   []*Job
+	nextID int
+}
+
+// start adds a running job, dropping the oldest ones beyond limit, and
+// returns it with the context that stopping it, or cancelling parent,
+// cancels.
+func (st *jobStore) start(parent context.Context, jobType string, params any, user string, limit int) (*Job, context.Context, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if n := len(st.jobs); n > 0 && st.jobs[n-1].State == JobRunning {
+		return nil, nil, errJobRunning
+	}
+	st.nextID++
+	job := &Job{
+		ID:        strconv.Itoa(st.nextID),
+		Type:      jobType,
+		Params:    params,
+		User:      user,
+		State:     JobRunning,
+		StartedAt: time.Now(),
+		stats:     statistics.NewStatistics(),
+		events:    &jobEvents{},
+		done:      make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(parent)
+	job.cancel = cancel
+
+	if limit < 1 {
+		limit = 1
+	}
+	st.jobs = append(st.jobs, job)
+	if len(st.jobs) > limit {
+		st.jobs = append([]*Job(nil), st.jobs[len(st.jobs)-limit:]...)
+	}
+	return job, ctx, nil
+}
+
+// finish records the outcome of job: stopped if err is a cancellation,
+// failed for other errors.
+func (st *jobStore) finish(job *Job, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.State = JobStopped
+	case err != nil:
+		job.State = JobFailed
+		job.Error = err.Error()
+	default:
+		job.State = JobCompleted
+	}
+	job.cancel() // releases the context
+	close(job.done)
+}
+
+// stop cancels job if it is running.
+func (st *jobStore) stop(job *Job) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if job.State != JobRunning {
+		return errJobNotRunning
+	}
+	job.cancel()
+	return nil
+}
+
+// find returns the job with id, or nil.
+func (st *jobStore) find(id string) *Job {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, job := range st.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// get returns a copy of the job with id.
+func (st *jobStore) get(id string) (Job, bool) {
+	job := st.find(id)
+	if job == nil {
+		return Job{}, false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return *job, true
+}
+
+// running returns the running job, or nil.
+func (st *jobStore) running() *Job {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if n := len(st.jobs); n > 0 && st.jobs[n-1].State == JobRunning {
+		return st.jobs[n-1]
+	}
+	return nil
+}
+
+// latest returns a copy of the running or last finished job.
+func (st *jobStore) latest() (Job, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.jobs) == 0 {
+		return Job{}, false
+	}
+	return *st.jobs[len(st.jobs)-1], true
+}
+
+// list returns copies of the kept jobs, newest first.
+func (st *jobStore) list() []Job {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	jobs := make([]Job, 0, len(st.jobs))
+	for i := len(st.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, *st.jobs[i])
+	}
+	return jobs
+}
+
+// stopJobs cancels the running job and compression, and refuses new jobs.
+// It waits until the job has finished its current files, or ctx is done, and
+// returns the job if it was cut off: stopped, or still running.
+func (s *Server) stopJobs(ctx context.Context) *Job {
+	job := s.jobs.running()
+	s.cancelJobs()
+	if job == nil {
+		return nil
+	}
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+	}
+	if latest, ok := s.jobs.get(job.ID); ok && (latest.State == JobCompleted || latest.State == JobFailed) {
+		return nil
+	}
+	return job
+}
+
+// startJob starts a job of jobType for the user of r, or writes an error
+// response and returns false if another one is running or the server is
+// shutting down. Both are recorded in the audit log.
+func (s *Server) startJob(w http.ResponseWriter, r *http.Request, jobType string, params any) (*Job, context.Context, bool) {
+	if s.jobsCtx.Err() != nil {
+		s.writeError(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+	job, ctx, err := s.jobs.start(s.jobsCtx, jobType, params, identity(r), s.currentConfig().Web.JobHistory)
+	if err != nil {
+		s.audit(r, AuditEntry{Action: jobType, Params: params, Outcome: "rejected", Error: err.Error()})
+		s.writeError(w, "Operation already in progress", http.StatusConflict)
+		return nil, nil, false
+	}
+	s.audit(r, AuditEntry{Action: jobType, JobID: job.ID, Params: params, Outcome: "started"})
+	return job, ctx, true
+}
+
+// finishJob records the outcome of job, run with cfg, also in the audit log
+// and the run history.
+func (s *Server) finishJob(job *Job, cfg *config.Config, err error) {
+	s.jobs.finish(job, err)
+	finished, _ := s.jobs.get(job.ID)
+	s.recordJob(finished, cfg)
+	s.audit(nil, AuditEntry{
+		User:    finished.User,
+		Action:  finished.Type,
+		JobID:   finished.ID,
+		Params:  finished.Params,
+		Outcome: finished.State,
+		Error:   finished.Error,
+	})
+}
+
+// stopJob stops job for the user of r and tells the WebSocket clients, or
+// writes a conflict response if job is not running.
+func (s *Server) stopJob(w http.ResponseWriter, r *http.Request, job *Job) {
+	if err := s.jobs.stop(job); err != nil {
+		s.audit(r, AuditEntry{Action: "stop", JobID: job.ID, Outcome: "rejected", Error: err.Error()})
+		s.writeError(w, "Cannot stop job "+job.ID+": "+err.Error(), http.StatusConflict)
+		return
+	}
+	s.audit(r, AuditEntry{Action: "stop", JobID: job.ID, Outcome: "stopped"})
+	s.broadcastWSMessage("operation_stopped", map[string]any{
+		"job_id":  job.ID,
+		"message": "Operation stopped by user",
+	})
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Message: "Operation stopped",
+	})
+}
+
+// handleListJobs returns the kept jobs, newest first.
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data:    s.jobs.list(),
+	})
+}
+
+// handleGetJob returns a job with its statistics.
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(mux.Vars(r)["id"])
+	if !ok {
+		s.writeError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data:    jobDetail{Job: job, Statistics: statisticsData(job.stats)},
+	})
+}
+
+// handleStopJob stops a running job.
+func (s *Server) handleStopJob(w http.ResponseWriter, r *http.Request) {
+	job := s.jobs.find(mux.Vars(r)["id"])
+	if job == nil {
+		s.writeError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	s.stopJob(w, r, job)
+}
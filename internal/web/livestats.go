@@ -0,0 +1,151 @@
+package web
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"photo-sorter-go/internal/organizer"
+
+	"github.com/sirupsen/logrus"
+)
+
+// statsRateWindow is the span the files per second of stats_update messages
+// are measured over.
+const statsRateWindow = 10 * time.Second
+
+// statsSample is the number of processed files at a point in time.
+type statsSample struct {
+	at        time.Time
+	processed int64
+}
+
+// statsChanges is the event sink of the statistics of a running job that
+// collects the changes between two stats_update messages.
+type statsChanges struct {
+	mu         sync.Mutex
+	counters   map[string]int64
+	breakdowns map[string]map[string]int64 // by event kind, then label value
+}
+
+// OnEvent implements statistics.EventSink.
+func (c *statsChanges) OnEvent(kind string, delta int64, labels map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if labels == nil {
+		c.counters[kind] += delta
+		return
+	}
+	for _, value := range labels { // breakdown events have one label
+		if c.breakdowns[kind] == nil {
+			c.breakdowns[kind] = make(map[string]int64)
+		}
+		c.breakdowns[kind][value] += delta
+	}
+}
+
+// take returns the changes collected since the previous call.
+func (c *statsChanges) take() (counters map[string]int64, breakdowns map[string]map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counters, breakdowns = c.counters, c.breakdowns
+	c.counters, c.breakdowns = make(map[string]int64), make(map[string]map[string]int64)
+	return counters, breakdowns
+}
+
+// streamStats sends a stats_update message with the counters of job every
+// web.stats_interval, and once more when the returned function is called,
+// which waits for it to be sent. Clients connecting in between get the latest
+// one at once. org reports the file being processed. The statistics of job
+// also feed the metrics until then.
+func (s *Server) streamStats(org *organizer.FileOrganizer, job *Job) (stop func()) {
+	interval := s.currentConfig().Web.StatsInterval
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	changes := &statsChanges{counters: make(map[string]int64), breakdowns: make(map[string]map[string]int64)}
+	unsubscribeChanges := job.stats.Subscribe(changes)
+	unsubscribeMetrics := job.stats.Subscribe(s.metrics.statsSink(job.stats.IsDryRun()))
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var samples []statsSample
+		stopping := false
+		for {
+			now := time.Now()
+			processed := atomic.LoadInt64(&job.stats.TotalFilesProcessed)
+			samples = append(samples, statsSample{at: now, processed: processed})
+			for len(samples) > 2 && now.Sub(samples[1].at) >= statsRateWindow {
+				samples = samples[1:]
+			}
+			s.publish("stats_update", s.statsUpdate(org, job, samples, changes), logrus.PanicLevel, true)
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				if stopping {
+					return
+				}
+				stopping = true // send the changes since the last update
+			}
+		}
+	}()
+
+	return func() {
+		unsubscribeChanges()
+		unsubscribeMetrics()
+		close(done)
+		<-stopped
+		s.events.clearSnapshot()
+	}
+}
+
+// statsUpdate returns the stats_update message of job: its counters, read
+// atomically, the files per second over samples, the ETA once the number of
+// files is known, the file being processed, and the changes since the
+// previous message.
+func (s *Server) statsUpdate(org *organizer.FileOrganizer, job *Job, samples []statsSample, changes *statsChanges) map[string]any {
+	stats := job.stats
+	found := atomic.LoadInt64(&stats.TotalFilesFound)
+	processed := atomic.LoadInt64(&stats.TotalFilesProcessed)
+	discoveryDone := stats.IsDiscoveryComplete()
+
+	var rate float64
+	first, last := samples[0], samples[len(samples)-1]
+	if elapsed := last.at.Sub(first.at).Seconds(); elapsed > 0 {
+		rate = float64(last.processed-first.processed) / elapsed
+	}
+	var eta any // unknown until discovery has finished and files are processed
+	if discoveryDone && rate > 0 {
+		eta = float64(max(found-processed, 0)) / rate
+	}
+	counters, breakdowns := changes.take()
+
+	return map[string]any{
+		"job_id":           job.ID,
+		"job_type":         job.Type,
+		"elapsed_seconds":  time.Since(job.StartedAt).Seconds(),
+		"files_per_second": rate,
+		"eta_seconds":      eta,
+		"current_file":     org.CurrentFile(),
+		"files": map[string]any{
+			"total_found":     found,
+			"discovery_done":  discoveryDone,
+			"total_processed": processed,
+			"organized":       atomic.LoadInt64(&stats.FilesOrganized),
+			"moved":           atomic.LoadInt64(&stats.FilesMoved),
+			"copied":          atomic.LoadInt64(&stats.FilesCopied),
+			"linked":          atomic.LoadInt64(&stats.FilesLinked),
+			"skipped":         atomic.LoadInt64(&stats.FilesSkipped),
+			"duplicates":      atomic.LoadInt64(&stats.DuplicatesFound),
+			"without_date":    atomic.LoadInt64(&stats.FilesWithoutDates),
+			"errors":          atomic.LoadInt64(&stats.FilesWithErrors),
+			"bytes_processed": atomic.LoadInt64(&stats.BytesProcessed),
+		},
+		"bytes":      bytesData(stats),
+		"changes":    counters,
+		"breakdowns": breakdowns,
+	}
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logStreamInfoRate is how many info messages a second are sent to the
+// clients; the rest are counted and reported with the next one sent.
+// Warnings and errors are always sent.
+const logStreamInfoRate = 50
+
+// logStreamHook sends the server logger's entries at info level and above to
+// the WebSocket and event stream clients as "log" messages, with the fields
+// of the entry, such as file and operation, and the ID of the running job.
+type logStreamHook struct {
+	server *Server
+
+	mu          sync.Mutex
+	windowStart time.Time
+	sent        int // info messages sent since windowStart
+	skipped     int // info messages not sent since the last one sent
+}
+
+// Levels returns the levels the hook receives.
+func (h *logStreamHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel, logrus.InfoLevel}
+}
+
+// Fire sends entry to the clients, unless too many info messages were sent
+// within the last second.
+func (h *logStreamHook) Fire(entry *logrus.Entry) error {
+	skipped, ok := h.admit(entry)
+	if !ok {
+		return nil
+	}
+
+	fields := make(map[string]any, len(entry.Data))
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string, bool, int, int64, float64:
+			fields[key] = v
+		default:
+			fields[key] = fmt.Sprint(v)
+		}
+	}
+	data := map[string]any{
+		"level":     entry.Level.String(),
+		"message":   entry.Message,
+		"timestamp": entry.Time.Format("2006-01-02 15:04:05"),
+		"fields":    fields,
+	}
+	if skipped > 0 {
+		data["skipped"] = skipped
+	}
+	if job := h.server.jobs.running(); job != nil {
+		data["job_id"] = job.ID
+	}
+	h.server.publish("log", data, entry.Level, false)
+	return nil
+}
+
+// admit reports whether entry is sent, and how many info messages were not
+// sent before it.
+func (h *logStreamHook) admit(entry *logrus.Entry) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if entry.Level == logrus.InfoLevel {
+		if now := time.Now(); now.Sub(h.windowStart) >= time.Second {
+			h.windowStart, h.sent = now, 0
+		}
+		if h.sent >= logStreamInfoRate {
+			h.skipped++
+			return 0, false
+		}
+		h.sent++
+	}
+	skipped := h.skipped
+	h.skipped = 0
+	return skipped, true
+}
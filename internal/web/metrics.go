@@ -0,0 +1,174 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"photo-sorter-go/internal/statistics"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the server's Prometheus registry. The job counters are fed
+// by the events of the statistics of each job, through statsSink.
+type metrics struct {
+	registry     *prometheus.Registry
+	httpDuration *prometheus.HistogramVec // by handler, method and code
+	handler      http.Handler
+
+	// jobCounters are the counters of the events of the job statistics, by
+	// event kind; errors counts the "error" events by operation.
+	jobCounters map[string]jobCounter
+	errors      *prometheus.CounterVec
+}
+
+// jobCounter is the counter an event kind adds to, with its labels after
+// dry_run.
+type jobCounter struct {
+	vec    *prometheus.CounterVec
+	labels []string
+}
+
+// jobCollector exports the server state.
+type jobCollector struct {
+	server *Server
+
+	jobRunning *prometheus.Desc
+	clients    *prometheus.Desc
+}
+
+// newMetrics creates the metrics of s.
+func newMetrics(s *Server) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "photo_sorter_http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"handler", "method", "code"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "photo_sorter_errors_total",
+			Help: "Errors recorded by scan, organize and apply jobs by operation.",
+		}, []string{"dry_run", "operation"}),
+	}
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, append([]string{"dry_run"}, labels...))
+		m.registry.MustRegister(vec)
+		return vec
+	}
+	filesProcessed := counter("photo_sorter_files_processed_total", "Media files processed by scan, organize and apply jobs.")
+	filesOrganized := counter("photo_sorter_files_organized_total", "Media files organized, or that would have been in dry runs.")
+	filesErrors := counter("photo_sorter_files_errors_total", "Media files that failed to be processed.")
+	bytesProcessed := counter("photo_sorter_bytes_processed_total", "Bytes of the media files processed.")
+	duplicates := counter("photo_sorter_duplicates_total", "Media files whose target already existed.")
+	dateSources := counter("photo_sorter_dates_extracted_total", "Dates of media files by where they were found.", "source")
+	bytesSaved := counter("photo_sorter_compression_saved_bytes_total", "Bytes saved by compressing files as they were organized.")
+	m.jobCounters = map[string]jobCounter{
+		"total_files_processed":      {filesProcessed, nil},
+		"files_organized":            {filesOrganized, nil},
+		"files_with_errors":          {filesErrors, nil},
+		"bytes_processed":            {bytesProcessed, nil},
+		"duplicates_found":           {duplicates, nil},
+		"bytes_saved_by_compression": {bytesSaved, nil},
+		"date_from_exif":             {dateSources, []string{"exif"}},
+		"date_from_video_meta":       {dateSources, []string{"video_metadata"}},
+		"date_from_thumbnail":        {dateSources, []string{"thumbnail"}},
+		"date_from_file_name":        {dateSources, []string{"file_name"}},
+		"date_from_takeout_json":     {dateSources, []string{"takeout_json"}},
+		"date_from_mod_time":         {dateSources, []string{"mod_time"}},
+		"date_extraction_errors":     {dateSources, []string{"error"}},
+	}
+	for _, dryRun := range []string{"false", "true"} {
+		for _, c := range m.jobCounters {
+			c.vec.WithLabelValues(append([]string{dryRun}, c.labels...)...) // export zeros before the first job
+		}
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.errors,
+		&jobCollector{
+			server:     s,
+			jobRunning: prometheus.NewDesc("photo_sorter_job_running", "Whether a scan, organize or apply job is running (1) or not (0).", nil, nil),
+			clients:    prometheus.NewDesc("photo_sorter_connected_clients", "Connected web interface clients by transport.", []string{"transport"}, nil),
+		},
+	)
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return m
+}
+
+// statsSink returns the event sink that adds the counter changes of a job's
+// statistics to the metrics, labeled with whether it is a dry run.
+func (m *metrics) statsSink(dryRun bool) statistics.EventSink {
+	label := strconv.FormatBool(dryRun)
+	counters := make(map[string]prometheus.Counter, len(m.jobCounters))
+	for kind, c := range m.jobCounters {
+		counters[kind] = c.vec.WithLabelValues(append([]string{label}, c.labels...)...)
+	}
+	return statistics.EventFunc(func(kind string, delta int64, labels map[string]string) {
+		if delta <= 0 {
+			return // Prometheus counters only go up
+		}
+		if kind == "error" {
+			m.errors.WithLabelValues(label, labels["operation"]).Add(float64(delta))
+		} else if c, ok := counters[kind]; ok {
+			c.Add(float64(delta))
+		}
+	})
+}
+
+// streamingRoutes are the routes of long-lived connections, whose durations
+// would swamp the request latencies. They are not instrumented, which also
+// keeps their write deadlines working: the promhttp response writer hides
+// them from http.ResponseController.
+var streamingRoutes = map[string]bool{"/ws": true, "/api/events": true}
+
+// instrument records the duration of requests to next by route template, so
+// that e.g. all /api/jobs/{id} requests share one series.
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				handler = template
+			}
+		}
+		if streamingRoutes[handler] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		observer := m.httpDuration.MustCurryWith(prometheus.Labels{"handler": handler})
+		promhttp.InstrumentHandlerDuration(observer, next).ServeHTTP(w, r)
+	})
+}
+
+// handleMetrics serves the metrics when web.metrics_enabled is set.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !s.currentConfig().Web.MetricsEnabled {
+		http.NotFound(w, r)
+		return
+	}
+	s.metrics.handler.ServeHTTP(w, r)
+}
+
+// Describe implements prometheus.Collector.
+func (c *jobCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.jobRunning
+	ch <- c.clients
+}
+
+// Collect implements prometheus.Collector.
+func (c *jobCollector) Collect(ch chan<- prometheus.Metric) {
+	running := 0.0
+	if c.server.jobs.running() != nil {
+		running = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.jobRunning, prometheus.GaugeValue, running)
+	ch <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, float64(c.server.wsClients.Load()), "websocket")
+	ch <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, float64(c.server.streamClients.Load()), "event_stream")
+}
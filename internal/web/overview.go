@@ -0,0 +1,217 @@
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/organizer"
+	"photo-sorter-go/internal/statistics"
+)
+
+const (
+	// overviewBudget is how long a source directory is walked for an
+	// overview; bigger trees get a partial count.
+	overviewBudget = 5 * time.Second
+
+	// overviewCacheTTL is how long an overview of a source directory is
+	// reused.
+	overviewCacheTTL = 3 * time.Minute
+)
+
+// errOverviewBudget stops a walk that has used up overviewBudget.
+var errOverviewBudget = errors.New("overview time budget exceeded")
+
+// SourceOverview is the number and size of the media files in a source directory.
+type SourceOverview struct {
+	Path        string    `json:"path"`
+	Directories []string  `json:"directories,omitempty"` // the other source directories counted
+	Files       int64     `json:"files"`
+	Bytes       int64     `json:"bytes"`
+	Partial     bool      `json:"partial"` // the walk ran out of time; the counts are a lower bound
+	ScannedAt   time.Time `json:"scanned_at"`
+}
+
+// TargetOverview is the space on the filesystem of a target directory.
+type TargetOverview struct {
+	Path      string `json:"path"`
+	Available int64  `json:"available"`
+	Total     int64  `json:"total"`
+	Error     string `json:"error,omitempty"` // why the space is unknown
+}
+
+// overviewCache keeps recent source overviews by source and target
+// directory, as a target inside the source is not counted.
+type overviewCache struct {
+	mu      sync.Mutex
+	entries map[string]SourceOverview
+}
+
+// get returns the overview stored under key if it is recent enough.
+func (c *overviewCache) get(key string) (SourceOverview, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ov, ok := c.entries[key]
+	if !ok || time.Since(ov.ScannedAt) > overviewCacheTTL {
+		return SourceOverview{}, false
+	}
+	return ov, true
+}
+
+// put stores ov under key, dropping entries that have expired.
+func (c *overviewCache) put(key string, ov SourceOverview) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]SourceOverview)
+	}
+	for old, entry := range c.entries {
+		if time.Since(entry.ScannedAt) > overviewCacheTTL {
+			delete(c.entries, old)
+		}
+	}
+	c.entries[key] = ov
+}
+
+// sourceOverview returns the overview of the source directories of cfg, from
+// the cache if it is recent. Several directories are counted together, under
+// the path of the first.
+func (s *Server) sourceOverview(cfg *config.Config) SourceOverview {
+	var total SourceOverview
+	for i, dir := range cfg.GetSourceDirectories() {
+		key := dir + "\x00" + filepath.Clean(cfg.GetTargetDirectory())
+		ov, ok := s.overviews.get(key)
+		if !ok {
+			ov = walkSource(dir, cfg)
+			s.overviews.put(key, ov)
+		}
+		if i == 0 {
+			total = ov
+			continue
+		}
+		total.Directories = append(total.Directories, ov.Path)
+		total.Files += ov.Files
+		total.Bytes += ov.Bytes
+		total.Partial = total.Partial || ov.Partial
+		if ov.ScannedAt.Before(total.ScannedAt) {
+			total.ScannedAt = ov.ScannedAt
+		}
+	}
+	return total
+}
+
+// walkSource counts the media files below dir for at most overviewBudget,
+// leaving out hidden files if the config does and the target directory if it
+// is inside dir.
+func walkSource(dir string, cfg *config.Config) SourceOverview {
+	ov := SourceOverview{Path: dir}
+	media := mediaExtensions(cfg)
+	target := filepath.Clean(cfg.GetTargetDirectory())
+	deadline := time.Now().Add(overviewBudget)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable entries are skipped, as by a run
+		}
+		if time.Now().After(deadline) {
+			return errOverviewBudget
+		}
+		hidden := path != dir && cfg.Processing.IgnoreHidden && strings.HasPrefix(d.Name(), ".")
+		if d.IsDir() {
+			if hidden || (path != dir && path == target) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hidden || !d.Type().IsRegular() || !media[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			ov.Files++
+			ov.Bytes += info.Size()
+		}
+		return nil
+	})
+	ov.Partial = errors.Is(err, errOverviewBudget)
+	ov.ScannedAt = time.Now()
+	return ov
+}
+
+// handleOverview returns the number and size of the media files in the
+// source directory and the space on the target filesystem, for checking that
+// a run fits before starting it. The source and target query parameters
+// default to the configured directories; source may be repeated for a run of
+// several. All must be within the browse roots.
+func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
+	req := OrganizeRequest{TargetDirectory: r.URL.Query().Get("target")}
+	cfg := s.currentConfig()
+	if sources := r.URL.Query()["source"]; len(sources) > 0 {
+		req.SourceDirectory, req.SourceDirectories = sources[0], sources[1:]
+	} else if sources := cfg.GetSourceDirectories(); len(sources) > 0 {
+		req.SourceDirectory, req.SourceDirectories = sources[0], sources[1:]
+	}
+	roots := s.browseRoots(cfg)
+	for _, path := range append([]string{req.SourceDirectory, req.TargetDirectory}, req.SourceDirectories...) {
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			s.writeError(w, "source and target must be absolute directory paths", http.StatusBadRequest)
+			return
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			resolved = filepath.Clean(path) // a target is created by the run
+		}
+		if !withinRoots(filepath.Clean(path), roots) || !withinRoots(resolved, roots) {
+			s.writeError(w, "Path is outside the allowed browse roots", http.StatusForbidden)
+			return
+		}
+	}
+
+	runCfg, ok := s.runConfig(w, req)
+	if !ok {
+		return
+	}
+	runCfg.Security.CheckDiskSpace = true // shown even if runs do not check it
+	source := s.sourceOverview(&runCfg)
+	target := TargetOverview{Path: runCfg.GetTargetDirectory()}
+	if available, total, err := organizer.DiskSpace(target.Path); err != nil {
+		target.Error = err.Error()
+	} else {
+		target.Available, target.Total = available, total
+	}
+
+	data := map[string]any{
+		"source":      source,
+		"target":      target,
+		"space_check": nil,
+	}
+	if check := s.estimateSpace(&runCfg, source); check != nil {
+		data["space_check"] = map[string]any{
+			"required":   check.Required,
+			"available":  check.Available,
+			"margin":     check.Margin,
+			"sufficient": check.Sufficient(),
+		}
+	}
+	s.writeJSON(w, APIResponse{Success: true, Data: data})
+}
+
+// estimateSpace compares the size of the media files in source with the space
+// on the target filesystem of a run with cfg. It returns nil if the run
+// needs no check, like CheckSpace, or the space cannot be determined.
+func (s *Server) estimateSpace(cfg *config.Config, source SourceOverview) *organizer.SpaceCheck {
+	org := organizer.NewFileOrganizer(cfg, s.log, statistics.NewStatistics(), s.dateExtractor, s.compressor)
+	check, err := org.EstimateSpace(source.Bytes)
+	if err != nil {
+		s.log.Debugf("Skipping disk space estimate: %v", err)
+		return nil
+	}
+	return check
+}
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photo-sorter-go/internal/config"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay is how long the config file must stay unchanged before it is
+// reloaded, so that an editor writing it in several steps causes one reload.
+const reloadDelay = 500 * time.Millisecond
+
+// restartSettings are the prefixes of the settings that only take effect when
+// the server starts.
+var restartSettings = []string{"web.bind_address", "web.tls.", "logging."}
+
+// SetConfigLoader sets how ReloadConfig reads the configuration again.
+func (s *Server) SetConfigLoader(load func() (*config.Config, error)) {
+	s.cfgMutex.Lock()
+	defer s.cfgMutex.Unlock()
+	s.loadConfig = load
+}
+
+// ReloadConfig reads the configuration again and makes it the one new jobs
+// use; running jobs keep the one they started with. The changed settings are
+// sent in a config_reloaded message. A configuration that cannot be loaded is
+// rejected, keeping the current one. reason says what caused the reload.
+func (s *Server) ReloadConfig(reason string) error {
+	s.reloadMutex.Lock() // reloads from a signal and the watcher do not interleave
+	defer s.reloadMutex.Unlock()
+
+	s.cfgMutex.RLock()
+	load := s.loadConfig
+	s.cfgMutex.RUnlock()
+	if load == nil {
+		return errors.New("the configuration cannot be reloaded")
+	}
+	params := map[string]any{"reason": reason}
+	entry := AuditEntry{Action: "config_reload", Params: params}
+	defer func() { s.audit(nil, entry) }()
+
+	cfg, err := load()
+	if err != nil {
+		s.log.Errorf("Configuration reload (%s) rejected, keeping the current configuration: %v", reason, err)
+		entry.Outcome, entry.Error = "rejected", err.Error()
+		s.broadcastWSMessage("config_reload_failed", map[string]any{"reason": reason, "error": err.Error()})
+		return err
+	}
+
+	s.cfgMutex.Lock()
+	changed := config.ChangedSettings(s.cfg, cfg)
+	s.cfg = cfg
+	s.browseDefaults = defaultBrowseRoots(cfg)
+	if cfg.File() != "" {
+		s.cfgNotice = "" // the file could be read
+	}
+	s.cfgMutex.Unlock()
+	s.scheduler.changed()
+	entry.Outcome = "applied"
+	params["changed"] = changed
+
+	if len(changed) == 0 {
+		s.log.Debugf("Configuration reloaded (%s): no settings changed", reason)
+		return nil
+	}
+	s.log.Infof("Configuration reloaded (%s): %s", reason, strings.Join(changed, ", "))
+	var restart []string
+	for _, path := range changed {
+		for _, prefix := range restartSettings {
+			if strings.HasPrefix(path, prefix) {
+				restart = append(restart, path)
+				break
+			}
+		}
+	}
+	if len(restart) > 0 {
+		s.log.Warnf("Restart the server to apply %s", strings.Join(restart, ", "))
+	}
+	s.broadcastWSMessage("config_reloaded", map[string]any{
+		"reason":  reason,
+		"file":    cfg.FilePath(),
+		"changed": changed,
+		"restart": restart,
+	})
+	return nil
+}
+
+// WatchConfigFile reloads the configuration when the file at path changes,
+// until the server stops. The directory is watched, so that files replaced
+// by editors, or by saving the configuration, are noticed as well.
+func (s *Server) WatchConfigFile(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		var pending *time.Timer
+		for {
+			select {
+			case <-s.jobsCtx.Done():
+				if pending != nil {
+					pending.Stop()
+				}
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != path || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				if pending != nil {
+					pending.Stop()
+				}
+				pending = time.AfterFunc(reloadDelay, func() {
+					_ = s.ReloadConfig("config file changed") // logged
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				s.log.Warnf("Watching the config file: %v", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,316 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"photo-sorter-go/internal/config"
+	"photo-sorter-go/internal/schedule"
+
+	"github.com/gorilla/mux"
+)
+
+// schedulerUser is who the jobs started by schedules belong to, in the job
+// history and the audit log.
+const schedulerUser = "scheduler"
+
+// scheduleCheckInterval is the longest the scheduler sleeps before looking at
+// the clock again, so that a changed clock or a suspended machine delays a
+// trigger by at most that long.
+const scheduleCheckInterval = time.Minute
+
+// scheduleRun is the outcome of the last trigger of a schedule.
+type scheduleRun struct {
+	At     time.Time `json:"at"`
+	JobID  string    `json:"job_id,omitempty"`
+	Result string    `json:"result"` // started, skipped or failed
+	Error  string    `json:"error,omitempty"`
+}
+
+// ScheduleStatus is a configured schedule with its next and last run.
+type ScheduleStatus struct {
+	config.Schedule
+	NextRun *time.Time   `json:"next_run"` // nil if disabled
+	LastRun *scheduleRun `json:"last_run"` // nil if not triggered since the server started
+}
+
+// scheduler is the state of the schedules the server runs.
+type scheduler struct {
+	mu   sync.Mutex
+	last map[string]scheduleRun // by schedule name
+
+	wake chan struct{} // the schedules have changed
+}
+
+// newScheduler returns a scheduler without runs.
+func newScheduler() *scheduler {
+	return &scheduler{
+		last: make(map[string]scheduleRun),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// changed makes the scheduler loop recompute the next trigger.
+func (sc *scheduler) changed() {
+	select {
+	case sc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runSchedules triggers the configured schedules until ctx is done. Each
+// schedule due since the previous check is triggered once; a trigger finding
+// a job or compression running is skipped, not queued.
+func (s *Server) runSchedules(ctx context.Context) {
+	from := time.Now()
+	for {
+		wait := scheduleCheckInterval
+		for _, sched := range s.currentConfig().Schedules {
+			if next := nextRun(sched, from); next != nil && time.Until(*next) < wait {
+				wait = max(time.Until(*next), 0)
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.scheduler.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		for _, sched := range s.currentConfig().Schedules {
+			if next := nextRun(sched, from); next != nil && !next.After(now) {
+				s.triggerSchedule(sched)
+			}
+		}
+		from = now
+	}
+}
+
+// nextRun returns the first time after after that sched triggers, or nil if
+// it is disabled or never triggers.
+func nextRun(sched config.Schedule, after time.Time) *time.Time {
+	if sched.Disabled {
+		return nil
+	}
+	spec, err := schedule.Parse(sched.At) // validated with the config
+	if err != nil {
+		return nil
+	}
+	next := spec.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// triggerSchedule starts the job of sched and records the outcome.
+func (s *Server) triggerSchedule(sched config.Schedule) {
+	run := scheduleRun{At: time.Now(), Result: "started"}
+	params := map[string]any{
+		"schedule":         sched.Name,
+		"source_directory": sched.SourceDirectory,
+		"target_directory": sched.TargetDirectory,
+		"dry_run":          sched.DryRun,
+	}
+	id, err := s.startScheduled(sched)
+	switch {
+	case errors.Is(err, errJobRunning), errors.Is(err, errCompressionRunning):
+		run.Result, run.Error = "skipped", err.Error()
+		s.log.Warnf("Skipping schedule %s: %v", sched.Name, err)
+	case err != nil:
+		run.Result, run.Error = "failed", err.Error()
+		s.log.Errorf("Schedule %s failed to start: %v", sched.Name, err)
+	default:
+		run.JobID = id
+		s.log.Infof("Schedule %s started %s %s", sched.Name, sched.Job, id)
+	}
+	s.audit(nil, AuditEntry{
+		User:    schedulerUser,
+		Action:  sched.Job,
+		JobID:   run.JobID,
+		Params:  params,
+		Outcome: run.Result,
+		Error:   run.Error,
+	})
+
+	s.scheduler.mu.Lock()
+	s.scheduler.last[sched.Name] = run
+	s.scheduler.mu.Unlock()
+}
+
+// startScheduled starts the job of sched as a web request would, and returns
+// the ID of the job or compression.
+func (s *Server) startScheduled(sched config.Schedule) (string, error) {
+	if sched.Job == "compress" {
+		if !s.currentConfig().Compressor.Enabled {
+			return "", fmt.Errorf("compression is disabled in config")
+		}
+		req := CompressRequest{
+			Directory:       sched.SourceDirectory,
+			TargetDirectory: sched.TargetDirectory,
+			DryRun:          sched.DryRun,
+		}
+		params, err := s.compressionParams(req)
+		if err != nil {
+			return "", err
+		}
+		run, err := s.startCompression(schedulerUser, req, params)
+		if err != nil {
+			return "", err
+		}
+		return run.ID, nil
+	}
+
+	req := OrganizeRequest{
+		SourceDirectory: sched.SourceDirectory,
+		TargetDirectory: sched.TargetDirectory,
+		DryRun:          sched.DryRun || sched.Job == "scan",
+	}
+	if req.SourceDirectory == "" {
+		if sources := s.currentConfig().GetSourceDirectories(); len(sources) > 0 {
+			req.SourceDirectory, req.SourceDirectories = sources[0], sources[1:]
+		}
+	}
+	cfg, err := s.requestConfig(req)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid options: %w", err)
+	}
+	params := struct {
+		Schedule string `json:"schedule"`
+		OrganizeRequest
+	}{sched.Name, req}
+	job, ctx, err := s.jobs.start(s.jobsCtx, sched.Job, params, schedulerUser, cfg.Web.JobHistory)
+	if err != nil {
+		return "", err
+	}
+	if sched.Job == "scan" {
+		go s.runScanAsync(ctx, job, cfg)
+	} else {
+		go s.runOrganizeAsync(ctx, job, cfg)
+	}
+	return job.ID, nil
+}
+
+// handleListSchedules returns the configured schedules with their next and
+// last runs.
+func (s *Server) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	schedules := s.currentConfig().Schedules
+	statuses := make([]ScheduleStatus, len(schedules))
+	s.scheduler.mu.Lock()
+	for i, sched := range schedules {
+		statuses[i] = ScheduleStatus{Schedule: sched, NextRun: nextRun(sched, now)}
+		if run, ok := s.scheduler.last[sched.Name]; ok {
+			statuses[i].LastRun = &run
+		}
+	}
+	s.scheduler.mu.Unlock()
+	s.writeJSON(w, APIResponse{Success: true, Data: statuses})
+}
+
+// handleCreateSchedule adds the schedule of the request.
+func (s *Server) handleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	s.changeSchedules(w, r, "schedule_create", func(schedules []config.Schedule, sched *config.Schedule) ([]config.Schedule, int) {
+		if slices.ContainsFunc(schedules, func(c config.Schedule) bool { return c.Name == sched.Name }) {
+			return nil, http.StatusConflict
+		}
+		return append(schedules, *sched), 0
+	})
+}
+
+// handleUpdateSchedule replaces the schedule named in the path with the one
+// of the request, which keeps the name if it leaves it out.
+func (s *Server) handleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	s.changeSchedules(w, r, "schedule_update", func(schedules []config.Schedule, sched *config.Schedule) ([]config.Schedule, int) {
+		i := slices.IndexFunc(schedules, func(c config.Schedule) bool { return c.Name == name })
+		if i < 0 {
+			return nil, http.StatusNotFound
+		}
+		if sched.Name == "" {
+			sched.Name = name
+		}
+		schedules[i] = *sched
+		return schedules, 0
+	})
+}
+
+// handleDeleteSchedule removes the schedule named in the path.
+func (s *Server) handleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	s.changeSchedules(w, r, "schedule_delete", func(schedules []config.Schedule, _ *config.Schedule) ([]config.Schedule, int) {
+		i := slices.IndexFunc(schedules, func(c config.Schedule) bool { return c.Name == name })
+		if i < 0 {
+			return nil, http.StatusNotFound
+		}
+		return slices.Delete(schedules, i, i+1), 0
+	})
+}
+
+// changeSchedules applies change to a copy of the configured schedules, with
+// the schedule in the body of r unless it is a delete. The result is only
+// applied if the configuration stays valid and is saved to the config file,
+// so that schedules survive restarts. change returns a status code instead
+// of the schedules if the schedule is missing or already exists.
+func (s *Server) changeSchedules(w http.ResponseWriter, r *http.Request, action string, change func([]config.Schedule, *config.Schedule) ([]config.Schedule, int)) {
+	var sched config.Schedule
+	if r.Method != http.MethodDelete {
+		if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+			s.writeError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entry := AuditEntry{Action: action, Params: map[string]any{"name": mux.Vars(r)["name"], "schedule": sched}}
+	defer func() { s.audit(r, entry) }() // once the config is unlocked
+	s.cfgMutex.Lock()
+	defer s.cfgMutex.Unlock()
+	updated := *s.cfg
+	schedules, status := change(slices.Clone(s.cfg.Schedules), &sched)
+	switch status {
+	case http.StatusNotFound:
+		entry.Outcome, entry.Error = "rejected", "schedule not found"
+		s.writeError(w, "Schedule not found", status)
+		return
+	case http.StatusConflict:
+		entry.Outcome, entry.Error = "rejected", "schedule exists"
+		s.writeError(w, fmt.Sprintf("Schedule %q already exists", sched.Name), status)
+		return
+	}
+	updated.Schedules = schedules
+	updated.SetOrigin(config.OriginWeb, "schedules")
+
+	if err := updated.Validate(); err != nil {
+		entry.Outcome, entry.Error = "rejected", err.Error()
+		s.writeError(w, fmt.Sprintf("Invalid schedule: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := updated.Save(""); err != nil {
+		entry.Outcome, entry.Error = "failed", err.Error()
+		s.writeError(w, fmt.Sprintf("Failed to save configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	s.cfg = &updated
+	s.scheduler.changed()
+
+	s.log.Infof("Schedules changed via web interface by %s", identity(r))
+	entry.Outcome = "applied"
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Message: "Schedules saved to " + updated.FilePath(),
+		Data:    updated.Schedules,
+	})
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"testing"
+
+	"photo-sorter-go/internal/config"
+)
+
+func TestScheduleSkipsWhileJobRuns(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	s, _ := newTestServer(t, cfg)
+	sched := config.Schedule{Name: "nightly", At: "03:00", Job: "scan"}
+
+	// A job started by hand is still running when the schedule triggers.
+	running, _, err := s.jobs.start(s.jobsCtx, "organize", nil, "test", cfg.Web.JobHistory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.triggerSchedule(sched)
+	if run := s.scheduler.last[sched.Name]; run.Result != "skipped" || run.JobID != "" {
+		t.Errorf("last run while a job runs = %+v, want skipped", run)
+	}
+	s.jobs.finish(running, nil)
+
+	s.triggerSchedule(sched)
+	run := s.scheduler.last[sched.Name]
+	if run.Result != "started" || run.JobID == "" {
+		t.Fatalf("last run = %+v, want started", run)
+	}
+	if state := waitForJob(t, s, run.JobID); state != JobCompleted {
+		t.Errorf("scheduled job %s, want %s", state, JobCompleted)
+	}
+}
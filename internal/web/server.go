@@ -1,11 +1,19 @@
 package web
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,8 +24,6 @@ import (
 	"photo-sorter-go/internal/organizer"
 	"photo-sorter-go/internal/statistics"
 
-	"strings"
-
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
@@ -25,24 +31,77 @@ import (
 
 // Server represents the main web server and its state.
 type Server struct {
-	cfg        *config.Config
-	log        *logrus.Logger
-	router     *mux.Router
-	httpServer *http.Server
-	wsUpgrader websocket.Upgrader
-	wsClients  map[*websocket.Conn]bool
-	wsMutex    sync.RWMutex
-
-	operationMutex sync.RWMutex
-	isRunning      bool
-	currentStats   *statistics.Statistics
+	cfgMutex       sync.RWMutex
+	cfg            *config.Config                 // replaced, never changed, by updates; see currentConfig
+	cfgNotice      string                         // shown by the web interface, see SetConfigNotice
+	browseDefaults []string                       // see defaultBrowseRoots
+	loadConfig     func() (*config.Config, error) // see SetConfigLoader
+	reloadMutex    sync.Mutex
+	log            *logrus.Logger
+	router         *mux.Router
+	httpServer     *http.Server
+	wsUpgrader     websocket.Upgrader
+	events         *publisher // messages for WebSocket and event stream clients
+	metrics        *metrics   // the Prometheus metrics served at /metrics
+
+	wsClients     atomic.Int64 // connected WebSocket clients
+	streamClients atomic.Int64 // connected event stream clients
+
+	jobs       jobStore           // scan, organize and apply operations
+	jobsCtx    context.Context    // parent of the jobs' and compressions' contexts
+	cancelJobs context.CancelFunc // stops all jobs when the server stops
+
+	reportMutex sync.RWMutex
+	reportPath  string // JSON report of the last finished scan or organize operation
+	reportJob   string // ID of the job reportPath belongs to
+
+	overviews overviewCache // recent /api/overview results by source directory
+
+	auditLog auditLog // who started jobs and changed the configuration
+
+	scheduler *scheduler // the last runs of the configured schedules
 
 	compressionMutex   sync.RWMutex
 	compressionRunning bool
-	compressionResults []compressor.CompressionResult
-	compressionError   string
+	compression        *compressionRun    // the running or last compression
+	compressionID      int                // ID of the last compression
+	cancelCompression  context.CancelFunc // stops the running compression
 
 	compressor compressor.Compressor
+
+	// dateExtractor is shared by all runs, so that its EXIF cache spares an
+	// organize run reading the files a scan has just read.
+	dateExtractor *extractor.ChainExtractor
+
+	assets         fs.FS // web interface templates and static files
+	assetsFromDisk bool  // assets is a --web-root directory
+
+	authMutex        sync.Mutex
+	sessions         map[string]session // tokens issued by /api/login
+	checkedPasswords map[string]bool    // hashes of basic auth credentials found valid
+
+	started   time.Time // when the server was created, for the uptime
+	version   string    // of the binary, see SetVersion
+	buildTime string
+}
+
+// currentConfig returns the server configuration. Updates replace it instead
+// of changing it, so an operation can use the returned snapshot throughout.
+func (s *Server) currentConfig() *config.Config {
+	s.cfgMutex.RLock()
+	defer s.cfgMutex.RUnlock()
+	return s.cfg
+}
+
+// SetConfigNotice sets a message about the configuration the server started
+// with, such as that no config file was found, which /api/config returns for
+// the web interface to show until the configuration is saved or reloaded.
+// Without one, /api/config tells when the configured directories cannot be
+// used.
+func (s *Server) SetConfigNotice(notice string) {
+	s.cfgMutex.Lock()
+	defer s.cfgMutex.Unlock()
+	s.cfgNotice = notice
 }
 
 // APIResponse is the standard API response structure.
@@ -53,73 +112,160 @@ type APIResponse struct {
 	Error   string `json:"error,omitempty"`
 }
 
-// ScanRequest represents a scan request payload.
+// ScanRequest represents a scan request payload. The options left out fall
+// back to the config, like those of OrganizeRequest, so that a scan previews
+// an organize run with the same options.
 type ScanRequest struct {
-	Directory string `json:"directory"`
+	Directory         string                 `json:"directory"`
+	Directories       []string               `json:"directories,omitempty"` // scanned in the same job as Directory
+	TargetDirectory   string                 `json:"target_directory,omitempty"`
+	DateFormat        string                 `json:"date_format,omitempty"`
+	DuplicateHandling config.DuplicatePolicy `json:"duplicate_handling,omitempty"` // a strategy or one per file category
+	MoveFiles         *bool                  `json:"move_files,omitempty"`
+	MaxFiles          int                    `json:"max_files,omitempty"`
+	ExcludePatterns   []string               `json:"exclude_patterns,omitempty"`
+	MinFileSize       string                 `json:"min_file_size,omitempty"`
+}
+
+// CompressRequest represents a compress request payload. Fields left out
+// fall back to the source and target directories and the compressor settings
+// of the config.
+type CompressRequest struct {
+	Directory       string   `json:"directory,omitempty"`
+	TargetDirectory string   `json:"target_directory,omitempty"`
+	Quality         int      `json:"quality,omitempty"`
+	Threshold       float64  `json:"threshold,omitempty"`
+	Formats         []string `json:"formats,omitempty"`
+	DryRun          bool     `json:"dry_run"`
+	SampleEvery     int      `json:"sample_every,omitempty"`   // with dry_run, encode every N-th image
+	StripMetadata   string   `json:"strip_metadata,omitempty"` // none, gps or all-but-essential
+	Force           bool     `json:"force,omitempty"`          // compress again images cached in the target
+	Profile         string   `json:"profile,omitempty"`        // config profile laid over the server config
 }
 
 // OrganizeRequest represents an organize request payload.
 type OrganizeRequest struct {
-	SourceDirectory string `json:"source_directory"`
-	TargetDirectory string `json:"target_directory,omitempty"`
-	DryRun          bool   `json:"dry_run"`
-	DateFormat      string `json:"date_format,omitempty"`
-	MoveFiles       *bool  `json:"move_files,omitempty"`
+	SourceDirectory   string                 `json:"source_directory"`
+	SourceDirectories []string               `json:"source_directories,omitempty"` // organized in the same job as SourceDirectory
+	TargetDirectory   string                 `json:"target_directory,omitempty"`
+	DryRun            bool                   `json:"dry_run"`
+	DateFormat        string                 `json:"date_format,omitempty"`
+	DuplicateHandling config.DuplicatePolicy `json:"duplicate_handling,omitempty"` // a strategy or one per file category
+	MoveFiles         *bool                  `json:"move_files,omitempty"`
+	Force             bool                   `json:"force,omitempty"`   // start even if the files do not fit on the target
+	Profile           string                 `json:"profile,omitempty"` // config profile laid over the server config, before the options below
+
+	// Limits of the run, replacing security.max_files_per_run and
+	// processing.min_file_size; the exclude patterns are added to the
+	// configured ones.
+	MaxFiles        int      `json:"max_files,omitempty"`
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+	MinFileSize     string   `json:"min_file_size,omitempty"`
+}
+
+// ApplyRequest represents an apply request payload.
+type ApplyRequest struct {
+	TargetDirectory string                `json:"target_directory,omitempty"`
+	Entries         []organizer.PlanEntry `json:"entries"`
 }
 
 // WSMessage is the structure for WebSocket messages.
 type WSMessage struct {
 	Type string `json:"type"`
 	Data any    `json:"data"`
+	Seq  uint64 `json:"seq"` // numbers the messages in sending order
 }
 
 // NewServer creates a new Server instance.
 func NewServer(cfg *config.Config, log *logrus.Logger, compressor compressor.Compressor) *Server {
 	s := &Server{
-		cfg:       cfg,
-		log:       log,
-		router:    mux.NewRouter(),
-		wsClients: make(map[*websocket.Conn]bool),
-		wsUpgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
-		},
-		compressor: compressor,
+		cfg:              cfg,
+		browseDefaults:   defaultBrowseRoots(cfg),
+		log:              log,
+		router:           mux.NewRouter(),
+		events:           newPublisher(),
+		scheduler:        newScheduler(),
+		compressor:       compressor,
+		dateExtractor:    extractor.NewDefaultExtractor(log),
+		assets:           builtinAssets(),
+		sessions:         make(map[string]session),
+		checkedPasswords: make(map[string]bool),
+		started:          time.Now(),
+		version:          "dev",
 	}
 
+	s.jobsCtx, s.cancelJobs = context.WithCancel(context.Background())
+	s.wsUpgrader.CheckOrigin = s.checkOrigin
+	s.metrics = newMetrics(s)
+	log.AddHook(&logStreamHook{server: s})
 	s.setupRoutes()
 	return s
 }
 
 // setupRoutes configures all HTTP and WebSocket routes.
 func (s *Server) setupRoutes() {
+	s.router.Use(s.metrics.instrument)
+	s.router.HandleFunc("/api/login", s.handleLogin).Methods("POST")
+	s.router.HandleFunc("/api/health", s.handleHealth).Methods("GET", "HEAD")
+	s.router.Handle("/metrics", s.requireAuth(http.HandlerFunc(s.handleMetrics))).Methods("GET")
+
 	api := s.router.PathPrefix("/api").Subrouter()
+	api.Use(s.requireAuth)
+	api.HandleFunc("/logout", s.handleLogout).Methods("POST")
 	api.HandleFunc("/status", s.handleStatus).Methods("GET")
+	api.HandleFunc("/version", s.handleVersion).Methods("GET")
 	api.HandleFunc("/scan", s.handleScan).Methods("POST")
 	api.HandleFunc("/organize", s.handleOrganize).Methods("POST")
 	api.HandleFunc("/stop", s.handleStop).Methods("POST")
+	api.HandleFunc("/plan", s.handlePlan).Methods("POST")
+	api.HandleFunc("/apply", s.handleApply).Methods("POST")
+	api.HandleFunc("/jobs", s.handleListJobs).Methods("GET")
+	api.HandleFunc("/history", s.handleListHistory).Methods("GET")
+	api.HandleFunc("/history/{id}", s.handleGetHistory).Methods("GET")
+	api.HandleFunc("/jobs/compare", s.handleCompareJobs).Methods("GET")
+	api.HandleFunc("/jobs/{id}", s.handleGetJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}/stop", s.handleStopJob).Methods("POST")
+	api.HandleFunc("/jobs/{id}/files", s.handleJobFiles).Methods("GET")
+	api.HandleFunc("/jobs/{id}/events", s.handleJobEvents).Methods("GET")
+	api.HandleFunc("/jobs/{id}/errors", s.handleJobErrors).Methods("GET")
+	api.HandleFunc("/jobs/{id}/histogram", s.handleJobHistogram).Methods("GET")
+	api.HandleFunc("/audit", s.handleAudit).Methods("GET")
+	api.HandleFunc("/schedules", s.handleListSchedules).Methods("GET")
+	api.HandleFunc("/schedules", s.handleCreateSchedule).Methods("POST")
+	api.HandleFunc("/schedules/{name}", s.handleUpdateSchedule).Methods("PUT")
+	api.HandleFunc("/schedules/{name}", s.handleDeleteSchedule).Methods("DELETE")
 
 	api.HandleFunc("/statistics", s.handleGetStatistics).Methods("GET")
+	api.HandleFunc("/statistics/directories", s.handleGetDirectoryStatistics).Methods("GET")
+	api.HandleFunc("/report", s.handleGetReport).Methods("GET")
 	api.HandleFunc("/config", s.handleGetConfig).Methods("GET")
 	api.HandleFunc("/config", s.handleUpdateConfig).Methods("POST")
+	api.HandleFunc("/config/save", s.handleSaveConfig).Methods("POST")
 	api.HandleFunc("/date-formats", s.handleGetDateFormats).Methods("GET")
+	api.HandleFunc("/events", s.handleEvents).Methods("GET")
+	api.HandleFunc("/browse", s.handleBrowse).Methods("GET")
+	api.HandleFunc("/browse/roots", s.handleBrowseRoots).Methods("GET")
+	api.HandleFunc("/exif", s.handleExif).Methods("GET")
+	api.HandleFunc("/overview", s.handleOverview).Methods("GET")
 
 	api.HandleFunc("/compress", s.handleCompress).Methods("POST")
+	api.HandleFunc("/compress/stop", s.handleStopCompression).Methods("POST")
 	api.HandleFunc("/compression-status", s.handleCompressionStatus).Methods("GET")
+	api.HandleFunc("/compression/{id}/results", s.handleCompressionResults).Methods("GET")
+	api.HandleFunc("/compression/{id}/results.csv", s.handleCompressionCSV).Methods("GET")
 
-	s.router.HandleFunc("/ws", s.handleWebSocket)
+	s.router.Handle("/ws", s.requireAuth(http.HandlerFunc(s.handleWebSocket)))
 
-	s.router.PathPrefix("/static/").Handler(
-		http.StripPrefix("/static/", http.FileServer(http.Dir("web/static/"))),
-	)
+	s.router.HandleFunc("/static/{path:.+}", s.handleStatic).Methods("GET", "HEAD")
 
-	s.router.HandleFunc("/", s.handleIndex).Methods("GET")
+	s.router.HandleFunc("/", s.handleIndex).Methods("GET", "HEAD")
 }
 
-// Start launches the HTTP server on the specified port.
-func (s *Server) Start(port int) error {
-	addr := fmt.Sprintf(":%d", port)
+// Start launches the HTTP server on the specified host and port; an empty
+// host listens on all interfaces. With tlsCfg enabled it serves HTTPS. The
+// configured schedules run until the server stops.
+func (s *Server) Start(host string, port int, tlsCfg config.TLSConfig) error {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
 	s.httpServer = &http.Server{
 		Addr:         addr,
 		Handler:      s.router,
@@ -128,12 +274,56 @@ func (s *Server) Start(port int) error {
 		IdleTimeout:  120 * time.Second,
 	}
 
-	s.log.Infof("Starting web server on http://localhost%s", addr)
+	if n := len(s.currentConfig().Schedules); n > 0 {
+		s.log.Infof("Running %d schedule(s)", n)
+	}
+	go s.runSchedules(s.jobsCtx)
+
+	if tlsCfg.Enabled() {
+		s.log.Infof("Starting web server on https://%s", addr)
+		return s.httpServer.ListenAndServeTLS(tlsCfg.CertFile, tlsCfg.KeyFile)
+	}
+	s.log.Infof("Starting web server on http://%s", addr)
 	return s.httpServer.ListenAndServe()
 }
 
-// Stop gracefully shuts down the HTTP server.
+// Stop gracefully shuts down the server. The running job and compression are
+// stopped; Stop waits, until ctx is done, for the job to finish its current
+// files and write its statistics and report, and for the WebSocket clients to
+// get a close message. Then the HTTP server is shut down.
 func (s *Server) Stop(ctx context.Context) error {
+	s.compressionMutex.RLock()
+	compressing := s.compressionRunning
+	s.compressionMutex.RUnlock()
+
+	var cutOff []string
+	if job := s.stopJobs(ctx); job != nil {
+		cutOff = append(cutOff, fmt.Sprintf("%s job %s (started %s)", job.Type, job.ID, job.StartedAt.Format(time.DateTime)))
+	}
+	if compressing {
+		cutOff = append(cutOff, "compression")
+	}
+	if len(cutOff) > 0 {
+		s.log.Warnf("Shutdown cut off: %s", strings.Join(cutOff, ", "))
+	}
+
+	s.events.closeAll() // shutting down does not end WebSockets and event streams
+	poll := time.NewTicker(10 * time.Millisecond)
+	defer poll.Stop()
+	for s.wsClients.Load() > 0 && ctx.Err() == nil {
+		select {
+		case <-poll.C:
+		case <-ctx.Done():
+		}
+	}
+
+	s.reportMutex.Lock()
+	if s.reportPath != "" {
+		os.Remove(s.reportPath)
+		s.reportPath = ""
+	}
+	s.reportMutex.Unlock()
+
 	if s.httpServer != nil {
 		return s.httpServer.Shutdown(ctx)
 	}
@@ -142,41 +332,59 @@ func (s *Server) Stop(ctx context.Context) error {
 
 // handleIndex serves the main HTML page.
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "web/templates/index.html")
+	s.serveAsset(w, r, "templates/index.html")
 }
 
-// handleStatus returns the current operation status and statistics.
+// handleStatus returns the current operation status and statistics: those of
+// the running job, or else of the last one.
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	s.operationMutex.RLock()
-	running := s.isRunning
-	stats := s.currentStats
-	s.operationMutex.RUnlock()
-
-	var statsData any
-	if stats != nil {
-		statsData = map[string]any{
-			"summary": stats.GetSummary(),
-			"files": map[string]any{
-				"total_found":     atomic.LoadInt64(&stats.TotalFilesFound),
-				"total_processed": atomic.LoadInt64(&stats.TotalFilesProcessed),
-				"organized":       atomic.LoadInt64(&stats.FilesOrganized),
-				"moved":           atomic.LoadInt64(&stats.FilesMoved),
-				"copied":          atomic.LoadInt64(&stats.FilesCopied),
-				"skipped":         atomic.LoadInt64(&stats.FilesSkipped),
-				"errors":          atomic.LoadInt64(&stats.FilesWithErrors),
-			},
-		}
+	var current any
+	var stats *statistics.Statistics
+	job, ok := s.jobs.latest()
+	if ok {
+		current, stats = job, job.stats
 	}
 
 	s.writeJSON(w, APIResponse{
 		Success: true,
 		Data: map[string]any{
-			"running":    running,
-			"statistics": statsData,
+			"running":    ok && job.State == JobRunning,
+			"job":        current,
+			"statistics": statisticsData(stats),
 		},
 	})
 }
 
+// statisticsData returns the counters of stats for API responses, or nil.
+func statisticsData(stats *statistics.Statistics) any {
+	if stats == nil {
+		return nil
+	}
+	return map[string]any{
+		"summary": stats.GetSummary(),
+		"files": map[string]any{
+			"total_found":     atomic.LoadInt64(&stats.TotalFilesFound),
+			"discovery_done":  stats.IsDiscoveryComplete(),
+			"total_processed": atomic.LoadInt64(&stats.TotalFilesProcessed),
+			"organized":       atomic.LoadInt64(&stats.FilesOrganized),
+			"moved":           atomic.LoadInt64(&stats.FilesMoved),
+			"copied":          atomic.LoadInt64(&stats.FilesCopied),
+			"skipped":         atomic.LoadInt64(&stats.FilesSkipped),
+			"in_use":          atomic.LoadInt64(&stats.FilesInUse),
+			"hidden_skipped":  atomic.LoadInt64(&stats.HiddenFilesSkipped),
+			"wrong_extension": atomic.LoadInt64(&stats.MismatchedExtensions),
+			"errors":          atomic.LoadInt64(&stats.FilesWithErrors),
+		},
+		"bytes":         bytesData(stats),
+		"file_types":    stats.FileTypes(),
+		"largest_files": stats.GetLargestFiles(statistics.LargestFilesKept),
+		"space": map[string]any{
+			"required":  atomic.LoadInt64(&stats.SpaceRequired),
+			"available": atomic.LoadInt64(&stats.SpaceAvailable),
+		},
+	}
+}
+
 // handleScan starts a scan operation asynchronously.
 func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
 	var req ScanRequest
@@ -195,11 +403,31 @@ func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go s.runScanAsyncWithLogs(req.Directory)
+	cfg, ok := s.runConfig(w, OrganizeRequest{
+		SourceDirectory:   req.Directory,
+		SourceDirectories: req.Directories,
+		TargetDirectory:   req.TargetDirectory,
+		DryRun:            true,
+		DateFormat:        req.DateFormat,
+		DuplicateHandling: req.DuplicateHandling,
+		MoveFiles:         req.MoveFiles,
+		MaxFiles:          req.MaxFiles,
+		ExcludePatterns:   req.ExcludePatterns,
+		MinFileSize:       req.MinFileSize,
+	})
+	if !ok {
+		return
+	}
+	job, ctx, ok := s.startJob(w, r, "scan", req)
+	if !ok {
+		return
+	}
+	go s.runScanAsync(ctx, job, cfg)
 
 	s.writeJSON(w, APIResponse{
 		Success: true,
 		Message: "Scan started",
+		Data:    map[string]any{"job_id": job.ID},
 	})
 }
 
@@ -216,219 +444,472 @@ func (s *Server) handleOrganize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.operationMutex.RLock()
-	if s.isRunning {
-		s.operationMutex.RUnlock()
-		s.writeError(w, "Operation already in progress", http.StatusConflict)
+	if _, err := os.Stat(req.SourceDirectory); os.IsNotExist(err) {
+		s.writeError(w, "Source directory does not exist", http.StatusBadRequest)
+		return
+	}
+
+	cfg, ok := s.runConfig(w, req)
+	if !ok {
 		return
 	}
-	s.operationMutex.RUnlock()
+	if req.Force {
+		cfg.Security.CheckDiskSpace = false
+	} else if check := s.estimateSpace(&cfg, s.sourceOverview(&cfg)); check != nil && !check.Sufficient() {
+		s.writeError(w, fmt.Sprintf("%v: %s; set force to start anyway", organizer.ErrInsufficientSpace, check), http.StatusInsufficientStorage)
+		return
+	}
+	job, ctx, ok := s.startJob(w, r, "organize", req)
+	if !ok {
+		return
+	}
+	go s.runOrganizeAsync(ctx, job, cfg)
 
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Message: "Organization started",
+		Data:    map[string]any{"job_id": job.ID},
+	})
+}
+
+// handlePlan returns the operations an organize request would perform, for review.
+func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	var req OrganizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.SourceDirectory == "" {
+		s.writeError(w, "Source directory is required", http.StatusBadRequest)
+		return
+	}
 	if _, err := os.Stat(req.SourceDirectory); os.IsNotExist(err) {
 		s.writeError(w, "Source directory does not exist", http.StatusBadRequest)
 		return
 	}
 
-	go s.runOrganizeAsync(req)
+	req.DryRun = true
+	cfg, ok := s.runConfig(w, req)
+	if !ok {
+		return
+	}
+	stats := statistics.NewStatistics()
+	org := organizer.NewFileOrganizer(&cfg, s.log, stats, s.dateExtractor, s.compressor)
+
+	entries, err := org.Plan()
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]any{
+			"entries":    entries,
+			"statistics": stats.GetSummary(),
+		},
+	})
+}
+
+// handleApply starts executing a reviewed plan asynchronously.
+func (s *Server) handleApply(w http.ResponseWriter, r *http.Request) {
+	var req ApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Entries) == 0 {
+		s.writeError(w, "Plan entries are required", http.StatusBadRequest)
+		return
+	}
+	if err := s.checkPlanPaths(req); err != nil {
+		s.writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	params := map[string]any{
+		"target_directory": req.TargetDirectory,
+		"entries":          len(req.Entries),
+	}
+	job, ctx, ok := s.startJob(w, r, "apply", params)
+	if !ok {
+		return
+	}
+	go s.runApplyAsync(ctx, job, req)
 
 	s.writeJSON(w, APIResponse{
 		Success: true,
-		Message: "Organization started",
+		Message: "Applying plan",
+		Data:    map[string]any{"job_id": job.ID},
 	})
 }
 
-// handleStop stops the current operation.
+// handleStop stops the running job, if any.
 func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
-	s.operationMutex.Lock()
-	s.isRunning = false
-	s.operationMutex.Unlock()
+	job := s.jobs.running()
+	if job == nil {
+		s.writeJSON(w, APIResponse{
+			Success: true,
+			Message: "No operation running",
+		})
+		return
+	}
+	s.stopJob(w, r, job)
+}
 
-	s.broadcastWSMessage("operation_stopped", map[string]any{
-		"message": "Operation stopped by user",
-	})
+// bytesData returns the bytes of stats by what was done with the files;
+// processed is the sum of the others.
+func bytesData(stats *statistics.Statistics) map[string]any {
+	return map[string]any{
+		"processed":     atomic.LoadInt64(&stats.BytesProcessed),
+		"moved":         atomic.LoadInt64(&stats.BytesMoved),
+		"copied":        atomic.LoadInt64(&stats.BytesCopied),
+		"linked":        atomic.LoadInt64(&stats.BytesLinked),
+		"skipped":       atomic.LoadInt64(&stats.BytesSkipped),
+		"would_process": atomic.LoadInt64(&stats.BytesWouldProcess),
+	}
+}
+
+// handleGetStatistics returns the statistics of the running or last job.
+func (s *Server) handleGetStatistics(w http.ResponseWriter, r *http.Request) {
+	var stats *statistics.Statistics
+	if job, ok := s.jobs.latest(); ok {
+		stats = job.stats
+	}
 
 	s.writeJSON(w, APIResponse{
 		Success: true,
-		Message: "Operation stopped",
+		Data:    statisticsData(stats),
 	})
 }
 
-// handleGetStatistics returns the current statistics.
-func (s *Server) handleGetStatistics(w http.ResponseWriter, r *http.Request) {
-	s.operationMutex.RLock()
-	stats := s.currentStats
-	s.operationMutex.RUnlock()
-
-	var statsData any
-	if stats != nil {
-		statsData = map[string]any{
-			"summary": stats.GetSummary(),
-			"files": map[string]any{
-				"total_found":     atomic.LoadInt64(&stats.TotalFilesFound),
-				"total_processed": atomic.LoadInt64(&stats.TotalFilesProcessed),
-				"organized":       atomic.LoadInt64(&stats.FilesOrganized),
-				"moved":           atomic.LoadInt64(&stats.FilesMoved),
-				"copied":          atomic.LoadInt64(&stats.FilesCopied),
-				"skipped":         atomic.LoadInt64(&stats.FilesSkipped),
-				"errors":          atomic.LoadInt64(&stats.FilesWithErrors),
-			},
-		}
+// handleGetDirectoryStatistics returns how many files the current or last
+// operation placed in each target directory.
+func (s *Server) handleGetDirectoryStatistics(w http.ResponseWriter, r *http.Request) {
+	directories := []statistics.DirectoryStat{}
+	if job, ok := s.jobs.latest(); ok {
+		directories = job.stats.DirectoryBreakdown()
 	}
 
 	s.writeJSON(w, APIResponse{
 		Success: true,
-		Data:    statsData,
+		Data:    directories,
 	})
 }
 
+// handleGetReport returns the report of the last finished scan or organize
+// operation: a JSON object with a "header" and one entry per file in "files".
+func (s *Server) handleGetReport(w http.ResponseWriter, r *http.Request) {
+	s.reportMutex.RLock()
+	defer s.reportMutex.RUnlock()
+
+	if s.reportPath == "" {
+		s.writeError(w, "No report available", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(s.reportPath)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	io.Copy(w, f)
+}
+
 // handleCompress starts the image compression process asynchronously.
 func (s *Server) handleCompress(w http.ResponseWriter, r *http.Request) {
-	s.compressionMutex.Lock()
-	if s.compressionRunning {
-		s.compressionMutex.Unlock()
+	var req CompressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		s.writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.currentConfig().Compressor.Enabled {
+		s.writeError(w, "Compression is disabled in config", http.StatusBadRequest)
+		return
+	}
+	params, err := s.compressionParams(req)
+	if err != nil {
+		s.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	run, err := s.startCompression(identity(r), req, params)
+	if err != nil {
+		s.audit(r, AuditEntry{Action: "compress", Params: req, Outcome: "rejected", Error: err.Error()})
 		s.writeJSON(w, APIResponse{
 			Success: false,
 			Error:   "Compression already running",
 		})
 		return
 	}
+	s.audit(r, AuditEntry{Action: "compress", JobID: run.ID, Params: req, Outcome: "started"})
+
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Message: "Image compression started",
+		Data:    map[string]any{"id": run.ID},
+	})
+}
+
+// startCompression starts compressing with params, as requested by user with
+// req, or returns errCompressionRunning.
+func (s *Server) startCompression(user string, req CompressRequest, params compressor.CompressionParams) (*compressionRun, error) {
+	s.compressionMutex.Lock()
+	defer s.compressionMutex.Unlock()
+	if s.compressionRunning {
+		return nil, errCompressionRunning
+	}
+	ctx, cancel := context.WithCancel(s.jobsCtx)
+	s.compressionID++
+	run := &compressionRun{
+		ID:        strconv.Itoa(s.compressionID),
+		User:      user,
+		Params:    req,
+		DryRun:    params.DryRun,
+		StartedAt: time.Now(),
+	}
 	s.compressionRunning = true
-	s.compressionResults = nil
-	s.compressionError = ""
-	s.compressionMutex.Unlock()
+	s.compression = run
+	s.cancelCompression = cancel
+	go s.runCompressionAsync(ctx, run, params)
+	return run, nil
+}
 
-	go s.runCompressionAsync()
+// handleStopCompression stops the running compression. Files being compressed
+// are finished, except for videos, whose encode is aborted.
+func (s *Server) handleStopCompression(w http.ResponseWriter, r *http.Request) {
+	s.compressionMutex.Lock()
+	running := s.compressionRunning
+	if s.cancelCompression != nil {
+		s.cancelCompression()
+		s.cancelCompression = nil
+	}
+	var id string
+	if s.compression != nil {
+		id = s.compression.ID
+	}
+	s.compressionMutex.Unlock()
 
+	if !running {
+		s.writeJSON(w, APIResponse{
+			Success: false,
+			Error:   "No compression running",
+		})
+		return
+	}
+	s.audit(r, AuditEntry{Action: "compress_stop", JobID: id, Outcome: "stopped"})
 	s.writeJSON(w, APIResponse{
 		Success: true,
-		Message: "Image compression started",
+		Message: "Stopping compression",
 	})
 }
 
+// compressionParams returns the parameters for a compress request, taking the
+// fields it leaves out from the config.
+func (s *Server) compressionParams(req CompressRequest) (compressor.CompressionParams, error) {
+	cfg, err := s.profileConfig(req.Profile)
+	if err != nil {
+		return compressor.CompressionParams{}, err
+	}
+	directory := req.Directory
+	if directory == "" {
+		directory = cfg.SourceDirectory
+	}
+	if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+		return compressor.CompressionParams{}, fmt.Errorf("directory does not exist or is not accessible: %s", directory)
+	}
+	targetDir := req.TargetDirectory
+	if targetDir == "" {
+		targetDir = cfg.GetTargetDirectory()
+	}
+
+	params := compressor.ParamsFromConfig(cfg.Compressor, []string{directory}, targetDir)
+	params.DryRun = req.DryRun
+	params.Force = req.Force
+	params.DetectFileType = cfg.Processing.DetectFileType
+	if req.SampleEvery < 0 {
+		return params, fmt.Errorf("sample_every must be positive")
+	}
+	params.SampleEvery = req.SampleEvery
+	if err := params.Override(req.Quality, req.Threshold, req.Formats); err != nil {
+		return params, err
+	}
+	switch req.StripMetadata {
+	case "":
+	case compressor.StripNone, compressor.StripGPS, compressor.StripAllButEssential:
+		params.StripMetadata = req.StripMetadata
+	default:
+		return params, fmt.Errorf("invalid strip_metadata (valid: none, gps, all-but-essential)")
+	}
+	return params, nil
+}
+
 // runCompressionAsync performs image compression in a separate goroutine.
-func (s *Server) runCompressionAsync() {
+func (s *Server) runCompressionAsync(ctx context.Context, run *compressionRun, compParams compressor.CompressionParams) {
 	s.broadcastWSMessage("compression_started", map[string]any{
-		"message":   "Image compression started",
-		"directory": s.cfg.SourceDirectory,
+		"id":               run.ID,
+		"message":          "Image compression started",
+		"directory":        compParams.InputPaths[0],
+		"target_directory": compParams.TargetDir,
+		"quality":          compParams.Quality,
+		"threshold":        compParams.Threshold,
+		"formats":          compParams.Formats,
+		"dry_run":          compParams.DryRun,
+		"strip_metadata":   compParams.StripMetadata,
 	})
 
 	defer func() {
 		s.compressionMutex.Lock()
 		s.compressionRunning = false
+		if s.cancelCompression != nil {
+			s.cancelCompression()
+			s.cancelCompression = nil
+		}
 		s.compressionMutex.Unlock()
 	}()
 
-	params := s.cfg.Compressor
-	s.log.Infof("runCompressionAsync called: enabled=%v, input=%v", params.Enabled, s.cfg.SourceDirectory)
+	s.log.Infof("Starting image compression: input=%s, targetDir=%s, quality=%d, threshold=%.2f, formats=%v, dryRun=%v",
+		compParams.InputPaths[0], compParams.TargetDir, compParams.Quality, compParams.Threshold, compParams.Formats, compParams.DryRun)
 
-	if !params.Enabled {
-		s.log.Warn("Compression is disabled in config")
-		return
-	}
-
-	targetDir := s.cfg.SourceDirectory
-	if s.cfg.TargetDirectory != nil && *s.cfg.TargetDirectory != "" {
-		targetDir = *s.cfg.TargetDirectory
-	}
-	compParams := compressor.CompressionParams{
-		InputPaths: []string{s.cfg.SourceDirectory},
-		TargetDir:  targetDir,
-		Quality:    params.Quality,
-		Threshold:  params.Threshold,
-		Formats:    params.Formats,
-	}
-
-	if len(compParams.InputPaths) == 0 || compParams.InputPaths[0] == "" {
-		s.log.Warn("No input files for compression: input paths empty")
-		return
-	}
-	if _, err := os.Stat(compParams.InputPaths[0]); err != nil {
-		s.log.Warnf("Input directory does not exist or not accessible: %v", err)
-		return
-	}
+	compParams.Progress = s.compressionProgressReporter()
+	compParams.Logger = s.log
 
-	s.log.Infof("Starting image compression: input=%v, targetDir=%s, quality=%d, threshold=%.2f, formats=%v",
-		s.cfg.SourceDirectory, targetDir, params.Quality, params.Threshold, params.Formats)
-
-	ctx := context.Background()
 	results, err := s.compressor.Compress(ctx, compParams)
+	stopped := err != nil && ctx.Err() != nil
+	entry := AuditEntry{User: run.User, Action: "compress", JobID: run.ID, Params: run.Params, Outcome: JobCompleted}
+	defer func() { s.audit(nil, entry) }()
 	s.compressionMutex.Lock()
 	defer s.compressionMutex.Unlock()
-	if err != nil {
-		s.compressionError = err.Error()
-		s.compressionResults = nil
+	now := time.Now()
+	run.FinishedAt = &now
+	if stopped {
+		entry.Outcome = JobStopped
+	}
+	if err != nil && !stopped {
+		run.Error = err.Error()
+		entry.Outcome, entry.Error = JobFailed, run.Error
+		s.recordCompression(run, compParams, now)
 		s.log.Errorf("Image compression error: %v", err)
 		s.broadcastWSMessage("compression_error", map[string]any{
+			"id":    run.ID,
 			"error": err.Error(),
 		})
-	} else {
-		s.compressionResults = results
-		var origSize, compSize int64
-		var processedCount int
-		for _, r := range results {
-			if r.Action == "compressed" || r.Action == "original" {
-				origSize += r.OriginalSize
-				compSize += r.CompressedSize
-				processedCount++
-			}
-		}
-		var percent float64
-		if origSize > 0 {
-			percent = float64(origSize-compSize) * 100 / float64(origSize)
+		return
+	}
+
+	run.Results = results
+	run.Totals = summarizeCompression(results)
+	s.recordCompression(run, compParams, now)
+	event, message := "compression_completed", "Image compression finished"
+	if stopped {
+		event, message = "compression_stopped", "Image compression stopped by user"
+	}
+	s.log.Infof("%s: %d files processed (only compressed/original), total files: %d", message, run.Totals.FilesProcessed, len(results))
+	s.broadcastWSMessage(event, map[string]any{
+		"id":              run.ID,
+		"files_processed": run.Totals.FilesProcessed,
+		"files_cached":    run.Totals.Cached,
+		"original_size":   run.Totals.OriginalSize,
+		"compressed_size": run.Totals.CompressedSize,
+		"percent_saved":   run.Totals.PercentSaved,
+		"duration_ms":     run.Totals.DurationMS,
+		"dry_run":         compParams.DryRun,
+		"projected_saved": run.Totals.ProjectedSaved,
+		"message":         message,
+	})
+}
+
+// compressionProgressReporter returns a progress callback that broadcasts
+// compression_progress messages, at most a few times per second and always
+// for the last file.
+func (s *Server) compressionProgressReporter() func(compressor.CompressionProgress) {
+	var last time.Time
+	return func(p compressor.CompressionProgress) {
+		if p.Done < p.Total && time.Since(last) < 500*time.Millisecond {
+			return
 		}
-		s.log.Infof("Image compression finished: %d files processed (only compressed/original), total files: %d", processedCount, len(results))
-		s.broadcastWSMessage("compression_completed", map[string]any{
-			"files_processed": processedCount,
-			"original_size":   origSize,
-			"compressed_size": compSize,
-			"percent_saved":   percent,
-			"message":         "Image compression finished",
+		last = time.Now()
+		s.broadcastWSMessage("compression_progress", map[string]any{
+			"done":        p.Done,
+			"total":       p.Total,
+			"bytes_saved": p.BytesSaved,
 		})
 	}
 }
 
-// handleCompressionStatus returns the status and results of compression.
+// handleCompressionStatus returns the status and totals of the running or
+// last compression. Its results are included up to maxStatusResults files;
+// those of larger runs are read from /api/compression/{id}/results.
 func (s *Server) handleCompressionStatus(w http.ResponseWriter, r *http.Request) {
 	s.compressionMutex.RLock()
 	running := s.compressionRunning
-	results := s.compressionResults
-	errMsg := s.compressionError
+	var run compressionRun
+	if s.compression != nil {
+		run = *s.compression
+	}
 	s.compressionMutex.RUnlock()
 
-	s.writeJSON(w, APIResponse{
-		Success: true,
-		Data: map[string]any{
-			"running": running,
-			"results": results,
-			"error":   errMsg,
-		},
-	})
+	data := map[string]any{
+		"id":      run.ID,
+		"running": running,
+		"results": []compressor.CompressionResult{},
+		"summary": run.Totals,
+		"error":   run.Error,
+	}
+	if len(run.Results) > maxStatusResults {
+		data["results"] = nil
+		data["results_truncated"] = true
+	} else if run.Results != nil {
+		data["results"] = run.Results
+	}
+	s.writeJSON(w, APIResponse{Success: true, Data: data})
 }
 
 // handleGetConfig returns the current configuration.
 func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	s.cfgMutex.RLock()
+	cfg, notice := s.cfg, s.cfgNotice
+	s.cfgMutex.RUnlock()
+	if notice == "" {
+		checked := *cfg // ValidatePaths may fill in source_directory
+		if err := checked.ValidatePaths(); err != nil {
+			notice = fmt.Sprintf("The configured directories cannot be used (%v); choose them below.", err)
+		}
+	}
 	s.writeJSON(w, APIResponse{
 		Success: true,
 		Data: map[string]any{
-			"date_format":        s.cfg.DateFormat,
-			"move_files":         s.cfg.Processing.MoveFiles,
-			"dry_run":            s.cfg.Security.DryRun,
-			"duplicate_handling": s.cfg.Processing.DuplicateHandling,
-			"source_directory":   s.cfg.SourceDirectory,
-			"target_directory":   s.cfg.TargetDirectory,
+			"date_format":        cfg.DateFormat,
+			"move_files":         cfg.Processing.MoveFiles,
+			"dry_run":            cfg.Security.DryRun,
+			"duplicate_handling": cfg.Processing.DuplicateHandling, // strategies by file category
+			"source_directory":   cfg.SourceDirectory,
+			"source_directories": cfg.SourceDirectories,
+			"sources":            cfg.Sources, // organized with settings of their own
+			"target_directory":   cfg.TargetDirectory,
+			"profiles":           cfg.ProfileNames(), // selectable with "profile" in organize, scan and compress requests
+			"notice":             notice,
 		},
 	})
 }
 
-// handleUpdateConfig updates the configuration from the request.
+// handleUpdateConfig updates the configuration from the request. The update
+// is only applied if the resulting configuration is valid; with
+// "persist": true, it is also saved to the config file. Running operations
+// keep the configuration they started with.
 func (s *Server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	var configUpdate struct {
-		DateFormat        string `json:"date_format,omitempty"`
-		MoveFiles         *bool  `json:"move_files,omitempty"`
-		DryRun            *bool  `json:"dry_run,omitempty"`
-		DuplicateHandling string `json:"duplicate_handling,omitempty"`
-		SourceDirectory   string `json:"source_directory,omitempty"`
-		TargetDirectory   string `json:"target_directory,omitempty"`
+		DateFormat        string                 `json:"date_format,omitempty"`
+		MoveFiles         *bool                  `json:"move_files,omitempty"`
+		DryRun            *bool                  `json:"dry_run,omitempty"`
+		DuplicateHandling config.DuplicatePolicy `json:"duplicate_handling,omitempty"`
+		SourceDirectory   string                 `json:"source_directory,omitempty"`
+		TargetDirectory   string                 `json:"target_directory,omitempty"`
+		Persist           bool                   `json:"persist,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&configUpdate); err != nil {
@@ -436,30 +917,81 @@ func (s *Server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entry := AuditEntry{Action: "config_update", Params: map[string]any{"persist": configUpdate.Persist}}
+	defer func() { s.audit(r, entry) }() // once the config is unlocked
+	s.cfgMutex.Lock()
+	defer s.cfgMutex.Unlock()
+	updated := *s.cfg
 	if configUpdate.DateFormat != "" {
-		s.cfg.DateFormat = configUpdate.DateFormat
+		updated.DateFormat = configUpdate.DateFormat
+		updated.SetOrigin(config.OriginWeb, "date_format")
 	}
 	if configUpdate.MoveFiles != nil {
-		s.cfg.Processing.MoveFiles = *configUpdate.MoveFiles
+		updated.Processing.MoveFiles = *configUpdate.MoveFiles
+		updated.SetOrigin(config.OriginWeb, "processing.move_files")
 	}
 	if configUpdate.DryRun != nil {
-		s.cfg.Security.DryRun = *configUpdate.DryRun
+		updated.Security.DryRun = *configUpdate.DryRun
+		updated.SetOrigin(config.OriginWeb, "security.dry_run")
 	}
-	if configUpdate.DuplicateHandling != "" {
-		s.cfg.Processing.DuplicateHandling = configUpdate.DuplicateHandling
+	if len(configUpdate.DuplicateHandling) > 0 {
+		updated.Processing.DuplicateHandling = configUpdate.DuplicateHandling
+		updated.SetOrigin(config.OriginWeb, "processing.duplicate_handling")
 	}
 	if configUpdate.SourceDirectory != "" {
-		s.cfg.SourceDirectory = configUpdate.SourceDirectory
+		updated.SourceDirectory = configUpdate.SourceDirectory
+		updated.SetOrigin(config.OriginWeb, "source_directory")
 	}
 	if configUpdate.TargetDirectory != "" {
-		s.cfg.TargetDirectory = &configUpdate.TargetDirectory
+		updated.TargetDirectory = &configUpdate.TargetDirectory
+		updated.SetOrigin(config.OriginWeb, "target_directory")
+	}
+
+	entry.Changes = configChanges(s.cfg, &updated)
+	if err := updated.Validate(); err != nil {
+		entry.Outcome, entry.Error = "rejected", err.Error()
+		s.writeError(w, fmt.Sprintf("Invalid configuration: %v", err), http.StatusBadRequest)
+		return
 	}
+	message := "Configuration updated successfully"
+	if configUpdate.Persist {
+		if err := updated.Save(""); err != nil {
+			entry.Outcome, entry.Error = "failed", err.Error()
+			s.writeError(w, fmt.Sprintf("Failed to save configuration: %v", err), http.StatusBadRequest)
+			return
+		}
+		message = "Configuration updated and saved to " + updated.FilePath()
+		s.cfgNotice = ""
+	}
+	s.cfg = &updated
 
-	s.log.Info("Configuration updated via web interface")
+	s.log.Infof("Configuration updated via web interface by %s", identity(r))
+	entry.Outcome = "applied"
 
 	s.writeJSON(w, APIResponse{
 		Success: true,
-		Message: "Configuration updated successfully",
+		Message: message,
+	})
+}
+
+// handleSaveConfig saves the current configuration to the config file.
+func (s *Server) handleSaveConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := *s.currentConfig() // Save normalizes the config it validates
+	entry := AuditEntry{Action: "config_save", Params: map[string]any{"path": cfg.FilePath()}}
+	if err := cfg.Save(""); err != nil {
+		entry.Outcome, entry.Error = "failed", err.Error()
+		s.audit(r, entry)
+		s.writeError(w, fmt.Sprintf("Failed to save configuration: %v", err), http.StatusBadRequest)
+		return
+	}
+	s.SetConfigNotice("")
+	s.log.Infof("Configuration saved to %s via web interface by %s", cfg.FilePath(), identity(r))
+	entry.Outcome = "saved"
+	s.audit(r, entry)
+
+	s.writeJSON(w, APIResponse{
+		Success: true,
+		Message: "Configuration saved to " + cfg.FilePath(),
 	})
 }
 
@@ -472,227 +1004,232 @@ func (s *Server) handleGetDateFormats(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleWebSocket upgrades the connection and manages WebSocket clients.
-// handleWebSocket handles WebSocket connections.
-func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	upgrader := s.wsUpgrader
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		s.log.Warnf("WebSocket upgrade failed: %v", err)
-		return
-	}
+// runScanAsync performs the scan of job with cfg, a dry run whose planned
+// operations reach the clients as log messages.
+func (s *Server) runScanAsync(ctx context.Context, job *Job, cfg config.Config) {
+	s.broadcastWSMessage("scan_started", map[string]any{
+		"job_id":    job.ID,
+		"directory": cfg.SourceDirectory,
+		"options":   cfg.RunOptions(),
+	})
 
-	s.wsMutex.Lock()
-	s.wsClients[conn] = true
-	s.wsMutex.Unlock()
+	org := organizer.NewFileOrganizer(&cfg, s.log, job.stats, s.dateExtractor, s.compressor)
 
-	defer func() {
-		s.wsMutex.Lock()
-		delete(s.wsClients, conn)
-		s.wsMutex.Unlock()
-		conn.Close()
-	}()
+	s.broadcastProgress(org, job)
+	finishReport := s.startReport(org, &cfg, job)
+	stopStats := s.streamStats(org, job)
+	err := org.OrganizeFiles(ctx)
+	stopStats()
+	finishReport()
+	s.finishJob(job, &cfg, err)
 
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			break
-		}
+	if errors.Is(err, context.Canceled) {
+		return // stopJob has already reported it
 	}
-}
-
-// broadcastWSLog отправляет лог-сообщение всем WS-клиентам
-func (s *Server) broadcastWSLog(level, message string) {
-	s.wsMutex.Lock()
-	defer s.wsMutex.Unlock()
-	for client := range s.wsClients {
-		_ = client.WriteJSON(WSMessage{
-			Type: "log",
-			Data: map[string]any{
-				"level":     level,
-				"message":   message,
-				"timestamp": time.Now().Format("2006-01-02 15:04:05"),
-			},
+	if err != nil {
+		s.broadcastWSMessage("scan_error", map[string]any{
+			"job_id": job.ID,
+			"error":  err.Error(),
+		})
+	} else {
+		s.broadcastWSMessage("scan_completed", map[string]any{
+			"job_id":     job.ID,
+			"statistics": job.stats.GetSummary(),
 		})
 	}
 }
 
-// runScanAsyncWithLogs запускает сканирование с пробросом логов в WebSocket
-func (s *Server) runScanAsyncWithLogs(directory string) {
-	go func() {
-		s.operationMutex.Lock()
-		s.isRunning = true
-		s.operationMutex.Unlock()
-
-		s.broadcastWSMessage("scan_started", map[string]any{
-			"directory": directory,
-		})
-
-		defer func() {
-			s.operationMutex.Lock()
-			s.isRunning = false
-			s.operationMutex.Unlock()
-		}()
-
-		cfg := *s.cfg // Копия!
-		cfg.SourceDirectory = directory
-		cfg.Security.DryRun = true
-
-		log := s.log
-		stats := statistics.NewStatistics()
-		dateExtractor := extractor.NewEXIFExtractor(log)
-		compressor := compressor.NewDefaultCompressor()
-
-		// Создаём organizer с хуком для логов
-		org := organizer.NewFileOrganizerWithLogHook(&cfg, log, stats, dateExtractor, compressor, func(level, message string) {
-			// Только dry-run логи (DRY-RUN: ...) пробрасываем в WebSocket
-			if strings.Contains(message, "DRY-RUN") {
-				s.broadcastWSLog(level, message)
-			}
-		})
+// runOrganizeAsync performs the organize operation of job with cfg.
+func (s *Server) runOrganizeAsync(ctx context.Context, job *Job, cfg config.Config) {
+	s.broadcastWSMessage("organize_started", map[string]any{
+		"job_id":           job.ID,
+		"source_directory": cfg.SourceDirectory,
+		"target_directory": cfg.GetTargetDirectory(),
+		"dry_run":          cfg.Security.DryRun,
+		"options":          cfg.RunOptions(),
+	})
 
-		err := org.OrganizeFiles()
-		if err != nil {
-			s.broadcastWSMessage("scan_error", map[string]any{
-				"error": err.Error(),
-			})
-			return
-		}
+	org := organizer.NewFileOrganizer(&cfg, s.log, job.stats, s.dateExtractor, s.compressor)
 
-		s.currentStats = stats
+	s.broadcastProgress(org, job)
+	finishReport := s.startReport(org, &cfg, job)
+	stopStats := s.streamStats(org, job)
+	err := org.OrganizeFiles(ctx)
+	stopStats()
+	finishReport()
+	s.finishJob(job, &cfg, err)
 
-		s.broadcastWSMessage("scan_completed", map[string]any{
-			"statistics": stats.GetSummary(),
+	if errors.Is(err, context.Canceled) {
+		return // stopJob has already reported it
+	}
+	if err != nil {
+		s.broadcastWSMessage("organize_error", map[string]any{
+			"job_id": job.ID,
+			"error":  err.Error(),
 		})
-	}()
+	} else {
+		s.broadcastWSMessage("organize_completed", map[string]any{
+			"job_id":     job.ID,
+			"statistics": job.stats.GetSummary(),
+		})
+	}
 }
 
-// runScanAsync performs a scan operation in a separate goroutine.
-func (s *Server) runScanAsync(directory string) {
-	s.operationMutex.Lock()
-	s.isRunning = true
-	s.currentStats = statistics.NewStatistics()
-	s.operationMutex.Unlock()
-
-	s.broadcastWSMessage("scan_started", map[string]any{
-		"directory": directory,
-	})
-
-	cfg := *s.cfg
-	cfg.SourceDirectory = directory
-	cfg.Security.DryRun = true
-
-	dateExtractor := extractor.NewEXIFExtractor(s.log)
-
-	// Прокидываем хук для логов (DRY-RUN и др.) в органайзер
-	org := organizer.NewFileOrganizerWithLogHook(&cfg, s.log, s.currentStats, dateExtractor, s.compressor, func(level, message string) {
-		// Пробрасываем только интересные логи (DRY-RUN, Would move/copy)
-		if strings.Contains(message, "DRY-RUN") || strings.Contains(message, "Would move") || strings.Contains(message, "Would copy") {
-			s.broadcastWSMessage("log", map[string]any{
-				"level":     level,
-				"message":   message,
-				"timestamp": time.Now().Format("2006-01-02 15:04:05"),
-			})
-		}
+// runApplyAsync executes the plan of job until ctx is cancelled.
+func (s *Server) runApplyAsync(ctx context.Context, job *Job, req ApplyRequest) {
+	s.broadcastWSMessage("apply_started", map[string]any{
+		"job_id":  job.ID,
+		"entries": len(req.Entries),
 	})
 
-	err := org.OrganizeFiles()
+	cfg := *s.currentConfig()
+	if req.TargetDirectory != "" {
+		cfg.TargetDirectory = &req.TargetDirectory
+	}
 
-	s.operationMutex.Lock()
-	s.isRunning = false
-	s.operationMutex.Unlock()
+	org := organizer.NewFileOrganizer(&cfg, s.log, job.stats, s.dateExtractor, s.compressor)
+	stopStats := s.streamStats(org, job)
+	err := org.ApplyPlan(ctx, req.Entries)
+	stopStats()
+	s.finishJob(job, &cfg, err)
 
+	if errors.Is(err, context.Canceled) {
+		return // stopJob has already reported it
+	}
 	if err != nil {
-		s.broadcastWSMessage("scan_error", map[string]any{
-			"error": err.Error(),
+		s.broadcastWSMessage("apply_error", map[string]any{
+			"job_id": job.ID,
+			"error":  err.Error(),
 		})
 	} else {
-		s.broadcastWSMessage("scan_completed", map[string]any{
-			"statistics": s.currentStats.GetSummary(),
+		s.broadcastWSMessage("apply_completed", map[string]any{
+			"job_id":     job.ID,
+			"statistics": job.stats.GetSummary(),
+			"plan_drift": atomic.LoadInt64(&job.stats.PlanDrift),
+			"errors":     job.stats.GetErrorSummary(),
 		})
 	}
 }
 
-// runOrganizeAsync performs an organize operation in a separate goroutine.
-func (s *Server) runOrganizeAsync(req OrganizeRequest) {
-	s.operationMutex.Lock()
-	s.isRunning = true
-	s.currentStats = statistics.NewStatistics()
-	s.operationMutex.Unlock()
-
-	s.broadcastWSMessage("organize_started", map[string]any{
-		"source_directory": req.SourceDirectory,
-		"target_directory": req.TargetDirectory,
-		"dry_run":          req.DryRun,
-	})
-
-	cfg := *s.cfg
-	cfg.SourceDirectory = req.SourceDirectory
+// requestConfig returns a copy of the server configuration with the request's
+// overrides applied. The request's source directories replace the configured
+// ones; the sources entries among them keep their settings.
+func (s *Server) requestConfig(req OrganizeRequest) (config.Config, error) {
+	cfg, err := s.profileConfig(req.Profile)
+	if err != nil {
+		return config.Config{}, err
+	}
+	cfg.SetSourceDirectories(append([]string{req.SourceDirectory}, req.SourceDirectories...))
 	if req.TargetDirectory != "" {
 		cfg.TargetDirectory = &req.TargetDirectory
 	}
 	cfg.Security.DryRun = req.DryRun
-
 	if req.DateFormat != "" {
 		cfg.DateFormat = req.DateFormat
 	}
+	if len(req.DuplicateHandling) > 0 {
+		cfg.Processing.DuplicateHandling = req.DuplicateHandling
+	}
 	if req.MoveFiles != nil {
 		cfg.Processing.MoveFiles = *req.MoveFiles
 	}
-
-	if req.DateFormat != "" {
-		cfg.DateFormat = req.DateFormat
+	if req.MaxFiles > 0 {
+		cfg.Security.MaxFilesPerRun = req.MaxFiles
 	}
-	if req.MoveFiles != nil {
-		cfg.Processing.MoveFiles = *req.MoveFiles
+	if len(req.ExcludePatterns) > 0 {
+		cfg.Processing.ExcludePatterns = append(slices.Clip(cfg.Processing.ExcludePatterns), req.ExcludePatterns...)
 	}
+	if req.MinFileSize != "" {
+		cfg.Processing.MinFileSize = req.MinFileSize
+	}
+	return cfg, nil
+}
 
-	dateExtractor := extractor.NewEXIFExtractor(s.log)
-	org := organizer.NewFileOrganizer(&cfg, s.log, s.currentStats, dateExtractor, s.compressor)
-
-	err := org.OrganizeFiles()
-
-	s.operationMutex.Lock()
-	s.isRunning = false
-	s.operationMutex.Unlock()
+// profileConfig returns a copy of the server configuration with the named
+// profile laid over it, or of the configuration itself if name is empty.
+func (s *Server) profileConfig(name string) (config.Config, error) {
+	cfg := s.currentConfig()
+	if name != "" {
+		merged, err := cfg.WithProfile(name)
+		if err != nil {
+			return config.Config{}, err
+		}
+		cfg = merged
+	}
+	return *cfg, nil
+}
 
+// runConfig returns the validated config of req, or writes a bad request
+// response and returns false if its options are invalid.
+func (s *Server) runConfig(w http.ResponseWriter, req OrganizeRequest) (config.Config, bool) {
+	if req.MaxFiles < 0 {
+		s.writeError(w, "Invalid options: max_files must not be negative", http.StatusBadRequest)
+		return config.Config{}, false
+	}
+	cfg, err := s.requestConfig(req)
+	if err == nil {
+		err = cfg.Validate()
+	}
 	if err != nil {
-		s.broadcastWSMessage("organize_error", map[string]any{
-			"error": err.Error(),
-		})
-	} else {
-		s.broadcastWSMessage("organize_completed", map[string]any{
-			"statistics": s.currentStats.GetSummary(),
-		})
+		s.writeError(w, fmt.Sprintf("Invalid options: %v", err), http.StatusBadRequest)
+		return cfg, false
 	}
+	return cfg, true
 }
 
-// broadcastWSMessage sends a message to all connected WebSocket clients.
-func (s *Server) broadcastWSMessage(messageType string, data any) {
-	message := WSMessage{
-		Type: messageType,
-		Data: data,
-	}
+// broadcastProgress makes org send a progress message for job to the
+// WebSocket clients after each batch of files.
+func (s *Server) broadcastProgress(org *organizer.FileOrganizer, job *Job) {
+	org.SetProgressHook(func(progress organizer.BatchProgress) {
+		s.broadcastWSMessage("progress", map[string]any{
+			"job_id":    job.ID,
+			"batch":     progress.Batch,
+			"processed": progress.Processed,
+			"found":     progress.Found,
+		})
+	})
+}
 
-	msgBytes, err := json.Marshal(message)
+// startReport makes org write a report of job to a new temporary file and
+// returns a function that completes it and makes it the one served by
+// /api/report and /api/jobs/{id}/files.
+func (s *Server) startReport(org *organizer.FileOrganizer, cfg *config.Config, job *Job) func() {
+	f, err := os.CreateTemp("", "photo-sorter-report-*.json")
 	if err != nil {
-		s.log.Errorf("Failed to marshal WebSocket message: %v", err)
-		return
+		s.log.Warnf("Could not create report file: %v", err)
+		return func() {}
 	}
+	w := bufio.NewWriter(f)
+	rep, err := organizer.NewReport(w, organizer.ReportFormatJSON, cfg)
+	if err != nil {
+		s.log.Warnf("Could not start report: %v", err)
+		f.Close()
+		os.Remove(f.Name())
+		return func() {}
+	}
+	org.SetReport(rep)
 
-	s.wsMutex.Lock()
-	defer s.wsMutex.Unlock()
-
-	for conn := range s.wsClients {
-		err := conn.WriteMessage(websocket.TextMessage, msgBytes)
+	return func() {
+		err := rep.Close()
+		if err == nil {
+			err = w.Flush()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
 		if err != nil {
-			s.log.Errorf("Failed to write WebSocket message: %v", err)
-			go func(c *websocket.Conn) {
-				s.wsMutex.Lock()
-				delete(s.wsClients, c)
-				s.wsMutex.Unlock()
-				c.Close()
-			}(conn)
+			s.log.Warnf("Could not write report: %v", err)
+			os.Remove(f.Name())
+			return
+		}
+
+		s.reportMutex.Lock()
+		previous := s.reportPath
+		s.reportPath = f.Name()
+		s.reportJob = job.ID
+		s.reportMutex.Unlock()
+		if previous != "" {
+			os.Remove(previous)
 		}
 	}
 }
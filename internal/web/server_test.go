@@ -0,0 +1,145 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentScanAndStatus(t *testing.T) {
+	cfg, dirs := newTestConfig(t)
+	for i := 0; i < 20; i++ {
+		writeTestFile(t, filepath.Join(dirs.Source, fmt.Sprintf("dir%d/IMG_%04d.jpg", i%4, i)), []byte("photo"))
+	}
+	s, ts := newTestServer(t, cfg)
+
+	// A scan is started while another one may be running, so it either
+	// starts or is refused; status requests always succeed.
+	const requests = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var started []string
+	for i := 0; i < requests; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			body := strings.NewReader(fmt.Sprintf(`{"directory": %q}`, dirs.Source))
+			resp, err := ts.Client().Post(ts.URL+"/api/scan", "application/json", body)
+			if err != nil {
+				t.Errorf("POST /api/scan: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			var decoded APIResponse
+			if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+				t.Errorf("POST /api/scan: %v", err)
+				return
+			}
+			switch resp.StatusCode {
+			case http.StatusOK:
+				mu.Lock()
+				started = append(started, decoded.Data.(map[string]any)["job_id"].(string))
+				mu.Unlock()
+			case http.StatusConflict:
+			default:
+				t.Errorf("POST /api/scan = %d: %s", resp.StatusCode, decoded.Error)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			resp, err := ts.Client().Get(ts.URL + "/api/status")
+			if err != nil {
+				t.Errorf("GET /api/status: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			var decoded APIResponse
+			if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil || resp.StatusCode != http.StatusOK || !decoded.Success {
+				t.Errorf("GET /api/status = %d, %v: %s", resp.StatusCode, err, decoded.Error)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(started) == 0 {
+		t.Fatal("no scan started")
+	}
+	for _, id := range started {
+		if state := waitForJob(t, s, id); state != JobCompleted {
+			t.Errorf("scan %s ended %s, want completed", id, state)
+		}
+	}
+	status, resp := doJSON(t, ts, "GET", "/api/status", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /api/status = %d: %s", status, resp.Error)
+	}
+	files := resp.Data.(map[string]any)["statistics"].(map[string]any)["files"].(map[string]any)
+	if found := files["total_found"]; found != float64(20) {
+		t.Errorf("last scan found %v files, want 20", found)
+	}
+}
+
+func TestRunRequestValidation(t *testing.T) {
+	cfg, dirs := newTestConfig(t)
+	tests := []struct {
+		name       string
+		options    map[string]any
+		wantStatus int
+		wantError  string // in the error of a rejected request
+	}{
+		{name: "bad glob", options: map[string]any{"exclude_patterns": []string{"*.tmp", "trip/[a-"}}, wantStatus: http.StatusBadRequest, wantError: "trip/[a-"},
+		{name: "negative max files", options: map[string]any{"max_files": -1}, wantStatus: http.StatusBadRequest, wantError: "max_files"},
+		{name: "bad min file size", options: map[string]any{"min_file_size": "ten"}, wantStatus: http.StatusBadRequest, wantError: "ten"},
+		{name: "valid", options: map[string]any{"max_files": 1, "exclude_patterns": []string{"skip/*"}, "min_file_size": "1B"}, wantStatus: http.StatusOK},
+	}
+	for _, path := range []string{"/api/scan", "/api/organize"} {
+		for _, tt := range tests {
+			t.Run(strings.TrimPrefix(path, "/api/")+"/"+tt.name, func(t *testing.T) {
+				s, ts := newTestServer(t, cfg)
+				req := map[string]any{"dry_run": true}
+				if path == "/api/scan" {
+					req["directory"] = dirs.Source
+				} else {
+					req["source_directory"] = dirs.Source
+				}
+				for key, value := range tt.options {
+					req[key] = value
+				}
+
+				status, resp := doJSON(t, ts, "POST", path, req)
+				if status != tt.wantStatus {
+					t.Fatalf("status = %d, want %d: %s", status, tt.wantStatus, resp.Error)
+				}
+				if tt.wantStatus != http.StatusOK {
+					if !strings.Contains(resp.Error, tt.wantError) {
+						t.Errorf("error %q does not mention %q", resp.Error, tt.wantError)
+					}
+					if jobs := s.jobs.list(); len(jobs) != 0 {
+						t.Errorf("a rejected request started %d jobs", len(jobs))
+					}
+					return
+				}
+
+				id, _ := resp.Data.(map[string]any)["job_id"].(string)
+				waitForJob(t, s, id)
+				status, resp = doJSON(t, ts, "GET", "/api/jobs/"+id, nil)
+				if status != http.StatusOK {
+					t.Fatalf("GET job = %d: %s", status, resp.Error)
+				}
+				params, _ := resp.Data.(map[string]any)["params"].(map[string]any)
+				for key, want := range map[string]any{"max_files": float64(1), "min_file_size": "1B"} {
+					if params[key] != want {
+						t.Errorf("job params %s = %v, want %v", key, params[key], want)
+					}
+				}
+				if patterns, _ := params["exclude_patterns"].([]any); len(patterns) != 1 || patterns[0] != "skip/*" {
+					t.Errorf("job params exclude_patterns = %v, want [skip/*]", params["exclude_patterns"])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"photo-sorter-go/internal/compressor"
+	"photo-sorter-go/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testDirs are the directories of a test server: its home, source and target
+// directories, with symlinks resolved as browse roots are.
+type testDirs struct {
+	Home   string
+	Source string
+	Target string
+}
+
+// newTestConfig returns the default configuration with a source and a target
+// directory of their own, and the run history, the audit log and the home
+// directory moved into the test's temporary directory.
+func newTestConfig(t testing.TB) (*config.Config, testDirs) {
+	t.Helper()
+	root := t.TempDir()
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	dirs := testDirs{
+		Home:   filepath.Join(root, "home"),
+		Source: filepath.Join(root, "src"),
+		Target: filepath.Join(root, "target"),
+	}
+	for _, dir := range []string{dirs.Home, dirs.Source, dirs.Target} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", dirs.Home)
+	t.Setenv("USERPROFILE", dirs.Home)
+
+	cfg := config.DefaultConfig()
+	cfg.SourceDirectory = dirs.Source
+	target := dirs.Target
+	cfg.TargetDirectory = &target
+	cfg.Compressor.Enabled = false
+	cfg.Processing.SettleTime = 0
+	cfg.Security.CheckDiskSpace = false
+	cfg.History.Directory = filepath.Join(root, "history")
+	cfg.Web.AuditLog = filepath.Join(root, "audit.jsonl")
+	cfg.Logging.FilePath = filepath.Join(root, "photo-sorter.log")
+	return cfg, dirs
+}
+
+// newTestServer returns a server for cfg, logging nothing, and an HTTP
+// server serving it. Both are stopped when the test ends, after the running
+// job has finished.
+func newTestServer(t testing.TB, cfg *config.Config) (*Server, *httptest.Server) {
+	t.Helper()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	s := NewServer(cfg, log, compressor.NewDefaultCompressor())
+	ts := httptest.NewServer(s.router)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.Stop(ctx); err != nil {
+			t.Errorf("stop server: %v", err)
+		}
+		ts.Close()
+	})
+	return s, ts
+}
+
+// doJSON sends body, encoded as JSON unless nil, to path on ts and returns
+// the status code and the decoded response.
+func doJSON(t testing.TB, ts *httptest.Server, method, path string, body any) (int, APIResponse) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	var decoded APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("%s %s: decode response: %v", method, path, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+// waitForJob waits until the job with id has finished and returns its state.
+func waitForJob(t testing.TB, s *Server, id string) string {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := s.jobs.get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.FinishedAt != nil {
+			return job.State
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return ""
+}
+
+// writeTestFile writes data at path, creating its directory, and dates it an
+// hour ago so that it is not taken for a file still being written.
+func writeTestFile(t testing.TB, path string, data []byte) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
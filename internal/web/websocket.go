@@ -0,0 +1,101 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSClientMessage is a message from a WebSocket client. A "subscribe" message
+// chooses the least severe log messages the client gets, e.g. "warning";
+// "info" by default.
+type WSClientMessage struct {
+	Type     string `json:"type"`
+	LogLevel string `json:"log_level,omitempty"`
+}
+
+const (
+	// wsWriteWait is how long a single write to a client may take.
+	wsWriteWait = 10 * time.Second
+
+	// wsPongWait is how long a client may stay silent, pongs included,
+	// before its connection is considered dead.
+	wsPongWait = 60 * time.Second
+
+	// wsPingPeriod is how often clients are pinged; less than wsPongWait.
+	wsPingPeriod = wsPongWait * 9 / 10
+)
+
+// handleWebSocket upgrades the connection and serves the client until it
+// disconnects, stops answering pings or falls too far behind.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log.Warnf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	s.wsClients.Add(1)
+	defer s.wsClients.Add(-1)
+	sub, _ := s.events.subscribe("WebSocket client "+conn.RemoteAddr().String(), false, 0)
+	go s.writeWS(conn, sub)
+	defer s.events.unsubscribe(sub)
+
+	conn.SetReadLimit(4096) // clients send nothing but pongs and subscriptions
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var msg WSClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				continue
+			}
+			return
+		}
+		if msg.Type == "subscribe" && msg.LogLevel != "" && !sub.setLogLevel(msg.LogLevel) {
+			s.log.Debugf("WebSocket client %s asked for unknown log level %q", conn.RemoteAddr(), msg.LogLevel)
+		}
+	}
+}
+
+// writeWS writes the events of sub to conn, and pings, until sub is removed
+// or a write fails; then it closes conn.
+func (s *Server) writeWS(conn *websocket.Conn, sub *subscriber) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case ev, ok := <-sub.events:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				message := []byte{}
+				if sub.shutdown.Load() {
+					message = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				}
+				_ = conn.WriteMessage(websocket.CloseMessage, message)
+				return
+			}
+			if !sub.wants(ev) {
+				continue
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, ev.data); err != nil {
+				s.log.Debugf("Failed to write WebSocket message: %v", err)
+				s.events.unsubscribe(sub)
+				return
+			}
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				s.events.unsubscribe(sub)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWS connects a WebSocket client to the server at url and closes it when
+// the test ends.
+func dialWS(t testing.TB, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial WebSocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// subscriberCount returns the number of clients subscribed to p.
+func (p *publisher) subscriberCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.subscribers)
+}
+
+func TestSlowWebSocketClientDoesNotBlockOthers(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	s, ts := newTestServer(t, cfg)
+	// The slow client never reads, so once the socket buffers are full its
+	// writer is stuck and its queue overflows.
+	dialWS(t, ts.URL)
+	fast := dialWS(t, ts.URL)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.events.subscriberCount() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("clients did not subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Enough to fill the slow client's socket buffers and then its queue.
+	// Each message is sent once the fast client has the previous one, so
+	// that only the slow client falls behind.
+	const messages = 4 * subscriberQueue
+	blob := strings.Repeat("x", 32<<10)
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		for {
+			_ = fast.SetReadDeadline(time.Now().Add(10 * time.Second))
+			var msg WSMessage
+			if err := fast.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Type == "test" {
+				received <- struct{}{}
+			}
+		}
+	}()
+
+	for i := 0; i < messages; i++ {
+		s.broadcastWSMessage("test", map[string]any{"i": i, "blob": blob})
+		select {
+		case _, ok := <-received:
+			if !ok {
+				t.Fatalf("fast client stopped after %d of %d messages", i, messages)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast client got %d of %d messages, then was held up", i, messages)
+		}
+	}
+	if n := s.events.subscriberCount(); n != 1 {
+		t.Errorf("%d clients subscribed, want the slow one dropped", n)
+	}
+}
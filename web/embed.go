@@ -0,0 +1,10 @@
+// Package web holds the assets of the web interface: the page template in
+// templates/ and the scripts and styles in static/.
+package web
+
+import "embed"
+
+// Assets are the web interface assets, built into the binary.
+//
+//go:embed templates static
+var Assets embed.FS
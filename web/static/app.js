@@ -11,7 +11,12 @@ class PhotoSorterApp {
     this.maxReconnectAttempts = 5;
     this.reconnectInterval = 3000;
     this._compressionPollInterval = null;
+    this.authToken = localStorage.getItem("photoSorterToken") || "";
+    this.logLevel = localStorage.getItem("photoSorterLogLevel") || "info";
+    this.duplicatePolicy = {}; // duplicate_handling by file category, from the config
 
+    this.bindLoginForm();
+    this.bindLogLevel();
     this.initializeWebSocket();
     this.bindEvents();
     this.startStatusPolling();
@@ -23,7 +28,11 @@ class PhotoSorterApp {
    */
   initializeWebSocket() {
     const protocol = window.location.protocol === "https:" ? "wss:" : "ws:";
-    const wsUrl = `${protocol}//${window.location.host}/ws`;
+    let wsUrl = `${protocol}//${window.location.host}/ws`;
+    if (this.authToken) {
+      // Browsers cannot set headers on WebSocket connections
+      wsUrl += `?token=${encodeURIComponent(this.authToken)}`;
+    }
 
     try {
       this.ws = new WebSocket(wsUrl);
@@ -38,11 +47,15 @@ class PhotoSorterApp {
    * Set up WebSocket event handlers
    */
   setupWebSocketHandlers() {
+    let opened = false;
     this.ws.onopen = () => {
+      opened = true;
       this.isConnected = true;
       this.reconnectAttempts = 0;
       this.log("Connected to server", "info");
       this.updateConnectionStatus(true);
+      this.subscribeLogs();
+      this.catchUpJobEvents();
     };
 
     this.ws.onmessage = (event) => {
@@ -58,6 +71,13 @@ class PhotoSorterApp {
       this.isConnected = false;
       this.updateConnectionStatus(false);
 
+      if (!opened && typeof EventSource !== "undefined") {
+        // Some proxies and networks break WebSockets; server-sent events
+        // carry the same messages over plain HTTP.
+        this.log("WebSocket unavailable, falling back to server-sent events", "warning");
+        this.initializeEventSource();
+        return;
+      }
       if (event.wasClean) {
         this.log("Connection closed cleanly", "info");
       } else {
@@ -73,6 +93,64 @@ class PhotoSorterApp {
     };
   }
 
+  /**
+   * Receive the server's messages as server-sent events. EventSource
+   * reconnects by itself and resumes after the last event it received.
+   */
+  initializeEventSource() {
+    let url = `/api/events?log_level=${encodeURIComponent(this.logLevel)}`;
+    if (this.authToken) {
+      // EventSource cannot set headers either
+      url += `&token=${encodeURIComponent(this.authToken)}`;
+    }
+
+    this.eventSource = new EventSource(url);
+    this.eventSource.onopen = () => {
+      this.isConnected = true;
+      this.log("Connected to server (server-sent events)", "info");
+      this.updateConnectionStatus(true);
+    };
+    this.eventSource.onmessage = (event) => {
+      try {
+        this.handleWebSocketMessage(JSON.parse(event.data));
+      } catch (error) {
+        this.log("Failed to parse server event: " + error.message, "error");
+      }
+    };
+    this.eventSource.onerror = () => {
+      this.isConnected = false;
+      this.updateConnectionStatus(false);
+    };
+  }
+
+  /**
+   * Let the user choose the least severe log messages the server sends
+   */
+  bindLogLevel() {
+    const select = document.getElementById("logLevelSelect");
+    if (!select) return;
+    select.value = this.logLevel;
+    select.addEventListener("change", () => {
+      this.logLevel = select.value;
+      localStorage.setItem("photoSorterLogLevel", this.logLevel);
+      if (this.eventSource) {
+        this.eventSource.close();
+        this.initializeEventSource();
+      } else {
+        this.subscribeLogs();
+      }
+    });
+  }
+
+  /**
+   * Tell the server over the WebSocket which log messages to send
+   */
+  subscribeLogs() {
+    if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+      this.ws.send(JSON.stringify({ type: "subscribe", log_level: this.logLevel }));
+    }
+  }
+
   /**
    * Schedule a reconnection attempt
    */
@@ -129,9 +207,13 @@ class PhotoSorterApp {
       this.stopCompressionPollingAndStatus();
       this.startCompression();
     });
+    this.bindButton("stopCompressionBtn", () => this.stopCompression());
 
     this.bindInput("sourceDir", (value) => this.validateSourceDirectory(value));
     this.bindInput("targetDir", (value) => this.validateTargetDirectory(value));
+    for (const id of ["sourceDir", "extraSourceDirs", "targetDir"]) {
+      document.getElementById(id)?.addEventListener("change", () => this.loadOverview());
+    }
 
     this.bindSelect("dateFormat", () => this.updateConfigDisplay());
     this.bindSelect("duplicateHandling", () => this.updateConfigDisplay());
@@ -140,6 +222,9 @@ class PhotoSorterApp {
 
     this.bindCheckbox("compressionEnabled", () => this.updateConfigDisplay());
     this.bindKeyboardShortcuts();
+    document.getElementById("auditDetails")?.addEventListener("toggle", (event) => {
+      if (event.target.open) this.loadAudit();
+    });
 
     window.addEventListener("beforeunload", () => this.cleanup());
     window.addEventListener("focus", () => this.updateStatus());
@@ -282,21 +367,61 @@ class PhotoSorterApp {
     this.updateElement("scanBtn", null, { disabled: running });
     this.updateElement("organizeBtn", null, { disabled: running });
     this.toggleElement("stopBtn", running);
+    if (!running) {
+      this.updateElement("currentFile", "");
+    }
 
     if (statistics && statistics.files) {
-      const { files } = statistics;
-      this.updateElement("filesFound", files.total_found || 0);
-      this.updateElement("filesProcessed", files.total_processed || 0);
-      this.updateElement("filesOrganized", files.organized || 0);
-      this.updateElement("filesMoved", files.moved || 0);
-      this.updateElement("filesSkipped", files.skipped || 0);
-      this.updateElement("errorsCount", files.errors || 0);
-      this.updateElement("filesCopied", files.copied || 0);
+      this.updateFileCounters(statistics.files);
+    }
 
+    // Set when a copy run checked the target's free space before starting.
+    if (statistics && statistics.space && statistics.space.required > 0) {
+      const { space } = statistics;
+      this.updateElement(
+        "spaceCheck",
+        `Disk space: ${this.formatSize(space.required)} needed, ${this.formatSize(space.available)} available`,
+      );
+    } else {
+      this.updateElement("spaceCheck", "");
+    }
+  }
+
+  /**
+   * Update the file counters and progress bar
+   */
+  updateFileCounters(files) {
+    this.updateElement("filesFound", files.total_found || 0);
+    this.updateElement("filesProcessed", files.total_processed || 0);
+    this.updateElement("filesOrganized", files.organized || 0);
+    this.updateElement("filesMoved", files.moved || 0);
+    this.updateElement("filesSkipped", files.skipped || 0);
+    this.updateElement("errorsCount", files.errors || 0);
+    this.updateElement("filesCopied", files.copied || 0);
+
+    // Files are processed while discovery is still running, so the total is
+    // only known (and a percentage meaningful) once discovery has finished.
+    if (files.discovery_done) {
       const progress =
         files.total_found > 0 ? (files.total_processed / files.total_found) * 100 : 0;
       this.updateProgressBar(progress);
+    } else {
+      this.updateElement("filesFound", `${files.total_found || 0}+`);
+    }
+  }
+
+  /**
+   * Update the counters, rate, ETA and current file from a stats_update message
+   */
+  updateLiveStats(data) {
+    this.updateFileCounters(data.files);
+    let status = `Running... ${data.files_per_second.toFixed(1)} files/s`;
+    if (typeof data.eta_seconds === "number") {
+      const eta = Math.round(data.eta_seconds);
+      status += `, ETA ${Math.floor(eta / 60)}m ${eta % 60}s`;
     }
+    this.updateElement("operationStatus", status);
+    this.updateElement("currentFile", data.current_file ? `Processing: ${data.current_file}` : "");
   }
 
   /**
@@ -325,7 +450,15 @@ class PhotoSorterApp {
       const response = await this.fetchWithTimeout("/api/scan", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ directory: sourceDir }),
+        body: JSON.stringify({
+          directory: sourceDir,
+          directories: this.getExtraSources(),
+          ...this.getRunLimits(),
+          target_directory: this.getInputValue("targetDir") || null,
+          date_format: this.getSelectValue("dateFormat"),
+          duplicate_handling: this.getDuplicatePolicy(),
+          move_files: this.getCheckboxValue("moveFilesCheck"),
+        }),
       });
       const data = await response.json();
       if (data.success) {
@@ -363,8 +496,9 @@ class PhotoSorterApp {
     }
 
     // Always ask for confirmation before organizing (since dry-run checkbox is removed)
+    const sources = [sourceDir, ...this.getExtraSources()].join(", ");
     const confirmed = confirm(
-      `Are you sure you want to organize photos?\nSource: ${sourceDir}\nTarget: ${targetDir || "In place"}\n\nThis will move/modify your files!`,
+      `Are you sure you want to organize photos?\nSource: ${sources}\nTarget: ${targetDir || "In place"}\n\nThis will move/modify your files!`,
     );
     if (!confirmed) {
       return;
@@ -374,19 +508,32 @@ class PhotoSorterApp {
       const dateFormat = this.getSelectValue("dateFormat");
       const moveFiles = this.getCheckboxValue("moveFilesCheck");
 
-      const response = await this.fetchWithTimeout("/api/organize", {
+      const request = {
+        source_directory: sourceDir,
+        source_directories: this.getExtraSources(),
+        ...this.getRunLimits(),
+        target_directory: targetDir || null,
+        dry_run: false,
+        date_format: dateFormat,
+        duplicate_handling: this.getDuplicatePolicy(),
+        move_files: moveFiles,
+      };
+      let response = await this.fetchWithTimeout("/api/organize", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({
-          source_directory: sourceDir,
-          target_directory: targetDir || null,
-          dry_run: false,
-          date_format: dateFormat,
-          move_files: moveFiles,
-        }),
+        body: JSON.stringify(request),
       });
-
-      const data = await response.json();
+      let data = await response.json();
+
+      // 507: the media files do not fit on the target; the user may go ahead.
+      if (response.status === 507 && confirm(`${data.error}\n\nStart anyway?`)) {
+        response = await this.fetchWithTimeout("/api/organize", {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ ...request, force: true }),
+        });
+        data = await response.json();
+      }
       if (data.success) {
         // Organization started successfully
       } else {
@@ -436,23 +583,28 @@ class PhotoSorterApp {
       .value.split(",")
       .map((f) => f.trim())
       .filter(Boolean);
+    const stripMetadata = document.getElementById("compressionStripMetadata").value;
+    const dryRun = document.getElementById("compressionDryRun").checked;
 
     this.updateElement("compressionStatus", "Starting compression...");
     this.updateElement("compressionResults", "");
 
     try {
-      const response = await fetch("/api/compress", {
+      const response = await this.apiFetch("/api/compress", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({
           quality,
           threshold,
           formats,
+          dry_run: dryRun,
+          strip_metadata: stripMetadata || undefined,
         }),
       });
       const data = await response.json();
       if (data.success) {
         this.updateElement("compressionStatus", "Compression started...");
+        this.toggleElement("stopCompressionBtn", true);
         this.pollCompressionStatus();
       } else {
         this.updateElement(
@@ -465,6 +617,22 @@ class PhotoSorterApp {
     }
   }
 
+  /**
+   * Stop the running compression; finished files are kept
+   */
+  async stopCompression() {
+    try {
+      const response = await this.fetchWithTimeout("/api/compress/stop", { method: "POST" });
+      const data = await response.json();
+      if (!data.success) {
+        throw new Error(data.error || "Failed to stop compression");
+      }
+      this.updateElement("compressionStatus", "Stopping compression...");
+    } catch (error) {
+      this.showAlert(`Failed to stop compression: ${error.message}`, "error");
+    }
+  }
+
   /**
    * Poll compression status periodically
    */
@@ -479,7 +647,7 @@ class PhotoSorterApp {
    */
   async updateCompressionStatus() {
     try {
-      const response = await fetch("/api/compression-status");
+      const response = await this.apiFetch("/api/compression-status");
       const data = await response.json();
       if (!data.success) {
         this.updateElement(
@@ -488,40 +656,28 @@ class PhotoSorterApp {
         );
         return;
       }
-      const { running, results, error } = data.data || {};
+      const { id, running, summary, error } = data.data || {};
       if (running) {
         this.updateElement("compressionStatus", "Compression in progress...");
       } else if (error) {
         this.updateElement("compressionStatus", "Compression error: " + error);
         if (this._compressionPollInterval) clearInterval(this._compressionPollInterval);
-      } else if (results && results.length > 0) {
+      } else if (id && summary && summary.total_files > 0) {
         this.updateElement("compressionStatus", "Compression finished.");
-        let compressed = results.filter(
-          (r) =>
-            r.action === "compressed" ||
-            r.Action === "compressed" ||
-            r.action === "original" ||
-            r.Action === "original",
-        );
-        if (compressed.length === 0) {
+        if (summary.files_processed === 0) {
           this.updateElement("compressionSummary", "All files were skipped (already compressed).");
           this.autoClearCompressionSummary();
         } else {
-          let origSize = 0,
-            compSize = 0;
-          for (const r of compressed) {
-            origSize += r.originalSize || r.OriginalSize || 0;
-            compSize += r.compressedSize || r.CompressedSize || 0;
-          }
-          let percent = origSize > 0 ? ((origSize - compSize) * 100) / origSize : 0;
-          const summary = [
-            `Original Size: ${this.formatSize(origSize)}`,
-            `Compressed Size: ${this.formatSize(compSize)}`,
-            `Saved (%): ${percent.toFixed(1)}`,
-          ].join("\n");
-          this.updateElement("compressionSummary", summary);
+          const lines = [
+            `Original Size: ${this.formatSize(summary.original_size)}`,
+            `Compressed Size: ${this.formatSize(summary.compressed_size)}`,
+            `Saved (%): ${summary.percent_saved.toFixed(1)}`,
+            `Files: ${summary.total_files} (${summary.compressed} compressed, ${summary.skipped} skipped, ${summary.cached || 0} cached, ${summary.errors} errors)`,
+          ];
+          this.updateElement("compressionSummary", lines.join("\n"));
           this.autoClearCompressionSummary();
         }
+        this.loadCompressionResults(id);
         if (this._compressionPollInterval) clearInterval(this._compressionPollInterval);
       } else {
         this.updateElement("compressionStatus", "");
@@ -534,27 +690,166 @@ class PhotoSorterApp {
   }
 
   /**
-   * Render compression results (legacy, not used)
+   * Load a page of the results of a finished compression into a table
    */
-  renderCompressionResults(results) {
-    this.updateElement("compressionResults", "");
-    if (!Array.isArray(results) || results.length === 0) {
-      this.updateElement("compressionSummary", "");
-      return;
+  async loadCompressionResults(id, offset = 0) {
+    const container = document.getElementById("compressionResults");
+    if (!container) return;
+    const action = this._compressionAction || "";
+    const params = new URLSearchParams({ offset, limit: 200 });
+    if (action) params.set("action", action);
+
+    try {
+      const response = await this.apiFetch(`/api/compression/${id}/results?${params}`);
+      const data = await response.json();
+      if (!data.success) throw new Error(data.error);
+      const page = data.data;
+
+      const actions = ["", ...Object.keys(page.counts).sort()];
+      const options = actions
+        .map(
+          (a) =>
+            `<option value="${this.escapeHtml(a)}"${a === action ? " selected" : ""}>${a ? `${this.escapeHtml(a)} (${page.counts[a]})` : "All actions"}</option>`,
+        )
+        .join("");
+      const rows = page.results
+        .map(
+          (r) =>
+            `<tr><td>${this.escapeHtml(r.input_path)}</td><td>${this.escapeHtml(r.action)}</td>` +
+            `<td>${this.formatSize(r.original_size)}</td><td>${this.formatSize(r.compressed_size)}</td>` +
+            `<td>${r.percentage_saved ? r.percentage_saved.toFixed(1) + "%" : ""}</td></tr>`,
+        )
+        .join("");
+      const end = offset + page.results.length;
+      // Links cannot send the Authorization header.
+      const csvParams = new URLSearchParams();
+      if (action) csvParams.set("action", action);
+      if (this.authToken) csvParams.set("token", this.authToken);
+      const csv = `/api/compression/${id}/results.csv?${csvParams}`;
+      container.innerHTML =
+        `<p><select id="compressionActionFilter">${options}</select> ` +
+        `Showing ${page.total > 0 ? offset + 1 : 0}-${end} of ${page.total} ` +
+        `<button id="compressionPrev"${offset > 0 ? "" : " disabled"}>Previous</button> ` +
+        `<button id="compressionNext"${end < page.total ? "" : " disabled"}>Next</button> ` +
+        `<a href="${csv}" download>Download CSV</a></p>` +
+        `<table><thead><tr><th>File</th><th>Action</th><th>Original</th><th>Compressed</th><th>Saved</th></tr></thead><tbody>${rows}</tbody></table>`;
+
+      document.getElementById("compressionActionFilter").addEventListener("change", (event) => {
+        this._compressionAction = event.target.value;
+        this.loadCompressionResults(id);
+      });
+      document.getElementById("compressionPrev").addEventListener("click", () => {
+        this.loadCompressionResults(id, Math.max(0, offset - page.limit));
+      });
+      document.getElementById("compressionNext").addEventListener("click", () => {
+        this.loadCompressionResults(id, end);
+      });
+    } catch (error) {
+      container.innerHTML = "";
+      console.error("Failed to load compression results:", error);
     }
-    let origSize = 0,
-      compSize = 0;
-    for (const r of results) {
-      origSize += r.originalSize || r.OriginalSize || 0;
-      compSize += r.compressedSize || r.CompressedSize || 0;
+  }
+
+  /**
+   * Load the latest audit log entries into a table
+   */
+  async loadAudit() {
+    const container = document.getElementById("auditResults");
+    if (!container) return;
+    try {
+      const response = await this.apiFetch("/api/audit?limit=100");
+      const data = await response.json();
+      if (!data.success) throw new Error(data.error);
+      const rows = data.data
+        .map((e) => {
+          const changes = Object.entries(e.changes || {})
+            .map(([field, c]) => `${field}: ${c.old} → ${c.new}`)
+            .join(", ");
+          const details = [e.job_id ? `job ${e.job_id}` : "", changes, e.error || ""].filter(Boolean).join("; ");
+          return (
+            `<tr><td>${this.escapeHtml(new Date(e.time).toLocaleString())}</td><td>${this.escapeHtml(e.user)}</td>` +
+            `<td>${this.escapeHtml(e.action)}</td><td>${this.escapeHtml(e.outcome)}</td><td>${this.escapeHtml(details)}</td></tr>`
+          );
+        })
+        .join("");
+      container.innerHTML = rows
+        ? `<table class="compression-results-table"><thead><tr><th>Time</th><th>User</th><th>Action</th><th>Outcome</th><th>Details</th></tr></thead><tbody>${rows}</tbody></table>`
+        : "<p>No activity recorded yet.</p>";
+    } catch (error) {
+      container.innerHTML = "";
+      console.error("Failed to load audit log:", error);
     }
-    let percent = origSize > 0 ? ((origSize - compSize) * 100) / origSize : 0;
-    const summary = [
-      `Original Size: ${this.formatBytes(origSize)}`,
-      `Compressed Size: ${this.formatBytes(compSize)}`,
-      `Saved (%): ${percent.toFixed(1)}`,
-    ].join("<br>");
-    this.updateElement("compressionSummary", summary);
+  }
+
+  /**
+   * Load the per-file report of the last scan or organization
+   */
+  async loadReport() {
+    try {
+      const response = await this.apiFetch("/api/report");
+      if (!response.ok) return;
+      const report = await response.json();
+      this.reportFiles = Array.isArray(report.files) ? report.files : [];
+      this.reportSort = { key: "source", asc: true };
+      this.renderReport();
+    } catch (error) {
+      console.error("Failed to load report:", error);
+    }
+  }
+
+  /**
+   * Render the report as a table sorted by the selected column
+   */
+  renderReport() {
+    const files = this.reportFiles || [];
+    if (files.length === 0) {
+      this.updateElement("reportResults", "");
+      return;
+    }
+    const { key, asc } = this.reportSort;
+    const sorted = [...files].sort((a, b) => {
+      const x = a[key] ?? "";
+      const y = b[key] ?? "";
+      const order = typeof x === "number" && typeof y === "number" ? x - y : String(x).localeCompare(String(y));
+      return asc ? order : -order;
+    });
+
+    // Rendering tens of thousands of rows would freeze the page.
+    const maxRows = 1000;
+    const columns = [
+      ["source", "Source"],
+      ["target", "Target"],
+      ["action", "Action"],
+      ["date", "Date"],
+      ["date_source", "Date Source"],
+      ["size", "Size"],
+    ];
+    const header = columns
+      .map(([k, label]) => `<th data-sort="${k}" style="cursor: pointer">${label}${k === key ? (asc ? " ▲" : " ▼") : ""}</th>`)
+      .join("");
+    const rows = sorted
+      .slice(0, maxRows)
+      .map(
+        (f) =>
+          `<tr><td>${this.escapeHtml(f.source || "")}</td><td>${this.escapeHtml(f.target || "")}</td>` +
+          `<td>${this.escapeHtml(f.action || "")}${f.reason ? ` (${this.escapeHtml(f.reason)})` : ""}</td>` +
+          `<td>${f.date ? this.escapeHtml(f.date.slice(0, 10)) : ""}</td><td>${this.escapeHtml(f.date_source || "")}</td>` +
+          `<td>${this.formatSize(f.size)}</td></tr>`,
+      )
+      .join("");
+    const note =
+      sorted.length > maxRows ? `<p>Showing ${maxRows} of ${sorted.length} files. <a href="/api/report" download="report.json">Download the full report</a></p>` : "";
+    const container = document.getElementById("reportResults");
+    if (!container) return;
+    container.innerHTML = `<table class="compression-results-table"><thead><tr>${header}</tr></thead><tbody>${rows}</tbody></table>${note}`;
+
+    document.querySelectorAll("#reportResults th[data-sort]").forEach((th) => {
+      th.addEventListener("click", () => {
+        const k = th.dataset.sort;
+        this.reportSort = { key: k, asc: this.reportSort.key === k ? !this.reportSort.asc : true };
+        this.renderReport();
+      });
+    });
   }
 
   /**
@@ -579,17 +874,62 @@ class PhotoSorterApp {
       .replace(/'/g, "&#39;");
   }
 
+  /**
+   * Fetch the messages about the last job that were sent while the
+   * connection was down; messages arriving meanwhile wait for them.
+   */
+  async catchUpJobEvents() {
+    if (!this.lastJobId || !this.lastSeq) return;
+    this.pendingMessages = [];
+    let caughtUp = 0; // seq of the last message fetched
+    try {
+      const params = new URLSearchParams({ since: this.lastSeq, log_level: this.logLevel });
+      const response = await this.apiFetch(`/api/jobs/${encodeURIComponent(this.lastJobId)}/events?${params}`);
+      const data = await response.json();
+      // A lower last_seq means the server has restarted since.
+      if (data.success && data.data.last_seq >= this.lastSeq) {
+        if (data.data.truncated) {
+          this.log("Some messages sent while disconnected are no longer available", "warning");
+        }
+        for (const message of data.data.events) {
+          this.handleWebSocketMessage(message, true);
+          caughtUp = message.seq;
+        }
+      }
+    } catch (error) {
+      console.error("Catch-up error:", error);
+    }
+    const pending = this.pendingMessages;
+    this.pendingMessages = null;
+    for (const message of pending) {
+      if (!message.seq || message.seq > caughtUp) this.handleWebSocketMessage(message);
+    }
+  }
+
   /**
    * Handle WebSocket messages
    */
-  handleWebSocketMessage(message) {
+  handleWebSocketMessage(message, catchingUp = false) {
     const { type, data } = message;
+    if (this.pendingMessages && !catchingUp) {
+      this.pendingMessages.push(message);
+      return;
+    }
+    if (message.seq) {
+      this.lastSeq = message.seq;
+    }
+    if (data && data.job_id) {
+      this.lastJobId = data.job_id;
+    }
 
     console.log("WebSocket message received:", { type, data, timestamp: new Date().toISOString() });
 
     switch (type) {
       case "log":
-        // Логи DRY-RUN/Would move/copy и др. из backend
+        // Log entries of the server at the chosen level and above
+        if (data && data.skipped) {
+          this.log(`${data.skipped} log messages skipped`, "info");
+        }
         this.log(
           data && data.message
             ? `[${data.timestamp || new Date().toLocaleTimeString()}] ${data.message}`
@@ -597,9 +937,22 @@ class PhotoSorterApp {
           data && data.level ? data.level : "info",
         );
         break;
+      case "progress":
+        // Sent after each batch of files; refresh the statistics right away.
+        this.updateStatus();
+        break;
+      case "stats_update":
+        this.updateLiveStats(data);
+        break;
       case "scan_started":
         console.log("Processing scan_started message:", data);
         this.log(`Scan started for: ${data.directory}`, "info");
+        if (data.options) {
+          this.log(
+            `Scan options: format ${data.options.date_format}, duplicates ${data.options.duplicate_handling}, ${data.options.move_files ? "move" : "copy"} to ${data.options.target_directory}`,
+            "info",
+          );
+        }
         break;
       case "scan_completed":
         let filesFound = null;
@@ -618,6 +971,7 @@ class PhotoSorterApp {
           this.log("Scan completed successfully", "success");
         }
         this.showAlert("Scan completed!", "success");
+        this.loadReport();
         break;
       case "scan_error":
         this.log(`Scan error: ${data.error}`, "error");
@@ -626,8 +980,9 @@ class PhotoSorterApp {
       case "organize_started":
         {
           const targetInfo = data.target_directory ? ` → ${data.target_directory}` : " (in place)";
+          const sources = data.options?.source_directories?.join(", ") || data.source_directory;
           this.log(
-            `Organization started (${data.dry_run ? "DRY RUN" : "LIVE"}) for: ${data.source_directory}${targetInfo}`,
+            `Organization started (${data.dry_run ? "DRY RUN" : "LIVE"}) for: ${sources}${targetInfo}`,
             "info",
           );
         }
@@ -635,31 +990,40 @@ class PhotoSorterApp {
       case "organize_completed":
         this.log("Organization completed successfully", "success");
         this.showAlert("Organization completed!", "success");
+        this.loadReport();
         break;
       case "organize_error":
         this.log(`Organization error: ${data.error}`, "error");
         this.showAlert(`Organization failed: ${data.error}`, "error");
         break;
       case "compression_started":
-        this.log("Compression started", "info");
+        this.log(
+          `Compression started (${data.dry_run ? "DRY RUN" : "LIVE"}) for: ${data.directory} -> ${data.target_directory}, quality ${data.quality}, threshold ${data.threshold}`,
+          "info",
+        );
         this.showAlert("Compression started...", "info");
         break;
+      case "compression_progress":
+        {
+          const percent = data.total > 0 ? (data.done * 100) / data.total : 0;
+          this.updateElement(
+            "compressionStatus",
+            `Compressing: ${data.done}/${data.total} files (${percent.toFixed(0)}%), ${this.formatSize(data.bytes_saved || 0)} saved`,
+          );
+        }
+        break;
+      case "compression_stopped":
       case "compression_completed":
         {
+          this.toggleElement("stopCompressionBtn", false);
           let origSize = 0,
             compSize = 0,
             percent = 0;
           if (Array.isArray(data.results) && data.results.length > 0) {
-            let compressed = data.results.filter(
-              (r) =>
-                r.action === "compressed" ||
-                r.Action === "compressed" ||
-                r.action === "original" ||
-                r.Action === "original",
-            );
+            const compressed = data.results.filter((r) => r.action === "compressed" || r.action === "original");
             for (const r of compressed) {
-              origSize += r.originalSize || r.OriginalSize || 0;
-              compSize += r.compressedSize || r.CompressedSize || 0;
+              origSize += r.original_size || 0;
+              compSize += r.compressed_size || 0;
             }
             percent = origSize > 0 ? ((origSize - compSize) * 100) / origSize : 0;
           } else if (
@@ -670,11 +1034,23 @@ class PhotoSorterApp {
             compSize = data.compressed_size;
             percent = typeof data.percent_saved === "number" ? data.percent_saved : 0;
           }
-          let msg = "Compression finished";
+          let msg = type === "compression_stopped" ? "Compression stopped" : "Compression finished";
+          if (data.dry_run) {
+            msg = type === "compression_stopped" ? "Dry run stopped" : "Dry run finished";
+          }
           if (typeof data.files_processed !== "undefined") {
             msg += `: ${data.files_processed} files`;
           }
+          if (data.files_cached) {
+            msg += ` (${data.files_cached} unchanged since the last run)`;
+          }
           msg += ` | Original Size: ${this.formatSize(origSize)}, Compressed Size: ${this.formatSize(compSize)}, Saved: ${percent.toFixed(1)}%`;
+          if (data.dry_run) {
+            msg += `, Projected savings: ${this.formatSize(data.projected_saved || 0)}`;
+          }
+          if (typeof data.duration_ms === "number") {
+            msg += `, Time: ${(data.duration_ms / 1000).toFixed(1)}s`;
+          }
           this.log(msg, "success");
           if (
             typeof data.files_processed === "number" &&
@@ -686,23 +1062,44 @@ class PhotoSorterApp {
               "All files were skipped (already compressed).",
             );
           } else {
-            const summary = [
+            const lines = [
               `Original Size: ${this.formatSize(origSize)}`,
               `Compressed Size: ${this.formatSize(compSize)}`,
               `Saved (%): ${percent.toFixed(1)}`,
-            ].join("\n");
+            ];
+            if (data.dry_run) {
+              lines.unshift("Dry run, no files written");
+              lines.push(`Projected savings: ${this.formatSize(data.projected_saved || 0)}`);
+            }
+            if (data.files_cached) {
+              lines.push(`Unchanged since the last run: ${data.files_cached} files`);
+            }
+            const summary = lines.join("\n");
             this.updateElement("compressionSummary", summary);
             this.autoClearCompressionSummary();
           }
         }
         break;
       case "compression_error":
+        this.toggleElement("stopCompressionBtn", false);
         this.log(`Compression error: ${data.error || ""}`, "error");
         this.showAlert(`Compression failed: ${data.error || ""}`, "error");
         break;
       case "operation_stopped":
         this.log("Operation stopped by user", "info");
         break;
+      case "config_reloaded":
+        // The config file changed or the server received SIGHUP
+        this.log(`Configuration reloaded: ${(data.changed || []).join(", ")}`, "info");
+        if (data.restart && data.restart.length) {
+          this.log(`Restart the server to apply ${data.restart.join(", ")}`, "warning");
+        }
+        this.loadConfig();
+        break;
+      case "config_reload_failed":
+        this.log(`Configuration reload rejected: ${data.error}`, "error");
+        this.showAlert(`The changed configuration was rejected: ${data.error}`, "warning");
+        break;
       case "progress_update":
         if (data.statistics) {
           this.updateUI({ running: true, statistics: data.statistics });
@@ -775,6 +1172,22 @@ class PhotoSorterApp {
     }
   }
 
+  /**
+   * Fetch an API endpoint with the login token, asking to log in if the
+   * server requires it
+   */
+  async apiFetch(url, options = {}) {
+    const headers = { ...(options.headers || {}) };
+    if (this.authToken) {
+      headers.Authorization = `Bearer ${this.authToken}`;
+    }
+    const response = await fetch(url, { ...options, headers });
+    if (response.status === 401) {
+      this.showLogin();
+    }
+    return response;
+  }
+
   /**
    * Fetch with timeout
    */
@@ -783,7 +1196,7 @@ class PhotoSorterApp {
     const timeoutId = setTimeout(() => controller.abort(), timeout);
 
     try {
-      const response = await fetch(url, {
+      const response = await this.apiFetch(url, {
         ...options,
         signal: controller.signal,
       });
@@ -828,6 +1241,40 @@ class PhotoSorterApp {
     return isValid;
   }
 
+  /**
+   * Show the size of the source's media files and the target's free space
+   */
+  async loadOverview() {
+    const sourceDir = this.getInputValue("sourceDir");
+    const targetDir = this.getInputValue("targetDir");
+    if (!sourceDir.startsWith("/") && !sourceDir.match(/^[A-Za-z]:/)) {
+      this.updateElement("dirOverview", "");
+      return;
+    }
+
+    try {
+      const params = new URLSearchParams({ source: sourceDir });
+      for (const dir of this.getExtraSources()) params.append("source", dir);
+      if (targetDir) params.set("target", targetDir);
+      const response = await this.fetchWithTimeout(`/api/overview?${params}`);
+      const data = await response.json();
+      if (!data.success) throw new Error(data.error);
+
+      const { source, target, space_check: check } = data.data;
+      let text = `${source.partial ? "At least " : ""}${source.files} media files, ${this.formatSize(source.bytes)}`;
+      if (!target.error) {
+        text += ` · ${this.formatSize(target.available)} free on target`;
+      }
+      if (check && !check.sufficient) {
+        text += " · ⚠️ not enough free space";
+      }
+      this.updateElement("dirOverview", text);
+    } catch (error) {
+      this.updateElement("dirOverview", "");
+      console.error("Overview error:", error);
+    }
+  }
+
   /**
    * Update input validation state
    */
@@ -891,6 +1338,38 @@ class PhotoSorterApp {
     return element ? element.value.trim() : "";
   }
 
+  /**
+   * Get the maximum files, exclude patterns and minimum size of a run
+   */
+  getRunLimits() {
+    return {
+      max_files: parseInt(this.getInputValue("maxFiles"), 10) || 0,
+      exclude_patterns: this.getInputValue("excludePatterns")
+        .split(",")
+        .map((pattern) => pattern.trim())
+        .filter(Boolean),
+      min_file_size: this.getInputValue("minFileSize"),
+    };
+  }
+
+  /**
+   * Get the duplicate handling of the config with the selected default
+   * strategy; the strategies of videos and RAW files are kept
+   */
+  getDuplicatePolicy() {
+    return { ...this.duplicatePolicy, default: this.getSelectValue("duplicateHandling") };
+  }
+
+  /**
+   * Get the additional source directories, one per line
+   */
+  getExtraSources() {
+    return this.getInputValue("extraSourceDirs")
+      .split("\n")
+      .map((line) => line.trim())
+      .filter(Boolean);
+  }
+
   /**
    * Set input value
    */
@@ -978,17 +1457,29 @@ class PhotoSorterApp {
 
         this.setSelectValue("dateFormat", config.date_format || "2006/01/02");
         this.setCheckboxValue("moveFilesCheck", config.move_files !== false);
-        this.setSelectValue("duplicateHandling", config.duplicate_handling || "rename");
+        this.duplicatePolicy = config.duplicate_handling || {};
+        this.setSelectValue("duplicateHandling", this.duplicatePolicy.default || "rename");
         this.setCheckboxValue("dryRunCheck", config.dry_run !== false);
 
-        if (config.source_directory) {
-          this.setInputValue("sourceDir", config.source_directory);
+        // Sources with settings of their own are organized in the same run.
+        const sources = (config.sources || []).map((source) => source.path);
+        const dirs = [config.source_directory, ...(config.source_directories || []), ...sources].filter(Boolean);
+        if (dirs.length > 0) {
+          this.setInputValue("sourceDir", dirs[0]);
         }
+        this.setInputValue("extraSourceDirs", dirs.slice(1).join("\n"));
         if (config.target_directory) {
           this.setInputValue("targetDir", config.target_directory);
         }
 
+        const notice = document.getElementById("configNotice");
+        if (notice) {
+          notice.textContent = config.notice || "";
+          notice.classList.toggle("d-none", !config.notice);
+        }
+
         this.updateConfigDisplay();
+        this.loadOverview();
         this.log("Configuration loaded successfully", "info");
       } else {
         throw new Error(data.error || "Failed to load config");
@@ -1006,10 +1497,11 @@ class PhotoSorterApp {
       const config = {
         date_format: this.getSelectValue("dateFormat"),
         move_files: this.getCheckboxValue("moveFilesCheck"),
-        duplicate_handling: this.getSelectValue("duplicateHandling"),
+        duplicate_handling: this.getDuplicatePolicy(),
         dry_run: this.getCheckboxValue("dryRunCheck"),
         source_directory: this.getInputValue("sourceDir"),
         target_directory: this.getInputValue("targetDir") || null,
+        persist: this.getCheckboxValue("persistConfigCheck"),
       };
 
       const response = await this.fetchWithTimeout("/api/config", {
@@ -1020,7 +1512,11 @@ class PhotoSorterApp {
 
       const data = await response.json();
       if (data.success) {
-        this.log("Configuration saved", "info");
+        this.log(data.message || "Configuration saved", "info");
+        const notice = document.getElementById("configNotice");
+        if (notice && config.persist) {
+          notice.classList.add("d-none");
+        }
         this.updateConfigDisplay();
       } else {
         throw new Error(data.error || "Failed to save config");
@@ -1050,6 +1546,9 @@ class PhotoSorterApp {
         2006: "Year Only",
         "2006-01-02": "Year-Month-Day",
         "2006-01": "Year-Month",
+        "{year}/{month}-{month_name}": "Year/Month Name",
+        "{year}/Q{quarter}": "Year/Quarter",
+        "{week_year}/W{week}": "Year/Week",
       }[dateFormat] || dateFormat;
 
     const configText = `
@@ -1073,6 +1572,60 @@ class PhotoSorterApp {
     }
   }
 
+  /**
+   * Bind the login form shown when the server requires authentication
+   */
+  bindLoginForm() {
+    const form = document.getElementById("loginForm");
+    if (form) {
+      form.addEventListener("submit", (event) => {
+        event.preventDefault();
+        this.login();
+      });
+    }
+  }
+
+  /**
+   * Show the login form, forgetting a token the server no longer accepts
+   */
+  showLogin() {
+    if (this.authToken) {
+      this.authToken = "";
+      localStorage.removeItem("photoSorterToken");
+    }
+    const overlay = document.getElementById("loginOverlay");
+    if (overlay) {
+      overlay.style.display = "flex";
+    }
+  }
+
+  /**
+   * Log in with a username and password, or with the token alone, and
+   * reload the page with the token the server returns
+   */
+  async login() {
+    const username = this.getInputValue("loginUsername");
+    const password = document.getElementById("loginPassword").value;
+    const body = username ? { username, password } : { token: password };
+    try {
+      const response = await fetch("/api/login", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body),
+      });
+      const data = await response.json();
+      if (!data.success) {
+        throw new Error(data.error || "Login failed");
+      }
+      if (data.data && data.data.token) {
+        localStorage.setItem("photoSorterToken", data.data.token);
+      }
+      window.location.reload();
+    } catch (error) {
+      this.updateElement("loginError", error.message);
+    }
+  }
+
   /**
    * Escape HTML to prevent XSS
    */
@@ -1089,6 +1642,9 @@ class PhotoSorterApp {
     if (this.ws && this.ws.readyState === WebSocket.OPEN) {
       this.ws.close();
     }
+    if (this.eventSource) {
+      this.eventSource.close();
+    }
     if (this._compressionPollInterval) {
       clearInterval(this._compressionPollInterval);
       this._compressionPollInterval = null;